@@ -0,0 +1,344 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	"github.com/bluek8s/kubedirector/pkg/catalog"
+	"github.com/bluek8s/kubedirector/pkg/conformance"
+	"github.com/bluek8s/kubedirector/pkg/e2e"
+	"github.com/bluek8s/kubedirector/pkg/executor"
+	"github.com/bluek8s/kubedirector/pkg/lint"
+	"github.com/bluek8s/kubedirector/pkg/shared"
+	"github.com/bluek8s/kubedirector/pkg/usage"
+	"github.com/spf13/pflag"
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+	"sigs.k8s.io/yaml"
+)
+
+const usageText = `Usage: kd <command> [flags]
+
+Commands:
+  app verify   Check that a KubeDirectorApp behaves correctly under
+               KubeDirector, by deploying it in a scratch namespace and
+               exercising create/expand/shrink/reconfigure/restore/delete.
+  top          Show the CPU and memory usage of virtual cluster members,
+               per member, role, and cluster, marking the hot members.
+  render       Show the statefulsets, services, and PVC templates that
+               KubeDirector would create for a KubeDirectorCluster
+               manifest, without creating anything.
+  validate     Check a KubeDirectorCluster manifest for settings that are
+               valid but likely to cause trouble, reporting coded findings.
+`
+
+func main() {
+
+	if (len(os.Args) >= 3) && (os.Args[1] == "app") && (os.Args[2] == "verify") {
+		os.Exit(appVerify(os.Args[3:]))
+	}
+	if (len(os.Args) >= 2) && (os.Args[1] == "top") {
+		os.Exit(top(os.Args[2:]))
+	}
+	if (len(os.Args) >= 2) && (os.Args[1] == "render") {
+		os.Exit(render(os.Args[2:]))
+	}
+	if (len(os.Args) >= 2) && (os.Args[1] == "validate") {
+		os.Exit(validate(os.Args[2:]))
+	}
+	fmt.Fprint(os.Stderr, usageText)
+	os.Exit(2)
+}
+
+// appVerify implements "kd app verify", returning the process exit code.
+func appVerify(
+	args []string,
+) int {
+
+	flags := pflag.NewFlagSet("kd app verify", pflag.ContinueOnError)
+	appPath := flags.String("app", "", "KubeDirectorApp manifest to verify (required)")
+	clusterPath := flags.String("cluster", "", "KubeDirectorCluster manifest to use instead of a generated one")
+	kubeconfig := flags.String("kubeconfig", "", "path to the kubeconfig file")
+	timeout := flags.Duration("timeout", conformance.DefaultStepTimeout, "time limit for each step")
+	output := flags.String("output", "text", "report format: text or json")
+	keep := flags.Bool("keep-namespace", false, "do not delete the scratch namespace afterward")
+	if parseErr := flags.Parse(args); parseErr != nil {
+		return 2
+	}
+	if (*appPath == "") || ((*output != "text") && (*output != "json")) {
+		fmt.Fprint(os.Stderr, "kd app verify: --app is required, and --output must be text or json\n")
+		flags.PrintDefaults()
+		return 2
+	}
+
+	f, fwErr := e2e.New(&e2e.KubeconfigEnvironment{Path: *kubeconfig})
+	if fwErr != nil {
+		fmt.Fprintf(os.Stderr, "kd app verify: %v\n", fwErr)
+		return 1
+	}
+	start := time.Now()
+	report, verifyErr := conformance.Verify(
+		f,
+		conformance.Options{
+			AppPath:       *appPath,
+			ClusterPath:   *clusterPath,
+			Timeout:       *timeout,
+			KeepNamespace: *keep,
+		},
+	)
+	if teardownErr := f.Teardown(); teardownErr != nil {
+		fmt.Fprintf(os.Stderr, "kd app verify: cleanup failed: %v\n", teardownErr)
+	}
+	if verifyErr != nil {
+		fmt.Fprintf(os.Stderr, "kd app verify: %v\n", verifyErr)
+		return 1
+	}
+
+	var writeErr error
+	if *output == "json" {
+		writeErr = report.WriteJSON(os.Stdout)
+	} else {
+		writeErr = report.WriteText(os.Stdout)
+		fmt.Printf("Total time: %v\n", time.Since(start).Round(time.Second))
+	}
+	if writeErr != nil {
+		fmt.Fprintf(os.Stderr, "kd app verify: %v\n", writeErr)
+		return 1
+	}
+	if !report.Passed() {
+		return 1
+	}
+	return 0
+}
+
+// top implements "kd top [cluster]", returning the process exit code.
+func top(
+	args []string,
+) int {
+
+	flags := pflag.NewFlagSet("kd top", pflag.ContinueOnError)
+	namespace := flags.StringP("namespace", "n", "default", "namespace of the virtual clusters")
+	kubeconfig := flags.String("kubeconfig", "", "path to the kubeconfig file")
+	sortBy := flags.String("sort-by", usage.SortName, "order of the members in each role: name, cpu, or memory")
+	cpuThreshold := flags.Int64("cpu-threshold", usage.DefaultThreshold, "percent of app container CPU limit (or request) that makes a member hot; 0 to ignore")
+	memoryThreshold := flags.Int64("memory-threshold", usage.DefaultThreshold, "percent of app container memory limit (or request) that makes a member hot; 0 to ignore")
+	hotOnly := flags.Bool("hot-only", false, "list only the hot members")
+	output := flags.String("output", "text", "report format: text or json")
+	if parseErr := flags.Parse(args); parseErr != nil {
+		return 2
+	}
+	validSort := (*sortBy == usage.SortName) || (*sortBy == usage.SortCPU) || (*sortBy == usage.SortMemory)
+	if (flags.NArg() > 1) || !validSort || ((*output != "text") && (*output != "json")) {
+		fmt.Fprint(os.Stderr, "kd top: at most one cluster may be named, --sort-by must be name, cpu, or memory, and --output must be text or json\n")
+		flags.PrintDefaults()
+		return 2
+	}
+
+	f, fwErr := e2e.New(&e2e.KubeconfigEnvironment{Path: *kubeconfig})
+	if fwErr != nil {
+		fmt.Fprintf(os.Stderr, "kd top: %v\n", fwErr)
+		return 1
+	}
+	defer f.Teardown()
+	report, snapshotErr := usage.Snapshot(
+		f.Client,
+		usage.Options{
+			Namespace:       *namespace,
+			Cluster:         flags.Arg(0),
+			SortBy:          *sortBy,
+			CPUThreshold:    *cpuThreshold,
+			MemoryThreshold: *memoryThreshold,
+			HotOnly:         *hotOnly,
+		},
+	)
+	if snapshotErr != nil {
+		fmt.Fprintf(os.Stderr, "kd top: %v\n", snapshotErr)
+		return 1
+	}
+
+	var writeErr error
+	if *output == "json" {
+		writeErr = report.WriteJSON(os.Stdout)
+	} else {
+		writeErr = report.WriteText(os.Stdout)
+	}
+	if writeErr != nil {
+		fmt.Fprintf(os.Stderr, "kd top: %v\n", writeErr)
+		return 1
+	}
+	return 0
+}
+
+// render implements "kd render", returning the process exit code.
+func render(
+	args []string,
+) int {
+
+	flags := pflag.NewFlagSet("kd render", pflag.ContinueOnError)
+	clusterPath := flags.StringP("filename", "f", "", "KubeDirectorCluster manifest to render (required)")
+	namespace := flags.StringP("namespace", "n", "", "namespace of the virtual cluster, if not the one in the manifest")
+	kubeconfig := flags.String("kubeconfig", "", "path to the kubeconfig file")
+	output := flags.StringP("output", "o", "yaml", "output format: yaml or json")
+	if parseErr := flags.Parse(args); parseErr != nil {
+		return 2
+	}
+	if (*clusterPath == "") || ((*output != "yaml") && (*output != "json")) {
+		fmt.Fprint(os.Stderr, "kd render: --filename is required, and --output must be yaml or json\n")
+		flags.PrintDefaults()
+		return 2
+	}
+
+	f, fwErr := e2e.New(&e2e.KubeconfigEnvironment{Path: *kubeconfig})
+	if fwErr != nil {
+		fmt.Fprintf(os.Stderr, "kd render: %v\n", fwErr)
+		return 1
+	}
+	defer f.Teardown()
+	// The executor looks up the app and the KubeDirector config through
+	// the shared client.
+	shared.SetClient(f.Client)
+	cr, dryRunErr := f.DryRunCluster(*namespace, *clusterPath)
+	if dryRunErr != nil {
+		fmt.Fprintf(os.Stderr, "kd render: %v\n", dryRunErr)
+		return 1
+	}
+	rendered, renderErr := executor.Render(logf.Log.WithName("kd-render"), cr)
+	if renderErr != nil {
+		fmt.Fprintf(os.Stderr, "kd render: %v\n", renderErr)
+		return 1
+	}
+
+	if *output == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if encodeErr := encoder.Encode(rendered); encodeErr != nil {
+			fmt.Fprintf(os.Stderr, "kd render: %v\n", encodeErr)
+			return 1
+		}
+		return 0
+	}
+	var objects []interface{}
+	for _, sset := range rendered.StatefulSets {
+		objects = append(objects, sset)
+	}
+	for _, service := range rendered.Services {
+		objects = append(objects, service)
+	}
+	for _, obj := range objects {
+		doc, marshalErr := yaml.Marshal(obj)
+		if marshalErr != nil {
+			fmt.Fprintf(os.Stderr, "kd render: %v\n", marshalErr)
+			return 1
+		}
+		fmt.Printf("---\n%s", doc)
+	}
+	return 0
+}
+
+// validate implements "kd validate", returning the process exit code. The
+// exit code is 1 if any finding has the error severity.
+func validate(
+	args []string,
+) int {
+
+	flags := pflag.NewFlagSet("kd validate", pflag.ContinueOnError)
+	clusterPath := flags.StringP("filename", "f", "", "KubeDirectorCluster manifest to check (required)")
+	appPath := flags.String("app", "", "KubeDirectorApp manifest of the cluster's app, instead of looking it up")
+	namespace := flags.StringP("namespace", "n", "", "namespace of the virtual cluster, if not the one in the manifest")
+	kubeconfig := flags.String("kubeconfig", "", "path to the kubeconfig file")
+	offline := flags.Bool("offline", false, "do not contact K8s: use the default severities, and skip the app checks unless --app is given")
+	output := flags.StringP("output", "o", "text", "report format: text or json")
+	if parseErr := flags.Parse(args); parseErr != nil {
+		return 2
+	}
+	if (*clusterPath == "") || ((*output != "text") && (*output != "json")) {
+		fmt.Fprint(os.Stderr, "kd validate: --filename is required, and --output must be text or json\n")
+		flags.PrintDefaults()
+		return 2
+	}
+
+	cr := &kdv1.KubeDirectorCluster{}
+	if readErr := e2e.ReadTyped(*clusterPath, cr); readErr != nil {
+		fmt.Fprintf(os.Stderr, "kd validate: %v\n", readErr)
+		return 1
+	}
+	if *namespace != "" {
+		cr.Namespace = *namespace
+	} else if cr.Namespace == "" {
+		cr.Namespace = "default"
+	}
+	var appCR *kdv1.KubeDirectorApp
+	if *appPath != "" {
+		appCR = &kdv1.KubeDirectorApp{}
+		if readErr := e2e.ReadTyped(*appPath, appCR); readErr != nil {
+			fmt.Fprintf(os.Stderr, "kd validate: %v\n", readErr)
+			return 1
+		}
+	}
+	severities := map[string]string{}
+	if !*offline {
+		f, fwErr := e2e.New(&e2e.KubeconfigEnvironment{Path: *kubeconfig})
+		if fwErr != nil {
+			fmt.Fprintf(os.Stderr, "kd validate: %v\n", fwErr)
+			return 1
+		}
+		defer f.Teardown()
+		// The catalog looks up the app through the shared client.
+		shared.SetClient(f.Client)
+		if appCR == nil {
+			var appErr error
+			appCR, appErr = catalog.FindApp(cr)
+			if appErr != nil {
+				fmt.Fprintf(os.Stderr, "kd validate: %v\n", appErr)
+				return 1
+			}
+		}
+		configs := &kdv1.KubeDirectorConfigList{}
+		if listErr := f.Client.List(context.TODO(), configs); listErr != nil {
+			fmt.Fprintf(os.Stderr, "kd validate: %v\n", listErr)
+			return 1
+		}
+		for _, config := range configs.Items {
+			if config.Name == shared.KubeDirectorGlobalConfig {
+				severities = config.Spec.LintSeverities
+			}
+		}
+	}
+
+	report := &lint.Report{
+		Namespace: cr.Namespace,
+		Cluster:   cr.Name,
+		App:       cr.Spec.AppID,
+		Findings:  lint.Cluster(cr, appCR, severities),
+	}
+	var writeErr error
+	if *output == "json" {
+		writeErr = report.WriteJSON(os.Stdout)
+	} else {
+		writeErr = report.WriteText(os.Stdout)
+	}
+	if writeErr != nil {
+		fmt.Fprintf(os.Stderr, "kd validate: %v\n", writeErr)
+		return 1
+	}
+	if report.HasErrors() {
+		return 1
+	}
+	return 0
+}
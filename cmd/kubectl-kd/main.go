@@ -0,0 +1,265 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/bluek8s/kubedirector/pkg/e2e"
+	"github.com/bluek8s/kubedirector/pkg/inspect"
+	"github.com/spf13/pflag"
+)
+
+const usageText = `Usage: kubectl kd <command> [flags]
+
+Commands:
+  get                        List the virtual clusters in a namespace.
+  members CLUSTER            Show the state, pod, node, and storage claims
+                             of each member of a virtual cluster.
+  logs CLUSTER MEMBER        Show the output of the app setup in a member.
+  restart CLUSTER MEMBER...  Restart members of a virtual cluster, one at a
+                             time; with --role, restart every member of
+                             that role.
+`
+
+func main() {
+
+	if len(os.Args) >= 2 {
+		switch os.Args[1] {
+		case "get":
+			os.Exit(get(os.Args[2:]))
+		case "members":
+			os.Exit(members(os.Args[2:]))
+		case "logs":
+			os.Exit(logs(os.Args[2:]))
+		case "restart":
+			os.Exit(restart(os.Args[2:]))
+		}
+	}
+	fmt.Fprint(os.Stderr, usageText)
+	os.Exit(2)
+}
+
+// commonFlags returns a flag set for the named command with the flags that
+// every command has: the namespace and kubeconfig.
+func commonFlags(
+	command string,
+) (*pflag.FlagSet, *string, *string) {
+
+	flags := pflag.NewFlagSet("kubectl kd "+command, pflag.ContinueOnError)
+	namespace := flags.StringP("namespace", "n", "default", "namespace of the virtual clusters")
+	kubeconfig := flags.String("kubeconfig", "", "path to the kubeconfig file")
+	return flags, namespace, kubeconfig
+}
+
+// connect returns a framework for the cluster named by the kubeconfig,
+// reporting any failure for the given command.
+func connect(
+	command string,
+	kubeconfig string,
+) *e2e.Framework {
+
+	f, fwErr := e2e.New(&e2e.KubeconfigEnvironment{Path: kubeconfig})
+	if fwErr != nil {
+		fmt.Fprintf(os.Stderr, "kubectl kd %s: %v\n", command, fwErr)
+		return nil
+	}
+	return f
+}
+
+// writeJSON writes the value as indented JSON to stdout.
+func writeJSON(
+	value interface{},
+) error {
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
+
+// get implements "kubectl kd get", returning the process exit code.
+func get(
+	args []string,
+) int {
+
+	flags, namespace, kubeconfig := commonFlags("get")
+	output := flags.StringP("output", "o", "text", "output format: text or json")
+	if parseErr := flags.Parse(args); parseErr != nil {
+		return 2
+	}
+	if (flags.NArg() != 0) || ((*output != "text") && (*output != "json")) {
+		fmt.Fprint(os.Stderr, "kubectl kd get: no arguments are allowed, and --output must be text or json\n")
+		flags.PrintDefaults()
+		return 2
+	}
+
+	f := connect("get", *kubeconfig)
+	if f == nil {
+		return 1
+	}
+	defer f.Teardown()
+	clusters, listErr := inspect.ListClusters(f.Client, *namespace)
+	if listErr != nil {
+		fmt.Fprintf(os.Stderr, "kubectl kd get: %v\n", listErr)
+		return 1
+	}
+	var writeErr error
+	if *output == "json" {
+		writeErr = writeJSON(clusters)
+	} else {
+		writeErr = inspect.WriteClustersText(os.Stdout, clusters)
+	}
+	if writeErr != nil {
+		fmt.Fprintf(os.Stderr, "kubectl kd get: %v\n", writeErr)
+		return 1
+	}
+	return 0
+}
+
+// members implements "kubectl kd members", returning the process exit code.
+func members(
+	args []string,
+) int {
+
+	flags, namespace, kubeconfig := commonFlags("members")
+	output := flags.StringP("output", "o", "text", "output format: text or json")
+	if parseErr := flags.Parse(args); parseErr != nil {
+		return 2
+	}
+	if (flags.NArg() != 1) || ((*output != "text") && (*output != "json")) {
+		fmt.Fprint(os.Stderr, "kubectl kd members: exactly one cluster must be named, and --output must be text or json\n")
+		flags.PrintDefaults()
+		return 2
+	}
+
+	f := connect("members", *kubeconfig)
+	if f == nil {
+		return 1
+	}
+	defer f.Teardown()
+	details, listErr := inspect.ListMembers(f.Client, *namespace, flags.Arg(0))
+	if listErr != nil {
+		fmt.Fprintf(os.Stderr, "kubectl kd members: %v\n", listErr)
+		return 1
+	}
+	var writeErr error
+	if *output == "json" {
+		writeErr = writeJSON(details)
+	} else {
+		writeErr = inspect.WriteMembersText(os.Stdout, details)
+	}
+	if writeErr != nil {
+		fmt.Fprintf(os.Stderr, "kubectl kd members: %v\n", writeErr)
+		return 1
+	}
+	return 0
+}
+
+// logs implements "kubectl kd logs", returning the process exit code.
+func logs(
+	args []string,
+) int {
+
+	flags, namespace, kubeconfig := commonFlags("logs")
+	stderr := flags.Bool("stderr", false, "show the standard error of the setup instead of its standard output")
+	tail := flags.Int("tail", inspect.DefaultTailLines, "number of lines to show")
+	follow := flags.BoolP("follow", "f", false, "keep showing new output")
+	if parseErr := flags.Parse(args); parseErr != nil {
+		return 2
+	}
+	if (flags.NArg() != 2) || (*tail < 0) {
+		fmt.Fprint(os.Stderr, "kubectl kd logs: a cluster and one of its members must be named, and --tail cannot be negative\n")
+		flags.PrintDefaults()
+		return 2
+	}
+
+	f := connect("logs", *kubeconfig)
+	if f == nil {
+		return 1
+	}
+	defer f.Teardown()
+	// Make sure the member is in the named cluster.
+	if _, roleErr := inspect.MemberRole(f.Client, *namespace, flags.Arg(0), flags.Arg(1)); roleErr != nil {
+		fmt.Fprintf(os.Stderr, "kubectl kd logs: %v\n", roleErr)
+		return 1
+	}
+	which := inspect.SetupStdout
+	if *stderr {
+		which = inspect.SetupStderr
+	}
+	tailErr := inspect.TailSetupLog(
+		f.Config,
+		f.Client,
+		*namespace,
+		flags.Arg(1),
+		which,
+		*tail,
+		*follow,
+		os.Stdout,
+	)
+	if tailErr != nil {
+		fmt.Fprintf(os.Stderr, "kubectl kd logs: %v\n", tailErr)
+		return 1
+	}
+	return 0
+}
+
+// restart implements "kubectl kd restart", returning the process exit code.
+func restart(
+	args []string,
+) int {
+
+	flags, namespace, kubeconfig := commonFlags("restart")
+	role := flags.String("role", "", "restart every member of this role")
+	if parseErr := flags.Parse(args); parseErr != nil {
+		return 2
+	}
+	if (flags.NArg() < 1) || ((*role == "") == (flags.NArg() == 1)) {
+		fmt.Fprint(os.Stderr, "kubectl kd restart: a cluster must be named, followed by either members or --role\n")
+		flags.PrintDefaults()
+		return 2
+	}
+
+	f := connect("restart", *kubeconfig)
+	if f == nil {
+		return 1
+	}
+	defer f.Teardown()
+	clusterName := flags.Arg(0)
+	podNames := flags.Args()[1:]
+	roleName := *role
+	// Named members must all be in the same role.
+	for _, podName := range podNames {
+		memberRole, roleErr := inspect.MemberRole(f.Client, *namespace, clusterName, podName)
+		if roleErr != nil {
+			fmt.Fprintf(os.Stderr, "kubectl kd restart: %v\n", roleErr)
+			return 1
+		}
+		if (roleName != "") && (memberRole != roleName) {
+			fmt.Fprint(os.Stderr, "kubectl kd restart: the members must all be in the same role\n")
+			return 2
+		}
+		roleName = memberRole
+	}
+	generation, restartErr := inspect.RestartMembers(f.Client, *namespace, clusterName, roleName, podNames)
+	if restartErr != nil {
+		fmt.Fprintf(os.Stderr, "kubectl kd restart: %v\n", restartErr)
+		return 1
+	}
+	fmt.Printf("restart generation %d requested for role %s of cluster %s\n", generation, roleName, clusterName)
+	return 0
+}
@@ -28,6 +28,8 @@ import (
 
 	"github.com/bluek8s/kubedirector/pkg/apis"
 	"github.com/bluek8s/kubedirector/pkg/controller"
+	"github.com/bluek8s/kubedirector/pkg/crdupgrade"
+	"github.com/bluek8s/kubedirector/pkg/extension"
 	"github.com/bluek8s/kubedirector/pkg/observer"
 	"github.com/bluek8s/kubedirector/pkg/shared"
 	"github.com/bluek8s/kubedirector/pkg/validator"
@@ -86,6 +88,15 @@ func main() {
 
 	printVersion()
 
+	// Fault injection is only for resilience testing, and is normally off.
+	shared.LoadFaultConfig()
+
+	// Without a config to talk to the apiserver there are no clients; the
+	// shared package has already logged why.
+	if shared.Config() == nil {
+		os.Exit(1)
+	}
+
 	// Create the overall controller-runtime manager. Note that it will watch
 	// all namespaces because of the specified emptystring for Namespace.
 	// (We'll reject KubeDirectorConfig requests in the validator when the
@@ -108,6 +119,10 @@ func main() {
 
 	log.Info("Registering Components.")
 
+	for _, name := range extension.Names() {
+		log.Info(fmt.Sprintf("Registered extension: %s", name))
+	}
+
 	// Setup Scheme for all resources
 	if schemeErr := apis.AddToScheme(mgr.GetScheme()); schemeErr != nil {
 		log.Error(schemeErr, "failed to add KubeDirector CRs to scheme")
@@ -161,6 +176,14 @@ func main() {
 		validator.StartValidationServer()
 	}()
 
+	// Bring the CRDs up to date before any reconciliation starts. This
+	// needs the validation server to be running since it rewrites existing
+	// custom resources.
+	if upgradeErr := crdupgrade.Run(log, *ownerReference); upgradeErr != nil {
+		log.Error(upgradeErr, "failed to bring the CRDs up to date")
+		os.Exit(1)
+	}
+
 	log.Info("Starting the Cmd.")
 
 	// Start the Cmd
@@ -10,6 +10,7 @@ require (
 	github.com/json-iterator/go v1.1.8 // indirect
 	github.com/onsi/ginkgo v1.11.0 // indirect
 	github.com/operator-framework/operator-sdk v0.15.2
+	github.com/prometheus/client_golang v1.2.1
 	github.com/prometheus/client_model v0.2.0 // indirect
 	github.com/spf13/pflag v1.0.5
 	golang.org/x/crypto v0.0.0-20201216223049-8b5274cf687f // indirect
@@ -19,7 +20,7 @@ require (
 	k8s.io/kube-openapi v0.0.0-20200410145947-61e04a5be9a6 // indirect
 	k8s.io/utils v0.0.0-20200324210504-a9aa75ae1b89 // indirect
 	sigs.k8s.io/controller-runtime v0.4.0
-	sigs.k8s.io/yaml v1.2.0 // indirect
+	sigs.k8s.io/yaml v1.2.0
 )
 
 // Pinned to kubernetes-1.16.2
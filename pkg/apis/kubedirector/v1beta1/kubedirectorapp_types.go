@@ -20,22 +20,77 @@ import (
 )
 
 // KubeDirectorAppSpec defines the desired state of KubeDirectorApp.
+// DerivedFrom names a base app that this app extends; when the app is
+// submitted, its spec is merged over that of the base app and stored in
+// that flattened form.
 type KubeDirectorAppSpec struct {
-	Label                 Label               `json:"label"`
-	DistroID              string              `json:"distroID"`
-	Version               string              `json:"version"`
-	SchemaVersion         int                 `json:"configSchemaVersion"`
-	DefaultImageRepoTag   *string             `json:"defaultImageRepoTag,omitempty"`
-	DefaultSetupPackage   SetupPackage        `json:"defaultConfigPackage,omitempty"`
-	Services              []Service           `json:"services,omitempty"`
-	NodeRoles             []NodeRole          `json:"roles"`
-	Config                NodeGroupConfig     `json:"config"`
-	DefaultPersistDirs    *[]string           `json:"defaultPersistDirs,omitempty"`
-	DefaultEventList      *[]string           `json:"defaultEventList,omitempty"`
-	Capabilities          []corev1.Capability `json:"capabilities,omitempty"`
-	SystemdRequired       bool                `json:"systemdRequired,omitempty"`
-	LogoURL               string              `json:"logoURL,omitempty"`
-	DefaultMaxLogSizeDump *int32              `json:"defaultMaxLogSizeDump,omitempty"`
+	Label                  Label               `json:"label"`
+	DistroID               string              `json:"distroID"`
+	Version                string              `json:"version"`
+	SchemaVersion          int                 `json:"configSchemaVersion"`
+	DefaultImageRepoTag    *string             `json:"defaultImageRepoTag,omitempty"`
+	DefaultSetupImage      *string             `json:"defaultSetupImageRepoTag,omitempty"`
+	DefaultSetupPackage    SetupPackage        `json:"defaultConfigPackage,omitempty"`
+	Services               []Service           `json:"services,omitempty"`
+	NodeRoles              []NodeRole          `json:"roles"`
+	Config                 NodeGroupConfig     `json:"config"`
+	DefaultPersistDirs     *[]string           `json:"defaultPersistDirs,omitempty"`
+	DefaultPersistExcludes *[]string           `json:"defaultPersistExcludes,omitempty"`
+	DefaultEventList       *[]string           `json:"defaultEventList,omitempty"`
+	Capabilities           []corev1.Capability `json:"capabilities,omitempty"`
+	SystemdRequired        bool                `json:"systemdRequired,omitempty"`
+	Shellless              bool                `json:"shellless,omitempty"`
+	LogoURL                string              `json:"logoURL,omitempty"`
+	DefaultMaxLogSizeDump  *int32              `json:"defaultMaxLogSizeDump,omitempty"`
+	RequiredEnv            []RequiredEnvVar    `json:"requiredEnv,omitempty"`
+	Requirements           *AppRequirements    `json:"requirements,omitempty"`
+	Upgrade                *AppUpgrade         `json:"upgrade,omitempty"`
+	DerivedFrom            *string             `json:"derivedFrom,omitempty"`
+}
+
+// Features of a K8s cluster that an app can require.
+const (
+	// AppFeatureBlockVolumes is support for raw block volumes.
+	AppFeatureBlockVolumes string = "BlockVolumes"
+
+	// AppFeatureReadWriteMany is a storage class whose volumes can be
+	// mounted read-write by many nodes, as declared by the
+	// kubedirector.hpe.com/accessModes annotation of the storage class.
+	AppFeatureReadWriteMany string = "ReadWriteMany"
+
+	// AppFeatureVolumeSnapshots is support for CSI volume snapshots.
+	AppFeatureVolumeSnapshots string = "VolumeSnapshots"
+)
+
+// AppUpgrade declares the previous versions of the app that a cluster can
+// be upgraded from, by switching the cluster to this app. If it is given,
+// switching a cluster to this app from a version that is not listed is
+// rejected.
+type AppUpgrade struct {
+	From []AppUpgradePath `json:"from"`
+}
+
+// AppUpgradePath describes the upgrade from one previous Version of the app,
+// as given by the version property of that KubeDirectorApp. Args are passed
+// to the startscript of the setup package, after --upgrade and --from with
+// the previous version, in each member. If AllowRollback is set, a cluster
+// can be switched back to the previous app before the upgrade is complete.
+type AppUpgradePath struct {
+	Version       string   `json:"version"`
+	Args          []string `json:"args,omitempty"`
+	AllowRollback bool     `json:"allowRollback,omitempty"`
+}
+
+// AppRequirements declares what the K8s cluster must provide before a
+// virtual cluster of the app can be created. MinKubernetesVersion is the
+// lowest K8s version (such as "1.21") that the app supports. Features lists
+// required cluster features, from the AppFeature* values. DeviceResources
+// lists extended resources advertised by device plugins (such as
+// "nvidia.com/gpu"), each of which some node must have allocatable.
+type AppRequirements struct {
+	MinKubernetesVersion *string  `json:"minKubernetesVersion,omitempty"`
+	Features             []string `json:"features,omitempty"`
+	DeviceResources      []string `json:"deviceResources,omitempty"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -77,9 +132,50 @@ type SetupPackage struct {
 
 // SetupPackageInfo is the URL of the setup package, plus a flag on whether
 // the new setup layout (for configcli and persisted dirs) should be used.
+// HookExecution, if given, controls how the package's startscript is run.
+// A PackageURL of the form oci://registry/repository@digest names an OCI
+// artifact, which KubeDirector pulls itself (using the credentials in the
+// dockerconfigjson secret PullSecretName, in the KubeDirector namespace, if
+// given) and copies into each member; other URLs are downloaded by the
+// members. SHA256, if given, is the hex sha256 digest of the package, which
+// each member checks before installing it. An http(s) package with a digest
+// may also be downloaded once by KubeDirector and copied into the members,
+// if the KubeDirectorConfig cacheSetupPackages flag is set.
 type SetupPackageInfo struct {
-	PackageURL        string `json:"packageURL"`
-	UseNewSetupLayout bool   `json:"useNewSetupLayout"`
+	PackageURL        string         `json:"packageURL"`
+	PullSecretName    string         `json:"pullSecretName,omitempty"`
+	SHA256            string         `json:"sha256,omitempty"`
+	UseNewSetupLayout bool           `json:"useNewSetupLayout"`
+	HookExecution     *HookExecution `json:"hookExecution,omitempty"`
+}
+
+// HookExecution describes the user, umask, and environment under which the
+// startscript of a setup package is run in a member. By default it runs as
+// the container's user (normally root) with the container's environment.
+// Env entries are added to, or override, that environment.
+type HookExecution struct {
+	RunAsUser  *int64       `json:"runAsUser,omitempty"`
+	RunAsGroup *int64       `json:"runAsGroup,omitempty"`
+	Umask      *string      `json:"umask,omitempty"`
+	Env        []HookEnvVar `json:"env,omitempty"`
+}
+
+// HookEnvVar is an environment variable set for setup package hooks.
+type HookEnvVar struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// RequiredEnvVar declares an environment variable that every virtual
+// cluster of the app must provide to the members of the listed roles (of all
+// roles, if Roles is empty). The cluster can set it in the env of each such
+// role. If SecretKey is given, the cluster can instead name a Secret through
+// its envSecret property, and the value is taken from that key of the Secret.
+type RequiredEnvVar struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Roles       []string `json:"roles,omitempty"`
+	SecretKey   string   `json:"secretKey,omitempty"`
 }
 
 // Service describes a network endpoint that should be exposed for external
@@ -93,41 +189,140 @@ type Service struct {
 }
 
 // ServiceEndpoint describes the service network address and protocol, and
-// whether it should be displayed through a web browser.
+// whether it should be displayed through a web browser. Ingress marks an
+// HTTP(S) endpoint that should be exposed through generated Ingresses (or
+// Routes) when those are configured.
 type ServiceEndpoint struct {
 	URLScheme    string `json:"urlScheme,omitempty"`
 	Port         *int32 `json:"port"`
 	Path         string `json:"path,omitempty"`
 	IsDashboard  bool   `json:"isDashboard,omitempty"`
 	HasAuthToken bool   `json:"hasAuthToken,omitempty"`
+	Ingress      bool   `json:"ingress,omitempty"`
 }
 
 // NodeRole describes a subset of virtual cluster members that will provide
 // the same services. At deployment time all role members will receive
-// identical resource assignments.
+// identical resource assignments. If SetupImage is set, the setup package
+// is run in a separate container using that image, rather than in the app
+// container. PersistExcludes are rsync-style patterns for files under the
+// PersistDirs that are not copied onto persistent storage. If EventList
+// explicitly includes "decommission", members leaving the role in a shrink
+// first run the setup package with --decommission, and are given up to
+// DecommissionTimeoutSeconds to succeed. Similarly if EventList includes
+// "stop", a member that KubeDirector is about to stop (for a restart,
+// shrink, or re-creation) first runs the setup package with --stop, and is
+// given up to StopTimeoutSeconds to finish. ConfigurePolicy bounds the initial
+// run of the setup package's configure event. Logging tells log agents how
+// to read the role's logs. Containers are run in each member alongside the
+// app container. BlockDevicePrep prepares the block devices of the role's
+// members, in clusters that give the role block storage.
 type NodeRole struct {
-	ID             string               `json:"id"`
-	Cardinality    string               `json:"cardinality"`
-	ImageRepoTag   *string              `json:"imageRepoTag,omitempty"`
-	SetupPackage   SetupPackage         `json:"configPackage,omitempty"`
-	PersistDirs    *[]string            `json:"persistDirs,omitempty"`
-	EventList      *[]string            `json:"eventList,omitempty"`
-	MinResources   *corev1.ResourceList `json:"minResources,omitempty"`
-	MinStorage     *MinStorage          `json:"minStorage,omitempty"`
-	ContainerSpec  *ContainerSpec       `json:"containerSpec,omitempty"`
-	MaxLogSizeDump *int32               `json:"maxLogSizeDump,omitempty"`
+	ID                         string               `json:"id"`
+	Cardinality                string               `json:"cardinality"`
+	ImageRepoTag               *string              `json:"imageRepoTag,omitempty"`
+	SetupImage                 *string              `json:"setupImageRepoTag,omitempty"`
+	SetupPackage               SetupPackage         `json:"configPackage,omitempty"`
+	PersistDirs                *[]string            `json:"persistDirs,omitempty"`
+	PersistExcludes            *[]string            `json:"persistExcludes,omitempty"`
+	EventList                  *[]string            `json:"eventList,omitempty"`
+	DecommissionTimeoutSeconds *int32               `json:"decommissionTimeoutSeconds,omitempty"`
+	StopTimeoutSeconds         *int32               `json:"stopTimeoutSeconds,omitempty"`
+	ConfigurePolicy            *ConfigurePolicy     `json:"configurePolicy,omitempty"`
+	Logging                    *AppLogging          `json:"logging,omitempty"`
+	Containers                 []AppContainer       `json:"containers,omitempty"`
+	MinResources               *corev1.ResourceList `json:"minResources,omitempty"`
+	MinStorage                 *MinStorage          `json:"minStorage,omitempty"`
+	ContainerSpec              *ContainerSpec       `json:"containerSpec,omitempty"`
+	MaxLogSizeDump             *int32               `json:"maxLogSizeDump,omitempty"`
+	BlockDevicePrep            *BlockDevicePrep     `json:"blockDevicePrep,omitempty"`
+}
+
+// BlockDevicePrep describes a step, run by a privileged init container in
+// each member before the app starts, that prepares each of the member's
+// block devices. If Encrypt is true the device is formatted as a LUKS
+// volume, with the key from the cluster role's encryptionKeySecret. If
+// Filesystem (ext4 or xfs) is set, a filesystem of that type is made on the
+// device, or inside its LUKS volume. A device that already has a LUKS
+// header or filesystem is never formatted again. Image is the image used
+// for the step, by default the role's app image; it must provide bash,
+// blkid, and the mkfs and cryptsetup commands that are needed.
+type BlockDevicePrep struct {
+	Filesystem *string `json:"filesystem,omitempty"`
+	Encrypt    bool    `json:"encrypt,omitempty"`
+	Image      *string `json:"imageRepoTag,omitempty"`
+}
+
+// ConfigurePolicy limits the initial configuration of a member by the setup
+// package. A configure run that has not finished after TimeoutSeconds is
+// stopped and counted as failed; by default there is no limit. A failed run
+// is tried again up to Retries times (zero if unset), waiting BackoffSeconds
+// (30 if unset) before the first retry and twice as long before each one
+// after that, up to ten minutes.
+type ConfigurePolicy struct {
+	TimeoutSeconds *int32 `json:"timeoutSeconds,omitempty"`
+	Retries        *int32 `json:"retries,omitempty"`
+	BackoffSeconds *int32 `json:"backoffSeconds,omitempty"`
+}
+
+// AppContainer is an additional container in each member of a role, for
+// apps that ship as several co-scheduled images. Ports are declared on the
+// container. VolumeMounts share directories of the app container with it,
+// in the same way as for the sidecars of a cluster role. If SetupPackage is
+// given, the container fetches the package (PackageURL and SHA256 are used)
+// and runs its startscript with --configure, to completion, when the member
+// is configured, before the role's own setup package is run.
+type AppContainer struct {
+	Name         string                      `json:"name"`
+	ImageRepoTag string                      `json:"imageRepoTag"`
+	Command      []string                    `json:"command,omitempty"`
+	Args         []string                    `json:"args,omitempty"`
+	Resources    corev1.ResourceRequirements `json:"resources,omitempty"`
+	Ports        []AppContainerPort          `json:"ports,omitempty"`
+	VolumeMounts []SidecarVolumeMount        `json:"volumeMounts,omitempty"`
+	SetupPackage *SetupPackageInfo           `json:"configPackage,omitempty"`
+}
+
+// AppContainerPort is a named port of an additional app container.
+type AppContainerPort struct {
+	Name string `json:"name"`
+	Port int32  `json:"port"`
+}
+
+// AppLogging describes the logs of a role's app container. Parser and
+// MultilineParser name the fluent-bit parsers for single-line records and
+// for records that span several lines (such as stack traces). Paths lists
+// log files that the app writes, apart from its stdout and stderr, for a
+// logging sidecar to ship.
+type AppLogging struct {
+	Parser          *string  `json:"parser,omitempty"`
+	MultilineParser *string  `json:"multilineParser,omitempty"`
+	Paths           []string `json:"paths,omitempty"`
 }
 
 // MinStorage describes the minimum persistent storage requirement, if any.
+// RecommendedSize, if given, is the size below which the validator warns
+// that the storage may be too small for practical use.
 type MinStorage struct {
-	Size                   string `json:"size"`
-	EphemeralModeSupported bool   `json:"ephemeralModeSupported"`
+	Size                   string  `json:"size"`
+	EphemeralModeSupported bool    `json:"ephemeralModeSupported"`
+	RecommendedSize        *string `json:"recommendedSize,omitempty"`
 }
 
-//ContainerSpec comments
+// ContainerSpec holds app container properties that an app author can set
+// for a role. The probes, if given, are used as the app container's
+// readiness, liveness, and startup probes. PreStop, if given, is a command
+// run in the app container before a member is stopped, for example to drain
+// or flush its services; TerminationGracePeriodSeconds bounds how long the
+// member gets to shut down.
 type ContainerSpec struct {
-	Stdin bool `json:"stdin,omitempty"`
-	Tty   bool `json:"tty,omitempty"`
+	Stdin                         bool          `json:"stdin,omitempty"`
+	Tty                           bool          `json:"tty,omitempty"`
+	ReadinessProbe                *corev1.Probe `json:"readinessProbe,omitempty"`
+	LivenessProbe                 *corev1.Probe `json:"livenessProbe,omitempty"`
+	StartupProbe                  *corev1.Probe `json:"startupProbe,omitempty"`
+	PreStop                       []string      `json:"preStop,omitempty"`
+	TerminationGracePeriodSeconds *int64        `json:"terminationGracePeriodSeconds,omitempty"`
 }
 
 // NodeGroupConfig identifies a set of roles, and the services on those roles.
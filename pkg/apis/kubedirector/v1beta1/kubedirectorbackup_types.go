@@ -0,0 +1,130 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// States of a backup, in the order that a successful backup goes through
+// them.
+const (
+	// BackupPending means the backup is waiting for its cluster to be
+	// configured.
+	BackupPending string = "pending"
+
+	// BackupFreezing means the freeze hook is running on the members.
+	BackupFreezing string = "freezing"
+
+	// BackupSnapshotting means the volume snapshots have been requested and
+	// the members stay frozen until every snapshot has been taken.
+	BackupSnapshotting string = "snapshotting"
+
+	// BackupThawing means the thaw hook is running on the members.
+	BackupThawing string = "thawing"
+
+	// BackupFinalizing means the members have been thawed and the backup is
+	// waiting for the snapshots to be ready to use.
+	BackupFinalizing string = "finalizing"
+
+	// BackupSucceeded means every snapshot is ready to use, so the backup
+	// can be restored.
+	BackupSucceeded string = "succeeded"
+
+	// BackupFailed means the backup could not be completed. The status
+	// message explains why.
+	BackupFailed string = "failed"
+)
+
+// KubeDirectorBackupSpec defines the desired state of KubeDirectorBackup:
+// the cluster (in the same namespace) to back up, the VolumeSnapshotClass to
+// use for its volume snapshots (the default class if not given), and how
+// long the members may stay frozen while the snapshots are taken.
+type KubeDirectorBackupSpec struct {
+	Cluster                 string  `json:"cluster"`
+	VolumeSnapshotClassName *string `json:"volumeSnapshotClassName,omitempty"`
+	FreezeTimeoutSeconds    *int32  `json:"freezeTimeoutSeconds,omitempty"`
+}
+
+// KubeDirectorBackupStatus defines the observed state of
+// KubeDirectorBackup. Message explains why a backup is pending or has
+// failed. ThawTime is when the thaw hook was started on the members.
+// ClusterSpec is the spec of the cluster when the backup was started, which
+// a restored cluster must be compatible with. Members lists the members that
+// were backed up, with their volume snapshots.
+type KubeDirectorBackupStatus struct {
+	State          string                   `json:"state"`
+	Message        string                   `json:"message,omitempty"`
+	StartTime      *metav1.Time             `json:"startTime,omitempty"`
+	ThawTime       *metav1.Time             `json:"thawTime,omitempty"`
+	CompletionTime *metav1.Time             `json:"completionTime,omitempty"`
+	ClusterSpec    *KubeDirectorClusterSpec `json:"clusterSpec,omitempty"`
+	Members        []BackupMember           `json:"members,omitempty"`
+}
+
+// BackupMember describes the backup of one cluster member. ContainerID is
+// the member's app container that the freeze and thaw hooks run in; their
+// states are one of running, succeeded, failed, or timedOut, and are empty
+// if the member's role does not handle the freeze event.
+type BackupMember struct {
+	Pod         string         `json:"pod"`
+	Role        string         `json:"role"`
+	ContainerID string         `json:"containerID"`
+	FreezeState string         `json:"freezeState,omitempty"`
+	ThawState   string         `json:"thawState,omitempty"`
+	Message     string         `json:"message,omitempty"`
+	Volumes     []BackupVolume `json:"volumes,omitempty"`
+}
+
+// BackupVolume describes the snapshot of one persistent volume claim of a
+// member. Template is the name of the statefulset volume claim template
+// that the claim was created from, which identifies the corresponding claim
+// of a member of a restored cluster. RestoreSize is the minimum size of a
+// volume restored from the snapshot.
+type BackupVolume struct {
+	PVC            string `json:"pvc"`
+	Template       string `json:"template"`
+	VolumeSnapshot string `json:"volumeSnapshot"`
+	ReadyToUse     bool   `json:"readyToUse,omitempty"`
+	RestoreSize    string `json:"restoreSize,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// KubeDirectorBackup is the Schema for the kubedirectorbackups API. This
+// object takes a crash-consistent (or, with the app's freeze hook,
+// app-consistent) set of CSI volume snapshots of the members of a virtual
+// cluster, which can be restored into a new virtual cluster.
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:path=kubedirectorbackups,scope=Namespaced
+type KubeDirectorBackup struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              KubeDirectorBackupSpec    `json:"spec,omitempty"`
+	Status            *KubeDirectorBackupStatus `json:"status,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// KubeDirectorBackupList contains a list of KubeDirectorBackup.
+type KubeDirectorBackupList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []KubeDirectorBackup `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&KubeDirectorBackup{}, &KubeDirectorBackupList{})
+}
@@ -29,42 +29,438 @@ const (
 	CrNameRole string = "CrNameRole"
 )
 
+// Condition types that may appear in the conditions list of a role status.
+const (
+	// RoleAffinityUnsatisfied is true when one or more members of the role
+	// cannot be scheduled because no node satisfies the role's affinity,
+	// anti-affinity, or node selection constraints, or because the nodes
+	// have taints that the role does not tolerate.
+	RoleAffinityUnsatisfied string = "AffinityUnsatisfied"
+
+	// RoleStorageExpanding is true while the persistent storage of the
+	// role's members is being grown to a newly requested size.
+	RoleStorageExpanding string = "StorageExpanding"
+
+	// RoleBlockStorageChanging is true while the block devices of the
+	// role's members are being grown to a newly requested size, or devices
+	// are being added to them.
+	RoleBlockStorageChanging string = "BlockStorageChanging"
+
+	// RoleUpgrading is true while the role's members are being restarted
+	// one at a time to use a changed app or setup image.
+	RoleUpgrading string = "Upgrading"
+
+	// RoleRestartRequired is true when the pod template that KubeDirector
+	// would now generate for the role differs from the one its statefulset
+	// is using, for a reason that KubeDirector does not roll out to the
+	// existing members by itself.
+	RoleRestartRequired string = "RestartRequired"
+
+	// RoleRestarting is true while members of the role are being restarted
+	// one at a time because the restart generation in the role spec was
+	// increased.
+	RoleRestarting string = "Restarting"
+
+	// RoleExpansionHalted is true while members are not being added to the
+	// role because existing members persistently fail to pull their image.
+	RoleExpansionHalted string = "ExpansionHalted"
+)
+
+// Condition types that may appear in the conditions list of a cluster status.
+const (
+	// ClusterMembersPending is true when one or more member pods are stuck
+	// in the Pending phase for a diagnosable reason. The per-member reasons
+	// are in each member's stateDetail.pendingReason.
+	ClusterMembersPending string = "MembersPending"
+
+	// ClusterConnectionsUnreachable is true when a database connection
+	// that requests probing cannot currently be reached. Member
+	// configuration is held off while this is true.
+	ClusterConnectionsUnreachable string = "ConnectionsUnreachable"
+
+	// ClusterChangeQueued is true when a change to role membership is
+	// waiting for an earlier, in-progress membership change to complete.
+	ClusterChangeQueued string = "ChangeQueued"
+
+	// ClusterDegraded is true when repeated failures to create the cluster's
+	// service, statefulset, or other child objects have opened the circuit
+	// breaker. The reason and message describe the blocking error; creation
+	// is retried periodically until it succeeds.
+	ClusterDegraded string = "Degraded"
+
+	// ClusterApprovalPending is true when a queued membership change needs
+	// approval, under the KubeDirectorConfig membershipApproval policy,
+	// before it can be carried out.
+	ClusterApprovalPending string = "ApprovalPending"
+
+	// ClusterExtensionFailed is true when the most recent call of one or
+	// more operator extension hooks for this cluster failed. The message
+	// names the extensions and hooks.
+	ClusterExtensionFailed string = "ExtensionFailed"
+
+	// ClusterPaused is true while reconciliation of the cluster is paused
+	// by its paused annotation. Member container states are still tracked
+	// in the status, but nothing else is done.
+	ClusterPaused string = "Paused"
+
+	// ClusterNamespaceTerminating is true once the cluster's namespace is
+	// being deleted. From then on KubeDirector only tears the cluster down:
+	// it creates nothing and runs no setup in its members.
+	ClusterNamespaceTerminating string = "NamespaceTerminating"
+
+	// ClusterRecreating is true while the cluster's services and
+	// statefulsets are being re-created under a changed naming scheme.
+	ClusterRecreating string = "Recreating"
+
+	// ClusterQuotaExceeded is true when a ResourceQuota or LimitRange of
+	// the namespace is blocking the creation of the cluster's objects,
+	// including the member pods and claims created by its statefulsets.
+	// The reason is ResourceQuota or LimitRange, and the message names the
+	// blocked objects, the limit, and the offending resources and amounts.
+	ClusterQuotaExceeded string = "QuotaExceeded"
+)
+
+// Condition types that may appear in the conditions list of a member status.
+const (
+	// MemberUnschedulable is true when no node can be found for the
+	// member's pod. The message is the scheduler's.
+	MemberUnschedulable string = "Unschedulable"
+
+	// MemberCrashLooping is true when a container of the member's pod is
+	// waiting to be started again after exiting repeatedly. The message
+	// names the container and says how it last exited.
+	MemberCrashLooping string = "CrashLooping"
+
+	// MemberNotReady is true when the member's pod is running but is not
+	// ready. The reason and message are those of the pod's Ready condition.
+	MemberNotReady string = "NotReady"
+
+	// MemberConfigError is true while the member is in config error state.
+	// The message is the configErrorDetail of the member.
+	MemberConfigError string = "ConfigError"
+)
+
+// Actions that may appear in the audit history of a cluster status.
+const (
+	// AuditDebugEnabled records that debug mode was turned on.
+	AuditDebugEnabled string = "DebugEnabled"
+
+	// AuditDebugExtended records that the expiry of debug mode was changed
+	// while it was active.
+	AuditDebugExtended string = "DebugExtended"
+
+	// AuditDebugEnded records that debug mode expired or was turned off.
+	AuditDebugEnded string = "DebugEnded"
+
+	// AuditOperationApproved records the approval of a membership change.
+	AuditOperationApproved string = "OperationApproved"
+
+	// AuditClusterCreated records the creation of the cluster, by its
+	// creator.
+	AuditClusterCreated string = "ClusterCreated"
+
+	// AuditRuntimeSocketGranted records that a role was created with access
+	// to a container runtime socket.
+	AuditRuntimeSocketGranted string = "RuntimeSocketGranted"
+)
+
+// Policies for the persistent volume claims of a role's members, in a
+// PVCRetentionPolicy.
+const (
+	// PVCRetain keeps the claims, so that their data can be re-used.
+	PVCRetain string = "Retain"
+
+	// PVCDelete deletes the claims along with the members.
+	PVCDelete string = "Delete"
+)
+
+// Modes of log collection for a role, in a RoleLogging.
+const (
+	// LoggingAnnotations only annotates the member pods for log agents.
+	LoggingAnnotations string = "Annotations"
+
+	// LoggingSidecar also adds a log shipper container to each member.
+	LoggingSidecar string = "Sidecar"
+)
+
+// Sources of the container runtime socket for a role, in a RuntimeSocket.
+const (
+	// RuntimeSocketDocker mounts the docker socket of the node.
+	RuntimeSocketDocker string = "docker"
+
+	// RuntimeSocketContainerd mounts the containerd socket of the node.
+	RuntimeSocketContainerd string = "containerd"
+
+	// RuntimeSocketDinD runs a docker-in-docker sidecar in each member and
+	// shares its socket with the app container.
+	RuntimeSocketDinD string = "dind"
+)
+
+// Database engines supported for database connections.
+const (
+	// DatabasePostgres is a PostgreSQL database.
+	DatabasePostgres string = "postgres"
+
+	// DatabaseMySQL is a MySQL database.
+	DatabaseMySQL string = "mysql"
+
+	// DatabaseMariaDB is a MariaDB database.
+	DatabaseMariaDB string = "mariadb"
+
+	// DatabaseMSSQL is a Microsoft SQL Server database.
+	DatabaseMSSQL string = "mssql"
+
+	// DatabaseOracle is an Oracle database.
+	DatabaseOracle string = "oracle"
+)
+
+// Object storage types supported for object store connections.
+const (
+	// ObjectStoreS3 is an S3 or S3-compatible bucket.
+	ObjectStoreS3 string = "s3"
+
+	// ObjectStoreGCS is a Google Cloud Storage bucket.
+	ObjectStoreGCS string = "gcs"
+
+	// ObjectStoreABFS is an Azure Data Lake Storage Gen2 container; the
+	// endpoint must name the storage account host.
+	ObjectStoreABFS string = "abfs"
+)
+
+// Cloud providers supported for role workload identity.
+const (
+	// WorkloadIdentityAWS selects EKS IAM roles for service accounts; the
+	// identity is an IAM role ARN.
+	WorkloadIdentityAWS string = "aws"
+
+	// WorkloadIdentityGCP selects GKE workload identity; the identity is a
+	// Google service account email.
+	WorkloadIdentityGCP string = "gcp"
+
+	// WorkloadIdentityAzure selects Azure AD workload identity; the identity
+	// is a managed identity or application client ID.
+	WorkloadIdentityAzure string = "azure"
+)
+
 // KubeDirectorClusterSpec defines the desired state of KubeDirectorCluster.
 // AppID references a KubeDirectorApp CR. ServiceType indicates whether to
 // use NodePort or LoadBalancer services. The Roles field describes the
 // requested cluster roles, each of which will be implemented (by KubeDirector)
-// using a StatefulSet.
+// using a StatefulSet. SpecFragments names configmaps (in the cluster's
+// namespace) whose partial role settings are merged into the roles when the
+// cluster is created. ShrinkAcknowledgement lists members (by pod name)
+// whose persistent storage may be destroyed when their role is shrunk or
+// removed. EnvSecret names a Secret (in the cluster's namespace) that
+// supplies the values of secret-backed environment variables required by
+// the app. PropagateLabels lists the keys of labels on the cluster CR that
+// are copied onto its member pods and services and into configmeta.
+// InitContainer overrides, for every role, settings of the init container
+// that initializes the members' persistent storage. Setting Rollback
+// reverts the spec to the last-known-good one recorded in the status.
+// CloneFrom names the backup or other cluster whose member volumes provide
+// the initial content of this cluster's member volumes. TopologyRouting sets
+// the topology-aware routing of the member services.
+// RecreateAcknowledgement must be set to change the naming scheme of a
+// cluster that has members, since that re-creates every role's statefulset.
+// RequireEncryptedStorage rejects the cluster unless the storage classes of
+// all its persistent storage and block devices encrypt volumes at rest.
 type KubeDirectorClusterSpec struct {
-	AppID         string      `json:"app"`
-	AppCatalog    *string     `json:"appCatalog,omitempty"`
-	ServiceType   *string     `json:"serviceType,omitempty"`
-	Roles         []Role      `json:"roles"`
-	DefaultSecret *KDSecret   `json:"defaultSecret,omitempty"`
-	Connections   Connections `json:"connections"`
-	NamingScheme  *string     `json:"namingScheme,omitempty"`
+	AppID                   string               `json:"app"`
+	AppCatalog              *string              `json:"appCatalog,omitempty"`
+	ServiceType             *string              `json:"serviceType,omitempty"`
+	Roles                   []Role               `json:"roles"`
+	DefaultSecret           *KDSecret            `json:"defaultSecret,omitempty"`
+	Connections             Connections          `json:"connections"`
+	NamingScheme            *string              `json:"namingScheme,omitempty"`
+	SpecFragments           []string             `json:"specFragments,omitempty"`
+	ShrinkAcknowledgement   []string             `json:"shrinkAcknowledgement,omitempty"`
+	EnvSecret               *string              `json:"envSecret,omitempty"`
+	PropagateLabels         []string             `json:"propagateLabels,omitempty"`
+	InitContainer           *InitContainerConfig `json:"initContainer,omitempty"`
+	Rollback                bool                 `json:"rollback,omitempty"`
+	CloneFrom               *CloneSource         `json:"cloneFrom,omitempty"`
+	TopologyRouting         *TopologyRouting     `json:"topologyRouting,omitempty"`
+	RecreateAcknowledgement bool                 `json:"recreateAcknowledgement,omitempty"`
+	RequireEncryptedStorage bool                 `json:"requireEncryptedStorage,omitempty"`
+}
+
+// TopologyRouting sets how traffic to the member services prefers endpoints
+// that are topologically close to the client. Mode is the value of the
+// services' service.kubernetes.io/topology-mode annotation (such as "Auto"),
+// and TrafficDistribution the value of their trafficDistribution (such as
+// "PreferClose").
+type TopologyRouting struct {
+	Mode                *string `json:"mode,omitempty"`
+	TrafficDistribution *string `json:"trafficDistribution,omitempty"`
+}
+
+// CloneSource names, in the cluster's namespace, either a KubeDirectorBackup
+// whose volume snapshots are restored or a KubeDirectorCluster whose member
+// PVCs are cloned. Exactly one of the two must be set.
+type CloneSource struct {
+	Backup  string `json:"backup,omitempty"`
+	Cluster string `json:"cluster,omitempty"`
+}
+
+// InitContainerConfig overrides settings of the init container that copies
+// the app's persisted directories onto a member's persistent storage. By
+// default that container uses the app image, the resources of the role
+// (including any GPUs), and runs as root. An Image set here must contain the
+// same directories as the app image, since they are copied from it.
+type InitContainerConfig struct {
+	Image           *string                      `json:"image,omitempty"`
+	Resources       *corev1.ResourceRequirements `json:"resources,omitempty"`
+	SecurityContext *corev1.SecurityContext      `json:"securityContext,omitempty"`
 }
 
 // Connections specifies list of cluster objects and configmaps objects that has
 // be connected to the cluster.
 type Connections struct {
-	Clusters   []string `json:"clusters,omitempty"`
-	ConfigMaps []string `json:"configmaps,omitempty"`
-	Secrets    []string `json:"secrets,omitempty"`
+	Clusters     []string                `json:"clusters,omitempty"`
+	ConfigMaps   []string                `json:"configmaps,omitempty"`
+	Secrets      []string                `json:"secrets,omitempty"`
+	ObjectStores []ObjectStoreConnection `json:"objectStores,omitempty"`
+	Databases    []DatabaseConnection    `json:"databases,omitempty"`
+}
+
+// DatabaseConnection describes a database to be made known to the cluster
+// members, in a form that does not depend on the app. Engine is one of the
+// Database* values; if Port is unset the engine's default port is used.
+// SecretRef optionally names a secret in the cluster's namespace that holds
+// the login credentials. If Probe is true, KubeDirector will not configure
+// members (or notify them of connection changes) until it can open a TCP
+// connection to the database.
+type DatabaseConnection struct {
+	Name      string       `json:"name"`
+	Engine    string       `json:"engine"`
+	Host      string       `json:"host"`
+	Port      *int32       `json:"port,omitempty"`
+	Database  *string      `json:"database,omitempty"`
+	SecretRef *string      `json:"secretRef,omitempty"`
+	TLS       *DatabaseTLS `json:"tls,omitempty"`
+	Probe     *bool        `json:"probe,omitempty"`
+}
+
+// DatabaseTLS describes how to make a TLS connection to a database.
+// CASecretRef optionally names a secret in the cluster's namespace with a
+// "ca.crt" key holding the CA bundle used to verify the server.
+type DatabaseTLS struct {
+	Enabled     bool    `json:"enabled"`
+	CASecretRef *string `json:"caSecretRef,omitempty"`
+}
+
+// ObjectStoreConnection describes an object storage bucket to be made known
+// to the cluster members, in a form that does not depend on the app. Type
+// is one of the ObjectStore* values. SecretRef optionally names a secret in
+// the cluster's namespace that holds the credentials for the bucket.
+type ObjectStoreConnection struct {
+	Name      string  `json:"name"`
+	Type      string  `json:"type"`
+	Bucket    string  `json:"bucket"`
+	Endpoint  *string `json:"endpoint,omitempty"`
+	Region    *string `json:"region,omitempty"`
+	SecretRef *string `json:"secretRef,omitempty"`
 }
 
 // KubeDirectorClusterStatus defines the observed state of KubeDirectorCluster.
 // It identifies which native k8s objects make up the cluster, and broadly
 // indicates ongoing operations of cluster creation or reconfiguration.
+// Creator is the username of the user that created the cluster, if known.
+// NamingScheme is the naming scheme that the cluster's existing services
+// and statefulsets were created with. AppUpgrade tracks the latest switch of
+// the cluster to a different app.
 type KubeDirectorClusterStatus struct {
-	State                   string           `json:"state"`
-	RestoreProgress         *RestoreProgress `json:"restoreProgress,omitempty"`
-	MemberStateRollup       StateRollup      `json:"memberStateRollup"`
-	GenerationUID           string           `json:"generationUID"`
-	SpecGenerationToProcess *int64           `json:"specGenerationToProcess,omitempty"`
-	ClusterService          string           `json:"clusterService"`
-	LastNodeID              int64            `json:"lastNodeID"`
-	Roles                   []RoleStatus     `json:"roles"`
-	LastConnectionHash      string           `json:"lastConnectionHash"`
+	State                   string            `json:"state"`
+	RestoreProgress         *RestoreProgress  `json:"restoreProgress,omitempty"`
+	MemberStateRollup       StateRollup       `json:"memberStateRollup"`
+	GenerationUID           string            `json:"generationUID"`
+	SpecGenerationToProcess *int64            `json:"specGenerationToProcess,omitempty"`
+	ClusterService          string            `json:"clusterService"`
+	LastNodeID              int64             `json:"lastNodeID"`
+	Roles                   []RoleStatus      `json:"roles"`
+	LastConnectionHash      string            `json:"lastConnectionHash"`
+	Conditions              []Condition       `json:"conditions,omitempty"`
+	Operations              []Operation       `json:"operations,omitempty"`
+	DebugExpires            *metav1.Time      `json:"debugExpires,omitempty"`
+	AuditHistory            []AuditRecord     `json:"auditHistory,omitempty"`
+	AppID                   string            `json:"app,omitempty"`
+	RetainedPVCs            []RetainedPVC     `json:"retainedPVCs,omitempty"`
+	LastLabelsHash          string            `json:"lastLabelsHash,omitempty"`
+	LastKnownGood           *LastKnownGood    `json:"lastKnownGood,omitempty"`
+	Creator                 string            `json:"creator,omitempty"`
+	NamingScheme            string            `json:"namingScheme,omitempty"`
+	AppUpgrade              *AppUpgradeStatus `json:"appUpgrade,omitempty"`
+}
+
+// AppUpgradeStatus records the progress of a switch of the cluster from one
+// app (From, with version FromVersion) to another (To, with version
+// ToVersion). Rollback is set if the switch went back to the app of an
+// upgrade that was still in progress. State is AppUpgradeInProgress until
+// every member has been configured on the images of the new app, as counted
+// by UpgradedMembers out of TotalMembers, and then AppUpgradeCompleted.
+type AppUpgradeStatus struct {
+	From            string       `json:"from"`
+	FromVersion     string       `json:"fromVersion,omitempty"`
+	To              string       `json:"to"`
+	ToVersion       string       `json:"toVersion,omitempty"`
+	Rollback        bool         `json:"rollback,omitempty"`
+	State           string       `json:"state"`
+	Started         metav1.Time  `json:"started"`
+	Completed       *metav1.Time `json:"completed,omitempty"`
+	UpgradedMembers int32        `json:"upgradedMembers"`
+	TotalMembers    int32        `json:"totalMembers"`
+}
+
+// States of an AppUpgradeStatus.
+const (
+	// AppUpgradeInProgress means that some members are not yet configured
+	// on the images of the new app.
+	AppUpgradeInProgress string = "InProgress"
+
+	// AppUpgradeCompleted means that every member is configured on the
+	// images of the new app.
+	AppUpgradeCompleted string = "Completed"
+)
+
+// LastKnownGood is the most recent spec, identified by its generation, that
+// the cluster was fully configured with. Setting rollback in the spec
+// replaces the spec with this one.
+type LastKnownGood struct {
+	Generation int64                   `json:"generation"`
+	Spec       KubeDirectorClusterSpec `json:"spec"`
+}
+
+// RetainedPVC is the persistent volume claim of a deleted member, kept for
+// possible recovery until the Expires time, or with no Expires time for as
+// long as the role's retention policy keeps it. If the member is re-created
+// before then (by growing its role again), it re-uses the claim.
+type RetainedPVC struct {
+	PVC     string       `json:"pvc"`
+	Role    string       `json:"role"`
+	Member  string       `json:"member"`
+	Expires *metav1.Time `json:"expires,omitempty"`
+}
+
+// Operation is a change in the member counts of a cluster's roles,
+// identified by the spec generation that requested it. The first operation
+// in the cluster status is the one being carried out (or the most recently
+// completed one); any others are queued behind it. Members maps role names
+// to their desired member counts.
+type Operation struct {
+	Generation       int64            `json:"generation"`
+	Members          map[string]int32 `json:"members"`
+	ApprovalRequired bool             `json:"approvalRequired,omitempty"`
+	ApprovedBy       string           `json:"approvedBy,omitempty"`
+}
+
+// AuditRecord is an entry in the audit history of a cluster, noting a
+// notable administrative action such as the use of debug mode. User is the
+// user responsible for the action, if known.
+type AuditRecord struct {
+	Time   metav1.Time `json:"time"`
+	Action string      `json:"action"`
+	User   string      `json:"user,omitempty"`
+	Detail string      `json:"detail,omitempty"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -101,6 +497,15 @@ type KDSecret struct {
 	ReadOnly    bool   `json:"readOnly,omitempty"`
 }
 
+// KDConfigMap describes a configmap object intended to be mounted inside a
+// container. It has the same properties as KDSecret.
+type KDConfigMap struct {
+	Name        string `json:"name"`
+	DefaultMode *int32 `json:"defaultMode,omitempty"`
+	MountPath   string `json:"mountPath"`
+	ReadOnly    bool   `json:"readOnly,omitempty"`
+}
+
 // EnvVar specifies environment variables for the start script in a container
 type EnvVar struct {
 	Name  string `json:"name"`
@@ -134,23 +539,183 @@ type VolumeProjections struct {
 // Role describes a subset of the virtual cluster members that shares a common
 // image, resource requirements, persistent storage definition, and (as
 // defined by the cluster's KubeDirectorApp) set of service endpoints.
+// ServiceType, if set, overrides the cluster's serviceType for the member
+// services of this role. PVCLabels and PVCAnnotations are set on the
+// persistent volume claims of the role's members. ServiceType,
+// ServiceAnnotations, PVCLabels, and PVCAnnotations may be changed while the
+// role has members; the member services and claims are updated to match.
+// MemberServiceAnnotations are also placed on the member services, after
+// the placeholders {member}, {role}, {cluster}, and {namespace} in their
+// values are replaced for each member, so that (for example) external-dns
+// can give each member its own host name. They too may be changed at any
+// time.
+// ImagePullSecrets and ImagePullPolicy apply to the containers that
+// KubeDirector generates from the app's images; if unset, the defaults from
+// the KubeDirectorConfig are used. PodSecurityContext is the security
+// context of the member pods, or if unset the default pod security context
+// from the KubeDirectorConfig. RoleSubdomain gives the role's members
+// their own DNS subdomain, through a headless service for just this role,
+// instead of the cluster's. PersistExcludes are added to the app's exclude
+// patterns for the initial copy of the persisted directories. PreStop and
+// TerminationGracePeriodSeconds, if set, replace those of the app's
+// containerSpec for the role. Scratch lists temporary volumes to mount in
+// the app container, apart from the persisted directories.
+// PVCRetentionPolicy decides what happens to the members' persistent
+// storage claims when the role shrinks or the cluster is deleted.
+// ConfigurePolicy overrides, field by field, the app's configure policy for
+// the role. Logging selects how the logs of the role's members are
+// collected. Edge, if set, marks the role's members as running on edge
+// nodes that may be out of contact with the K8s API for long periods.
+// RuntimeSocket gives the app container access to a container runtime, for
+// CI and build apps; it is only allowed in the namespaces listed in the
+// KubeDirectorConfig.
 type Role struct {
-	Name               string                      `json:"id"`
-	PodLabels          map[string]string           `json:"podLabels,omitempty"`
-	PodAnnotations     map[string]string           `json:"podAnnotations,omitempty"`
-	ServiceLabels      map[string]string           `json:"serviceLabels,omitempty"`
-	ServiceAnnotations map[string]string           `json:"serviceAnnotations,omitempty"`
-	Members            *int32                      `json:"members,omitempty"`
-	Resources          corev1.ResourceRequirements `json:"resources"`
-	Affinity           *corev1.Affinity            `json:"affinity,omitempty"`
-	Storage            *ClusterStorage             `json:"storage,omitempty"`
-	EnvVars            []corev1.EnvVar             `json:"env,omitempty"`
-	FileInjections     []FileInjections            `json:"fileInjections,omitempty"`
-	Secret             *KDSecret                   `json:"secret,omitempty"`
-	BlockStorage       *BlockStorage               `json:"blockStorage,omitempty"`
-	ServiceAccountName string                      `json:"serviceAccountName,omitempty"`
-	SecretKeys         []SecretKey                 `json:"secretKeys,omitempty"`
-	VolumeProjections  []VolumeProjections         `json:"volumeProjections,omitempty"`
+	Name                          string                            `json:"id"`
+	PodLabels                     map[string]string                 `json:"podLabels,omitempty"`
+	PodAnnotations                map[string]string                 `json:"podAnnotations,omitempty"`
+	ServiceLabels                 map[string]string                 `json:"serviceLabels,omitempty"`
+	ServiceAnnotations            map[string]string                 `json:"serviceAnnotations,omitempty"`
+	MemberServiceAnnotations      map[string]string                 `json:"memberServiceAnnotations,omitempty"`
+	ServiceType                   *string                           `json:"serviceType,omitempty"`
+	PVCLabels                     map[string]string                 `json:"pvcLabels,omitempty"`
+	PVCAnnotations                map[string]string                 `json:"pvcAnnotations,omitempty"`
+	Members                       *int32                            `json:"members,omitempty"`
+	Resources                     corev1.ResourceRequirements       `json:"resources"`
+	Affinity                      *corev1.Affinity                  `json:"affinity,omitempty"`
+	Tolerations                   []corev1.Toleration               `json:"tolerations,omitempty"`
+	NodeSelector                  map[string]string                 `json:"nodeSelector,omitempty"`
+	TopologySpread                []corev1.TopologySpreadConstraint `json:"topologySpreadConstraints,omitempty"`
+	PriorityClassName             string                            `json:"priorityClassName,omitempty"`
+	RuntimeClassName              string                            `json:"runtimeClassName,omitempty"`
+	ImagePullSecrets              []corev1.LocalObjectReference     `json:"imagePullSecrets,omitempty"`
+	ImagePullPolicy               corev1.PullPolicy                 `json:"imagePullPolicy,omitempty"`
+	PodSecurityContext            *corev1.PodSecurityContext        `json:"podSecurityContext,omitempty"`
+	RoleSubdomain                 bool                              `json:"roleSubdomain,omitempty"`
+	Storage                       *ClusterStorage                   `json:"storage,omitempty"`
+	PersistExcludes               []string                          `json:"persistExcludes,omitempty"`
+	PreStop                       []string                          `json:"preStop,omitempty"`
+	TerminationGracePeriodSeconds *int64                            `json:"terminationGracePeriodSeconds,omitempty"`
+	EnvVars                       []corev1.EnvVar                   `json:"env,omitempty"`
+	EnvFrom                       []corev1.EnvFromSource            `json:"envFrom,omitempty"`
+	FileInjections                []FileInjections                  `json:"fileInjections,omitempty"`
+	Secret                        *KDSecret                         `json:"secret,omitempty"`
+	ConfigMaps                    []KDConfigMap                     `json:"configMaps,omitempty"`
+	PodInfoMountPath              *string                           `json:"podInfoMountPath,omitempty"`
+	BlockStorage                  *BlockStorage                     `json:"blockStorage,omitempty"`
+	ServiceAccountName            string                            `json:"serviceAccountName,omitempty"`
+	SecretKeys                    []SecretKey                       `json:"secretKeys,omitempty"`
+	VolumeProjections             []VolumeProjections               `json:"volumeProjections,omitempty"`
+	WorkloadIdentity              *WorkloadIdentity                 `json:"workloadIdentity,omitempty"`
+	Sidecars                      []Sidecar                         `json:"sidecars,omitempty"`
+	Restart                       *RoleRestart                      `json:"restart,omitempty"`
+	Scratch                       []ScratchVolume                   `json:"scratch,omitempty"`
+	PVCRetentionPolicy            *PVCRetentionPolicy               `json:"persistentVolumeClaimRetentionPolicy,omitempty"`
+	ConfigurePolicy               *ConfigurePolicy                  `json:"configurePolicy,omitempty"`
+	Logging                       *RoleLogging                      `json:"logging,omitempty"`
+	Edge                          *RoleEdge                         `json:"edge,omitempty"`
+	RuntimeSocket                 *RuntimeSocket                    `json:"runtimeSocket,omitempty"`
+}
+
+// RuntimeSocket chooses where the container runtime socket of a role's app
+// container comes from. With Source RuntimeSocketDocker or
+// RuntimeSocketContainerd the socket of the node is mounted, which lets the
+// members control every container on the node. RuntimeSocketDinD instead
+// runs a privileged docker-in-docker sidecar in each member, from Image if
+// that is set; the builds are then isolated from the node's runtime, at the
+// cost of their own image cache.
+type RuntimeSocket struct {
+	Source string  `json:"source"`
+	Image  *string `json:"image,omitempty"`
+}
+
+// RoleEdge describes how the members of an edge role ride out the loss of
+// contact between their node and the K8s API. The members tolerate the
+// not-ready and unreachable node taints for DisconnectToleranceSeconds,
+// or indefinitely if that is unset, so K8s does not evict them from a node
+// that has stopped reporting. The timeouts and failure thresholds of the
+// app's probes for the role are multiplied by ProbeRelaxFactor (default 3).
+type RoleEdge struct {
+	DisconnectToleranceSeconds *int64 `json:"disconnectToleranceSeconds,omitempty"`
+	ProbeRelaxFactor           *int32 `json:"probeRelaxFactor,omitempty"`
+}
+
+// RoleLogging selects how the logs of a role's members are collected. With
+// either Mode, the member pods are annotated with the fluent-bit parsers
+// given by the app, for a node-level log agent to use on the app's stdout
+// and stderr. Mode LoggingSidecar also adds a log shipper container to each
+// member, which sends the app's log files and the setup package logs in
+// /var/log/guestconfig to the log sink of the KubeDirectorConfig.
+// Resources are those of the log shipper container.
+type RoleLogging struct {
+	Mode      string                      `json:"mode"`
+	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
+}
+
+// PVCRetentionPolicy chooses, as PVCRetain or PVCDelete, whether the
+// persistent storage claims of a role's members are kept WhenScaled (when
+// members are removed by shrinking the role) and WhenDeleted (when the
+// cluster is deleted). Either defaults to PVCDelete. A claim kept when
+// scaled is re-used by the member with the same name if the role grows
+// again; a claim kept when deleted is released from the cluster and must be
+// cleaned up by hand.
+type PVCRetentionPolicy struct {
+	WhenScaled  string `json:"whenScaled,omitempty"`
+	WhenDeleted string `json:"whenDeleted,omitempty"`
+}
+
+// ScratchVolume is temporary space mounted in the app container of each
+// member of a role. Its content is lost whenever the member's pod goes away.
+// SizeLimit caps the space used; a member that exceeds it is evicted.
+// Medium "Memory" backs the space with RAM, which counts against the memory
+// limit of the member, instead of node disk.
+type ScratchVolume struct {
+	Name      string  `json:"name"`
+	MountPath string  `json:"mountPath"`
+	SizeLimit *string `json:"sizeLimit,omitempty"`
+	Medium    string  `json:"medium,omitempty"`
+}
+
+// RoleRestart requests a controlled restart of members of a role. Each time
+// Generation is increased, the listed Members (or every member, if none are
+// listed) are restarted one at a time.
+type RoleRestart struct {
+	Generation int64    `json:"generation"`
+	Members    []string `json:"members,omitempty"`
+}
+
+// Sidecar describes an additional container that runs alongside the app
+// container in every member of a role, such as a log shipper, metrics
+// exporter, or proxy.
+type Sidecar struct {
+	Name         string                      `json:"name"`
+	Image        string                      `json:"image"`
+	Command      []string                    `json:"command,omitempty"`
+	Args         []string                    `json:"args,omitempty"`
+	Env          []corev1.EnvVar             `json:"env,omitempty"`
+	Resources    corev1.ResourceRequirements `json:"resources,omitempty"`
+	VolumeMounts []SidecarVolumeMount        `json:"volumeMounts,omitempty"`
+}
+
+// SidecarVolumeMount shares a directory of the app container with a
+// sidecar. If AppPath is within the role's persistent storage, the sidecar
+// mounts that part of the member's PVC. Otherwise an empty directory is
+// mounted at AppPath in the app container and at MountPath in the sidecar.
+type SidecarVolumeMount struct {
+	AppPath   string `json:"appPath"`
+	MountPath string `json:"mountPath"`
+	ReadOnly  bool   `json:"readOnly,omitempty"`
+}
+
+// WorkloadIdentity binds the members of a role to a cloud provider identity.
+// KubeDirector generates a service account for the role annotated for the
+// given provider, and projects any token the provider requires into the
+// app container, so that members can reach cloud services (such as object
+// stores) without static credentials.
+type WorkloadIdentity struct {
+	Provider string  `json:"provider"`
+	Identity string  `json:"identity"`
+	TenantID *string `json:"tenantID,omitempty"`
+	Audience *string `json:"audience,omitempty"`
 }
 
 // SecretKey holds data which is supposed to be only available on configuration phase
@@ -175,7 +740,9 @@ type RestoreProgress struct {
 }
 
 // StateRollup surfaces whether any per-member statuses have problems that
-// should be investigated.
+// should be investigated. MembersDisconnected is set while any edge role
+// member is on a node that is out of contact with K8s; such members are
+// not counted as down.
 type StateRollup struct {
 	MembershipChanging  bool `json:"membershipChanging"`
 	MembersDown         bool `json:"membersDown"`
@@ -184,46 +751,185 @@ type StateRollup struct {
 	MembersRestarting   bool `json:"membersRestarting"`
 	ConfigErrors        bool `json:"configErrors"`
 	MembersNotScheduled bool `json:"membersNotScheduled"`
+	MembersDisconnected bool `json:"membersDisconnected,omitempty"`
 }
 
 // ClusterStorage defines the persistent storage size/type, if any, to be used
 // for certain specified directories of each container filesystem in a role.
+// AccessModes are the access modes of the claims (ReadWriteOnce if empty).
 type ClusterStorage struct {
-	Size         string  `json:"size"`
-	StorageClass *string `json:"storageClassName,omitempty"`
+	Size         string   `json:"size"`
+	StorageClass *string  `json:"storageClassName,omitempty"`
+	AccessModes  []string `json:"accessModes,omitempty"`
 }
 
 // BlockStorage defines the block storage type, path, and optionally size, if any, to be used
-// for mounting a block volume in a role.
+// for mounting a block volume in a role. AccessModes are the access modes of
+// the claims (ReadWriteOnce if empty). EncryptionKeySecret names a secret,
+// in the cluster's namespace, whose "key" entry is the LUKS key for the
+// devices; it is required if the app encrypts the role's block devices.
 type BlockStorage struct {
-	StorageClass *string `json:"storageClassName,omitempty"`
-	Path         *string `json:"pathPrefix,omitempty"`
-	Size         *string `json:"size,omitempty"`
-	NumDevices   *int32  `json:"numDevices,omitempty"`
+	StorageClass        *string  `json:"storageClassName,omitempty"`
+	Path                *string  `json:"pathPrefix,omitempty"`
+	Size                *string  `json:"size,omitempty"`
+	NumDevices          *int32   `json:"numDevices,omitempty"`
+	AccessModes         []string `json:"accessModes,omitempty"`
+	EncryptionKeySecret *string  `json:"encryptionKeySecret,omitempty"`
 }
 
 // RoleStatus describes the component objects of a virtual cluster role.
+// PodTemplateHash is the hash of the pod template that KubeDirector would
+// currently generate for the role; the statefulset's podTemplateHash
+// annotation has the hash of the template that it is actually using.
+// MemberSummary is set when the statuses of the role's steady-state members
+// have been moved out of the cluster status (see MemberSummary). Subdomain
+// names the role's own headless service, if it has one. Restart tracks a
+// member restart requested through the role spec. While the role is being
+// re-created under a changed naming scheme, PreviousStatefulSet names the
+// statefulset being replaced and PreviousMembers its members, whose volumes
+// are cloned for the new members.
 type RoleStatus struct {
-	Name                string            `json:"id"`
-	StatefulSet         string            `json:"statefulSet"`
-	Members             []MemberStatus    `json:"members"`
-	EncryptedSecretKeys map[string]string `json:"encryptedSecretKeys,omitempty"`
+	Name                string             `json:"id"`
+	StatefulSet         string             `json:"statefulSet"`
+	Members             []MemberStatus     `json:"members"`
+	EncryptedSecretKeys map[string]string  `json:"encryptedSecretKeys,omitempty"`
+	Conditions          []Condition        `json:"conditions,omitempty"`
+	ServiceAccount      string             `json:"serviceAccount,omitempty"`
+	Persistence         *RolePersistence   `json:"persistence,omitempty"`
+	PodTemplateHash     string             `json:"podTemplateHash,omitempty"`
+	MemberSummary       *MemberSummary     `json:"memberSummary,omitempty"`
+	Subdomain           string             `json:"subdomain,omitempty"`
+	Restart             *RoleRestartStatus `json:"restart,omitempty"`
+	PreviousStatefulSet string             `json:"previousStatefulSet,omitempty"`
+	PreviousMembers     []PreviousMember   `json:"previousMembers,omitempty"`
+}
+
+// PreviousMember is a member of a role's replaced statefulset, by pod name,
+// with the names of its persistent volume claims.
+type PreviousMember struct {
+	Pod  string   `json:"pod"`
+	PVCs []string `json:"pvcs,omitempty"`
+}
+
+// RoleRestartStatus tracks the progress of a restart requested through the
+// role spec. Generation is the last restart generation acted on. Member is
+// the member currently being restarted, and PreviousContainer the ID of the
+// app container it was running when it was restarted. Pending lists the
+// members still waiting to be restarted.
+type RoleRestartStatus struct {
+	Generation        int64    `json:"generation"`
+	Member            string   `json:"member,omitempty"`
+	PreviousContainer string   `json:"previousContainer,omitempty"`
+	Pending           []string `json:"pending,omitempty"`
+}
+
+// MemberSummary describes the members of a role whose steady-state member
+// statuses are kept in the DetailConfigMap (a configmap in the cluster's
+// namespace) rather than in the cluster status, to keep the status of a
+// very large role small. The Members list of the role status then contains
+// only the members that are changing or have problems. Total is the number
+// of members in the role, and States counts them by member state.
+type MemberSummary struct {
+	Total           int32            `json:"total"`
+	States          map[string]int32 `json:"states"`
+	DetailConfigMap string           `json:"detailConfigMap"`
+}
+
+// RolePersistence describes the storage actually configured for the members
+// of a role: the directories persisted on the role's PVC after the app's
+// persistDirs are combined with KubeDirector's defaults, the volume mounts
+// of the app container, and the PVC templates of the role's statefulset.
+// Encrypted is set if the storage classes of all the PVC templates are
+// known, and tells whether they all encrypt their volumes at rest.
+type RolePersistence struct {
+	PersistDirs    []string               `json:"persistDirs,omitempty"`
+	VolumeMounts   []VolumeMountSummary   `json:"volumeMounts,omitempty"`
+	ClaimTemplates []ClaimTemplateSummary `json:"claimTemplates,omitempty"`
+	Encrypted      *bool                  `json:"encrypted,omitempty"`
+}
+
+// VolumeMountSummary describes one volume mount of the app container.
+type VolumeMountSummary struct {
+	Name      string `json:"name"`
+	MountPath string `json:"mountPath"`
+	SubPath   string `json:"subPath,omitempty"`
+	ReadOnly  bool   `json:"readOnly,omitempty"`
+}
+
+// ClaimTemplateSummary describes one PVC template of a role's statefulset.
+// Encrypted tells whether its storage class encrypts volumes at rest, if
+// the storage class could be found.
+type ClaimTemplateSummary struct {
+	Name         string   `json:"name"`
+	StorageClass string   `json:"storageClassName,omitempty"`
+	Size         string   `json:"size"`
+	VolumeMode   string   `json:"volumeMode,omitempty"`
+	AccessModes  []string `json:"accessModes,omitempty"`
+	Encrypted    *bool    `json:"encrypted,omitempty"`
+}
+
+// Condition describes a notable circumstance affecting some part of a
+// virtual cluster, in the style of the conditions on native k8s objects.
+type Condition struct {
+	Type               string                 `json:"type"`
+	Status             corev1.ConditionStatus `json:"status"`
+	Reason             string                 `json:"reason,omitempty"`
+	Message            string                 `json:"message,omitempty"`
+	LastTransitionTime metav1.Time            `json:"lastTransitionTime,omitempty"`
 }
 
 // MemberStatus describes the component objects of a virtual cluster member.
+// Conditions flag what is currently wrong with the member, if anything.
+// ContainerRestarts lists the containers of the member's current pod that
+// have been restarted.
 type MemberStatus struct {
-	Pod              string            `json:"pod"`
-	Service          string            `json:"service"`
-	AuthToken        string            `json:"authToken,omitempty"`
-	PVC              string            `json:"pvc,omitempty"`
-	State            string            `json:"state"`
-	StateDetail      MemberStateDetail `json:"stateDetail,omitempty"`
-	NodeID           int64             `json:"nodeID"`
-	BlockDevicePaths []string          `json:"blockDevicePaths,omitempty"`
+	Pod               string              `json:"pod"`
+	Service           string              `json:"service"`
+	AuthToken         string              `json:"authToken,omitempty"`
+	PVC               string              `json:"pvc,omitempty"`
+	State             string              `json:"state"`
+	StateDetail       MemberStateDetail   `json:"stateDetail,omitempty"`
+	NodeID            int64               `json:"nodeID"`
+	BlockDevicePaths  []string            `json:"blockDevicePaths,omitempty"`
+	Lifecycle         *MemberLifecycle    `json:"lifecycle,omitempty"`
+	Conditions        []Condition         `json:"conditions,omitempty"`
+	ContainerRestarts []ContainerRestarts `json:"containerRestarts,omitempty"`
+}
+
+// ContainerRestarts is the restart Count of one container of a member's pod,
+// as reported by K8s, with the exit code, reason, and finish time of the
+// container's last termination.
+type ContainerRestarts struct {
+	Container      string       `json:"container"`
+	Count          int32        `json:"count"`
+	LastExitCode   int32        `json:"lastExitCode"`
+	LastReason     string       `json:"lastReason,omitempty"`
+	LastFinishedAt *metav1.Time `json:"lastFinishedAt,omitempty"`
+}
+
+// MemberLifecycle records when a member reached each stage of its initial
+// provisioning: member status created, pod scheduled, persistent storage
+// initialized (only for members with storage), app container running, app
+// setup configured, and pod ready.
+type MemberLifecycle struct {
+	Created            *metav1.Time `json:"created,omitempty"`
+	Scheduled          *metav1.Time `json:"scheduled,omitempty"`
+	StorageInitialized *metav1.Time `json:"storageInitialized,omitempty"`
+	Running            *metav1.Time `json:"running,omitempty"`
+	Configured         *metav1.Time `json:"configured,omitempty"`
+	Ready              *metav1.Time `json:"ready,omitempty"`
 }
 
 // MemberStateDetail digs into detail about the management of configmeta and
-// app scripts in the member.
+// app scripts in the member. CertificateVersion is the resource version of
+// the member's certificate secret that was last installed in the member.
+// ClonedFrom is the source member whose volumes this member's were cloned
+// from, if any. Configure tracks the runs of the app's initial configuration.
+// StorageInit summarizes the initial copy of the persisted directories onto
+// the member's storage. SetupAttempts counts the runs of the initial
+// configuration over the life of the member, and LastConfigureError is why
+// the latest failed one failed; unlike the counts in Configure, these are
+// not reset when a member in config error state is retried.
 type MemberStateDetail struct {
 	ConfigErrorDetail        *string             `json:"configErrorDetail,omitempty"`
 	LastConfigDataGeneration *int64              `json:"lastConfigDataGeneration,omitempty"`
@@ -236,6 +942,76 @@ type MemberStateDetail struct {
 	StartScriptOutMsg        string              `json:"startScriptStdoutMessage,omitempty"`
 	StartScriptErrMsg        string              `json:"startScriptStderrMessage,omitempty"`
 	SchedulingErrorMessage   *string             `json:"schedulingErrorMessage,omitempty"`
+	PendingReason            *string             `json:"pendingReason,omitempty"`
+	ImagePullError           *ImagePullStatus    `json:"imagePullError,omitempty"`
+	ConfiguredImage          string              `json:"configuredImage,omitempty"`
+	CertificateVersion       string              `json:"certificateVersion,omitempty"`
+	Decommission             *DecommissionStatus `json:"decommission,omitempty"`
+	ClonedFrom               string              `json:"clonedFrom,omitempty"`
+	Configure                *ConfigureStatus    `json:"configure,omitempty"`
+	StorageInit              *StorageInitSummary `json:"storageInit,omitempty"`
+	Stop                     *MemberStopStatus   `json:"stop,omitempty"`
+	SetupAttempts            int32               `json:"setupAttempts,omitempty"`
+	LastConfigureError       string              `json:"lastConfigureError,omitempty"`
+}
+
+// StorageInitSummary is the compact record that the init container of a
+// member leaves of the initial copy onto its persistent storage: the copy
+// Method (rsync or cp), its ExitCode and duration in Seconds, the final
+// rsync progress line as Summary, and the last lines of the rsync log as
+// LogTail. The bulky rsync log is removed from the storage once a copy has
+// succeeded.
+type StorageInitSummary struct {
+	Method   string   `json:"method"`
+	ExitCode int32    `json:"exitCode"`
+	Seconds  int64    `json:"seconds"`
+	Summary  string   `json:"summary,omitempty"`
+	LogTail  []string `json:"logTail,omitempty"`
+}
+
+// ConfigureStatus counts the Attempts at the initial configuration of a
+// member. Started is when the attempt now running, if any, started.
+// LastError is why the latest failed attempt failed. RetryAfter, while set, is when the next
+// attempt is due.
+type ConfigureStatus struct {
+	Attempts   int32        `json:"attempts"`
+	Started    *metav1.Time `json:"started,omitempty"`
+	RetryAfter *metav1.Time `json:"retryAfter,omitempty"`
+	LastError  string       `json:"lastError,omitempty"`
+}
+
+// DecommissionStatus describes the progress of the app's decommission hook
+// on a member that is leaving its role. State is one of running, succeeded,
+// failed, or timedOut; Message has the reason for a failure.
+type DecommissionStatus struct {
+	State   string      `json:"state"`
+	Started metav1.Time `json:"started"`
+	Message string      `json:"message,omitempty"`
+}
+
+// MemberStopStatus describes the most recent time that KubeDirector stopped
+// a member: for a restart, a shrink or removal of its role, or the
+// re-creation of the cluster's objects. Reason is one of Restart, Shrink,
+// RoleRemoved, or Recreate. State is that of the app's stop hook: running,
+// succeeded, failed, timedOut, or skipped (if the app does not handle the
+// stop event, or the member was never configured). Container is the
+// container that was stopped.
+type MemberStopStatus struct {
+	Reason    string      `json:"reason"`
+	State     string      `json:"state"`
+	Container string      `json:"container,omitempty"`
+	Started   metav1.Time `json:"started"`
+	Message   string      `json:"message,omitempty"`
+}
+
+// ImagePullStatus describes an ongoing failure to pull the image for one of
+// a member's containers. Since records when the failure was first observed.
+type ImagePullStatus struct {
+	Container string      `json:"container"`
+	Image     string      `json:"image"`
+	Reason    string      `json:"reason"`
+	Message   string      `json:"message,omitempty"`
+	Since     metav1.Time `json:"since"`
 }
 
 // NotificationDesc contains the info necessary to perform a notify command.
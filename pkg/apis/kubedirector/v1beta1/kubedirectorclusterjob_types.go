@@ -0,0 +1,120 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Condition types that may appear in the conditions list of a cluster job
+// status.
+const (
+	// ClusterJobBlocked is true when the job cannot be run, e.g. because the
+	// cluster does not exist or the job spec is invalid. The message gives
+	// the error.
+	ClusterJobBlocked string = "Blocked"
+)
+
+// KubeDirectorClusterJobSpec defines the desired state of
+// KubeDirectorClusterJob: the cluster whose members the job runs on, what to
+// run (either a Command, or a Hook of the role's setup package), and when to
+// run it. Roles and Members narrow down the members to run on; OnePerRole
+// runs the job on only one member of each selected role. A job without a
+// Schedule runs once when created, and a job with one runs according to
+// that cron schedule unless Suspend is set. Either way, increasing
+// RunGeneration runs the job once more on demand.
+type KubeDirectorClusterJobSpec struct {
+	Cluster        string   `json:"cluster"`
+	Command        []string `json:"command,omitempty"`
+	Hook           string   `json:"hook,omitempty"`
+	Roles          []string `json:"roles,omitempty"`
+	Members        []string `json:"members,omitempty"`
+	OnePerRole     bool     `json:"onePerRole,omitempty"`
+	Schedule       string   `json:"schedule,omitempty"`
+	Suspend        bool     `json:"suspend,omitempty"`
+	RunGeneration  int64    `json:"runGeneration,omitempty"`
+	TimeoutSeconds *int32   `json:"timeoutSeconds,omitempty"`
+	HistoryLimit   *int32   `json:"historyLimit,omitempty"`
+}
+
+// KubeDirectorClusterJobStatus defines the observed state of
+// KubeDirectorClusterJob. RunGeneration is the last on-demand run generation
+// acted on, and LastScheduleTime the last time a scheduled run was started.
+// Active is the run in progress, if any, and History the finished runs,
+// oldest first.
+type KubeDirectorClusterJobStatus struct {
+	RunGeneration    *int64          `json:"runGeneration,omitempty"`
+	LastScheduleTime *metav1.Time    `json:"lastScheduleTime,omitempty"`
+	Active           *ClusterJobRun  `json:"active,omitempty"`
+	History          []ClusterJobRun `json:"history,omitempty"`
+	Conditions       []Condition     `json:"conditions,omitempty"`
+}
+
+// ClusterJobRun describes one run of a cluster job. Trigger says why the
+// run was started (created, onDemand, or schedule), and State is one of
+// running, succeeded, or failed. Message explains a run that could not be
+// started on any member.
+type ClusterJobRun struct {
+	ID       string                `json:"id"`
+	Trigger  string                `json:"trigger"`
+	State    string                `json:"state"`
+	Started  metav1.Time           `json:"started"`
+	Finished *metav1.Time          `json:"finished,omitempty"`
+	Message  string                `json:"message,omitempty"`
+	Members  []ClusterJobMemberRun `json:"members,omitempty"`
+}
+
+// ClusterJobMemberRun describes the part of a cluster job run that ran on
+// one member. ContainerID is the member's app container that the job was
+// started in. State is one of running, succeeded, failed, or timedOut.
+// Stdout and Stderr hold the end of the job's output on the member.
+type ClusterJobMemberRun struct {
+	Pod         string `json:"pod"`
+	Role        string `json:"role"`
+	ContainerID string `json:"containerID"`
+	State       string `json:"state"`
+	ExitStatus  *int32 `json:"exitStatus,omitempty"`
+	Stdout      string `json:"stdout,omitempty"`
+	Stderr      string `json:"stderr,omitempty"`
+	Message     string `json:"message,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// KubeDirectorClusterJob is the Schema for the kubedirectorclusterjobs API.
+// This object runs a command or setup package hook on members of a virtual
+// cluster, on demand or on a schedule, and keeps a history of the runs and
+// their output.
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:path=kubedirectorclusterjobs,scope=Namespaced
+type KubeDirectorClusterJob struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              KubeDirectorClusterJobSpec    `json:"spec,omitempty"`
+	Status            *KubeDirectorClusterJobStatus `json:"status,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// KubeDirectorClusterJobList contains a list of KubeDirectorClusterJob.
+type KubeDirectorClusterJobList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []KubeDirectorClusterJob `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&KubeDirectorClusterJob{}, &KubeDirectorClusterJobList{})
+}
@@ -15,24 +15,177 @@
 package v1beta1
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 // KubeDirectorConfigSpec defines the desired state of KubeDirectorConfig.
 type KubeDirectorConfigSpec struct {
-	StorageClass                   *string           `json:"defaultStorageClassName,omitempty"`
-	ServiceType                    *string           `json:"defaultServiceType,omitempty"`
-	NativeSystemdSupport           *bool             `json:"nativeSystemdSupport,omitempty"`
-	RequiredSecretPrefix           *string           `json:"requiredSecretPrefix,omitempty"`
-	ClusterSvcDomainBase           *string           `json:"clusterSvcDomainBase,omitempty"`
-	DefaultNamingScheme            *string           `json:"defaultNamingScheme,omitempty"`
-	MasterEncryptionKey            *string           `json:"masterEncryptionKey,omitempty"`
-	PodLabels                      map[string]string `json:"podLabels,omitempty"`
-	PodAnnotations                 map[string]string `json:"podAnnotations,omitempty"`
-	ServiceLabels                  map[string]string `json:"serviceLabels,omitempty"`
-	ServiceAnnotations             map[string]string `json:"serviceAnnotations,omitempty"`
-	BackupClusterStatus            *bool             `json:"backupClusterStatus,omitempty"`
-	AllowRestoreWithoutConnections *bool             `json:"allowRestoreWithoutConnections,omitempty"`
+	StorageClass                   *string                    `json:"defaultStorageClassName,omitempty"`
+	ServiceType                    *string                    `json:"defaultServiceType,omitempty"`
+	NativeSystemdSupport           *bool                      `json:"nativeSystemdSupport,omitempty"`
+	RequiredSecretPrefix           *string                    `json:"requiredSecretPrefix,omitempty"`
+	ClusterSvcDomainBase           *string                    `json:"clusterSvcDomainBase,omitempty"`
+	DefaultNamingScheme            *string                    `json:"defaultNamingScheme,omitempty"`
+	MasterEncryptionKey            *string                    `json:"masterEncryptionKey,omitempty"`
+	PodLabels                      map[string]string          `json:"podLabels,omitempty"`
+	PodAnnotations                 map[string]string          `json:"podAnnotations,omitempty"`
+	ServiceLabels                  map[string]string          `json:"serviceLabels,omitempty"`
+	ServiceAnnotations             map[string]string          `json:"serviceAnnotations,omitempty"`
+	BackupClusterStatus            *bool                      `json:"backupClusterStatus,omitempty"`
+	AllowRestoreWithoutConnections *bool                      `json:"allowRestoreWithoutConnections,omitempty"`
+	HaltExpansionOnImagePullError  *bool                      `json:"haltExpansionOnImagePullError,omitempty"`
+	ClusterSpecFragments           []string                   `json:"clusterSpecFragments,omitempty"`
+	RejectConflictingChanges       *bool                      `json:"rejectConflictingChanges,omitempty"`
+	AppAntiAffinity                *AppAntiAffinity           `json:"appAntiAffinity,omitempty"`
+	DebugImage                     *string                    `json:"debugImage,omitempty"`
+	AutoTopologySpread             *AutoTopologySpread        `json:"autoTopologySpread,omitempty"`
+	EscalatedWarnings              []string                   `json:"escalatedWarnings,omitempty"`
+	MembershipApproval             *string                    `json:"membershipApproval,omitempty"`
+	RequireShrinkAcknowledgement   *bool                      `json:"requireShrinkAcknowledgement,omitempty"`
+	DeletedPVCRetentionSeconds     *int32                     `json:"deletedPVCRetentionSeconds,omitempty"`
+	NetworkPolicies                *bool                      `json:"networkPolicies,omitempty"`
+	CheckConnectionAccess          *bool                      `json:"checkConnectionAccess,omitempty"`
+	Ingress                        *IngressConfig             `json:"ingress,omitempty"`
+	MemberCertificates             *MemberCertsConfig         `json:"memberCertificates,omitempty"`
+	MemberStatusDetailLimit        *int32                     `json:"memberStatusDetailLimit,omitempty"`
+	ImagePullSecrets               []string                   `json:"defaultImagePullSecrets,omitempty"`
+	ImagePullPolicy                *string                    `json:"defaultImagePullPolicy,omitempty"`
+	PodSecurityContext             *corev1.PodSecurityContext `json:"defaultPodSecurityContext,omitempty"`
+	InitContainer                  *InitContainerConfig       `json:"defaultInitContainer,omitempty"`
+	SchedulingDefaults             *SchedulingDefaults        `json:"schedulingDefaults,omitempty"`
+	CacheSetupPackages             *bool                      `json:"cacheSetupPackages,omitempty"`
+	OwnerRefRepairPolicy           *string                    `json:"ownerRefRepairPolicy,omitempty"`
+	LogSink                        *LogSinkConfig             `json:"logSink,omitempty"`
+	Dashboards                     *DashboardConfig           `json:"dashboards,omitempty"`
+	LintSeverities                 map[string]string          `json:"lintSeverities,omitempty"`
+	RuntimeSocketNamespaces        []string                   `json:"runtimeSocketNamespaces,omitempty"`
+}
+
+// Policies for the membershipApproval property of a KubeDirectorConfig,
+// selecting which changes to role member counts must be approved before
+// they are carried out.
+const (
+	// ApprovalNone means that no membership changes need approval.
+	ApprovalNone string = "None"
+
+	// ApprovalShrink means that changes which remove members from any role
+	// (including removing the role) need approval.
+	ApprovalShrink string = "Shrink"
+
+	// ApprovalAll means that every membership change of an existing cluster
+	// needs approval.
+	ApprovalAll string = "All"
+)
+
+// Policies for the ownerRefRepairPolicy property of a KubeDirectorConfig,
+// selecting what KubeDirector does when an object that it manages for a
+// virtual cluster is missing the owner reference to the cluster.
+const (
+	// OwnerRefRepairReplace replaces all of the object's owner references
+	// with the one to the cluster.
+	OwnerRefRepairReplace string = "Replace"
+
+	// OwnerRefRepairMerge adds the owner reference to the cluster, keeping
+	// the existing ones. Any other controller reference is kept as a plain
+	// owner reference, since an object can have only one controller.
+	OwnerRefRepairMerge string = "Merge"
+
+	// OwnerRefRepairReportOnly only reports the missing owner reference.
+	OwnerRefRepairReportOnly string = "ReportOnly"
+)
+
+// IngressConfig asks KubeDirector to expose the app service endpoints that
+// are marked for ingress through generated Ingress objects, or OpenShift
+// Routes if Routes is true. HostTemplate forms the host name for each
+// member and service endpoint; it may contain the placeholders {member},
+// {service}, {role}, {cluster}, and {namespace}, and must contain at least
+// {member} and {service}. Class selects the ingress controller, through the
+// kubernetes.io/ingress.class annotation. Annotations are added to every
+// generated object. TLSSecret names a secret (in each cluster's namespace)
+// with the certificate for the Ingress hosts; for Routes, any TLSSecret
+// value turns on edge termination with the router's certificate.
+type IngressConfig struct {
+	HostTemplate string            `json:"hostTemplate"`
+	Class        *string           `json:"class,omitempty"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+	TLSSecret    *string           `json:"tlsSecret,omitempty"`
+	Routes       bool              `json:"routes,omitempty"`
+}
+
+// LogSinkConfig is where the logging sidecars of virtual cluster members
+// send their logs. Output names a fluent-bit output plugin (such as
+// "forward", "es", or "loki"), and Properties are the settings of that
+// plugin. Image, if set, replaces the default fluent-bit image of the
+// sidecars.
+type LogSinkConfig struct {
+	Output     string            `json:"output"`
+	Properties map[string]string `json:"properties,omitempty"`
+	Image      *string           `json:"image,omitempty"`
+}
+
+// DashboardConfig asks KubeDirector to generate a Grafana dashboard for each
+// virtual cluster, in a configmap in the cluster's namespace that the
+// dashboard loader sidecar of Grafana can pick up. Label and LabelValue form
+// the label that the sidecar looks for (by default grafana_dashboard=1).
+// Datasource names the Prometheus datasource in Grafana that scrapes the
+// KubeDirector and container metrics (by default "Prometheus"). Folder, if
+// set, is placed in the grafana_folder annotation of the configmap.
+type DashboardConfig struct {
+	Label      *string `json:"label,omitempty"`
+	LabelValue *string `json:"labelValue,omitempty"`
+	Datasource *string `json:"datasource,omitempty"`
+	Folder     *string `json:"folder,omitempty"`
+}
+
+// MemberCertsConfig asks KubeDirector to request a TLS certificate for each
+// virtual cluster member from cert-manager. IssuerName names the issuer to
+// use: an Issuer in each cluster's namespace, or a ClusterIssuer if
+// IssuerKind is "ClusterIssuer". Duration, if set, is the requested lifetime
+// of the certificates (in Go duration format, e.g. "2160h").
+type MemberCertsConfig struct {
+	IssuerName string  `json:"issuerName"`
+	IssuerKind *string `json:"issuerKind,omitempty"`
+	Duration   *string `json:"duration,omitempty"`
+}
+
+// Kinds of cert-manager issuer that may be named in the memberCertificates
+// property of a KubeDirectorConfig.
+const (
+	CertIssuer        string = "Issuer"
+	CertClusterIssuer string = "ClusterIssuer"
+)
+
+// AppAntiAffinity asks KubeDirector to discourage the scheduling of members
+// of different clusters of the listed apps into the same topology domain
+// (by default, the same node). If Roles is non-empty, only members of those
+// roles are affected, and they are only kept apart from members of the same
+// role. Weight is the weight of the generated preferred anti-affinity term.
+type AppAntiAffinity struct {
+	Apps        []string `json:"apps"`
+	Roles       []string `json:"roles,omitempty"`
+	Weight      *int32   `json:"weight,omitempty"`
+	TopologyKey *string  `json:"topologyKey,omitempty"`
+}
+
+// AutoTopologySpread asks KubeDirector to generate a topology spread
+// constraint, for each of the listed topology keys, for the members of any
+// role that does not specify its own topologySpreadConstraints. The
+// generated constraints are soft (ScheduleAnyway) and allow the given
+// maximum skew, defaulting to 1.
+type AutoTopologySpread struct {
+	TopologyKeys []string `json:"topologyKeys"`
+	MaxSkew      *int32   `json:"maxSkew,omitempty"`
+}
+
+// SchedulingDefaults are pod scheduling settings that are filled in, when a
+// virtual cluster is created, for each role that does not set the same
+// property itself.
+type SchedulingDefaults struct {
+	Tolerations       []corev1.Toleration `json:"tolerations,omitempty"`
+	NodeSelector      map[string]string   `json:"nodeSelector,omitempty"`
+	RuntimeClassName  *string             `json:"runtimeClassName,omitempty"`
+	PriorityClassName *string             `json:"priorityClassName,omitempty"`
 }
 
 // KubeDirectorConfigStatus defines the observed state of KubeDirectorConfig.
@@ -0,0 +1,66 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1beta1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// KubeDirectorNamespaceConfigSpec defines the desired state of
+// KubeDirectorNamespaceConfig: overrides of the KubeDirectorConfig settings
+// for the virtual clusters in one namespace, plus limits on what those
+// clusters may use. StorageClass and ServiceType take precedence over the
+// defaults of the same names in the KubeDirectorConfig. If AllowedApps is
+// non-empty, only clusters of the listed apps may be created in the
+// namespace. MaxMemberResources caps the requests and limits that any one
+// member may ask for, per resource name. MaxClusterResources caps the total
+// footprint of one cluster, using the same resource names as the hard
+// limits of a ResourceQuota (e.g. "requests.cpu", "limits.memory",
+// "requests.storage", or "pods").
+type KubeDirectorNamespaceConfigSpec struct {
+	StorageClass        *string             `json:"defaultStorageClassName,omitempty"`
+	ServiceType         *string             `json:"defaultServiceType,omitempty"`
+	AllowedApps         []string            `json:"allowedApps,omitempty"`
+	MaxMemberResources  corev1.ResourceList `json:"maxMemberResources,omitempty"`
+	MaxClusterResources corev1.ResourceList `json:"maxClusterResources,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// KubeDirectorNamespaceConfig is the Schema for the
+// kubedirectornamespaceconfigs API. At most one such object, named
+// kd-namespace-config, applies to each namespace.
+// +kubebuilder:resource:path=kubedirectornamespaceconfigs,scope=Namespaced
+type KubeDirectorNamespaceConfig struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec *KubeDirectorNamespaceConfigSpec `json:"spec,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// KubeDirectorNamespaceConfigList contains a list of
+// KubeDirectorNamespaceConfig.
+type KubeDirectorNamespaceConfigList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []KubeDirectorNamespaceConfig `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&KubeDirectorNamespaceConfig{}, &KubeDirectorNamespaceConfigList{})
+}
@@ -0,0 +1,77 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Condition types that may appear in the conditions list of a role scale
+// status.
+const (
+	// RoleScaleBlocked is true when the requested member count could not be
+	// applied to the cluster role, e.g. because the cluster or role does not
+	// exist or the cluster change was rejected. The message gives the error.
+	RoleScaleBlocked string = "Blocked"
+)
+
+// KubeDirectorRoleScaleSpec defines the desired state of
+// KubeDirectorRoleScale: the cluster role to scale and its desired member
+// count. Members is the property exposed through the scale subresource.
+type KubeDirectorRoleScaleSpec struct {
+	Cluster string `json:"cluster"`
+	Role    string `json:"role"`
+	Members *int32 `json:"members,omitempty"`
+}
+
+// KubeDirectorRoleScaleStatus defines the observed state of
+// KubeDirectorRoleScale. Members is the current member count of the role and
+// Selector is the label selector for its member pods, in string form as
+// expected by the HorizontalPodAutoscaler.
+type KubeDirectorRoleScaleStatus struct {
+	Members            int32       `json:"members"`
+	Selector           string      `json:"selector"`
+	ObservedGeneration int64       `json:"observedGeneration"`
+	Conditions         []Condition `json:"conditions,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// KubeDirectorRoleScale is the Schema for the kubedirectorrolescales API.
+// This object exposes the member count of one role of a virtual cluster
+// through a scale subresource, so that a HorizontalPodAutoscaler or other
+// automation can resize the role without editing the cluster spec.
+// +kubebuilder:subresource:status
+// +kubebuilder:subresource:scale:specpath=.spec.members,statuspath=.status.members,selectorpath=.status.selector
+// +kubebuilder:resource:path=kubedirectorrolescales,scope=Namespaced
+type KubeDirectorRoleScale struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              KubeDirectorRoleScaleSpec    `json:"spec,omitempty"`
+	Status            *KubeDirectorRoleScaleStatus `json:"status,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// KubeDirectorRoleScaleList contains a list of KubeDirectorRoleScale.
+type KubeDirectorRoleScaleList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []KubeDirectorRoleScale `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&KubeDirectorRoleScale{}, &KubeDirectorRoleScaleList{})
+}
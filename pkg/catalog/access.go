@@ -0,0 +1,97 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catalog
+
+import (
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	"github.com/bluek8s/kubedirector/pkg/observer"
+	"github.com/bluek8s/kubedirector/pkg/shared"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+)
+
+// connectionAllowed determines whether the named object, of the given
+// resource type and API group, may be read on behalf of the given cluster
+// for use as a connection. If the checkConnectionAccess config property is
+// set, the object may only be read if the cluster's creator is allowed to
+// get it. Clusters with no recorded creator are not checked. A denial is
+// reported as a warning event on the cluster.
+func connectionAllowed(
+	cr *kdv1.KubeDirectorCluster,
+	group string,
+	resource string,
+	name string,
+) (bool, error) {
+
+	if !shared.GetCheckConnectionAccess() {
+		return true, nil
+	}
+	creator, creatorErr := shared.ClusterCreator(cr)
+	if creatorErr != nil {
+		return false, creatorErr
+	}
+	if creator == nil {
+		return true, nil
+	}
+	allowed, reason, reviewErr := shared.UserAllowed(
+		creator,
+		cr.Namespace,
+		group,
+		resource,
+		name,
+		"get",
+	)
+	if reviewErr != nil {
+		return false, reviewErr
+	}
+	if !allowed {
+		shared.LogEventf(
+			cr,
+			v1.EventTypeWarning,
+			shared.EventReasonCluster,
+			"not connecting %s{%s}: creator %s may not read it: %s",
+			resource,
+			name,
+			creator.Username,
+			reason,
+		)
+	}
+	return allowed, nil
+}
+
+// connectedSecret reads the named secret for use by a connection of the
+// given cluster, subject to connectionAllowed. It returns nil, rather than
+// an error, if the secret does not exist or may not be read.
+func connectedSecret(
+	cr *kdv1.KubeDirectorCluster,
+	name string,
+) (*v1.Secret, error) {
+
+	allowed, accessErr := connectionAllowed(cr, "", "secrets", name)
+	if accessErr != nil {
+		return nil, accessErr
+	}
+	if !allowed {
+		return nil, nil
+	}
+	sec, err := observer.GetSecret(cr.Namespace, name)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return sec, nil
+}
@@ -20,6 +20,7 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"github.com/bluek8s/kubedirector/pkg/secretkeys"
+	"net/url"
 	"strconv"
 	"sync"
 	"time"
@@ -41,6 +42,9 @@ const (
 	// SecretType is a label placed on desired secret that
 	// we want to watch and propogate inside containers
 	secretType = shared.KdDomainBase + "/secretType"
+	// databaseCAKey is the key of the CA bundle in a database's TLS CA
+	// secret.
+	databaseCAKey = "ca.crt"
 )
 
 // allServiceRefkeys is a subroutine of getServices, used to generate a
@@ -190,6 +194,13 @@ func genConfigConnections(
 	// every configmap is a map of string and string
 	kdcm := make(map[string][]map[string]map[string]string)
 	for _, connectedCmName := range cr.Spec.Connections.ConfigMaps {
+		allowed, accessErr := connectionAllowed(cr, "", "configmaps", connectedCmName)
+		if accessErr != nil {
+			return nil, accessErr
+		}
+		if !allowed {
+			continue
+		}
 		cm, err := observer.GetConfigMap(cr.Namespace, connectedCmName)
 		if err != nil {
 			if errors.IsNotFound(err) {
@@ -227,6 +238,13 @@ func genSecretConnections(
 	// every secret is a map of string and byte array
 	kdsecret := make(map[string][]map[string]map[string][]byte)
 	for _, connectedsecretName := range cr.Spec.Connections.Secrets {
+		allowed, accessErr := connectionAllowed(cr, "", "secrets", connectedsecretName)
+		if accessErr != nil {
+			return nil, accessErr
+		}
+		if !allowed {
+			continue
+		}
 		sec, err := observer.GetSecret(cr.Namespace, connectedsecretName)
 		if err != nil {
 			if errors.IsNotFound(err) {
@@ -259,6 +277,165 @@ func genSecretConnections(
 	return kdsecret, nil
 }
 
+// genObjectStoreConnections will look at the cluster spec and generate a
+// map of object store connection name to its normalized description. If a
+// connection references a credentials secret, the secret's data is included
+// as-is; a missing secret, or one that the cluster creator may not read,
+// just results in no credentials.
+func genObjectStoreConnections(
+	cr *kdv1.KubeDirectorCluster,
+) (map[string]objectStore, error) {
+
+	stores := make(map[string]objectStore)
+	for _, conn := range cr.Spec.Connections.ObjectStores {
+		store := objectStore{
+			Type:   conn.Type,
+			Bucket: conn.Bucket,
+		}
+		if conn.Endpoint != nil {
+			store.Endpoint = *conn.Endpoint
+		}
+		if conn.Region != nil {
+			store.Region = *conn.Region
+		}
+		store.URI = objectStoreURI(conn)
+		if conn.SecretRef != nil {
+			sec, err := connectedSecret(cr, *conn.SecretRef)
+			if err != nil {
+				return nil, err
+			}
+			if sec != nil {
+				store.Credentials = make(map[string]string)
+				for k, v := range sec.Data {
+					store.Credentials[k] = string(v)
+				}
+			}
+		}
+		stores[conn.Name] = store
+	}
+	return stores, nil
+}
+
+// DatabasePort returns the port to use for the given database connection,
+// which is the engine's default port if none was specified.
+func DatabasePort(
+	conn kdv1.DatabaseConnection,
+) int32 {
+
+	if conn.Port != nil {
+		return *conn.Port
+	}
+	switch conn.Engine {
+	case kdv1.DatabasePostgres:
+		return 5432
+	case kdv1.DatabaseMySQL, kdv1.DatabaseMariaDB:
+		return 3306
+	case kdv1.DatabaseMSSQL:
+		return 1433
+	case kdv1.DatabaseOracle:
+		return 1521
+	}
+	return 0
+}
+
+// genDatabaseConnections will look at the cluster spec and generate a map
+// of database connection name to its normalized description. Referenced
+// secrets that do not exist, or that the cluster creator may not read, are
+// skipped, as for other connections.
+func genDatabaseConnections(
+	cr *kdv1.KubeDirectorCluster,
+) (map[string]database, error) {
+
+	databases := make(map[string]database)
+	for _, conn := range cr.Spec.Connections.Databases {
+		db := database{
+			Engine: conn.Engine,
+			Host:   conn.Host,
+			Port:   DatabasePort(conn),
+		}
+		if conn.Database != nil {
+			db.Database = *conn.Database
+		}
+		if conn.SecretRef != nil {
+			sec, err := connectedSecret(cr, *conn.SecretRef)
+			if err != nil {
+				return nil, err
+			}
+			if sec != nil {
+				db.Credentials = make(map[string]string)
+				for k, v := range sec.Data {
+					db.Credentials[k] = string(v)
+				}
+			}
+		}
+		if (conn.TLS != nil) && conn.TLS.Enabled {
+			db.TLS = true
+			if conn.TLS.CASecretRef != nil {
+				sec, err := connectedSecret(cr, *conn.TLS.CASecretRef)
+				if err != nil {
+					return nil, err
+				}
+				if sec != nil {
+					db.CACert = string(sec.Data[databaseCAKey])
+				}
+			}
+		}
+		db.JDBCURL = databaseJDBCURL(db)
+		databases[conn.Name] = db
+	}
+	return databases, nil
+}
+
+// databaseJDBCURL forms a JDBC URL for the given database, for the benefit
+// of the many data apps that are configured that way.
+func databaseJDBCURL(
+	db database,
+) string {
+
+	hostPort := db.Host + ":" + strconv.Itoa(int(db.Port))
+	switch db.Engine {
+	case kdv1.DatabasePostgres:
+		return "jdbc:postgresql://" + hostPort + "/" + db.Database
+	case kdv1.DatabaseMySQL:
+		return "jdbc:mysql://" + hostPort + "/" + db.Database
+	case kdv1.DatabaseMariaDB:
+		return "jdbc:mariadb://" + hostPort + "/" + db.Database
+	case kdv1.DatabaseMSSQL:
+		result := "jdbc:sqlserver://" + hostPort
+		if db.Database != "" {
+			result += ";databaseName=" + db.Database
+		}
+		return result
+	case kdv1.DatabaseOracle:
+		return "jdbc:oracle:thin:@//" + hostPort + "/" + db.Database
+	}
+	return ""
+}
+
+// objectStoreURI forms the conventional URI prefix for the objects in the
+// given bucket.
+func objectStoreURI(
+	conn kdv1.ObjectStoreConnection,
+) string {
+
+	switch conn.Type {
+	case kdv1.ObjectStoreS3:
+		return "s3://" + conn.Bucket
+	case kdv1.ObjectStoreGCS:
+		return "gs://" + conn.Bucket
+	case kdv1.ObjectStoreABFS:
+		host := ""
+		if conn.Endpoint != nil {
+			host = *conn.Endpoint
+			if u, err := url.Parse(host); err == nil && u.Host != "" {
+				host = u.Host
+			}
+		}
+		return "abfss://" + conn.Bucket + "@" + host
+	}
+	return ""
+}
+
 // genClusterConnections generates a map of running clusters that are to be connected
 // to this cluster
 func genClusterConnections(
@@ -267,6 +444,13 @@ func genClusterConnections(
 
 	toConnectMeta := make(map[string]configmeta)
 	for _, clusterName := range cr.Spec.Connections.Clusters {
+		allowed, accessErr := connectionAllowed(cr, shared.KdDomainBase, "kubedirectorclusters", clusterName)
+		if accessErr != nil {
+			return nil, accessErr
+		}
+		if !allowed {
+			continue
+		}
 		// Fetch the cluster object
 		clusterToConnect, connectedErr := observer.GetCluster(cr.Namespace, clusterName)
 		if connectedErr != nil {
@@ -276,6 +460,9 @@ func genClusterConnections(
 				return nil, connectedErr
 			}
 		}
+		if loadErr := shared.LoadMemberStatusDetail(clusterToConnect); loadErr != nil {
+			return nil, loadErr
+		}
 		appForclusterToConnect, connectedAppErr := observer.GetApp(clusterToConnect.Namespace, clusterToConnect.Spec.AppID)
 		if connectedAppErr != nil {
 			if errors.IsNotFound(connectedAppErr) {
@@ -284,7 +471,6 @@ func genClusterConnections(
 				return nil, connectedAppErr
 			}
 		}
-		domain := clusterToConnect.Status.ClusterService + "." + clusterToConnect.Namespace + shared.GetSvcClusterDomainBase()
 		membersForRole := make(map[string][]*kdv1.MemberStatus)
 		for _, roleInfo := range clusterToConnect.Status.Roles {
 			var membersStatus []*kdv1.MemberStatus
@@ -297,7 +483,7 @@ func genClusterConnections(
 			membersForRole[roleInfo.Name] = membersStatus
 		}
 
-		nodegroups, err := nodegroups(clusterToConnect, appForclusterToConnect, membersForRole, domain)
+		nodegroups, err := nodegroups(clusterToConnect, appForclusterToConnect, membersForRole)
 		if err != nil {
 			return nil, err
 		}
@@ -336,7 +522,6 @@ func nodegroups(
 	cr *kdv1.KubeDirectorCluster,
 	appCR *kdv1.KubeDirectorApp,
 	membersForRole map[string][]*kdv1.MemberStatus,
-	domain string,
 ) (map[string]nodegroup, error) {
 
 	roles := make(map[string]role)
@@ -348,6 +533,7 @@ func nodegroups(
 			continue
 		}
 
+		domain := shared.MemberDomain(cr, roleName)
 		var fqdns []string
 		var nodeIds []string
 		fqdnMappings := make(map[string]string)
@@ -384,6 +570,7 @@ func nodegroups(
 			FQDNMappings: fqdnMappings,
 			Flavor:       roleFlavor,
 			SecretKeys:   secretKeys,
+			Containers:   roleContainers(appCR, roleName),
 		}
 	}
 	return map[string]nodegroup{
@@ -396,6 +583,40 @@ func nodegroups(
 	}, nil
 }
 
+// roleContainers describes the containers in each member of the given role:
+// the app container, followed by any additional containers of the app. It
+// is empty if the role has no additional containers.
+func roleContainers(
+	appCR *kdv1.KubeDirectorApp,
+	roleName string,
+) []container {
+
+	appRole := GetRoleFromID(appCR, roleName)
+	if (appRole == nil) || (len(appRole.Containers) == 0) {
+		return nil
+	}
+	mainContainer := container{Name: "app"}
+	if appRole.ImageRepoTag != nil {
+		mainContainer.Image = *appRole.ImageRepoTag
+	}
+	result := []container{mainContainer}
+	for _, appContainer := range appRole.Containers {
+		ports := make(map[string]int32)
+		for _, port := range appContainer.Ports {
+			ports[port.Name] = port.Port
+		}
+		result = append(
+			result,
+			container{
+				Name:  appContainer.Name,
+				Image: appContainer.ImageRepoTag,
+				Ports: ports,
+			},
+		)
+	}
+	return result
+}
+
 // secretKeys decrypts role secret keys into name-to-value map
 func secretKeys(
 	roleSpec kdv1.Role,
@@ -418,7 +639,6 @@ func clusterBaseConfig(
 	cr *kdv1.KubeDirectorCluster,
 	appCR *kdv1.KubeDirectorApp,
 	membersForRole map[string][]*kdv1.MemberStatus,
-	domain string,
 ) (*configmeta, error) {
 
 	clustersMeta, conErr := genClusterConnections(cr)
@@ -435,7 +655,17 @@ func clusterBaseConfig(
 		return nil, secErr
 	}
 
-	nodegroups, err := nodegroups(cr, appCR, membersForRole, domain)
+	objectStores, storeErr := genObjectStoreConnections(cr)
+	if storeErr != nil {
+		return nil, storeErr
+	}
+
+	databases, dbErr := genDatabaseConnections(cr)
+	if dbErr != nil {
+		return nil, dbErr
+	}
+
+	nodegroups, err := nodegroups(cr, appCR, membersForRole)
 	if err != nil {
 		return nil, err
 	}
@@ -459,11 +689,14 @@ func clusterBaseConfig(
 					BdvlibRefKey: []string{"nodegroups", "1", "config_metadata"},
 				},
 			},
+			Labels: shared.PropagatedLabels(cr),
 		},
 		Connections: connections{
-			Clusters:   clustersMeta,
-			ConfigMaps: kdConfigMaps,
-			Secrets:    kdSecrets,
+			Clusters:     clustersMeta,
+			ConfigMaps:   kdConfigMaps,
+			Secrets:      kdSecrets,
+			ObjectStores: objectStores,
+			Databases:    databases,
 		},
 	}, nil
 }
@@ -488,13 +721,13 @@ func ConfigmetaGenerator(
 	// returned function, since we won't always actually need to call the
 	// function. However it's really handy to know up front if any errors
 	// would be generated.
-	domain := cr.Status.ClusterService + "." + cr.Namespace + shared.GetSvcClusterDomainBase()
 	perNodeConfig := make(map[string]*node)
-	c, err := clusterBaseConfig(cr, appCR, membersForRole, domain)
+	c, err := clusterBaseConfig(cr, appCR, membersForRole)
 	if err != nil {
 		return nil, err
 	}
 	for roleName, members := range membersForRole {
+		domain := shared.MemberDomain(cr, roleName)
 		for _, member := range members {
 			memberName := member.Pod
 
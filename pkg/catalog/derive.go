@@ -0,0 +1,191 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catalog
+
+import (
+	"encoding/json"
+	"fmt"
+
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	"github.com/bluek8s/kubedirector/pkg/observer"
+	"github.com/bluek8s/kubedirector/pkg/shared"
+)
+
+// derivedListKeys names, for each list property that a derived app merges
+// entry by entry with its base app, the property that identifies an entry.
+// Other lists in a derived app replace those of the base app.
+var derivedListKeys = map[string]string{
+	"roles":        "id",
+	"services":     "id",
+	"roleServices": "roleID",
+}
+
+// derivedRoleDefaults maps each app-level default to the role property that
+// it fills in. A stored app has its defaults already copied into its roles,
+// so a derived app that sets one of these defaults must first clear the
+// corresponding property from the inherited roles.
+var derivedRoleDefaults = map[string]string{
+	"defaultImageRepoTag":      "imageRepoTag",
+	"defaultSetupImageRepoTag": "setupImageRepoTag",
+	"defaultConfigPackage":     "configPackage",
+	"defaultPersistDirs":       "persistDirs",
+	"defaultPersistExcludes":   "persistExcludes",
+	"defaultEventList":         "eventList",
+	"defaultMaxLogSizeDump":    "maxLogSizeDump",
+}
+
+// FindBaseApp returns the app named by the derivedFrom property of an app in
+// the given namespace. It looks in that namespace first and then in the KD
+// namespace.
+func FindBaseApp(
+	namespace string,
+	baseName string,
+) (*kdv1.KubeDirectorApp, error) {
+
+	appCR, appErr := observer.GetApp(namespace, baseName)
+	if appErr == nil {
+		return appCR, nil
+	}
+	kdNamespace, nsErr := shared.GetKubeDirectorNamespace()
+	if nsErr != nil {
+		return nil, nsErr
+	}
+	appCR, appErr = observer.GetApp(kdNamespace, baseName)
+	if appErr != nil {
+		return nil, fmt.Errorf(
+			"failed to fetch CR for the base App : %s error %v",
+			baseName,
+			appErr,
+		)
+	}
+	return appCR, nil
+}
+
+// FlattenApp merges the spec of a derived app, given as raw JSON, over the
+// spec of its base app and returns the result. Objects are merged property
+// by property, and a null property in the derived spec removes the inherited
+// one. Roles and services are merged entry by entry, matched by ID, as are
+// the roleServices of the config; entries new to the derived app are added
+// after the inherited ones. All other values in the derived spec replace
+// the inherited ones. The derivedFrom property itself is kept.
+func FlattenApp(
+	baseCR *kdv1.KubeDirectorApp,
+	derivedSpec []byte,
+) (*kdv1.KubeDirectorAppSpec, error) {
+
+	baseJSON, baseErr := json.Marshal(baseCR.Spec)
+	if baseErr != nil {
+		return nil, baseErr
+	}
+	var base map[string]interface{}
+	if err := json.Unmarshal(baseJSON, &base); err != nil {
+		return nil, err
+	}
+	var derived map[string]interface{}
+	if err := json.Unmarshal(derivedSpec, &derived); err != nil {
+		return nil, err
+	}
+	if baseRoles, ok := base["roles"].([]interface{}); ok {
+		for defaultKey, roleKey := range derivedRoleDefaults {
+			if _, ok := derived[defaultKey]; !ok {
+				continue
+			}
+			for _, baseRole := range baseRoles {
+				if roleMap, ok := baseRole.(map[string]interface{}); ok {
+					delete(roleMap, roleKey)
+				}
+			}
+		}
+	}
+	merged := mergeDerived(base, derived, "")
+	mergedJSON, mergedErr := json.Marshal(merged)
+	if mergedErr != nil {
+		return nil, mergedErr
+	}
+	result := &kdv1.KubeDirectorAppSpec{}
+	if err := json.Unmarshal(mergedJSON, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// mergeDerived merges one value of a derived app spec over the inherited
+// value, as described for FlattenApp. The key is the name of the property
+// holding the value, which decides how lists are merged.
+func mergeDerived(
+	base interface{},
+	derived interface{},
+	key string,
+) interface{} {
+
+	switch derivedValue := derived.(type) {
+	case map[string]interface{}:
+		baseMap, ok := base.(map[string]interface{})
+		if !ok {
+			return derivedValue
+		}
+		for k, v := range derivedValue {
+			if v == nil {
+				delete(baseMap, k)
+			} else {
+				baseMap[k] = mergeDerived(baseMap[k], v, k)
+			}
+		}
+		return baseMap
+	case []interface{}:
+		idKey, merges := derivedListKeys[key]
+		baseList, ok := base.([]interface{})
+		if !merges || !ok || !listKeyed(baseList, idKey) || !listKeyed(derivedValue, idKey) {
+			return derivedValue
+		}
+		result := baseList
+		for _, entry := range derivedValue {
+			entryMap := entry.(map[string]interface{})
+			found := false
+			for i := range result {
+				resultMap := result[i].(map[string]interface{})
+				if resultMap[idKey] == entryMap[idKey] {
+					result[i] = mergeDerived(resultMap, entryMap, "")
+					found = true
+					break
+				}
+			}
+			if !found {
+				result = append(result, entryMap)
+			}
+		}
+		return result
+	}
+	return derived
+}
+
+// listKeyed reports whether every entry of the list is an object with a
+// string value for the given identifying property.
+func listKeyed(
+	list []interface{},
+	idKey string,
+) bool {
+
+	for _, entry := range list {
+		entryMap, ok := entry.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		if _, ok := entryMap[idKey].(string); !ok {
+			return false
+		}
+	}
+	return true
+}
@@ -158,6 +158,7 @@ func PortsForRole(
 							ID:        service.ID,
 							Port:      *(service.Endpoint.Port),
 							URLScheme: service.Endpoint.URLScheme,
+							Ingress:   service.Endpoint.Ingress,
 						}
 						result = append(result, servicePortInfo)
 					}
@@ -205,6 +206,38 @@ func ImageForRole(
 	)
 }
 
+// SetupImageForRole returns the image to be used for running the setup
+// package in pods of a given role, or an empty string if the setup package
+// runs in the app container.
+func SetupImageForRole(
+	cr *kdv1.KubeDirectorCluster,
+	role string,
+) (string, error) {
+
+	// Fetch the app type definition if we haven't yet cached it in this
+	// handler pass.
+	appCR, err := GetApp(cr)
+	if err != nil {
+		return "", err
+	}
+
+	for _, nodeRole := range appCR.Spec.NodeRoles {
+		if nodeRole.ID == role {
+			if nodeRole.SetupImage != nil {
+				return *(nodeRole.SetupImage), nil
+			}
+			return "", nil
+		}
+	}
+
+	// Should never reach here.
+	return "", fmt.Errorf(
+		"Role {%s} not found for app {%s} when searching for setup image",
+		role,
+		cr.Spec.AppID,
+	)
+}
+
 // AppSetupPackageInfo returns the app setup package info for a given role. The
 // fact that this function is invoked means that setup package was specified
 // either for the node role or the application as a whole.
@@ -243,6 +276,57 @@ func AppSetupPackageInfo(
 	)
 }
 
+// HookExecution fetches the HookExecution settings of the given role's setup
+// package, or nil if it has none.
+func HookExecution(
+	cr *kdv1.KubeDirectorCluster,
+	role string,
+) *kdv1.HookExecution {
+
+	setupInfo, _ := AppSetupPackageInfo(cr, role)
+	if setupInfo == nil {
+		return nil
+	}
+	return setupInfo.HookExecution
+}
+
+// HookPrefix returns the text to put in front of a startscript invocation
+// so that it runs with the umask, environment, and user requested by the
+// role's setup package. It is empty if the package does not ask for any of
+// those. Changing the user relies on the setpriv command being in the image.
+func HookPrefix(
+	cr *kdv1.KubeDirectorCluster,
+	role string,
+) string {
+
+	hook := HookExecution(cr, role)
+	if hook == nil {
+		return ""
+	}
+	prefix := ""
+	if hook.Umask != nil {
+		prefix += "umask " + *hook.Umask + " && "
+	}
+	if len(hook.Env) != 0 {
+		prefix += "env"
+		for _, envVar := range hook.Env {
+			prefix += " " + shared.ShellQuote(envVar.Name+"="+envVar.Value)
+		}
+		prefix += " "
+	}
+	if (hook.RunAsUser != nil) || (hook.RunAsGroup != nil) {
+		prefix += "setpriv"
+		if hook.RunAsUser != nil {
+			prefix += fmt.Sprintf(" --reuid=%d", *hook.RunAsUser)
+		}
+		if hook.RunAsGroup != nil {
+			prefix += fmt.Sprintf(" --regid=%d", *hook.RunAsGroup)
+		}
+		prefix += " --clear-groups "
+	}
+	return prefix
+}
+
 // SystemdRequired checks whether systemctl mounts are required for a given
 // app.
 func SystemdRequired(
@@ -259,6 +343,22 @@ func SystemdRequired(
 	return appCR.Spec.SystemdRequired, nil
 }
 
+// AppShellless checks whether the app images lack a shell, in which case
+// KubeDirector must not inject any shell commands into the app container.
+func AppShellless(
+	cr *kdv1.KubeDirectorCluster,
+) (bool, error) {
+
+	// Fetch the app type definition if we haven't yet cached it in this
+	// handler pass.
+	appCR, err := GetApp(cr)
+	if err != nil {
+		return false, err
+	}
+
+	return appCR.Spec.Shellless, nil
+}
+
 // AgentRequired checks whether agent installation is required for a given app.
 func AgentRequired(
 	cr *kdv1.KubeDirectorCluster,
@@ -314,6 +414,78 @@ func AppPersistDirs(
 	)
 }
 
+// AppLogging fetches the description of the logs of a given role's app
+// container, or nil if the app does not give one.
+func AppLogging(
+	cr *kdv1.KubeDirectorCluster,
+	role string,
+) (*kdv1.AppLogging, error) {
+
+	appCR, err := GetApp(cr)
+	if err != nil {
+		return nil, err
+	}
+	nodeRole := GetRoleFromID(appCR, role)
+	if nodeRole == nil {
+		return nil, fmt.Errorf(
+			"Role {%s} not found for app {%s} when searching for logging",
+			role,
+			cr.Spec.AppID,
+		)
+	}
+	return nodeRole.Logging, nil
+}
+
+// AppBlockDevicePrep fetches the preparation step for the block devices of
+// a given role, or nil if the app does not give one.
+func AppBlockDevicePrep(
+	cr *kdv1.KubeDirectorCluster,
+	role string,
+) (*kdv1.BlockDevicePrep, error) {
+
+	appCR, err := GetApp(cr)
+	if err != nil {
+		return nil, err
+	}
+	nodeRole := GetRoleFromID(appCR, role)
+	if nodeRole == nil {
+		return nil, fmt.Errorf(
+			"Role {%s} not found for app {%s} when searching for block device prep",
+			role,
+			cr.Spec.AppID,
+		)
+	}
+	return nodeRole.BlockDevicePrep, nil
+}
+
+// AppPersistExcludes fetches the patterns for files, under the persisted
+// directories of a given role, that should not be copied onto the PVC.
+func AppPersistExcludes(
+	cr *kdv1.KubeDirectorCluster,
+	role string,
+) (*[]string, error) {
+
+	appCR, err := GetApp(cr)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, nodeRole := range appCR.Spec.NodeRoles {
+		if nodeRole.ID == role {
+			// As with PersistDirs, the validation hook has already applied
+			// any app-level default here.
+			return nodeRole.PersistExcludes, nil
+		}
+	}
+
+	// Should never reach here.
+	return nil, fmt.Errorf(
+		"Role {%s} not found for app {%s} when searching for persist excludes",
+		role,
+		cr.Spec.AppID,
+	)
+}
+
 // RoleContainerSpecs fetches container spec properties
 // that needs to be overridden by KDApp author
 func RoleContainerSpecs(
@@ -337,6 +509,27 @@ func RoleContainerSpecs(
 	return nil, nil
 }
 
+// RequiredEnvForRole returns the environment variables that the app
+// requires the given role to be provided with.
+func RequiredEnvForRole(
+	cr *kdv1.KubeDirectorCluster,
+	role string,
+) ([]kdv1.RequiredEnvVar, error) {
+
+	appCR, err := GetApp(cr)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []kdv1.RequiredEnvVar
+	for _, requiredEnv := range appCR.Spec.RequiredEnv {
+		if (len(requiredEnv.Roles) == 0) || shared.StringInList(role, requiredEnv.Roles) {
+			result = append(result, requiredEnv)
+		}
+	}
+	return result, nil
+}
+
 // FindApp returns the app type definition for the given virtual cluster. If
 // the appCatalog property is set to "local", it looks in the same namespace
 // as the cluster. If set to "system", it looks in the same namespace as
@@ -389,3 +582,33 @@ func GetApp(
 	cr.AppSpec = appCR
 	return appCR, nil
 }
+
+// FindAppWithID looks up the app with the given ID in the catalog of the
+// cluster, as FindApp does for the cluster's own app.
+func FindAppWithID(
+	cr *kdv1.KubeDirectorCluster,
+	appID string,
+) (*kdv1.KubeDirectorApp, error) {
+
+	lookup := *cr
+	lookup.Spec.AppID = appID
+	return FindApp(&lookup)
+}
+
+// UpgradePath returns the upgrade path that the app declares from the given
+// previous version, or nil if it declares none.
+func UpgradePath(
+	appCR *kdv1.KubeDirectorApp,
+	fromVersion string,
+) *kdv1.AppUpgradePath {
+
+	if appCR.Spec.Upgrade == nil {
+		return nil
+	}
+	for i := range appCR.Spec.Upgrade.From {
+		if appCR.Spec.Upgrade.From[i].Version == fromVersion {
+			return &(appCR.Spec.Upgrade.From[i])
+		}
+	}
+	return nil
+}
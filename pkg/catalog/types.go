@@ -44,9 +44,31 @@ type nodegroup struct {
 }
 
 type connections struct {
-	Clusters   map[string]configmeta                     `json:"clusters"`
-	ConfigMaps map[string][]map[string]map[string]string `json:"configmaps"`
-	Secrets    map[string][]map[string]map[string][]byte `json:"secrets"`
+	Clusters     map[string]configmeta                     `json:"clusters"`
+	ConfigMaps   map[string][]map[string]map[string]string `json:"configmaps"`
+	Secrets      map[string][]map[string]map[string][]byte `json:"secrets"`
+	ObjectStores map[string]objectStore                    `json:"object_stores"`
+	Databases    map[string]database                       `json:"databases"`
+}
+
+type database struct {
+	Engine      string            `json:"engine"`
+	Host        string            `json:"host"`
+	Port        int32             `json:"port"`
+	Database    string            `json:"database,omitempty"`
+	TLS         bool              `json:"tls"`
+	CACert      string            `json:"ca_cert,omitempty"`
+	JDBCURL     string            `json:"jdbc_url"`
+	Credentials map[string]string `json:"credentials,omitempty"`
+}
+
+type objectStore struct {
+	Type        string            `json:"type"`
+	Bucket      string            `json:"bucket"`
+	Endpoint    string            `json:"endpoint,omitempty"`
+	Region      string            `json:"region,omitempty"`
+	URI         string            `json:"uri"`
+	Credentials map[string]string `json:"credentials,omitempty"`
 }
 
 type cluster struct {
@@ -54,6 +76,7 @@ type cluster struct {
 	Isolated   bool               `json:"isolated"`
 	ID         string             `json:"id"`
 	ConfigMeta map[string]refkeys `json:"config_metadata"`
+	Labels     map[string]string  `json:"labels,omitempty"`
 }
 
 type node struct {
@@ -76,6 +99,13 @@ type role struct {
 	FQDNMappings map[string]string  `json:"fqdn_mappings"`
 	Flavor       flavor             `json:"flavor"`
 	SecretKeys   map[string]string  `json:"secret_keys,omitempty"`
+	Containers   []container        `json:"containers,omitempty"`
+}
+
+type container struct {
+	Name  string           `json:"name"`
+	Image string           `json:"image"`
+	Ports map[string]int32 `json:"ports,omitempty"`
 }
 
 type service struct {
@@ -103,4 +133,5 @@ type ServicePortInfo struct {
 	ID        string
 	Port      int32
 	URLScheme string
+	Ingress   bool
 }
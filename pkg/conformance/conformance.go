@@ -0,0 +1,485 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package conformance
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	"github.com/bluek8s/kubedirector/pkg/e2e"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Verify runs the conformance steps for the app described by opts, using
+// an already-running KubeDirector reachable through the given framework.
+// An error is returned only if the run could not be set up; failures of
+// individual steps are recorded in the returned report.
+func Verify(
+	f *e2e.Framework,
+	opts Options,
+) (*Report, error) {
+
+	if opts.Timeout == 0 {
+		opts.Timeout = DefaultStepTimeout
+	}
+	namespace, nsErr := f.CreateNamespace(namespacePrefix)
+	if nsErr != nil {
+		return nil, nsErr
+	}
+	app, appErr := f.CreateApp(namespace, opts.AppPath)
+	if appErr != nil {
+		return nil, appErr
+	}
+	var cr *kdv1.KubeDirectorCluster
+	if opts.ClusterPath != "" {
+		var crErr error
+		cr, crErr = f.CreateCluster(namespace, opts.ClusterPath, app.Name)
+		if crErr != nil {
+			return nil, crErr
+		}
+	} else {
+		cr = generateCluster(app, namespace)
+		if crErr := f.Client.Create(context.TODO(), cr); crErr != nil {
+			return nil, crErr
+		}
+	}
+
+	v := &verifier{
+		f:       f,
+		opts:    opts,
+		app:     app,
+		cr:      cr,
+		members: make(map[string]int),
+		report: &Report{
+			App:       app.Name,
+			Version:   app.Spec.Version,
+			Namespace: namespace,
+			Cluster:   cr.Name,
+		},
+	}
+	for _, role := range cr.Spec.Roles {
+		if role.Members != nil {
+			v.members[role.Name] = int(*role.Members)
+		}
+	}
+
+	created := v.run(StepCreate, v.create)
+	expanded := false
+	if created {
+		expanded = v.run(StepExpand, v.expand)
+	} else {
+		v.skip(StepExpand, "cluster was not created")
+	}
+	if expanded {
+		v.run(StepShrink, v.shrink)
+	} else {
+		v.skip(StepShrink, "cluster was not expanded")
+	}
+	if created {
+		v.run(StepReconfigure, v.reconfigure)
+		v.run(StepRestore, v.restore)
+	} else {
+		v.skip(StepReconfigure, "cluster was not created")
+		v.skip(StepRestore, "cluster was not created")
+	}
+	v.run(StepDelete, v.delete)
+
+	if opts.KeepNamespace {
+		f.ForgetNamespace(namespace)
+	}
+	return v.report, nil
+}
+
+// Passed returns true if no step failed.
+func (r *Report) Passed() bool {
+
+	for _, step := range r.Steps {
+		if step.Result == ResultFailed {
+			return false
+		}
+	}
+	return true
+}
+
+// verifier holds the state of a single conformance run.
+type verifier struct {
+	f       *e2e.Framework
+	opts    Options
+	app     *kdv1.KubeDirectorApp
+	cr      *kdv1.KubeDirectorCluster
+	members map[string]int
+	report  *Report
+
+	// expandedRole is the role grown by the expand step, if any.
+	expandedRole string
+}
+
+// stepFunc implements a step. It returns a non-empty skip reason if the
+// step does not apply to this app.
+type stepFunc func() (skipReason string, err error)
+
+// run executes a step and records its outcome, returning true if it passed.
+func (v *verifier) run(
+	name string,
+	step stepFunc,
+) bool {
+
+	start := time.Now()
+	skipReason, stepErr := step()
+	stepReport := StepReport{
+		Name:     name,
+		Result:   ResultPassed,
+		Duration: time.Since(start).Round(time.Second).String(),
+	}
+	if stepErr != nil {
+		stepReport.Result = ResultFailed
+		stepReport.Message = stepErr.Error()
+	} else if skipReason != "" {
+		stepReport.Result = ResultSkipped
+		stepReport.Message = skipReason
+	}
+	v.report.Steps = append(v.report.Steps, stepReport)
+	return stepReport.Result == ResultPassed
+}
+
+// skip records a step that was not attempted.
+func (v *verifier) skip(
+	name string,
+	reason string,
+) {
+
+	v.report.Steps = append(
+		v.report.Steps,
+		StepReport{
+			Name:     name,
+			Result:   ResultSkipped,
+			Message:  reason,
+			Duration: "0s",
+		},
+	)
+}
+
+// create waits for the initial cluster to be fully configured.
+func (v *verifier) create() (string, error) {
+
+	return "", v.waitConfigured()
+}
+
+// expand adds a member to the first role that has a scale-out cardinality.
+func (v *verifier) expand() (string, error) {
+
+	for _, role := range v.cr.Spec.Roles {
+		if !isScaleOut(v.app, role.Name) {
+			continue
+		}
+		v.expandedRole = role.Name
+		return "", v.setMembers(role.Name, v.members[role.Name]+1)
+	}
+	return "app has no scale-out roles in this cluster", nil
+}
+
+// shrink returns the expanded role to its original size.
+func (v *verifier) shrink() (string, error) {
+
+	return "", v.setMembers(v.expandedRole, v.members[v.expandedRole]-1)
+}
+
+// reconfigure connects a new configmap to the cluster, which causes the
+// members to be notified, and waits for the cluster to settle again.
+func (v *verifier) reconfigure() (string, error) {
+
+	before, getErr := v.f.GetCluster(v.cr.Namespace, v.cr.Name)
+	if getErr != nil {
+		return "", getErr
+	}
+	oldHash := before.Status.LastConnectionHash
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: v.cr.Namespace,
+			Name:      v.cr.Name + connectionConfigMapSuffix,
+		},
+		Data: map[string]string{"verify": "true"},
+	}
+	if createErr := v.f.Client.Create(context.TODO(), cm); createErr != nil {
+		return "", createErr
+	}
+	updateErr := v.f.UpdateCluster(
+		v.cr.Namespace,
+		v.cr.Name,
+		v.opts.Timeout,
+		func(cr *kdv1.KubeDirectorCluster) {
+			cr.Spec.Connections.ConfigMaps = append(
+				cr.Spec.Connections.ConfigMaps,
+				cm.Name,
+			)
+		},
+	)
+	if updateErr != nil {
+		return "", updateErr
+	}
+	connectionsChanged := func(cr *kdv1.KubeDirectorCluster) bool {
+		return (cr.Status != nil) && (cr.Status.LastConnectionHash != oldHash)
+	}
+	return "", v.waitConfigured(connectionsChanged)
+}
+
+// restore simulates a backup-and-restore of the cluster: the cluster
+// resource is deleted while orphaning its dependents, then re-created as a
+// backup tool would. KubeDirector should recognize the restore, wait for the
+// status backup and component resources, and resume reconciliation.
+func (v *verifier) restore() (string, error) {
+
+	backup, getErr := v.f.GetCluster(v.cr.Namespace, v.cr.Name)
+	if getErr != nil {
+		return "", getErr
+	}
+	if backup.Annotations[e2e.StatusBackupAnnotation] != "true" {
+		return "status backups are not enabled (backupClusterStatus in KubeDirectorConfig)", nil
+	}
+	deleteErr := v.f.Client.Delete(
+		context.TODO(),
+		backup.DeepCopy(),
+		client.PropagationPolicy(metav1.DeletePropagationOrphan),
+	)
+	if deleteErr != nil {
+		return "", deleteErr
+	}
+	gone := func() (bool, error) {
+		_, err := v.f.GetCluster(v.cr.Namespace, v.cr.Name)
+		return errors.IsNotFound(err), nil
+	}
+	if waitErr := e2e.Poll(v.opts.Timeout, gone); waitErr != nil {
+		return "", fmt.Errorf("cluster was not deleted: %v", waitErr)
+	}
+
+	restored := &kdv1.KubeDirectorCluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   backup.Namespace,
+			Name:        backup.Name,
+			Labels:      backup.Labels,
+			Annotations: backup.Annotations,
+		},
+		Spec: backup.Spec,
+	}
+	if createErr := v.f.Client.Create(context.TODO(), restored); createErr != nil {
+		return "", createErr
+	}
+	notRestoring := func(cr *kdv1.KubeDirectorCluster) bool {
+		_, restoring := cr.Labels[e2e.RestoringLabel]
+		return !restoring
+	}
+	return "", v.waitConfigured(notRestoring)
+}
+
+// delete deletes the cluster and waits for it to be gone.
+func (v *verifier) delete() (string, error) {
+
+	return "", v.f.DeleteCluster(v.cr.Namespace, v.cr.Name, v.opts.Timeout)
+}
+
+// setMembers changes the member count of a role and waits for the cluster
+// to be fully configured at the new size.
+func (v *verifier) setMembers(
+	roleName string,
+	count int,
+) error {
+
+	members := int32(count)
+	updateErr := v.f.UpdateCluster(
+		v.cr.Namespace,
+		v.cr.Name,
+		v.opts.Timeout,
+		func(cr *kdv1.KubeDirectorCluster) {
+			for i := range cr.Spec.Roles {
+				if cr.Spec.Roles[i].Name == roleName {
+					cr.Spec.Roles[i].Members = &members
+				}
+			}
+		},
+	)
+	if updateErr != nil {
+		return updateErr
+	}
+	waitErr := v.waitConfigured(
+		e2e.RoleMembersInState(roleName, e2e.MemberStateConfigured, count),
+	)
+	if waitErr == nil {
+		v.members[roleName] = count
+	}
+	return waitErr
+}
+
+// waitConfigured waits for the cluster and all its members to be
+// configured, along with any extra conditions. On timeout the returned
+// error summarizes the last observed state.
+func (v *verifier) waitConfigured(
+	extra ...e2e.ClusterCondition,
+) error {
+
+	conditions := append(
+		[]e2e.ClusterCondition{
+			e2e.ClusterStateIs(e2e.ClusterStateConfigured),
+			e2e.AllMembersInState(e2e.MemberStateConfigured),
+			specProcessed,
+		},
+		extra...,
+	)
+	cr, waitErr := v.f.WaitForCluster(
+		v.cr.Namespace,
+		v.cr.Name,
+		v.opts.Timeout,
+		conditions...,
+	)
+	if waitErr != nil {
+		return fmt.Errorf("%v; %s", waitErr, describe(cr))
+	}
+	return nil
+}
+
+// specProcessed is satisfied when KubeDirector has handled the latest spec
+// change.
+func specProcessed(
+	cr *kdv1.KubeDirectorCluster,
+) bool {
+
+	return (cr.Status != nil) && (cr.Status.SpecGenerationToProcess == nil)
+}
+
+// describe summarizes the state of a cluster for failure messages.
+func describe(
+	cr *kdv1.KubeDirectorCluster,
+) string {
+
+	if (cr == nil) || (cr.Status == nil) {
+		return "cluster has no status"
+	}
+	var roles []string
+	for _, roleStatus := range cr.Status.Roles {
+		states := make(map[string]int)
+		for _, member := range roleStatus.Members {
+			states[member.State]++
+		}
+		var counts []string
+		for state, count := range states {
+			counts = append(counts, fmt.Sprintf("%d %s", count, state))
+		}
+		sort.Strings(counts)
+		roles = append(
+			roles,
+			fmt.Sprintf("%s: [%s]", roleStatus.Name, strings.Join(counts, ", ")),
+		)
+	}
+	return fmt.Sprintf(
+		"cluster state %q, members %s",
+		cr.Status.State,
+		strings.Join(roles, "; "),
+	)
+}
+
+// generateCluster builds a minimal cluster for the app, with every selected
+// role at its minimum cardinality.
+func generateCluster(
+	app *kdv1.KubeDirectorApp,
+	namespace string,
+) *kdv1.KubeDirectorCluster {
+
+	cr := &kdv1.KubeDirectorCluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace,
+			Name:      app.Name + "-verify",
+		},
+		Spec: kdv1.KubeDirectorClusterSpec{
+			AppID: app.Name,
+		},
+	}
+	for _, roleID := range app.Spec.Config.SelectedRoles {
+		appRole := findAppRole(app, roleID)
+		if appRole == nil {
+			continue
+		}
+		count, _ := parseCardinality(appRole.Cardinality)
+		members := int32(count)
+		resources := corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse(defaultMemberCPU),
+			corev1.ResourceMemory: resource.MustParse(defaultMemberMemory),
+		}
+		if appRole.MinResources != nil {
+			for name, quantity := range *appRole.MinResources {
+				resources[name] = quantity
+			}
+		}
+		role := kdv1.Role{
+			Name:    roleID,
+			Members: &members,
+			Resources: corev1.ResourceRequirements{
+				Requests: resources,
+				Limits:   resources,
+			},
+		}
+		if (appRole.MinStorage != nil) && !appRole.MinStorage.EphemeralModeSupported {
+			role.Storage = &kdv1.ClusterStorage{Size: appRole.MinStorage.Size}
+		}
+		cr.Spec.Roles = append(cr.Spec.Roles, role)
+	}
+	return cr
+}
+
+// findAppRole returns the app role with the given ID, or nil.
+func findAppRole(
+	app *kdv1.KubeDirectorApp,
+	roleID string,
+) *kdv1.NodeRole {
+
+	for i := range app.Spec.NodeRoles {
+		if app.Spec.NodeRoles[i].ID == roleID {
+			return &app.Spec.NodeRoles[i]
+		}
+	}
+	return nil
+}
+
+// isScaleOut returns true if the given app role accepts more members than
+// its minimum.
+func isScaleOut(
+	app *kdv1.KubeDirectorApp,
+	roleID string,
+) bool {
+
+	appRole := findAppRole(app, roleID)
+	if appRole == nil {
+		return false
+	}
+	_, scaleOut := parseCardinality(appRole.Cardinality)
+	return scaleOut
+}
+
+// parseCardinality returns the member count from an app role cardinality
+// value, and whether the count is a minimum ("N+") rather than exact.
+func parseCardinality(
+	cardinality string,
+) (int, bool) {
+
+	scaleOut := strings.HasSuffix(cardinality, "+")
+	count, _ := strconv.Atoi(strings.TrimSuffix(cardinality, "+"))
+	return count, scaleOut
+}
@@ -0,0 +1,20 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// Package conformance checks whether a KubeDirectorApp behaves correctly
+// under KubeDirector. It deploys the app into a scratch namespace and drives
+// a virtual cluster through the create, expand, shrink, reconfigure, restore,
+// and delete flows, recording the outcome of each step in a Report.
+//
+// The checks are built on the e2e package and are run by "kd app verify".
+package conformance
@@ -0,0 +1,62 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package conformance
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+)
+
+// WriteText writes a human-readable form of the report.
+func (r *Report) WriteText(
+	w io.Writer,
+) error {
+
+	fmt.Fprintf(w, "App:       %s (version %s)\n", r.App, r.Version)
+	fmt.Fprintf(w, "Namespace: %s\n", r.Namespace)
+	fmt.Fprintf(w, "Cluster:   %s\n\n", r.Cluster)
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "STEP\tRESULT\tDURATION\tMESSAGE")
+	for _, step := range r.Steps {
+		fmt.Fprintf(
+			tw,
+			"%s\t%s\t%s\t%s\n",
+			step.Name,
+			step.Result,
+			step.Duration,
+			step.Message,
+		)
+	}
+	if flushErr := tw.Flush(); flushErr != nil {
+		return flushErr
+	}
+	verdict := "CONFORMANT"
+	if !r.Passed() {
+		verdict = "NOT CONFORMANT"
+	}
+	_, writeErr := fmt.Fprintf(w, "\nResult: %s\n", verdict)
+	return writeErr
+}
+
+// WriteJSON writes the report as indented JSON.
+func (r *Report) WriteJSON(
+	w io.Writer,
+) error {
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
@@ -0,0 +1,83 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package conformance
+
+import (
+	"time"
+)
+
+// Names of the steps in a conformance run, in the order they are run.
+const (
+	StepCreate      = "create"
+	StepExpand      = "expand"
+	StepShrink      = "shrink"
+	StepReconfigure = "reconfigure"
+	StepRestore     = "restore"
+	StepDelete      = "delete"
+)
+
+// Possible results for a step.
+const (
+	ResultPassed  = "passed"
+	ResultFailed  = "failed"
+	ResultSkipped = "skipped"
+)
+
+const (
+	// DefaultStepTimeout is used if Options does not specify a timeout.
+	DefaultStepTimeout = 15 * time.Minute
+
+	// defaultMemberCPU and defaultMemberMemory are the resources given to
+	// members of a generated cluster, for roles that do not declare
+	// minResources.
+	defaultMemberCPU    = "1"
+	defaultMemberMemory = "2Gi"
+
+	// namespacePrefix is the prefix for scratch namespace names.
+	namespacePrefix = "kd-verify"
+
+	// connectionConfigMapSuffix is appended to the cluster name to form the
+	// name of the configmap connected during the reconfigure step.
+	connectionConfigMapSuffix = "-verify-connection"
+)
+
+// Options controls a conformance run. AppPath names the KubeDirectorApp
+// manifest to verify. ClusterPath optionally names a KubeDirectorCluster
+// manifest to use; if it is empty a cluster is generated using the minimum
+// member count and resources for each selected role. Timeout bounds each
+// individual step. If KeepNamespace is true the scratch namespace is not
+// deleted at the end of the run, for debugging.
+type Options struct {
+	AppPath       string
+	ClusterPath   string
+	Timeout       time.Duration
+	KeepNamespace bool
+}
+
+// StepReport is the outcome of one step.
+type StepReport struct {
+	Name     string `json:"name"`
+	Result   string `json:"result"`
+	Message  string `json:"message,omitempty"`
+	Duration string `json:"duration"`
+}
+
+// Report is the outcome of a conformance run.
+type Report struct {
+	App       string       `json:"app"`
+	Version   string       `json:"version"`
+	Namespace string       `json:"namespace"`
+	Cluster   string       `json:"cluster"`
+	Steps     []StepReport `json:"steps"`
+}
@@ -0,0 +1,629 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubedirectorbackup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	"github.com/bluek8s/kubedirector/pkg/catalog"
+	"github.com/bluek8s/kubedirector/pkg/executor"
+	"github.com/bluek8s/kubedirector/pkg/observer"
+	"github.com/bluek8s/kubedirector/pkg/shared"
+	"k8s.io/apimachinery/pkg/api/equality"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// syncBackup moves the backup along through its states: freezing the
+// members, snapshotting their volumes, thawing the members, and waiting for
+// the snapshots to be ready. It returns how long to wait before the backup
+// should be looked at again, or zero if the backup is finished. While the
+// backup is in progress it holds our finalizer, so that deleting it cannot
+// leave members frozen.
+func syncBackup(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorBackup,
+) (time.Duration, error) {
+
+	if cr.Status == nil {
+		cr.Status = &kdv1.KubeDirectorBackupStatus{}
+	}
+	oldStatus := cr.Status.DeepCopy()
+	hadFinalizer := shared.HasFinalizer(cr)
+	defer func() {
+		if shared.HasFinalizer(cr) != hadFinalizer {
+			status := cr.Status
+			updateErr := shared.Update(context.TODO(), cr)
+			cr.Status = status
+			if updateErr != nil {
+				shared.LogError(
+					reqLogger,
+					updateErr,
+					cr,
+					shared.EventReasonNoEvent,
+					"failed to update finalizers",
+				)
+				return
+			}
+		}
+		if ((cr.DeletionTimestamp != nil) && !shared.HasFinalizer(cr)) ||
+			equality.Semantic.DeepEqual(oldStatus, cr.Status) {
+			return
+		}
+		updateErr := shared.StatusUpdate(context.TODO(), cr)
+		if updateErr != nil {
+			shared.LogError(
+				reqLogger,
+				updateErr,
+				cr,
+				shared.EventReasonNoEvent,
+				"failed to update status",
+			)
+		}
+	}()
+
+	if cr.DeletionTimestamp != nil {
+		if hadFinalizer && !thawForDelete(reqLogger, cr) {
+			return activePollPeriod, nil
+		}
+		shared.RemoveFinalizer(cr)
+		return 0, nil
+	}
+
+	switch cr.Status.State {
+	case "", kdv1.BackupPending:
+		if waitErr := startBackup(reqLogger, cr); waitErr != nil {
+			cr.Status.State = kdv1.BackupPending
+			cr.Status.Message = waitErr.Error()
+			return pendingPollPeriod, nil
+		}
+	case kdv1.BackupFreezing:
+		checkFreeze(reqLogger, cr)
+	case kdv1.BackupSnapshotting:
+		checkSnapshotsTaken(reqLogger, cr)
+	case kdv1.BackupThawing:
+		checkThaw(reqLogger, cr)
+	case kdv1.BackupFinalizing:
+		checkSnapshotsReady(reqLogger, cr)
+	}
+
+	if (cr.Status.State == kdv1.BackupSucceeded) || (cr.Status.State == kdv1.BackupFailed) {
+		shared.RemoveFinalizer(cr)
+		return 0, nil
+	}
+	return activePollPeriod, nil
+}
+
+// startBackup records the cluster's spec and members, and starts the freeze
+// hook on the members whose roles handle it. An error is returned if the
+// cluster is not (yet) in a state to be backed up; a backup that cannot be
+// done at all is marked as failed.
+func startBackup(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorBackup,
+) error {
+
+	cluster, clusterErr := observer.GetCluster(cr.Namespace, cr.Spec.Cluster)
+	if clusterErr != nil {
+		if k8serrors.IsNotFound(clusterErr) {
+			failBackup(reqLogger, cr, fmt.Sprintf("cluster %s not found", cr.Spec.Cluster))
+			return nil
+		}
+		return clusterErr
+	}
+	if (cluster.Status == nil) || (cluster.Status.State != clusterReady) {
+		return fmt.Errorf("waiting for cluster %s to be configured", cluster.Name)
+	}
+	if loadErr := shared.LoadMemberStatusDetail(cluster); loadErr != nil {
+		return loadErr
+	}
+	appCr, appErr := catalog.GetApp(cluster)
+	if appErr != nil {
+		return appErr
+	}
+	shellless, shelllessErr := catalog.AppShellless(cluster)
+	if shelllessErr != nil {
+		return shelllessErr
+	}
+
+	var members []kdv1.BackupMember
+	numVolumes := 0
+	for _, roleStatus := range cluster.Status.Roles {
+		var roleSpec *kdv1.Role
+		for i := range cluster.Spec.Roles {
+			if cluster.Spec.Roles[i].Name == roleStatus.Name {
+				roleSpec = &(cluster.Spec.Roles[i])
+				break
+			}
+		}
+		appRole := catalog.GetRoleFromID(appCr, roleStatus.Name)
+		canFreeze := !shellless && (appRole != nil) && (appRole.EventList != nil) &&
+			shared.StringInList(freezeEvent, *appRole.EventList)
+		for _, member := range roleStatus.Members {
+			if member.Pod == "" {
+				continue
+			}
+			backupMember := kdv1.BackupMember{
+				Pod:         member.Pod,
+				Role:        roleStatus.Name,
+				ContainerID: member.StateDetail.LastConfiguredContainer,
+			}
+			var pvcNames []string
+			if member.PVC != "" {
+				pvcNames = append(pvcNames, member.PVC)
+			}
+			if roleSpec != nil {
+				pvcNames = append(pvcNames, executor.MemberBlockPVCNames(roleSpec, member.Pod)...)
+			}
+			for _, pvcName := range pvcNames {
+				backupMember.Volumes = append(
+					backupMember.Volumes,
+					kdv1.BackupVolume{
+						PVC:            pvcName,
+						Template:       strings.TrimSuffix(pvcName, "-"+member.Pod),
+						VolumeSnapshot: executor.BackupSnapshotName(cr, pvcName),
+					},
+				)
+			}
+			numVolumes += len(backupMember.Volumes)
+			if canFreeze {
+				backupMember.FreezeState = hookRunning
+			}
+			members = append(members, backupMember)
+		}
+	}
+	if numVolumes == 0 {
+		failBackup(reqLogger, cr, fmt.Sprintf("cluster %s has no persistent volumes", cluster.Name))
+		return nil
+	}
+
+	now := metav1.Now()
+	cr.Status.State = kdv1.BackupFreezing
+	cr.Status.Message = ""
+	cr.Status.StartTime = &now
+	cr.Status.ClusterSpec = cluster.Spec.DeepCopy()
+	cr.Status.Members = members
+	shared.EnsureFinalizer(cr)
+	shared.LogInfof(
+		reqLogger,
+		cr,
+		shared.EventReasonBackup,
+		"started backup of cluster{%s}",
+		cluster.Name,
+	)
+	for i := range cr.Status.Members {
+		member := &(cr.Status.Members[i])
+		if member.FreezeState != hookRunning {
+			continue
+		}
+		startErr := startHook(reqLogger, cr, cluster, member, freezeEvent)
+		if startErr != nil {
+			member.FreezeState = hookFailed
+			member.Message = startErr.Error()
+		}
+	}
+	return nil
+}
+
+// checkFreeze checks on the freeze hook of each member. Once the hook has
+// finished everywhere, the volume snapshots are requested; if it failed or
+// timed out anywhere, the members are thawed and the backup fails.
+func checkFreeze(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorBackup,
+) {
+
+	timeout := freezeTimeout(cr)
+	allDone := true
+	var failedPods []string
+	for i := range cr.Status.Members {
+		member := &(cr.Status.Members[i])
+		if member.FreezeState == hookRunning {
+			member.FreezeState, member.Message = checkHook(reqLogger, cr, member, freezeEvent)
+			if member.FreezeState == hookRunning {
+				if time.Since(cr.Status.StartTime.Time) < timeout {
+					allDone = false
+					continue
+				}
+				member.FreezeState = hookTimedOut
+				member.Message = fmt.Sprintf("did not finish within %v", timeout)
+			}
+		}
+		if (member.FreezeState == hookFailed) || (member.FreezeState == hookTimedOut) {
+			failedPods = append(failedPods, member.Pod)
+		}
+	}
+	if !allDone {
+		return
+	}
+	if len(failedPods) != 0 {
+		beginThaw(reqLogger, cr, "freeze failed on members "+strings.Join(failedPods, ", "))
+		return
+	}
+	for _, member := range cr.Status.Members {
+		for _, volume := range member.Volumes {
+			createErr := shared.Create(context.TODO(), executor.VolumeSnapshot(cr, volume.PVC))
+			if (createErr != nil) && !k8serrors.IsAlreadyExists(createErr) {
+				beginThaw(
+					reqLogger,
+					cr,
+					fmt.Sprintf("failed to create snapshot of PVC %s: %v", volume.PVC, createErr),
+				)
+				return
+			}
+		}
+	}
+	cr.Status.State = kdv1.BackupSnapshotting
+}
+
+// checkSnapshotsTaken thaws the members once every volume snapshot has been
+// taken, i.e. the point in time it captures is fixed even if it is not yet
+// ready to use. The backup fails if any snapshot fails or they are not all
+// taken before the freeze timeout.
+func checkSnapshotsTaken(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorBackup,
+) {
+
+	allTaken := true
+	for _, member := range cr.Status.Members {
+		for _, volume := range member.Volumes {
+			snapshot, snapshotErr := getSnapshot(cr, volume.VolumeSnapshot)
+			if snapshotErr != nil {
+				beginThaw(reqLogger, cr, snapshotErr.Error())
+				return
+			}
+			if snapshot == nil {
+				allTaken = false
+				continue
+			}
+			_, taken, _ := unstructured.NestedString(snapshot.Object, "status", "creationTime")
+			if !taken {
+				allTaken = false
+			}
+		}
+	}
+	if allTaken {
+		beginThaw(reqLogger, cr, "")
+		return
+	}
+	timeout := freezeTimeout(cr)
+	if time.Since(cr.Status.StartTime.Time) >= timeout {
+		beginThaw(reqLogger, cr, fmt.Sprintf("snapshots were not taken within %v", timeout))
+	}
+}
+
+// beginThaw starts the thaw hook on the members and moves the backup into
+// thawing state. A non-empty failure message marks the backup as failed
+// once the members are thawed.
+func beginThaw(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorBackup,
+	failure string,
+) {
+
+	now := metav1.Now()
+	cr.Status.State = kdv1.BackupThawing
+	cr.Status.Message = failure
+	cr.Status.ThawTime = &now
+	startThaw(reqLogger, cr)
+}
+
+// startThaw starts the thaw hook on each member where the freeze hook was
+// started, unless the thaw hook has already been started there.
+func startThaw(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorBackup,
+) {
+
+	cluster, clusterErr := observer.GetCluster(cr.Namespace, cr.Spec.Cluster)
+	for i := range cr.Status.Members {
+		member := &(cr.Status.Members[i])
+		if (member.FreezeState == "") || (member.ThawState != "") {
+			continue
+		}
+		member.ThawState = hookRunning
+		startErr := clusterErr
+		if startErr == nil {
+			startErr = startHook(reqLogger, cr, cluster, member, thawEvent)
+		}
+		if startErr != nil {
+			member.ThawState = hookFailed
+			member.Message = startErr.Error()
+		}
+	}
+}
+
+// checkThaw checks on the thaw hook of each member. Once the hook has
+// finished everywhere, the backup either fails (if it had already run into
+// a problem) or goes on to wait for its snapshots to be ready. A member
+// where the thaw failed is reported, since the app may still be frozen
+// there, but does not make the backup fail.
+func checkThaw(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorBackup,
+) {
+
+	if !pollThaw(reqLogger, cr) {
+		return
+	}
+	if cr.Status.Message != "" {
+		failBackup(reqLogger, cr, cr.Status.Message)
+		return
+	}
+	cr.Status.State = kdv1.BackupFinalizing
+}
+
+// thawForDelete makes sure that deleting a backup in progress does not leave
+// members frozen. It starts the thaw hook wherever the freeze hook was
+// started, and reports whether the thaw has finished everywhere, i.e.
+// whether the backup's finalizer can be removed.
+func thawForDelete(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorBackup,
+) bool {
+
+	if cr.Status.ThawTime == nil {
+		now := metav1.Now()
+		cr.Status.ThawTime = &now
+	}
+	startThaw(reqLogger, cr)
+	return pollThaw(reqLogger, cr)
+}
+
+// pollThaw checks on the thaw hook of each member where it is running, and
+// reports whether it has finished (or timed out) everywhere.
+func pollThaw(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorBackup,
+) bool {
+
+	allDone := true
+	for i := range cr.Status.Members {
+		member := &(cr.Status.Members[i])
+		if member.ThawState != hookRunning {
+			continue
+		}
+		member.ThawState, member.Message = checkHook(reqLogger, cr, member, thawEvent)
+		if member.ThawState == hookRunning {
+			if time.Since(cr.Status.ThawTime.Time) < thawTimeout {
+				allDone = false
+				continue
+			}
+			member.ThawState = hookTimedOut
+			member.Message = fmt.Sprintf("did not finish within %v", thawTimeout)
+		}
+		if member.ThawState != hookSucceeded {
+			shared.LogErrorf(
+				reqLogger,
+				errors.New(member.Message),
+				cr,
+				shared.EventReasonBackup,
+				"thaw failed on member{%s}; the app may still be frozen there",
+				member.Pod,
+			)
+		}
+	}
+	return allDone
+}
+
+// checkSnapshotsReady records the restore size of each volume snapshot that
+// is ready to use, and completes the backup once they all are.
+func checkSnapshotsReady(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorBackup,
+) {
+
+	allReady := true
+	for i := range cr.Status.Members {
+		member := &(cr.Status.Members[i])
+		for j := range member.Volumes {
+			volume := &(member.Volumes[j])
+			if volume.ReadyToUse {
+				continue
+			}
+			snapshot, snapshotErr := getSnapshot(cr, volume.VolumeSnapshot)
+			if snapshotErr != nil {
+				failBackup(reqLogger, cr, snapshotErr.Error())
+				return
+			}
+			if snapshot == nil {
+				allReady = false
+				continue
+			}
+			ready, _, _ := unstructured.NestedBool(snapshot.Object, "status", "readyToUse")
+			if !ready {
+				allReady = false
+				continue
+			}
+			volume.ReadyToUse = true
+			volume.RestoreSize, _, _ = unstructured.NestedString(snapshot.Object, "status", "restoreSize")
+		}
+	}
+	if !allReady {
+		return
+	}
+	now := metav1.Now()
+	cr.Status.State = kdv1.BackupSucceeded
+	cr.Status.CompletionTime = &now
+	shared.LogInfof(
+		reqLogger,
+		cr,
+		shared.EventReasonBackup,
+		"backup of cluster{%s} succeeded",
+		cr.Spec.Cluster,
+	)
+}
+
+// failBackup marks the backup as failed for the given reason.
+func failBackup(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorBackup,
+	reason string,
+) {
+
+	now := metav1.Now()
+	cr.Status.State = kdv1.BackupFailed
+	cr.Status.Message = reason
+	cr.Status.CompletionTime = &now
+	shared.LogErrorf(
+		reqLogger,
+		errors.New(reason),
+		cr,
+		shared.EventReasonBackup,
+		"backup of cluster{%s} failed: %s",
+		cr.Spec.Cluster,
+		reason,
+	)
+}
+
+// freezeTimeout returns how long the members of the backup's cluster may
+// stay frozen.
+func freezeTimeout(
+	cr *kdv1.KubeDirectorBackup,
+) time.Duration {
+
+	if cr.Spec.FreezeTimeoutSeconds != nil {
+		return time.Duration(*cr.Spec.FreezeTimeoutSeconds) * time.Second
+	}
+	return defaultFreezeTimeout
+}
+
+// getSnapshot fetches one of the backup's volume snapshots. An error is
+// returned if the snapshot is gone or has failed; a nil snapshot (and no
+// error) means that it could not be read this time.
+func getSnapshot(
+	cr *kdv1.KubeDirectorBackup,
+	snapshotName string,
+) (*unstructured.Unstructured, error) {
+
+	snapshot, getErr := observer.GetVolumeSnapshot(cr.Namespace, snapshotName)
+	if getErr != nil {
+		if k8serrors.IsNotFound(getErr) {
+			return nil, fmt.Errorf("snapshot %s was deleted", snapshotName)
+		}
+		return nil, nil
+	}
+	message, failed, _ := unstructured.NestedString(snapshot.Object, "status", "error", "message")
+	if failed {
+		return nil, fmt.Errorf("snapshot %s failed: %s", snapshotName, message)
+	}
+	return snapshot, nil
+}
+
+// hookDir returns the directory in the app container that holds the status
+// and output files of the backup's hooks on that member.
+func hookDir(
+	cr *kdv1.KubeDirectorBackup,
+) string {
+
+	return path.Join(hookDirBase, cr.Name)
+}
+
+// startHook starts the given event of the setup package startscript in the
+// app container of one member. Like the other setup package hooks, it runs
+// asynchronously and its exit status is picked up from a status file on
+// later passes.
+func startHook(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorBackup,
+	cluster *kdv1.KubeDirectorCluster,
+	member *kdv1.BackupMember,
+	event string,
+) error {
+
+	shared.LogInfof(
+		reqLogger,
+		cr,
+		shared.EventReasonBackup,
+		"running %s on member{%s}",
+		event,
+		member.Pod,
+	)
+	prefix := strings.Replace(catalog.HookPrefix(cluster, member.Role), "'", `'\''`, -1)
+	cmd := fmt.Sprintf(
+		hookRunCmd,
+		hookDir(cr),
+		member.ContainerID,
+		event,
+		prefix,
+	)
+	return executor.RunScript(
+		reqLogger,
+		cr,
+		cr.Namespace,
+		member.Pod,
+		member.ContainerID,
+		executor.AppContainerName,
+		"backup "+event,
+		strings.NewReader(cmd),
+	)
+}
+
+// checkHook reads the status file of the given event on one member and
+// returns the hook's state, along with the end of its stderr if it failed.
+// A member that cannot be reached is left for the timeout to deal with.
+func checkHook(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorBackup,
+	member *kdv1.BackupMember,
+	event string,
+) (string, string) {
+
+	readFile := func(fileName string) (string, bool) {
+		var strB strings.Builder
+		fileExists, fileError := executor.ReadFile(
+			reqLogger,
+			cr,
+			cr.Namespace,
+			member.Pod,
+			member.ContainerID,
+			executor.AppContainerName,
+			path.Join(hookDir(cr), fileName),
+			&strB,
+		)
+		return strB.String(), fileExists && (fileError == nil)
+	}
+	statusStr, ok := readFile(event + ".status")
+	if !ok {
+		return hookRunning, ""
+	}
+	splitPoint := strings.LastIndex(statusStr, "=")
+	if (splitPoint == -1) || (statusStr[splitPoint+1:] == "") {
+		return hookRunning, ""
+	}
+	exitStatus, convErr := strconv.Atoi(statusStr[splitPoint+1:])
+	if convErr != nil {
+		return hookFailed, "malformed status file"
+	}
+	if exitStatus == 0 {
+		return hookSucceeded, ""
+	}
+	message := fmt.Sprintf("%s exited with status %d", event, exitStatus)
+	if stderr, stderrOk := readFile(event + ".stderr"); stderrOk {
+		message = message + ": " + shared.GetLastLines(stderr, hookOutputMaxSize)
+	}
+	return hookFailed, message
+}
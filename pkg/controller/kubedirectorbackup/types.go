@@ -0,0 +1,71 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubedirectorbackup
+
+import (
+	"time"
+)
+
+const (
+	// activePollPeriod is how often a backup in progress is checked.
+	activePollPeriod = 10 * time.Second
+
+	// pendingPollPeriod is how often a backup that is waiting for its
+	// cluster to be configured is checked.
+	pendingPollPeriod = 30 * time.Second
+
+	// defaultFreezeTimeout is how long the members may stay frozen, while
+	// the freeze hook runs and the snapshots are taken, if the backup does
+	// not say.
+	defaultFreezeTimeout = 5 * time.Minute
+
+	// thawTimeout is how long the thaw hook is given on each member.
+	thawTimeout = 5 * time.Minute
+
+	// hookOutputMaxSize limits how much of the end of the stderr of a failed
+	// hook is kept in the backup status.
+	hookOutputMaxSize int32 = 1024
+
+	// clusterReady is the cluster state in which a backup can be started.
+	clusterReady = "configured"
+)
+
+// States of the freeze and thaw hooks on a member.
+const (
+	hookRunning   = "running"
+	hookSucceeded = "succeeded"
+	hookFailed    = "failed"
+	hookTimedOut  = "timedOut"
+)
+
+// Setup package events used to quiesce the app while its volumes are
+// snapshotted. A role registers for both through the freeze event in its
+// eventList.
+const (
+	freezeEvent = "freeze"
+	thawEvent   = "thaw"
+)
+
+// Files and commands used to run a hook in a member's app container. The
+// startscript is the one installed by the cluster controller from the
+// role's setup package.
+const (
+	hookDirBase     = "/var/lib/kubedirector/backups"
+	hookStartscript = "/opt/guestconfig/*/startscript"
+	hookRunCmd      = `mkdir -p %[1]s && rm -f %[1]s/%[3]s.* &&
+	echo -n %[2]s= > %[1]s/%[3]s.status &&
+	nohup sh -c '%[4]s` + hookStartscript + ` --%[3]s 2>%[1]s/%[3]s.stderr 1>%[1]s/%[3]s.stdout;
+	echo -n $? >> %[1]s/%[3]s.status' &`
+)
@@ -0,0 +1,115 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubedirectorcluster
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-logr/logr"
+
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	"github.com/bluek8s/kubedirector/pkg/catalog"
+	"github.com/bluek8s/kubedirector/pkg/executor"
+	"github.com/bluek8s/kubedirector/pkg/observer"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// configureAppContainers installs and runs the setup packages of the
+// additional app containers of a member, if the app declares any for the
+// role. Each container gets the member's configmeta and runs its package's
+// startscript with --configure to completion; the first failure is
+// returned.
+func configureAppContainers(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorCluster,
+	podName string,
+	roleName string,
+	configmeta string,
+) error {
+
+	appCr, appErr := catalog.GetApp(cr)
+	if appErr != nil {
+		return appErr
+	}
+	appRole := catalog.GetRoleFromID(appCr, roleName)
+	if appRole == nil {
+		return nil
+	}
+	var pod *corev1.Pod
+	for _, appContainer := range appRole.Containers {
+		setupInfo := appContainer.SetupPackage
+		if setupInfo == nil {
+			continue
+		}
+		if pod == nil {
+			var podErr error
+			pod, podErr = observer.GetPod(cr.Namespace, podName)
+			if podErr != nil {
+				return podErr
+			}
+		}
+		containerID := ""
+		for _, containerStatus := range pod.Status.ContainerStatuses {
+			if (containerStatus.Name == appContainer.Name) && (containerStatus.State.Running != nil) {
+				containerID = containerStatus.ContainerID
+			}
+		}
+		if containerID == "" {
+			return fmt.Errorf(
+				"container{%s} is not running in member{%s}",
+				appContainer.Name,
+				podName,
+			)
+		}
+		configmetaErr := executor.CreateFile(
+			reqLogger,
+			cr,
+			cr.Namespace,
+			podName,
+			containerID,
+			appContainer.Name,
+			configMetaFile,
+			strings.NewReader(configmeta),
+			true,
+		)
+		if configmetaErr != nil {
+			return configmetaErr
+		}
+		fetchCmd := fmt.Sprintf(appPrepFetchURLFmt, setupInfo.PackageURL)
+		if setupInfo.SHA256 != "" {
+			fetchCmd += " &&\n\t" + fmt.Sprintf(appPrepVerifyFmt, setupInfo.SHA256)
+		}
+		cmd := fmt.Sprintf(appPrepInitCmdFmt, fetchCmd) + " &&\n\t" + appContainerConfigCmd
+		cmdErr := executor.RunScript(
+			reqLogger,
+			cr,
+			cr.Namespace,
+			podName,
+			containerID,
+			appContainer.Name,
+			"app container config",
+			strings.NewReader(cmd),
+		)
+		if cmdErr != nil {
+			return fmt.Errorf(
+				"configure of container{%s} failed: %v",
+				appContainer.Name,
+				cmdErr,
+			)
+		}
+	}
+	return nil
+}
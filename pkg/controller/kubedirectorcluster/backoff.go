@@ -0,0 +1,287 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubedirectorcluster
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	"github.com/bluek8s/kubedirector/pkg/shared"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// createBackoffKey identifies one child object (service, statefulset, etc.)
+// of a cluster, by the object description passed to createWithBackoff.
+type createBackoffKey struct {
+	cluster types.UID
+	object  string
+}
+
+// createBackoff tracks the consecutive failures to create one child object
+// of a cluster.
+type createBackoff struct {
+	failures      int
+	retryAt       time.Time
+	lastErr       error
+	quotaConflict *quotaConflict
+}
+
+var (
+	createBackoffs     = make(map[createBackoffKey]*createBackoff)
+	createBackoffsLock sync.Mutex
+)
+
+// createBackoffError is returned in place of attempting an object creation
+// while the cluster is waiting out the backoff from earlier failures.
+type createBackoffError struct {
+	object string
+	wait   time.Duration
+}
+
+func (e *createBackoffError) Error() string {
+	return fmt.Sprintf(
+		"not creating %s; backing off for %v after earlier failures",
+		e.object,
+		e.wait.Round(time.Second),
+	)
+}
+
+// createWithBackoff runs the given creation function for the named object
+// unless that object is currently backing off from earlier creation
+// failures. Each consecutive failure doubles the time before the next
+// attempt, up to createRetryMaxDelay; once there have been
+// createBreakerThreshold failures in a row the circuit is open. A
+// successful creation closes the circuit for that object.
+//
+// This may be called concurrently (see runBounded), so it only records the
+// backoff state; the cluster's conditions are set from that state by
+// syncDegradedCondition and syncQuotaCondition once all creations are done.
+func createWithBackoff(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorCluster,
+	object string,
+	create func() error,
+) error {
+
+	key := createBackoffKey{cluster: cr.UID, object: object}
+	createBackoffsLock.Lock()
+	if backoff, ok := createBackoffs[key]; ok {
+		if wait := time.Until(backoff.retryAt); wait > 0 {
+			createBackoffsLock.Unlock()
+			return &createBackoffError{object: object, wait: wait}
+		}
+	}
+	createBackoffsLock.Unlock()
+	createErr := create()
+	createBackoffsLock.Lock()
+	defer createBackoffsLock.Unlock()
+	if createErr == nil {
+		if _, ok := createBackoffs[key]; ok {
+			delete(createBackoffs, key)
+			shared.LogInfof(
+				reqLogger,
+				cr,
+				shared.EventReasonCluster,
+				"created %s; no longer backing off",
+				object,
+			)
+		}
+		return nil
+	}
+	backoff, ok := createBackoffs[key]
+	if !ok {
+		backoff = &createBackoff{}
+		createBackoffs[key] = backoff
+	}
+	backoff.failures++
+	backoff.lastErr = createErr
+	backoff.quotaConflict = parseQuotaConflict(object, createErr.Error())
+	delay := createRetryDelay(backoff.failures)
+	backoff.retryAt = time.Now().Add(delay)
+	shared.LogInfof(
+		reqLogger,
+		cr,
+		shared.EventReasonCluster,
+		"%d consecutive failures to create %s; next attempt in %v",
+		backoff.failures,
+		object,
+		delay,
+	)
+	return createErr
+}
+
+// createRetryDelay returns the wait before the next attempt to create an
+// object that has failed the given number of times in a row: the base delay
+// doubled for each failure after the first, up to createRetryMaxDelay.
+func createRetryDelay(
+	failures int,
+) time.Duration {
+
+	delay := createRetryBaseDelay
+	for i := 1; (i < failures) && (delay < createRetryMaxDelay); i++ {
+		delay *= 2
+	}
+	if delay > createRetryMaxDelay {
+		delay = createRetryMaxDelay
+	}
+	return delay
+}
+
+// runBounded runs the given functions concurrently, with at most
+// createParallelism of them running at once, and waits for all of them to
+// finish.
+func runBounded(
+	funcs []func(),
+) {
+
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, createParallelism)
+	wg.Add(len(funcs))
+	for _, f := range funcs {
+		slots <- struct{}{}
+		go func(run func()) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			run()
+		}(f)
+	}
+	wg.Wait()
+}
+
+// createRetryWait returns how long the cluster must still wait before the
+// next attempt to create any of its backed-off child objects, or zero if
+// none is backing off.
+func createRetryWait(
+	cr *kdv1.KubeDirectorCluster,
+) time.Duration {
+
+	createBackoffsLock.Lock()
+	defer createBackoffsLock.Unlock()
+	var soonest time.Duration
+	for key, backoff := range createBackoffs {
+		if key.cluster != cr.UID {
+			continue
+		}
+		if wait := time.Until(backoff.retryAt); (wait > 0) && ((soonest == 0) || (wait < soonest)) {
+			soonest = wait
+		}
+	}
+	return soonest
+}
+
+// syncDegradedCondition sets the cluster's Degraded condition to true,
+// naming the blocking error, while any of its child objects has failed
+// creation createBreakerThreshold or more times in a row; otherwise it
+// clears the condition. If several objects are blocked, the first by name
+// is described.
+func syncDegradedCondition(
+	cr *kdv1.KubeDirectorCluster,
+) {
+
+	createBackoffsLock.Lock()
+	defer createBackoffsLock.Unlock()
+	blocked := ""
+	for key, backoff := range createBackoffs {
+		if (key.cluster != cr.UID) || (backoff.failures < createBreakerThreshold) {
+			continue
+		}
+		if (blocked == "") || (key.object < blocked) {
+			blocked = key.object
+		}
+	}
+	if blocked == "" {
+		shared.SetCondition(
+			&cr.Status.Conditions,
+			kdv1.ClusterDegraded,
+			corev1.ConditionFalse,
+			"",
+			"",
+		)
+		return
+	}
+	lastErr := createBackoffs[createBackoffKey{cluster: cr.UID, object: blocked}].lastErr
+	shared.SetCondition(
+		&cr.Status.Conditions,
+		kdv1.ClusterDegraded,
+		corev1.ConditionTrue,
+		createFailureReason(lastErr),
+		fmt.Sprintf("failed to create %s: %v", blocked, lastErr),
+	)
+}
+
+// createQuotaConflicts returns the quota or limit range conflicts that
+// failed the last attempts to create objects of the cluster, for objects
+// that have not since been created successfully. They are sorted by object.
+func createQuotaConflicts(
+	cr *kdv1.KubeDirectorCluster,
+) []*quotaConflict {
+
+	createBackoffsLock.Lock()
+	defer createBackoffsLock.Unlock()
+	var objects []string
+	for key, backoff := range createBackoffs {
+		if (key.cluster == cr.UID) && (backoff.quotaConflict != nil) {
+			objects = append(objects, key.object)
+		}
+	}
+	sort.Strings(objects)
+	conflicts := make([]*quotaConflict, 0, len(objects))
+	for _, object := range objects {
+		key := createBackoffKey{cluster: cr.UID, object: object}
+		conflicts = append(conflicts, createBackoffs[key].quotaConflict)
+	}
+	return conflicts
+}
+
+// forgetCreateBackoff drops any backoff state for a deleted cluster.
+func forgetCreateBackoff(
+	cr *kdv1.KubeDirectorCluster,
+) {
+
+	createBackoffsLock.Lock()
+	defer createBackoffsLock.Unlock()
+	for key := range createBackoffs {
+		if key.cluster == cr.UID {
+			delete(createBackoffs, key)
+		}
+	}
+}
+
+// createFailureReason classifies a creation error for the reason of the
+// Degraded condition. A quota rejection gets a reason distinct from the
+// QuotaExceeded condition, which describes it in detail.
+func createFailureReason(
+	err error,
+) string {
+
+	msg := err.Error()
+	switch {
+	case errors.IsForbidden(err) && strings.Contains(msg, "exceeded quota"):
+		return "QuotaBlocked"
+	case strings.Contains(msg, "admission webhook"):
+		return "AdmissionDenied"
+	case errors.IsForbidden(err) || errors.IsInvalid(err):
+		return "CreateRejected"
+	default:
+		return "CreateFailed"
+	}
+}
@@ -0,0 +1,235 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubedirectorcluster
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+var testLogger logr.Logger = logf.Log.WithName("test")
+
+func TestCreateRetryDelay(t *testing.T) {
+
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{1, 5 * time.Second},
+		{2, 10 * time.Second},
+		{3, 20 * time.Second},
+		{6, 160 * time.Second},
+		{7, 5 * time.Minute},
+		{100, 5 * time.Minute},
+	}
+	for _, test := range tests {
+		if got := createRetryDelay(test.failures); got != test.want {
+			t.Errorf("%d failures: got %v, want %v", test.failures, got, test.want)
+		}
+	}
+}
+
+func TestCreateWithBackoffDegraded(t *testing.T) {
+
+	quotaErr := errors.NewForbidden(
+		schema.GroupResource{Resource: "services"},
+		"s1",
+		fmt.Errorf("exceeded quota: q1, requested: services=1, used: services=2, limited: services=2"),
+	)
+	webhookErr := fmt.Errorf(`admission webhook "check.example.com" denied the request: no`)
+	otherErr := fmt.Errorf("connection refused")
+
+	tests := []struct {
+		name       string
+		results    []error
+		wantStatus string
+		wantReason string
+	}{
+		{"below threshold", []error{otherErr, otherErr}, "", ""},
+		{"threshold", []error{otherErr, otherErr, otherErr}, "True", "CreateFailed"},
+		{"quota", []error{quotaErr, quotaErr, quotaErr}, "True", "QuotaBlocked"},
+		{"webhook", []error{otherErr, otherErr, webhookErr}, "True", "AdmissionDenied"},
+		{"cleared on success", []error{otherErr, otherErr, otherErr, nil}, "False", ""},
+		{"success resets count", []error{otherErr, otherErr, nil, otherErr}, "", ""},
+	}
+	for i, test := range tests {
+		cr := &kdv1.KubeDirectorCluster{Status: &kdv1.KubeDirectorClusterStatus{}}
+		cr.UID = types.UID(fmt.Sprintf("backoff-%d", i))
+		key := createBackoffKey{cluster: cr.UID, object: "service s1"}
+		for _, result := range test.results {
+			// Skip the wait from the previous failure.
+			if backoff, ok := createBackoffs[key]; ok {
+				backoff.retryAt = time.Time{}
+			}
+			createErr := createWithBackoff(
+				testLogger,
+				cr,
+				"service s1",
+				func() error { return result },
+			)
+			if createErr != result {
+				t.Errorf("%s: got error %v, want %v", test.name, createErr, result)
+			}
+			syncDegradedCondition(cr)
+		}
+		gotStatus := ""
+		gotReason := ""
+		for _, condition := range cr.Status.Conditions {
+			if condition.Type == kdv1.ClusterDegraded {
+				gotStatus = string(condition.Status)
+				gotReason = condition.Reason
+			}
+		}
+		if (gotStatus != test.wantStatus) || (gotReason != test.wantReason) {
+			t.Errorf(
+				"%s: got Degraded %q/%q, want %q/%q",
+				test.name,
+				gotStatus,
+				gotReason,
+				test.wantStatus,
+				test.wantReason,
+			)
+		}
+		forgetCreateBackoff(cr)
+	}
+}
+
+func TestCreateWithBackoffWaits(t *testing.T) {
+
+	cr := &kdv1.KubeDirectorCluster{Status: &kdv1.KubeDirectorClusterStatus{}}
+	cr.UID = "backoff-wait"
+	defer forgetCreateBackoff(cr)
+	createErr := createWithBackoff(
+		testLogger,
+		cr,
+		"service s1",
+		func() error { return fmt.Errorf("connection refused") },
+	)
+	if createErr == nil {
+		t.Fatalf("first attempt: got no error")
+	}
+	called := false
+	createErr = createWithBackoff(
+		testLogger,
+		cr,
+		"service s1",
+		func() error {
+			called = true
+			return nil
+		},
+	)
+	if _, ok := createErr.(*createBackoffError); !ok || called {
+		t.Errorf("second attempt: got error %v and called %v, want backoff error and not called", createErr, called)
+	}
+}
+
+func TestCreateRetryWait(t *testing.T) {
+
+	now := time.Now()
+	tests := []struct {
+		name     string
+		retryAts map[string]time.Time
+		want     time.Duration
+	}{
+		{"none", nil, 0},
+		{"all past", map[string]time.Time{"a": now.Add(-time.Minute)}, 0},
+		{
+			"soonest future",
+			map[string]time.Time{
+				"a": now.Add(-time.Minute),
+				"b": now.Add(time.Minute),
+				"c": now.Add(20 * time.Second),
+			},
+			20 * time.Second,
+		},
+	}
+	other := createBackoffKey{cluster: "retry-wait-other", object: "a"}
+	createBackoffs[other] = &createBackoff{failures: 1, retryAt: now.Add(time.Second)}
+	defer delete(createBackoffs, other)
+	for i, test := range tests {
+		cr := &kdv1.KubeDirectorCluster{Status: &kdv1.KubeDirectorClusterStatus{}}
+		cr.UID = types.UID(fmt.Sprintf("retry-wait-%d", i))
+		for object, retryAt := range test.retryAts {
+			key := createBackoffKey{cluster: cr.UID, object: object}
+			createBackoffs[key] = &createBackoff{failures: 1, retryAt: retryAt}
+		}
+		got := createRetryWait(cr)
+		// Allow for the time taken since the entries were made.
+		if (got > test.want) || (got < test.want-time.Second) {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+		forgetCreateBackoff(cr)
+	}
+}
+
+func TestParseQuotaConflict(t *testing.T) {
+
+	tests := []struct {
+		name string
+		msg  string
+		want *quotaConflict
+	}{
+		{
+			"resource quota",
+			`pods "p1" is forbidden: exceeded quota: compute, requested: requests.cpu=2,requests.memory=1Gi, used: requests.cpu=1,requests.memory=1Gi, limited: requests.cpu=2,requests.memory=2Gi`,
+			&quotaConflict{
+				object:    "pod p1",
+				kind:      quotaKindResourceQuota,
+				resources: []string{"requests.cpu", "requests.memory"},
+				detail:    "ResourceQuota{compute} exceeded: requested requests.cpu=2,requests.memory=1Gi, used requests.cpu=1,requests.memory=1Gi, limited requests.cpu=2,requests.memory=2Gi",
+			},
+		},
+		{
+			"limit range",
+			`pods "p1" is forbidden: [maximum cpu usage per Container is 1, but limit is 2, minimum memory usage per Pod is 1Gi, but request is 512Mi]`,
+			&quotaConflict{
+				object:    "pod p1",
+				kind:      quotaKindLimitRange,
+				resources: []string{"cpu", "memory"},
+				detail:    "LimitRange violated: maximum cpu per Container is 1, but limit is 2; minimum memory per Pod is 1Gi, but request is 512Mi",
+			},
+		},
+		{
+			"limit ratio",
+			`pods "p1" is forbidden: cpu max limit to request ratio per Container is 2, but provided ratio is 4.000000.`,
+			&quotaConflict{
+				object:    "pod p1",
+				kind:      quotaKindLimitRange,
+				resources: []string{"cpu"},
+				detail:    "LimitRange violated: cpu limit to request ratio per Container is at most 2, but is 4.000000",
+			},
+		},
+		{
+			"other error",
+			`pods "p1" is forbidden: unable to validate against any security policy`,
+			nil,
+		},
+	}
+	for _, test := range tests {
+		got := parseQuotaConflict("pod p1", test.msg)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubedirectorcluster
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-logr/logr"
+
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	"github.com/bluek8s/kubedirector/pkg/catalog"
+	"github.com/bluek8s/kubedirector/pkg/executor"
+	"github.com/bluek8s/kubedirector/pkg/shared"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+)
+
+// handleRoleBlockStorageChange checks whether the size or number of the
+// role's block devices has been increased. If so it requests the larger
+// size for each existing member block PVC, and replaces the statefulset so
+// that its claim templates (and, for added devices, its pod template) match
+// the role. Added devices reach the existing members as the statefulset
+// controller restarts them. The role's BlockStorageChanging condition
+// tracks the process until every member has all of its block PVCs at the
+// new size; the members are then notified. Failure here will not be treated
+// as a reconciler-stopping error; we'll just try again next time. The
+// return value is false if the role has been left without a statefulset.
+func handleRoleBlockStorageChange(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorCluster,
+	role *roleInfo,
+) bool {
+
+	if role.roleSpec == nil || role.roleSpec.BlockStorage == nil {
+		return true
+	}
+	// Members created before their device paths were recorded in their
+	// status get them now.
+	for i := range role.roleStatus.Members {
+		if len(role.roleStatus.Members[i].BlockDevicePaths) == 0 {
+			role.roleStatus.Members[i].BlockDevicePaths = executor.BlockDevicePaths(role.roleSpec)
+		}
+	}
+	desiredCount := *role.roleSpec.BlockStorage.NumDevices
+	desiredSize := executor.BlockDeviceSize(role.roleSpec)
+	currentCount, currentSize := executor.StatefulSetBlockStorage(role.statefulSet)
+	if currentSize == nil {
+		return true
+	}
+	changing := shared.ConditionIsTrue(role.roleStatus.Conditions, kdv1.RoleBlockStorageChanging)
+	needsReplace := (currentCount < desiredCount) || (currentSize.Cmp(desiredSize) < 0)
+	if !needsReplace && !changing {
+		return true
+	}
+
+	// Only make changes while the role membership is settled. Members
+	// being created or deleted will be dealt with on a later pass.
+	for _, member := range role.roleStatus.Members {
+		state := memberState(member.State)
+		if state != memberReady && state != memberConfigError {
+			return true
+		}
+	}
+
+	if !changing {
+		shared.LogInfof(
+			reqLogger,
+			cr,
+			shared.EventReasonRole,
+			"changing block storage for role{%s} from %d device(s) of %s to %d device(s) of %s",
+			role.roleStatus.Name,
+			currentCount,
+			currentSize.String(),
+			desiredCount,
+			desiredSize.String(),
+		)
+	}
+
+	// Set the condition before touching the statefulset, so that if the
+	// replacement is interrupted we know to finish it.
+	shared.SetCondition(
+		&role.roleStatus.Conditions,
+		kdv1.RoleBlockStorageChanging,
+		corev1.ConditionTrue,
+		"Changing",
+		fmt.Sprintf(
+			"changing member block storage to %d device(s) of %s",
+			desiredCount,
+			desiredSize.String(),
+		),
+	)
+	if needsReplace {
+		statefulSet, replaceErr := executor.ReplaceStatefulSetBlockStorage(
+			reqLogger,
+			cr,
+			role.roleSpec,
+			role.statefulSet,
+			role.roleStatus.PodTemplateHash,
+		)
+		if replaceErr != nil {
+			shared.LogErrorf(
+				reqLogger,
+				replaceErr,
+				cr,
+				shared.EventReasonRole,
+				"failed to replace StatefulSet{%s}",
+				role.statefulSet.Name,
+			)
+		}
+		if statefulSet == nil {
+			role.statefulSet = nil
+			return false
+		}
+		role.statefulSet = statefulSet
+		// The configmeta given to the members lists the new devices.
+		devicePaths := executor.BlockDevicePaths(role.roleSpec)
+		for i := range role.roleStatus.Members {
+			role.roleStatus.Members[i].BlockDevicePaths = devicePaths
+		}
+	}
+
+	// Grow the claims of the existing devices. The claims for added devices
+	// only appear as the members are restarted, at the new size.
+	var pending []string
+	for _, member := range role.roleStatus.Members {
+		for _, pvcName := range executor.MemberBlockPVCNames(role.roleSpec, member.Pod) {
+			done, expandErr := executor.ExpandPVC(cr.Namespace, pvcName, desiredSize)
+			if (expandErr != nil) && !errors.IsNotFound(expandErr) {
+				shared.LogErrorf(
+					reqLogger,
+					expandErr,
+					cr,
+					shared.EventReasonRole,
+					"failed to expand PVC{%s}",
+					pvcName,
+				)
+			}
+			if !done {
+				pending = append(pending, pvcName)
+			}
+		}
+	}
+	if (len(pending) != 0) || !executor.StatefulSetRolloutDone(role.statefulSet) {
+		message := "waiting for members to restart with the new block devices"
+		if len(pending) != 0 {
+			message = fmt.Sprintf(
+				"waiting for PVC(s) %s to reach %s",
+				strings.Join(pending, ","),
+				desiredSize.String(),
+			)
+		}
+		shared.SetCondition(
+			&role.roleStatus.Conditions,
+			kdv1.RoleBlockStorageChanging,
+			corev1.ConditionTrue,
+			"Changing",
+			message,
+		)
+		return true
+	}
+	shared.LogInfof(
+		reqLogger,
+		cr,
+		shared.EventReasonRole,
+		"finished changing block storage for role{%s}",
+		role.roleStatus.Name,
+	)
+	shared.SetCondition(
+		&role.roleStatus.Conditions,
+		kdv1.RoleBlockStorageChanging,
+		corev1.ConditionFalse,
+		"",
+		"",
+	)
+	queueBlockDevicesNotify(reqLogger, cr, role)
+	return true
+}
+
+// queueBlockDevicesNotify adds a notify about the role's current block
+// devices to the queue of each ready member of the role, if the app role
+// handles that event. The notify is run through the member's startscript
+// with the arguments "--blockdevices --role <role> --paths <paths> --size
+// <size>", where paths is a comma-separated list of the device paths.
+func queueBlockDevicesNotify(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorCluster,
+	role *roleInfo,
+) {
+
+	appCr, appErr := catalog.GetApp(cr)
+	if appErr != nil {
+		return
+	}
+	appRole := catalog.GetRoleFromID(appCr, role.roleStatus.Name)
+	if (appRole == nil) || (appRole.EventList == nil) ||
+		!shared.StringInList(blockDevicesEvent, *appRole.EventList) {
+		return
+	}
+	blockSize := executor.BlockDeviceSize(role.roleSpec)
+	arguments := []string{
+		"--" + blockDevicesEvent,
+		"--role",
+		role.roleStatus.Name,
+		"--paths",
+		strings.Join(executor.BlockDevicePaths(role.roleSpec), ","),
+		"--size",
+		blockSize.String(),
+	}
+	for i := range role.roleStatus.Members {
+		member := &(role.roleStatus.Members[i])
+		if memberState(member.State) != memberReady {
+			continue
+		}
+		shared.LogInfof(
+			reqLogger,
+			cr,
+			shared.EventReasonNoEvent,
+			"will notify member{%s}: %s",
+			member.Pod,
+			blockDevicesEvent,
+		)
+		member.StateDetail.PendingNotifyCmds = append(
+			member.StateDetail.PendingNotifyCmds,
+			&kdv1.NotificationDesc{Arguments: arguments},
+		)
+	}
+}
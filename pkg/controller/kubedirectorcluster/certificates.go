@@ -0,0 +1,251 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubedirectorcluster
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	"github.com/bluek8s/kubedirector/pkg/catalog"
+	"github.com/bluek8s/kubedirector/pkg/executor"
+	"github.com/bluek8s/kubedirector/pkg/observer"
+	"github.com/bluek8s/kubedirector/pkg/shared"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+)
+
+// memberCertsConfig returns the member certificates config that applies to
+// this cluster, or nil if members should not get certificates. Members of
+// shellless apps never get certificates, since there is no way to copy the
+// files into their containers.
+func memberCertsConfig(
+	cr *kdv1.KubeDirectorCluster,
+) *kdv1.MemberCertsConfig {
+
+	config := shared.GetMemberCertsConfig()
+	if config == nil {
+		return nil
+	}
+	shellless, shelllessErr := catalog.AppShellless(cr)
+	if (shelllessErr != nil) || shellless {
+		return nil
+	}
+	return config
+}
+
+// syncMemberCertificate makes the cert-manager Certificate of a member match
+// the member certificates config. If certificates are not configured, a
+// Certificate owned by KubeDirector is deleted. The secret holding the
+// issued certificate is returned if it is available. The returned bool is
+// false if certificates are configured but the secret has not been
+// populated yet.
+func syncMemberCertificate(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorCluster,
+	role *roleInfo,
+	member *kdv1.MemberStatus,
+) (*corev1.Secret, bool, error) {
+
+	config := memberCertsConfig(cr)
+	name := executor.MemberCertificateName(member.Pod)
+	certificate, certErr := observer.GetCertificate(cr.Namespace, name)
+	if config == nil {
+		if (certErr == nil) && shared.OwnerReferencesPresent(cr, certificate.GetOwnerReferences()) {
+			return nil, true, executor.DeleteMemberCertificate(cr.Namespace, member.Pod)
+		}
+		if (certErr != nil) && !errors.IsNotFound(certErr) && !meta.IsNoMatchError(certErr) {
+			return nil, true, certErr
+		}
+		return nil, true, nil
+	}
+
+	desired := executor.MemberCertificate(config, cr, role.roleSpec, member.Pod)
+	switch {
+	case (certErr != nil) && errors.IsNotFound(certErr):
+		createErr := createWithBackoff(
+			reqLogger,
+			cr,
+			"certificate for member{"+member.Pod+"}",
+			func() error {
+				return shared.Create(context.TODO(), desired)
+			},
+		)
+		if createErr != nil {
+			return nil, false, createErr
+		}
+	case certErr != nil:
+		return nil, false, certErr
+	default:
+		if updateErr := executor.UpdateCertificate(reqLogger, cr, certificate, desired); updateErr != nil {
+			return nil, false, updateErr
+		}
+	}
+
+	secret, secretErr := observer.GetSecret(cr.Namespace, name)
+	if secretErr != nil {
+		if errors.IsNotFound(secretErr) {
+			return nil, false, nil
+		}
+		return nil, false, secretErr
+	}
+	if (len(secret.Data[corev1.TLSCertKey]) == 0) || (len(secret.Data[corev1.TLSPrivateKeyKey]) == 0) {
+		// Not issued yet.
+		return nil, false, nil
+	}
+	return secret, true, nil
+}
+
+// installMemberCertificate copies the certificate, key, and CA certificate
+// from the given secret into the app container of a member, and records
+// the version of the secret that was installed.
+func installMemberCertificate(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorCluster,
+	member *kdv1.MemberStatus,
+	containerID string,
+	secret *corev1.Secret,
+) error {
+
+	for _, key := range []string{corev1.TLSCertKey, corev1.TLSPrivateKeyKey, memberCertCAKey} {
+		data, ok := secret.Data[key]
+		if !ok {
+			continue
+		}
+		createErr := executor.CreateFile(
+			reqLogger,
+			cr,
+			cr.Namespace,
+			member.Pod,
+			containerID,
+			executor.AppContainerName,
+			filepath.Join(memberCertDir, key),
+			bytes.NewReader(data),
+			false,
+		)
+		if createErr != nil {
+			return fmt.Errorf(
+				"failed to install %s: %v",
+				key,
+				createErr,
+			)
+		}
+	}
+	member.StateDetail.CertificateVersion = secret.ResourceVersion
+	return nil
+}
+
+// refreshMemberCertificate is used on ready members. It keeps the member's
+// Certificate in sync and, if cert-manager has renewed the certificate since
+// it was last installed, copies the new files into the member. A member
+// with a setup package is then told about the change by running its
+// startscript with --reconnect.
+func refreshMemberCertificate(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorCluster,
+	role *roleInfo,
+	member *kdv1.MemberStatus,
+) {
+
+	secret, _, syncErr := syncMemberCertificate(reqLogger, cr, role, member)
+	if syncErr != nil {
+		shared.LogErrorf(
+			reqLogger,
+			syncErr,
+			cr,
+			shared.EventReasonMember,
+			"failed to sync certificate for member{%s}",
+			member.Pod,
+		)
+		return
+	}
+	if (secret == nil) || (secret.ResourceVersion == member.StateDetail.CertificateVersion) {
+		return
+	}
+	containerID := member.StateDetail.LastConfiguredContainer
+	installErr := installMemberCertificate(reqLogger, cr, member, containerID, secret)
+	if installErr != nil {
+		shared.LogErrorf(
+			reqLogger,
+			installErr,
+			cr,
+			shared.EventReasonMember,
+			"failed to install renewed certificate in member{%s}",
+			member.Pod,
+		)
+		return
+	}
+	shared.LogInfof(
+		reqLogger,
+		cr,
+		shared.EventReasonMember,
+		"installed renewed certificate in member{%s}",
+		member.Pod,
+	)
+	if member.StateDetail.LastConfigDataGeneration == nil {
+		return
+	}
+	cmdErr := executor.RunScript(
+		reqLogger,
+		cr,
+		cr.Namespace,
+		member.Pod,
+		containerID,
+		executor.AppContainerName,
+		"app reconnect",
+		strings.NewReader(fmt.Sprintf(
+			appPrepConfigReconnectCmd,
+			containerID,
+			quotedHookPrefix(cr, role.roleSpec.Name),
+		)),
+	)
+	if cmdErr != nil {
+		shared.LogErrorf(
+			reqLogger,
+			cmdErr,
+			cr,
+			shared.EventReasonMember,
+			"failed to run startscript with --reconnect in member{%s} after certificate renewal",
+			member.Pod,
+		)
+	}
+}
+
+// deleteMemberCertificate removes the Certificate (if any) of a member that
+// is being deleted, along with the secret holding the issued certificate.
+// Nothing is deleted unless the Certificate is owned by this cluster.
+func deleteMemberCertificate(
+	cr *kdv1.KubeDirectorCluster,
+	member *kdv1.MemberStatus,
+) error {
+
+	name := executor.MemberCertificateName(member.Pod)
+	certificate, certErr := observer.GetCertificate(cr.Namespace, name)
+	if certErr != nil {
+		if errors.IsNotFound(certErr) || meta.IsNoMatchError(certErr) {
+			return nil
+		}
+		return certErr
+	}
+	if !shared.OwnerReferencesPresent(cr, certificate.GetOwnerReferences()) {
+		return nil
+	}
+	return executor.DeleteMemberCertificate(cr.Namespace, member.Pod)
+}
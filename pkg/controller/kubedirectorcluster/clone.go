@@ -0,0 +1,202 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubedirectorcluster
+
+import (
+	"fmt"
+	"strings"
+
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	"github.com/bluek8s/kubedirector/pkg/executor"
+	"github.com/bluek8s/kubedirector/pkg/observer"
+	"github.com/bluek8s/kubedirector/pkg/shared"
+	"github.com/go-logr/logr"
+	v1 "k8s.io/api/core/v1"
+)
+
+// cloneVolume describes the content source of one volume of a member that
+// is being cloned.
+type cloneVolume struct {
+	template   string
+	dataSource *v1.TypedLocalObjectReference
+	minSize    string
+}
+
+// cloneMemberVolumes creates, for each create pending member of a role in
+// a cluster that is being cloned, PVCs whose content comes from the volumes
+// of the corresponding member (same role and statefulset index) of the
+// clone source: the volume snapshots of a backup, or the PVCs of another
+// cluster. The statefulset uses these PVCs instead of provisioning empty
+// ones. This is only done while the cluster is first being created; members
+// added later start out empty as usual.
+func cloneMemberVolumes(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorCluster,
+	role *roleInfo,
+) error {
+
+	if (cr.Spec.CloneFrom == nil) || (cr.Status.State != string(clusterCreating)) {
+		return nil
+	}
+	if len(role.statefulSet.Spec.VolumeClaimTemplates) == 0 {
+		return nil
+	}
+	var sourceDesc string
+	var sourceVolumes func(podName string) (string, []cloneVolume, error)
+	if cr.Spec.CloneFrom.Backup != "" {
+		backup, backupErr := observer.GetBackup(cr.Namespace, cr.Spec.CloneFrom.Backup)
+		if backupErr != nil {
+			return backupErr
+		}
+		if (backup.Status == nil) || (backup.Status.State != kdv1.BackupSucceeded) {
+			return fmt.Errorf("backup %s has not succeeded", backup.Name)
+		}
+		sourceDesc = "backup{" + backup.Name + "}"
+		sourceVolumes = func(podName string) (string, []cloneVolume, error) {
+			return backupMemberVolumes(backup, role.roleStatus.Name, podName)
+		}
+	} else {
+		source, sourceErr := observer.GetCluster(cr.Namespace, cr.Spec.CloneFrom.Cluster)
+		if sourceErr != nil {
+			return sourceErr
+		}
+		if loadErr := shared.LoadMemberStatusDetail(source); loadErr != nil {
+			return loadErr
+		}
+		sourceDesc = "cluster{" + source.Name + "}"
+		sourceVolumes = func(podName string) (string, []cloneVolume, error) {
+			return clusterMemberVolumes(source, role.roleStatus.Name, podName)
+		}
+	}
+	for _, member := range role.membersByState[memberCreatePending] {
+		sourcePod, volumes, volumesErr := sourceVolumes(member.Pod)
+		if volumesErr != nil {
+			return volumesErr
+		}
+		if sourcePod == "" {
+			continue
+		}
+		if member.StateDetail.ClonedFrom == "" {
+			shared.LogInfof(
+				reqLogger,
+				cr,
+				shared.EventReasonMember,
+				"cloning volumes of member{%s} from %s member{%s}",
+				member.Pod,
+				sourceDesc,
+				sourcePod,
+			)
+		}
+		for _, volume := range volumes {
+			createErr := executor.CreatePVCFromSource(
+				role.statefulSet,
+				volume.template,
+				member.Pod,
+				volume.dataSource,
+				volume.minSize,
+			)
+			if createErr != nil {
+				return createErr
+			}
+		}
+		member.StateDetail.ClonedFrom = sourcePod
+	}
+	return nil
+}
+
+// backupMemberVolumes finds the member of the backup that has the same role
+// and statefulset index as the given pod, if any, and returns its pod name
+// and the snapshots of its volumes.
+func backupMemberVolumes(
+	backup *kdv1.KubeDirectorBackup,
+	roleName string,
+	podName string,
+) (string, []cloneVolume, error) {
+
+	index := podName[strings.LastIndex(podName, "-"):]
+	for _, backupMember := range backup.Status.Members {
+		if (backupMember.Role != roleName) || !strings.HasSuffix(backupMember.Pod, index) {
+			continue
+		}
+		var volumes []cloneVolume
+		for _, volume := range backupMember.Volumes {
+			volumes = append(
+				volumes,
+				cloneVolume{
+					template:   volume.Template,
+					dataSource: executor.SnapshotSource(volume.VolumeSnapshot),
+					minSize:    volume.RestoreSize,
+				},
+			)
+		}
+		return backupMember.Pod, volumes, nil
+	}
+	return "", nil, nil
+}
+
+// clusterMemberVolumes finds the member of the source cluster that has the
+// same role and statefulset index as the given pod, if any, and returns its
+// pod name and its PVCs. The source cluster's member status detail must
+// already have been loaded.
+func clusterMemberVolumes(
+	source *kdv1.KubeDirectorCluster,
+	roleName string,
+	podName string,
+) (string, []cloneVolume, error) {
+
+	var roleSpec *kdv1.Role
+	for i := range source.Spec.Roles {
+		if source.Spec.Roles[i].Name == roleName {
+			roleSpec = &(source.Spec.Roles[i])
+			break
+		}
+	}
+	index := podName[strings.LastIndex(podName, "-"):]
+	for _, roleStatus := range source.Status.Roles {
+		if roleStatus.Name != roleName {
+			continue
+		}
+		for _, sourceMember := range roleStatus.Members {
+			if (sourceMember.Pod == "") || !strings.HasSuffix(sourceMember.Pod, index) {
+				continue
+			}
+			var pvcNames []string
+			if sourceMember.PVC != "" {
+				pvcNames = append(pvcNames, sourceMember.PVC)
+			}
+			if roleSpec != nil {
+				pvcNames = append(pvcNames, executor.MemberBlockPVCNames(roleSpec, sourceMember.Pod)...)
+			}
+			var volumes []cloneVolume
+			for _, pvcName := range pvcNames {
+				pvc, pvcErr := observer.GetPVC(source.Namespace, pvcName)
+				if pvcErr != nil {
+					return "", nil, pvcErr
+				}
+				size := pvc.Spec.Resources.Requests[v1.ResourceStorage]
+				volumes = append(
+					volumes,
+					cloneVolume{
+						template:   strings.TrimSuffix(pvcName, "-"+sourceMember.Pod),
+						dataSource: executor.PVCSource(pvcName),
+						minSize:    size.String(),
+					},
+				)
+			}
+			return sourceMember.Pod, volumes, nil
+		}
+	}
+	return "", nil, nil
+}
@@ -19,6 +19,7 @@ import (
 	"context"
 	"crypto/md5"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"strconv"
 	"time"
@@ -26,6 +27,7 @@ import (
 	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
 	"github.com/bluek8s/kubedirector/pkg/catalog"
 	"github.com/bluek8s/kubedirector/pkg/executor"
+	"github.com/bluek8s/kubedirector/pkg/extension"
 	"github.com/bluek8s/kubedirector/pkg/observer"
 	"github.com/bluek8s/kubedirector/pkg/shared"
 	"github.com/go-logr/logr"
@@ -51,6 +53,8 @@ func (r *ReconcileKubeDirectorCluster) syncCluster(
 	// Memoize state of the incoming object.
 	hadFinalizer := shared.HasFinalizer(cr)
 	oldStatus := cr.Status.DeepCopy()
+	paused := false
+	terminating := false
 
 	// Make sure we have a Status object to work with.
 	if cr.Status == nil {
@@ -62,6 +66,22 @@ func (r *ReconcileKubeDirectorCluster) syncCluster(
 		cr.Status.SpecGenerationToProcess = &initSpecGen
 	}
 
+	// The statuses of steady-state members of very large roles are not kept
+	// in the stored cluster status; bring them back for this reconcile.
+	// oldStatus stays in the stored form, for comparison with the form that
+	// would be written back.
+	if loadErr := shared.LoadMemberStatusDetail(cr); loadErr != nil {
+		shared.LogError(
+			reqLogger,
+			loadErr,
+			cr,
+			shared.EventReasonCluster,
+			"cannot load member statuses",
+		)
+		return loadErr
+	}
+	statesBefore := snapshotStates(cr)
+
 	annotations := cr.Annotations
 	if annotations == nil {
 		annotations = make(map[string]string)
@@ -89,14 +109,23 @@ func (r *ReconcileKubeDirectorCluster) syncCluster(
 		// we fail to fix the owner ref there it's not worth bailing out of
 		// reconciliation.
 		executor.UpdateClusterStatusBackupOwner(reqLogger, cr, statusBackup)
-		syncMemberNotifies(reqLogger, cr)
+		if !paused && !terminating {
+			syncMemberNotifies(reqLogger, cr)
+			syncMemberReadiness(reqLogger, cr)
+			syncDegradedCondition(cr)
+			syncQuotaCondition(reqLogger, cr)
+		}
 		updateStateRollup(cr)
+		if cr.DeletionTimestamp == nil {
+			publishMemberMetrics(cr)
+		}
 		nowHasFinalizer := shared.HasFinalizer(cr)
 		// Now see if anything has changed that we need to fix or update.
 		statusChanged := false
 		backupAnnotationNeedsReconcile := false
 		if (cr.DeletionTimestamp == nil) || nowHasFinalizer {
-			statusChanged = !equality.Semantic.DeepEqual(cr.Status, oldStatus)
+			storedStatus, _ := summarizeMemberStatus(cr.Status)
+			statusChanged = !equality.Semantic.DeepEqual(storedStatus, oldStatus)
 			// Even if status content has not changed, we still need to go
 			// through the status-writing process if we need to create or
 			// delete a status-backup CR.
@@ -138,14 +167,30 @@ func (r *ReconcileKubeDirectorCluster) syncCluster(
 			if (updateErr == nil) && statusChanged {
 				cr.Status.GenerationUID = uuid.New().String()
 				ClusterStatusGens.WriteStatusGen(cr.UID, cr.Status.GenerationUID)
-				updateErr = executor.UpdateClusterStatus(
+				// Write the complete member lists of any very large roles
+				// to their configmaps before the status that relies on
+				// them. The in-memory CR keeps the complete status.
+				storedStatus, details := summarizeMemberStatus(cr.Status)
+				updateErr = executor.UpdateMemberStatusDetail(
+					reqLogger,
 					cr,
-					statusBackupShouldExist,
-					statusBackup,
+					details,
 				)
+				if updateErr == nil {
+					statusCR := cr.DeepCopy()
+					statusCR.Status = storedStatus
+					updateErr = executor.UpdateClusterStatus(
+						statusCR,
+						statusBackupShouldExist,
+						statusBackup,
+					)
+					cr.ResourceVersion = statusCR.ResourceVersion
+				}
 				// If this succeeded, no need to do it again on next iteration.
 				if updateErr == nil {
 					statusChanged = false
+					executor.DeleteStaleMemberStatusDetail(reqLogger, cr, details)
+					publishTransitions(reqLogger, cr, statesBefore)
 				}
 			}
 			// If any necessary status update worked, let's also update
@@ -204,6 +249,20 @@ func (r *ReconcileKubeDirectorCluster) syncCluster(
 					continue
 				}
 			}
+			// Nothing new (such as a status backup or member status
+			// configmap) can be created in a terminating namespace, so
+			// don't hold up this reconciler for writes that may never
+			// succeed.
+			if namespaceTerminating(cr) {
+				shared.LogError(
+					reqLogger,
+					updateErr,
+					cr,
+					shared.EventReasonNoEvent,
+					"namespace is terminating; giving up on status update",
+				)
+				return
+			}
 			if wait < maxWait {
 				wait = wait * 2
 			}
@@ -228,6 +287,11 @@ func (r *ReconcileKubeDirectorCluster) syncCluster(
 	// Calculate md5check sum to generate unique hash for connection object
 	currentHash := calcConnectionsHash(&cr.Spec.Connections, cr.Namespace)
 
+	// Changes to the propagated labels are not covered by the spec
+	// generation, so track them by hash too.
+	labelsHash := propagatedLabelsHash(cr)
+	labelsChanged := (labelsHash != cr.Status.LastLabelsHash)
+
 	// We use a finalizer to maintain KubeDirector state consistency;
 	// e.g. app references and ClusterStatusGens.
 	doExit, finalizerErr := r.handleFinalizers(reqLogger, cr)
@@ -262,24 +326,74 @@ func (r *ReconcileKubeDirectorCluster) syncCluster(
 
 	checkContainerStates(reqLogger, cr)
 
+	// In a terminating namespace the cluster is only torn down; it will
+	// itself be deleted along with the namespace.
+	terminating = handleNamespaceTermination(reqLogger, cr)
+	if terminating {
+		return nil
+	}
+
+	// A paused cluster is only observed. Its status is still written back,
+	// but nothing is created or changed and no commands are run in members.
+	paused = clusterPaused(reqLogger, cr)
+	if paused {
+		return nil
+	}
+
+	// A changed naming scheme is carried out by re-creating the cluster's
+	// objects. Nothing else is done in a pass that deletes the old ones.
+	if !syncNamingSchemeChange(reqLogger, cr) {
+		return nil
+	}
+
 	clusterServiceErr := syncClusterService(reqLogger, cr)
 	if clusterServiceErr != nil {
 		errLog("cluster service", clusterServiceErr)
 		return clusterServiceErr
 	}
 
+	syncAppChange(reqLogger, cr)
+
+	syncRoleScales(reqLogger, cr)
+
+	syncOperations(reqLogger, cr)
+
+	syncCreator(reqLogger, cr)
+
+	syncDebugMode(reqLogger, cr)
+
+	syncRetainedPVCs(reqLogger, cr)
+
 	roles, state, rolesErr := syncClusterRoles(reqLogger, cr)
 	if rolesErr != nil {
 		errLog("roles", rolesErr)
 		return rolesErr
 	}
 
+	// If a membership change is queued behind the one just completed, it
+	// will be started on the next handler pass; the cluster is not stable.
+	if (state == clusterMembersStableReady) && (len(cr.Status.Operations) > 1) {
+		state = clusterMembersStableUnready
+	}
+
+	syncNetworkPolicies(reqLogger, cr, roles)
+
+	if dashboardErr := executor.SyncDashboard(reqLogger, cr); dashboardErr != nil {
+		shared.LogError(
+			reqLogger,
+			dashboardErr,
+			cr,
+			shared.EventReasonNoEvent,
+			"failed to sync dashboard configmap",
+		)
+	}
+
 	// The "state" calculated above can be different on next handler pass,
 	// so we need to make sure we bump the spec gen now if necessary.
 	// If we delay doing this, a handler error (e.g. in syncMemberServices)
 	// could cause a handler exit and we would lose the necessary spec gen
 	// update.
-	if state == clusterMembersChangedUnready || (currentHash != cr.Status.LastConnectionHash) {
+	if state == clusterMembersChangedUnready || (currentHash != cr.Status.LastConnectionHash) || labelsChanged {
 
 		if currentHash != cr.Status.LastConnectionHash {
 
@@ -311,6 +425,7 @@ func (r *ReconcileKubeDirectorCluster) syncCluster(
 		incremented := *cr.Status.SpecGenerationToProcess + int64(1)
 		cr.Status.SpecGenerationToProcess = &incremented
 		cr.Status.LastConnectionHash = currentHash
+		cr.Status.LastLabelsHash = labelsHash
 	}
 
 	memberServicesErr := syncMemberServices(reqLogger, cr, roles)
@@ -319,6 +434,12 @@ func (r *ReconcileKubeDirectorCluster) syncCluster(
 		return memberServicesErr
 	}
 
+	syncMemberPodLabels(reqLogger, cr, roles)
+
+	syncMemberPVCMetadata(reqLogger, cr, roles)
+
+	syncRoleRestarts(reqLogger, cr, roles)
+
 	if state == clusterMembersStableReady {
 		if cr.Status.State != string(clusterReady) {
 			shared.LogInfo(
@@ -401,7 +522,8 @@ func (r *ReconcileKubeDirectorCluster) syncCluster(
 			cr.Status.State = string(clusterReady)
 		}
 
-		if currentHash == cr.Status.LastConnectionHash {
+		if (currentHash == cr.Status.LastConnectionHash) && !labelsChanged {
+			recordLastKnownGood(reqLogger, cr)
 			return nil
 		}
 	}
@@ -410,6 +532,11 @@ func (r *ReconcileKubeDirectorCluster) syncCluster(
 		cr.Status.State = string(clusterUpdating)
 	}
 
+	// Hold off on configuring members, or updating the configmeta of ready
+	// members, while any probed database connection is unreachable (or not
+	// yet probed); other member changes go ahead.
+	holdConfigure := !checkDatabaseConnections(reqLogger, cr)
+
 	configmetaGen, configMetaErr := catalog.ConfigmetaGenerator(
 		cr,
 		calcMembersForRoles(roles),
@@ -425,12 +552,14 @@ func (r *ReconcileKubeDirectorCluster) syncCluster(
 		return configMetaErr
 	}
 
-	membersErr := syncMembers(reqLogger, cr, roles, configmetaGen)
+	membersErr := syncMembers(reqLogger, cr, roles, configmetaGen, holdConfigure)
 	if membersErr != nil {
 		errLog("members", membersErr)
 		return membersErr
 	}
 
+	syncAppUpgradeProgress(reqLogger, cr)
+
 	return nil
 }
 
@@ -478,6 +607,39 @@ func calcConnectionsHash(
 		buffer.WriteString(c)
 		buffer.WriteString(rv)
 	}
+	for _, store := range con.ObjectStores {
+		// The connection details are part of the spec, but connections are
+		// not covered by the spec generation, so hash them here too.
+		storeJSON, _ := json.Marshal(store)
+		buffer.Write(storeJSON)
+		if store.SecretRef != nil {
+			var rv string
+			secretObj, secErr := observer.GetSecret(ns, *store.SecretRef)
+			if secErr == nil {
+				rv = secretObj.ResourceVersion
+			}
+			buffer.WriteString(rv)
+		}
+	}
+	for _, db := range con.Databases {
+		dbJSON, _ := json.Marshal(db)
+		buffer.Write(dbJSON)
+		secretNames := []*string{db.SecretRef}
+		if db.TLS != nil {
+			secretNames = append(secretNames, db.TLS.CASecretRef)
+		}
+		for _, secretName := range secretNames {
+			if secretName == nil {
+				continue
+			}
+			var rv string
+			secretObj, secErr := observer.GetSecret(ns, *secretName)
+			if secErr == nil {
+				rv = secretObj.ResourceVersion
+			}
+			buffer.WriteString(rv)
+		}
+	}
 	// md5 is very cheap for small strings
 	md5Sum := md5.Sum([]byte(buffer.String()))
 	return hex.EncodeToString(md5Sum[:])
@@ -485,21 +647,32 @@ func calcConnectionsHash(
 
 // checkContainerStates updates the lastKnownContainerState in each member
 // status. It will also move ready or config-error nodes back to create pending
-// status if their container ID has changed.
+// status if their container ID has changed, unless they are edge members on
+// a node that is out of contact. Finally it refreshes each role's
+// AffinityUnsatisfied condition based on member scheduling errors, the
+// cluster's MembersPending condition based on diagnosis of pending pods, and
+// its QuotaExceeded condition.
+// Settled members whose pods have had no events since the last check are
+// skipped, except on the periodic full check; see takeMemberPodChanges.
 func checkContainerStates(
 	reqLogger logr.Logger,
 	cr *kdv1.KubeDirectorCluster,
 ) {
 
+	changedPods, fullCheck := takeMemberPodChanges(cr)
 	numRoleStatuses := len(cr.Status.Roles)
 	for i := 0; i < numRoleStatuses; i++ {
 		roleStatus := &(cr.Status.Roles[i])
 		numMemberStatuses := len(roleStatus.Members)
 		for j := 0; j < numMemberStatuses; j++ {
 			memberStatus := &(roleStatus.Members[j])
+			if !fullCheck && !changedPods[memberStatus.Pod] && memberSettled(cr, memberStatus) {
+				continue
+			}
 			containerID := ""
-			// clear SchedulingErrorMessage in MemberStateDetail
+			// clear SchedulingErrorMessage and PendingReason in MemberStateDetail
 			memberStatus.StateDetail.SchedulingErrorMessage = nil
+			memberStatus.StateDetail.PendingReason = nil
 			if memberStatus.Pod != "" {
 				memberStatus.StateDetail.LastKnownContainerState = containerMissing
 				pod, podErr := observer.GetPod(cr.Namespace, memberStatus.Pod)
@@ -516,8 +689,11 @@ func checkContainerStates(
 									memberStatus.StateDetail.LastKnownContainerState = containerUnresponsive
 								} else {
 									memberStatus.StateDetail.LastKnownContainerState = containerUnknown
+									// Look at container readiness rather than
+									// pod readiness, since the latter also
+									// depends on our own readiness gate.
 									for _, condition := range pod.Status.Conditions {
-										if condition.Type == corev1.PodReady {
+										if condition.Type == corev1.ContainersReady {
 											switch condition.Status {
 											case corev1.ConditionTrue:
 												memberStatus.StateDetail.LastKnownContainerState = containerRunning
@@ -546,6 +722,12 @@ func checkContainerStates(
 							break
 						}
 					}
+					// An edge member whose node is out of contact keeps its
+					// configured container; its pod status is only stale.
+					if memberNodeDisconnected(cr, roleStatus.Name, pod) {
+						memberStatus.StateDetail.LastKnownContainerState = containerDisconnected
+						containerID = memberStatus.StateDetail.LastConfiguredContainer
+					}
 				} else {
 					if !errors.IsNotFound(podErr) {
 						memberStatus.StateDetail.LastKnownContainerState = containerUnknown
@@ -583,9 +765,22 @@ func checkContainerStates(
 				}
 				// Set pod blocking message in MemberStateDetail if LastKnownContainerState is containerMissing
 				updateSchedulingErrorMessage(pod, memberStatus)
+				// Explain why the pod is pending, if it is, and track any
+				// image pull failures.
+				if podErr == nil {
+					updatePendingDiagnosis(cr, pod, memberStatus)
+					updateImagePullStatus(pod, memberStatus)
+					updateMemberHealth(pod, memberStatus)
+				} else {
+					memberStatus.StateDetail.ImagePullError = nil
+					updateMemberHealth(nil, memberStatus)
+				}
 			}
 		}
+		updateRoleAffinityCondition(roleStatus)
 	}
+	updateMembersPendingCondition(cr)
+	updateExtensionFailedCondition(cr)
 }
 
 // updateStateRollup examines current per-member status and sets the top-level
@@ -601,6 +796,7 @@ func updateStateRollup(
 	cr.Status.MemberStateRollup.MembersRestarting = false
 	cr.Status.MemberStateRollup.ConfigErrors = false
 	cr.Status.MemberStateRollup.MembersNotScheduled = false
+	cr.Status.MemberStateRollup.MembersDisconnected = false
 
 	checkMemberDown := func(memberStatus kdv1.MemberStatus) {
 		if (memberStatus.StateDetail.LastKnownContainerState == containerTerminated) ||
@@ -655,6 +851,9 @@ func updateStateRollup(
 			if memberStatus.StateDetail.LastKnownContainerState == containerWaiting {
 				cr.Status.MemberStateRollup.MembersWaiting = true
 			}
+			if memberStatus.StateDetail.LastKnownContainerState == containerDisconnected {
+				cr.Status.MemberStateRollup.MembersDisconnected = true
+			}
 		}
 	}
 }
@@ -756,6 +955,22 @@ func (r *ReconcileKubeDirectorCluster) handleFinalizers(
 ) (bool, error) {
 
 	if cr.DeletionTimestamp != nil {
+		// Give any extensions a chance to act before the members go away,
+		// unless that was already done when the namespace started
+		// terminating. Their failures do not hold up the deletion.
+		if shared.HasFinalizer(cr) &&
+			!shared.ConditionIsTrue(cr.Status.Conditions, kdv1.ClusterNamespaceTerminating) {
+			extension.PreDelete(reqLogger, cr)
+		}
+		// Claims that the role retention policies keep must be released
+		// from the cluster before the garbage collector can delete them.
+		// Hold on to the finalizer until that is done.
+		if shared.HasFinalizer(cr) {
+			releaseErr := releaseRetainedPVCs(reqLogger, cr)
+			if releaseErr != nil {
+				return true, releaseErr
+			}
+		}
 		// If a deletion has been requested, while ours (or other) finalizers
 		// existed on the CR, go ahead and remove our finalizer.
 		shared.RemoveFinalizer(cr)
@@ -767,6 +982,13 @@ func (r *ReconcileKubeDirectorCluster) handleFinalizers(
 		)
 		// Also clear the status gen from our cache.
 		ClusterStatusGens.DeleteStatusGen(cr.UID)
+		forgetCreateBackoff(cr)
+		forgetDatabaseProbes(cr)
+		forgetStatefulSetQuotaChecks(cr)
+		forgetPendingEventChecks(cr)
+		forgetMemberPodChanges(cr)
+		shared.DeleteClusterMembers(cr.Namespace, cr.Name, allMemberStates)
+		extension.ForgetCluster(cr)
 		shared.RemoveClusterAppReference(
 			cr.Namespace,
 			cr.Name,
@@ -782,6 +1004,24 @@ func (r *ReconcileKubeDirectorCluster) handleFinalizers(
 	return false, nil
 }
 
+// publishMemberMetrics updates the metrics for the number of members of the
+// cluster in each member state.
+func publishMemberMetrics(
+	cr *kdv1.KubeDirectorCluster,
+) {
+
+	counts := make(map[string]int)
+	for _, state := range allMemberStates {
+		counts[state] = 0
+	}
+	for _, roleStatus := range cr.Status.Roles {
+		for _, member := range roleStatus.Members {
+			counts[member.State]++
+		}
+	}
+	shared.SetClusterMembers(cr.Namespace, cr.Name, counts)
+}
+
 // calcMembersForRoles generates a map of role name to list of all member
 // in the role that are intended to exist -- i.e. members in states
 // memberCreatePending, memberCreating, memberReady or memberConfigError
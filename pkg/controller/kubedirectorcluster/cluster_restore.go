@@ -418,6 +418,52 @@ func connectedResourcesExist(
 			return false
 		}
 	}
+	for _, store := range cr.Spec.Connections.ObjectStores {
+		if store.SecretRef == nil {
+			continue
+		}
+		_, secretErr := observer.GetSecret(
+			cr.Namespace,
+			*store.SecretRef,
+		)
+		if secretErr != nil {
+			shared.LogInfof(
+				reqLogger,
+				cr,
+				shared.EventReasonCluster,
+				"being restored: object store %s credentials Secret %s does not exist",
+				store.Name,
+				*store.SecretRef,
+			)
+			return false
+		}
+	}
+	for _, db := range cr.Spec.Connections.Databases {
+		secretNames := []*string{db.SecretRef}
+		if db.TLS != nil {
+			secretNames = append(secretNames, db.TLS.CASecretRef)
+		}
+		for _, secretName := range secretNames {
+			if secretName == nil {
+				continue
+			}
+			_, secretErr := observer.GetSecret(
+				cr.Namespace,
+				*secretName,
+			)
+			if secretErr != nil {
+				shared.LogInfof(
+					reqLogger,
+					cr,
+					shared.EventReasonCluster,
+					"being restored: database %s Secret %s does not exist",
+					db.Name,
+					*secretName,
+				)
+				return false
+			}
+		}
+	}
 	return true
 }
 
@@ -0,0 +1,203 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubedirectorcluster
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	"github.com/bluek8s/kubedirector/pkg/catalog"
+	"github.com/bluek8s/kubedirector/pkg/executor"
+	"github.com/bluek8s/kubedirector/pkg/shared"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// configurePolicy returns the timeout (zero for none), the number of
+// retries, and the initial retry backoff for the initial configuration of
+// the given role's members. Each field set in the cluster role's policy
+// overrides that of the app role.
+func configurePolicy(
+	cr *kdv1.KubeDirectorCluster,
+	roleName string,
+) (time.Duration, int32, time.Duration) {
+
+	var policies []*kdv1.ConfigurePolicy
+	appCr, appErr := catalog.GetApp(cr)
+	if appErr == nil {
+		appRole := catalog.GetRoleFromID(appCr, roleName)
+		if appRole != nil {
+			policies = append(policies, appRole.ConfigurePolicy)
+		}
+	}
+	for i := range cr.Spec.Roles {
+		if cr.Spec.Roles[i].Name == roleName {
+			policies = append(policies, cr.Spec.Roles[i].ConfigurePolicy)
+		}
+	}
+	var timeout time.Duration
+	var retries int32
+	backoff := defaultConfigureBackoff
+	for _, policy := range policies {
+		if policy == nil {
+			continue
+		}
+		if policy.TimeoutSeconds != nil {
+			timeout = time.Duration(*policy.TimeoutSeconds) * time.Second
+		}
+		if policy.Retries != nil {
+			retries = *policy.Retries
+		}
+		if policy.BackoffSeconds != nil {
+			backoff = time.Duration(*policy.BackoffSeconds) * time.Second
+		}
+	}
+	return timeout, retries, backoff
+}
+
+// noteConfigureStarted counts a new attempt at the initial configuration of
+// a member.
+func noteConfigureStarted(
+	stateDetail *kdv1.MemberStateDetail,
+) {
+
+	if stateDetail.Configure == nil {
+		stateDetail.Configure = &kdv1.ConfigureStatus{}
+	}
+	now := metav1.Now()
+	stateDetail.SetupAttempts++
+	stateDetail.Configure.Attempts++
+	stateDetail.Configure.Started = &now
+	stateDetail.Configure.RetryAfter = nil
+}
+
+// noteConfigureFinished marks the current attempt at the initial
+// configuration of a member, if any, as no longer running.
+func noteConfigureFinished(
+	stateDetail *kdv1.MemberStateDetail,
+) {
+
+	if stateDetail.Configure != nil {
+		stateDetail.Configure.Started = nil
+	}
+}
+
+// configureRetryWaiting reports whether the member is waiting out the
+// backoff before its next attempt at initial configuration.
+func configureRetryWaiting(
+	stateDetail *kdv1.MemberStateDetail,
+) bool {
+
+	status := stateDetail.Configure
+	return (status != nil) && (status.RetryAfter != nil) &&
+		time.Now().Before(status.RetryAfter.Time)
+}
+
+// checkConfigureTimeout looks at a configure run that is still going in the
+// member. If it has run longer than the role's configure timeout, the run
+// is stopped and an error is returned. Runs not started by an attempt at
+// initial configuration, such as upgrade runs, are not limited.
+func checkConfigureTimeout(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorCluster,
+	podName string,
+	containerID string,
+	stateDetail *kdv1.MemberStateDetail,
+	roleName string,
+) error {
+
+	status := stateDetail.Configure
+	if (status == nil) || (status.Started == nil) {
+		return nil
+	}
+	timeout, _, _ := configurePolicy(cr, roleName)
+	if (timeout == 0) || (time.Since(status.Started.Time) < timeout) {
+		return nil
+	}
+	stopErr := executor.RunScript(
+		reqLogger,
+		cr,
+		cr.Namespace,
+		podName,
+		containerID,
+		executor.AppContainerName,
+		"app config stop",
+		strings.NewReader(appPrepConfigStopCmd),
+	)
+	if stopErr != nil {
+		// Not fatal; the next attempt starts over in any case.
+		shared.LogErrorf(
+			reqLogger,
+			stopErr,
+			cr,
+			shared.EventReasonNoEvent,
+			"failed to stop timed-out setup in member{%s}",
+			podName,
+		)
+	}
+	noteConfigureFinished(stateDetail)
+	return fmt.Errorf("configure did not finish within %v", timeout)
+}
+
+// scheduleConfigureRetry records a failed attempt at the initial
+// configuration of a member. It returns true if the role's configure policy
+// allows another attempt, which is then scheduled after a backoff that
+// doubles with each attempt.
+func scheduleConfigureRetry(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorCluster,
+	roleName string,
+	podName string,
+	stateDetail *kdv1.MemberStateDetail,
+	configErr error,
+) bool {
+
+	if stateDetail.Configure == nil {
+		stateDetail.Configure = &kdv1.ConfigureStatus{}
+	}
+	status := stateDetail.Configure
+	if status.Attempts == 0 {
+		// The attempt failed before it was counted.
+		status.Attempts = 1
+	}
+	status.Started = nil
+	status.LastError = configErr.Error()
+	stateDetail.LastConfigureError = status.LastError
+	_, retries, backoff := configurePolicy(cr, roleName)
+	if status.Attempts > retries {
+		return false
+	}
+	for i := int32(1); (i < status.Attempts) && (backoff < maxConfigureBackoff); i++ {
+		backoff *= 2
+	}
+	if backoff > maxConfigureBackoff {
+		backoff = maxConfigureBackoff
+	}
+	retryAfter := metav1.NewTime(time.Now().Add(backoff))
+	status.RetryAfter = &retryAfter
+	shared.LogInfof(
+		reqLogger,
+		cr,
+		shared.EventReasonMember,
+		"retrying initial config for member{%s} in role{%s} in %v",
+		podName,
+		roleName,
+		backoff,
+	)
+	return true
+}
@@ -0,0 +1,214 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubedirectorcluster
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	"github.com/bluek8s/kubedirector/pkg/catalog"
+	"github.com/bluek8s/kubedirector/pkg/shared"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// databaseProbe tracks the probing of the database connections of one
+// cluster. The probes run in the background, so that the reconciler never
+// waits on a dial; targets identifies the probed connections, so that a
+// change to them discards any earlier result.
+type databaseProbe struct {
+	targets     string
+	running     bool
+	checked     bool
+	checkedAt   time.Time
+	unreachable []string
+}
+
+var (
+	databaseProbes     = make(map[types.UID]*databaseProbe)
+	databaseProbesLock sync.Mutex
+)
+
+// checkDatabaseConnections looks at the latest probe results for the
+// database connections that request probing, starting a new round of
+// probes in the background if the results are missing or stale, and
+// updates the cluster's ConnectionsUnreachable condition from them.
+// Returns false if any probed database could not be reached, or has not
+// been probed yet, in which case members should not be configured (or
+// notified of connection changes) yet.
+func checkDatabaseConnections(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorCluster,
+) bool {
+
+	var probed []kdv1.DatabaseConnection
+	var targets []string
+	for _, conn := range cr.Spec.Connections.Databases {
+		if (conn.Probe == nil) || !*conn.Probe {
+			continue
+		}
+		probed = append(probed, conn)
+		targets = append(targets, conn.Name+"="+databaseAddress(conn))
+	}
+	if len(probed) == 0 {
+		forgetDatabaseProbes(cr)
+		shared.SetCondition(
+			&cr.Status.Conditions,
+			kdv1.ClusterConnectionsUnreachable,
+			corev1.ConditionFalse,
+			"",
+			"",
+		)
+		return true
+	}
+
+	databaseProbesLock.Lock()
+	defer databaseProbesLock.Unlock()
+	probe, ok := databaseProbes[cr.UID]
+	if !ok || (probe.targets != strings.Join(targets, ",")) {
+		probe = &databaseProbe{targets: strings.Join(targets, ",")}
+		databaseProbes[cr.UID] = probe
+	}
+	if !probe.running &&
+		(!probe.checked || (time.Since(probe.checkedAt) >= databaseProbePeriod)) {
+		probe.running = true
+		go runDatabaseProbes(probe, probed)
+	}
+	if !probe.checked {
+		return false
+	}
+
+	if len(probe.unreachable) == 0 {
+		shared.SetCondition(
+			&cr.Status.Conditions,
+			kdv1.ClusterConnectionsUnreachable,
+			corev1.ConditionFalse,
+			"",
+			"",
+		)
+		return true
+	}
+	message := fmt.Sprintf(
+		"%d database connection(s) unreachable; %s",
+		len(probe.unreachable),
+		strings.Join(probe.unreachable, "; "),
+	)
+	if !shared.ConditionIsTrue(cr.Status.Conditions, kdv1.ClusterConnectionsUnreachable) {
+		shared.LogInfof(
+			reqLogger,
+			cr,
+			shared.EventReasonCluster,
+			"holding member configuration: %s",
+			message,
+		)
+	}
+	shared.SetCondition(
+		&cr.Status.Conditions,
+		kdv1.ClusterConnectionsUnreachable,
+		corev1.ConditionTrue,
+		"DatabaseUnreachable",
+		message,
+	)
+	return false
+}
+
+// runDatabaseProbes probes the given database connections concurrently and
+// records the result in the given probe state.
+func runDatabaseProbes(
+	probe *databaseProbe,
+	conns []kdv1.DatabaseConnection,
+) {
+
+	var wg sync.WaitGroup
+	var resultsLock sync.Mutex
+	var unreachable []string
+	wg.Add(len(conns))
+	for _, conn := range conns {
+		go func(c kdv1.DatabaseConnection) {
+			defer wg.Done()
+			if probeErr := probeDatabase(c); probeErr != nil {
+				resultsLock.Lock()
+				unreachable = append(unreachable, c.Name+": "+probeErr.Error())
+				resultsLock.Unlock()
+			}
+		}(conn)
+	}
+	wg.Wait()
+	sort.Strings(unreachable)
+
+	databaseProbesLock.Lock()
+	defer databaseProbesLock.Unlock()
+	probe.running = false
+	probe.checked = true
+	probe.checkedAt = time.Now()
+	probe.unreachable = unreachable
+}
+
+// databaseProbeRunning reports whether a round of probes of the cluster's
+// database connections is in progress.
+func databaseProbeRunning(
+	cr *kdv1.KubeDirectorCluster,
+) bool {
+
+	databaseProbesLock.Lock()
+	defer databaseProbesLock.Unlock()
+	if probe, ok := databaseProbes[cr.UID]; ok {
+		return probe.running
+	}
+	return false
+}
+
+// forgetDatabaseProbes drops any probe state for a cluster.
+func forgetDatabaseProbes(
+	cr *kdv1.KubeDirectorCluster,
+) {
+
+	databaseProbesLock.Lock()
+	defer databaseProbesLock.Unlock()
+	delete(databaseProbes, cr.UID)
+}
+
+// databaseAddress returns the host:port address of the given database.
+func databaseAddress(
+	conn kdv1.DatabaseConnection,
+) string {
+
+	return net.JoinHostPort(
+		conn.Host,
+		strconv.Itoa(int(catalog.DatabasePort(conn))),
+	)
+}
+
+// probeDatabase checks whether a TCP connection can be opened to the given
+// database from the KubeDirector pod. This does not attempt a login; it is
+// just meant to catch a database that is down or not yet provisioned.
+func probeDatabase(
+	conn kdv1.DatabaseConnection,
+) error {
+
+	netConn, dialErr := net.DialTimeout("tcp", databaseAddress(conn), databaseProbeTimeout)
+	if dialErr != nil {
+		return dialErr
+	}
+	netConn.Close()
+	return nil
+}
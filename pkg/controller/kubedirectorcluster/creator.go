@@ -0,0 +1,53 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubedirectorcluster
+
+import (
+	"github.com/go-logr/logr"
+
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	"github.com/bluek8s/kubedirector/pkg/shared"
+)
+
+// syncCreator records the creator of the cluster, as captured at admission
+// in the creator annotation, in the cluster status and (once) in the audit
+// history. Clusters created before the creator was captured have no
+// creator.
+func syncCreator(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorCluster,
+) {
+
+	if cr.Status.Creator != "" {
+		return
+	}
+	userInfo, userErr := shared.ClusterCreator(cr)
+	if userErr != nil {
+		shared.LogErrorf(
+			reqLogger,
+			userErr,
+			cr,
+			shared.EventReasonNoEvent,
+			"failed to decode %s annotation",
+			shared.CreatorAnnotation,
+		)
+		return
+	}
+	if (userInfo == nil) || (userInfo.Username == "") {
+		return
+	}
+	cr.Status.Creator = userInfo.Username
+	addAuditRecord(cr, kdv1.AuditClusterCreated, userInfo.Username, "")
+}
@@ -0,0 +1,169 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubedirectorcluster
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	"github.com/bluek8s/kubedirector/pkg/executor"
+	"github.com/bluek8s/kubedirector/pkg/shared"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// syncDebugMode compares the debug mode request annotations on the CR with
+// the debug mode recorded in the status, and starts, extends, or ends debug
+// mode accordingly. Each such transition is recorded in the audit history.
+// The statefulsets pick up the change when their config is reconciled.
+// Request annotations that have lapsed are removed from the CR.
+func syncDebugMode(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorCluster,
+) {
+
+	expires, requested := debugRequestExpiry(cr)
+	user := cr.Annotations[shared.DebugUserAnnotation]
+	active := requested && time.Now().Before(expires.Time)
+
+	switch {
+	case active && (cr.Status.DebugExpires == nil):
+		shared.LogInfof(
+			reqLogger,
+			cr,
+			shared.EventReasonCluster,
+			"debug mode enabled by %s until %s",
+			user,
+			expires.UTC().Format(time.RFC3339),
+		)
+		cr.Status.DebugExpires = &expires
+		addAuditRecord(
+			cr,
+			kdv1.AuditDebugEnabled,
+			user,
+			fmt.Sprintf("until %s", expires.UTC().Format(time.RFC3339)),
+		)
+	case active && !cr.Status.DebugExpires.Equal(&expires):
+		shared.LogInfof(
+			reqLogger,
+			cr,
+			shared.EventReasonCluster,
+			"debug mode changed by %s to end at %s",
+			user,
+			expires.UTC().Format(time.RFC3339),
+		)
+		cr.Status.DebugExpires = &expires
+		addAuditRecord(
+			cr,
+			kdv1.AuditDebugExtended,
+			user,
+			fmt.Sprintf("until %s", expires.UTC().Format(time.RFC3339)),
+		)
+	case !active && (cr.Status.DebugExpires != nil):
+		detail := "turned off"
+		if requested {
+			detail = "expired"
+		} else {
+			// Whoever removed the request is not known.
+			user = ""
+		}
+		shared.LogInfof(
+			reqLogger,
+			cr,
+			shared.EventReasonCluster,
+			"debug mode %s",
+			detail,
+		)
+		cr.Status.DebugExpires = nil
+		addAuditRecord(cr, kdv1.AuditDebugEnded, user, detail)
+	}
+
+	if active || !hasDebugAnnotations(cr) {
+		return
+	}
+	removeErr := executor.RemoveDebugAnnotations(reqLogger, cr)
+	if removeErr != nil {
+		shared.LogError(
+			reqLogger,
+			removeErr,
+			cr,
+			shared.EventReasonNoEvent,
+			"failed to remove debug mode annotations",
+		)
+	}
+}
+
+// debugRequestExpiry returns the expiry time of the debug mode request on
+// the CR. The boolean return is false if there is no valid request.
+func debugRequestExpiry(
+	cr *kdv1.KubeDirectorCluster,
+) (metav1.Time, bool) {
+
+	if _, ok := cr.Annotations[shared.DebugTTLAnnotation]; !ok {
+		return metav1.Time{}, false
+	}
+	expiresStr, ok := cr.Annotations[shared.DebugExpiresAnnotation]
+	if !ok {
+		return metav1.Time{}, false
+	}
+	expires, parseErr := time.Parse(time.RFC3339, expiresStr)
+	if parseErr != nil {
+		return metav1.Time{}, false
+	}
+	return metav1.NewTime(expires), true
+}
+
+// hasDebugAnnotations reports whether any of the debug mode request
+// annotations are on the CR.
+func hasDebugAnnotations(
+	cr *kdv1.KubeDirectorCluster,
+) bool {
+
+	for _, key := range []string{
+		shared.DebugTTLAnnotation,
+		shared.DebugExpiresAnnotation,
+		shared.DebugUserAnnotation,
+	} {
+		if _, ok := cr.Annotations[key]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// addAuditRecord appends a record to the audit history in the cluster
+// status, discarding the oldest records beyond maxAuditHistory.
+func addAuditRecord(
+	cr *kdv1.KubeDirectorCluster,
+	action string,
+	user string,
+	detail string,
+) {
+
+	cr.Status.AuditHistory = append(
+		cr.Status.AuditHistory,
+		kdv1.AuditRecord{
+			Time:   metav1.Now(),
+			Action: action,
+			User:   user,
+			Detail: detail,
+		},
+	)
+	if excess := len(cr.Status.AuditHistory) - maxAuditHistory; excess > 0 {
+		cr.Status.AuditHistory = cr.Status.AuditHistory[excess:]
+	}
+}
@@ -0,0 +1,226 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubedirectorcluster
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	"github.com/bluek8s/kubedirector/pkg/catalog"
+	"github.com/bluek8s/kubedirector/pkg/executor"
+	"github.com/bluek8s/kubedirector/pkg/shared"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// decommissionTimeout returns how long the members leaving the given role
+// are given to decommission, or zero if the app does not ask for the
+// decommission event. Like the upgrade event, it must be explicitly listed
+// in the role's eventList, since older setup packages do not handle it.
+func decommissionTimeout(
+	cr *kdv1.KubeDirectorCluster,
+	roleName string,
+) time.Duration {
+
+	appCr, appErr := catalog.GetApp(cr)
+	if appErr != nil {
+		return 0
+	}
+	appRole := catalog.GetRoleFromID(appCr, roleName)
+	if (appRole == nil) || (appRole.EventList == nil) ||
+		!shared.StringInList(decommissionEvent, *appRole.EventList) {
+		return 0
+	}
+	if appRole.DecommissionTimeoutSeconds != nil {
+		return time.Duration(*appRole.DecommissionTimeoutSeconds) * time.Second
+	}
+	return defaultDecommissionTimeout
+}
+
+// decommissionMembers runs the decommission hook on the delete pending
+// members of the role, and checks on the ones where it is already running.
+// It returns true once every such member has either succeeded or run out
+// of time, at which point the members can go on to be deleted.
+func decommissionMembers(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorCluster,
+	role *roleInfo,
+) bool {
+
+	timeout := decommissionTimeout(cr, role.roleStatus.Name)
+	if timeout == 0 {
+		return true
+	}
+	leaving := role.membersByState[memberDeletePending]
+	fqdns := fqdnsList(cr, role.roleStatus.Name, leaving)
+	allDone := true
+	for _, member := range leaving {
+		if !decommissionMember(reqLogger, cr, role, member, fqdns, timeout) {
+			allDone = false
+		}
+	}
+	return allDone
+}
+
+// decommissionMember starts or checks on the decommission hook in one
+// leaving member, recording its progress in the member status. A member
+// that was never configured has nothing to decommission. A failed hook
+// holds the member until the timeout, to give an operator the chance to
+// act before the member's data is gone.
+func decommissionMember(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorCluster,
+	role *roleInfo,
+	member *kdv1.MemberStatus,
+	fqdns string,
+	timeout time.Duration,
+) bool {
+
+	containerID := member.StateDetail.LastConfiguredContainer
+	if containerID == "" {
+		return true
+	}
+	status := member.StateDetail.Decommission
+	if status == nil {
+		member.StateDetail.Decommission = &kdv1.DecommissionStatus{
+			State:   decommissionRunning,
+			Started: metav1.Now(),
+		}
+		status = member.StateDetail.Decommission
+		cmd := fmt.Sprintf(
+			appPrepConfigDecommissionCmd,
+			containerID,
+			quotedHookPrefix(cr, role.roleStatus.Name),
+			"--role "+role.roleStatus.Name+" --fqdns "+fqdns,
+		)
+		cmdErr := executor.RunScript(
+			reqLogger,
+			cr,
+			cr.Namespace,
+			member.Pod,
+			containerID,
+			executor.AppContainerName,
+			"app decommission",
+			strings.NewReader(cmd),
+		)
+		if cmdErr != nil {
+			status.State = decommissionFailed
+			status.Message = cmdErr.Error()
+			shared.LogErrorf(
+				reqLogger,
+				cmdErr,
+				cr,
+				shared.EventReasonMemberDecommissionFailed,
+				"failed to start decommission of member{%s}",
+				member.Pod,
+			)
+			return false
+		}
+		shared.LogInfof(
+			reqLogger,
+			cr,
+			shared.EventReasonMemberDecommissioning,
+			"decommissioning member{%s}",
+			member.Pod,
+		)
+		return false
+	}
+	if (status.State == decommissionSucceeded) || (status.State == decommissionTimedOut) {
+		return true
+	}
+	if status.State == decommissionRunning {
+		checkDecommission(reqLogger, cr, member, containerID)
+		if status.State == decommissionSucceeded {
+			shared.LogInfof(
+				reqLogger,
+				cr,
+				shared.EventReasonMemberDecommissioned,
+				"member{%s} decommissioned",
+				member.Pod,
+			)
+			return true
+		}
+	}
+	if time.Since(status.Started.Time) < timeout {
+		return false
+	}
+	shared.LogInfof(
+		reqLogger,
+		cr,
+		shared.EventReasonMemberDecommissionFailed,
+		"decommission of member{%s} did not succeed within %v; deleting it anyway",
+		member.Pod,
+		timeout,
+	)
+	status.State = decommissionTimedOut
+	return true
+}
+
+// checkDecommission reads the status file of a running decommission hook
+// and updates the member's decommission status if the hook has finished.
+func checkDecommission(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorCluster,
+	member *kdv1.MemberStatus,
+	containerID string,
+) {
+
+	status := member.StateDetail.Decommission
+	readFile := func(filePath string) (string, bool) {
+		var strB strings.Builder
+		fileExists, fileError := executor.ReadFile(
+			reqLogger,
+			cr,
+			cr.Namespace,
+			member.Pod,
+			containerID,
+			executor.AppContainerName,
+			filePath,
+			&strB,
+		)
+		return strB.String(), fileExists && (fileError == nil)
+	}
+	statusStr, ok := readFile(appPrepDecommissionStatus)
+	if !ok {
+		// Either the member is unreachable right now or it has restarted
+		// and lost the hook; the timeout takes care of both.
+		return
+	}
+	splitPoint := strings.LastIndex(statusStr, "=")
+	if (splitPoint == -1) || (statusStr[splitPoint+1:] == "") {
+		return
+	}
+	exitStatus, convErr := strconv.Atoi(statusStr[splitPoint+1:])
+	if (convErr == nil) && (exitStatus == 0) {
+		status.State = decommissionSucceeded
+		return
+	}
+	status.State = decommissionFailed
+	status.Message = "decommission failed"
+	if stderr, stderrOk := readFile(appPrepDecommissionStderr); stderrOk {
+		status.Message = shared.GetLastLines(stderr, shared.DefaultMaxLogSizeDump)
+	}
+	shared.LogInfof(
+		reqLogger,
+		cr,
+		shared.EventReasonMemberDecommissionFailed,
+		"decommission of member{%s} failed; holding it until the timeout",
+		member.Pod,
+	)
+}
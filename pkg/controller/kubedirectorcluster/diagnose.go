@@ -0,0 +1,434 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubedirectorcluster
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	"github.com/bluek8s/kubedirector/pkg/observer"
+	"github.com/bluek8s/kubedirector/pkg/shared"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// benignWaitingReasons are container waiting reasons that are a normal part
+// of pod startup and so are not interesting as a pending diagnosis.
+var benignWaitingReasons = []string{
+	"ContainerCreating",
+	"PodInitializing",
+}
+
+// crashLoopWaitingReason is the container waiting reason given while K8s
+// backs off before starting a repeatedly failing container again.
+const crashLoopWaitingReason = "CrashLoopBackOff"
+
+// imagePullWaitingReasons are container waiting reasons that indicate a
+// problem getting the container image.
+var imagePullWaitingReasons = []string{
+	"ErrImagePull",
+	"ImagePullBackOff",
+	"InvalidImageName",
+	"ErrImageNeverPull",
+}
+
+// pendingEventKey identifies a member pod of a cluster.
+type pendingEventKey struct {
+	cluster types.UID
+	pod     string
+}
+
+// pendingEventCheck remembers the outcome of the last look at the events of
+// a pending pod whose status does not say why it is pending, so that the
+// events are only listed again when the pod's conditions change or the
+// result gets old.
+type pendingEventCheck struct {
+	podUID    types.UID
+	since     metav1.Time
+	checkedAt time.Time
+	reason    string
+}
+
+var (
+	pendingEventChecks     = make(map[pendingEventKey]*pendingEventCheck)
+	pendingEventChecksLock sync.Mutex
+)
+
+// diagnosePendingPod returns a human-readable explanation of why the given
+// member pod of the cluster is stuck in the Pending phase, or the empty
+// string if the pod is not pending or no particular reason can be found.
+// The pod's own status is consulted first; if that is not informative, the
+// most recent warning event about the pod since its conditions last changed
+// is used.
+func diagnosePendingPod(
+	cr *kdv1.KubeDirectorCluster,
+	pod *corev1.Pod,
+) string {
+
+	if pod.Status.Phase != corev1.PodPending {
+		forgetPendingEventCheck(cr, pod.Name)
+		return ""
+	}
+
+	// Scheduling problems.
+	for _, condition := range pod.Status.Conditions {
+		if (condition.Type != corev1.PodScheduled) ||
+			(condition.Status != corev1.ConditionFalse) ||
+			(condition.Reason != corev1.PodReasonUnschedulable) {
+			continue
+		}
+		switch {
+		case strings.Contains(condition.Message, "Insufficient"):
+			return "insufficient resources to schedule: " + condition.Message
+		case strings.Contains(condition.Message, "unbound") &&
+			strings.Contains(condition.Message, "PersistentVolumeClaim"):
+			return "waiting for persistent volume claim to be bound: " + condition.Message
+		default:
+			return "cannot be scheduled: " + condition.Message
+		}
+	}
+
+	// Container start problems, including image pulls.
+	allStatuses := append(
+		append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...),
+		pod.Status.ContainerStatuses...,
+	)
+	for _, containerStatus := range allStatuses {
+		waiting := containerStatus.State.Waiting
+		if (waiting == nil) || (waiting.Reason == "") {
+			continue
+		}
+		if shared.StringInList(waiting.Reason, benignWaitingReasons) {
+			continue
+		}
+		if shared.StringInList(waiting.Reason, imagePullWaitingReasons) {
+			return fmt.Sprintf(
+				"cannot pull image(%s) for container(%s): %s: %s",
+				containerStatus.Image,
+				containerStatus.Name,
+				waiting.Reason,
+				waiting.Message,
+			)
+		}
+		return fmt.Sprintf(
+			"container(%s) waiting: %s: %s",
+			containerStatus.Name,
+			waiting.Reason,
+			waiting.Message,
+		)
+	}
+
+	// Fall back to the events, e.g. for volume attach/mount failures.
+	return pendingEventDiagnosis(cr, pod)
+}
+
+// pendingEventDiagnosis explains a pending pod from the most recent warning
+// event about it that was posted since its conditions last changed, which
+// leaves out the events of an earlier pod of the same name and problems
+// that the pod has since got past. The events are listed from K8s rather
+// than a cache, so they are only listed again when the pod's conditions
+// change or pendingEventCheckPeriod has passed since they were last read.
+func pendingEventDiagnosis(
+	cr *kdv1.KubeDirectorCluster,
+	pod *corev1.Pod,
+) string {
+
+	since := pod.CreationTimestamp
+	for _, condition := range pod.Status.Conditions {
+		if since.Before(&condition.LastTransitionTime) {
+			since = condition.LastTransitionTime
+		}
+	}
+	key := pendingEventKey{cluster: cr.UID, pod: pod.Name}
+	pendingEventChecksLock.Lock()
+	defer pendingEventChecksLock.Unlock()
+	check, ok := pendingEventChecks[key]
+	if ok && (check.podUID == pod.UID) && check.since.Equal(&since) &&
+		(time.Since(check.checkedAt) < pendingEventCheckPeriod) {
+		return check.reason
+	}
+	check = &pendingEventCheck{
+		podUID:    pod.UID,
+		since:     since,
+		checkedAt: time.Now(),
+	}
+	pendingEventChecks[key] = check
+	events, eventsErr := observer.GetPodEvents(pod)
+	if eventsErr != nil {
+		return ""
+	}
+	var latest *corev1.Event
+	for i := range events {
+		event := &(events[i])
+		if (event.Type != corev1.EventTypeWarning) || event.LastTimestamp.Before(&since) {
+			continue
+		}
+		if (latest == nil) || latest.LastTimestamp.Before(&event.LastTimestamp) {
+			latest = event
+		}
+	}
+	if latest != nil {
+		check.reason = latest.Reason + ": " + latest.Message
+	}
+	return check.reason
+}
+
+// forgetPendingEventCheck drops the remembered event check of the named
+// member pod of the cluster, if any.
+func forgetPendingEventCheck(
+	cr *kdv1.KubeDirectorCluster,
+	podName string,
+) {
+
+	pendingEventChecksLock.Lock()
+	defer pendingEventChecksLock.Unlock()
+	delete(pendingEventChecks, pendingEventKey{cluster: cr.UID, pod: podName})
+}
+
+// forgetPendingEventChecks drops the remembered event checks of the member
+// pods of a deleted cluster.
+func forgetPendingEventChecks(
+	cr *kdv1.KubeDirectorCluster,
+) {
+
+	pendingEventChecksLock.Lock()
+	defer pendingEventChecksLock.Unlock()
+	for key := range pendingEventChecks {
+		if key.cluster == cr.UID {
+			delete(pendingEventChecks, key)
+		}
+	}
+}
+
+// updatePendingDiagnosis sets the given member's pending reason from a
+// diagnosis of its pod.
+func updatePendingDiagnosis(
+	cr *kdv1.KubeDirectorCluster,
+	pod *corev1.Pod,
+	memberStatus *kdv1.MemberStatus,
+) {
+
+	reason := diagnosePendingPod(cr, pod)
+	if reason == "" {
+		memberStatus.StateDetail.PendingReason = nil
+	} else {
+		memberStatus.StateDetail.PendingReason = &reason
+	}
+}
+
+// updateMembersPendingCondition sets the cluster's MembersPending condition
+// according to whether any members currently have a pending reason.
+func updateMembersPendingCondition(
+	cr *kdv1.KubeDirectorCluster,
+) {
+
+	var pending []string
+	for _, roleStatus := range cr.Status.Roles {
+		for _, memberStatus := range roleStatus.Members {
+			if memberStatus.StateDetail.PendingReason != nil {
+				pending = append(
+					pending,
+					memberStatus.Pod+": "+*memberStatus.StateDetail.PendingReason,
+				)
+			}
+		}
+	}
+	if len(pending) == 0 {
+		shared.SetCondition(
+			&cr.Status.Conditions,
+			kdv1.ClusterMembersPending,
+			corev1.ConditionFalse,
+			"",
+			"",
+		)
+		return
+	}
+	shared.SetCondition(
+		&cr.Status.Conditions,
+		kdv1.ClusterMembersPending,
+		corev1.ConditionTrue,
+		"PodsPending",
+		fmt.Sprintf(
+			"%d member(s) pending; %s",
+			len(pending),
+			strings.Join(pending, "; "),
+		),
+	)
+}
+
+// updateImagePullStatus records any image pull failure currently reported
+// for the given member's pod, or clears the record if there is none. If the
+// same failure was already recorded, its original timestamp is preserved so
+// that we can tell how long it has been going on.
+func updateImagePullStatus(
+	pod *corev1.Pod,
+	memberStatus *kdv1.MemberStatus,
+) {
+
+	allStatuses := append(
+		append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...),
+		pod.Status.ContainerStatuses...,
+	)
+	for _, containerStatus := range allStatuses {
+		waiting := containerStatus.State.Waiting
+		if (waiting == nil) || !shared.StringInList(waiting.Reason, imagePullWaitingReasons) {
+			continue
+		}
+		since := metav1.Now()
+		previous := memberStatus.StateDetail.ImagePullError
+		if (previous != nil) && (previous.Image == containerStatus.Image) {
+			since = previous.Since
+		}
+		memberStatus.StateDetail.ImagePullError = &kdv1.ImagePullStatus{
+			Container: containerStatus.Name,
+			Image:     containerStatus.Image,
+			Reason:    waiting.Reason,
+			Message:   waiting.Message,
+			Since:     since,
+		}
+		return
+	}
+	memberStatus.StateDetail.ImagePullError = nil
+}
+
+// hasPersistentImagePullError returns true if any member of the given role
+// has had an image pull failure for at least imagePullErrorHaltThreshold.
+func hasPersistentImagePullError(
+	role *roleInfo,
+) bool {
+
+	if role.roleStatus == nil {
+		return false
+	}
+	for _, memberStatus := range role.roleStatus.Members {
+		pullError := memberStatus.StateDetail.ImagePullError
+		if pullError == nil {
+			continue
+		}
+		if time.Since(pullError.Since.Time) >= imagePullErrorHaltThreshold {
+			return true
+		}
+	}
+	return false
+}
+
+// updateMemberHealth sets the conditions of the given member, and records
+// the restarts of the containers of its pod. The pod is nil if the member
+// currently has none.
+func updateMemberHealth(
+	pod *corev1.Pod,
+	memberStatus *kdv1.MemberStatus,
+) {
+
+	var restarts []kdv1.ContainerRestarts
+	unschedulable := corev1.ConditionFalse
+	unschedulableMessage := ""
+	crashLooping := corev1.ConditionFalse
+	crashLoopingMessage := ""
+	notReady := corev1.ConditionFalse
+	notReadyReason := ""
+	notReadyMessage := ""
+	if pod != nil {
+		for _, condition := range pod.Status.Conditions {
+			switch condition.Type {
+			case corev1.PodScheduled:
+				if (condition.Status == corev1.ConditionFalse) &&
+					(condition.Reason == corev1.PodReasonUnschedulable) {
+					unschedulable = corev1.ConditionTrue
+					unschedulableMessage = condition.Message
+				}
+			case corev1.PodReady:
+				if (pod.Status.Phase == corev1.PodRunning) &&
+					(condition.Status != corev1.ConditionTrue) {
+					notReady = corev1.ConditionTrue
+					notReadyReason = condition.Reason
+					notReadyMessage = condition.Message
+				}
+			}
+		}
+		allStatuses := append(
+			append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...),
+			pod.Status.ContainerStatuses...,
+		)
+		for _, containerStatus := range allStatuses {
+			if containerStatus.RestartCount == 0 {
+				continue
+			}
+			containerRestarts := kdv1.ContainerRestarts{
+				Container: containerStatus.Name,
+				Count:     containerStatus.RestartCount,
+			}
+			if terminated := containerStatus.LastTerminationState.Terminated; terminated != nil {
+				finishedAt := terminated.FinishedAt
+				containerRestarts.LastExitCode = terminated.ExitCode
+				containerRestarts.LastReason = terminated.Reason
+				containerRestarts.LastFinishedAt = &finishedAt
+			}
+			restarts = append(restarts, containerRestarts)
+			waiting := containerStatus.State.Waiting
+			if (waiting != nil) && (waiting.Reason == crashLoopWaitingReason) {
+				crashLooping = corev1.ConditionTrue
+				crashLoopingMessage = fmt.Sprintf(
+					"container %s has restarted %d times, last exiting with code %d (%s)",
+					containerRestarts.Container,
+					containerRestarts.Count,
+					containerRestarts.LastExitCode,
+					containerRestarts.LastReason,
+				)
+			}
+		}
+	}
+	memberStatus.ContainerRestarts = restarts
+
+	shared.SetCondition(
+		&memberStatus.Conditions,
+		kdv1.MemberUnschedulable,
+		unschedulable,
+		corev1.PodReasonUnschedulable,
+		unschedulableMessage,
+	)
+	shared.SetCondition(
+		&memberStatus.Conditions,
+		kdv1.MemberCrashLooping,
+		crashLooping,
+		crashLoopWaitingReason,
+		crashLoopingMessage,
+	)
+	shared.SetCondition(
+		&memberStatus.Conditions,
+		kdv1.MemberNotReady,
+		notReady,
+		notReadyReason,
+		notReadyMessage,
+	)
+	configError := corev1.ConditionFalse
+	configErrorMessage := ""
+	if (memberStatus.State == string(memberConfigError)) &&
+		(memberStatus.StateDetail.ConfigErrorDetail != nil) {
+		configError = corev1.ConditionTrue
+		configErrorMessage = *memberStatus.StateDetail.ConfigErrorDetail
+	}
+	shared.SetCondition(
+		&memberStatus.Conditions,
+		kdv1.MemberConfigError,
+		configError,
+		"ConfigError",
+		configErrorMessage,
+	)
+}
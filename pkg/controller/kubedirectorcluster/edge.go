@@ -0,0 +1,62 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubedirectorcluster
+
+import (
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	"github.com/bluek8s/kubedirector/pkg/observer"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// edgeRole reports whether the given role of the cluster is an edge role.
+func edgeRole(
+	cr *kdv1.KubeDirectorCluster,
+	roleName string,
+) bool {
+
+	for i := range cr.Spec.Roles {
+		if cr.Spec.Roles[i].Name == roleName {
+			return cr.Spec.Roles[i].Edge != nil
+		}
+	}
+	return false
+}
+
+// memberNodeDisconnected reports whether the given pod of an edge role is on
+// a node that has stopped reporting to K8s. The pod status of such a member
+// is stale, so it says nothing about whether the member has failed; the
+// member agent keeps working from its local copy of configmeta until the
+// node reconnects.
+func memberNodeDisconnected(
+	cr *kdv1.KubeDirectorCluster,
+	roleName string,
+	pod *corev1.Pod,
+) bool {
+
+	if (pod.Spec.NodeName == "") || !edgeRole(cr, roleName) {
+		return false
+	}
+	node, nodeErr := observer.GetNode(pod.Spec.NodeName)
+	if nodeErr != nil {
+		// Can't tell; treat the pod status as current.
+		return false
+	}
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == corev1.NodeReady {
+			return condition.Status == corev1.ConditionUnknown
+		}
+	}
+	return false
+}
@@ -0,0 +1,59 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubedirectorcluster
+
+import (
+	"fmt"
+	"strings"
+
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	"github.com/bluek8s/kubedirector/pkg/extension"
+	"github.com/bluek8s/kubedirector/pkg/shared"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// updateExtensionFailedCondition sets the cluster's ExtensionFailed
+// condition according to whether any extension hooks have outstanding
+// failures for this cluster.
+func updateExtensionFailedCondition(
+	cr *kdv1.KubeDirectorCluster,
+) {
+
+	failures := extension.Failures(cr)
+	if len(failures) == 0 {
+		shared.SetCondition(
+			&cr.Status.Conditions,
+			kdv1.ClusterExtensionFailed,
+			corev1.ConditionFalse,
+			"",
+			"",
+		)
+		return
+	}
+	var descs []string
+	for _, failure := range failures {
+		descs = append(
+			descs,
+			fmt.Sprintf("%s %s: %s", failure.Extension, failure.Hook, failure.Message),
+		)
+	}
+	shared.SetCondition(
+		&cr.Status.Conditions,
+		kdv1.ClusterExtensionFailed,
+		corev1.ConditionTrue,
+		"HookFailed",
+		strings.Join(descs, "; "),
+	)
+}
@@ -0,0 +1,64 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubedirectorcluster
+
+import (
+	"fmt"
+	"strings"
+
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	"github.com/bluek8s/kubedirector/pkg/catalog"
+)
+
+// quotedHookPrefix is the role's hook prefix (see catalog.HookPrefix)
+// escaped for use inside a single-quoted shell string, as in the nohup
+// commands that start the startscript.
+func quotedHookPrefix(
+	cr *kdv1.KubeDirectorCluster,
+	roleName string,
+) string {
+
+	return strings.Replace(catalog.HookPrefix(cr, roleName), "'", `'\''`, -1)
+}
+
+// hookOwnershipCmd returns the commands, if any, to append to the setup
+// package install so that a startscript run as some other user or group can
+// still use the package directory.
+func hookOwnershipCmd(
+	cr *kdv1.KubeDirectorCluster,
+	roleName string,
+) string {
+
+	hook := catalog.HookExecution(cr, roleName)
+	if hook == nil {
+		return ""
+	}
+	if hook.RunAsUser != nil {
+		owner := fmt.Sprintf("%d", *hook.RunAsUser)
+		if hook.RunAsGroup != nil {
+			owner += fmt.Sprintf(":%d", *hook.RunAsGroup)
+		}
+		return fmt.Sprintf(" &&\n\tchown -R %s %s", owner, appPrepDir)
+	}
+	if hook.RunAsGroup != nil {
+		return fmt.Sprintf(
+			" &&\n\tchgrp -R %d %s && chmod g+rwx %s",
+			*hook.RunAsGroup,
+			appPrepDir,
+			appPrepDir,
+		)
+	}
+	return ""
+}
@@ -0,0 +1,173 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubedirectorcluster
+
+import (
+	"context"
+
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	"github.com/bluek8s/kubedirector/pkg/executor"
+	"github.com/bluek8s/kubedirector/pkg/observer"
+	"github.com/bluek8s/kubedirector/pkg/shared"
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+)
+
+// handleMemberIngress makes the Ingress or Routes of a member match the
+// ingress config: if Ingresses are configured and the member's role has
+// endpoints marked for ingress, a single Ingress with the name of the member
+// service; if Routes are configured, one Route per such endpoint. Objects of
+// the kind that is not configured are deleted if KubeDirector owns them.
+// Failures are not reconciler-stopping errors; we'll just try again next
+// time.
+func handleMemberIngress(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorCluster,
+	role *roleInfo,
+	member *kdv1.MemberStatus,
+) {
+
+	if role.roleSpec == nil {
+		return
+	}
+	endpoints, endpointsErr := executor.IngressEndpoints(cr, role.roleStatus.Name)
+	if endpointsErr != nil {
+		shared.LogErrorf(
+			reqLogger,
+			endpointsErr,
+			cr,
+			shared.EventReasonNoEvent,
+			"failed to find ingress endpoints for role{%s}",
+			role.roleStatus.Name,
+		)
+		return
+	}
+	if len(endpoints) == 0 {
+		return
+	}
+	config := shared.GetIngressConfig()
+	wantIngress := (config != nil) && !config.Routes
+	wantRoutes := (config != nil) && config.Routes
+
+	logErr := func(err error, kind string, name string) {
+		shared.LogErrorf(
+			reqLogger,
+			err,
+			cr,
+			shared.EventReasonMember,
+			"failed to sync %s{%s} for member{%s}",
+			kind,
+			name,
+			member.Pod,
+		)
+	}
+
+	ingress, ingressErr := observer.GetIngress(cr.Namespace, member.Service)
+	switch {
+	case (ingressErr != nil) && !errors.IsNotFound(ingressErr):
+		logErr(ingressErr, "ingress", member.Service)
+	case wantIngress:
+		desired := executor.MemberIngress(
+			config,
+			cr,
+			role.roleSpec,
+			member.Pod,
+			member.Service,
+			endpoints,
+		)
+		var syncErr error
+		if ingressErr != nil {
+			syncErr = createWithBackoff(
+				reqLogger,
+				cr,
+				"ingress for member{"+member.Pod+"}",
+				func() error {
+					return shared.Create(context.TODO(), desired)
+				},
+			)
+		} else {
+			syncErr = executor.UpdateIngress(reqLogger, cr, ingress, desired)
+		}
+		if syncErr != nil {
+			logErr(syncErr, "ingress", member.Service)
+		}
+	case (ingressErr == nil) && shared.OwnerReferencesPresent(cr, ingress.OwnerReferences):
+		deleteErr := shared.Delete(context.TODO(), ingress)
+		if (deleteErr != nil) && !errors.IsNotFound(deleteErr) {
+			logErr(deleteErr, "ingress", member.Service)
+		}
+	}
+
+	for _, endpoint := range endpoints {
+		name := executor.MemberRouteName(member.Service, endpoint.ID)
+		route, routeErr := observer.GetRoute(cr.Namespace, name)
+		switch {
+		case (routeErr != nil) && meta.IsNoMatchError(routeErr) && !wantRoutes:
+			// Not OpenShift, and we don't want Routes anyway.
+		case (routeErr != nil) && !errors.IsNotFound(routeErr):
+			logErr(routeErr, "route", name)
+		case wantRoutes:
+			desired := executor.MemberRoute(
+				config,
+				cr,
+				role.roleSpec,
+				member.Pod,
+				member.Service,
+				endpoint,
+			)
+			var syncErr error
+			if routeErr != nil {
+				syncErr = createWithBackoff(
+					reqLogger,
+					cr,
+					"route for member{"+member.Pod+"}",
+					func() error {
+						return shared.Create(context.TODO(), desired)
+					},
+				)
+			} else {
+				syncErr = executor.UpdateRoute(reqLogger, cr, route, desired)
+			}
+			if syncErr != nil {
+				logErr(syncErr, "route", name)
+			}
+		case (routeErr == nil) && shared.OwnerReferencesPresent(cr, route.GetOwnerReferences()):
+			deleteErr := shared.Delete(context.TODO(), route)
+			if (deleteErr != nil) && !errors.IsNotFound(deleteErr) {
+				logErr(deleteErr, "route", name)
+			}
+		}
+	}
+}
+
+// deleteMemberIngress removes the Ingress and Routes (if any) of a member
+// that is being deleted.
+func deleteMemberIngress(
+	cr *kdv1.KubeDirectorCluster,
+	role *roleInfo,
+	member *kdv1.MemberStatus,
+) error {
+
+	endpoints, endpointsErr := executor.IngressEndpoints(cr, role.roleStatus.Name)
+	if endpointsErr != nil {
+		return endpointsErr
+	}
+	var serviceIDs []string
+	for _, endpoint := range endpoints {
+		serviceIDs = append(serviceIDs, endpoint.ID)
+	}
+	return executor.DeleteMemberIngress(cr.Namespace, member.Service, serviceIDs)
+}
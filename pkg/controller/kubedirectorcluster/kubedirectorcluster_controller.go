@@ -21,6 +21,9 @@ import (
 
 	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
 	"github.com/bluek8s/kubedirector/pkg/shared"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 
 	"k8s.io/apimachinery/pkg/runtime"
@@ -65,7 +68,79 @@ func add(
 	}
 
 	// Watch for changes to primary resource KubeDirectorCluster.
-	err = c.Watch(&source.Kind{Type: &kdv1.KubeDirectorCluster{}}, &handler.EnqueueRequestForObject{})
+	err = c.Watch(
+		&source.Kind{Type: &kdv1.KubeDirectorCluster{}},
+		&handler.EnqueueRequestForObject{},
+		shared.FaultDelayPredicate,
+	)
+	if err != nil {
+		return err
+	}
+
+	// Watch for changes to owned statefulsets. Statefulsets that KubeDirector
+	// did not create are dropped by clusterLabelPredicate, and status-only
+	// churn is filtered out by statefulSetPredicate.
+	err = c.Watch(
+		&source.Kind{Type: &appsv1.StatefulSet{}},
+		&handler.EnqueueRequestForOwner{
+			IsController: true,
+			OwnerType:    &kdv1.KubeDirectorCluster{},
+		},
+		clusterLabelPredicate,
+		statefulSetPredicate,
+		shared.FaultDelayPredicate,
+	)
+	if err != nil {
+		return err
+	}
+
+	// Watch for changes to owned network policies, so that any drift from
+	// the generated rules is repaired promptly.
+	err = c.Watch(
+		&source.Kind{Type: &networkingv1.NetworkPolicy{}},
+		&handler.EnqueueRequestForOwner{
+			IsController: true,
+			OwnerType:    &kdv1.KubeDirectorCluster{},
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	// Watch for changes to member pods. These are owned by statefulsets
+	// rather than directly by the cluster, so map them back to the cluster
+	// through the cluster label. Pods without that label are dropped by
+	// clusterLabelPredicate before anything else is done with them, and
+	// condition flapping is filtered out by podPredicate.
+	err = c.Watch(
+		&source.Kind{Type: &corev1.Pod{}},
+		&handler.EnqueueRequestsFromMapFunc{ToRequests: podToClusterRequest},
+		clusterLabelPredicate,
+		podPredicate,
+		shared.FaultDelayPredicate,
+	)
+	if err != nil {
+		return err
+	}
+
+	// Also watch every event on member pods, without podPredicate, just to
+	// note which pods have changed. This lets each reconcile re-examine
+	// only the changed members instead of every member pod.
+	err = c.Watch(
+		&source.Kind{Type: &corev1.Pod{}},
+		podChangeTracker,
+		clusterLabelPredicate,
+	)
+	if err != nil {
+		return err
+	}
+
+	// Watch for changes to role scales, mapping them to the cluster that
+	// they target.
+	err = c.Watch(
+		&source.Kind{Type: &kdv1.KubeDirectorRoleScale{}},
+		&handler.EnqueueRequestsFromMapFunc{ToRequests: roleScaleToClusterRequest},
+	)
 	if err != nil {
 		return err
 	}
@@ -101,6 +176,7 @@ func (r *ReconcileKubeDirectorCluster) Reconcile(
 
 	reqLogger := log.WithValues("Request.Namespace", request.Namespace, "Request.Name", request.Name)
 	reconcileResult := reconcile.Result{RequeueAfter: reconcilePeriod}
+	start := time.Now()
 
 	// Fetch the KubeDirectorCluster instance.
 	cr := &kdv1.KubeDirectorCluster{}
@@ -126,6 +202,21 @@ func (r *ReconcileKubeDirectorCluster) Reconcile(
 	} else {
 		err = r.handleRestore(reqLogger, cr)
 	}
+	shared.ObserveReconcile("KubeDirectorCluster", start, err)
+
+	// If creation of child objects is backing off after failures, come
+	// back when the next attempt is due. An error is still returned as-is,
+	// so that it is reported and the request is requeued with the
+	// controller's own rate limiting.
+	if err == nil {
+		if wait := createRetryWait(cr); (wait > 0) && (wait < reconcilePeriod) {
+			reconcileResult.RequeueAfter = wait
+		}
+		// Likewise pick up the result of database probes in progress.
+		if databaseProbeRunning(cr) && (databaseProbeTimeout < reconcileResult.RequeueAfter) {
+			reconcileResult.RequeueAfter = databaseProbeTimeout
+		}
+	}
 
 	return reconcileResult, err
 }
@@ -0,0 +1,143 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubedirectorcluster
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	"github.com/bluek8s/kubedirector/pkg/executor"
+	"github.com/bluek8s/kubedirector/pkg/observer"
+	"github.com/bluek8s/kubedirector/pkg/shared"
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/errors"
+)
+
+// propagatedLabelsHash calculates a hash of the cluster CR labels that are
+// propagated to members, so that a change can be detected and pushed out in
+// configmeta. If no labels are propagated the hash is empty.
+func propagatedLabelsHash(
+	cr *kdv1.KubeDirectorCluster,
+) string {
+
+	labels := shared.PropagatedLabels(cr)
+	if len(labels) == 0 {
+		return ""
+	}
+	// Map keys are marshalled in sorted order, so this is stable.
+	labelsJSON, _ := json.Marshal(labels)
+	md5Sum := md5.Sum(labelsJSON)
+	return hex.EncodeToString(md5Sum[:])
+}
+
+// syncMemberPodLabels makes the propagated labels on every member pod match
+// the cluster CR. Failures are not reconciler-stopping errors; we'll just
+// try again next time.
+func syncMemberPodLabels(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorCluster,
+	roles []*roleInfo,
+) {
+
+	for _, role := range roles {
+		if (role.roleStatus == nil) || (role.roleSpec == nil) {
+			continue
+		}
+		for i := 0; i < len(role.roleStatus.Members); i++ {
+			member := &(role.roleStatus.Members[i])
+			if member.State == string(memberDeleting) {
+				continue
+			}
+			pod, podErr := observer.GetPod(cr.Namespace, member.Pod)
+			if podErr != nil {
+				if !errors.IsNotFound(podErr) {
+					shared.LogErrorf(
+						reqLogger,
+						podErr,
+						cr,
+						shared.EventReasonNoEvent,
+						"failed to find member{%s} in role{%s}",
+						member.Pod,
+						role.roleStatus.Name,
+					)
+				}
+				continue
+			}
+			labelsErr := executor.UpdatePodPropagatedLabels(
+				reqLogger,
+				cr,
+				role.roleSpec,
+				pod,
+			)
+			if labelsErr != nil {
+				shared.LogErrorf(
+					reqLogger,
+					labelsErr,
+					cr,
+					shared.EventReasonMember,
+					"failed to update labels on member{%s}",
+					member.Pod,
+				)
+			}
+		}
+	}
+}
+
+// syncMemberPVCMetadata makes the labels and annotations of every member's
+// PVCs match the pvcLabels and pvcAnnotations of its role, and repairs
+// their owner references. Failures are not reconciler-stopping errors;
+// we'll just try again next time.
+func syncMemberPVCMetadata(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorCluster,
+	roles []*roleInfo,
+) {
+
+	for _, role := range roles {
+		if (role.roleStatus == nil) || (role.roleSpec == nil) {
+			continue
+		}
+		for i := 0; i < len(role.roleStatus.Members); i++ {
+			member := &(role.roleStatus.Members[i])
+			if member.State == string(memberDeleting) {
+				continue
+			}
+			pvcNames := executor.MemberBlockPVCNames(role.roleSpec, member.Pod)
+			if member.PVC != "" {
+				pvcNames = append(pvcNames, member.PVC)
+			}
+			for _, pvcName := range pvcNames {
+				updateErr := executor.UpdatePVCMetadata(
+					reqLogger,
+					cr,
+					role.roleSpec,
+					pvcName,
+				)
+				if updateErr != nil {
+					shared.LogErrorf(
+						reqLogger,
+						updateErr,
+						cr,
+						shared.EventReasonMember,
+						"failed to update labels and annotations on PVC{%s}",
+						pvcName,
+					)
+				}
+			}
+		}
+	}
+}
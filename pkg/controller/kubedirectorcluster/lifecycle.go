@@ -0,0 +1,234 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubedirectorcluster
+
+import (
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	"github.com/bluek8s/kubedirector/pkg/executor"
+	"github.com/bluek8s/kubedirector/pkg/shared"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Stages of member provisioning, as reported in the member stage duration
+// metric. Each stage ends at the named lifecycle timestamp.
+const (
+	stageScheduling     = "scheduling"
+	stageStorageInit    = "storage_init"
+	stageContainerStart = "container_start"
+	stageAppConfig      = "app_config"
+	stageReadiness      = "readiness"
+	stageTotal          = "total"
+)
+
+// noteMemberCreated starts the lifecycle record of a new member.
+func noteMemberCreated(
+	cr *kdv1.KubeDirectorCluster,
+	roleName string,
+	m *kdv1.MemberStatus,
+) {
+
+	now := metav1.Now()
+	m.Lifecycle = &kdv1.MemberLifecycle{Created: &now}
+	shared.LogEventf(
+		cr,
+		corev1.EventTypeNormal,
+		shared.EventReasonMemberCreated,
+		"member{%s} created in role{%s}",
+		m.Pod,
+		roleName,
+	)
+}
+
+// noteMemberScheduled records, from the member's pod, when the pod was
+// scheduled and (for members with storage) when its storage was
+// initialized, if those have happened and were not already recorded.
+func noteMemberScheduled(
+	cr *kdv1.KubeDirectorCluster,
+	roleName string,
+	m *kdv1.MemberStatus,
+	pod *corev1.Pod,
+) {
+
+	if m.Lifecycle == nil {
+		return
+	}
+	lc := m.Lifecycle
+	if lc.Scheduled == nil {
+		if scheduled := podConditionTrueSince(pod, corev1.PodScheduled); scheduled != nil {
+			lc.Scheduled = scheduled
+			observeMemberStage(cr, roleName, stageScheduling, lc.Created, *scheduled)
+			shared.LogEventf(
+				cr,
+				corev1.EventTypeNormal,
+				shared.EventReasonMemberScheduled,
+				"member{%s} scheduled to node{%s}",
+				m.Pod,
+				pod.Spec.NodeName,
+			)
+		}
+	}
+	if (lc.StorageInitialized == nil) && (m.PVC != "") {
+		if initialized := executor.StorageInitFinished(pod); initialized != nil {
+			lc.StorageInitialized = initialized
+			observeMemberStage(cr, roleName, stageStorageInit, lc.Scheduled, *initialized)
+		}
+	}
+}
+
+// noteStorageInit keeps the init container's summary of the initial copy
+// onto the member's persistent storage, the first time that it is seen. The
+// summary outlives the pod, and the init container has removed the full
+// rsync log from the storage.
+func noteStorageInit(
+	cr *kdv1.KubeDirectorCluster,
+	m *kdv1.MemberStatus,
+	pod *corev1.Pod,
+) {
+
+	if (m.PVC == "") || (m.StateDetail.StorageInit != nil) {
+		return
+	}
+	summary := executor.StorageInitSummary(pod)
+	m.StateDetail.StorageInit = summary
+	if summary == nil {
+		return
+	}
+	if summary.ExitCode != 0 {
+		shared.LogEventf(
+			cr,
+			corev1.EventTypeWarning,
+			shared.EventReasonMemberStorageInitFailed,
+			"storage init of member{%s} by %s failed with exit code %d after %ds",
+			m.Pod,
+			summary.Method,
+			summary.ExitCode,
+			summary.Seconds,
+		)
+		return
+	}
+	shared.LogEventf(
+		cr,
+		corev1.EventTypeNormal,
+		shared.EventReasonMemberStorageInitialized,
+		"storage of member{%s} initialized by %s in %ds: %s",
+		m.Pod,
+		summary.Method,
+		summary.Seconds,
+		summary.Summary,
+	)
+}
+
+// noteMemberRunning records when the app container of the member started.
+func noteMemberRunning(
+	cr *kdv1.KubeDirectorCluster,
+	roleName string,
+	m *kdv1.MemberStatus,
+	containerStatus *corev1.ContainerStatus,
+) {
+
+	if (m.Lifecycle == nil) || (m.Lifecycle.Running != nil) {
+		return
+	}
+	lc := m.Lifecycle
+	running := metav1.Now()
+	if containerStatus.State.Running != nil {
+		running = containerStatus.State.Running.StartedAt
+	}
+	lc.Running = &running
+	previous := lc.Scheduled
+	if lc.StorageInitialized != nil {
+		previous = lc.StorageInitialized
+	}
+	observeMemberStage(cr, roleName, stageContainerStart, previous, running)
+}
+
+// noteMemberConfigured records when the initial app setup of the member
+// completed.
+func noteMemberConfigured(
+	cr *kdv1.KubeDirectorCluster,
+	roleName string,
+	m *kdv1.MemberStatus,
+) {
+
+	if (m.Lifecycle == nil) || (m.Lifecycle.Configured != nil) {
+		return
+	}
+	now := metav1.Now()
+	m.Lifecycle.Configured = &now
+	observeMemberStage(cr, roleName, stageAppConfig, m.Lifecycle.Running, now)
+}
+
+// noteMemberReady records, from the member's pod, when the configured
+// member's pod first became ready. This completes the lifecycle record.
+func noteMemberReady(
+	cr *kdv1.KubeDirectorCluster,
+	roleName string,
+	m *kdv1.MemberStatus,
+	pod *corev1.Pod,
+) {
+
+	if (m.Lifecycle == nil) || (m.Lifecycle.Configured == nil) || (m.Lifecycle.Ready != nil) {
+		return
+	}
+	ready := podConditionTrueSince(pod, corev1.PodReady)
+	if ready == nil {
+		return
+	}
+	// The condition may predate the configuration if the pod has no
+	// "configured" readiness gate.
+	if ready.Before(m.Lifecycle.Configured) {
+		ready = m.Lifecycle.Configured
+	}
+	m.Lifecycle.Ready = ready
+	observeMemberStage(cr, roleName, stageReadiness, m.Lifecycle.Configured, *ready)
+	observeMemberStage(cr, roleName, stageTotal, m.Lifecycle.Created, *ready)
+}
+
+// observeMemberStage publishes the duration of a member provisioning stage,
+// if the time at which the stage started is known.
+func observeMemberStage(
+	cr *kdv1.KubeDirectorCluster,
+	roleName string,
+	stage string,
+	start *metav1.Time,
+	end metav1.Time,
+) {
+
+	if start == nil {
+		return
+	}
+	duration := end.Sub(start.Time)
+	if duration < 0 {
+		duration = 0
+	}
+	shared.ObserveMemberStage(cr.Spec.AppID, roleName, stage, duration)
+}
+
+// podConditionTrueSince returns the time at which the given condition of
+// the pod last became true, or nil if it is not currently true.
+func podConditionTrueSince(
+	pod *corev1.Pod,
+	conditionType corev1.PodConditionType,
+) *metav1.Time {
+
+	for i := range pod.Status.Conditions {
+		condition := &(pod.Status.Conditions[i])
+		if (condition.Type == conditionType) && (condition.Status == corev1.ConditionTrue) {
+			return &condition.LastTransitionTime
+		}
+	}
+	return nil
+}
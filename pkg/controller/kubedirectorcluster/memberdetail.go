@@ -0,0 +1,108 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubedirectorcluster
+
+import (
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	"github.com/bluek8s/kubedirector/pkg/shared"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// memberStatusDetailName returns the name of the configmap that holds the
+// member statuses of the given role, when it has too many members to keep
+// them all in the cluster status. The role's statefulset name is already
+// unique and valid as an object name.
+func memberStatusDetailName(
+	roleStatus *kdv1.RoleStatus,
+) string {
+
+	return roleStatus.StatefulSet + "-members"
+}
+
+// steadyMember decides whether a member is in a steady state that does not
+// need to be visible in the cluster status itself: configured, running, and
+// with no errors, pending work, or true conditions.
+func steadyMember(
+	member *kdv1.MemberStatus,
+) bool {
+
+	if (member.Pod == "") || (member.State != string(memberReady)) {
+		return false
+	}
+	for _, condition := range member.Conditions {
+		if condition.Status == corev1.ConditionTrue {
+			return false
+		}
+	}
+	detail := &(member.StateDetail)
+	return (detail.LastKnownContainerState == containerRunning) &&
+		(detail.ConfiguringContainer == "") &&
+		(detail.ConfigErrorDetail == nil) &&
+		(len(detail.PendingNotifyCmds) == 0) &&
+		(detail.SchedulingErrorMessage == nil) &&
+		(detail.PendingReason == nil) &&
+		(detail.ImagePullError == nil)
+}
+
+// summarizeMemberStatus returns the form of the given cluster status that
+// should be written to K8s. For each role with more members than the
+// memberStatusDetailLimit of the KubeDirectorConfig, the steady-state
+// members are dropped from the returned role status and a member summary
+// is added in their place; the complete member list of the role is then
+// returned in the details map, keyed by the name of the configmap that
+// should hold it. The input status is not modified.
+func summarizeMemberStatus(
+	status *kdv1.KubeDirectorClusterStatus,
+) (*kdv1.KubeDirectorClusterStatus, map[string][]kdv1.MemberStatus) {
+
+	limit := int(shared.GetMemberStatusDetailLimit())
+	result := status.DeepCopy()
+	details := make(map[string][]kdv1.MemberStatus)
+	for i := range result.Roles {
+		roleStatus := &(result.Roles[i])
+		roleStatus.MemberSummary = nil
+		// Leave alone roles that are marked for removal, and any role if
+		// summaries are not enabled.
+		if (limit == 0) || (roleStatus.StatefulSet == "") {
+			continue
+		}
+		summary := &kdv1.MemberSummary{
+			States:          make(map[string]int32),
+			DetailConfigMap: memberStatusDetailName(roleStatus),
+		}
+		allMembers := make([]kdv1.MemberStatus, 0, len(roleStatus.Members))
+		unsteadyMembers := make([]kdv1.MemberStatus, 0)
+		for j := range roleStatus.Members {
+			member := &(roleStatus.Members[j])
+			// Members marked for removal will be compacted away anyway.
+			if member.Pod == "" {
+				continue
+			}
+			allMembers = append(allMembers, *member)
+			summary.Total++
+			summary.States[member.State]++
+			if !steadyMember(member) {
+				unsteadyMembers = append(unsteadyMembers, *member)
+			}
+		}
+		if len(allMembers) <= limit {
+			continue
+		}
+		roleStatus.Members = unsteadyMembers
+		roleStatus.MemberSummary = summary
+		details[summary.DetailConfigMap] = allMembers
+	}
+	return result, details
+}
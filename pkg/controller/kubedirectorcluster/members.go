@@ -16,6 +16,7 @@ package kubedirectorcluster
 
 import (
 	"bufio"
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
@@ -31,6 +32,7 @@ import (
 	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
 	"github.com/bluek8s/kubedirector/pkg/catalog"
 	"github.com/bluek8s/kubedirector/pkg/executor"
+	"github.com/bluek8s/kubedirector/pkg/extension"
 	"github.com/bluek8s/kubedirector/pkg/observer"
 	"github.com/bluek8s/kubedirector/pkg/shared"
 	corev1 "k8s.io/api/core/v1"
@@ -38,21 +40,38 @@ import (
 	"k8s.io/client-go/util/exec"
 )
 
-// syncMembers is responsible for adding or deleting members. It and
-// syncMemberNotifies are the only functions in this file that are invoked
-// from another file (from the syncCluster function in cluster.go). Along with
+// syncMembers is responsible for adding or deleting members. It,
+// syncMemberNotifies, and syncMemberReadiness are the only functions in this
+// file that are invoked from another file (from the syncCluster function in cluster.go). Along with
 // k8s interactions (changing statefulset replica count), this involves
 // creating notifications to existing members about additions/deletions,
 // injecting configmeta data into members, and triggering application setup.
 // This function will modify the member status data structures to update their
-// states.
+// states. If holdConfigure is true, members are only moved along toward
+// creation or deletion; no member is configured or given new configmeta.
 func syncMembers(
 	reqLogger logr.Logger,
 	cr *kdv1.KubeDirectorCluster,
 	roles []*roleInfo,
 	configmetaGenerator func(string) string,
+	holdConfigure bool,
 ) error {
 
+	if holdConfigure {
+		for _, r := range roles {
+			if _, ok := r.membersByState[memberCreatePending]; ok {
+				handleCreatePendingMembers(reqLogger, cr, r)
+			}
+			if _, ok := r.membersByState[memberDeletePending]; ok {
+				handleDeletePendingMembers(reqLogger, cr, r, roles)
+			}
+			if _, ok := r.membersByState[memberDeleting]; ok {
+				handleDeletingMembers(reqLogger, cr, r)
+			}
+		}
+		return nil
+	}
+
 	// Update configmeta in current ready members if necessary. These may not
 	// all succeed if any members are down. We'll return early if we fail to
 	// update any ready members or if there are rebooting members that will
@@ -131,9 +150,9 @@ func syncMembers(
 }
 
 // syncMemberNotifies is responsible processing any existing member
-// notification queues. It and syncMembers are the only functions in this file
-// that are invoked from another file (from the syncCluster function in
-// cluster.go). Along with executing the notify commands into members, this
+// notification queues. It, syncMembers, and syncMemberReadiness are the only
+// functions in this file that are invoked from another file (from the
+// syncCluster function in cluster.go). Along with executing the notify commands into members, this
 // function will modify the member status data structures to update their
 // notification queues.
 func syncMemberNotifies(
@@ -145,6 +164,7 @@ func syncMemberNotifies(
 	// whether they have any pending notifies.
 	var membersToProcess []*kdv1.MemberStatus
 	var membersSkippingNotifies []*kdv1.MemberStatus
+	hookPrefixes := make(map[*kdv1.MemberStatus]string)
 	transitionalMembers := false
 	numRoleStatuses := len(cr.Status.Roles)
 	for i := 0; i < numRoleStatuses; i++ {
@@ -158,6 +178,7 @@ func syncMemberNotifies(
 				if len(memberStatus.StateDetail.PendingNotifyCmds) != 0 {
 					// If it does, we'll need to process the notifies below.
 					membersToProcess = append(membersToProcess, memberStatus)
+					hookPrefixes[memberStatus] = catalog.HookPrefix(cr, roleStatus.Name)
 				} else if !transitionalMembers {
 					// If not, AND if there are no transitional-state members
 					// (who might be on their way to generating a notify),
@@ -196,7 +217,8 @@ func syncMemberNotifies(
 			defer wgReady.Done()
 			var newQueue []*kdv1.NotificationDesc
 			for _, notify := range m.StateDetail.PendingNotifyCmds {
-				cmd := appPrepStartscript + " " + strings.Join(notify.Arguments, " ")
+				cmd := hookPrefixes[m] + appPrepStartscript + " " +
+					strings.Join(notify.Arguments, " ")
 				notifyError := executor.RunScript(
 					reqLogger,
 					cr,
@@ -217,11 +239,19 @@ func syncMemberNotifies(
 						reqLogger,
 						notifyError,
 						cr,
-						shared.EventReasonMember,
+						shared.EventReasonMemberNotifyFailed,
 						"failed to notify member{%s} about member changes",
 						m.Pod,
 					)
 				} else {
+					shared.LogInfof(
+						reqLogger,
+						cr,
+						shared.EventReasonMemberNotified,
+						"notified member{%s} of %s",
+						m.Pod,
+						strings.Join(notify.Arguments, " "),
+					)
 					// Update the setup generation number if no transitional
 					// members are left to process. (We could omit this and
 					// let the next handler poll take care of it as a "skip
@@ -240,6 +270,83 @@ func syncMemberNotifies(
 	wgReady.Wait()
 }
 
+// syncMemberReadiness makes sure that the "configured" readiness gate
+// condition on each member pod reflects whether that member is currently in
+// the ready state. This keeps non-headless services from routing to members
+// whose app configuration has not completed, regardless of whether the app
+// provides its own readiness probe. Failures are logged and will be retried
+// on the next handler pass.
+func syncMemberReadiness(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorCluster,
+) {
+
+	if (cr.Status == nil) || (cr.DeletionTimestamp != nil) {
+		return
+	}
+	var members []*kdv1.MemberStatus
+	var memberRoles []string
+	numRoleStatuses := len(cr.Status.Roles)
+	for i := 0; i < numRoleStatuses; i++ {
+		roleStatus := &(cr.Status.Roles[i])
+		numMembers := len(roleStatus.Members)
+		for j := 0; j < numMembers; j++ {
+			memberStatus := &(roleStatus.Members[j])
+			if memberStatus.Pod == "" {
+				continue
+			}
+			members = append(members, memberStatus)
+			memberRoles = append(memberRoles, roleStatus.Name)
+		}
+	}
+	var wgReadiness sync.WaitGroup
+	wgReadiness.Add(len(members))
+	for i, member := range members {
+		go func(m *kdv1.MemberStatus, roleName string) {
+			defer wgReadiness.Done()
+			pod, podGetErr := observer.GetPod(cr.Namespace, m.Pod)
+			if podGetErr != nil {
+				// Pod not there (yet or anymore); nothing to do.
+				return
+			}
+			if m.State == string(memberReady) {
+				noteMemberReady(cr, roleName, m, pod)
+			}
+			if !executor.HasConfiguredReadinessGate(pod) {
+				return
+			}
+			// Only a ready member whose pod is running the container that
+			// we configured counts as configured.
+			configured := false
+			if m.State == string(memberReady) {
+				for _, containerStatus := range pod.Status.ContainerStatuses {
+					if containerStatus.Name == executor.AppContainerName {
+						configured = (containerStatus.ContainerID == m.StateDetail.LastConfiguredContainer)
+						break
+					}
+				}
+			}
+			updateErr := executor.UpdatePodConfiguredCondition(
+				reqLogger,
+				cr,
+				pod,
+				configured,
+			)
+			if updateErr != nil {
+				shared.LogErrorf(
+					reqLogger,
+					updateErr,
+					cr,
+					shared.EventReasonMember,
+					"failed to update readiness for member{%s}",
+					m.Pod,
+				)
+			}
+		}(member, memberRoles[i])
+	}
+	wgReadiness.Wait()
+}
+
 // https://github.com/bluek8s/kubedirector/issues/547
 // setStateDetailLogs sets the extracted results
 // of startscript executions
@@ -304,6 +411,8 @@ func handleReadyMembers(
 	for _, member := range ready {
 		go func(m *kdv1.MemberStatus) {
 			defer wgReady.Done()
+			// Install a renewed certificate if there is one.
+			refreshMemberCertificate(reqLogger, cr, role, m)
 			// If this pod never got configmeta (because it has no setup
 			// package), it doesn't need an update.
 			if m.StateDetail.LastConfigDataGeneration == nil {
@@ -314,6 +423,11 @@ func handleReadyMembers(
 			if *m.StateDetail.LastConfigDataGeneration == *cr.Status.SpecGenerationToProcess {
 				return
 			}
+			// An edge member that is out of contact will be updated once
+			// its node reconnects.
+			if m.StateDetail.LastKnownContainerState == containerDisconnected {
+				return
+			}
 			// Drop in the new configmeta.
 			configmeta := configmetaGenerator(m.Pod)
 			createFileErr := executor.CreateFile(
@@ -387,7 +501,11 @@ func handleReadyMembers(
 					return fileExists, fileError
 				}
 
-				cmd := fmt.Sprintf(appPrepConfigReconnectCmd, containerID)
+				cmd := fmt.Sprintf(
+					appPrepConfigReconnectCmd,
+					containerID,
+					quotedHookPrefix(cr, role.roleSpec.Name),
+				)
 
 				cmdErr := executor.RunScript(
 					reqLogger,
@@ -484,10 +602,13 @@ func handleCreatePendingMembers(
 				}
 				return
 			}
+			noteMemberScheduled(cr, role.roleStatus.Name, m, pod)
+			noteStorageInit(cr, m, pod)
 			if pod.Status.Phase == corev1.PodRunning {
-				for _, containerStatus := range pod.Status.ContainerStatuses {
+				for i, containerStatus := range pod.Status.ContainerStatuses {
 					if (containerStatus.Name == executor.AppContainerName) &&
 						(containerStatus.ContainerID != "") {
+						noteMemberRunning(cr, role.roleStatus.Name, m, &(pod.Status.ContainerStatuses[i]))
 						m.StateDetail.ConfiguringContainer = containerStatus.ContainerID
 						m.State = string(memberCreating)
 						// We don't need to update membersByState; the newly
@@ -543,6 +664,9 @@ func handleCreatingMembers(
 			setFinalState := func(state memberState, errorDetail *string) {
 				m.State = string(state)
 				m.StateDetail.ConfigErrorDetail = errorDetail
+				if state == memberReady {
+					noteMemberConfigured(cr, role.roleStatus.Name, m)
+				}
 			}
 
 			connectionVersion := getConnectionVersion(reqLogger, cr, role)
@@ -557,7 +681,7 @@ func handleCreatingMembers(
 						reqLogger,
 						injectErr,
 						cr,
-						shared.EventReasonMember,
+						shared.EventReasonMemberConfigFailed,
 						"failed to inject one or more files for member{%s} in role{%s}",
 						m.Pod,
 						role.roleStatus.Name,
@@ -566,17 +690,62 @@ func handleCreatingMembers(
 						"failed requested file injections: %s",
 						injectErr.Error(),
 					)
+					m.StateDetail.LastConfigureError = statusErrMsg
+					shared.CountSetupFailure(cr.Namespace, cr.Name, role.roleStatus.Name)
 					setFinalState(memberConfigError, &statusErrMsg)
 					return
 				}
 			}
 
+			// If member certificates are configured, wait for the member's
+			// certificate to be issued and install it.
+			certSecret, certReady, certErr := syncMemberCertificate(reqLogger, cr, role, m)
+			if certErr != nil {
+				shared.LogErrorf(
+					reqLogger,
+					certErr,
+					cr,
+					shared.EventReasonMember,
+					"failed to sync certificate for member{%s} in role{%s}",
+					m.Pod,
+					role.roleStatus.Name,
+				)
+				return
+			}
+			if !certReady {
+				shared.LogInfof(
+					reqLogger,
+					cr,
+					shared.EventReasonNoEvent,
+					"waiting for certificate for member{%s} in role{%s}",
+					m.Pod,
+					role.roleStatus.Name,
+				)
+				return
+			}
+			if certSecret != nil {
+				installErr := installMemberCertificate(reqLogger, cr, m, containerID, certSecret)
+				if installErr != nil {
+					shared.LogErrorf(
+						reqLogger,
+						installErr,
+						cr,
+						shared.EventReasonMember,
+						"failed to install certificate for member{%s} in role{%s}",
+						m.Pod,
+						role.roleStatus.Name,
+					)
+					return
+				}
+			}
+
 			if setupInfo == nil {
 				setFinalState(memberReady, nil)
+				m.StateDetail.ConfiguredImage = memberAppImage(cr, m.Pod)
 				shared.LogInfof(
 					reqLogger,
 					cr,
-					shared.EventReasonMember,
+					shared.EventReasonMemberConfigured,
 					"initial config skipped for member{%s} in role{%s}",
 					m.Pod,
 					role.roleStatus.Name,
@@ -584,6 +753,19 @@ func handleCreatingMembers(
 				return
 			}
 
+			// Hold off if a failed configuration is waiting to be retried.
+			if configureRetryWaiting(&m.StateDetail) {
+				shared.LogInfof(
+					reqLogger,
+					cr,
+					shared.EventReasonNoEvent,
+					"initial config of member{%s} in role{%s} waiting to retry",
+					m.Pod,
+					role.roleStatus.Name,
+				)
+				return
+			}
+
 			// Start or continue the initial configuration.
 			isFinal, configErr := appConfig(
 				reqLogger,
@@ -632,27 +814,40 @@ func handleCreatingMembers(
 					reqLogger,
 					configErr,
 					cr,
-					shared.EventReasonMember,
+					shared.EventReasonMemberConfigFailed,
 					"failed to run initial config for member{%s} in role{%s}",
 					m.Pod,
 					role.roleStatus.Name,
 				)
+				retrying := scheduleConfigureRetry(
+					reqLogger,
+					cr,
+					role.roleStatus.Name,
+					m.Pod,
+					&m.StateDetail,
+					configErr,
+				)
+				if retrying {
+					return
+				}
 				statusErrMsg := fmt.Sprintf(
 					"execution of app config failed: %s",
 					configErr.Error(),
 				)
+				shared.CountSetupFailure(cr.Namespace, cr.Name, role.roleStatus.Name)
 				setFinalState(memberConfigError, &statusErrMsg)
 				return
 			}
 			shared.LogInfof(
 				reqLogger,
 				cr,
-				shared.EventReasonMember,
+				shared.EventReasonMemberConfigured,
 				"initial config done for member{%s} in role{%s}",
 				m.Pod,
 				role.roleStatus.Name,
 			)
 			setFinalState(memberReady, nil)
+			m.StateDetail.ConfiguredImage = memberAppImage(cr, m.Pod)
 		}(member)
 	}
 	wgSetup.Wait()
@@ -674,6 +869,15 @@ func handleCreatingMembers(
 			member.StateDetail.ConfiguringContainer = ""
 		}
 	}
+
+	// Let any extensions know about the members that are now configured.
+	// This is done after the parallel setup is finished so that the hooks
+	// see a consistent cluster status.
+	for _, member := range creating {
+		if member.State == string(memberReady) {
+			extension.PostMemberConfigured(reqLogger, cr, role.roleStatus.Name, member)
+		}
+	}
 }
 
 // handleDeletingMembers operates on all members in the role that are
@@ -705,7 +909,10 @@ func handleDeletingMembers(
 
 	// Now handle each of the deleting members in parallel. We want to clean
 	// up the corresponding service and volume claim, and ultimately the
-	// member status.
+	// member status. If so configured, the volume claim is instead kept, for
+	// a while in case the member's data needs to be recovered or for as
+	// long as the role's retention policy says.
+	retention := newPVCRetention(role.roleSpec)
 	var wgCleanup sync.WaitGroup
 	wgCleanup.Add(len(deleting))
 	for _, member := range deleting {
@@ -729,6 +936,32 @@ func handleDeletingMembers(
 				)
 				return
 			}
+			if (m.Service != "") && (m.Service != zeroPortsService) {
+				ingressDelErr := deleteMemberIngress(cr, role, m)
+				if ingressDelErr != nil {
+					shared.LogErrorf(
+						reqLogger,
+						ingressDelErr,
+						cr,
+						shared.EventReasonMember,
+						"failed to delete ingress for member{%s}",
+						m.Pod,
+					)
+					return
+				}
+			}
+			certDelErr := deleteMemberCertificate(cr, m)
+			if certDelErr != nil {
+				shared.LogErrorf(
+					reqLogger,
+					certDelErr,
+					cr,
+					shared.EventReasonMember,
+					"failed to delete certificate for member{%s}",
+					m.Pod,
+				)
+				return
+			}
 			if m.Service != "" {
 				serviceDelErr := executor.DeletePodService(
 					reqLogger,
@@ -748,6 +981,10 @@ func handleDeletingMembers(
 					)
 				}
 			}
+			if (m.PVC != "") && (retention != nil) {
+				retention.retain(role.roleStatus.Name, m)
+				m.PVC = ""
+			}
 			if m.PVC != "" {
 				pvcDelErr := executor.DeletePVC(
 					cr.Namespace,
@@ -774,12 +1011,15 @@ func handleDeletingMembers(
 		}(member)
 	}
 	wgCleanup.Wait()
+	recordRetainedPVCs(cr, retention)
 }
 
 // handleDeletePendingMembers operates on all members in the role that are
-// currently in the delete pending state. It first notifies all ready members
-// in the cluster of the impending deletion; then it moves all of these
-// delete pending members to the deleting state.
+// currently in the delete pending state. If the app asks for it, it first
+// waits for these members to run the decommission hook. It then stops these
+// members (see stopMember), notifies all ready members in the cluster of the
+// impending deletion, and moves all of these delete pending members to the
+// deleting state.
 func handleDeletePendingMembers(
 	reqLogger logr.Logger,
 	cr *kdv1.KubeDirectorCluster,
@@ -787,6 +1027,26 @@ func handleDeletePendingMembers(
 	allRoles []*roleInfo,
 ) {
 
+	if !decommissionMembers(reqLogger, cr, role) {
+		return
+	}
+
+	// Give the leaving members the chance to shut down cleanly before the
+	// statefulset scale-down deletes them.
+	reason := stopReasonShrink
+	if role.roleSpec == nil {
+		reason = stopReasonRoleRemoved
+	}
+	allStopped := true
+	for _, member := range role.membersByState[memberDeletePending] {
+		if !stopMember(reqLogger, cr, role.roleStatus.Name, member, reason, false) {
+			allStopped = false
+		}
+	}
+	if !allStopped {
+		return
+	}
+
 	// Generate the notifications for these members, to later send to any
 	// ready nodes that aren't up-to-date.
 	generateNotifies(reqLogger, cr, role, allRoles)
@@ -794,6 +1054,14 @@ func handleDeletePendingMembers(
 	// All done, change state.
 	for _, member := range role.membersByState[memberDeletePending] {
 		member.State = string(memberDeleting)
+		shared.LogInfof(
+			reqLogger,
+			cr,
+			shared.EventReasonMemberDeleting,
+			"deleting member{%s} from role{%s}",
+			member.Pod,
+			role.roleStatus.Name,
+		)
 	}
 	role.membersByState[memberDeleting] = append(
 		role.membersByState[memberDeleting],
@@ -819,8 +1087,67 @@ func checkMemberCount(
 		len(role.membersByState[memberReady]) +
 		len(role.membersByState[memberConfigError]))
 
+	// If configured to do so, don't expand the role while its existing
+	// members are persistently failing to pull their image. This is kept
+	// as a role condition, and the event is only posted when it starts.
+	if (replicas > *(role.statefulSet.Spec.Replicas)) &&
+		shared.GetHaltExpansionOnImagePullError() &&
+		hasPersistentImagePullError(role) {
+		if !shared.ConditionIsTrue(role.roleStatus.Conditions, kdv1.RoleExpansionHalted) {
+			shared.LogInfof(
+				reqLogger,
+				cr,
+				shared.EventReasonRole,
+				"expansion of role{%s} halted due to persistent image pull errors",
+				role.roleStatus.Name,
+			)
+		}
+		shared.SetCondition(
+			&role.roleStatus.Conditions,
+			kdv1.RoleExpansionHalted,
+			corev1.ConditionTrue,
+			"ImagePullError",
+			"members of the role are persistently failing to pull their image",
+		)
+		return false
+	}
+	shared.SetCondition(
+		&role.roleStatus.Conditions,
+		kdv1.RoleExpansionHalted,
+		corev1.ConditionFalse,
+		"",
+		"",
+	)
+
 	// Fix the statefulset if we haven't successfully resized it yet.
 	if *(role.statefulSet.Spec.Replicas) != replicas {
+		// A cluster cloned from a backup or another cluster needs the cloned
+		// volumes in place before its new members are created, as does a
+		// role being re-created under a changed naming scheme.
+		if replicas > *(role.statefulSet.Spec.Replicas) {
+			if cloneErr := cloneMemberVolumes(reqLogger, cr, role); cloneErr != nil {
+				shared.LogErrorf(
+					reqLogger,
+					cloneErr,
+					cr,
+					shared.EventReasonRole,
+					"failed to clone volumes for role{%s}",
+					role.roleStatus.Name,
+				)
+				return false
+			}
+			if migrateErr := migrateMemberVolumes(reqLogger, cr, role); migrateErr != nil {
+				shared.LogErrorf(
+					reqLogger,
+					migrateErr,
+					cr,
+					shared.EventReasonRole,
+					"failed to migrate volumes for role{%s}",
+					role.roleStatus.Name,
+				)
+				return false
+			}
+		}
 		shared.LogInfof(
 			reqLogger,
 			cr,
@@ -987,11 +1314,15 @@ func setupLegacyLinks(
 }
 
 // setupAppConfig injects the app setup package (if any) into the member's
-// container and installs it.
+// container and installs it. A package from an OCI registry is pulled by
+// KubeDirector and copied into the container, as is an http(s) package with
+// a digest if setup packages are cached; otherwise the container downloads
+// the package itself. A package with a digest is checked against it in the
+// container before it is installed.
 func setupAppConfig(
 	reqLogger logr.Logger,
 	cr *kdv1.KubeDirectorCluster,
-	setupURL string,
+	setupInfo *kdv1.SetupPackageInfo,
 	podName string,
 	expectedContainerID string,
 	roleName string,
@@ -1015,7 +1346,48 @@ func setupAppConfig(
 	}
 
 	// Fetch and install it.
-	cmd := fmt.Sprintf(appPrepInitCmdFmt, setupURL)
+	fetchCmd := fmt.Sprintf(appPrepFetchURLFmt, setupInfo.PackageURL)
+	var content []byte
+	var pullErr error
+	staged := false
+	if executor.IsOCIPackage(setupInfo.PackageURL) {
+		content, pullErr = executor.FetchOCIPackage(
+			setupInfo.PackageURL,
+			setupInfo.PullSecretName,
+		)
+		staged = true
+	} else if (setupInfo.SHA256 != "") && shared.GetCacheSetupPackages() &&
+		executor.IsHTTPPackage(setupInfo.PackageURL) {
+		content, pullErr = executor.FetchSetupPackage(
+			setupInfo.PackageURL,
+			setupInfo.SHA256,
+		)
+		staged = true
+	}
+	if pullErr != nil {
+		return pullErr
+	}
+	if staged {
+		stageErr := executor.CreateFile(
+			reqLogger,
+			cr,
+			cr.Namespace,
+			podName,
+			expectedContainerID,
+			executor.AppContainerName,
+			appPrepStagedPackage,
+			bytes.NewReader(content),
+			false,
+		)
+		if stageErr != nil {
+			return stageErr
+		}
+		fetchCmd = appPrepFetchStaged
+	}
+	if setupInfo.SHA256 != "" {
+		fetchCmd += " &&\n\t" + fmt.Sprintf(appPrepVerifyFmt, setupInfo.SHA256)
+	}
+	cmd := fmt.Sprintf(appPrepInitCmdFmt, fetchCmd) + hookOwnershipCmd(cr, roleName)
 	return executor.RunScript(
 		reqLogger,
 		cr,
@@ -1249,6 +1621,7 @@ func appConfig(
 		stateDetail.ConfigErrorDetail = nil
 		stateDetail.LastSetupGeneration = nil
 		stateDetail.PendingNotifyCmds = []*kdv1.NotificationDesc{}
+		stateDetail.Configure = nil
 		shared.LogInfof(
 			reqLogger,
 			cr,
@@ -1256,6 +1629,19 @@ func appConfig(
 			"member{%s} was previously in config error state; re-trying setup",
 			podName,
 		)
+	} else if (stateDetail.Configure != nil) && (stateDetail.Configure.RetryAfter != nil) {
+		// Likewise for a retry after a failed attempt, once its backoff
+		// has passed.
+		stateDetail.LastSetupGeneration = nil
+		stateDetail.PendingNotifyCmds = []*kdv1.NotificationDesc{}
+		shared.LogInfof(
+			reqLogger,
+			cr,
+			shared.EventReasonMember,
+			"member{%s} setup attempt %d failed; re-trying setup",
+			podName,
+			stateDetail.Configure.Attempts,
+		)
 	} else {
 		// For initial configuration, startscript will run asynchronously and we
 		// will check back periodically. So let's have a look at the existing
@@ -1265,6 +1651,20 @@ func appConfig(
 		if fileError != nil {
 			return true, fileError
 		}
+		// A member whose volumes were cloned may carry the status file of
+		// the source member. That says nothing about setup in this cluster
+		// if we have never uploaded configmeta to the member.
+		if fileExists && (stateDetail.ClonedFrom != "") && (stateDetail.LastConfigDataGeneration == nil) {
+			shared.LogInfof(
+				reqLogger,
+				cr,
+				shared.EventReasonMember,
+				"member{%s} has setup state cloned from member{%s}; running setup",
+				podName,
+				stateDetail.ClonedFrom,
+			)
+			fileExists = false
+		}
 		if fileExists {
 			// Configure script was previously started. Extract the container
 			// ID where it is/was run, and see if we have a final config status.
@@ -1281,6 +1681,17 @@ func appConfig(
 				// restart? If not we will return and check again later; if so
 				// we will fall through and try to start setup from scratch.
 				if configContainerID == expectedContainerID {
+					timeoutErr := checkConfigureTimeout(
+						reqLogger,
+						cr,
+						podName,
+						expectedContainerID,
+						stateDetail,
+						roleName,
+					)
+					if timeoutErr != nil {
+						return true, timeoutErr
+					}
 					return false, nil
 				}
 				shared.LogInfof(
@@ -1296,6 +1707,7 @@ func appConfig(
 				// on, update LastSetupGeneration to indicate that the last
 				// pushed configmeta was processed. Clear any pending notifies
 				// because we captured that info as part of setup.
+				noteConfigureFinished(stateDetail)
 				if configContainerID == expectedContainerID {
 					stateDetail.LastSetupGeneration = stateDetail.LastConfigDataGeneration
 					stateDetail.PendingNotifyCmds = []*kdv1.NotificationDesc{}
@@ -1316,6 +1728,39 @@ func appConfig(
 						if linkErr != nil {
 							return true, linkErr
 						}
+						// If the restart was for an image upgrade, let the
+						// setup package know.
+						upgradeStarted, upgradeErr := appUpgrade(
+							reqLogger,
+							cr,
+							setupInfo,
+							podName,
+							expectedContainerID,
+							stateDetail,
+							roleName,
+							configmetaGenerator,
+						)
+						if upgradeErr != nil {
+							return true, upgradeErr
+						}
+						if upgradeStarted {
+							return false, nil
+						}
+						// If the restart was requested through the role's
+						// restart generation, let the setup package know.
+						restartStarted, restartErr := appRestart(
+							reqLogger,
+							cr,
+							podName,
+							expectedContainerID,
+							roleName,
+						)
+						if restartErr != nil {
+							return true, restartErr
+						}
+						if restartStarted {
+							return false, nil
+						}
 					}
 					return true, nil
 				}
@@ -1364,6 +1809,8 @@ func appConfig(
 		)
 		return false, nil
 	}
+	// From here on this counts as an attempt at configuration.
+	noteConfigureStarted(stateDetail)
 	// Now upload the configmeta file.
 	configmetaErr := executor.CreateFile(
 		reqLogger,
@@ -1392,10 +1839,21 @@ func appConfig(
 		return true, linkErr
 	}
 	// Make sure the necessary app-specific materials are in place.
-	setupErr := setupAppConfig(reqLogger, cr, setupInfo.PackageURL, podName, expectedContainerID, roleName)
+	setupErr := setupAppConfig(reqLogger, cr, setupInfo, podName, expectedContainerID, roleName)
 	if setupErr != nil {
 		return true, setupErr
 	}
+	// Configure any additional app containers first.
+	containersErr := configureAppContainers(
+		reqLogger,
+		cr,
+		podName,
+		roleName,
+		configmetaGenerator(podName),
+	)
+	if containersErr != nil {
+		return true, containersErr
+	}
 	// Run the config file iff the event is registered during initial configuration.
 	appCr, appErr := catalog.GetApp(cr)
 	if appErr != nil {
@@ -1409,11 +1867,22 @@ func appConfig(
 		return true, appErr
 	}
 	role := catalog.GetRoleFromID(appCr, roleName)
-	if role.EventList != nil && !shared.StringInList("configure", *role.EventList) {
+	// A member whose volumes were cloned gets the restored event instead,
+	// if its role handles that, until it has first been configured.
+	runCmd := appPrepConfigRunCmd
+	if (stateDetail.ClonedFrom != "") && (stateDetail.ConfiguredImage == "") &&
+		(role.EventList != nil) && shared.StringInList(restoredEvent, *role.EventList) {
+		runCmd = appPrepConfigRestoredCmd
+	} else if role.EventList != nil && !shared.StringInList("configure", *role.EventList) {
+		noteConfigureFinished(stateDetail)
 		return true, nil
 	}
 	// Now kick off the initial config.
-	cmd := fmt.Sprintf(appPrepConfigRunCmd, expectedContainerID)
+	cmd := fmt.Sprintf(
+		runCmd,
+		expectedContainerID,
+		quotedHookPrefix(cr, roleName),
+	)
 	cmdErr := executor.RunScript(
 		reqLogger,
 		cr,
@@ -1433,6 +1902,14 @@ func appConfig(
 		}
 		return true, cmdErr
 	}
+	shared.LogInfof(
+		reqLogger,
+		cr,
+		shared.EventReasonMemberConfigStarted,
+		"initial config started for member{%s} in role{%s}",
+		podName,
+		roleName,
+	)
 	return false, nil
 }
 
@@ -1460,12 +1937,12 @@ func queueNotify(
 		// will appropriately skip the ones that are still creating, or the
 		// ones in other states that are just reboots.
 		op = "addnodes"
-		deltaFqdns = fqdnsList(cr, creatingOrCreated)
+		deltaFqdns = fqdnsList(cr, modifiedRole.roleStatus.Name, creatingOrCreated)
 	}
 	if op == "" {
 		if deletePending, ok := modifiedRole.membersByState[memberDeletePending]; ok {
 			op = "delnodes"
-			deltaFqdns = fqdnsList(cr, deletePending)
+			deltaFqdns = fqdnsList(cr, modifiedRole.roleStatus.Name, deletePending)
 		}
 	}
 
@@ -1515,19 +1992,17 @@ func queueNotify(
 	)
 }
 
-// fqdnsList generates a comma-separated list of FQDNs given a list of members.
+// fqdnsList generates a comma-separated list of FQDNs given a list of members
+// of the named role.
 func fqdnsList(
 	cr *kdv1.KubeDirectorCluster,
+	roleName string,
 	members []*kdv1.MemberStatus,
 ) string {
 
+	domain := shared.MemberDomain(cr, roleName)
 	getMemberFqdn := func(m *kdv1.MemberStatus) string {
-		s := []string{
-			m.Pod,
-			cr.Status.ClusterService,
-			cr.Namespace + shared.GetSvcClusterDomainBase(),
-		}
-		return strings.Join(s, ".")
+		return m.Pod + "." + domain
 	}
 	numMembers := len(members)
 	fqdns := make([]string, 0, numMembers)
@@ -0,0 +1,73 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubedirectorcluster
+
+import (
+	"github.com/go-logr/logr"
+
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	"github.com/bluek8s/kubedirector/pkg/extension"
+	"github.com/bluek8s/kubedirector/pkg/observer"
+	"github.com/bluek8s/kubedirector/pkg/shared"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// namespaceTerminating reports whether the cluster's namespace is being
+// deleted. Nothing new can be created in such a namespace. If the namespace
+// cannot be fetched, it is assumed not to be terminating.
+func namespaceTerminating(
+	cr *kdv1.KubeDirectorCluster,
+) bool {
+
+	ns, nsErr := observer.GetNamespace(cr.Namespace)
+	if nsErr != nil {
+		return false
+	}
+	return (ns.DeletionTimestamp != nil) ||
+		(ns.Status.Phase == corev1.NamespaceTerminating)
+}
+
+// handleNamespaceTermination checks whether the cluster's namespace is
+// being deleted, and if so switches the cluster to teardown-only handling.
+// The first time this is noticed, the extensions' PreDelete hooks are run,
+// while the members are most likely still there; their failures do not
+// hold anything up. Returns true if the namespace is terminating.
+func handleNamespaceTermination(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorCluster,
+) bool {
+
+	if !namespaceTerminating(cr) {
+		return false
+	}
+	if !shared.ConditionIsTrue(cr.Status.Conditions, kdv1.ClusterNamespaceTerminating) {
+		shared.LogInfof(
+			reqLogger,
+			cr,
+			shared.EventReasonCluster,
+			"namespace %s is terminating; only tearing down from now on",
+			cr.Namespace,
+		)
+		extension.PreDelete(reqLogger, cr)
+		shared.SetCondition(
+			&cr.Status.Conditions,
+			kdv1.ClusterNamespaceTerminating,
+			corev1.ConditionTrue,
+			"NamespaceDeleted",
+			"the namespace is being deleted",
+		)
+	}
+	return true
+}
@@ -0,0 +1,128 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubedirectorcluster
+
+import (
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	"github.com/bluek8s/kubedirector/pkg/executor"
+	"github.com/bluek8s/kubedirector/pkg/observer"
+	"github.com/bluek8s/kubedirector/pkg/shared"
+	"github.com/go-logr/logr"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+)
+
+// syncNetworkPolicies is responsible for the per-role network policies that
+// KubeDirector generates when the networkPolicies config property is set.
+// Each role that has a statefulset gets a policy of the same name; these
+// are created if missing and repaired if changed. Policies of this cluster
+// that are no longer wanted (because the role is gone, or the feature has
+// been turned off) are deleted. Failures here are not reconciler-stopping
+// errors; we'll just try again next time.
+func syncNetworkPolicies(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorCluster,
+	roles []*roleInfo,
+) {
+
+	existing, listErr := observer.ListClusterNetworkPolicies(cr.Namespace, cr.Name)
+	if listErr != nil {
+		shared.LogError(
+			reqLogger,
+			listErr,
+			cr,
+			shared.EventReasonNoEvent,
+			"failed to list NetworkPolicies",
+		)
+		return
+	}
+	existingByName := make(map[string]*networkingv1.NetworkPolicy)
+	for i := range existing {
+		existingByName[existing[i].Name] = &(existing[i])
+	}
+
+	wanted := make(map[string]bool)
+	if shared.GetNetworkPolicies() {
+		for _, role := range roles {
+			if (role.roleSpec == nil) || (role.statefulSet == nil) {
+				continue
+			}
+			name := role.statefulSet.Name
+			wanted[name] = true
+			if policy, ok := existingByName[name]; ok {
+				updateErr := executor.UpdateNetworkPolicy(
+					reqLogger,
+					cr,
+					role.roleSpec,
+					policy,
+				)
+				if updateErr != nil {
+					shared.LogErrorf(
+						reqLogger,
+						updateErr,
+						cr,
+						shared.EventReasonRole,
+						"failed to update NetworkPolicy{%s}",
+						name,
+					)
+				}
+				continue
+			}
+			createErr := createWithBackoff(
+				reqLogger,
+				cr,
+				"network policy for role "+role.roleSpec.Name,
+				func() error {
+					_, err := executor.CreateNetworkPolicy(cr, role.roleSpec, name)
+					return err
+				},
+			)
+			if createErr != nil {
+				shared.LogErrorf(
+					reqLogger,
+					createErr,
+					cr,
+					shared.EventReasonRole,
+					"failed to create NetworkPolicy{%s}",
+					name,
+				)
+			}
+		}
+	}
+
+	for name, policy := range existingByName {
+		if wanted[name] || !shared.OwnerReferencesPresent(cr, policy.OwnerReferences) {
+			continue
+		}
+		shared.LogInfof(
+			reqLogger,
+			cr,
+			shared.EventReasonCluster,
+			"deleting NetworkPolicy{%s}",
+			name,
+		)
+		deleteErr := executor.DeleteNetworkPolicy(cr.Namespace, name)
+		if (deleteErr != nil) && !errors.IsNotFound(deleteErr) {
+			shared.LogErrorf(
+				reqLogger,
+				deleteErr,
+				cr,
+				shared.EventReasonCluster,
+				"failed to delete NetworkPolicy{%s}",
+				name,
+			)
+		}
+	}
+}
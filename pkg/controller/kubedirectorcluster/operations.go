@@ -0,0 +1,398 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package kubedirectorcluster
+
+import (
+	"fmt"
+	"strconv"
+
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	"github.com/bluek8s/kubedirector/pkg/shared"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// syncOperations maintains the queue of membership operations in the
+// cluster status. When the role member counts in the spec differ from the
+// most recently requested operation, the new counts are either merged into
+// the active operation (if every role they change is currently idle),
+// merged into the operation already queued behind the active one, or
+// queued as a new operation. A queued operation becomes active once the
+// active one has completed.
+func syncOperations(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorCluster,
+) {
+
+	desired := specMembers(cr)
+	ops := cr.Status.Operations
+	if len(ops) == 0 {
+		cr.Status.Operations = []kdv1.Operation{
+			{
+				Generation: cr.Generation,
+				Members:    desired,
+			},
+		}
+		return
+	}
+
+	syncApprovals(reqLogger, cr, ops)
+
+	if (len(ops) > 1) && operationComplete(cr, &ops[0]) && operationApproved(&ops[1]) {
+		shared.LogInfof(
+			reqLogger,
+			cr,
+			shared.EventReasonCluster,
+			"membership change from generation %d complete; starting queued change from generation %d",
+			ops[0].Generation,
+			ops[1].Generation,
+		)
+		ops = ops[1:]
+	}
+
+	lastIndex := len(ops) - 1
+	if !membersEqual(desired, ops[lastIndex].Members) {
+		switch {
+		case (lastIndex == 0) && canMergeOperation(cr, &ops[0], desired) &&
+			!approvalRequired(ops[0].Members, desired):
+			// Also covers the usual case of a change to a cluster whose
+			// previous change has completed.
+			ops[0].Generation = cr.Generation
+			ops[0].Members = desired
+		case lastIndex > 0:
+			shared.LogInfof(
+				reqLogger,
+				cr,
+				shared.EventReasonCluster,
+				"replacing queued membership change with generation %d",
+				cr.Generation,
+			)
+			ops[lastIndex].Generation = cr.Generation
+			ops[lastIndex].Members = desired
+			ops[lastIndex].ApprovalRequired = approvalRequired(ops[lastIndex-1].Members, desired)
+			ops[lastIndex].ApprovedBy = ""
+		default:
+			shared.LogInfof(
+				reqLogger,
+				cr,
+				shared.EventReasonCluster,
+				"queueing membership change from generation %d behind in-progress generation %d",
+				cr.Generation,
+				ops[0].Generation,
+			)
+			ops = append(
+				ops,
+				kdv1.Operation{
+					Generation:       cr.Generation,
+					Members:          desired,
+					ApprovalRequired: approvalRequired(ops[0].Members, desired),
+				},
+			)
+		}
+	}
+	cr.Status.Operations = ops
+
+	if last := &ops[len(ops)-1]; !operationApproved(last) {
+		shared.SetCondition(
+			&cr.Status.Conditions,
+			kdv1.ClusterApprovalPending,
+			corev1.ConditionTrue,
+			"MembershipChangeNeedsApproval",
+			fmt.Sprintf(
+				"membership change from generation %d must be approved by setting the %s annotation to %d",
+				last.Generation,
+				shared.ApproveGenerationAnnotation,
+				last.Generation,
+			),
+		)
+	} else {
+		shared.SetCondition(
+			&cr.Status.Conditions,
+			kdv1.ClusterApprovalPending,
+			corev1.ConditionFalse,
+			"",
+			"",
+		)
+	}
+
+	if len(ops) > 1 {
+		shared.SetCondition(
+			&cr.Status.Conditions,
+			kdv1.ClusterChangeQueued,
+			corev1.ConditionTrue,
+			"MembershipChangeInProgress",
+			fmt.Sprintf(
+				"membership change from generation %d is waiting for generation %d to complete",
+				ops[1].Generation,
+				ops[0].Generation,
+			),
+		)
+	} else {
+		shared.SetCondition(
+			&cr.Status.Conditions,
+			kdv1.ClusterChangeQueued,
+			corev1.ConditionFalse,
+			"",
+			"",
+		)
+	}
+}
+
+// ChangeConflicts returns true if the role member counts in the spec could
+// not be acted on immediately, because they would have to be queued behind
+// an in-progress membership change. The validator uses this to reject such
+// changes when so configured.
+func ChangeConflicts(
+	cr *kdv1.KubeDirectorCluster,
+) (bool, int64) {
+
+	if (cr.Status == nil) || (len(cr.Status.Operations) == 0) {
+		return false, 0
+	}
+	ops := cr.Status.Operations
+	desired := specMembers(cr)
+	if membersEqual(desired, ops[len(ops)-1].Members) {
+		return false, 0
+	}
+	if (len(ops) == 1) && canMergeOperation(cr, &ops[0], desired) {
+		return false, 0
+	}
+	return true, ops[0].Generation
+}
+
+// activeTarget returns the member count that the reconciler should work
+// toward for the given role: its count in the active operation, or zero if
+// the role is only added by a queued operation.
+func activeTarget(
+	cr *kdv1.KubeDirectorCluster,
+	roleSpec *kdv1.Role,
+) int {
+
+	if len(cr.Status.Operations) == 0 {
+		return int(*(roleSpec.Members))
+	}
+	return int(cr.Status.Operations[0].Members[roleSpec.Name])
+}
+
+// removedRoleTarget returns the member count that the reconciler should
+// work toward for a role that is no longer in the spec: zero, unless the
+// active operation still includes the role because its removal is queued
+// awaiting approval, in which case the role's existing members are kept.
+func removedRoleTarget(
+	cr *kdv1.KubeDirectorCluster,
+	roleStatus *kdv1.RoleStatus,
+) int {
+
+	ops := cr.Status.Operations
+	if (len(ops) < 2) || operationApproved(&ops[len(ops)-1]) {
+		return 0
+	}
+	if _, ok := ops[0].Members[roleStatus.Name]; !ok {
+		return 0
+	}
+	count := 0
+	for _, member := range roleStatus.Members {
+		if !shared.StringInList(member.State, deletingMemberStates) {
+			count++
+		}
+	}
+	return count
+}
+
+// specMembers returns the role member counts requested in the spec.
+func specMembers(
+	cr *kdv1.KubeDirectorCluster,
+) map[string]int32 {
+
+	members := make(map[string]int32)
+	for _, role := range cr.Spec.Roles {
+		if role.Members != nil {
+			members[role.Name] = *role.Members
+		}
+	}
+	return members
+}
+
+// membersEqual compares two sets of role member counts, treating an absent
+// role as having zero members.
+func membersEqual(
+	a map[string]int32,
+	b map[string]int32,
+) bool {
+
+	for name, count := range a {
+		if b[name] != count {
+			return false
+		}
+	}
+	for name, count := range b {
+		if a[name] != count {
+			return false
+		}
+	}
+	return true
+}
+
+// operationComplete returns true if every role has reached its member count
+// in the given operation, with every member either ready or in error. Roles
+// that have been removed from the spec are expected to have no members.
+func operationComplete(
+	cr *kdv1.KubeDirectorCluster,
+	op *kdv1.Operation,
+) bool {
+
+	inSpec := specMembers(cr)
+	for name, count := range op.Members {
+		if _, ok := inSpec[name]; !ok {
+			continue
+		}
+		if !roleIdleAt(cr, name, int(count)) {
+			return false
+		}
+	}
+	for _, roleStatus := range cr.Status.Roles {
+		_, inOp := op.Members[roleStatus.Name]
+		_, stillInSpec := inSpec[roleStatus.Name]
+		if inOp && stillInSpec {
+			continue
+		}
+		if !roleIdleAt(cr, roleStatus.Name, 0) {
+			return false
+		}
+	}
+	return true
+}
+
+// canMergeOperation returns true if the desired member counts can be
+// folded into the given active operation: every role whose count would
+// change must already be idle at the operation's count for it.
+func canMergeOperation(
+	cr *kdv1.KubeDirectorCluster,
+	op *kdv1.Operation,
+	desired map[string]int32,
+) bool {
+
+	for name, count := range desired {
+		current := op.Members[name]
+		if count == current {
+			continue
+		}
+		if !roleIdleAt(cr, name, int(current)) {
+			return false
+		}
+	}
+	return true
+}
+
+// roleIdleAt returns true if the named role has exactly the given number of
+// members, all either ready or in error, and is not in the middle of a
+// storage change or image upgrade. A membership change is therefore never
+// merged into (or started alongside) an in-progress resize or upgrade of
+// the role; it is queued behind it instead.
+func roleIdleAt(
+	cr *kdv1.KubeDirectorCluster,
+	roleName string,
+	count int,
+) bool {
+
+	for i := range cr.Status.Roles {
+		roleStatus := &(cr.Status.Roles[i])
+		if roleStatus.Name != roleName {
+			continue
+		}
+		if len(roleStatus.Members) != count {
+			return false
+		}
+		if replacingStatefulSet(roleStatus) ||
+			shared.ConditionIsTrue(roleStatus.Conditions, kdv1.RoleUpgrading) {
+			return false
+		}
+		for _, member := range roleStatus.Members {
+			if (member.State != string(memberReady)) &&
+				(member.State != string(memberConfigError)) {
+				return false
+			}
+		}
+		return true
+	}
+	return count == 0
+}
+
+// approvalRequired returns true if, under the KubeDirectorConfig
+// membershipApproval policy, changing the role member counts from prev to
+// desired needs approval. A role absent from desired is treated as shrinking
+// to zero members.
+func approvalRequired(
+	prev map[string]int32,
+	desired map[string]int32,
+) bool {
+
+	switch shared.GetMembershipApproval() {
+	case kdv1.ApprovalAll:
+		return !membersEqual(prev, desired)
+	case kdv1.ApprovalShrink:
+		for name, count := range prev {
+			if desired[name] < count {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// operationApproved returns true if the given operation does not need
+// approval or has been approved.
+func operationApproved(
+	op *kdv1.Operation,
+) bool {
+
+	return !op.ApprovalRequired || (op.ApprovedBy != "")
+}
+
+// syncApprovals marks a queued operation as approved if the approval
+// annotation on the cluster names its generation. The validator only lets
+// an authorized user set that annotation, and records who did so.
+func syncApprovals(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorCluster,
+	ops []kdv1.Operation,
+) {
+
+	approved, ok := cr.Annotations[shared.ApproveGenerationAnnotation]
+	approvedBy := cr.Annotations[shared.ApprovedByAnnotation]
+	if !ok || (approvedBy == "") {
+		return
+	}
+	for i := range ops {
+		op := &ops[i]
+		if operationApproved(op) || (approved != strconv.FormatInt(op.Generation, 10)) {
+			continue
+		}
+		op.ApprovedBy = approvedBy
+		shared.LogInfof(
+			reqLogger,
+			cr,
+			shared.EventReasonCluster,
+			"membership change from generation %d approved by %s",
+			op.Generation,
+			op.ApprovedBy,
+		)
+		addAuditRecord(
+			cr,
+			kdv1.AuditOperationApproved,
+			op.ApprovedBy,
+			fmt.Sprintf("generation %d", op.Generation),
+		)
+	}
+}
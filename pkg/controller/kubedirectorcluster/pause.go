@@ -0,0 +1,70 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubedirectorcluster
+
+import (
+	"github.com/go-logr/logr"
+
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	"github.com/bluek8s/kubedirector/pkg/shared"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// clusterPaused reports whether the cluster's paused annotation is set to
+// "true", and keeps its Paused condition to match. An event is logged when
+// the cluster becomes paused or resumes.
+func clusterPaused(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorCluster,
+) bool {
+
+	paused := (cr.Annotations[shared.PausedAnnotation] == "true")
+	wasPaused := shared.ConditionIsTrue(cr.Status.Conditions, kdv1.ClusterPaused)
+	if paused {
+		if !wasPaused {
+			shared.LogInfof(
+				reqLogger,
+				cr,
+				shared.EventReasonCluster,
+				"reconciliation paused by the %s annotation",
+				shared.PausedAnnotation,
+			)
+		}
+		shared.SetCondition(
+			&cr.Status.Conditions,
+			kdv1.ClusterPaused,
+			corev1.ConditionTrue,
+			"Annotation",
+			"reconciliation is paused by the "+shared.PausedAnnotation+" annotation",
+		)
+		return true
+	}
+	if wasPaused {
+		shared.LogInfo(
+			reqLogger,
+			cr,
+			shared.EventReasonCluster,
+			"reconciliation resumed",
+		)
+	}
+	shared.SetCondition(
+		&cr.Status.Conditions,
+		kdv1.ClusterPaused,
+		corev1.ConditionFalse,
+		"",
+		"",
+	)
+	return false
+}
@@ -0,0 +1,152 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubedirectorcluster
+
+import (
+	"sync"
+	"time"
+
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	"github.com/bluek8s/kubedirector/pkg/shared"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+)
+
+// podChanges is the set of member pods of one cluster that have had any
+// event since the cluster's member states were last checked, along with the
+// time of the last check that looked at every member.
+type podChanges struct {
+	pods      map[string]bool
+	lastFull  time.Time
+	needsFull bool
+}
+
+var (
+	memberPodChanges     = make(map[types.NamespacedName]*podChanges)
+	memberPodChangesLock sync.Mutex
+)
+
+// podChangeTracker is the event handler for a watch on all pods that feeds
+// memberPodChanges. It records the pod names of changed members against
+// their cluster (identified by the cluster label) and never enqueues any
+// requests itself; that is left to the filtered pod watch, so that changes
+// which don't warrant a reconcile are still noticed by the next one.
+var podChangeTracker = handler.Funcs{
+	CreateFunc: func(e event.CreateEvent, q workqueue.RateLimitingInterface) {
+		notePodChange(e.Meta)
+	},
+	UpdateFunc: func(e event.UpdateEvent, q workqueue.RateLimitingInterface) {
+		notePodChange(e.MetaNew)
+	},
+	DeleteFunc: func(e event.DeleteEvent, q workqueue.RateLimitingInterface) {
+		notePodChange(e.Meta)
+	},
+	GenericFunc: func(e event.GenericEvent, q workqueue.RateLimitingInterface) {
+		notePodChange(e.Meta)
+	},
+}
+
+// notePodChange records an event on the given pod, if it is a member pod.
+func notePodChange(
+	podMeta metav1.Object,
+) {
+
+	if podMeta == nil {
+		return
+	}
+	clusterName, ok := podMeta.GetLabels()[shared.ClusterLabel]
+	if !ok {
+		return
+	}
+	key := types.NamespacedName{
+		Namespace: podMeta.GetNamespace(),
+		Name:      clusterName,
+	}
+	memberPodChangesLock.Lock()
+	defer memberPodChangesLock.Unlock()
+	changes, ok := memberPodChanges[key]
+	if !ok {
+		// Nothing has been checked for this cluster yet, so the first check
+		// will look at every member anyway.
+		changes = &podChanges{
+			pods:      make(map[string]bool),
+			needsFull: true,
+		}
+		memberPodChanges[key] = changes
+	}
+	changes.pods[podMeta.GetName()] = true
+}
+
+// takeMemberPodChanges returns the set of member pods of the given cluster
+// that have changed since the previous call, and clears it. If the second
+// return value is true, the caller must check every member instead: this is
+// the case for a cluster not seen before (e.g. after KubeDirector restarts)
+// and, as a safety net against missed events, once per podFullCheckPeriod.
+func takeMemberPodChanges(
+	cr *kdv1.KubeDirectorCluster,
+) (map[string]bool, bool) {
+
+	key := types.NamespacedName{Namespace: cr.Namespace, Name: cr.Name}
+	now := time.Now()
+	memberPodChangesLock.Lock()
+	defer memberPodChangesLock.Unlock()
+	changes, ok := memberPodChanges[key]
+	if !ok {
+		changes = &podChanges{needsFull: true}
+		memberPodChanges[key] = changes
+	}
+	changed := changes.pods
+	full := changes.needsFull || (now.Sub(changes.lastFull) >= podFullCheckPeriod)
+	changes.pods = make(map[string]bool)
+	changes.needsFull = false
+	if full {
+		changes.lastFull = now
+	}
+	return changed, full
+}
+
+// forgetMemberPodChanges drops the change tracking for a deleted cluster.
+func forgetMemberPodChanges(
+	cr *kdv1.KubeDirectorCluster,
+) {
+
+	key := types.NamespacedName{Namespace: cr.Namespace, Name: cr.Name}
+	memberPodChangesLock.Lock()
+	defer memberPodChangesLock.Unlock()
+	delete(memberPodChanges, key)
+}
+
+// memberSettled decides whether a member whose pod has not changed can keep
+// its current container state without looking at the pod again. Only
+// members in a steady state qualify, and only if the cluster has no newer
+// spec for them to pick up (which would make their container unresponsive).
+func memberSettled(
+	cr *kdv1.KubeDirectorCluster,
+	member *kdv1.MemberStatus,
+) bool {
+
+	if !steadyMember(member) {
+		return false
+	}
+	lastGen := member.StateDetail.LastConfigDataGeneration
+	specGen := cr.Status.SpecGenerationToProcess
+	if (lastGen != nil) && (specGen != nil) && (*lastGen != *specGen) {
+		return false
+	}
+	return true
+}
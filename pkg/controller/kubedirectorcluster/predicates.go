@@ -0,0 +1,169 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubedirectorcluster
+
+import (
+	"github.com/bluek8s/kubedirector/pkg/executor"
+	"github.com/bluek8s/kubedirector/pkg/shared"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// clusterLabelPredicate passes only events on objects that carry the
+// cluster label, which KubeDirector puts on every statefulset and pod that
+// it creates. The pod and statefulset watches see every such object in the
+// K8s cluster, so this is checked before anything else.
+var clusterLabelPredicate = predicate.Funcs{
+	CreateFunc: func(e event.CreateEvent) bool {
+		return hasClusterLabel(e.Meta)
+	},
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		return hasClusterLabel(e.MetaNew)
+	},
+	DeleteFunc: func(e event.DeleteEvent) bool {
+		return hasClusterLabel(e.Meta)
+	},
+	GenericFunc: func(e event.GenericEvent) bool {
+		return hasClusterLabel(e.Meta)
+	},
+}
+
+// hasClusterLabel reports whether the given object has the cluster label.
+func hasClusterLabel(
+	meta metav1.Object,
+) bool {
+
+	if meta == nil {
+		return false
+	}
+	_, ok := meta.GetLabels()[shared.ClusterLabel]
+	return ok
+}
+
+// statefulSetPredicate filters events on statefulsets owned by a
+// KubeDirectorCluster. Creates and deletes always pass. Updates pass only if
+// they change something the cluster handler looks at: the spec (tracked by
+// generation), the replicas count reported in status, the owner refs, or the
+// deletion timestamp. Other status churn is ignored; the periodic requeue
+// will still catch anything missed here.
+var statefulSetPredicate = predicate.Funcs{
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		oldSS, oldOk := e.ObjectOld.(*appsv1.StatefulSet)
+		newSS, newOk := e.ObjectNew.(*appsv1.StatefulSet)
+		if !(oldOk && newOk) {
+			return true
+		}
+		if oldSS.Generation != newSS.Generation {
+			return true
+		}
+		if oldSS.Status.Replicas != newSS.Status.Replicas {
+			return true
+		}
+		if (oldSS.DeletionTimestamp == nil) != (newSS.DeletionTimestamp == nil) {
+			return true
+		}
+		return !equality.Semantic.DeepEqual(oldSS.OwnerReferences, newSS.OwnerReferences)
+	},
+}
+
+// podPredicate filters events on member pods. Creates and deletes always
+// pass. Updates pass only if they change the pod phase, the deletion
+// timestamp, the scheduling outcome, or the identity or state of the app
+// container. In particular, readiness condition flapping (including changes
+// to our own configured-state condition) does not trigger a reconcile.
+var podPredicate = predicate.Funcs{
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		oldPod, oldOk := e.ObjectOld.(*corev1.Pod)
+		newPod, newOk := e.ObjectNew.(*corev1.Pod)
+		if !(oldOk && newOk) {
+			return true
+		}
+		if oldPod.Status.Phase != newPod.Status.Phase {
+			return true
+		}
+		if (oldPod.DeletionTimestamp == nil) != (newPod.DeletionTimestamp == nil) {
+			return true
+		}
+		if podScheduledStatus(oldPod) != podScheduledStatus(newPod) {
+			return true
+		}
+		return appContainerSummary(oldPod) != appContainerSummary(newPod)
+	},
+}
+
+// podScheduledStatus returns the status of the PodScheduled condition of the
+// given pod, or the empty string if the condition is not present.
+func podScheduledStatus(
+	pod *corev1.Pod,
+) corev1.ConditionStatus {
+
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodScheduled {
+			return condition.Status
+		}
+	}
+	return ""
+}
+
+// appContainerSummary returns a string that changes whenever the app
+// container of the given pod gets a new container ID or moves between the
+// waiting, running, and terminated states.
+func appContainerSummary(
+	pod *corev1.Pod,
+) string {
+
+	for _, containerStatus := range pod.Status.ContainerStatuses {
+		if containerStatus.Name != executor.AppContainerName {
+			continue
+		}
+		state := containerUnknown
+		if containerStatus.State.Running != nil {
+			state = containerRunning
+		} else if containerStatus.State.Waiting != nil {
+			state = containerWaiting
+		} else if containerStatus.State.Terminated != nil {
+			state = containerTerminated
+		}
+		return containerStatus.ContainerID + "=" + state
+	}
+	return ""
+}
+
+// podToClusterRequest maps a member pod to a reconcile request for the
+// KubeDirectorCluster that it belongs to, as identified by the cluster
+// label. Pods without that label produce no requests.
+var podToClusterRequest = handler.ToRequestsFunc(
+	func(obj handler.MapObject) []reconcile.Request {
+		clusterName, ok := obj.Meta.GetLabels()[shared.ClusterLabel]
+		if !ok {
+			return nil
+		}
+		return []reconcile.Request{
+			{
+				NamespacedName: types.NamespacedName{
+					Namespace: obj.Meta.GetNamespace(),
+					Name:      clusterName,
+				},
+			},
+		}
+	},
+)
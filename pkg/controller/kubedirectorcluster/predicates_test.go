@@ -0,0 +1,251 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubedirectorcluster
+
+import (
+	"testing"
+
+	"github.com/bluek8s/kubedirector/pkg/executor"
+	"github.com/bluek8s/kubedirector/pkg/shared"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+)
+
+// testPod returns a member pod of cluster "c1" whose app container has the
+// given ID and state.
+func testPod(
+	containerID string,
+	state corev1.ContainerState,
+) *corev1.Pod {
+
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "ns",
+			Name:      "kdss-abcde-0",
+			Labels:    map[string]string{shared.ClusterLabel: "c1"},
+		},
+		Status: corev1.PodStatus{
+			Phase: corev1.PodRunning,
+			Conditions: []corev1.PodCondition{
+				{Type: corev1.PodScheduled, Status: corev1.ConditionTrue},
+				{Type: corev1.PodReady, Status: corev1.ConditionTrue},
+			},
+			ContainerStatuses: []corev1.ContainerStatus{
+				{
+					Name:        executor.AppContainerName,
+					ContainerID: containerID,
+					State:       state,
+				},
+			},
+		},
+	}
+}
+
+var runningState = corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}
+
+func TestClusterLabelPredicate(t *testing.T) {
+
+	labelled := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels: map[string]string{shared.ClusterLabel: "c1"},
+		},
+	}
+	unlabelled := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels: map[string]string{"app": "other"},
+		},
+	}
+	tests := []struct {
+		name string
+		pod  *corev1.Pod
+		want bool
+	}{
+		{"labelled", labelled, true},
+		{"unlabelled", unlabelled, false},
+	}
+	for _, tc := range tests {
+		if got := clusterLabelPredicate.Create(event.CreateEvent{Meta: tc.pod, Object: tc.pod}); got != tc.want {
+			t.Errorf("%s: create = %v, want %v", tc.name, got, tc.want)
+		}
+		update := event.UpdateEvent{
+			MetaOld:   tc.pod,
+			ObjectOld: tc.pod,
+			MetaNew:   tc.pod,
+			ObjectNew: tc.pod,
+		}
+		if got := clusterLabelPredicate.Update(update); got != tc.want {
+			t.Errorf("%s: update = %v, want %v", tc.name, got, tc.want)
+		}
+		if got := clusterLabelPredicate.Delete(event.DeleteEvent{Meta: tc.pod, Object: tc.pod}); got != tc.want {
+			t.Errorf("%s: delete = %v, want %v", tc.name, got, tc.want)
+		}
+		if got := clusterLabelPredicate.Generic(event.GenericEvent{Meta: tc.pod, Object: tc.pod}); got != tc.want {
+			t.Errorf("%s: generic = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+	if clusterLabelPredicate.Create(event.CreateEvent{}) {
+		t.Errorf("create with no object passed")
+	}
+}
+
+func TestStatefulSetPredicateUpdate(t *testing.T) {
+
+	replicas := int32(3)
+	base := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "kdss-abcde",
+			Generation: 4,
+			OwnerReferences: []metav1.OwnerReference{
+				{Kind: "KubeDirectorCluster", Name: "c1", UID: "uid-1"},
+			},
+		},
+		Spec: appsv1.StatefulSetSpec{Replicas: &replicas},
+		Status: appsv1.StatefulSetStatus{
+			Replicas:      3,
+			ReadyReplicas: 3,
+		},
+	}
+	now := metav1.Now()
+	tests := []struct {
+		name   string
+		modify func(ss *appsv1.StatefulSet)
+		want   bool
+	}{
+		{"no change", func(ss *appsv1.StatefulSet) {}, false},
+		{"ready replicas", func(ss *appsv1.StatefulSet) { ss.Status.ReadyReplicas = 2 }, false},
+		{"generation", func(ss *appsv1.StatefulSet) { ss.Generation = 5 }, true},
+		{"status replicas", func(ss *appsv1.StatefulSet) { ss.Status.Replicas = 2 }, true},
+		{"deleting", func(ss *appsv1.StatefulSet) { ss.DeletionTimestamp = &now }, true},
+		{"owner refs", func(ss *appsv1.StatefulSet) { ss.OwnerReferences = nil }, true},
+	}
+	for _, tc := range tests {
+		newSS := base.DeepCopy()
+		tc.modify(newSS)
+		update := event.UpdateEvent{
+			MetaOld:   base,
+			ObjectOld: base,
+			MetaNew:   newSS,
+			ObjectNew: newSS,
+		}
+		if got := statefulSetPredicate.Update(update); got != tc.want {
+			t.Errorf("%s: got %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestPodPredicateUpdate(t *testing.T) {
+
+	base := testPod("docker://aaa", runningState)
+	now := metav1.Now()
+	tests := []struct {
+		name   string
+		modify func(pod *corev1.Pod)
+		want   bool
+	}{
+		{"no change", func(pod *corev1.Pod) {}, false},
+		{
+			"readiness flap",
+			func(pod *corev1.Pod) { pod.Status.Conditions[1].Status = corev1.ConditionFalse },
+			false,
+		},
+		{
+			"other container",
+			func(pod *corev1.Pod) {
+				pod.Status.ContainerStatuses = append(
+					pod.Status.ContainerStatuses,
+					corev1.ContainerStatus{Name: "sidecar", ContainerID: "docker://bbb"},
+				)
+			},
+			false,
+		},
+		{"phase", func(pod *corev1.Pod) { pod.Status.Phase = corev1.PodFailed }, true},
+		{"deleting", func(pod *corev1.Pod) { pod.DeletionTimestamp = &now }, true},
+		{
+			"unscheduled",
+			func(pod *corev1.Pod) { pod.Status.Conditions[0].Status = corev1.ConditionFalse },
+			true,
+		},
+		{
+			"container restarted",
+			func(pod *corev1.Pod) { pod.Status.ContainerStatuses[0].ContainerID = "docker://ccc" },
+			true,
+		},
+		{
+			"container terminated",
+			func(pod *corev1.Pod) {
+				pod.Status.ContainerStatuses[0].State = corev1.ContainerState{
+					Terminated: &corev1.ContainerStateTerminated{ExitCode: 1},
+				}
+			},
+			true,
+		},
+	}
+	for _, tc := range tests {
+		newPod := base.DeepCopy()
+		tc.modify(newPod)
+		update := event.UpdateEvent{
+			MetaOld:   base,
+			ObjectOld: base,
+			MetaNew:   newPod,
+			ObjectNew: newPod,
+		}
+		if got := podPredicate.Update(update); got != tc.want {
+			t.Errorf("%s: got %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestAppContainerSummary(t *testing.T) {
+
+	tests := []struct {
+		name string
+		pod  *corev1.Pod
+		want string
+	}{
+		{"running", testPod("docker://aaa", runningState), "docker://aaa=" + containerRunning},
+		{
+			"waiting",
+			testPod("", corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{}}),
+			"=" + containerWaiting,
+		},
+		{"unknown", testPod("docker://aaa", corev1.ContainerState{}), "docker://aaa=" + containerUnknown},
+		{"no app container", &corev1.Pod{}, ""},
+	}
+	for _, tc := range tests {
+		if got := appContainerSummary(tc.pod); got != tc.want {
+			t.Errorf("%s: got %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestPodToClusterRequest(t *testing.T) {
+
+	pod := testPod("docker://aaa", runningState)
+	requests := podToClusterRequest.Map(handler.MapObject{Meta: pod, Object: pod})
+	want := types.NamespacedName{Namespace: "ns", Name: "c1"}
+	if (len(requests) != 1) || (requests[0].NamespacedName != want) {
+		t.Errorf("labelled pod: got %v, want one request for %v", requests, want)
+	}
+
+	pod.Labels = nil
+	requests = podToClusterRequest.Map(handler.MapObject{Meta: pod, Object: pod})
+	if len(requests) != 0 {
+		t.Errorf("unlabelled pod: got %v, want no requests", requests)
+	}
+}
@@ -0,0 +1,306 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubedirectorcluster
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	"github.com/bluek8s/kubedirector/pkg/observer"
+	"github.com/bluek8s/kubedirector/pkg/shared"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Kinds of namespace limits that can block object creation, used as the
+// reason of the QuotaExceeded condition.
+const (
+	quotaKindResourceQuota = "ResourceQuota"
+	quotaKindLimitRange    = "LimitRange"
+)
+
+// failedCreateEventReason is the reason of the events that the statefulset
+// controller posts when it cannot create a pod or claim.
+const failedCreateEventReason = "FailedCreate"
+
+var (
+	// resourceQuotaRegexp matches the ResourceQuota admission error. Only
+	// the exceeded resources are listed in it.
+	resourceQuotaRegexp = regexp.MustCompile(
+		`exceeded quota: ([^,\s]+), requested: (\S+), used: (\S+), limited: ([^\s"\]]+)`,
+	)
+	// limitRangeRegexp matches a minimum or maximum violation in the
+	// LimitRange admission error.
+	limitRangeRegexp = regexp.MustCompile(
+		`(maximum|minimum) ([\w./-]+) usage per (\w+) is ([^,\s]+), but (limit|request) is ([^,\s"\]]+)`,
+	)
+	// limitRatioRegexp matches a limit to request ratio violation in the
+	// LimitRange admission error.
+	limitRatioRegexp = regexp.MustCompile(
+		`([\w./-]+) max limit to request ratio per (\w+) is ([^,\s]+), but provided ratio is ([^,\s"\]]+)`,
+	)
+)
+
+// statefulSetQuotaKey identifies a statefulset of a cluster.
+type statefulSetQuotaKey struct {
+	cluster     types.UID
+	statefulSet string
+}
+
+// statefulSetQuotaCheck remembers the outcome of the last look at the
+// events of a statefulset that is short of pods, so that the events are only
+// listed again when the shortfall changes or the result gets old.
+type statefulSetQuotaCheck struct {
+	shortfall int32
+	checkedAt time.Time
+	conflict  *quotaConflict
+}
+
+var (
+	statefulSetQuotaChecks     = make(map[statefulSetQuotaKey]*statefulSetQuotaCheck)
+	statefulSetQuotaChecksLock sync.Mutex
+)
+
+// quotaConflict describes the rejection of an object by a ResourceQuota or
+// LimitRange of the namespace.
+type quotaConflict struct {
+	object    string
+	kind      string
+	resources []string
+	detail    string
+}
+
+// parseQuotaConflict picks the offending limit, resources, and amounts out
+// of an error message from the quota or limit range admission plugins. It
+// returns nil if the message is not such an error.
+func parseQuotaConflict(
+	object string,
+	msg string,
+) *quotaConflict {
+
+	if match := resourceQuotaRegexp.FindStringSubmatch(msg); match != nil {
+		limited := strings.TrimRight(match[4], ".")
+		var resources []string
+		for _, pair := range strings.Split(limited, ",") {
+			resources = append(resources, strings.SplitN(pair, "=", 2)[0])
+		}
+		return &quotaConflict{
+			object:    object,
+			kind:      quotaKindResourceQuota,
+			resources: resources,
+			detail: fmt.Sprintf(
+				"ResourceQuota{%s} exceeded: requested %s, used %s, limited %s",
+				match[1],
+				match[2],
+				match[3],
+				limited,
+			),
+		}
+	}
+
+	var resources []string
+	var details []string
+	for _, match := range limitRangeRegexp.FindAllStringSubmatch(msg, -1) {
+		resources = append(resources, match[2])
+		details = append(
+			details,
+			fmt.Sprintf(
+				"%s %s per %s is %s, but %s is %s",
+				match[1],
+				match[2],
+				match[3],
+				match[4],
+				match[5],
+				strings.TrimRight(match[6], "."),
+			),
+		)
+	}
+	for _, match := range limitRatioRegexp.FindAllStringSubmatch(msg, -1) {
+		resources = append(resources, match[1])
+		details = append(
+			details,
+			fmt.Sprintf(
+				"%s limit to request ratio per %s is at most %s, but is %s",
+				match[1],
+				match[2],
+				match[3],
+				strings.TrimRight(match[4], "."),
+			),
+		)
+	}
+	if len(details) == 0 {
+		return nil
+	}
+	return &quotaConflict{
+		object:    object,
+		kind:      quotaKindLimitRange,
+		resources: resources,
+		detail:    "LimitRange violated: " + strings.Join(details, "; "),
+	}
+}
+
+// statefulSetQuotaConflicts looks for quota or limit range conflicts that
+// keep the statefulsets of the cluster's roles from creating member pods
+// and claims. These only show up as events on the statefulsets, so the
+// events are only read for a statefulset that is short of pods, and then
+// only when its shortfall has changed or quotaEventCheckPeriod has passed
+// since they were last read.
+func statefulSetQuotaConflicts(
+	cr *kdv1.KubeDirectorCluster,
+) []*quotaConflict {
+
+	statefulSetQuotaChecksLock.Lock()
+	defer statefulSetQuotaChecksLock.Unlock()
+	var conflicts []*quotaConflict
+	for _, roleStatus := range cr.Status.Roles {
+		if roleStatus.StatefulSet == "" {
+			continue
+		}
+		statefulSet, ssErr := observer.GetStatefulSet(cr.Namespace, roleStatus.StatefulSet)
+		if (ssErr != nil) || (statefulSet.Spec.Replicas == nil) {
+			continue
+		}
+		key := statefulSetQuotaKey{cluster: cr.UID, statefulSet: statefulSet.Name}
+		shortfall := *statefulSet.Spec.Replicas - statefulSet.Status.Replicas
+		if shortfall <= 0 {
+			delete(statefulSetQuotaChecks, key)
+			continue
+		}
+		check, ok := statefulSetQuotaChecks[key]
+		if ok && (check.shortfall == shortfall) &&
+			(time.Since(check.checkedAt) < quotaEventCheckPeriod) {
+			if check.conflict != nil {
+				conflicts = append(conflicts, check.conflict)
+			}
+			continue
+		}
+		check = &statefulSetQuotaCheck{
+			shortfall: shortfall,
+			checkedAt: time.Now(),
+		}
+		statefulSetQuotaChecks[key] = check
+		events, eventsErr := observer.GetStatefulSetEvents(cr.Namespace, statefulSet.Name)
+		if eventsErr != nil {
+			continue
+		}
+		var latest *corev1.Event
+		for i := range events {
+			event := &(events[i])
+			if (event.Type != corev1.EventTypeWarning) || (event.Reason != failedCreateEventReason) {
+				continue
+			}
+			if (latest == nil) || latest.LastTimestamp.Before(&event.LastTimestamp) {
+				latest = event
+			}
+		}
+		if latest == nil {
+			continue
+		}
+		conflict := parseQuotaConflict(
+			"members of role{"+roleStatus.Name+"}",
+			latest.Message,
+		)
+		if conflict != nil {
+			check.conflict = conflict
+			conflicts = append(conflicts, conflict)
+		}
+	}
+	return conflicts
+}
+
+// forgetStatefulSetQuotaChecks drops the remembered event checks of the
+// statefulsets of a deleted cluster.
+func forgetStatefulSetQuotaChecks(
+	cr *kdv1.KubeDirectorCluster,
+) {
+
+	statefulSetQuotaChecksLock.Lock()
+	defer statefulSetQuotaChecksLock.Unlock()
+	for key := range statefulSetQuotaChecks {
+		if key.cluster == cr.UID {
+			delete(statefulSetQuotaChecks, key)
+		}
+	}
+}
+
+// syncQuotaCondition sets the cluster's QuotaExceeded condition from the
+// quota or limit range conflicts currently blocking its objects: those that
+// failed the last attempt to create an object directly, and those reported
+// by its statefulsets.
+func syncQuotaCondition(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorCluster,
+) {
+
+	conflicts := createQuotaConflicts(cr)
+	conflicts = append(conflicts, statefulSetQuotaConflicts(cr)...)
+	if len(conflicts) == 0 {
+		shared.SetCondition(
+			&cr.Status.Conditions,
+			kdv1.ClusterQuotaExceeded,
+			corev1.ConditionFalse,
+			"",
+			"",
+		)
+		return
+	}
+	reportQuotaConflicts(reqLogger, cr, conflicts)
+}
+
+// reportQuotaConflicts sets the cluster's QuotaExceeded condition to true,
+// describing the given conflicts. A conflict that the condition did not
+// already describe is also logged, with a warning event, and counted in
+// the quota conflicts metric.
+func reportQuotaConflicts(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorCluster,
+	conflicts []*quotaConflict,
+) {
+
+	prevMessage := ""
+	if shared.ConditionIsTrue(cr.Status.Conditions, kdv1.ClusterQuotaExceeded) {
+		for _, condition := range cr.Status.Conditions {
+			if condition.Type == kdv1.ClusterQuotaExceeded {
+				prevMessage = condition.Message
+			}
+		}
+	}
+	var descs []string
+	for _, conflict := range conflicts {
+		desc := conflict.object + ": " + conflict.detail
+		descs = append(descs, desc)
+		if strings.Contains(prevMessage, desc) {
+			continue
+		}
+		msg := fmt.Sprintf("cannot create %s; %s", conflict.object, conflict.detail)
+		reqLogger.Info(msg)
+		shared.LogEvent(cr, corev1.EventTypeWarning, shared.EventReasonCluster, msg)
+		for _, resource := range conflict.resources {
+			shared.CountQuotaConflict(cr.Namespace, cr.Name, conflict.kind, resource)
+		}
+	}
+	shared.SetCondition(
+		&cr.Status.Conditions,
+		kdv1.ClusterQuotaExceeded,
+		corev1.ConditionTrue,
+		conflicts[0].kind,
+		strings.Join(descs, "; "),
+	)
+}
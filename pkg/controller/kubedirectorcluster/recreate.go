@@ -0,0 +1,338 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubedirectorcluster
+
+import (
+	"strings"
+
+	"github.com/go-logr/logr"
+
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	"github.com/bluek8s/kubedirector/pkg/executor"
+	"github.com/bluek8s/kubedirector/pkg/observer"
+	"github.com/bluek8s/kubedirector/pkg/shared"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// syncNamingSchemeChange carries out a change of the cluster's naming
+// scheme. The names of the cluster service and the role statefulsets come
+// from the naming scheme, and a statefulset can't be renamed (nor can its
+// selector be changed), so the change is made by re-creating them. Once the
+// cluster is settled, the cluster service is deleted and every role's
+// statefulset is deleted along with its members. The usual handling of a
+// missing cluster service or statefulset then creates new ones with the new
+// names, and the new members get clones of the persistent volumes of the
+// old members with the same statefulset index (see migrateMemberVolumes).
+// When all the new members are ready the old volumes are deleted. Returns
+// false if the rest of this handler pass should be skipped.
+func syncNamingSchemeChange(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorCluster,
+) bool {
+
+	// A cluster from before the naming scheme was recorded must have been
+	// created with its current one.
+	if cr.Status.NamingScheme == "" {
+		cr.Status.NamingScheme = *(cr.Spec.NamingScheme)
+		return true
+	}
+	if cr.Status.NamingScheme == *(cr.Spec.NamingScheme) {
+		return true
+	}
+	if !shared.ConditionIsTrue(cr.Status.Conditions, kdv1.ClusterRecreating) {
+		if !recreateCanStart(cr) {
+			return true
+		}
+		// Let every member shut down cleanly before anything is torn down.
+		allStopped := true
+		for i := range cr.Status.Roles {
+			roleStatus := &(cr.Status.Roles[i])
+			if (roleStatus.StatefulSet == "") || (roleStatus.PreviousStatefulSet != "") {
+				continue
+			}
+			if !stopRoleMembers(reqLogger, cr, roleStatus, stopReasonRecreate) {
+				allStopped = false
+			}
+		}
+		if !allStopped {
+			return false
+		}
+		if cr.Status.ClusterService != "" {
+			deleteErr := executor.DeleteHeadlessService(
+				cr.Namespace,
+				cr.Status.ClusterService,
+			)
+			if (deleteErr != nil) && !apierrors.IsNotFound(deleteErr) {
+				shared.LogErrorf(
+					reqLogger,
+					deleteErr,
+					cr,
+					shared.EventReasonCluster,
+					"failed to delete cluster service{%s}",
+					cr.Status.ClusterService,
+				)
+				return false
+			}
+			cr.Status.ClusterService = ""
+		}
+		// Nothing is created while this is incomplete, so a role that still
+		// has its statefulset and no previous one is always an old role.
+		for i := range cr.Status.Roles {
+			roleStatus := &(cr.Status.Roles[i])
+			if (roleStatus.StatefulSet == "") || (roleStatus.PreviousStatefulSet != "") {
+				continue
+			}
+			if !tearDownRole(reqLogger, cr, roleStatus) {
+				return false
+			}
+		}
+		shared.LogInfof(
+			reqLogger,
+			cr,
+			shared.EventReasonCluster,
+			"re-creating cluster objects to change naming scheme from %s to %s",
+			cr.Status.NamingScheme,
+			*(cr.Spec.NamingScheme),
+		)
+		shared.SetCondition(
+			&cr.Status.Conditions,
+			kdv1.ClusterRecreating,
+			corev1.ConditionTrue,
+			"NamingSchemeChanged",
+			"re-creating services and statefulsets for naming scheme "+*(cr.Spec.NamingScheme),
+		)
+		return false
+	}
+
+	// Wait for every re-created role to have its new members ready.
+	for i := range cr.Status.Roles {
+		roleStatus := &(cr.Status.Roles[i])
+		if roleStatus.PreviousStatefulSet == "" {
+			continue
+		}
+		if roleStatus.StatefulSet == roleStatus.PreviousStatefulSet {
+			return true
+		}
+		for _, member := range roleStatus.Members {
+			if (member.State != string(memberReady)) &&
+				(member.State != string(memberConfigError)) {
+				return true
+			}
+		}
+	}
+
+	// All done. The old volumes are no longer needed.
+	for i := range cr.Status.Roles {
+		roleStatus := &(cr.Status.Roles[i])
+		for _, previous := range roleStatus.PreviousMembers {
+			for _, pvcName := range previous.PVCs {
+				pvcDelErr := executor.DeletePVC(cr.Namespace, pvcName)
+				if (pvcDelErr != nil) && !apierrors.IsNotFound(pvcDelErr) {
+					shared.LogErrorf(
+						reqLogger,
+						pvcDelErr,
+						cr,
+						shared.EventReasonRole,
+						"failed to delete PVC{%s}",
+						pvcName,
+					)
+					return true
+				}
+			}
+		}
+		roleStatus.PreviousStatefulSet = ""
+		roleStatus.PreviousMembers = nil
+	}
+	shared.LogInfof(
+		reqLogger,
+		cr,
+		shared.EventReasonCluster,
+		"naming scheme changed to %s",
+		*(cr.Spec.NamingScheme),
+	)
+	cr.Status.NamingScheme = *(cr.Spec.NamingScheme)
+	shared.SetCondition(
+		&cr.Status.Conditions,
+		kdv1.ClusterRecreating,
+		corev1.ConditionFalse,
+		"Recreated",
+		"",
+	)
+	return true
+}
+
+// recreateCanStart reports whether the cluster is settled enough for its
+// objects to be re-created: configured, with no membership change queued
+// and no role in the middle of a storage change, upgrade, or restart.
+func recreateCanStart(
+	cr *kdv1.KubeDirectorCluster,
+) bool {
+
+	if (cr.Status.State != string(clusterReady)) || (len(cr.Status.Operations) > 1) {
+		return false
+	}
+	busyConditions := []string{
+		kdv1.RoleStorageExpanding,
+		kdv1.RoleBlockStorageChanging,
+		kdv1.RoleUpgrading,
+		kdv1.RoleRestarting,
+	}
+	for _, roleStatus := range cr.Status.Roles {
+		for _, conditionType := range busyConditions {
+			if shared.ConditionIsTrue(roleStatus.Conditions, conditionType) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// tearDownRole deletes the statefulset of a role that is being re-created,
+// and the role's own headless service if it has one. The role's members are
+// recorded as its previous members and moved straight to the deleting state;
+// every member of the cluster is going away, so there is no one to notify.
+// Their PVCs are left for migrateMemberVolumes to clone. Returns false if a
+// deletion failed.
+func tearDownRole(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorCluster,
+	roleStatus *kdv1.RoleStatus,
+) bool {
+
+	deleteErr := executor.DeleteStatefulSet(cr.Namespace, roleStatus.StatefulSet)
+	if (deleteErr != nil) && !apierrors.IsNotFound(deleteErr) {
+		shared.LogErrorf(
+			reqLogger,
+			deleteErr,
+			cr,
+			shared.EventReasonRole,
+			"failed to delete StatefulSet{%s}",
+			roleStatus.StatefulSet,
+		)
+		return false
+	}
+	if roleStatus.Subdomain != "" {
+		svcDelErr := executor.DeleteHeadlessService(cr.Namespace, roleStatus.Subdomain)
+		if (svcDelErr != nil) && !apierrors.IsNotFound(svcDelErr) {
+			shared.LogErrorf(
+				reqLogger,
+				svcDelErr,
+				cr,
+				shared.EventReasonRole,
+				"failed to delete headless service{%s}",
+				roleStatus.Subdomain,
+			)
+			return false
+		}
+		roleStatus.Subdomain = ""
+	}
+	shared.LogInfof(
+		reqLogger,
+		cr,
+		shared.EventReasonRole,
+		"deleted StatefulSet{%s} of role{%s} for re-creation",
+		roleStatus.StatefulSet,
+		roleStatus.Name,
+	)
+
+	var roleSpec *kdv1.Role
+	for i := range cr.Spec.Roles {
+		if cr.Spec.Roles[i].Name == roleStatus.Name {
+			roleSpec = &(cr.Spec.Roles[i])
+			break
+		}
+	}
+	roleStatus.PreviousStatefulSet = roleStatus.StatefulSet
+	roleStatus.PreviousMembers = nil
+	for i := range roleStatus.Members {
+		member := &(roleStatus.Members[i])
+		if member.Pod == "" {
+			continue
+		}
+		previous := kdv1.PreviousMember{Pod: member.Pod}
+		if member.PVC != "" {
+			previous.PVCs = append(previous.PVCs, member.PVC)
+		}
+		if roleSpec != nil {
+			previous.PVCs = append(
+				previous.PVCs,
+				executor.MemberBlockPVCNames(roleSpec, member.Pod)...,
+			)
+		}
+		roleStatus.PreviousMembers = append(roleStatus.PreviousMembers, previous)
+		member.PVC = ""
+		member.State = string(memberDeleting)
+	}
+	return true
+}
+
+// migrateMemberVolumes creates, for each create pending member of a role
+// that is being re-created, PVCs cloned from the volumes of the previous
+// member with the same statefulset index. The statefulset uses these PVCs
+// instead of provisioning empty ones. Cloning requires a CSI driver that
+// supports it; until the clones can be made, the members are not created.
+func migrateMemberVolumes(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorCluster,
+	role *roleInfo,
+) error {
+
+	if len(role.roleStatus.PreviousMembers) == 0 {
+		return nil
+	}
+	for _, member := range role.membersByState[memberCreatePending] {
+		index := member.Pod[strings.LastIndex(member.Pod, "-"):]
+		var previous *kdv1.PreviousMember
+		for i := range role.roleStatus.PreviousMembers {
+			if strings.HasSuffix(role.roleStatus.PreviousMembers[i].Pod, index) {
+				previous = &(role.roleStatus.PreviousMembers[i])
+				break
+			}
+		}
+		if previous == nil {
+			continue
+		}
+		if member.StateDetail.ClonedFrom == "" {
+			shared.LogInfof(
+				reqLogger,
+				cr,
+				shared.EventReasonMember,
+				"migrating volumes of member{%s} from previous member{%s}",
+				member.Pod,
+				previous.Pod,
+			)
+		}
+		for _, pvcName := range previous.PVCs {
+			pvc, pvcErr := observer.GetPVC(cr.Namespace, pvcName)
+			if pvcErr != nil {
+				return pvcErr
+			}
+			size := pvc.Spec.Resources.Requests[corev1.ResourceStorage]
+			createErr := executor.CreatePVCFromSource(
+				role.statefulSet,
+				strings.TrimSuffix(pvcName, "-"+previous.Pod),
+				member.Pod,
+				executor.PVCSource(pvcName),
+				size.String(),
+			)
+			if createErr != nil {
+				return createErr
+			}
+		}
+		member.StateDetail.ClonedFrom = previous.Pod
+	}
+	return nil
+}
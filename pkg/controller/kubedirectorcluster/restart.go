@@ -0,0 +1,320 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubedirectorcluster
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/go-logr/logr"
+
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	"github.com/bluek8s/kubedirector/pkg/catalog"
+	"github.com/bluek8s/kubedirector/pkg/executor"
+	"github.com/bluek8s/kubedirector/pkg/shared"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// initialRestartStatus returns the restart status for a newly created role.
+// Any restart generation already in the spec is treated as done, since the
+// members are about to start for the first time anyway.
+func initialRestartStatus(
+	roleSpec *kdv1.Role,
+) *kdv1.RoleRestartStatus {
+
+	if roleSpec.Restart == nil {
+		return nil
+	}
+	return &kdv1.RoleRestartStatus{Generation: roleSpec.Restart.Generation}
+}
+
+// syncRoleRestarts carries out the member restarts requested through the
+// restart generation of each role spec. Failure here will not be treated as
+// a reconciler-stopping error; we'll just try again next time.
+func syncRoleRestarts(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorCluster,
+	roles []*roleInfo,
+) {
+
+	for _, role := range roles {
+		if (role.roleStatus == nil) || (role.roleSpec == nil) {
+			continue
+		}
+		if (role.roleSpec.Restart == nil) && (role.roleStatus.Restart == nil) {
+			continue
+		}
+		if role.roleStatus.Restart == nil {
+			role.roleStatus.Restart = &kdv1.RoleRestartStatus{}
+		}
+		queueRoleRestart(reqLogger, cr, role)
+		if !checkRoleRestart(reqLogger, cr, role) {
+			continue
+		}
+		startRoleRestart(reqLogger, cr, role)
+	}
+}
+
+// queueRoleRestart adds the requested members to the role's pending restart
+// list if the restart generation in the spec has been increased. Members
+// are restarted in descending ordinal order, as for a rolling update of the
+// statefulset.
+func queueRoleRestart(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorCluster,
+	role *roleInfo,
+) {
+
+	spec := role.roleSpec.Restart
+	status := role.roleStatus.Restart
+	if (spec == nil) || (spec.Generation <= status.Generation) {
+		return
+	}
+	status.Generation = spec.Generation
+	members := role.roleStatus.Members
+	for i := len(members) - 1; i >= 0; i-- {
+		podName := members[i].Pod
+		state := memberState(members[i].State)
+		if (podName == "") || (state == memberDeletePending) || (state == memberDeleting) {
+			continue
+		}
+		if (len(spec.Members) != 0) && !shared.StringInList(podName, spec.Members) {
+			continue
+		}
+		if (podName == status.Member) || shared.StringInList(podName, status.Pending) {
+			continue
+		}
+		status.Pending = append(status.Pending, podName)
+	}
+	shared.LogInfof(
+		reqLogger,
+		cr,
+		shared.EventReasonRole,
+		"restart generation %d requested for role{%s}; restarting members %s",
+		spec.Generation,
+		role.roleStatus.Name,
+		strings.Join(status.Pending, ", "),
+	)
+	shared.SetCondition(
+		&role.roleStatus.Conditions,
+		kdv1.RoleRestarting,
+		corev1.ConditionTrue,
+		"RestartRequested",
+		fmt.Sprintf(
+			"restarting members for restart generation %d",
+			spec.Generation,
+		),
+	)
+}
+
+// checkRoleRestart follows the member currently being restarted, if any.
+// The restart of a member is done when it has been configured in a new
+// container, or when the member has gone away. If the restarted member ends
+// up in config error state, the remaining restarts are abandoned. Returns
+// true if another member can be restarted now.
+func checkRoleRestart(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorCluster,
+	role *roleInfo,
+) bool {
+
+	status := role.roleStatus.Restart
+	if status.Member == "" {
+		return true
+	}
+	var member *kdv1.MemberStatus
+	for i := range role.roleStatus.Members {
+		if role.roleStatus.Members[i].Pod == status.Member {
+			member = &(role.roleStatus.Members[i])
+			break
+		}
+	}
+	if member != nil {
+		state := memberState(member.State)
+		if (state != memberDeletePending) && (state != memberDeleting) {
+			if (state != memberReady) && (state != memberConfigError) {
+				return false
+			}
+			if member.StateDetail.LastConfiguredContainer == status.PreviousContainer {
+				return false
+			}
+			if state == memberConfigError {
+				shared.LogErrorf(
+					reqLogger,
+					errors.New("member in config error state"),
+					cr,
+					shared.EventReasonMember,
+					"restart of member{%s} failed; abandoning restart of members %s",
+					status.Member,
+					strings.Join(status.Pending, ", "),
+				)
+				shared.SetCondition(
+					&role.roleStatus.Conditions,
+					kdv1.RoleRestarting,
+					corev1.ConditionFalse,
+					"RestartFailed",
+					fmt.Sprintf(
+						"member %s failed to configure after restart",
+						status.Member,
+					),
+				)
+				status.Member = ""
+				status.PreviousContainer = ""
+				status.Pending = nil
+				return false
+			}
+			shared.LogInfof(
+				reqLogger,
+				cr,
+				shared.EventReasonMember,
+				"restart of member{%s} complete",
+				status.Member,
+			)
+		}
+	}
+	status.Member = ""
+	status.PreviousContainer = ""
+	return true
+}
+
+// startRoleRestart restarts the next pending member of the role, by
+// deleting its pod so that the statefulset recreates it. This is only done
+// while every other member of the role is settled and the role is not being
+// upgraded, so that at most one member is down at a time.
+func startRoleRestart(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorCluster,
+	role *roleInfo,
+) {
+
+	status := role.roleStatus.Restart
+	if len(status.Pending) == 0 {
+		if shared.ConditionIsTrue(role.roleStatus.Conditions, kdv1.RoleRestarting) {
+			shared.LogInfof(
+				reqLogger,
+				cr,
+				shared.EventReasonRole,
+				"restart of role{%s} complete",
+				role.roleStatus.Name,
+			)
+			shared.SetCondition(
+				&role.roleStatus.Conditions,
+				kdv1.RoleRestarting,
+				corev1.ConditionFalse,
+				"Restarted",
+				"all requested members have been restarted",
+			)
+		}
+		return
+	}
+	if !allRoleMembersReadyOrError(cr, role) ||
+		shared.ConditionIsTrue(role.roleStatus.Conditions, kdv1.RoleUpgrading) {
+		return
+	}
+	for len(status.Pending) != 0 {
+		podName := status.Pending[0]
+		var member *kdv1.MemberStatus
+		for i := range role.roleStatus.Members {
+			if role.roleStatus.Members[i].Pod == podName {
+				member = &(role.roleStatus.Members[i])
+				break
+			}
+		}
+		if (member == nil) ||
+			((member.State != string(memberReady)) && (member.State != string(memberConfigError))) {
+			// Member has gone away since it was queued.
+			status.Pending = status.Pending[1:]
+			continue
+		}
+		if !stopMember(reqLogger, cr, role.roleStatus.Name, member, stopReasonRestart, true) {
+			return
+		}
+		status.Pending = status.Pending[1:]
+		status.Member = podName
+		status.PreviousContainer = member.StateDetail.LastConfiguredContainer
+		return
+	}
+}
+
+// memberRestarting reports whether the given member is the one currently
+// being restarted through its role's restart generation.
+func memberRestarting(
+	cr *kdv1.KubeDirectorCluster,
+	roleName string,
+	podName string,
+) bool {
+
+	for _, roleStatus := range cr.Status.Roles {
+		if roleStatus.Name == roleName {
+			return (roleStatus.Restart != nil) && (roleStatus.Restart.Member == podName)
+		}
+	}
+	return false
+}
+
+// appRestart runs the restart event of the setup package on a member that
+// has come back in a new container after being restarted through its role's
+// restart generation, if the role has registered for that event. Like the
+// initial configure, the event runs asynchronously and its result is picked
+// up from the status file by appConfig on a later pass. The returned bool
+// is true if the event was started.
+func appRestart(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorCluster,
+	podName string,
+	expectedContainerID string,
+	roleName string,
+) (bool, error) {
+
+	if !memberRestarting(cr, roleName, podName) {
+		return false, nil
+	}
+	appCr, appErr := catalog.GetApp(cr)
+	if appErr != nil {
+		return false, appErr
+	}
+	role := catalog.GetRoleFromID(appCr, roleName)
+	if (role == nil) || (role.EventList == nil) ||
+		!shared.StringInList(restartEvent, *role.EventList) {
+		return false, nil
+	}
+	shared.LogInfof(
+		reqLogger,
+		cr,
+		shared.EventReasonMember,
+		"running restart on member{%s}",
+		podName,
+	)
+	cmd := fmt.Sprintf(
+		appPrepConfigRestartCmd,
+		expectedContainerID,
+		quotedHookPrefix(cr, roleName),
+	)
+	cmdErr := executor.RunScript(
+		reqLogger,
+		cr,
+		cr.Namespace,
+		podName,
+		expectedContainerID,
+		executor.AppContainerName,
+		"app restart",
+		strings.NewReader(cmd),
+	)
+	if cmdErr != nil {
+		return false, cmdErr
+	}
+	return true, nil
+}
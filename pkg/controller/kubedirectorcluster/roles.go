@@ -17,6 +17,7 @@ package kubedirectorcluster
 import (
 	"fmt"
 	"strconv"
+	"strings"
 	"sync/atomic"
 
 	"github.com/go-logr/logr"
@@ -25,7 +26,10 @@ import (
 	"github.com/bluek8s/kubedirector/pkg/executor"
 	"github.com/bluek8s/kubedirector/pkg/observer"
 	"github.com/bluek8s/kubedirector/pkg/shared"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
 )
 
 // syncClusterRoles is responsible for dealing with roles being changed, added,
@@ -56,6 +60,10 @@ func syncClusterRoles(
 		}
 	}
 
+	// Make the K8s objects for any new roles all at once, rather than one
+	// role at a time in the loop below.
+	precreateRoles(reqLogger, cr, roles)
+
 	// Assume cluster is stable until found otherwise.
 	allMembersReady := true
 	anyMembersChanged := false
@@ -68,6 +76,7 @@ func syncClusterRoles(
 			createErr := handleRoleCreate(
 				reqLogger, cr, r, &anyMembersChanged)
 			if createErr != nil {
+				recordPrecreatedRoles(reqLogger, cr, roles, &anyMembersChanged)
 				return nil, clusterMembersUnknown, createErr
 			}
 		case r.statefulSet == nil && r.roleStatus != nil:
@@ -82,6 +91,23 @@ func syncClusterRoles(
 			// First see if we need to reconcile any out-of-band statefulset
 			// changes.
 			handleRoleConfig(reqLogger, cr, r)
+			// Grow the member storage if the role's storage size has been
+			// increased. If this leaves the role without a statefulset,
+			// pick it up again on the next pass.
+			if !handleRoleStorageExpansion(reqLogger, cr, r) {
+				allMembersReady = false
+				continue
+			}
+			// Likewise for the role's block devices, which may also have
+			// been added to.
+			if !handleRoleBlockStorageChange(reqLogger, cr, r) {
+				allMembersReady = false
+				continue
+			}
+			// Roll the members onto new images if the app has changed.
+			handleRoleUpgrade(reqLogger, cr, r)
+			// Note whether the pod template is still out of date.
+			updateRoleTemplateCondition(r)
 			// Now check for desired changes in role population.
 			if len(r.roleStatus.Members) == 0 && r.desiredPop == 0 {
 				// Role is going away and we have finished removing pods.
@@ -133,9 +159,10 @@ func initRoleInfo(
 	numRoleSpecs := len(cr.Spec.Roles)
 	numRoleStatuses := len(cr.Status.Roles)
 
-	// Capture the desired roles and member count in the spec. The fields
-	// statefulSet, roleStatus, and membersByState may be populated later
-	// in this function.
+	// Capture the desired roles in the spec, and the member count for each
+	// from the active membership operation. The fields statefulSet,
+	// roleStatus, and membersByState may be populated later in this
+	// function.
 	for i := 0; i < numRoleSpecs; i++ {
 		roleSpec := &(cr.Spec.Roles[i])
 		roles[roleSpec.Name] = &roleInfo{
@@ -143,7 +170,7 @@ func initRoleInfo(
 			roleSpec:       roleSpec,
 			roleStatus:     nil,
 			membersByState: make(map[memberState][]*kdv1.MemberStatus),
-			desiredPop:     int(*(roleSpec.Members)),
+			desiredPop:     activeTarget(cr, roleSpec),
 		}
 	}
 
@@ -183,6 +210,12 @@ func initRoleInfo(
 				return nil, statefulSetErr
 			}
 		}
+		if (statefulSet != nil) && (statefulSet.DeletionTimestamp != nil) &&
+			replacingStatefulSet(roleStatus) {
+			// We deleted this statefulset to replace it, and it has not
+			// gone away yet. Treat it as already gone.
+			statefulSet = nil
+		}
 		if role, ok := roles[roleStatus.Name]; ok {
 			// This role is in the spec. Update the roleinfo with the
 			// statefulset pointer (if any) and the role status pointer.
@@ -204,13 +237,14 @@ func initRoleInfo(
 			}
 		} else {
 			// This is not a role desired in the spec. Create a new info
-			// entry with desired member count at zero.
+			// entry with desired member count at zero, unless its removal
+			// is waiting for approval.
 			roles[roleStatus.Name] = &roleInfo{
 				statefulSet:    statefulSet,
 				roleSpec:       nil,
 				roleStatus:     roleStatus,
 				membersByState: make(map[memberState][]*kdv1.MemberStatus),
-				desiredPop:     0,
+				desiredPop:     removedRoleTarget(cr, roleStatus),
 			}
 		}
 	}
@@ -260,6 +294,124 @@ func handleRoleCreate(
 		return nil
 	}
 
+	// The objects may already have been made by precreateRoles.
+	objects := role.precreated
+	role.precreated = nil
+	if objects == nil {
+		objects = createRoleObjects(reqLogger, cr, role)
+	}
+	if objects.err != nil {
+		return objects.err
+	}
+	statefulSet := objects.statefulSet
+	serviceAccount := objects.serviceAccount
+	subdomain := objects.subdomain
+
+	// OK we have the statefulset, so set up the role and member status.
+	*anyMembersChanged = true
+	role.statefulSet = statefulSet
+	if role.roleStatus == nil {
+		newRoleStatus := kdv1.RoleStatus{
+			Name:           role.roleSpec.Name,
+			StatefulSet:    statefulSet.Name,
+			Members:        make([]kdv1.MemberStatus, 0, role.desiredPop),
+			ServiceAccount: serviceAccount,
+			Subdomain:      subdomain,
+			Restart:        initialRestartStatus(role.roleSpec),
+		}
+		// cr.Status.Roles was created with enough capacity to avoid
+		// realloc, so we can safely grow it w/o disturbing our
+		// pointers to its elements.
+		cr.Status.Roles = append(cr.Status.Roles, newRoleStatus)
+		role.roleStatus = &(cr.Status.Roles[len(cr.Status.Roles)-1])
+		noteRuntimeSocketGranted(cr, role.roleSpec)
+	} else {
+		role.roleStatus.StatefulSet = statefulSet.Name
+		role.roleStatus.ServiceAccount = serviceAccount
+		role.roleStatus.Subdomain = subdomain
+	}
+	role.roleStatus.Persistence = executor.StatefulSetPersistence(statefulSet)
+	addMemberStatuses(cr, role)
+	return nil
+}
+
+// noteRuntimeSocketGranted posts a warning event, and adds an audit record,
+// when a role that has access to a container runtime socket is created.
+func noteRuntimeSocketGranted(
+	cr *kdv1.KubeDirectorCluster,
+	roleSpec *kdv1.Role,
+) {
+
+	if roleSpec.RuntimeSocket == nil {
+		return
+	}
+	detail := fmt.Sprintf(
+		"role{%s} source{%s}",
+		roleSpec.Name,
+		roleSpec.RuntimeSocket.Source,
+	)
+	shared.LogEventf(
+		cr,
+		corev1.EventTypeWarning,
+		shared.EventReasonRole,
+		"container runtime socket granted to %s",
+		detail,
+	)
+	addAuditRecord(cr, kdv1.AuditRuntimeSocketGranted, cr.Status.Creator, detail)
+}
+
+// precreateRoles makes the K8s objects for every new role that needs
+// members, running the creations concurrently so that a cluster with many
+// roles gets its first pods sooner. The results are picked up by
+// handleRoleCreate.
+func precreateRoles(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorCluster,
+	roles []*roleInfo,
+) {
+
+	var creates []func()
+	for _, r := range roles {
+		if (r.statefulSet != nil) || (r.roleStatus != nil) || (r.desiredPop == 0) {
+			continue
+		}
+		role := r
+		creates = append(
+			creates,
+			func() {
+				role.precreated = createRoleObjects(reqLogger, cr, role)
+			},
+		)
+	}
+	runBounded(creates)
+}
+
+// recordPrecreatedRoles sets up the status of every new role whose objects
+// were made by precreateRoles, when the roles loop is stopped early by an
+// error. Otherwise the objects would be forgotten.
+func recordPrecreatedRoles(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorCluster,
+	roles []*roleInfo,
+	anyMembersChanged *bool,
+) {
+
+	for _, r := range roles {
+		if (r.precreated != nil) && (r.precreated.err == nil) {
+			handleRoleCreate(reqLogger, cr, r, anyMembersChanged)
+		}
+	}
+}
+
+// createRoleObjects makes the K8s objects for a new role: its service
+// account and headless service if it needs them, and its statefulset. Any
+// error is returned in the result.
+func createRoleObjects(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorCluster,
+	role *roleInfo,
+) *roleObjects {
+
 	shared.LogInfof(
 		reqLogger,
 		cr,
@@ -270,17 +422,93 @@ func handleRoleCreate(
 
 	nativeSystemdSupport := shared.GetNativeSystemdSupport()
 
+	// If the role uses workload identity, its service account must exist
+	// before any member pods can be created.
+	serviceAccount := ""
+	if role.roleSpec.WorkloadIdentity != nil {
+		var saName string
+		saErr := createWithBackoff(
+			reqLogger,
+			cr,
+			"service account for role{"+role.roleSpec.Name+"}",
+			func() error {
+				var err error
+				saName, err = executor.EnsureWorkloadIdentityServiceAccount(
+					reqLogger,
+					cr,
+					role.roleSpec,
+				)
+				return err
+			},
+		)
+		if saErr != nil {
+			shared.LogErrorf(
+				reqLogger,
+				saErr,
+				cr,
+				shared.EventReasonRole,
+				"failed to create service account for role{%s}",
+				role.roleSpec.Name,
+			)
+			return &roleObjects{err: saErr}
+		}
+		serviceAccount = saName
+	}
+
+	// Likewise, a role with its own DNS subdomain needs its headless
+	// service, which will govern the statefulset.
+	subdomain := ""
+	if role.roleSpec.RoleSubdomain {
+		var svcName string
+		svcErr := createWithBackoff(
+			reqLogger,
+			cr,
+			"headless service for role{"+role.roleSpec.Name+"}",
+			func() error {
+				var err error
+				svcName, err = executor.EnsureRoleHeadlessService(
+					reqLogger,
+					cr,
+					role.roleSpec,
+				)
+				return err
+			},
+		)
+		if svcErr != nil {
+			shared.LogErrorf(
+				reqLogger,
+				svcErr,
+				cr,
+				shared.EventReasonRole,
+				"failed to create headless service for role{%s}",
+				role.roleSpec.Name,
+			)
+			return &roleObjects{err: svcErr}
+		}
+		subdomain = svcName
+	}
+
 	// Create the associated statefulset.
-	statefulSet, createErr := executor.CreateStatefulSet(
+	var statefulSet *appsv1.StatefulSet
+	createErr := createWithBackoff(
 		reqLogger,
 		cr,
-		nativeSystemdSupport,
-		role.roleSpec,
-		role.roleStatus,
+		"StatefulSet for role{"+role.roleSpec.Name+"}",
+		func() error {
+			var err error
+			statefulSet, err = executor.CreateStatefulSet(
+				reqLogger,
+				cr,
+				nativeSystemdSupport,
+				role.roleSpec,
+				role.roleStatus,
+			)
+			return err
+		},
 	)
 	if createErr != nil {
-		// Not much to do if we can't create it... we'll just keep trying
-		// on every run through the reconciler.
+		// Not much to do if we can't create it... we'll keep trying, with
+		// backoff, on later runs through the reconciler.
 		shared.LogErrorf(
 			reqLogger,
 			createErr,
@@ -289,28 +517,13 @@ func handleRoleCreate(
 			"failed to create StatefulSet for role{%s}",
 			role.roleSpec.Name,
 		)
-		return createErr
+		return &roleObjects{err: createErr}
 	}
-
-	// OK we have the statefulset, so set up the role and member status.
-	*anyMembersChanged = true
-	role.statefulSet = statefulSet
-	if role.roleStatus == nil {
-		newRoleStatus := kdv1.RoleStatus{
-			Name:        role.roleSpec.Name,
-			StatefulSet: statefulSet.Name,
-			Members:     make([]kdv1.MemberStatus, 0, role.desiredPop),
-		}
-		// cr.Status.Roles was created with enough capacity to avoid
-		// realloc, so we can safely grow it w/o disturbing our
-		// pointers to its elements.
-		cr.Status.Roles = append(cr.Status.Roles, newRoleStatus)
-		role.roleStatus = &(cr.Status.Roles[len(cr.Status.Roles)-1])
-	} else {
-		role.roleStatus.StatefulSet = statefulSet.Name
+	return &roleObjects{
+		serviceAccount: serviceAccount,
+		subdomain:      subdomain,
+		statefulSet:    statefulSet,
 	}
-	addMemberStatuses(cr, role)
-	return nil
 }
 
 // handleRoleReCreate deals with the unusual-but-possible case of the role
@@ -324,6 +537,13 @@ func handleRoleReCreate(
 	anyMembersChanged *bool,
 ) error {
 
+	if role.roleSpec != nil && len(role.roleStatus.Members) != 0 &&
+		replacingStatefulSet(role.roleStatus) {
+		// The statefulset was deleted by us, orphaning its pods, to replace
+		// it with one that has different storage claim templates. Finish
+		// that job rather than tearing down the members.
+		return handleRoleStorageRestore(reqLogger, cr, role)
+	}
 	if len(role.roleStatus.Members) == 0 {
 		// No lingering pod status to deal with.
 		if role.desiredPop == 0 {
@@ -386,11 +606,37 @@ func handleRoleConfig(
 	role *roleInfo,
 ) {
 
+	// Work out what the pod template should look like now. Later steps
+	// compare this hash against the one recorded on the statefulset rather
+	// than comparing the templates themselves.
+	if role.roleSpec != nil {
+		templateHash, hashErr := executor.DesiredPodTemplateHash(
+			reqLogger,
+			cr,
+			role.roleSpec,
+			role.roleStatus,
+		)
+		if hashErr != nil {
+			shared.LogErrorf(
+				reqLogger,
+				hashErr,
+				cr,
+				shared.EventReasonRole,
+				"failed to generate pod template for role{%s}",
+				role.roleStatus.Name,
+			)
+			return
+		}
+		role.roleStatus.PodTemplateHash = templateHash
+	}
+
 	updateErr := executor.UpdateStatefulSetNonReplicas(
 		reqLogger,
 		cr,
 		role.roleSpec,
-		role.statefulSet)
+		role.statefulSet,
+		role.roleStatus.PodTemplateHash,
+	)
 	if updateErr != nil {
 		shared.LogErrorf(
 			reqLogger,
@@ -401,6 +647,249 @@ func handleRoleConfig(
 			role.statefulSet.Name,
 		)
 	}
+
+	// Keep the persistence summary current; it may be missing for roles
+	// created by an older KubeDirector, or stale after a storage expansion.
+	role.roleStatus.Persistence = executor.StatefulSetPersistence(role.statefulSet)
+
+	// Repair the role's own headless service, if any.
+	if (role.roleSpec != nil) && (role.roleStatus.Subdomain != "") {
+		_, svcErr := executor.EnsureRoleHeadlessService(
+			reqLogger,
+			cr,
+			role.roleSpec,
+		)
+		if svcErr != nil {
+			shared.LogErrorf(
+				reqLogger,
+				svcErr,
+				cr,
+				shared.EventReasonRole,
+				"failed to update headless service{%s}",
+				role.roleStatus.Subdomain,
+			)
+		}
+	}
+
+	// Also repair the workload identity service account, if any. Skip this
+	// for a role that is going away entirely.
+	if role.roleSpec == nil || role.roleSpec.WorkloadIdentity == nil {
+		return
+	}
+	if role.roleStatus == nil ||
+		(len(role.roleStatus.Members) == 0 && role.desiredPop == 0) {
+		return
+	}
+	saName, saErr := executor.EnsureWorkloadIdentityServiceAccount(
+		reqLogger,
+		cr,
+		role.roleSpec,
+	)
+	if saErr != nil {
+		shared.LogErrorf(
+			reqLogger,
+			saErr,
+			cr,
+			shared.EventReasonRole,
+			"failed to update service account{%s}",
+			saName,
+		)
+		return
+	}
+	role.roleStatus.ServiceAccount = saName
+}
+
+// handleRoleStorageExpansion checks whether the role's persistent storage
+// size has been increased, and if so requests the larger size for each member
+// PVC and replaces the statefulset so that future members also get the larger
+// size. The role's StorageExpanding condition tracks the process until every
+// member PVC reports the new capacity. Failure here will not be treated as a
+// reconciler-stopping error; we'll just try again next time. The return value
+// is false if the role has been left without a statefulset.
+func handleRoleStorageExpansion(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorCluster,
+	role *roleInfo,
+) bool {
+
+	if role.roleSpec == nil || role.roleSpec.Storage == nil {
+		return true
+	}
+	desiredSize, parseErr := resource.ParseQuantity(role.roleSpec.Storage.Size)
+	if parseErr != nil {
+		return true
+	}
+	currentSize := executor.StatefulSetStorageSize(role.statefulSet)
+	if currentSize == nil {
+		return true
+	}
+	expanding := shared.ConditionIsTrue(role.roleStatus.Conditions, kdv1.RoleStorageExpanding)
+	if currentSize.Cmp(desiredSize) >= 0 && !expanding {
+		return true
+	}
+
+	// Only resize while the role membership is settled. Members being
+	// created or deleted will be dealt with on a later pass.
+	for _, member := range role.roleStatus.Members {
+		state := memberState(member.State)
+		if state != memberReady && state != memberConfigError {
+			return true
+		}
+	}
+
+	if !expanding {
+		shared.LogInfof(
+			reqLogger,
+			cr,
+			shared.EventReasonRole,
+			"expanding storage for role{%s} from %s to %s",
+			role.roleStatus.Name,
+			currentSize.String(),
+			desiredSize.String(),
+		)
+	}
+	var pending []string
+	for _, member := range role.roleStatus.Members {
+		if member.PVC == "" {
+			continue
+		}
+		done, expandErr := executor.ExpandPVC(cr.Namespace, member.PVC, desiredSize)
+		if expandErr != nil {
+			shared.LogErrorf(
+				reqLogger,
+				expandErr,
+				cr,
+				shared.EventReasonRole,
+				"failed to expand PVC{%s}",
+				member.PVC,
+			)
+		}
+		if !done {
+			pending = append(pending, member.PVC)
+		}
+	}
+
+	// Set the condition before touching the statefulset, so that if the
+	// replacement is interrupted we know to finish it.
+	shared.SetCondition(
+		&role.roleStatus.Conditions,
+		kdv1.RoleStorageExpanding,
+		corev1.ConditionTrue,
+		"Resizing",
+		fmt.Sprintf(
+			"expanding member storage to %s",
+			desiredSize.String(),
+		),
+	)
+	if currentSize.Cmp(desiredSize) < 0 {
+		statefulSet, replaceErr := executor.ReplaceStatefulSetStorage(
+			reqLogger,
+			cr,
+			role.statefulSet,
+			desiredSize,
+		)
+		if replaceErr != nil {
+			shared.LogErrorf(
+				reqLogger,
+				replaceErr,
+				cr,
+				shared.EventReasonRole,
+				"failed to replace StatefulSet{%s}",
+				role.statefulSet.Name,
+			)
+		}
+		if statefulSet == nil {
+			role.statefulSet = nil
+			return false
+		}
+		role.statefulSet = statefulSet
+	}
+
+	if len(pending) != 0 {
+		shared.SetCondition(
+			&role.roleStatus.Conditions,
+			kdv1.RoleStorageExpanding,
+			corev1.ConditionTrue,
+			"Resizing",
+			fmt.Sprintf(
+				"waiting for PVC(s) %s to reach %s",
+				strings.Join(pending, ","),
+				desiredSize.String(),
+			),
+		)
+		return true
+	}
+	shared.LogInfof(
+		reqLogger,
+		cr,
+		shared.EventReasonRole,
+		"finished expanding storage for role{%s}",
+		role.roleStatus.Name,
+	)
+	shared.SetCondition(
+		&role.roleStatus.Conditions,
+		kdv1.RoleStorageExpanding,
+		corev1.ConditionFalse,
+		"",
+		"",
+	)
+	return true
+}
+
+// handleRoleStorageRestore re-creates the statefulset for a role whose
+// statefulset replacement (during storage expansion) was interrupted after
+// the old statefulset was deleted. The new statefulset adopts the orphaned
+// member pods. Failure to create the statefulset will be a
+// reconciler-stopping error.
+func handleRoleStorageRestore(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorCluster,
+	role *roleInfo,
+) error {
+
+	shared.LogInfof(
+		reqLogger,
+		cr,
+		shared.EventReasonRole,
+		"re-creating StatefulSet{%s} for role{%s}",
+		role.roleStatus.StatefulSet,
+		role.roleStatus.Name,
+	)
+	statefulSet, createErr := executor.RestoreStatefulSet(
+		reqLogger,
+		cr,
+		shared.GetNativeSystemdSupport(),
+		role.roleSpec,
+		role.roleStatus,
+	)
+	if errors.IsAlreadyExists(createErr) {
+		// The old statefulset is still going away; try again next pass.
+		return nil
+	}
+	if createErr != nil {
+		shared.LogErrorf(
+			reqLogger,
+			createErr,
+			cr,
+			shared.EventReasonRole,
+			"failed to re-create StatefulSet for role{%s}",
+			role.roleStatus.Name,
+		)
+		return createErr
+	}
+	role.statefulSet = statefulSet
+	return nil
+}
+
+// replacingStatefulSet reports whether the role's statefulset is being
+// replaced to change its storage claim templates, i.e. whether a missing
+// statefulset for the role should be re-created around its members.
+func replacingStatefulSet(
+	roleStatus *kdv1.RoleStatus,
+) bool {
+
+	return shared.ConditionIsTrue(roleStatus.Conditions, kdv1.RoleStorageExpanding) ||
+		shared.ConditionIsTrue(roleStatus.Conditions, kdv1.RoleBlockStorageChanging)
 }
 
 // handleRoleDelete takes care of deleting the associated statefulset after
@@ -419,10 +908,47 @@ func handleRoleDelete(
 		"finishing cleanup on role{%s}",
 		role.roleStatus.Name,
 	)
+	if role.roleStatus.ServiceAccount != "" {
+		saErr := executor.DeleteServiceAccount(
+			cr.Namespace,
+			role.roleStatus.ServiceAccount,
+		)
+		if saErr == nil || errors.IsNotFound(saErr) {
+			role.roleStatus.ServiceAccount = ""
+		} else {
+			shared.LogErrorf(
+				reqLogger,
+				saErr,
+				cr,
+				shared.EventReasonRole,
+				"failed to delete service account{%s}",
+				role.roleStatus.ServiceAccount,
+			)
+		}
+	}
+	if role.roleStatus.Subdomain != "" {
+		svcErr := executor.DeleteHeadlessService(
+			cr.Namespace,
+			role.roleStatus.Subdomain,
+		)
+		if svcErr == nil || errors.IsNotFound(svcErr) {
+			role.roleStatus.Subdomain = ""
+		} else {
+			shared.LogErrorf(
+				reqLogger,
+				svcErr,
+				cr,
+				shared.EventReasonRole,
+				"failed to delete headless service{%s}",
+				role.roleStatus.Subdomain,
+			)
+		}
+	}
 	deleteErr := executor.DeleteStatefulSet(cr.Namespace, role.statefulSet.Name)
 	if deleteErr == nil || errors.IsNotFound(deleteErr) {
 		// Mark the role status for removal.
 		role.roleStatus.StatefulSet = ""
+		role.roleStatus.Persistence = nil
 	} else {
 		shared.LogErrorf(
 			reqLogger,
@@ -508,19 +1034,8 @@ func addMemberStatuses(
 		} else {
 			pvcName = executor.PvcNamePrefix + "-" + memberName
 		}
-		// check if there is block device to be mounted in the member.
-		// assign path value if there is else it'd be an empty string
-		var blockDevPaths []string
-
-		if role.roleSpec.BlockStorage != nil {
-			numDevices := *role.roleSpec.BlockStorage.NumDevices
-			pathPrefix := *role.roleSpec.BlockStorage.Path
-			for i := int32(0); i < numDevices; i++ {
-				blockDevPath := pathPrefix + strconv.FormatInt(int64(i), 10)
-				blockDevPaths = append(blockDevPaths, blockDevPath)
-			}
-
-		}
+		// Note the paths of any block devices in the member.
+		blockDevPaths := executor.BlockDevicePaths(role.roleSpec)
 
 		// role.roleStatus.Members was created with enough capacity to
 		// avoid realloc, so we can safely grow it w/o disturbing our
@@ -536,6 +1051,7 @@ func addMemberStatuses(
 				BlockDevicePaths: blockDevPaths,
 			},
 		)
+		noteMemberCreated(cr, role.roleStatus.Name, &(role.roleStatus.Members[i]))
 		role.membersByState[memberCreatePending] = append(
 			role.membersByState[memberCreatePending],
 			&(role.roleStatus.Members[i]))
@@ -0,0 +1,208 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubedirectorcluster
+
+import (
+	"context"
+
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	"github.com/bluek8s/kubedirector/pkg/executor"
+	"github.com/bluek8s/kubedirector/pkg/shared"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/types"
+	k8sClient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// roleScaleToClusterRequest maps a KubeDirectorRoleScale to a reconcile
+// request for the cluster that it targets.
+var roleScaleToClusterRequest = handler.ToRequestsFunc(
+	func(obj handler.MapObject) []reconcile.Request {
+		roleScale, ok := obj.Object.(*kdv1.KubeDirectorRoleScale)
+		if !ok {
+			return nil
+		}
+		return []reconcile.Request{
+			{
+				NamespacedName: types.NamespacedName{
+					Namespace: roleScale.Namespace,
+					Name:      roleScale.Spec.Cluster,
+				},
+			},
+		}
+	},
+)
+
+// syncRoleScales applies the member counts requested through any
+// KubeDirectorRoleScale resources that target this cluster, by patching the
+// cluster spec. The patch goes through the validator like any other spec
+// change, so a count that cannot be applied yet (e.g. because of an
+// in-progress membership change) is retried on later handler passes. Each
+// role scale's status is updated with the current member count and pod
+// selector of its role.
+func syncRoleScales(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorCluster,
+) {
+
+	roleScales := &kdv1.KubeDirectorRoleScaleList{}
+	listErr := shared.List(
+		context.TODO(),
+		roleScales,
+		k8sClient.InNamespace(cr.Namespace),
+	)
+	if listErr != nil {
+		shared.LogError(
+			reqLogger,
+			listErr,
+			cr,
+			shared.EventReasonCluster,
+			"failed to list role scales",
+		)
+		return
+	}
+
+	// Work out the new status of each role scale for this cluster, and
+	// collect the member count changes to apply.
+	var targeted []*kdv1.KubeDirectorRoleScale
+	var origStatuses []*kdv1.KubeDirectorRoleScaleStatus
+	var pending []*kdv1.KubeDirectorRoleScale
+	scaledCR := cr.DeepCopy()
+	for i := range roleScales.Items {
+		roleScale := &(roleScales.Items[i])
+		if roleScale.Spec.Cluster != cr.Name {
+			continue
+		}
+		targeted = append(targeted, roleScale)
+		origStatuses = append(origStatuses, roleScale.Status.DeepCopy())
+		if roleScale.Status == nil {
+			roleScale.Status = &kdv1.KubeDirectorRoleScaleStatus{}
+		}
+		var roleSpec *kdv1.Role
+		for j := range scaledCR.Spec.Roles {
+			if scaledCR.Spec.Roles[j].Name == roleScale.Spec.Role {
+				roleSpec = &(scaledCR.Spec.Roles[j])
+				break
+			}
+		}
+		if roleSpec == nil {
+			shared.SetCondition(
+				&roleScale.Status.Conditions,
+				kdv1.RoleScaleBlocked,
+				corev1.ConditionTrue,
+				"RoleNotFound",
+				"role is not in the cluster spec",
+			)
+			continue
+		}
+		roleScale.Status.Selector = executor.RoleSelector(cr, roleSpec)
+		roleScale.Status.Members = 0
+		for _, roleStatus := range cr.Status.Roles {
+			if roleStatus.Name != roleSpec.Name {
+				continue
+			}
+			for _, member := range roleStatus.Members {
+				if !shared.StringInList(member.State, deletingMemberStates) {
+					roleScale.Status.Members++
+				}
+			}
+		}
+		if (roleScale.Spec.Members == nil) ||
+			(roleScale.Status.ObservedGeneration == roleScale.Generation) {
+			continue
+		}
+		if (roleSpec.Members != nil) && (*roleSpec.Members == *roleScale.Spec.Members) {
+			roleScale.Status.ObservedGeneration = roleScale.Generation
+			shared.SetCondition(
+				&roleScale.Status.Conditions,
+				kdv1.RoleScaleBlocked,
+				corev1.ConditionFalse,
+				"",
+				"",
+			)
+			continue
+		}
+		members := *roleScale.Spec.Members
+		roleSpec.Members = &members
+		pending = append(pending, roleScale)
+	}
+
+	// Apply all the changes in one spec patch. Including the resource
+	// version in the patch makes it fail, rather than overwrite, if the
+	// spec has been changed by someone else in the meantime.
+	if len(pending) != 0 {
+		origCR := cr.DeepCopy()
+		origCR.ResourceVersion = ""
+		patchErr := shared.Patch(context.TODO(), origCR, scaledCR)
+		for _, roleScale := range pending {
+			if patchErr == nil {
+				shared.LogInfof(
+					reqLogger,
+					cr,
+					shared.EventReasonRole,
+					"scaling role{%s} to %d members as requested by role scale{%s}",
+					roleScale.Spec.Role,
+					*roleScale.Spec.Members,
+					roleScale.Name,
+				)
+				roleScale.Status.ObservedGeneration = roleScale.Generation
+				shared.SetCondition(
+					&roleScale.Status.Conditions,
+					kdv1.RoleScaleBlocked,
+					corev1.ConditionFalse,
+					"",
+					"",
+				)
+			} else {
+				shared.LogErrorf(
+					reqLogger,
+					patchErr,
+					cr,
+					shared.EventReasonRole,
+					"failed to scale role{%s} as requested by role scale{%s}",
+					roleScale.Spec.Role,
+					roleScale.Name,
+				)
+				shared.SetCondition(
+					&roleScale.Status.Conditions,
+					kdv1.RoleScaleBlocked,
+					corev1.ConditionTrue,
+					"ClusterChangeRejected",
+					patchErr.Error(),
+				)
+			}
+		}
+	}
+
+	// Write back any changed role scale status.
+	for i, roleScale := range targeted {
+		if equality.Semantic.DeepEqual(roleScale.Status, origStatuses[i]) {
+			continue
+		}
+		if updateErr := shared.StatusUpdate(context.TODO(), roleScale); updateErr != nil {
+			shared.LogErrorf(
+				reqLogger,
+				updateErr,
+				cr,
+				shared.EventReasonNoEvent,
+				"failed to update status of role scale{%s}",
+				roleScale.Name,
+			)
+		}
+	}
+}
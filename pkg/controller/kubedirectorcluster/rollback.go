@@ -0,0 +1,57 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubedirectorcluster
+
+import (
+	"github.com/go-logr/logr"
+
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	"github.com/bluek8s/kubedirector/pkg/shared"
+)
+
+// recordLastKnownGood is called when the cluster is stable and every member
+// has been configured with the current spec. Unless some member is in
+// config error state, it records the current spec in the status as the one
+// that a later rollback will return to.
+func recordLastKnownGood(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorCluster,
+) {
+
+	lastKnownGood := cr.Status.LastKnownGood
+	if (lastKnownGood != nil) && (lastKnownGood.Generation == cr.Generation) {
+		return
+	}
+	for _, roleStatus := range cr.Status.Roles {
+		for _, member := range roleStatus.Members {
+			if member.State == string(memberConfigError) {
+				return
+			}
+		}
+	}
+	spec := cr.Spec.DeepCopy()
+	spec.Rollback = false
+	cr.Status.LastKnownGood = &kdv1.LastKnownGood{
+		Generation: cr.Generation,
+		Spec:       *spec,
+	}
+	shared.LogInfof(
+		reqLogger,
+		cr,
+		shared.EventReasonNoEvent,
+		"recorded spec generation %d as last-known-good",
+		cr.Generation,
+	)
+}
@@ -88,22 +88,59 @@ func syncMemberServices(
 	roles []*roleInfo,
 ) error {
 
+	// Missing services are collected here and then created together, so
+	// that a new cluster with many members gets its services sooner.
+	type serviceCreate struct {
+		role   *roleInfo
+		member *kdv1.MemberStatus
+		err    error
+	}
+	var toCreate []*serviceCreate
 	for _, role := range roles {
 		if role.roleStatus != nil {
 			for i := 0; i < len(role.roleStatus.Members); i++ {
-				serviceErr := handleMemberService(
+				member := &(role.roleStatus.Members[i])
+				needsCreate, serviceErr := handleMemberService(
 					reqLogger,
 					cr,
 					role,
-					&(role.roleStatus.Members[i]),
+					member,
 				)
 				if serviceErr != nil {
 					return serviceErr
 				}
+				if needsCreate {
+					toCreate = append(
+						toCreate,
+						&serviceCreate{role: role, member: member},
+					)
+				}
 			}
 		}
 	}
 
+	var creates []func()
+	for _, c := range toCreate {
+		create := c
+		creates = append(
+			creates,
+			func() {
+				create.err = handleMemberServiceCreate(
+					reqLogger,
+					cr,
+					create.role,
+					create.member,
+				)
+			},
+		)
+	}
+	runBounded(creates)
+	for _, c := range toCreate {
+		if c.err != nil {
+			return c.err
+		}
+	}
+
 	return nil
 }
 
@@ -115,7 +152,17 @@ func handleClusterServiceCreate(
 	cr *kdv1.KubeDirectorCluster,
 ) error {
 
-	clusterService, createErr := executor.CreateHeadlessService(cr)
+	var clusterService *corev1.Service
+	createErr := createWithBackoff(
+		reqLogger,
+		cr,
+		"cluster service",
+		func() error {
+			var err error
+			clusterService, err = executor.CreateHeadlessService(cr)
+			return err
+		},
+	)
 	if createErr != nil {
 		// Not much to do if we can't create it... we'll just keep trying
 		// on every run through the reconciler.
@@ -154,26 +201,38 @@ func handleClusterServiceConfig(
 			cr.Status.ClusterService,
 		)
 	}
+	labelsErr := executor.UpdateServicePropagatedLabels(reqLogger, cr, nil, clusterService)
+	if labelsErr != nil {
+		shared.LogErrorf(
+			reqLogger,
+			labelsErr,
+			cr,
+			shared.EventReasonCluster,
+			"failed to update labels on Service{%s}",
+			cr.Status.ClusterService,
+		)
+	}
 }
 
-// handleMemberService makes sure that the per-member service exists if it
+// handleMemberService checks whether the per-member service exists if it
 // should. (If it should not, we don't worry about it here... member syncing
-// will clean it up.) If the service is created, it will store this service
-// name in the member status. Failure to create a service as needed will be a
-// reconciler-stopping error.
+// will clean it up.) An existing service has its config reconciled. The
+// returned boolean is true if the service needs to be created, which the
+// caller does with handleMemberServiceCreate. Failure to look up the service
+// will be a reconciler-stopping error.
 func handleMemberService(
 	reqLogger logr.Logger,
 	cr *kdv1.KubeDirectorCluster,
 	role *roleInfo,
 	member *kdv1.MemberStatus,
-) error {
+) (bool, error) {
 
 	if serviceShouldBeReconciled[memberState(member.State)] {
 		if member.Service == zeroPortsService {
 			// TBD: Currently nothing to do if no ports on the service. This
 			// will change in the future if/when handleMemberServiceConfig
 			// supports modification of an existing service's ports.
-			return nil
+			return false, nil
 		}
 		memberService, queryErr := queryService(
 			reqLogger,
@@ -181,7 +240,7 @@ func handleMemberService(
 			member.Service,
 		)
 		if queryErr != nil {
-			return queryErr
+			return false, queryErr
 		}
 		if memberService == nil {
 			if member.Service != "" && member.Service != zeroPortsService {
@@ -195,27 +254,18 @@ func handleMemberService(
 				)
 			}
 			// Need to create a service.
-			createErr := handleMemberServiceCreate(
-				reqLogger,
-				cr,
-				role,
-				member,
-			)
-			if createErr != nil {
-				return createErr
-			}
-		} else {
-			// We have an existing service so just reconcile its config.
-			handleMemberServiceConfig(
-				reqLogger,
-				cr,
-				role,
-				member,
-				memberService,
-			)
+			return true, nil
 		}
+		// We have an existing service so just reconcile its config.
+		handleMemberServiceConfig(
+			reqLogger,
+			cr,
+			role,
+			member,
+			memberService,
+		)
 	}
-	return nil
+	return false, nil
 }
 
 // handleMemberServiceCreate will create a per-member service and store its
@@ -230,10 +280,20 @@ func handleMemberServiceCreate(
 	member *kdv1.MemberStatus,
 ) error {
 
-	memberService, createErr := executor.CreatePodService(
+	var memberService *corev1.Service
+	createErr := createWithBackoff(
+		reqLogger,
 		cr,
-		role.roleSpec,
-		member.Pod,
+		"member service for member{"+member.Pod+"}",
+		func() error {
+			var err error
+			memberService, err = executor.CreatePodService(
+				cr,
+				role.roleSpec,
+				member.Pod,
+			)
+			return err
+		},
 	)
 	if createErr != nil {
 		// Not much to do if we can't create it... we'll just keep trying
@@ -259,9 +319,10 @@ func handleMemberServiceCreate(
 }
 
 // handleMemberServiceConfig checks an existing per-member service to see if
-// any of its important properties need to be reconciled. Failure to reconcile
-// will not be treated as a reconciler-stopping error; we'll just try again next
-// time.
+// any of its important properties (including propagated labels) need to be
+// reconciled, along with any Ingress or Routes for the service. Failure to
+// reconcile will not be treated as a reconciler-stopping error; we'll just
+// try again next time.
 func handleMemberServiceConfig(
 	reqLogger logr.Logger,
 	cr *kdv1.KubeDirectorCluster,
@@ -277,6 +338,23 @@ func handleMemberServiceConfig(
 		member.Pod,
 		memberService,
 	)
+	labelsErr := executor.UpdateServicePropagatedLabels(
+		reqLogger,
+		cr,
+		role.roleSpec,
+		memberService,
+	)
+	if labelsErr != nil {
+		shared.LogErrorf(
+			reqLogger,
+			labelsErr,
+			cr,
+			shared.EventReasonMember,
+			"failed to update labels on service{%s}",
+			memberService.Name,
+		)
+	}
+	handleMemberIngress(reqLogger, cr, role, member)
 }
 
 // queryService is a generalized lookup subroutine for finding either
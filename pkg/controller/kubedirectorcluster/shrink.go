@@ -0,0 +1,355 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubedirectorcluster
+
+import (
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	"github.com/bluek8s/kubedirector/pkg/executor"
+	"github.com/bluek8s/kubedirector/pkg/shared"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ShrinkVictims returns, per role, the names of the members whose persistent
+// volume claims would be released if the role member counts in the spec
+// were carried out. A role that is no longer in the spec loses all of its
+// members; a role with no member count in the spec is not changing, and
+// neither is the data of a role whose claims are retained when it shrinks.
+// The validator uses this to require acknowledgement of such data loss.
+func ShrinkVictims(
+	cr *kdv1.KubeDirectorCluster,
+) map[string][]string {
+
+	victims := make(map[string][]string)
+	if cr.Status == nil {
+		return victims
+	}
+	desired := specMembers(cr)
+	inSpec := make(map[string]bool)
+	retained := make(map[string]bool)
+	for i := range cr.Spec.Roles {
+		role := &(cr.Spec.Roles[i])
+		inSpec[role.Name] = true
+		retained[role.Name] = retainsPVCsWhenScaled(role)
+	}
+	for _, roleStatus := range cr.Status.Roles {
+		target, ok := desired[roleStatus.Name]
+		if (!ok && inSpec[roleStatus.Name]) || retained[roleStatus.Name] {
+			continue
+		}
+		// Members that are already being deleted don't count; of the rest,
+		// the members past the target count are the ones that will go.
+		var live int32
+		for _, member := range roleStatus.Members {
+			if shared.StringInList(member.State, deletingMemberStates) {
+				continue
+			}
+			live++
+			if (live > target) && (member.PVC != "") {
+				victims[roleStatus.Name] = append(
+					victims[roleStatus.Name],
+					member.Pod,
+				)
+			}
+		}
+	}
+	return victims
+}
+
+// retainsPVCsWhenScaled checks whether the retention policy of the given
+// role keeps the claims of members removed by shrinking the role.
+func retainsPVCsWhenScaled(
+	role *kdv1.Role,
+) bool {
+
+	return (role != nil) &&
+		(role.PVCRetentionPolicy != nil) &&
+		(role.PVCRetentionPolicy.WhenScaled == kdv1.PVCRetain)
+}
+
+// retainsPVCsWhenDeleted checks whether the retention policy of the given
+// role keeps the claims of its members when the cluster is deleted.
+func retainsPVCsWhenDeleted(
+	role *kdv1.Role,
+) bool {
+
+	return (role != nil) &&
+		(role.PVCRetentionPolicy != nil) &&
+		(role.PVCRetentionPolicy.WhenDeleted == kdv1.PVCRetain)
+}
+
+// pvcRetention holds the persistent volume claims released by deleted
+// members during one handler pass, to be recorded in the cluster status.
+// A nil expiry time means that the claims are kept indefinitely.
+type pvcRetention struct {
+	lock    sync.Mutex
+	expires *metav1.Time
+	claims  []kdv1.RetainedPVC
+}
+
+// newPVCRetention returns a pvcRetention if the claims of deleted members
+// of the given role (nil if the role is being removed) are to be kept,
+// otherwise nil. They are kept indefinitely if the role's retention policy
+// says so, or else for a while if KubeDirector is configured to do that.
+func newPVCRetention(
+	role *kdv1.Role,
+) *pvcRetention {
+
+	if retainsPVCsWhenScaled(role) {
+		return &pvcRetention{}
+	}
+	seconds := shared.GetDeletedPVCRetentionSeconds()
+	if seconds <= 0 {
+		return nil
+	}
+	expires := metav1.NewTime(
+		time.Now().Add(time.Duration(seconds) * time.Second),
+	)
+	return &pvcRetention{
+		expires: &expires,
+	}
+}
+
+// retain records the claim of a deleted member. It is safe to call from
+// concurrent member handlers.
+func (r *pvcRetention) retain(
+	role string,
+	member *kdv1.MemberStatus,
+) {
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.claims = append(
+		r.claims,
+		kdv1.RetainedPVC{
+			PVC:     member.PVC,
+			Role:    role,
+			Member:  member.Pod,
+			Expires: r.expires,
+		},
+	)
+}
+
+// syncRetainedPVCs handles the claims of deleted members that are being
+// kept for recovery. A claim that is in use again by a current member is
+// re-adopted and no longer tracked. A claim whose retention period has
+// passed is deleted, as is a claim kept by a retention policy that its
+// role no longer has.
+func syncRetainedPVCs(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorCluster,
+) {
+
+	if len(cr.Status.RetainedPVCs) == 0 {
+		return
+	}
+	inUse := make(map[string]bool)
+	for _, roleStatus := range cr.Status.Roles {
+		for _, member := range roleStatus.Members {
+			if member.PVC != "" {
+				inUse[member.PVC] = true
+			}
+		}
+	}
+	roleSpecs := make(map[string]*kdv1.Role)
+	for i := range cr.Spec.Roles {
+		roleSpecs[cr.Spec.Roles[i].Name] = &(cr.Spec.Roles[i])
+	}
+	now := time.Now()
+	var kept []kdv1.RetainedPVC
+	for _, retained := range cr.Status.RetainedPVCs {
+		if inUse[retained.PVC] {
+			if !readoptPVC(reqLogger, cr, roleSpecs[retained.Role], retained.PVC) {
+				kept = append(kept, retained)
+				continue
+			}
+			shared.LogInfof(
+				reqLogger,
+				cr,
+				shared.EventReasonMember,
+				"retained PVC{%s} re-used by member{%s} in role{%s}",
+				retained.PVC,
+				retained.Member,
+				retained.Role,
+			)
+			continue
+		}
+		if retained.Expires == nil {
+			if retainsPVCsWhenScaled(roleSpecs[retained.Role]) {
+				kept = append(kept, retained)
+				continue
+			}
+		} else if now.Before(retained.Expires.Time) {
+			kept = append(kept, retained)
+			continue
+		}
+		pvcDelErr := executor.DeletePVC(cr.Namespace, retained.PVC)
+		if pvcDelErr != nil && !apierrors.IsNotFound(pvcDelErr) {
+			shared.LogErrorf(
+				reqLogger,
+				pvcDelErr,
+				cr,
+				shared.EventReasonMember,
+				"failed to delete retained PVC{%s}",
+				retained.PVC,
+			)
+			kept = append(kept, retained)
+			continue
+		}
+		shared.LogInfof(
+			reqLogger,
+			cr,
+			shared.EventReasonMember,
+			"deleted retained PVC{%s} of former member{%s}",
+			retained.PVC,
+			retained.Member,
+		)
+	}
+	cr.Status.RetainedPVCs = kept
+}
+
+// readoptPVC brings a retained claim that a re-created member is using
+// again up to date with the role spec: its size may need to grow, and its
+// labels and annotations may need to change, if the role was changed while
+// the claim was not in use. Returns false if this should be tried again.
+func readoptPVC(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorCluster,
+	role *kdv1.Role,
+	pvcName string,
+) bool {
+
+	if role == nil {
+		return true
+	}
+	if role.Storage != nil {
+		desiredSize, parseErr := resource.ParseQuantity(role.Storage.Size)
+		if parseErr == nil {
+			_, expandErr := executor.ExpandPVC(cr.Namespace, pvcName, desiredSize)
+			if expandErr != nil {
+				shared.LogErrorf(
+					reqLogger,
+					expandErr,
+					cr,
+					shared.EventReasonMember,
+					"failed to expand re-used PVC{%s}",
+					pvcName,
+				)
+				return false
+			}
+		}
+	}
+	updateErr := executor.UpdatePVCMetadata(reqLogger, cr, role, pvcName)
+	if updateErr != nil {
+		shared.LogErrorf(
+			reqLogger,
+			updateErr,
+			cr,
+			shared.EventReasonMember,
+			"failed to update labels and annotations on re-used PVC{%s}",
+			pvcName,
+		)
+		return false
+	}
+	return true
+}
+
+// releaseRetainedPVCs is called when the cluster is being deleted. For each
+// role whose retention policy keeps its claims in that case, it removes the
+// cluster from the owner references of the claims of the role's members
+// (including any claims kept from earlier deleted members), so that they
+// outlive the cluster.
+func releaseRetainedPVCs(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorCluster,
+) error {
+
+	if cr.Status == nil {
+		return nil
+	}
+	for i := range cr.Spec.Roles {
+		role := &(cr.Spec.Roles[i])
+		if !retainsPVCsWhenDeleted(role) {
+			continue
+		}
+		var pvcNames []string
+		for _, roleStatus := range cr.Status.Roles {
+			if roleStatus.Name != role.Name {
+				continue
+			}
+			for _, member := range roleStatus.Members {
+				if member.PVC != "" {
+					pvcNames = append(pvcNames, member.PVC)
+				}
+				pvcNames = append(
+					pvcNames,
+					executor.MemberBlockPVCNames(role, member.Pod)...,
+				)
+			}
+			for _, previous := range roleStatus.PreviousMembers {
+				pvcNames = append(pvcNames, previous.PVCs...)
+			}
+		}
+		for _, retained := range cr.Status.RetainedPVCs {
+			if retained.Role == role.Name {
+				pvcNames = append(pvcNames, retained.PVC)
+			}
+		}
+		for _, pvcName := range pvcNames {
+			releaseErr := executor.ReleasePVC(cr, pvcName)
+			if releaseErr != nil {
+				shared.LogErrorf(
+					reqLogger,
+					releaseErr,
+					cr,
+					shared.EventReasonCluster,
+					"failed to release PVC{%s} of role{%s}",
+					pvcName,
+					role.Name,
+				)
+				return releaseErr
+			}
+		}
+		if len(pvcNames) != 0 {
+			shared.LogInfof(
+				reqLogger,
+				cr,
+				shared.EventReasonCluster,
+				"keeping %d PVCs of role{%s} after cluster deletion",
+				len(pvcNames),
+				role.Name,
+			)
+		}
+	}
+	return nil
+}
+
+// recordRetainedPVCs adds the claims released during this handler pass to
+// the cluster status.
+func recordRetainedPVCs(
+	cr *kdv1.KubeDirectorCluster,
+	retention *pvcRetention,
+) {
+
+	if retention != nil {
+		cr.Status.RetainedPVCs = append(cr.Status.RetainedPVCs, retention.claims...)
+	}
+}
@@ -0,0 +1,258 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubedirectorcluster
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	"github.com/bluek8s/kubedirector/pkg/catalog"
+	"github.com/bluek8s/kubedirector/pkg/executor"
+	"github.com/bluek8s/kubedirector/pkg/shared"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// stopTimeout returns how long a member of the given role is given to run
+// the stop hook, or zero if the app does not ask for the stop event. Like
+// the decommission event, it must be explicitly listed in the role's
+// eventList.
+func stopTimeout(
+	cr *kdv1.KubeDirectorCluster,
+	roleName string,
+) time.Duration {
+
+	appCr, appErr := catalog.GetApp(cr)
+	if appErr != nil {
+		return 0
+	}
+	appRole := catalog.GetRoleFromID(appCr, roleName)
+	if (appRole == nil) || (appRole.EventList == nil) ||
+		!shared.StringInList(stopEvent, *appRole.EventList) {
+		return 0
+	}
+	if appRole.StopTimeoutSeconds != nil {
+		return time.Duration(*appRole.StopTimeoutSeconds) * time.Second
+	}
+	return defaultStopTimeout
+}
+
+// stopMember is the single path by which KubeDirector stops a member that it
+// is about to take down, whether to restart it, to shrink or remove its
+// role, or to re-create the cluster's objects. It starts or checks on the
+// app's stop hook in the member, recording the reason and progress in the
+// member status. Once the hook has finished or run out of time, the pod is
+// deleted if deletePod is true (otherwise the caller's statefulset change
+// takes care of it) and true is returned. The container's own preStop
+// handler and termination grace period still apply to the deletion.
+func stopMember(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorCluster,
+	roleName string,
+	member *kdv1.MemberStatus,
+	reason string,
+	deletePod bool,
+) bool {
+
+	if !runStopHook(reqLogger, cr, roleName, member, reason) {
+		return false
+	}
+	if !deletePod {
+		return true
+	}
+	deleteErr := executor.DeletePod(cr.Namespace, member.Pod)
+	if (deleteErr != nil) && !apierrors.IsNotFound(deleteErr) {
+		shared.LogErrorf(
+			reqLogger,
+			deleteErr,
+			cr,
+			shared.EventReasonMember,
+			"failed to delete pod{%s} for %s",
+			member.Pod,
+			reason,
+		)
+		return false
+	}
+	return true
+}
+
+// stopRoleMembers stops every member of the role for the given reason
+// without deleting them. It returns true once all of them are stopped.
+func stopRoleMembers(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorCluster,
+	roleStatus *kdv1.RoleStatus,
+	reason string,
+) bool {
+
+	allDone := true
+	for i := range roleStatus.Members {
+		member := &(roleStatus.Members[i])
+		if !stopMember(reqLogger, cr, roleStatus.Name, member, reason, false) {
+			allDone = false
+		}
+	}
+	return allDone
+}
+
+// runStopHook does the app-facing part of stopMember. A stop status left
+// over from another container or another reason is replaced, so that each
+// stop of a container runs the hook once. It returns true when the member
+// can go down.
+func runStopHook(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorCluster,
+	roleName string,
+	member *kdv1.MemberStatus,
+	reason string,
+) bool {
+
+	containerID := member.StateDetail.LastConfiguredContainer
+	status := member.StateDetail.Stop
+	if (status == nil) || (status.Reason != reason) || (status.Container != containerID) {
+		member.StateDetail.Stop = &kdv1.MemberStopStatus{
+			Reason:    reason,
+			State:     stopRunning,
+			Container: containerID,
+			Started:   metav1.Now(),
+		}
+		status = member.StateDetail.Stop
+		shared.LogInfof(
+			reqLogger,
+			cr,
+			shared.EventReasonMemberStopping,
+			"stopping member{%s} for %s",
+			member.Pod,
+			reason,
+		)
+		timeout := stopTimeout(cr, roleName)
+		if (containerID == "") || (timeout == 0) {
+			status.State = stopSkipped
+			return true
+		}
+		cmd := fmt.Sprintf(
+			appPrepStopHookCmd,
+			containerID,
+			quotedHookPrefix(cr, roleName),
+			"--reason "+reason,
+		)
+		cmdErr := executor.RunScript(
+			reqLogger,
+			cr,
+			cr.Namespace,
+			member.Pod,
+			containerID,
+			executor.AppContainerName,
+			"app stop",
+			strings.NewReader(cmd),
+		)
+		if cmdErr != nil {
+			// Nothing to wait for; the member goes down regardless.
+			status.State = stopFailed
+			status.Message = cmdErr.Error()
+			shared.LogErrorf(
+				reqLogger,
+				cmdErr,
+				cr,
+				shared.EventReasonMemberStopFailed,
+				"failed to start stop hook in member{%s}",
+				member.Pod,
+			)
+			return true
+		}
+		return false
+	}
+	if status.State != stopRunning {
+		return true
+	}
+	if checkStop(reqLogger, cr, member, containerID) {
+		return true
+	}
+	timeout := stopTimeout(cr, roleName)
+	if time.Since(status.Started.Time) < timeout {
+		return false
+	}
+	shared.LogInfof(
+		reqLogger,
+		cr,
+		shared.EventReasonMemberStopFailed,
+		"stop hook of member{%s} did not finish within %v; stopping it anyway",
+		member.Pod,
+		timeout,
+	)
+	status.State = stopTimedOut
+	return true
+}
+
+// checkStop reads the status file of a running stop hook and updates the
+// member's stop status if the hook has finished. Unlike a failed
+// decommission, a failed stop hook does not hold the member, since the
+// stop was asked for regardless. Returns true if the hook has finished.
+func checkStop(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorCluster,
+	member *kdv1.MemberStatus,
+	containerID string,
+) bool {
+
+	status := member.StateDetail.Stop
+	readFile := func(filePath string) (string, bool) {
+		var strB strings.Builder
+		fileExists, fileError := executor.ReadFile(
+			reqLogger,
+			cr,
+			cr.Namespace,
+			member.Pod,
+			containerID,
+			executor.AppContainerName,
+			filePath,
+			&strB,
+		)
+		return strB.String(), fileExists && (fileError == nil)
+	}
+	statusStr, ok := readFile(appPrepStopStatus)
+	if !ok {
+		// Either the member is unreachable right now or it has restarted
+		// and lost the hook; the timeout takes care of both.
+		return false
+	}
+	splitPoint := strings.LastIndex(statusStr, "=")
+	if (splitPoint == -1) || (statusStr[splitPoint+1:] == "") {
+		return false
+	}
+	exitStatus, convErr := strconv.Atoi(statusStr[splitPoint+1:])
+	if (convErr == nil) && (exitStatus == 0) {
+		status.State = stopSucceeded
+		return true
+	}
+	status.State = stopFailed
+	status.Message = "stop hook failed"
+	if stderr, stderrOk := readFile(appPrepStopStderr); stderrOk {
+		status.Message = shared.GetLastLines(stderr, shared.DefaultMaxLogSizeDump)
+	}
+	shared.LogInfof(
+		reqLogger,
+		cr,
+		shared.EventReasonMemberStopFailed,
+		"stop hook of member{%s} failed; stopping it anyway",
+		member.Pod,
+	)
+	return true
+}
@@ -0,0 +1,142 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubedirectorcluster
+
+import (
+	"sort"
+
+	"github.com/go-logr/logr"
+
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	"github.com/bluek8s/kubedirector/pkg/shared"
+)
+
+// memberStateRef is the role and state of a member in a stateSnapshot.
+type memberStateRef struct {
+	role  string
+	state string
+}
+
+// stateSnapshot records the cluster and member states at the start of a
+// handler pass, for publishTransitions to compare against.
+type stateSnapshot struct {
+	cluster string
+	members map[string]memberStateRef
+}
+
+// snapshotStates records the current cluster and member states. The
+// member statuses must be complete (not summarized) at this point.
+func snapshotStates(
+	cr *kdv1.KubeDirectorCluster,
+) stateSnapshot {
+
+	snapshot := stateSnapshot{
+		cluster: cr.Status.State,
+		members: make(map[string]memberStateRef),
+	}
+	for _, roleStatus := range cr.Status.Roles {
+		for _, member := range roleStatus.Members {
+			snapshot.members[member.Pod] = memberStateRef{
+				role:  roleStatus.Name,
+				state: member.State,
+			}
+		}
+	}
+	return snapshot
+}
+
+// publishTransitions posts an event with a structured payload (see
+// shared.EventPayload) for each change of the cluster or member states
+// since the given snapshot. It is called once the new status has been
+// written, so that watchers only hear about transitions that stick.
+func publishTransitions(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorCluster,
+	before stateSnapshot,
+) {
+
+	if cr.Status.State != before.cluster {
+		shared.LogTransitionf(
+			reqLogger,
+			cr,
+			shared.EventReasonCluster,
+			shared.EventPayload{
+				Type:      shared.EventClusterStateChanged,
+				Namespace: cr.Namespace,
+				Cluster:   cr.Name,
+				From:      before.cluster,
+				To:        cr.Status.State,
+			},
+			"cluster state changed from %q to %q",
+			before.cluster,
+			cr.Status.State,
+		)
+	}
+
+	after := snapshotStates(cr)
+	var pods []string
+	for pod := range before.members {
+		pods = append(pods, pod)
+	}
+	for pod := range after.members {
+		if _, ok := before.members[pod]; !ok {
+			pods = append(pods, pod)
+		}
+	}
+	sort.Strings(pods)
+	for _, pod := range pods {
+		previous, hadMember := before.members[pod]
+		current, hasMember := after.members[pod]
+		switch {
+		case !hasMember:
+			shared.LogTransitionf(
+				reqLogger,
+				cr,
+				shared.EventReasonMember,
+				shared.EventPayload{
+					Type:      shared.EventMemberRemoved,
+					Namespace: cr.Namespace,
+					Cluster:   cr.Name,
+					Role:      previous.role,
+					Member:    pod,
+					From:      previous.state,
+				},
+				"member{%s} in role{%s} removed",
+				pod,
+				previous.role,
+			)
+		case !hadMember || (previous.state != current.state):
+			shared.LogTransitionf(
+				reqLogger,
+				cr,
+				shared.EventReasonMember,
+				shared.EventPayload{
+					Type:      shared.EventMemberStateChanged,
+					Namespace: cr.Namespace,
+					Cluster:   cr.Name,
+					Role:      current.role,
+					Member:    pod,
+					From:      previous.state,
+					To:        current.state,
+				},
+				"member{%s} in role{%s} changed state from %q to %q",
+				pod,
+				current.role,
+				previous.state,
+				current.state,
+			)
+		}
+	}
+}
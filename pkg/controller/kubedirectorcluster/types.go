@@ -15,6 +15,8 @@
 package kubedirectorcluster
 
 import (
+	"time"
+
 	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
 	"github.com/bluek8s/kubedirector/pkg/shared"
 	appsv1 "k8s.io/api/apps/v1"
@@ -60,6 +62,14 @@ var deletingMemberStates = []string{
 	string(memberDeletePending),
 	string(memberDeleting),
 }
+var allMemberStates = []string{
+	string(memberCreatePending),
+	string(memberCreating),
+	string(memberReady),
+	string(memberDeletePending),
+	string(memberDeleting),
+	string(memberConfigError),
+}
 
 const (
 	containerRunning      = "running"
@@ -69,6 +79,7 @@ const (
 	containerTerminated   = "terminated"
 	containerMissing      = "absent"
 	containerUnknown      = "unknown"
+	containerDisconnected = "disconnected"
 )
 
 const (
@@ -82,12 +93,17 @@ const (
 	ln -sf %[2]s/bin/configcli %[2]s/bin/bd_vcli`
 	configcliTestFile       = shared.ConfigCliLoc + "/bin/configcli"
 	configcliLegacyTestFile = shared.ConfigCliLegacyLoc + "/bin/configcli"
+	appPrepDir              = "/opt/guestconfig"
 	appPrepStartscript      = "/opt/guestconfig/*/startscript"
+	appPrepStagedPackage    = "/tmp/kd-appconfig.tgz"
+	appPrepFetchURLFmt      = "curl -L %s -o appconfig.tgz"
+	appPrepFetchStaged      = "mv " + appPrepStagedPackage + " appconfig.tgz"
+	appPrepVerifyFmt        = "echo '%s  appconfig.tgz' | sha256sum -c -"
 	appPrepInitCmdFmt       = `mkdir -p /opt/guestconfig &&
 	chmod 700 /opt/guestconfig &&
 	cd /opt/guestconfig &&
 	rm -rf /opt/guestconfig/* &&
-	curl -L %s -o appconfig.tgz &&
+	%s &&
 	tar xzf appconfig.tgz &&
 	chmod u+x ` + appPrepStartscript + ` &&
 	rm -rf /opt/guestconfig/appconfig.tgz`
@@ -95,16 +111,103 @@ const (
 	appPrepConfigStdout = "/opt/guestconfig/configure.stdout"
 	appPrepConfigStderr = "/opt/guestconfig/configure.stderr"
 	appPrepConfigRunCmd = `rm -f /opt/guestconfig/configure.* &&
-	echo -n %s= > ` + appPrepConfigStatus + ` && 
-	nohup sh -c '` + appPrepStartscript +
+	echo -n %[1]s= > ` + appPrepConfigStatus + ` && 
+	nohup sh -c '%[2]s` + appPrepStartscript +
 		` --configure 2>` + appPrepConfigStderr + ` 1>` + appPrepConfigStdout + `;
 	echo -n $? >> ` + appPrepConfigStatus + `' &`
+	// appContainerConfigCmd runs, to completion, the configure event of a
+	// setup package installed in an additional app container.
+	appContainerConfigCmd = appPrepStartscript + ` --configure 2>` + appPrepConfigStderr +
+		` 1>` + appPrepConfigStdout
 	fileInjectionCommand = `mkdir -p %s && cd %s &&
 	curl -L %s -o %s`
-	appPrepConfigReconnectCmd = `echo -n %s= > ` + appPrepConfigStatus + ` &&
-	nohup sh -c '` + appPrepStartscript +
+	appPrepConfigReconnectCmd = `echo -n %[1]s= > ` + appPrepConfigStatus + ` &&
+	nohup sh -c '%[2]s` + appPrepStartscript +
 		` --reconnect 2>` + appPrepConfigStderr + ` 1>` + appPrepConfigStdout + `;
 	echo -n $? >> ` + appPrepConfigStatus + `' &`
+	appPrepConfigUpgradeCmd = `echo -n %[1]s= > ` + appPrepConfigStatus + ` &&
+	nohup sh -c '%[2]s` + appPrepStartscript +
+		` --upgrade%[3]s 2>` + appPrepConfigStderr + ` 1>` + appPrepConfigStdout + `;
+	echo -n $? >> ` + appPrepConfigStatus + `' &`
+	upgradeEvent = "upgrade"
+
+	appPrepConfigRestartCmd = `echo -n %[1]s= > ` + appPrepConfigStatus + ` &&
+	nohup sh -c '%[2]s` + appPrepStartscript +
+		` --restart 2>` + appPrepConfigStderr + ` 1>` + appPrepConfigStdout + `;
+	echo -n $? >> ` + appPrepConfigStatus + `' &`
+	restartEvent = "restart"
+
+	appPrepConfigRestoredCmd = `rm -f /opt/guestconfig/configure.* &&
+	echo -n %[1]s= > ` + appPrepConfigStatus + ` &&
+	nohup sh -c '%[2]s` + appPrepStartscript +
+		` --restored 2>` + appPrepConfigStderr + ` 1>` + appPrepConfigStdout + `;
+	echo -n $? >> ` + appPrepConfigStatus + `' &`
+	restoredEvent = "restored"
+
+	// blockDevicesEvent is the notify sent to the members of a role whose
+	// block devices have been grown or added to, if the role handles it.
+	blockDevicesEvent = "blockdevices"
+
+	appPrepDecommissionStatus    = "/opt/guestconfig/decommission.status"
+	appPrepDecommissionStdout    = "/opt/guestconfig/decommission.stdout"
+	appPrepDecommissionStderr    = "/opt/guestconfig/decommission.stderr"
+	appPrepConfigDecommissionCmd = `rm -f /opt/guestconfig/decommission.* &&
+	echo -n %[1]s= > ` + appPrepDecommissionStatus + ` &&
+	nohup sh -c '%[2]s` + appPrepStartscript +
+		` --decommission %[3]s 2>` + appPrepDecommissionStderr + ` 1>` + appPrepDecommissionStdout + `;
+	echo -n $? >> ` + appPrepDecommissionStatus + `' &`
+	decommissionEvent = "decommission"
+
+	appPrepStopStatus  = "/opt/guestconfig/stop.status"
+	appPrepStopStdout  = "/opt/guestconfig/stop.stdout"
+	appPrepStopStderr  = "/opt/guestconfig/stop.stderr"
+	appPrepStopHookCmd = `rm -f /opt/guestconfig/stop.* &&
+	echo -n %[1]s= > ` + appPrepStopStatus + ` &&
+	nohup sh -c '%[2]s` + appPrepStartscript +
+		` --stop %[3]s 2>` + appPrepStopStderr + ` 1>` + appPrepStopStdout + `;
+	echo -n $? >> ` + appPrepStopStatus + `' &`
+	stopEvent = "stop"
+)
+
+// States of the decommission hook on a member leaving its role.
+const (
+	decommissionRunning   = "running"
+	decommissionSucceeded = "succeeded"
+	decommissionFailed    = "failed"
+	decommissionTimedOut  = "timedOut"
+	// defaultDecommissionTimeout is how long a leaving member is given to
+	// decommission if the app does not say.
+	defaultDecommissionTimeout = 10 * time.Minute
+)
+
+// States of the app's stop hook on a member that KubeDirector is stopping,
+// and the reasons for stopping it.
+const (
+	stopRunning   = "running"
+	stopSucceeded = "succeeded"
+	stopFailed    = "failed"
+	stopTimedOut  = "timedOut"
+	stopSkipped   = "skipped"
+	// defaultStopTimeout is how long a member is given to run the stop
+	// hook if the app does not say.
+	defaultStopTimeout = 2 * time.Minute
+
+	stopReasonRestart     = "Restart"
+	stopReasonShrink      = "Shrink"
+	stopReasonRoleRemoved = "RoleRemoved"
+	stopReasonRecreate    = "Recreate"
+)
+
+// Limits on the initial configure run of a member.
+const (
+	// defaultConfigureBackoff is the wait before the first retry of a
+	// failed configure run if the configure policy does not say.
+	defaultConfigureBackoff = 30 * time.Second
+	// maxConfigureBackoff caps the doubling wait between retries.
+	maxConfigureBackoff = 10 * time.Minute
+	// appPrepConfigStopCmd stops a configure (or restored) run that has
+	// overstayed its timeout.
+	appPrepConfigStopCmd = `pkill -f 'startscript --(configure|restored)' || true`
 )
 
 // Support for old images/scripts that expect configcli to be in /usr/bin.
@@ -116,14 +219,84 @@ const (
 	ln -sf /usr/local/bin/configmacro /usr/bin/configmacro`
 )
 
+const (
+	// memberCertDir is where the files of a member's TLS certificate are
+	// installed in its app container.
+	memberCertDir = "/etc/kubedirector/tls"
+	// memberCertCAKey is the secret key (and file name) of the issuing CA
+	// certificate, if the issuer provides one.
+	memberCertCAKey = "ca.crt"
+)
+
 const (
 	zeroPortsService = "n/a"
 )
 
+const (
+	// imagePullErrorHaltThreshold is how long a member's image pull must
+	// have been failing before we consider it persistent enough to halt
+	// further expansion of its role (if so configured).
+	imagePullErrorHaltThreshold = 5 * time.Minute
+
+	// databaseProbeTimeout bounds each attempt to open a TCP connection
+	// to a database connection that requests probing.
+	databaseProbeTimeout = 3 * time.Second
+
+	// quotaEventCheckPeriod is how long the quota conflicts found in the
+	// events of a statefulset that is short of pods are used before the
+	// events are listed again, as long as the shortfall does not change.
+	quotaEventCheckPeriod = time.Minute
+
+	// pendingEventCheckPeriod is how long the diagnosis found in the events
+	// of a pending pod is used before the events are listed again, as long
+	// as the pod's conditions do not change.
+	pendingEventCheckPeriod = time.Minute
+
+	// databaseProbePeriod is how long the result of probing a cluster's
+	// database connections is used before they are probed again.
+	databaseProbePeriod = 30 * time.Second
+
+	// createRetryBaseDelay is the wait before retrying after a first failure
+	// to create a child object; it doubles with each consecutive failure.
+	createRetryBaseDelay = 5 * time.Second
+
+	// createRetryMaxDelay is the longest wait between attempts to create a
+	// child object that keeps failing.
+	createRetryMaxDelay = 5 * time.Minute
+
+	// createBreakerThreshold is the number of consecutive creation failures
+	// that opens the circuit breaker and marks the cluster Degraded.
+	createBreakerThreshold = 3
+
+	// createParallelism is the largest number of child object creations
+	// that one reconciler pass runs at once, for example for the roles and
+	// member services of a new cluster.
+	createParallelism = 8
+
+	// podFullCheckPeriod is the longest time between checks of a cluster's
+	// member container states that look at every member pod, rather than
+	// only those with pod events since the previous check.
+	podFullCheckPeriod = 5 * time.Minute
+)
+
+// maxAuditHistory is the number of most recent audit records kept in the
+// cluster status.
+const maxAuditHistory = 50
+
 type roleInfo struct {
 	statefulSet    *appsv1.StatefulSet
 	roleSpec       *kdv1.Role
 	roleStatus     *kdv1.RoleStatus
 	membersByState map[memberState][]*kdv1.MemberStatus
 	desiredPop     int
+	precreated     *roleObjects
+}
+
+// roleObjects are the K8s objects made for a new role, before its status is
+// set up.
+type roleObjects struct {
+	serviceAccount string
+	subdomain      string
+	statefulSet    *appsv1.StatefulSet
+	err            error
 }
@@ -0,0 +1,417 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubedirectorcluster
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-logr/logr"
+
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	"github.com/bluek8s/kubedirector/pkg/catalog"
+	"github.com/bluek8s/kubedirector/pkg/executor"
+	"github.com/bluek8s/kubedirector/pkg/observer"
+	"github.com/bluek8s/kubedirector/pkg/shared"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// syncAppChange notices when the cluster has been switched to a different
+// app, and moves the app-in-use reference accordingly. The status records
+// the app that the cluster was last reconciled against, and starts tracking
+// the progress of the upgrade. The member images are changed when the roles
+// are reconciled.
+func syncAppChange(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorCluster,
+) {
+
+	if cr.Status.AppID == cr.Spec.AppID {
+		return
+	}
+	if cr.Status.AppID != "" {
+		shared.LogInfof(
+			reqLogger,
+			cr,
+			shared.EventReasonCluster,
+			"app changed from %s to %s",
+			cr.Status.AppID,
+			cr.Spec.AppID,
+		)
+		shared.RemoveClusterAppReference(
+			cr.Namespace,
+			cr.Name,
+			*(cr.Spec.AppCatalog),
+			cr.Status.AppID,
+		)
+		shared.EnsureClusterAppReference(
+			cr.Namespace,
+			cr.Name,
+			*(cr.Spec.AppCatalog),
+			cr.Spec.AppID,
+		)
+		startAppUpgrade(cr)
+	}
+	cr.Status.AppID = cr.Spec.AppID
+}
+
+// startAppUpgrade records the start of a switch from the app in the status
+// to the app in the spec. Going back to the app that an unfinished upgrade
+// started from is recorded as a rollback.
+func startAppUpgrade(
+	cr *kdv1.KubeDirectorCluster,
+) {
+
+	upgrade := &kdv1.AppUpgradeStatus{
+		From:    cr.Status.AppID,
+		To:      cr.Spec.AppID,
+		State:   kdv1.AppUpgradeInProgress,
+		Started: metav1.Now(),
+	}
+	prevAppCR, prevAppErr := catalog.FindAppWithID(cr, cr.Status.AppID)
+	if prevAppErr == nil {
+		upgrade.FromVersion = prevAppCR.Spec.Version
+	}
+	appCR, appErr := catalog.GetApp(cr)
+	if appErr == nil {
+		upgrade.ToVersion = appCR.Spec.Version
+	}
+	prevUpgrade := cr.Status.AppUpgrade
+	if (prevUpgrade != nil) && (prevUpgrade.State == kdv1.AppUpgradeInProgress) &&
+		(prevUpgrade.From == cr.Spec.AppID) {
+		upgrade.Rollback = true
+	}
+	cr.Status.AppUpgrade = upgrade
+}
+
+// syncAppUpgradeProgress counts the members that have been configured on
+// the images of the cluster's current app, and marks the app upgrade in the
+// status as completed once that is all of them.
+func syncAppUpgradeProgress(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorCluster,
+) {
+
+	upgrade := cr.Status.AppUpgrade
+	if (upgrade == nil) || (upgrade.State != kdv1.AppUpgradeInProgress) {
+		return
+	}
+	var total, upgraded int32
+	for _, roleStatus := range cr.Status.Roles {
+		appImage, appImageErr := catalog.ImageForRole(cr, roleStatus.Name)
+		if appImageErr != nil {
+			continue
+		}
+		for _, member := range roleStatus.Members {
+			if shared.StringInList(member.State, deletingMemberStates) {
+				continue
+			}
+			total++
+			if (memberState(member.State) == memberReady) &&
+				(member.StateDetail.ConfiguredImage == appImage) {
+				upgraded++
+			}
+		}
+	}
+	upgrade.TotalMembers = total
+	upgrade.UpgradedMembers = upgraded
+	if upgraded < total {
+		return
+	}
+	shared.LogInfof(
+		reqLogger,
+		cr,
+		shared.EventReasonCluster,
+		"upgrade from app %s to %s complete",
+		upgrade.From,
+		upgrade.To,
+	)
+	now := metav1.Now()
+	upgrade.State = kdv1.AppUpgradeCompleted
+	upgrade.Completed = &now
+}
+
+// appUpgradeArgs returns the arguments, quoted for use in the upgrade
+// command, to add to the upgrade event of a member for the upgrade path
+// that the app declares from the version of the previous app, if any.
+func appUpgradeArgs(
+	cr *kdv1.KubeDirectorCluster,
+	appCR *kdv1.KubeDirectorApp,
+) string {
+
+	upgrade := cr.Status.AppUpgrade
+	if (upgrade == nil) || (upgrade.State != kdv1.AppUpgradeInProgress) ||
+		(upgrade.To != cr.Spec.AppID) {
+		return ""
+	}
+	path := catalog.UpgradePath(appCR, upgrade.FromVersion)
+	if path == nil {
+		return ""
+	}
+	args := " --from " + shared.ShellQuote(upgrade.FromVersion)
+	for _, arg := range path.Args {
+		args += " " + shared.ShellQuote(arg)
+	}
+	return strings.Replace(args, "'", `'\''`, -1)
+}
+
+// handleRoleUpgrade checks whether the images used by the role's statefulset
+// match the images that the app now specifies for the role, and if not
+// updates the statefulset, which restarts the members one at a time. The
+// role's Upgrading condition tracks the process until every member is
+// running the new images. Failure here will not be treated as a
+// reconciler-stopping error; we'll just try again next time.
+func handleRoleUpgrade(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorCluster,
+	role *roleInfo,
+) {
+
+	if role.roleSpec == nil {
+		return
+	}
+	upgrading := shared.ConditionIsTrue(role.roleStatus.Conditions, kdv1.RoleUpgrading)
+	if upgrading && executor.StatefulSetRolloutDone(role.statefulSet) &&
+		allRoleMembersReadyOrError(cr, role) {
+		shared.LogInfof(
+			reqLogger,
+			cr,
+			shared.EventReasonRole,
+			"upgrade of role{%s} complete",
+			role.roleStatus.Name,
+		)
+		shared.SetCondition(
+			&role.roleStatus.Conditions,
+			kdv1.RoleUpgrading,
+			corev1.ConditionFalse,
+			"Upgraded",
+			"all members are running the current images",
+		)
+		return
+	}
+
+	appImage, appImageErr := catalog.ImageForRole(cr, role.roleSpec.Name)
+	if appImageErr != nil {
+		return
+	}
+	setupImage, setupImageErr := catalog.SetupImageForRole(cr, role.roleSpec.Name)
+	if setupImageErr != nil {
+		return
+	}
+	currentAppImage, currentSetupImage := executor.StatefulSetImages(role.statefulSet)
+	if currentSetupImage == "" {
+		// Only an existing setup container can have its image changed.
+		setupImage = ""
+	}
+	if (appImage == currentAppImage) && (setupImage == currentSetupImage) {
+		return
+	}
+
+	// Only start the upgrade while the role membership is settled. Members
+	// being created or deleted will be dealt with on a later pass.
+	for _, member := range role.roleStatus.Members {
+		state := memberState(member.State)
+		if state != memberReady && state != memberConfigError {
+			return
+		}
+	}
+
+	shared.LogInfof(
+		reqLogger,
+		cr,
+		shared.EventReasonRole,
+		"upgrading role{%s} from image %s to %s",
+		role.roleStatus.Name,
+		currentAppImage,
+		appImage,
+	)
+	updateErr := executor.UpdateStatefulSetImages(
+		reqLogger,
+		cr,
+		role.statefulSet,
+		appImage,
+		setupImage,
+		role.roleStatus.PodTemplateHash,
+	)
+	if updateErr != nil {
+		shared.LogErrorf(
+			reqLogger,
+			updateErr,
+			cr,
+			shared.EventReasonRole,
+			"failed to update images on StatefulSet{%s}",
+			role.statefulSet.Name,
+		)
+		return
+	}
+	shared.SetCondition(
+		&role.roleStatus.Conditions,
+		kdv1.RoleUpgrading,
+		corev1.ConditionTrue,
+		"RollingUpdate",
+		fmt.Sprintf(
+			"restarting members to use image %s",
+			appImage,
+		),
+	)
+}
+
+// memberAppImage returns the image of the app container in the given
+// member pod, or an empty string if the pod cannot be found.
+func memberAppImage(
+	cr *kdv1.KubeDirectorCluster,
+	podName string,
+) string {
+
+	pod, podErr := observer.GetPod(cr.Namespace, podName)
+	if podErr != nil {
+		return ""
+	}
+	for _, container := range pod.Spec.Containers {
+		if container.Name == executor.AppContainerName {
+			return container.Image
+		}
+	}
+	return ""
+}
+
+// appUpgrade runs the upgrade event of the setup package on a member whose
+// app container has been restarted with a different image than the one it
+// was configured on, if the role's eventList explicitly includes "upgrade".
+// Otherwise nothing is run and the member keeps its earlier setup, since
+// startscripts written for older KubeDirector versions would not recognize
+// the event. Since the new image may come with a new setup package, the package is fetched again
+// and the current configmeta uploaded before the event is run. Like the
+// initial configure, the upgrade runs asynchronously and its result is
+// picked up from the status file by appConfig on a later pass. The returned
+// bool is true if the upgrade was started.
+func appUpgrade(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorCluster,
+	setupInfo *kdv1.SetupPackageInfo,
+	podName string,
+	expectedContainerID string,
+	stateDetail *kdv1.MemberStateDetail,
+	roleName string,
+	configmetaGenerator func(string) string,
+) (bool, error) {
+
+	currentImage := memberAppImage(cr, podName)
+	if (stateDetail.ConfiguredImage == "") || (stateDetail.ConfiguredImage == currentImage) {
+		return false, nil
+	}
+	appCr, appErr := catalog.GetApp(cr)
+	if appErr != nil {
+		return false, appErr
+	}
+	role := catalog.GetRoleFromID(appCr, roleName)
+	if (role == nil) || (role.EventList == nil) ||
+		!shared.StringInList(upgradeEvent, *role.EventList) {
+		return false, nil
+	}
+	// Wait for the ready members to adopt the current configmeta, as for
+	// initial configuration.
+	if configmetaGenerator == nil {
+		return false, nil
+	}
+	shared.LogInfof(
+		reqLogger,
+		cr,
+		shared.EventReasonMember,
+		"running upgrade on member{%s} from image %s to %s",
+		podName,
+		stateDetail.ConfiguredImage,
+		currentImage,
+	)
+	setupErr := setupAppConfig(reqLogger, cr, setupInfo, podName, expectedContainerID, roleName)
+	if setupErr != nil {
+		return false, setupErr
+	}
+	configmetaErr := executor.CreateFile(
+		reqLogger,
+		cr,
+		cr.Namespace,
+		podName,
+		expectedContainerID,
+		executor.AppContainerName,
+		configMetaFile,
+		strings.NewReader(configmetaGenerator(podName)),
+		setupInfo.UseNewSetupLayout,
+	)
+	if configmetaErr != nil {
+		return false, configmetaErr
+	}
+	stateDetail.LastConfigDataGeneration = cr.Status.SpecGenerationToProcess
+	cmd := fmt.Sprintf(
+		appPrepConfigUpgradeCmd,
+		expectedContainerID,
+		quotedHookPrefix(cr, roleName),
+		appUpgradeArgs(cr, appCr),
+	)
+	cmdErr := executor.RunScript(
+		reqLogger,
+		cr,
+		cr.Namespace,
+		podName,
+		expectedContainerID,
+		executor.AppContainerName,
+		"app upgrade",
+		strings.NewReader(cmd),
+	)
+	if cmdErr != nil {
+		return false, cmdErr
+	}
+	return true, nil
+}
+
+// updateRoleTemplateCondition sets the role's RestartRequired condition
+// according to whether the pod template hash recorded on the role's
+// statefulset differs from the hash of the template that KubeDirector would
+// generate now. This happens when a change (for example to the
+// KubeDirectorConfig, or from a KubeDirector upgrade) affects the pod
+// template but is not one that KubeDirector rolls out to existing members
+// on its own.
+func updateRoleTemplateCondition(
+	role *roleInfo,
+) {
+
+	if (role.roleSpec == nil) || (role.roleStatus.PodTemplateHash == "") {
+		return
+	}
+	currentHash := executor.StatefulSetPodTemplateHash(role.statefulSet)
+	if currentHash == role.roleStatus.PodTemplateHash {
+		shared.SetCondition(
+			&role.roleStatus.Conditions,
+			kdv1.RoleRestartRequired,
+			corev1.ConditionFalse,
+			"",
+			"",
+		)
+		return
+	}
+	shared.SetCondition(
+		&role.roleStatus.Conditions,
+		kdv1.RoleRestartRequired,
+		corev1.ConditionTrue,
+		"PodTemplateChanged",
+		fmt.Sprintf(
+			"pod template of StatefulSet{%s} has hash %s but the current spec generates %s",
+			role.statefulSet.Name,
+			currentHash,
+			role.roleStatus.PodTemplateHash,
+		),
+	)
+}
@@ -15,10 +15,25 @@
 package kubedirectorcluster
 
 import (
+	"fmt"
+	"strings"
+
 	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	"github.com/bluek8s/kubedirector/pkg/shared"
 	corev1 "k8s.io/api/core/v1"
 )
 
+// affinityFailureMarkers are (lowercased) fragments of scheduler failure
+// messages that indicate a node was rejected because of affinity,
+// anti-affinity, node selection constraints, or untolerated taints.
+var affinityFailureMarkers = []string{
+	"node selector",
+	"node affinity",
+	"pod affinity",
+	"anti-affinity",
+	"taint",
+}
+
 // updateSchedulingErrorMessage updates MemberStateDetails with SchedulingErrorMessage
 func updateSchedulingErrorMessage(
 	pod *corev1.Pod,
@@ -35,3 +50,49 @@ func updateSchedulingErrorMessage(
 		}
 	}
 }
+
+// updateRoleAffinityCondition examines the scheduling error messages of the
+// members in the given role status, and sets the role's AffinityUnsatisfied
+// condition according to whether any of them indicate an affinity problem.
+func updateRoleAffinityCondition(
+	roleStatus *kdv1.RoleStatus,
+) {
+
+	var blocked []string
+	var lastMessage string
+	for _, memberStatus := range roleStatus.Members {
+		if memberStatus.StateDetail.SchedulingErrorMessage == nil {
+			continue
+		}
+		message := *memberStatus.StateDetail.SchedulingErrorMessage
+		lowerMessage := strings.ToLower(message)
+		for _, marker := range affinityFailureMarkers {
+			if strings.Contains(lowerMessage, marker) {
+				blocked = append(blocked, memberStatus.Pod)
+				lastMessage = message
+				break
+			}
+		}
+	}
+	if len(blocked) == 0 {
+		shared.SetCondition(
+			&roleStatus.Conditions,
+			kdv1.RoleAffinityUnsatisfied,
+			corev1.ConditionFalse,
+			"",
+			"",
+		)
+		return
+	}
+	shared.SetCondition(
+		&roleStatus.Conditions,
+		kdv1.RoleAffinityUnsatisfied,
+		corev1.ConditionTrue,
+		corev1.PodReasonUnschedulable,
+		fmt.Sprintf(
+			"member(s) %s cannot be scheduled: %s",
+			strings.Join(blocked, ","),
+			lastMessage,
+		),
+	)
+}
@@ -0,0 +1,475 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubedirectorclusterjob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	"github.com/bluek8s/kubedirector/pkg/catalog"
+	"github.com/bluek8s/kubedirector/pkg/executor"
+	"github.com/bluek8s/kubedirector/pkg/observer"
+	"github.com/bluek8s/kubedirector/pkg/shared"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// syncJob checks on the job's active run, if any, and starts a new run if
+// one is due. It returns how long to wait before the job should be looked
+// at again, or zero if nothing is expected to happen until the job changes.
+func syncJob(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorClusterJob,
+) (time.Duration, error) {
+
+	if cr.Status == nil {
+		cr.Status = &kdv1.KubeDirectorClusterJobStatus{}
+	}
+	oldStatus := cr.Status.DeepCopy()
+	defer func() {
+		if equality.Semantic.DeepEqual(oldStatus, cr.Status) {
+			return
+		}
+		updateErr := shared.StatusUpdate(context.TODO(), cr)
+		if updateErr != nil {
+			shared.LogError(
+				reqLogger,
+				updateErr,
+				cr,
+				shared.EventReasonNoEvent,
+				"failed to update status",
+			)
+		}
+	}()
+
+	var schedule *cronSchedule
+	if cr.Spec.Schedule != "" {
+		var scheduleErr error
+		schedule, scheduleErr = parseSchedule(cr.Spec.Schedule)
+		if scheduleErr != nil {
+			setBlocked(cr, scheduleErr.Error())
+			return 0, nil
+		}
+	}
+	if (len(cr.Spec.Command) == 0) == (cr.Spec.Hook == "") {
+		setBlocked(cr, "exactly one of command and hook must be given")
+		return 0, nil
+	}
+	cluster, clusterErr := observer.GetCluster(cr.Namespace, cr.Spec.Cluster)
+	if clusterErr != nil {
+		if k8serrors.IsNotFound(clusterErr) {
+			setBlocked(cr, fmt.Sprintf("cluster %s not found", cr.Spec.Cluster))
+			return blockedPollPeriod, nil
+		}
+		return 0, clusterErr
+	}
+	if loadErr := shared.LoadMemberStatusDetail(cluster); loadErr != nil {
+		return 0, loadErr
+	}
+	setBlocked(cr, "")
+
+	if cr.Status.Active != nil {
+		checkRun(reqLogger, cr)
+		if cr.Status.Active != nil {
+			return activeRunPollPeriod, nil
+		}
+	}
+
+	// Work out whether a new run is due, and when the next scheduled run
+	// is. A run that came due while the previous run was in progress is
+	// started now, but missed runs are not made up for otherwise.
+	trigger := ""
+	if cr.Status.RunGeneration == nil {
+		runGeneration := cr.Spec.RunGeneration
+		cr.Status.RunGeneration = &runGeneration
+		if schedule == nil {
+			trigger = triggerCreated
+		}
+	} else if cr.Spec.RunGeneration > *cr.Status.RunGeneration {
+		runGeneration := cr.Spec.RunGeneration
+		cr.Status.RunGeneration = &runGeneration
+		trigger = triggerOnDemand
+	}
+	var nextRun time.Time
+	if (schedule != nil) && !cr.Spec.Suspend {
+		now := time.Now()
+		lastRun := cr.CreationTimestamp.Time
+		if cr.Status.LastScheduleTime != nil {
+			lastRun = cr.Status.LastScheduleTime.Time
+		}
+		nextRun = schedule.next(lastRun)
+		if !nextRun.IsZero() && !now.Before(nextRun) {
+			if trigger == "" {
+				trigger = triggerSchedule
+			}
+			cr.Status.LastScheduleTime = &metav1.Time{Time: now}
+			nextRun = schedule.next(now)
+		}
+	}
+	if trigger != "" {
+		startRun(reqLogger, cr, cluster, trigger)
+		if cr.Status.Active != nil {
+			return activeRunPollPeriod, nil
+		}
+	}
+	if nextRun.IsZero() {
+		return 0, nil
+	}
+	return time.Until(nextRun), nil
+}
+
+// setBlocked sets the job's Blocked condition to true with the given
+// message, or to false if the message is empty.
+func setBlocked(
+	cr *kdv1.KubeDirectorClusterJob,
+	message string,
+) {
+
+	status := corev1.ConditionTrue
+	reason := "Invalid"
+	if message == "" {
+		status = corev1.ConditionFalse
+		reason = ""
+	}
+	shared.SetCondition(
+		&cr.Status.Conditions,
+		kdv1.ClusterJobBlocked,
+		status,
+		reason,
+		message,
+	)
+}
+
+// jobTargets returns the configured members of the cluster that the job
+// should run on, as pairs of role name and member status.
+func jobTargets(
+	cr *kdv1.KubeDirectorClusterJob,
+	cluster *kdv1.KubeDirectorCluster,
+) ([]string, []*kdv1.MemberStatus) {
+
+	var roleNames []string
+	var members []*kdv1.MemberStatus
+	if cluster.Status == nil {
+		return roleNames, members
+	}
+	for i := range cluster.Status.Roles {
+		roleStatus := &(cluster.Status.Roles[i])
+		if (len(cr.Spec.Roles) != 0) && !shared.StringInList(roleStatus.Name, cr.Spec.Roles) {
+			continue
+		}
+		for j := range roleStatus.Members {
+			member := &(roleStatus.Members[j])
+			if (member.Pod == "") || (member.State != memberReady) {
+				continue
+			}
+			if (len(cr.Spec.Members) != 0) && !shared.StringInList(member.Pod, cr.Spec.Members) {
+				continue
+			}
+			roleNames = append(roleNames, roleStatus.Name)
+			members = append(members, member)
+			if cr.Spec.OnePerRole {
+				break
+			}
+		}
+	}
+	return roleNames, members
+}
+
+// jobCommand returns the shell command that runs the job on a member of the
+// given role, escaped for use inside a single-quoted shell string. A hook
+// is run through the role's setup package startscript, with the same user
+// and environment as its other hooks.
+func jobCommand(
+	cr *kdv1.KubeDirectorClusterJob,
+	cluster *kdv1.KubeDirectorCluster,
+	roleName string,
+) (string, error) {
+
+	var command string
+	if cr.Spec.Hook != "" {
+		setupInfo, setupErr := catalog.AppSetupPackageInfo(cluster, roleName)
+		if setupErr != nil {
+			return "", setupErr
+		}
+		if setupInfo == nil {
+			return "", fmt.Errorf(
+				"role %s has no setup package to run hook %s",
+				roleName,
+				cr.Spec.Hook,
+			)
+		}
+		command = catalog.HookPrefix(cluster, roleName) + jobStartscript +
+			" --job " + shared.ShellQuote(cr.Spec.Hook)
+	} else {
+		args := make([]string, len(cr.Spec.Command))
+		for i, arg := range cr.Spec.Command {
+			args[i] = shared.ShellQuote(arg)
+		}
+		command = strings.Join(args, " ")
+	}
+	return strings.Replace(command, "'", `'\''`, -1), nil
+}
+
+// jobDir returns the directory in the app container that holds the status
+// and output files of the job's latest run on that member.
+func jobDir(
+	cr *kdv1.KubeDirectorClusterJob,
+) string {
+
+	return path.Join(jobDirBase, cr.Name)
+}
+
+// startRun starts a new run of the job on each target member, making it
+// the job's active run. If the job cannot be started on any member, the
+// run goes straight into the history as failed.
+func startRun(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorClusterJob,
+	cluster *kdv1.KubeDirectorCluster,
+	trigger string,
+) {
+
+	now := metav1.Now()
+	run := &kdv1.ClusterJobRun{
+		ID:      fmt.Sprintf("%s-%d", cr.Name, now.Unix()),
+		Trigger: trigger,
+		State:   runRunning,
+		Started: now,
+	}
+	cr.Status.Active = run
+	shellless, shelllessErr := catalog.AppShellless(cluster)
+	if shelllessErr != nil {
+		run.Message = shelllessErr.Error()
+		finishRun(reqLogger, cr)
+		return
+	}
+	if shellless {
+		run.Message = "the cluster's app has no shell to run the job"
+		finishRun(reqLogger, cr)
+		return
+	}
+	roleNames, members := jobTargets(cr, cluster)
+	if len(members) == 0 {
+		run.Message = "no configured members match the job"
+		finishRun(reqLogger, cr)
+		return
+	}
+	podNames := make([]string, len(members))
+	for i, member := range members {
+		podNames[i] = member.Pod
+		memberRun := kdv1.ClusterJobMemberRun{
+			Pod:         member.Pod,
+			Role:        roleNames[i],
+			ContainerID: member.StateDetail.LastConfiguredContainer,
+			State:       runRunning,
+		}
+		startErr := startMemberRun(reqLogger, cr, cluster, &memberRun)
+		if startErr != nil {
+			memberRun.State = runFailed
+			memberRun.Message = startErr.Error()
+		}
+		run.Members = append(run.Members, memberRun)
+	}
+	shared.LogInfof(
+		reqLogger,
+		cr,
+		shared.EventReasonClusterJob,
+		"started run %s (%s) on members %s",
+		run.ID,
+		trigger,
+		strings.Join(podNames, ", "),
+	)
+}
+
+// startMemberRun starts the job in the app container of one member. Like
+// the setup package hooks, the job runs asynchronously and its exit status
+// is picked up from a status file on later passes.
+func startMemberRun(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorClusterJob,
+	cluster *kdv1.KubeDirectorCluster,
+	memberRun *kdv1.ClusterJobMemberRun,
+) error {
+
+	command, commandErr := jobCommand(cr, cluster, memberRun.Role)
+	if commandErr != nil {
+		return commandErr
+	}
+	cmd := fmt.Sprintf(
+		jobRunCmd,
+		jobDir(cr),
+		memberRun.ContainerID,
+		command,
+	)
+	return executor.RunScript(
+		reqLogger,
+		cr,
+		cr.Namespace,
+		memberRun.Pod,
+		memberRun.ContainerID,
+		executor.AppContainerName,
+		"cluster job "+cr.Name,
+		strings.NewReader(cmd),
+	)
+}
+
+// checkRun checks on each member of the active run that has not finished,
+// and finishes the run once every member is done or has timed out.
+func checkRun(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorClusterJob,
+) {
+
+	run := cr.Status.Active
+	timeout := defaultJobTimeout
+	if cr.Spec.TimeoutSeconds != nil {
+		timeout = time.Duration(*cr.Spec.TimeoutSeconds) * time.Second
+	}
+	allDone := true
+	for i := range run.Members {
+		memberRun := &(run.Members[i])
+		if memberRun.State != runRunning {
+			continue
+		}
+		checkMemberRun(reqLogger, cr, memberRun)
+		if memberRun.State != runRunning {
+			continue
+		}
+		if time.Since(run.Started.Time) < timeout {
+			allDone = false
+			continue
+		}
+		memberRun.State = runTimedOut
+		memberRun.Message = fmt.Sprintf("did not finish within %v", timeout)
+	}
+	if allDone {
+		finishRun(reqLogger, cr)
+	}
+}
+
+// checkMemberRun reads the status file of the job on one member and, if
+// the job has exited, records its exit status and the end of its output.
+// A member that cannot be reached, or that has restarted and lost the job,
+// is left for the timeout to deal with.
+func checkMemberRun(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorClusterJob,
+	memberRun *kdv1.ClusterJobMemberRun,
+) {
+
+	readFile := func(fileName string) (string, bool) {
+		var strB strings.Builder
+		fileExists, fileError := executor.ReadFile(
+			reqLogger,
+			cr,
+			cr.Namespace,
+			memberRun.Pod,
+			memberRun.ContainerID,
+			executor.AppContainerName,
+			path.Join(jobDir(cr), fileName),
+			&strB,
+		)
+		return strB.String(), fileExists && (fileError == nil)
+	}
+	statusStr, ok := readFile(jobStatusFile)
+	if !ok {
+		return
+	}
+	splitPoint := strings.LastIndex(statusStr, "=")
+	if (splitPoint == -1) || (statusStr[splitPoint+1:] == "") {
+		return
+	}
+	exitStatus, convErr := strconv.Atoi(statusStr[splitPoint+1:])
+	if convErr != nil {
+		memberRun.State = runFailed
+		memberRun.Message = "malformed status file"
+		return
+	}
+	exitStatus32 := int32(exitStatus)
+	memberRun.ExitStatus = &exitStatus32
+	memberRun.State = runSucceeded
+	if exitStatus != 0 {
+		memberRun.State = runFailed
+	}
+	if stdout, stdoutOk := readFile(jobStdoutFile); stdoutOk {
+		memberRun.Stdout = shared.GetLastLines(stdout, jobOutputMaxSize)
+	}
+	if stderr, stderrOk := readFile(jobStderrFile); stderrOk {
+		memberRun.Stderr = shared.GetLastLines(stderr, jobOutputMaxSize)
+	}
+}
+
+// finishRun moves the active run into the history, as succeeded if it ran
+// successfully on every member and failed otherwise. The oldest runs are
+// dropped from the history to keep it within the job's history limit.
+func finishRun(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorClusterJob,
+) {
+
+	run := cr.Status.Active
+	now := metav1.Now()
+	run.Finished = &now
+	var failedPods []string
+	for _, memberRun := range run.Members {
+		if memberRun.State != runSucceeded {
+			failedPods = append(failedPods, memberRun.Pod)
+		}
+	}
+	if (len(run.Members) == 0) || (len(failedPods) != 0) {
+		run.State = runFailed
+		reason := run.Message
+		if len(failedPods) != 0 {
+			reason = "failed on members " + strings.Join(failedPods, ", ")
+		}
+		shared.LogErrorf(
+			reqLogger,
+			errors.New(reason),
+			cr,
+			shared.EventReasonClusterJob,
+			"run %s failed: %s",
+			run.ID,
+			reason,
+		)
+	} else {
+		run.State = runSucceeded
+		shared.LogInfof(
+			reqLogger,
+			cr,
+			shared.EventReasonClusterJob,
+			"run %s succeeded",
+			run.ID,
+		)
+	}
+	limit := defaultHistoryLimit
+	if cr.Spec.HistoryLimit != nil {
+		limit = int(*cr.Spec.HistoryLimit)
+	}
+	cr.Status.History = append(cr.Status.History, *run)
+	if len(cr.Status.History) > limit {
+		cr.Status.History = cr.Status.History[len(cr.Status.History)-limit:]
+	}
+	cr.Status.Active = nil
+}
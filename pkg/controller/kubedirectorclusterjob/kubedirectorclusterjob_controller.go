@@ -0,0 +1,114 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubedirectorclusterjob
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	"github.com/bluek8s/kubedirector/pkg/shared"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+var log = logf.Log.WithName("controller_kubedirectorclusterjob")
+
+// Add creates a new KubeDirectorClusterJob Controller and adds it to the
+// Manager. The Manager will set fields on the Controller and Start it when
+// the Manager is Started.
+func Add(
+	mgr manager.Manager,
+) error {
+
+	return add(mgr, newReconciler(mgr))
+}
+
+// newReconciler returns a new reconcile.Reconciler.
+func newReconciler(
+	mgr manager.Manager,
+) reconcile.Reconciler {
+
+	return &ReconcileKubeDirectorClusterJob{scheme: mgr.GetScheme()}
+}
+
+// add adds a new Controller to mgr with r as the reconcile.Reconciler.
+func add(
+	mgr manager.Manager,
+	r reconcile.Reconciler,
+) error {
+
+	// Create a new controller
+	c, err := controller.New("kubedirectorclusterjob-controller", mgr, controller.Options{Reconciler: r})
+	if err != nil {
+		return err
+	}
+
+	// Watch for changes to primary resource KubeDirectorClusterJob.
+	err = c.Watch(&source.Kind{Type: &kdv1.KubeDirectorClusterJob{}}, &handler.EnqueueRequestForObject{})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// blank assignment to verify that ReconcileKubeDirectorClusterJob implements
+// reconcile.Reconciler.
+var _ reconcile.Reconciler = &ReconcileKubeDirectorClusterJob{}
+
+// ReconcileKubeDirectorClusterJob reconciles a KubeDirectorClusterJob object.
+type ReconcileKubeDirectorClusterJob struct {
+	scheme *runtime.Scheme
+}
+
+// Reconcile reads that state of the cluster for a KubeDirectorClusterJob
+// object and makes changes based on the state read and what is in the
+// KubeDirectorClusterJob.Spec. The request is requeued while a run is in
+// progress, and for the next scheduled run of the job if it has a schedule.
+func (r *ReconcileKubeDirectorClusterJob) Reconcile(
+	request reconcile.Request,
+) (reconcile.Result, error) {
+
+	reqLogger := log.WithValues("Request.Namespace", request.Namespace, "Request.Name", request.Name)
+
+	// Fetch the KubeDirectorClusterJob instance.
+	cr := &kdv1.KubeDirectorClusterJob{}
+	err := shared.Get(context.TODO(), request.NamespacedName, cr)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			// Request object not found, could have been deleted after
+			// reconcile request. Any run still going in the cluster members
+			// is left to finish on its own.
+			return reconcile.Result{}, nil
+		}
+		// Error reading the object - requeue the request.
+		return reconcile.Result{},
+			fmt.Errorf("could not fetch KubeDirectorClusterJob instance: %s", err)
+	}
+
+	start := time.Now()
+	requeueAfter, err := syncJob(reqLogger, cr)
+	shared.ObserveReconcile("KubeDirectorClusterJob", start, err)
+	return reconcile.Result{RequeueAfter: requeueAfter}, err
+}
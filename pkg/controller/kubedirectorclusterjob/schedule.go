@@ -0,0 +1,221 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubedirectorclusterjob
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSchedule is a parsed five-field cron schedule. Each field is a bitmask
+// of the values it matches. As in cron, when both the day-of-month and the
+// day-of-week fields are restricted, a day matching either one matches.
+type cronSchedule struct {
+	minute     uint64
+	hour       uint64
+	dayOfMonth uint64
+	month      uint64
+	dayOfWeek  uint64
+	anyDom     bool
+	anyDow     bool
+}
+
+// cronField describes the allowed range of one field of a cron schedule,
+// and the names (if any) that may be used for its values.
+type cronField struct {
+	name  string
+	min   int
+	max   int
+	names map[string]int
+}
+
+var cronFields = []cronField{
+	{"minute", 0, 59, nil},
+	{"hour", 0, 23, nil},
+	{"day of month", 1, 31, nil},
+	{"month", 1, 12, map[string]int{
+		"JAN": 1, "FEB": 2, "MAR": 3, "APR": 4, "MAY": 5, "JUN": 6,
+		"JUL": 7, "AUG": 8, "SEP": 9, "OCT": 10, "NOV": 11, "DEC": 12,
+	}},
+	{"day of week", 0, 7, map[string]int{
+		"SUN": 0, "MON": 1, "TUE": 2, "WED": 3, "THU": 4, "FRI": 5, "SAT": 6,
+	}},
+}
+
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// ValidateSchedule checks that the given cron schedule of a cluster job can
+// be parsed, returning the parse error if not.
+func ValidateSchedule(
+	schedule string,
+) error {
+
+	_, parseErr := parseSchedule(schedule)
+	return parseErr
+}
+
+// parseSchedule parses a standard five-field cron schedule (minute, hour,
+// day of month, month, day of week), where each field is "*" or a comma
+// separated list of values and ranges, optionally with a "/step". Months
+// and days of the week can also be given by their three-letter English
+// names, in any case. The usual "@daily" style macros are also accepted.
+// Day of week 7 is Sunday, like 0.
+func parseSchedule(
+	schedule string,
+) (*cronSchedule, error) {
+
+	if expanded, isMacro := cronMacros[strings.TrimSpace(schedule)]; isMacro {
+		schedule = expanded
+	}
+	fields := strings.Fields(schedule)
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf(
+			"schedule {%s} must have %d fields",
+			schedule,
+			len(cronFields),
+		)
+	}
+	masks := make([]uint64, len(cronFields))
+	for i, field := range fields {
+		mask, parseErr := parseCronField(field, cronFields[i])
+		if parseErr != nil {
+			return nil, parseErr
+		}
+		masks[i] = mask
+	}
+	// Fold Sunday-as-7 into Sunday-as-0.
+	if masks[4]&(1<<7) != 0 {
+		masks[4] |= 1
+	}
+	return &cronSchedule{
+		minute:     masks[0],
+		hour:       masks[1],
+		dayOfMonth: masks[2],
+		month:      masks[3],
+		dayOfWeek:  masks[4],
+		anyDom:     strings.HasPrefix(fields[2], "*"),
+		anyDow:     strings.HasPrefix(fields[4], "*"),
+	}, nil
+}
+
+// parseCronField parses one field of a cron schedule into a bitmask of the
+// values it matches.
+func parseCronField(
+	field string,
+	limits cronField,
+) (uint64, error) {
+
+	var mask uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, step := part, 1
+		if slash := strings.Index(part, "/"); slash != -1 {
+			rangePart = part[:slash]
+			parsedStep, stepErr := strconv.Atoi(part[slash+1:])
+			if (stepErr != nil) || (parsedStep <= 0) {
+				return 0, fmt.Errorf("invalid step in %s field {%s}", limits.name, field)
+			}
+			step = parsedStep
+		}
+		low, high := limits.min, limits.max
+		if rangePart != "*" {
+			bounds := strings.SplitN(rangePart, "-", 2)
+			var lowErr, highErr error
+			low, lowErr = cronValue(bounds[0], limits)
+			high, highErr = low, nil
+			if len(bounds) == 2 {
+				high, highErr = cronValue(bounds[1], limits)
+			} else if step != 1 {
+				// As in cron, "n/step" means from n to the end of the range.
+				high = limits.max
+			}
+			if (lowErr != nil) || (highErr != nil) ||
+				(low < limits.min) || (high > limits.max) || (low > high) {
+				return 0, fmt.Errorf("invalid %s field {%s}", limits.name, field)
+			}
+		}
+		for value := low; value <= high; value += step {
+			mask |= 1 << uint(value)
+		}
+	}
+	return mask, nil
+}
+
+// cronValue parses one value of a cron schedule field, either as a number
+// or as one of the field's names.
+func cronValue(
+	value string,
+	limits cronField,
+) (int, error) {
+
+	if named, isName := limits.names[strings.ToUpper(value)]; isName {
+		return named, nil
+	}
+	return strconv.Atoi(value)
+}
+
+// matchesDay reports whether the schedule allows the day of the given time.
+func (s *cronSchedule) matchesDay(
+	t time.Time,
+) bool {
+
+	domMatch := s.dayOfMonth&(1<<uint(t.Day())) != 0
+	dowMatch := s.dayOfWeek&(1<<uint(t.Weekday())) != 0
+	if s.anyDom || s.anyDow {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+// next returns the first time after the given time that matches the
+// schedule, in UTC. A schedule that can never match (such as February 30)
+// gives the zero time.
+func (s *cronSchedule) next(
+	after time.Time,
+) time.Time {
+
+	t := after.UTC().Truncate(time.Minute).Add(time.Minute)
+	// Any schedule that can match at all does so within a few years.
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if !s.matchesDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = t.Truncate(time.Hour).Add(time.Hour)
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
@@ -0,0 +1,246 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubedirectorclusterjob
+
+import (
+	"testing"
+	"time"
+)
+
+// bits returns the schedule field bitmask matching the given values.
+func bits(
+	values ...int,
+) uint64 {
+
+	var mask uint64
+	for _, value := range values {
+		mask |= 1 << uint(value)
+	}
+	return mask
+}
+
+// span returns the values from low to high inclusive, in the given steps.
+func span(
+	low int,
+	high int,
+	step int,
+) []int {
+
+	var values []int
+	for value := low; value <= high; value += step {
+		values = append(values, value)
+	}
+	return values
+}
+
+func TestParseSchedule(t *testing.T) {
+
+	tests := []struct {
+		schedule string
+		want     cronSchedule
+	}{
+		{
+			schedule: "* * * * *",
+			want: cronSchedule{
+				minute:     bits(span(0, 59, 1)...),
+				hour:       bits(span(0, 23, 1)...),
+				dayOfMonth: bits(span(1, 31, 1)...),
+				month:      bits(span(1, 12, 1)...),
+				dayOfWeek:  bits(span(0, 7, 1)...),
+				anyDom:     true,
+				anyDow:     true,
+			},
+		},
+		{
+			schedule: "0 9-17 * * *",
+			want: cronSchedule{
+				minute:     bits(0),
+				hour:       bits(span(9, 17, 1)...),
+				dayOfMonth: bits(span(1, 31, 1)...),
+				month:      bits(span(1, 12, 1)...),
+				dayOfWeek:  bits(span(0, 7, 1)...),
+				anyDom:     true,
+				anyDow:     true,
+			},
+		},
+		{
+			schedule: "*/15 */6 * * *",
+			want: cronSchedule{
+				minute:     bits(0, 15, 30, 45),
+				hour:       bits(0, 6, 12, 18),
+				dayOfMonth: bits(span(1, 31, 1)...),
+				month:      bits(span(1, 12, 1)...),
+				dayOfWeek:  bits(span(0, 7, 1)...),
+				anyDom:     true,
+				anyDow:     true,
+			},
+		},
+		{
+			schedule: "5/20 1-10/3 * * *",
+			want: cronSchedule{
+				minute:     bits(5, 25, 45),
+				hour:       bits(1, 4, 7, 10),
+				dayOfMonth: bits(span(1, 31, 1)...),
+				month:      bits(span(1, 12, 1)...),
+				dayOfWeek:  bits(span(0, 7, 1)...),
+				anyDom:     true,
+				anyDow:     true,
+			},
+		},
+		{
+			schedule: "0,30 0 1,15,28-31 * *",
+			want: cronSchedule{
+				minute:     bits(0, 30),
+				hour:       bits(0),
+				dayOfMonth: bits(1, 15, 28, 29, 30, 31),
+				month:      bits(span(1, 12, 1)...),
+				dayOfWeek:  bits(span(0, 7, 1)...),
+				anyDom:     false,
+				anyDow:     true,
+			},
+		},
+		{
+			schedule: "0 0 * JAN-Mar,dec mon-FRI",
+			want: cronSchedule{
+				minute:     bits(0),
+				hour:       bits(0),
+				dayOfMonth: bits(span(1, 31, 1)...),
+				month:      bits(1, 2, 3, 12),
+				dayOfWeek:  bits(1, 2, 3, 4, 5),
+				anyDom:     true,
+				anyDow:     false,
+			},
+		},
+		{
+			schedule: "0 0 * * 7",
+			want: cronSchedule{
+				minute:     bits(0),
+				hour:       bits(0),
+				dayOfMonth: bits(span(1, 31, 1)...),
+				month:      bits(span(1, 12, 1)...),
+				dayOfWeek:  bits(0, 7),
+				anyDom:     true,
+				anyDow:     false,
+			},
+		},
+		{
+			schedule: "@hourly",
+			want: cronSchedule{
+				minute:     bits(0),
+				hour:       bits(span(0, 23, 1)...),
+				dayOfMonth: bits(span(1, 31, 1)...),
+				month:      bits(span(1, 12, 1)...),
+				dayOfWeek:  bits(span(0, 7, 1)...),
+				anyDom:     true,
+				anyDow:     true,
+			},
+		},
+	}
+	for _, test := range tests {
+		got, err := parseSchedule(test.schedule)
+		if err != nil {
+			t.Errorf("parseSchedule(%q): unexpected error %v", test.schedule, err)
+			continue
+		}
+		if *got != test.want {
+			t.Errorf("parseSchedule(%q) = %+v, want %+v", test.schedule, *got, test.want)
+		}
+	}
+}
+
+func TestParseScheduleInvalid(t *testing.T) {
+
+	schedules := []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"@sometimes",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * 32 * *",
+		"* * * 0 *",
+		"* * * 13 *",
+		"* * * * 8",
+		"-1 * * * *",
+		"a * * * *",
+		"5-1 * * * *",
+		"1,,2 * * * *",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"1-2-3 * * * *",
+		"* * * FOO *",
+		"* * * JAN-FOO *",
+		"* * * * MON-",
+		"* * MON * *",
+		"* * * * JAN",
+	}
+	for _, schedule := range schedules {
+		if _, err := parseSchedule(schedule); err == nil {
+			t.Errorf("parseSchedule(%q): expected an error", schedule)
+		}
+		if ValidateSchedule(schedule) == nil {
+			t.Errorf("ValidateSchedule(%q): expected an error", schedule)
+		}
+	}
+}
+
+func TestScheduleNext(t *testing.T) {
+
+	tests := []struct {
+		schedule string
+		after    time.Time
+		want     time.Time
+	}{
+		{
+			// Wednesday to the next Monday.
+			schedule: "0 0 * * MON",
+			after:    time.Date(2024, 1, 3, 12, 0, 0, 0, time.UTC),
+			want:     time.Date(2024, 1, 8, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			// A match in the current minute is not "after".
+			schedule: "*/15 * * * *",
+			after:    time.Date(2024, 1, 3, 12, 15, 30, 0, time.UTC),
+			want:     time.Date(2024, 1, 3, 12, 30, 0, 0, time.UTC),
+		},
+		{
+			// Either the day of month or the day of week may match.
+			schedule: "0 0 13 * FRI",
+			after:    time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			want:     time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			schedule: "30 2 29 FEB *",
+			after:    time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC),
+			want:     time.Date(2024, 2, 29, 2, 30, 0, 0, time.UTC),
+		},
+		{
+			schedule: "0 0 30 2 *",
+			after:    time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			want:     time.Time{},
+		},
+	}
+	for _, test := range tests {
+		parsed, err := parseSchedule(test.schedule)
+		if err != nil {
+			t.Errorf("parseSchedule(%q): unexpected error %v", test.schedule, err)
+			continue
+		}
+		if got := parsed.next(test.after); !got.Equal(test.want) {
+			t.Errorf("next(%q, %v) = %v, want %v", test.schedule, test.after, got, test.want)
+		}
+	}
+}
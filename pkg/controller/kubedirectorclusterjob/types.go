@@ -0,0 +1,75 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubedirectorclusterjob
+
+import (
+	"time"
+)
+
+const (
+	// activeRunPollPeriod is how often a job with a run in progress is
+	// checked.
+	activeRunPollPeriod = 10 * time.Second
+
+	// blockedPollPeriod is how often a job that cannot run because its
+	// cluster is missing is checked again.
+	blockedPollPeriod = time.Minute
+
+	// defaultJobTimeout is how long a run is given on each member if the job
+	// does not say.
+	defaultJobTimeout = time.Hour
+
+	// defaultHistoryLimit is how many finished runs are kept in the job
+	// status if the job does not say.
+	defaultHistoryLimit = 10
+
+	// jobOutputMaxSize limits how much of the end of the stdout and stderr
+	// of a run on a member is kept in the job status.
+	jobOutputMaxSize int32 = 1024
+
+	// memberReady is the cluster member state in which a job can be run on
+	// the member.
+	memberReady = "configured"
+)
+
+// Reasons for starting a run of a job.
+const (
+	triggerCreated  = "created"
+	triggerOnDemand = "onDemand"
+	triggerSchedule = "schedule"
+)
+
+// States of a job run, and of its part on each member.
+const (
+	runRunning   = "running"
+	runSucceeded = "succeeded"
+	runFailed    = "failed"
+	runTimedOut  = "timedOut"
+)
+
+// Files and commands used to run a job in a member's app container. The
+// startscript is the one installed by the cluster controller from the
+// role's setup package.
+const (
+	jobDirBase     = "/var/lib/kubedirector/jobs"
+	jobStartscript = "/opt/guestconfig/*/startscript"
+	jobStatusFile  = "run.status"
+	jobStdoutFile  = "run.stdout"
+	jobStderrFile  = "run.stderr"
+	jobRunCmd      = `mkdir -p %[1]s && rm -f %[1]s/run.* &&
+	echo -n %[2]s= > %[1]s/` + jobStatusFile + ` &&
+	nohup sh -c '%[3]s 2>%[1]s/` + jobStderrFile + ` 1>%[1]s/` + jobStdoutFile + `;
+	echo -n $? >> %[1]s/` + jobStatusFile + `' &`
+)
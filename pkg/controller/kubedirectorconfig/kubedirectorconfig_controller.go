@@ -17,6 +17,7 @@ package kubedirectorconfig
 import (
 	"context"
 	"fmt"
+	"time"
 
 	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
 	"github.com/bluek8s/kubedirector/pkg/shared"
@@ -121,6 +122,8 @@ func (r *ReconcileKubeDirectorConfig) Reconcile(
 			fmt.Errorf("could not fetch KubeDirectorConfig instance: %s", err)
 	}
 
+	start := time.Now()
 	err = r.syncConfig(reqLogger, cr)
+	shared.ObserveReconcile("KubeDirectorConfig", start, err)
 	return reconcileResult, err
 }
@@ -37,7 +37,8 @@ const (
 // syncSecret runs the reconciliation logic. It is invoked because of a
 // change in or addition of secret instance, currently there is no
 // polling for this resource. If the secret is not labeled
-// with key "kubedirector.hpe.com/secretType" then no op
+// with key "kubedirector.hpe.com/secretType" then it is only of interest
+// as the credentials for an object store or database connection.
 func (r *ReconcileSecret) syncSecret(
 	reqLogger logr.Logger,
 	secret *corev1.Secret,
@@ -45,15 +46,29 @@ func (r *ReconcileSecret) syncSecret(
 
 	// Memoize state of the incoming object.
 	oldSecret, _ := observer.GetSecret(secret.Namespace, secret.Name)
-	if _, ok := oldSecret.Labels[secretType]; !ok {
-		return nil
-	}
+	_, isTyped := oldSecret.Labels[secretType]
 	/* anonymous fun to check if some cluster
 	   is using this config map as a connection */
 	isClusterUsingSecret := func(secretName string, cluster kdv1.KubeDirectorCluster) bool {
-		clusterSecrets := cluster.Spec.Connections.Secrets
-		for _, clusterSecret := range clusterSecrets {
-			if clusterSecret == secretName {
+		if isTyped {
+			clusterSecrets := cluster.Spec.Connections.Secrets
+			for _, clusterSecret := range clusterSecrets {
+				if clusterSecret == secretName {
+					return true
+				}
+			}
+		}
+		for _, store := range cluster.Spec.Connections.ObjectStores {
+			if (store.SecretRef != nil) && (*store.SecretRef == secretName) {
+				return true
+			}
+		}
+		for _, db := range cluster.Spec.Connections.Databases {
+			if (db.SecretRef != nil) && (*db.SecretRef == secretName) {
+				return true
+			}
+			if (db.TLS != nil) && (db.TLS.CASecretRef != nil) &&
+				(*db.TLS.CASecretRef == secretName) {
 				return true
 			}
 		}
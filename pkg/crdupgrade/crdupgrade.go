@@ -0,0 +1,337 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crdupgrade
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/bluek8s/kubedirector/pkg/shared"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/yaml"
+)
+
+// Run applies the CRDs shipped with KubeDirector and migrates any custom
+// resources stored in older versions, retrying with backoff on failure. It
+// returns an error if this has not succeeded after maxUpgradeAttempts, in
+// which case reconciliation must not start against an inconsistent schema.
+// If the CRD directory does not exist (e.g. when running locally) there is
+// nothing to do.
+func Run(
+	log logr.Logger,
+	ownerRef metav1.OwnerReference,
+) error {
+
+	crdDir := defaultCRDDir
+	if dir, found := os.LookupEnv(crdDirEnvVar); found {
+		crdDir = dir
+	}
+	if _, statErr := os.Stat(crdDir); os.IsNotExist(statErr) {
+		log.Info("no CRD directory; skipping CRD upgrade", "dir", crdDir)
+		return nil
+	}
+
+	wait := time.Second
+	for attempt := 1; ; attempt++ {
+		upgradeErr := upgrade(log, crdDir, ownerRef)
+		if upgradeErr == nil {
+			setStatus(log, ownerRef, upgradeComplete, "all CRDs up to date")
+			log.Info("CRD upgrade complete")
+			return nil
+		}
+		if attempt == maxUpgradeAttempts {
+			setStatus(log, ownerRef, upgradeFailed, upgradeErr.Error())
+			return fmt.Errorf("CRD upgrade failed after %d attempts: %v", attempt, upgradeErr)
+		}
+		setStatus(log, ownerRef, upgradeRetrying, upgradeErr.Error())
+		log.Error(upgradeErr, fmt.Sprintf("CRD upgrade failed; trying again in %v", wait))
+		time.Sleep(wait)
+		if wait < maxRetryWait {
+			wait = wait * 2
+		}
+	}
+}
+
+// upgrade makes one pass through applying and migrating every shipped CRD.
+func upgrade(
+	log logr.Logger,
+	crdDir string,
+	ownerRef metav1.OwnerReference,
+) error {
+
+	crds, readErr := readCRDs(crdDir)
+	if readErr != nil {
+		return readErr
+	}
+	for _, crd := range crds {
+		setStatus(log, ownerRef, upgradeApplying, "applying CRD "+crd.GetName())
+		if applyErr := applyCRD(log, crd); applyErr != nil {
+			return fmt.Errorf("failed to apply CRD %s: %v", crd.GetName(), applyErr)
+		}
+	}
+	for _, crd := range crds {
+		established, waitErr := waitEstablished(crd)
+		if waitErr != nil {
+			return fmt.Errorf("failed waiting for CRD %s: %v", crd.GetName(), waitErr)
+		}
+		setStatus(log, ownerRef, upgradeMigrating, "migrating resources for CRD "+crd.GetName())
+		if migrateErr := migrateStorage(log, established); migrateErr != nil {
+			return fmt.Errorf("failed to migrate CRD %s: %v", crd.GetName(), migrateErr)
+		}
+	}
+	return nil
+}
+
+// readCRDs parses every CRD YAML file in the given directory, in name order.
+func readCRDs(
+	crdDir string,
+) ([]*unstructured.Unstructured, error) {
+
+	files, globErr := filepath.Glob(filepath.Join(crdDir, "*_crd.yaml"))
+	if globErr != nil {
+		return nil, globErr
+	}
+	sort.Strings(files)
+	var result []*unstructured.Unstructured
+	for _, file := range files {
+		content, readErr := ioutil.ReadFile(file)
+		if readErr != nil {
+			return nil, readErr
+		}
+		obj := make(map[string]interface{})
+		if parseErr := yaml.Unmarshal(content, &obj); parseErr != nil {
+			return nil, fmt.Errorf("failed to parse %s: %v", file, parseErr)
+		}
+		result = append(result, &unstructured.Unstructured{Object: obj})
+	}
+	return result, nil
+}
+
+// applyCRD creates the given CRD in k8s, or updates the spec of the
+// existing CRD if it differs.
+func applyCRD(
+	log logr.Logger,
+	desired *unstructured.Unstructured,
+) error {
+
+	existing := &unstructured.Unstructured{}
+	existing.SetGroupVersionKind(desired.GroupVersionKind())
+	getErr := shared.Get(
+		context.TODO(),
+		types.NamespacedName{Name: desired.GetName()},
+		existing,
+	)
+	if getErr != nil {
+		if !errors.IsNotFound(getErr) {
+			return getErr
+		}
+		log.Info("creating CRD", "name", desired.GetName())
+		return shared.Create(context.TODO(), desired.DeepCopy())
+	}
+	// The apiserver fills in defaults for spec properties that the shipped
+	// CRD leaves out, so only compare (and overwrite) the properties that
+	// the shipped CRD does set.
+	existingSpec, _, _ := unstructured.NestedMap(existing.Object, "spec")
+	desiredSpec, _, _ := unstructured.NestedMap(desired.Object, "spec")
+	if existingSpec == nil {
+		existingSpec = make(map[string]interface{})
+	}
+	differs := false
+	for key, value := range desiredSpec {
+		if !equality.Semantic.DeepEqual(existingSpec[key], value) {
+			existingSpec[key] = value
+			differs = true
+		}
+	}
+	if !differs {
+		return nil
+	}
+	log.Info("updating CRD", "name", desired.GetName())
+	existing.Object["spec"] = existingSpec
+	return shared.Update(context.TODO(), existing)
+}
+
+// waitEstablished polls the named CRD until it has the Established
+// condition, and returns the current CRD object.
+func waitEstablished(
+	crd *unstructured.Unstructured,
+) (*unstructured.Unstructured, error) {
+
+	deadline := time.Now().Add(establishTimeout)
+	for {
+		current := &unstructured.Unstructured{}
+		current.SetGroupVersionKind(crd.GroupVersionKind())
+		getErr := shared.Get(
+			context.TODO(),
+			types.NamespacedName{Name: crd.GetName()},
+			current,
+		)
+		if getErr == nil {
+			conditions, _, _ := unstructured.NestedSlice(current.Object, "status", "conditions")
+			for _, c := range conditions {
+				condition, ok := c.(map[string]interface{})
+				if ok && (condition["type"] == "Established") && (condition["status"] == "True") {
+					return current, nil
+				}
+			}
+		}
+		if time.Now().After(deadline) {
+			if getErr != nil {
+				return nil, getErr
+			}
+			return nil, fmt.Errorf("not established after %v", establishTimeout)
+		}
+		time.Sleep(2 * time.Second)
+	}
+}
+
+// migrateStorage rewrites every resource of the given CRD's kind if the CRD
+// reports that some resources may be stored in a version other than the
+// current storage version, then trims the CRD's storedVersions. Rewriting a
+// resource unchanged is enough to have the apiserver re-encode it in the
+// storage version.
+func migrateStorage(
+	log logr.Logger,
+	crd *unstructured.Unstructured,
+) error {
+
+	storageVersion := crdStorageVersion(crd)
+	if storageVersion == "" {
+		return fmt.Errorf("no storage version")
+	}
+	storedVersions, _, _ := unstructured.NestedStringSlice(crd.Object, "status", "storedVersions")
+	if (len(storedVersions) == 1) && (storedVersions[0] == storageVersion) {
+		return nil
+	}
+
+	group, _, _ := unstructured.NestedString(crd.Object, "spec", "group")
+	kind, _, _ := unstructured.NestedString(crd.Object, "spec", "names", "kind")
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(
+		schema.GroupVersionKind{
+			Group:   group,
+			Version: storageVersion,
+			Kind:    kind + "List",
+		},
+	)
+	if listErr := shared.List(context.TODO(), list); listErr != nil {
+		return listErr
+	}
+	log.Info(
+		"migrating stored resources",
+		"crd", crd.GetName(),
+		"storedVersions", storedVersions,
+		"storageVersion", storageVersion,
+		"count", len(list.Items),
+	)
+	for i := range list.Items {
+		updateErr := shared.Update(context.TODO(), &(list.Items[i]))
+		// A conflict means someone else has written the resource since we
+		// listed it, which accomplishes the same thing.
+		if (updateErr != nil) && !errors.IsConflict(updateErr) && !errors.IsNotFound(updateErr) {
+			return fmt.Errorf(
+				"failed to rewrite %s/%s: %v",
+				list.Items[i].GetNamespace(),
+				list.Items[i].GetName(),
+				updateErr,
+			)
+		}
+	}
+
+	setErr := unstructured.SetNestedStringSlice(
+		crd.Object,
+		[]string{storageVersion},
+		"status",
+		"storedVersions",
+	)
+	if setErr != nil {
+		return setErr
+	}
+	return shared.StatusUpdate(context.TODO(), crd)
+}
+
+// crdStorageVersion returns the version in which the given CRD stores its
+// resources.
+func crdStorageVersion(
+	crd *unstructured.Unstructured,
+) string {
+
+	versions, _, _ := unstructured.NestedSlice(crd.Object, "spec", "versions")
+	for _, v := range versions {
+		version, ok := v.(map[string]interface{})
+		if ok && (version["storage"] == true) {
+			name, _ := version["name"].(string)
+			return name
+		}
+	}
+	version, _, _ := unstructured.NestedString(crd.Object, "spec", "version")
+	return version
+}
+
+// setStatus publishes the current upgrade state in the status configmap.
+// Failure to do so is logged, but is not fatal to the upgrade.
+func setStatus(
+	log logr.Logger,
+	ownerRef metav1.OwnerReference,
+	state upgradeState,
+	message string,
+) {
+
+	kdNamespace, nsErr := shared.GetKubeDirectorNamespace()
+	if nsErr != nil {
+		log.Error(nsErr, "failed to publish CRD upgrade status")
+		return
+	}
+	data := map[string]string{
+		"state":       string(state),
+		"message":     message,
+		"lastUpdated": time.Now().UTC().Format(time.RFC3339),
+	}
+	cm := &corev1.ConfigMap{}
+	writeErr := shared.Get(
+		context.TODO(),
+		types.NamespacedName{Namespace: kdNamespace, Name: statusConfigMapName},
+		cm,
+	)
+	if writeErr == nil {
+		cm.Data = data
+		writeErr = shared.Update(context.TODO(), cm)
+	} else if errors.IsNotFound(writeErr) {
+		cm = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            statusConfigMapName,
+				Namespace:       kdNamespace,
+				OwnerReferences: []metav1.OwnerReference{ownerRef},
+			},
+			Data: data,
+		}
+		writeErr = shared.Create(context.TODO(), cm)
+	}
+	if writeErr != nil {
+		log.Error(writeErr, "failed to publish CRD upgrade status", "state", state)
+	}
+}
@@ -0,0 +1,24 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package crdupgrade brings the KubeDirector CRDs in k8s up to date with the
+// ones shipped in the KubeDirector image, at startup and before any
+// reconciliation begins.
+//
+// Each shipped CRD is created or updated, and once it is established any
+// existing custom resources still stored in an older version are rewritten
+// so that the CRD's storedVersions can be trimmed to the current storage
+// version. Progress is published in a configmap in the KubeDirector
+// namespace.
+package crdupgrade
@@ -0,0 +1,51 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crdupgrade
+
+import (
+	"time"
+)
+
+// upgradeState is the overall progress of the CRD upgrade, as reported in
+// the status configmap.
+type upgradeState string
+
+const (
+	upgradeApplying  upgradeState = "applying"
+	upgradeMigrating upgradeState = "migrating"
+	upgradeRetrying  upgradeState = "retrying"
+	upgradeComplete  upgradeState = "complete"
+	upgradeFailed    upgradeState = "failed"
+)
+
+const (
+	// crdDirEnvVar can be set to override the directory from which the
+	// shipped CRD YAML files are read.
+	crdDirEnvVar = "KD_CRD_DIR"
+	// defaultCRDDir is where the KubeDirector image places its CRD files.
+	defaultCRDDir = "/home/kubedirector/crds"
+	// statusConfigMapName is the configmap, in the KubeDirector namespace,
+	// where upgrade progress is published.
+	statusConfigMapName = "kubedirector-crd-upgrade"
+
+	// establishTimeout is how long to wait for an applied CRD to become
+	// established before retrying the whole upgrade.
+	establishTimeout = 60 * time.Second
+	// maxRetryWait bounds the backoff between upgrade attempts.
+	maxRetryWait = 256 * time.Second
+	// maxUpgradeAttempts is how many times the upgrade is tried before
+	// giving up, which with the backoff is roughly eight minutes.
+	maxUpgradeAttempts = 10
+)
@@ -0,0 +1,28 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package e2e is a reusable end-to-end test harness for KubeDirector and for
+// the KubeDirectorApps run by it.
+//
+// An Environment provides a k8s cluster to test against: either an envtest
+// control plane (which has no nodes, so is only useful for exercising CRDs
+// and admission) or a kind cluster. A Framework built on that environment
+// can install manifests such as the KubeDirector CRDs and deployment,
+// create apps and clusters in scratch namespaces, and wait for clusters and
+// their members to reach expected states.
+//
+// This package deliberately does not depend on the KubeDirector operator
+// packages (other than the API types), so that it can be imported by
+// downstream test suites that validate their own app catalogs.
+package e2e
@@ -0,0 +1,175 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package e2e
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+)
+
+// EnvtestEnvironment runs a local apiserver and etcd through envtest, with
+// the CRDs from the given directories installed. The envtest binaries must
+// be available as described in the controller-runtime envtest docs.
+type EnvtestEnvironment struct {
+	CRDDirectoryPaths []string
+	env               *envtest.Environment
+}
+
+// Start implements Environment.
+func (e *EnvtestEnvironment) Start() (*rest.Config, error) {
+
+	e.env = &envtest.Environment{
+		CRDDirectoryPaths: e.CRDDirectoryPaths,
+	}
+	return e.env.Start()
+}
+
+// Stop implements Environment.
+func (e *EnvtestEnvironment) Stop() error {
+
+	if e.env == nil {
+		return nil
+	}
+	return e.env.Stop()
+}
+
+// RunsPods implements Environment. An envtest control plane has no nodes.
+func (e *EnvtestEnvironment) RunsPods() bool {
+
+	return false
+}
+
+// KubeconfigEnvironment uses an existing cluster, reached through the
+// kubeconfig file at Path. If Path is empty the usual kubeconfig loading
+// rules apply (KUBECONFIG environment variable, then ~/.kube/config).
+type KubeconfigEnvironment struct {
+	Path string
+}
+
+// Start implements Environment.
+func (e *KubeconfigEnvironment) Start() (*rest.Config, error) {
+
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	if e.Path != "" {
+		rules.ExplicitPath = e.Path
+	}
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		rules,
+		&clientcmd.ConfigOverrides{},
+	).ClientConfig()
+}
+
+// Stop implements Environment. The cluster is left as it is.
+func (e *KubeconfigEnvironment) Stop() error {
+
+	return nil
+}
+
+// RunsPods implements Environment.
+func (e *KubeconfigEnvironment) RunsPods() bool {
+
+	return true
+}
+
+// KindEnvironment uses a kind cluster with the given name. If the cluster
+// does not already exist it is created by Start and deleted by Stop. Any
+// listed images are loaded into the cluster's nodes, which is useful for
+// testing a locally built KubeDirector image.
+type KindEnvironment struct {
+	Name       string
+	NodeImage  string
+	LoadImages []string
+	created    bool
+}
+
+// Start implements Environment.
+func (e *KindEnvironment) Start() (*rest.Config, error) {
+
+	if !e.exists() {
+		args := []string{"create", "cluster", "--name", e.Name, "--wait", "5m"}
+		if e.NodeImage != "" {
+			args = append(args, "--image", e.NodeImage)
+		}
+		if _, createErr := runKind(args...); createErr != nil {
+			return nil, createErr
+		}
+		e.created = true
+	}
+	for _, image := range e.LoadImages {
+		if _, loadErr := runKind("load", "docker-image", image, "--name", e.Name); loadErr != nil {
+			return nil, loadErr
+		}
+	}
+	kubeconfig, configErr := runKind("get", "kubeconfig", "--name", e.Name)
+	if configErr != nil {
+		return nil, configErr
+	}
+	return clientcmd.RESTConfigFromKubeConfig(kubeconfig)
+}
+
+// Stop implements Environment.
+func (e *KindEnvironment) Stop() error {
+
+	if !e.created {
+		return nil
+	}
+	_, deleteErr := runKind("delete", "cluster", "--name", e.Name)
+	return deleteErr
+}
+
+// RunsPods implements Environment.
+func (e *KindEnvironment) RunsPods() bool {
+
+	return true
+}
+
+// exists checks whether a kind cluster of the given name already exists.
+func (e *KindEnvironment) exists() bool {
+
+	out, err := runKind("get", "clusters")
+	if err != nil {
+		return false
+	}
+	for _, line := range strings.Fields(string(out)) {
+		if line == e.Name {
+			return true
+		}
+	}
+	return false
+}
+
+// runKind runs the kind CLI with the given args and returns its stdout.
+func runKind(
+	args ...string,
+) ([]byte, error) {
+
+	kind := "kind"
+	if path, found := os.LookupEnv(kindBinaryEnvVar); found {
+		kind = path
+	}
+	cmd := exec.Command(kind, args...)
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("kind %v failed: %v", args, err)
+	}
+	return out, nil
+}
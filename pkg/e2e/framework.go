@@ -0,0 +1,489 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package e2e
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/bluek8s/kubedirector/pkg/apis"
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Framework drives tests against an Environment.
+type Framework struct {
+	Config     *rest.Config
+	Client     client.Client
+	Env        Environment
+	namespaces []string
+}
+
+// New starts the given environment and returns a framework for it.
+func New(
+	env Environment,
+) (*Framework, error) {
+
+	config, startErr := env.Start()
+	if startErr != nil {
+		return nil, startErr
+	}
+	scheme := runtime.NewScheme()
+	if schemeErr := clientgoscheme.AddToScheme(scheme); schemeErr != nil {
+		env.Stop()
+		return nil, schemeErr
+	}
+	if schemeErr := apis.AddToScheme(scheme); schemeErr != nil {
+		env.Stop()
+		return nil, schemeErr
+	}
+	c, clientErr := client.New(config, client.Options{Scheme: scheme})
+	if clientErr != nil {
+		env.Stop()
+		return nil, clientErr
+	}
+	return &Framework{
+		Config: config,
+		Client: c,
+		Env:    env,
+	}, nil
+}
+
+// Teardown deletes any namespaces created through the framework and stops
+// the environment.
+func (f *Framework) Teardown() error {
+
+	for _, ns := range f.namespaces {
+		toDelete := &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{Name: ns},
+		}
+		deleteErr := f.Client.Delete(context.TODO(), toDelete)
+		if (deleteErr != nil) && !errors.IsNotFound(deleteErr) {
+			return deleteErr
+		}
+	}
+	f.namespaces = nil
+	return f.Env.Stop()
+}
+
+// CreateNamespace creates a scratch namespace with a generated name based on
+// the given prefix. It will be deleted by Teardown.
+func (f *Framework) CreateNamespace(
+	prefix string,
+) (string, error) {
+
+	ns := &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{GenerateName: prefix + "-"},
+	}
+	if createErr := f.Client.Create(context.TODO(), ns); createErr != nil {
+		return "", createErr
+	}
+	f.namespaces = append(f.namespaces, ns.Name)
+	return ns.Name, nil
+}
+
+// ForgetNamespace stops tracking a namespace created by CreateNamespace, so
+// that Teardown will leave it in place.
+func (f *Framework) ForgetNamespace(
+	namespace string,
+) {
+
+	var remaining []string
+	for _, ns := range f.namespaces {
+		if ns != namespace {
+			remaining = append(remaining, ns)
+		}
+	}
+	f.namespaces = remaining
+}
+
+// ApplyManifests creates the objects in the given YAML or JSON files, which
+// may each hold multiple documents. Objects that already exist are left as
+// they are. If namespace is non-empty it is used for any namespaced object
+// that does not specify one.
+func (f *Framework) ApplyManifests(
+	namespace string,
+	paths ...string,
+) ([]*unstructured.Unstructured, error) {
+
+	var result []*unstructured.Unstructured
+	for _, path := range paths {
+		objs, readErr := ReadManifests(path)
+		if readErr != nil {
+			return result, readErr
+		}
+		for _, obj := range objs {
+			if (namespace != "") && (obj.GetNamespace() == "") {
+				obj.SetNamespace(namespace)
+			}
+			createErr := f.Client.Create(context.TODO(), obj)
+			if (createErr != nil) && !errors.IsAlreadyExists(createErr) {
+				return result, fmt.Errorf(
+					"failed to create %s %s from %s: %v",
+					obj.GetKind(),
+					obj.GetName(),
+					path,
+					createErr,
+				)
+			}
+			result = append(result, obj)
+		}
+	}
+	return result, nil
+}
+
+// ReadManifests parses all the objects in the given YAML or JSON file.
+func ReadManifests(
+	path string,
+) ([]*unstructured.Unstructured, error) {
+
+	file, openErr := os.Open(path)
+	if openErr != nil {
+		return nil, openErr
+	}
+	defer file.Close()
+	var result []*unstructured.Unstructured
+	decoder := utilyaml.NewYAMLOrJSONDecoder(file, 4096)
+	for {
+		obj := make(map[string]interface{})
+		decodeErr := decoder.Decode(&obj)
+		if decodeErr == io.EOF {
+			break
+		}
+		if decodeErr != nil {
+			return nil, fmt.Errorf("failed to parse %s: %v", path, decodeErr)
+		}
+		if len(obj) == 0 {
+			continue
+		}
+		result = append(result, &unstructured.Unstructured{Object: obj})
+	}
+	return result, nil
+}
+
+// WaitForKubeDirector waits until the named KubeDirector deployment has an
+// available replica and its admission webhook is registered.
+func (f *Framework) WaitForKubeDirector(
+	namespace string,
+	deploymentName string,
+	timeout time.Duration,
+) error {
+
+	return Poll(timeout, func() (bool, error) {
+		deployment := &appsv1.Deployment{}
+		getErr := f.Client.Get(
+			context.TODO(),
+			types.NamespacedName{Namespace: namespace, Name: deploymentName},
+			deployment,
+		)
+		if getErr != nil {
+			return false, nil
+		}
+		if deployment.Status.AvailableReplicas == 0 {
+			return false, nil
+		}
+		webhook := &unstructured.Unstructured{}
+		webhook.SetAPIVersion("admissionregistration.k8s.io/v1beta1")
+		webhook.SetKind("MutatingWebhookConfiguration")
+		webhookErr := f.Client.Get(
+			context.TODO(),
+			types.NamespacedName{Name: "kubedirector-webhook"},
+			webhook,
+		)
+		return webhookErr == nil, nil
+	})
+}
+
+// CreateApp creates the KubeDirectorApp described in the given file, in
+// the given namespace.
+func (f *Framework) CreateApp(
+	namespace string,
+	path string,
+) (*kdv1.KubeDirectorApp, error) {
+
+	app := &kdv1.KubeDirectorApp{}
+	if readErr := ReadTyped(path, app); readErr != nil {
+		return nil, readErr
+	}
+	app.Namespace = namespace
+	if createErr := f.Client.Create(context.TODO(), app); createErr != nil {
+		return nil, createErr
+	}
+	return app, nil
+}
+
+// CreateCluster creates the KubeDirectorCluster described in the given file,
+// in the given namespace. If appName is non-empty it replaces the app
+// referenced by the file.
+func (f *Framework) CreateCluster(
+	namespace string,
+	path string,
+	appName string,
+) (*kdv1.KubeDirectorCluster, error) {
+
+	cr := &kdv1.KubeDirectorCluster{}
+	if readErr := ReadTyped(path, cr); readErr != nil {
+		return nil, readErr
+	}
+	cr.Namespace = namespace
+	if appName != "" {
+		cr.Spec.AppID = appName
+	}
+	if createErr := f.Client.Create(context.TODO(), cr); createErr != nil {
+		return nil, createErr
+	}
+	return cr, nil
+}
+
+// DryRunCluster submits the KubeDirectorCluster described in the given file
+// to the API server as a dry run, so that it goes through admission (and
+// picks up defaults) without being persisted. If namespace is empty the
+// namespace in the file is used, or else "default". If the cluster already
+// exists the dry run is an update, and the result carries the existing
+// status.
+func (f *Framework) DryRunCluster(
+	namespace string,
+	path string,
+) (*kdv1.KubeDirectorCluster, error) {
+
+	cr := &kdv1.KubeDirectorCluster{}
+	if readErr := ReadTyped(path, cr); readErr != nil {
+		return nil, readErr
+	}
+	if namespace != "" {
+		cr.Namespace = namespace
+	} else if cr.Namespace == "" {
+		cr.Namespace = "default"
+	}
+	current, getErr := f.GetCluster(cr.Namespace, cr.Name)
+	if getErr == nil {
+		cr.ResourceVersion = current.ResourceVersion
+		cr.Status = current.Status
+		updateErr := f.Client.Update(context.TODO(), cr, client.DryRunAll)
+		return cr, updateErr
+	}
+	if !errors.IsNotFound(getErr) {
+		return nil, getErr
+	}
+	createErr := f.Client.Create(context.TODO(), cr, client.DryRunAll)
+	return cr, createErr
+}
+
+// GetCluster fetches the current state of a KubeDirectorCluster.
+func (f *Framework) GetCluster(
+	namespace string,
+	name string,
+) (*kdv1.KubeDirectorCluster, error) {
+
+	cr := &kdv1.KubeDirectorCluster{}
+	getErr := f.Client.Get(
+		context.TODO(),
+		types.NamespacedName{Namespace: namespace, Name: name},
+		cr,
+	)
+	return cr, getErr
+}
+
+// UpdateCluster applies the given change to the current spec of a
+// KubeDirectorCluster and writes it back, retrying on conflicts.
+func (f *Framework) UpdateCluster(
+	namespace string,
+	name string,
+	timeout time.Duration,
+	mutate func(cr *kdv1.KubeDirectorCluster),
+) error {
+
+	var lastErr error
+	pollErr := Poll(timeout, func() (bool, error) {
+		cr, getErr := f.GetCluster(namespace, name)
+		if getErr != nil {
+			return false, getErr
+		}
+		mutate(cr)
+		lastErr = f.Client.Update(context.TODO(), cr)
+		if lastErr == nil {
+			return true, nil
+		}
+		// Conflicts, and rejections because a previous change has not yet
+		// been processed, are worth retrying.
+		return false, nil
+	})
+	if (pollErr != nil) && (lastErr != nil) {
+		return fmt.Errorf("%v; last error: %v", pollErr, lastErr)
+	}
+	return pollErr
+}
+
+// DeleteCluster deletes a KubeDirectorCluster and waits for it to be gone.
+func (f *Framework) DeleteCluster(
+	namespace string,
+	name string,
+	timeout time.Duration,
+) error {
+
+	cr := &kdv1.KubeDirectorCluster{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+	}
+	deleteErr := f.Client.Delete(context.TODO(), cr)
+	if (deleteErr != nil) && !errors.IsNotFound(deleteErr) {
+		return deleteErr
+	}
+	return Poll(timeout, func() (bool, error) {
+		_, getErr := f.GetCluster(namespace, name)
+		return errors.IsNotFound(getErr), nil
+	})
+}
+
+// WaitForCluster waits until the named KubeDirectorCluster satisfies all of
+// the given conditions, and returns its state at that point.
+func (f *Framework) WaitForCluster(
+	namespace string,
+	name string,
+	timeout time.Duration,
+	conditions ...ClusterCondition,
+) (*kdv1.KubeDirectorCluster, error) {
+
+	var cr *kdv1.KubeDirectorCluster
+	pollErr := Poll(timeout, func() (bool, error) {
+		current, getErr := f.GetCluster(namespace, name)
+		if getErr != nil {
+			return false, nil
+		}
+		cr = current
+		for _, condition := range conditions {
+			if !condition(cr) {
+				return false, nil
+			}
+		}
+		return true, nil
+	})
+	return cr, pollErr
+}
+
+// ClusterStateIs is satisfied when the cluster's overall state has the
+// given value.
+func ClusterStateIs(
+	state string,
+) ClusterCondition {
+
+	return func(cr *kdv1.KubeDirectorCluster) bool {
+		return (cr.Status != nil) && (cr.Status.State == state)
+	}
+}
+
+// RoleMembersInState is satisfied when exactly count members of the given
+// role exist and all are in the given state.
+func RoleMembersInState(
+	role string,
+	state string,
+	count int,
+) ClusterCondition {
+
+	return func(cr *kdv1.KubeDirectorCluster) bool {
+		if cr.Status == nil {
+			return false
+		}
+		for _, roleStatus := range cr.Status.Roles {
+			if roleStatus.Name != role {
+				continue
+			}
+			if len(roleStatus.Members) != count {
+				return false
+			}
+			for _, member := range roleStatus.Members {
+				if member.State != state {
+					return false
+				}
+			}
+			return true
+		}
+		return count == 0
+	}
+}
+
+// AllMembersInState is satisfied when every member of every role is in the
+// given state.
+func AllMembersInState(
+	state string,
+) ClusterCondition {
+
+	return func(cr *kdv1.KubeDirectorCluster) bool {
+		if cr.Status == nil {
+			return false
+		}
+		for _, roleStatus := range cr.Status.Roles {
+			for _, member := range roleStatus.Members {
+				if member.State != state {
+					return false
+				}
+			}
+		}
+		return true
+	}
+}
+
+// ReadTyped parses the first object in the given manifest file into obj.
+func ReadTyped(
+	path string,
+	obj runtime.Object,
+) error {
+
+	objs, readErr := ReadManifests(path)
+	if readErr != nil {
+		return readErr
+	}
+	if len(objs) == 0 {
+		return fmt.Errorf("no object found in %s", path)
+	}
+	return runtime.DefaultUnstructuredConverter.FromUnstructured(
+		objs[0].Object,
+		obj,
+	)
+}
+
+// Poll calls check every DefaultPollInterval until it returns true or an
+// error, or until the timeout expires.
+func Poll(
+	timeout time.Duration,
+	check func() (bool, error),
+) error {
+
+	deadline := time.Now().Add(timeout)
+	for {
+		done, checkErr := check()
+		if checkErr != nil {
+			return checkErr
+		}
+		if done {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out after %v", timeout)
+		}
+		time.Sleep(DefaultPollInterval)
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package e2e
+
+import (
+	"time"
+
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	"k8s.io/client-go/rest"
+)
+
+// Cluster and member states as reported in KubeDirectorCluster status.
+// These mirror the values used by the KubeDirector reconciler.
+const (
+	ClusterStateCreating     = "creating"
+	ClusterStateUpdating     = "updating"
+	ClusterStateConfigured   = "configured"
+	ClusterStateSpecModified = "spec modified"
+
+	MemberStateCreatePending = "create pending"
+	MemberStateCreating      = "creating"
+	MemberStateConfigured    = "configured"
+	MemberStateDeletePending = "delete pending"
+	MemberStateDeleting      = "deleting"
+	MemberStateConfigError   = "config error"
+)
+
+// Label and annotation keys used by KubeDirector on KubeDirectorCluster
+// resources, as relevant to backup and restore.
+const (
+	RestoringLabel         = "kubedirector.hpe.com/restoring"
+	StatusBackupAnnotation = "kubedirector.hpe.com/status-backup-exists"
+)
+
+const (
+	// DefaultPollInterval is how often the Wait functions re-check state.
+	DefaultPollInterval = 2 * time.Second
+
+	// kindBinaryEnvVar can be set to the path of the kind executable.
+	kindBinaryEnvVar = "KIND"
+)
+
+// Environment is a k8s cluster that tests can run against.
+type Environment interface {
+	// Start brings up the cluster if necessary and returns a config for
+	// talking to its apiserver.
+	Start() (*rest.Config, error)
+	// Stop tears down anything that Start created.
+	Stop() error
+	// RunsPods is true if the environment has nodes, i.e. if KubeDirector
+	// itself and virtual cluster members can actually run in it.
+	RunsPods() bool
+}
+
+// ClusterCondition is a predicate on the current state of a cluster, for
+// use with Framework.WaitForCluster.
+type ClusterCondition func(cr *kdv1.KubeDirectorCluster) bool
@@ -0,0 +1,65 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package executor
+
+import (
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	"github.com/bluek8s/kubedirector/pkg/catalog"
+	v1 "k8s.io/api/core/v1"
+)
+
+// generateAppContainers returns the additional app containers that the app
+// declares for the role. They are returned as sidecars, so that they share
+// directories with the app container in the same way, along with the ports
+// to declare on each of them.
+func generateAppContainers(
+	cr *kdv1.KubeDirectorCluster,
+	role *kdv1.Role,
+) ([]kdv1.Sidecar, map[string][]v1.ContainerPort, error) {
+
+	appCR, appErr := catalog.GetApp(cr)
+	if appErr != nil {
+		return nil, nil, appErr
+	}
+	appRole := catalog.GetRoleFromID(appCR, role.Name)
+	if appRole == nil {
+		return nil, nil, nil
+	}
+	var containers []kdv1.Sidecar
+	ports := make(map[string][]v1.ContainerPort)
+	for _, appContainer := range appRole.Containers {
+		containers = append(
+			containers,
+			kdv1.Sidecar{
+				Name:         appContainer.Name,
+				Image:        appContainer.ImageRepoTag,
+				Command:      appContainer.Command,
+				Args:         appContainer.Args,
+				Resources:    appContainer.Resources,
+				VolumeMounts: appContainer.VolumeMounts,
+			},
+		)
+		for _, port := range appContainer.Ports {
+			ports[appContainer.Name] = append(
+				ports[appContainer.Name],
+				v1.ContainerPort{
+					Name:          port.Name,
+					ContainerPort: port.Port,
+				},
+			)
+		}
+	}
+	return containers, ports, nil
+}
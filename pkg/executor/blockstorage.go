@@ -0,0 +1,297 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package executor
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/go-logr/logr"
+
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	"github.com/bluek8s/kubedirector/pkg/catalog"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// BlockDeviceSize returns the size of each block device of the given role.
+// The role must have block storage.
+func BlockDeviceSize(
+	role *kdv1.Role,
+) resource.Quantity {
+
+	size, _ := resource.ParseQuantity(defaultBlockDeviceSize)
+	if role.BlockStorage.Size != nil {
+		size, _ = resource.ParseQuantity(*role.BlockStorage.Size)
+	}
+	return size
+}
+
+// BlockDevicePaths returns the device paths at which the block devices of
+// the given role appear in the app container of each member.
+func BlockDevicePaths(
+	role *kdv1.Role,
+) []string {
+
+	var result []string
+	if (role.BlockStorage == nil) || (role.BlockStorage.NumDevices == nil) {
+		return result
+	}
+	for i := int32(0); i < *role.BlockStorage.NumDevices; i++ {
+		result = append(
+			result,
+			*role.BlockStorage.Path+strconv.FormatInt(int64(i), 10),
+		)
+	}
+	return result
+}
+
+// StatefulSetBlockStorage returns the number of block device claim
+// templates of the given statefulset, and the size requested by them (nil
+// if there are none).
+func StatefulSetBlockStorage(
+	statefulSet *appsv1.StatefulSet,
+) (int32, *resource.Quantity) {
+
+	var count int32
+	var size *resource.Quantity
+	for _, template := range statefulSet.Spec.VolumeClaimTemplates {
+		if !isBlockClaimTemplate(&template) {
+			continue
+		}
+		count++
+		if templateSize, ok := template.Spec.Resources.Requests[v1.ResourceStorage]; ok {
+			size = &templateSize
+		}
+	}
+	return count, size
+}
+
+// ReplaceStatefulSetBlockStorage replaces the given statefulset with one
+// whose block device claim templates match the given role, in number and
+// in size. If devices are added, the app container of the pod template gets
+// the new devices too and the given pod template hash is recorded; the
+// statefulset controller then restarts the member pods one at a time, and
+// creates the claims for the new devices as it does so. Return values are
+// as for ReplaceStatefulSetStorage.
+func ReplaceStatefulSetBlockStorage(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorCluster,
+	role *kdv1.Role,
+	statefulSet *appsv1.StatefulSet,
+	templateHash string,
+) (*appsv1.StatefulSet, error) {
+
+	currentCount, _ := StatefulSetBlockStorage(statefulSet)
+	modify := func(replacement *appsv1.StatefulSet) {
+		var templates []v1.PersistentVolumeClaim
+		for _, template := range replacement.Spec.VolumeClaimTemplates {
+			if !isBlockClaimTemplate(&template) {
+				templates = append(templates, template)
+			}
+		}
+		for _, template := range getVolumeClaimTemplate(cr, role, PvcNamePrefix) {
+			if isBlockClaimTemplate(&template) {
+				templates = append(templates, template)
+			}
+		}
+		replacement.Spec.VolumeClaimTemplates = templates
+		if *role.BlockStorage.NumDevices == currentCount {
+			return
+		}
+		podSpec := &replacement.Spec.Template.Spec
+		for i := range podSpec.Containers {
+			if podSpec.Containers[i].Name == AppContainerName {
+				podSpec.Containers[i].VolumeDevices = generateBlockDevices(role)
+			}
+		}
+		for i := range podSpec.InitContainers {
+			if podSpec.InitContainers[i].Name == BlockPrepContainerName {
+				prepContainer := &podSpec.InitContainers[i]
+				prepContainer.VolumeDevices = generateBlockDevices(role)
+				prepContainer.Args = append(
+					prepContainer.Args[:blockPrepFixedArgs],
+					BlockDevicePaths(role)...,
+				)
+			}
+		}
+		setPodTemplateHash(replacement, templateHash)
+	}
+	return replaceStatefulSet(
+		reqLogger,
+		cr,
+		statefulSet,
+		modify,
+		"block storage",
+	)
+}
+
+// generateBlockDevices returns the block devices of the app container for
+// the given role, one for each of the role's block device claims.
+func generateBlockDevices(
+	role *kdv1.Role,
+) []v1.VolumeDevice {
+
+	var volumeDevices []v1.VolumeDevice
+	for i, devicePath := range BlockDevicePaths(role) {
+		volumeDevices = append(
+			volumeDevices,
+			v1.VolumeDevice{
+				Name:       blockPvcNamePrefix + strconv.Itoa(i),
+				DevicePath: devicePath,
+			},
+		)
+	}
+	return volumeDevices
+}
+
+// isBlockClaimTemplate reports whether the given claim template is for one
+// of a role's block devices.
+func isBlockClaimTemplate(
+	template *v1.PersistentVolumeClaim,
+) bool {
+
+	if !strings.HasPrefix(template.Name, blockPvcNamePrefix) {
+		return false
+	}
+	_, convErr := strconv.Atoi(strings.TrimPrefix(template.Name, blockPvcNamePrefix))
+	return convErr == nil
+}
+
+// applyBlockDevicePrep adds, to the given pod spec for a member of the given
+// role, the init container that prepares the member's block devices if the
+// app asks for that. If the devices are encrypted, the volume holding the
+// LUKS key is added too, and mounted in the app container so that the app
+// can open the devices.
+func applyBlockDevicePrep(
+	cr *kdv1.KubeDirectorCluster,
+	role *kdv1.Role,
+	imageID string,
+	podSpec *v1.PodSpec,
+) error {
+
+	if (role.BlockStorage == nil) || (role.BlockStorage.NumDevices == nil) ||
+		(*role.BlockStorage.NumDevices == 0) {
+		return nil
+	}
+	prep, prepErr := catalog.AppBlockDevicePrep(cr, role.Name)
+	if (prepErr != nil) || (prep == nil) {
+		return prepErr
+	}
+
+	privileged := true
+	var rootUID int64
+	prepContainer := v1.Container{
+		Name:            BlockPrepContainerName,
+		Image:           imageID,
+		ImagePullPolicy: imagePullPolicy(role),
+		Command:         []string{"/bin/bash"},
+		Args: append(
+			[]string{"-c", generateBlockPrepCmd(), BlockPrepContainerName},
+			BlockDevicePaths(role)...,
+		),
+		SecurityContext: &v1.SecurityContext{
+			Privileged: &privileged,
+			RunAsUser:  &rootUID,
+		},
+		VolumeDevices: generateBlockDevices(role),
+	}
+	if prep.Image != nil {
+		prepContainer.Image = *prep.Image
+	}
+	if prep.Filesystem != nil {
+		prepContainer.Env = append(
+			prepContainer.Env,
+			v1.EnvVar{Name: "KD_BLOCK_FS", Value: *prep.Filesystem},
+		)
+	}
+	if prep.Encrypt {
+		if role.BlockStorage.EncryptionKeySecret == nil {
+			return fmt.Errorf(
+				"role {%s} encrypts its block devices but has no encryptionKeySecret",
+				role.Name,
+			)
+		}
+		prepContainer.Env = append(
+			prepContainer.Env,
+			v1.EnvVar{Name: "KD_BLOCK_ENCRYPT", Value: "true"},
+		)
+		keyMount := v1.VolumeMount{
+			Name:      blockKeyVolumeName,
+			MountPath: BlockKeyMountPath,
+			ReadOnly:  true,
+		}
+		prepContainer.VolumeMounts = append(prepContainer.VolumeMounts, keyMount)
+		for i := range podSpec.Containers {
+			if podSpec.Containers[i].Name == AppContainerName {
+				podSpec.Containers[i].VolumeMounts = append(
+					podSpec.Containers[i].VolumeMounts,
+					keyMount,
+				)
+			}
+		}
+		keyMode := int32(0400)
+		podSpec.Volumes = append(
+			podSpec.Volumes,
+			v1.Volume{
+				Name: blockKeyVolumeName,
+				VolumeSource: v1.VolumeSource{
+					Secret: &v1.SecretVolumeSource{
+						SecretName: *role.BlockStorage.EncryptionKeySecret,
+						Items: []v1.KeyToPath{
+							{Key: blockKeySecretKey, Path: blockKeySecretKey},
+						},
+						DefaultMode: &keyMode,
+					},
+				},
+			},
+		)
+	}
+	podSpec.InitContainers = append(podSpec.InitContainers, prepContainer)
+	return nil
+}
+
+// generateBlockPrepCmd generates the script run by the block device
+// preparation container, which gets the device paths as its arguments and
+// the filesystem type and encryption choice through KD_BLOCK_FS and
+// KD_BLOCK_ENCRYPT. A device is only ever formatted if blkid finds no
+// signature on it, so a restarted member keeps its data; a device that
+// holds something other than a LUKS volume when encryption is asked for
+// fails the step rather than being overwritten. What the step creates is
+// labelled, to tell it apart from data put there by other means.
+func generateBlockPrepCmd() string {
+
+	keyFile := BlockKeyMountPath + "/" + blockKeySecretKey
+	return fmt.Sprintf("set -e; "+
+		"for dev in \"$@\"; do "+
+		"target=$dev; "+
+		"if [ -n \"$KD_BLOCK_ENCRYPT\" ]; then "+
+		"if ! cryptsetup isLuks \"$dev\"; then "+
+		"if [ -n \"$(blkid -p -o value -s TYPE \"$dev\")\" ]; then "+
+		"echo \"$dev holds data that is not a LUKS volume; not formatting it\" >&2; exit 1; fi; "+
+		"cryptsetup luksFormat --batch-mode --label %[1]s --key-file %[2]s \"$dev\"; fi; "+
+		"name=kd-prep-$(cat /proc/sys/kernel/random/uuid); "+
+		"cryptsetup open --key-file %[2]s \"$dev\" \"$name\"; "+
+		"trap 'cryptsetup close \"$name\"' EXIT; "+
+		"target=/dev/mapper/$name; fi; "+
+		"if [ -n \"$KD_BLOCK_FS\" ] && [ -z \"$(blkid -p -o value -s TYPE \"$target\")\" ]; then "+
+		"mkfs.\"$KD_BLOCK_FS\" -L %[1]s \"$target\"; fi; "+
+		"if [ -n \"$KD_BLOCK_ENCRYPT\" ]; then trap - EXIT; cryptsetup close \"$name\"; fi; "+
+		"done",
+		blockPrepLabel,
+		keyFile)
+}
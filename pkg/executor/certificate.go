@@ -0,0 +1,158 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package executor
+
+import (
+	"context"
+
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	"github.com/bluek8s/kubedirector/pkg/shared"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// MemberCertificateName returns the name of the cert-manager Certificate for
+// a member. The secret that cert-manager populates has the same name.
+func MemberCertificateName(
+	podName string,
+) string {
+
+	return podName + "-tls"
+}
+
+// MemberCertificate generates the cert-manager Certificate for a member. The
+// certificate covers the DNS names by which the member can be reached
+// through the headless service of its role (if the role has its own
+// subdomain) or cluster.
+func MemberCertificate(
+	config *kdv1.MemberCertsConfig,
+	cr *kdv1.KubeDirectorCluster,
+	role *kdv1.Role,
+	podName string,
+) *unstructured.Unstructured {
+
+	name := MemberCertificateName(podName)
+	issuerKind := kdv1.CertIssuer
+	if config.IssuerKind != nil {
+		issuerKind = *config.IssuerKind
+	}
+	svcName := shared.MemberSubdomain(cr, role.Name)
+	dnsNames := []interface{}{
+		podName + "." + svcName + "." + cr.Namespace + shared.GetSvcClusterDomainBase(),
+		podName + "." + svcName + "." + cr.Namespace + ".svc",
+		podName + "." + svcName,
+	}
+	certificate := &unstructured.Unstructured{}
+	certificate.SetAPIVersion(certManagerAPIVersion)
+	certificate.SetKind("Certificate")
+	certificate.SetName(name)
+	certificate.SetNamespace(cr.Namespace)
+	certificate.SetOwnerReferences(shared.OwnerReferences(cr))
+	certificate.SetLabels(labelsForService(cr, role))
+	spec := map[string]interface{}{
+		"secretName": name,
+		"commonName": dnsNames[0],
+		"dnsNames":   dnsNames,
+		"issuerRef": map[string]interface{}{
+			"name":  config.IssuerName,
+			"kind":  issuerKind,
+			"group": certManagerGroup,
+		},
+	}
+	if config.Duration != nil {
+		spec["duration"] = *config.Duration
+	}
+	certificate.Object["spec"] = spec
+	return certificate
+}
+
+// UpdateCertificate reconciles the owner reference and the properties that
+// KubeDirector sets in the spec of an existing member Certificate to those
+// of the desired Certificate.
+func UpdateCertificate(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorCluster,
+	certificate *unstructured.Unstructured,
+	desired *unstructured.Unstructured,
+) error {
+
+	patchedRes := certificate.DeepCopy()
+	changed := !shared.OwnerReferencesPresent(cr, certificate.GetOwnerReferences())
+	patchedRes.SetOwnerReferences(shared.OwnerReferences(cr))
+	desiredSpec, _, _ := unstructured.NestedMap(desired.Object, "spec")
+	for _, field := range []string{"secretName", "commonName", "dnsNames", "issuerRef", "duration"} {
+		current, found, _ := unstructured.NestedFieldCopy(certificate.Object, "spec", field)
+		value, wanted := desiredSpec[field]
+		switch {
+		case wanted && !equality.Semantic.DeepEqual(current, value):
+			unstructured.SetNestedField(patchedRes.Object, value, "spec", field)
+			changed = true
+		case !wanted && found:
+			unstructured.RemoveNestedField(patchedRes.Object, "spec", field)
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	shared.LogInfof(
+		reqLogger,
+		cr,
+		shared.EventReasonMember,
+		"repairing certificate{%s}",
+		certificate.GetName(),
+	)
+	return shared.Patch(
+		context.TODO(),
+		certificate,
+		patchedRes,
+	)
+}
+
+// DeleteMemberCertificate deletes the Certificate of a member along with the
+// secret that holds the issued certificate. Objects that do not exist (or a
+// Certificate kind that the K8s API does not know about) are not an error.
+func DeleteMemberCertificate(
+	namespace string,
+	podName string,
+) error {
+
+	name := MemberCertificateName(podName)
+	certificate := &unstructured.Unstructured{}
+	certificate.SetAPIVersion(certManagerAPIVersion)
+	certificate.SetKind("Certificate")
+	certificate.SetName(name)
+	certificate.SetNamespace(namespace)
+	if deleteErr := shared.Delete(context.TODO(), certificate); !ignorableDeleteError(deleteErr) {
+		return deleteErr
+	}
+	secret := &corev1.Secret{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Secret",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+		},
+	}
+	if deleteErr := shared.Delete(context.TODO(), secret); !ignorableDeleteError(deleteErr) {
+		return deleteErr
+	}
+	return nil
+}
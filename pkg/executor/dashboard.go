@@ -0,0 +1,261 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package executor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	"github.com/bluek8s/kubedirector/pkg/catalog"
+	"github.com/bluek8s/kubedirector/pkg/observer"
+	"github.com/bluek8s/kubedirector/pkg/shared"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// DashboardConfigMapName returns the name of the configmap that holds the
+// generated Grafana dashboard of the given cluster.
+func DashboardConfigMapName(
+	cr *kdv1.KubeDirectorCluster,
+) string {
+
+	return cr.Name + dashboardConfigMapSuffix
+}
+
+// SyncDashboard makes the dashboard configmap of the cluster match the
+// dashboards property of the KubeDirectorConfig: created or updated (with
+// panels for the current roles) if dashboards are configured, or deleted
+// if not.
+func SyncDashboard(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorCluster,
+) error {
+
+	cmName := DashboardConfigMapName(cr)
+	existing, getErr := observer.GetConfigMap(cr.Namespace, cmName)
+	if (getErr != nil) && !errors.IsNotFound(getErr) {
+		return getErr
+	}
+	exists := (getErr == nil) && shared.OwnerReferencesPresent(cr, existing.OwnerReferences)
+
+	config := shared.GetDashboardConfig()
+	if config == nil {
+		if !exists {
+			return nil
+		}
+		shared.LogInfof(
+			reqLogger,
+			cr,
+			shared.EventReasonNoEvent,
+			"deleting dashboard configmap{%s}",
+			cmName,
+		)
+		deleteErr := shared.Delete(context.TODO(), existing)
+		if (deleteErr != nil) && !errors.IsNotFound(deleteErr) {
+			return deleteErr
+		}
+		return nil
+	}
+
+	dashboard, genErr := generateDashboard(cr, config)
+	if genErr != nil {
+		return genErr
+	}
+	cmLabels := labelsForCluster(cr)
+	label := shared.DefaultDashboardLabel
+	if config.Label != nil {
+		label = *config.Label
+	}
+	cmLabels[label] = shared.DefaultDashboardLabelValue
+	if config.LabelValue != nil {
+		cmLabels[label] = *config.LabelValue
+	}
+	var cmAnnotations map[string]string
+	if config.Folder != nil {
+		cmAnnotations = map[string]string{dashboardFolderAnnotation: *config.Folder}
+	}
+	data := map[string]string{
+		cr.Namespace + "-" + cr.Name + ".json": dashboard,
+	}
+
+	if getErr != nil {
+		cm := &corev1.ConfigMap{
+			TypeMeta: metav1.TypeMeta{
+				Kind:       "ConfigMap",
+				APIVersion: "v1",
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            cmName,
+				Namespace:       cr.Namespace,
+				OwnerReferences: shared.OwnerReferences(cr),
+				Labels:          cmLabels,
+				Annotations:     cmAnnotations,
+			},
+			Data: data,
+		}
+		shared.LogInfof(
+			reqLogger,
+			cr,
+			shared.EventReasonCluster,
+			"creating dashboard configmap{%s}",
+			cmName,
+		)
+		return shared.Create(context.TODO(), cm)
+	}
+	if exists &&
+		equality.Semantic.DeepEqual(existing.Data, data) &&
+		equality.Semantic.DeepEqual(existing.Labels, cmLabels) &&
+		equality.Semantic.DeepEqual(existing.Annotations, cmAnnotations) {
+		return nil
+	}
+	patchedRes := *existing
+	patchedRes.OwnerReferences = shared.OwnerReferences(cr)
+	patchedRes.Labels = cmLabels
+	patchedRes.Annotations = cmAnnotations
+	patchedRes.Data = data
+	return shared.Patch(
+		context.TODO(),
+		existing,
+		&patchedRes,
+	)
+}
+
+// generateDashboard returns the JSON of the Grafana dashboard for the
+// cluster. The panels are the same for every cluster of an app: the member
+// states and setup failures of the cluster, the provisioning times of the
+// app's members, and the CPU and memory use of the app containers in each
+// role. The cluster's namespace and name are constant dashboard variables.
+func generateDashboard(
+	cr *kdv1.KubeDirectorCluster,
+	config *kdv1.DashboardConfig,
+) (string, error) {
+
+	datasource := shared.DefaultDashboardDatasource
+	if config.Datasource != nil {
+		datasource = *config.Datasource
+	}
+	appName := cr.Spec.AppID
+	if appCR, appErr := catalog.GetApp(cr); appErr == nil {
+		appName = appCR.Spec.Label.Name
+	}
+	clusterSelector := `namespace="$namespace",cluster="$cluster"`
+
+	var panels []map[string]interface{}
+	addPanel := func(title string, unit string, exprs ...string) {
+		var targets []map[string]interface{}
+		for i, expr := range exprs {
+			targets = append(
+				targets,
+				map[string]interface{}{
+					"refId": string(rune('A' + i)),
+					"expr":  expr,
+				},
+			)
+		}
+		index := len(panels)
+		panels = append(
+			panels,
+			map[string]interface{}{
+				"id":         index + 1,
+				"type":       "timeseries",
+				"title":      title,
+				"datasource": datasource,
+				"gridPos": map[string]int{
+					"x": (index % 2) * 12,
+					"y": (index / 2) * 8,
+					"w": 12,
+					"h": 8,
+				},
+				"fieldConfig": map[string]interface{}{
+					"defaults": map[string]string{"unit": unit},
+				},
+				"targets": targets,
+			},
+		)
+	}
+
+	addPanel(
+		"Members by state",
+		"short",
+		fmt.Sprintf(`sum by (state) (kubedirector_cluster_members{%s})`, clusterSelector),
+	)
+	addPanel(
+		"Setup failures by role (1h)",
+		"short",
+		fmt.Sprintf(`sum by (role) (increase(kubedirector_setup_failures_total{%s}[1h]))`, clusterSelector),
+	)
+	addPanel(
+		"Member provisioning time, 90th percentile ("+appName+")",
+		"s",
+		fmt.Sprintf(
+			`histogram_quantile(0.9, sum by (le, stage) (rate(kubedirector_member_stage_duration_seconds_bucket{app=%q}[1h])))`,
+			cr.Spec.AppID,
+		),
+	)
+	for _, roleStatus := range cr.Status.Roles {
+		if roleStatus.StatefulSet == "" {
+			continue
+		}
+		podSelector := fmt.Sprintf(
+			`namespace="$namespace",pod=~%q,container=%q`,
+			roleStatus.StatefulSet+"-[0-9]+",
+			AppContainerName,
+		)
+		addPanel(
+			"CPU use of role "+roleStatus.Name,
+			"short",
+			fmt.Sprintf(`sum by (pod) (rate(container_cpu_usage_seconds_total{%s}[5m]))`, podSelector),
+		)
+		addPanel(
+			"Memory use of role "+roleStatus.Name,
+			"bytes",
+			fmt.Sprintf(`sum by (pod) (container_memory_working_set_bytes{%s})`, podSelector),
+		)
+	}
+
+	constant := func(name string, value string) map[string]interface{} {
+		return map[string]interface{}{
+			"type":  "constant",
+			"name":  name,
+			"query": value,
+			"hide":  2,
+		}
+	}
+	dashboard := map[string]interface{}{
+		"uid":           "kd-" + string(cr.UID),
+		"title":         fmt.Sprintf("%s/%s (%s)", cr.Namespace, cr.Name, appName),
+		"tags":          []string{"kubedirector", cr.Spec.AppID},
+		"schemaVersion": dashboardSchemaVersion,
+		"time":          map[string]string{"from": "now-6h", "to": "now"},
+		"refresh":       "1m",
+		"templating": map[string]interface{}{
+			"list": []map[string]interface{}{
+				constant("namespace", cr.Namespace),
+				constant("cluster", cr.Name),
+			},
+		},
+		"panels": panels,
+	}
+	encoded, encodeErr := json.MarshalIndent(dashboard, "", "  ")
+	if encodeErr != nil {
+		return "", encodeErr
+	}
+	return string(encoded), nil
+}
@@ -0,0 +1,161 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package executor
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	"github.com/bluek8s/kubedirector/pkg/shared"
+	v1 "k8s.io/api/core/v1"
+)
+
+// debugModeActive reports whether debug mode is currently in effect for
+// the virtual cluster, as recorded in its status.
+func debugModeActive(
+	cr *kdv1.KubeDirectorCluster,
+) bool {
+
+	return (cr.Status != nil) && (cr.Status.DebugExpires != nil)
+}
+
+// debugModeApplied reports whether the given pod spec has the debug mode
+// changes in it.
+func debugModeApplied(
+	podSpec *v1.PodSpec,
+) bool {
+
+	for _, container := range podSpec.Containers {
+		if container.Name == DebugContainerName {
+			return true
+		}
+	}
+	return false
+}
+
+// applyDebugMode sets the properties of the given member pod spec that are
+// affected by debug mode. The app container's capabilities and TTY/STDIN
+// settings are first reset to what the app requests, and any debug sidecar
+// is removed. Then if debug mode is active the app container additionally
+// gets the SYS_PTRACE capability and a TTY, and a debug sidecar that shares
+// the pod's process namespace is added.
+func applyDebugMode(
+	cr *kdv1.KubeDirectorCluster,
+	role *kdv1.Role,
+	podSpec *v1.PodSpec,
+) error {
+
+	securityContext, securityErr := generateSecurityContext(cr)
+	if securityErr != nil {
+		return securityErr
+	}
+	tty := hasTTY(cr, role.Name)
+	stdin := hasSTDIN(cr, role.Name)
+
+	var containers []v1.Container
+	for _, container := range podSpec.Containers {
+		if container.Name != DebugContainerName {
+			containers = append(containers, container)
+		}
+	}
+	// The pod shares its process namespace anyway if it has a setup
+	// container.
+	podSpec.ShareProcessNamespace = nil
+	if hasSetupContainer(podSpec) {
+		shareProcessNamespace := true
+		podSpec.ShareProcessNamespace = &shareProcessNamespace
+	}
+
+	if debugModeActive(cr) {
+		if securityContext == nil {
+			securityContext = &v1.SecurityContext{}
+		}
+		if securityContext.Capabilities == nil {
+			securityContext.Capabilities = &v1.Capabilities{}
+		}
+		// Don't append to the app's capabilities list in place.
+		securityContext.Capabilities.Add = append(
+			append([]v1.Capability{}, securityContext.Capabilities.Add...),
+			debugCapability,
+		)
+		tty = true
+		stdin = true
+		shareProcessNamespace := true
+		podSpec.ShareProcessNamespace = &shareProcessNamespace
+		containers = append(
+			containers,
+			v1.Container{
+				Name:    DebugContainerName,
+				Image:   shared.GetDebugImage(),
+				Command: []string{"/bin/sh"},
+				TTY:     true,
+				Stdin:   true,
+				SecurityContext: &v1.SecurityContext{
+					Capabilities: &v1.Capabilities{
+						Add: []v1.Capability{debugCapability},
+					},
+				},
+			},
+		)
+	}
+
+	numContainers := len(containers)
+	for i := 0; i < numContainers; i++ {
+		container := &(containers[i])
+		if container.Name == AppContainerName {
+			container.SecurityContext = securityContext
+			container.TTY = tty
+			container.Stdin = stdin
+		}
+	}
+	podSpec.Containers = containers
+	return nil
+}
+
+// RemoveDebugAnnotations removes the debug mode request annotations from
+// the CR. If the CR in K8s is successfully updated, the annotations of the
+// in-memory CR (passed to this function) will also be updated to match.
+func RemoveDebugAnnotations(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorCluster,
+) error {
+
+	debugAnnotations := []string{
+		shared.DebugTTLAnnotation,
+		shared.DebugExpiresAnnotation,
+		shared.DebugUserAnnotation,
+	}
+	// Work on a deep copy so that the patch response doesn't overwrite the
+	// in-memory status.
+	patchedCR := cr.DeepCopy()
+	patchedCR.Annotations = make(map[string]string)
+	for key, value := range cr.Annotations {
+		if !shared.StringInList(key, debugAnnotations) {
+			patchedCR.Annotations[key] = value
+		}
+	}
+	patchErr := shared.Patch(
+		context.TODO(),
+		cr,
+		patchedCR,
+	)
+	if patchErr == nil {
+		cr.Annotations = patchedCR.Annotations
+		cr.ResourceVersion = patchedCR.ResourceVersion
+	}
+	return patchErr
+}
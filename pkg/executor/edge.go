@@ -0,0 +1,90 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package executor
+
+import (
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	v1 "k8s.io/api/core/v1"
+)
+
+// generateTolerations returns the tolerations for the member pods of a
+// role. For an edge role, tolerations of the not-ready and unreachable node
+// taints are added so that K8s does not evict members from a node that has
+// lost contact with the control plane, unless the role already has its own
+// tolerations for those taints.
+func generateTolerations(
+	role *kdv1.Role,
+) []v1.Toleration {
+
+	if role.Edge == nil {
+		return role.Tolerations
+	}
+	result := append([]v1.Toleration{}, role.Tolerations...)
+	for _, taintKey := range []string{nodeNotReadyTaint, nodeUnreachableTaint} {
+		tolerated := false
+		for _, toleration := range role.Tolerations {
+			if toleration.Key == taintKey {
+				tolerated = true
+				break
+			}
+		}
+		if tolerated {
+			continue
+		}
+		var seconds *int64
+		if role.Edge.DisconnectToleranceSeconds != nil {
+			toleranceSeconds := *role.Edge.DisconnectToleranceSeconds
+			seconds = &toleranceSeconds
+		}
+		result = append(
+			result,
+			v1.Toleration{
+				Key:               taintKey,
+				Operator:          v1.TolerationOpExists,
+				Effect:            v1.TaintEffectNoExecute,
+				TolerationSeconds: seconds,
+			},
+		)
+	}
+	return result
+}
+
+// relaxProbe stretches the timeout and failure threshold of an app probe
+// for the members of an edge role, whose health checks may be slow to
+// answer over a poor link. The probe is modified in place; nil is allowed.
+func relaxProbe(
+	role *kdv1.Role,
+	probe *v1.Probe,
+) {
+
+	if (role.Edge == nil) || (probe == nil) {
+		return
+	}
+	factor := int32(defaultProbeRelaxFactor)
+	if role.Edge.ProbeRelaxFactor != nil {
+		factor = *role.Edge.ProbeRelaxFactor
+	}
+	// Zero means the K8s default for each of these.
+	timeoutSeconds := probe.TimeoutSeconds
+	if timeoutSeconds == 0 {
+		timeoutSeconds = 1
+	}
+	failureThreshold := probe.FailureThreshold
+	if failureThreshold == 0 {
+		failureThreshold = 3
+	}
+	probe.TimeoutSeconds = timeoutSeconds * factor
+	probe.FailureThreshold = failureThreshold * factor
+}
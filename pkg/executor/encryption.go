@@ -0,0 +1,114 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package executor
+
+import (
+	"strings"
+
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	"github.com/bluek8s/kubedirector/pkg/observer"
+	storagev1 "k8s.io/api/storage/v1"
+)
+
+// encryptionFlagParameters are storage class parameters that turn on
+// encryption at rest when set to "true", and encryptionKeyParameters those
+// that do so by naming a key. Parameter names are compared without regard
+// to case, since provisioners differ in how they treat it.
+var encryptionFlagParameters = []string{
+	"encrypted", // AWS EBS, Ceph RBD
+	"secure",    // Portworx
+}
+var encryptionKeyParameters = []string{
+	"kmskeyid",                // AWS EBS
+	"disk-encryption-kms-key", // GCE PD
+	"diskencryptionsetid",     // Azure disk
+}
+
+// StorageClassEncrypted reports whether the volumes of the given storage
+// class are encrypted at rest. The EncryptedStorageAnnotation of the class,
+// if set to "true" or "false", decides; otherwise the class parameters are
+// checked against the conventions of the common provisioners.
+func StorageClassEncrypted(
+	storageClass *storagev1.StorageClass,
+) bool {
+
+	switch storageClass.Annotations[EncryptedStorageAnnotation] {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	for name, value := range storageClass.Parameters {
+		name = strings.ToLower(name)
+		for _, flag := range encryptionFlagParameters {
+			if (name == flag) && strings.EqualFold(value, "true") {
+				return true
+			}
+		}
+		for _, key := range encryptionKeyParameters {
+			if (name == key) && (value != "") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// StorageClassNameEncrypted is StorageClassEncrypted for the named storage
+// class, or for the K8s default storage class if the name is empty.
+func StorageClassNameEncrypted(
+	storageClassName string,
+) (bool, error) {
+
+	var storageClass *storagev1.StorageClass
+	var scErr error
+	if storageClassName == "" {
+		storageClass, scErr = observer.GetDefaultStorageClass()
+	} else {
+		storageClass, scErr = observer.GetStorageClass(storageClassName)
+	}
+	if (scErr != nil) || (storageClass == nil) {
+		return false, scErr
+	}
+	return StorageClassEncrypted(storageClass), nil
+}
+
+// noteClaimEncryption records, in the given persistence summary, whether
+// the storage class of each claim template encrypts its volumes, and
+// whether they all do. Claims whose storage class cannot be found are left
+// unmarked, and so is the summary as a whole.
+func noteClaimEncryption(
+	persistence *kdv1.RolePersistence,
+) {
+
+	if len(persistence.ClaimTemplates) == 0 {
+		return
+	}
+	allKnown := true
+	allEncrypted := true
+	for i := range persistence.ClaimTemplates {
+		claim := &persistence.ClaimTemplates[i]
+		encrypted, scErr := StorageClassNameEncrypted(claim.StorageClass)
+		if scErr != nil {
+			allKnown = false
+			continue
+		}
+		claim.Encrypted = &encrypted
+		allEncrypted = allEncrypted && encrypted
+	}
+	if allKnown {
+		persistence.Encrypted = &allEncrypted
+	}
+}
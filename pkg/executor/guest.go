@@ -370,6 +370,14 @@ func ExecCommand(
 		)
 	}
 
+	// If the member has a setup container, commands aimed at the app
+	// container are run there instead. The container ID check above is
+	// still against the app container, since it is the app container's
+	// restarts that require reconfiguration.
+	if (containerName == AppContainerName) && hasSetupContainer(&pod.Spec) {
+		containerName = SetupContainerName
+	}
+
 	if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
 		return fmt.Errorf(
 			"cannot connect to pod{%v} in phase %v",
@@ -378,6 +386,10 @@ func ExecCommand(
 		)
 	}
 
+	if faultErr := shared.InjectExecDrop(podName, containerName); faultErr != nil {
+		return faultErr
+	}
+
 	request := shared.ClientSet().CoreV1().RESTClient().Post().
 		Resource("pods").
 		Name(podName).
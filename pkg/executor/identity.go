@@ -0,0 +1,246 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package executor
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	"github.com/bluek8s/kubedirector/pkg/observer"
+	"github.com/bluek8s/kubedirector/pkg/shared"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// WorkloadIdentityServiceAccountName returns the name of the service account
+// that KubeDirector generates for a role that requests workload identity.
+func WorkloadIdentityServiceAccountName(
+	cr *kdv1.KubeDirectorCluster,
+	role *kdv1.Role,
+) string {
+
+	return MungObjectName(cr.Name+"-"+role.Name) + identitySANameSuffix
+}
+
+// EnsureWorkloadIdentityServiceAccount creates the service account used by
+// a role's members for workload identity, or repairs its annotations and
+// owner reference if they have drifted from what the role spec requires.
+// Returns the service account name.
+func EnsureWorkloadIdentityServiceAccount(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorCluster,
+	role *kdv1.Role,
+) (string, error) {
+
+	name := WorkloadIdentityServiceAccountName(cr, role)
+	annotations := annotationsForIdentity(role.WorkloadIdentity)
+	existing, getErr := observer.GetServiceAccount(cr.Namespace, name)
+	if getErr != nil {
+		if !errors.IsNotFound(getErr) {
+			return name, getErr
+		}
+		shared.LogInfof(
+			reqLogger,
+			cr,
+			shared.EventReasonRole,
+			"creating workload identity service account{%s} for role{%s}",
+			name,
+			role.Name,
+		)
+		sa := &corev1.ServiceAccount{
+			TypeMeta: metav1.TypeMeta{
+				Kind:       "ServiceAccount",
+				APIVersion: "v1",
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            name,
+				Namespace:       cr.Namespace,
+				OwnerReferences: shared.OwnerReferences(cr),
+				Labels:          labelsForRole(cr, role),
+				Annotations:     annotations,
+			},
+		}
+		return name, shared.Create(context.TODO(), sa)
+	}
+
+	needsPatch := false
+	patchedRes := *existing
+	if !shared.OwnerReferencesPresent(cr, existing.OwnerReferences) {
+		patchedRes.OwnerReferences = shared.OwnerReferences(cr)
+		needsPatch = true
+	}
+	patchedAnnotations := make(map[string]string)
+	for key, value := range existing.Annotations {
+		patchedAnnotations[key] = value
+	}
+	for key, value := range annotations {
+		patchedAnnotations[key] = value
+	}
+	if !reflect.DeepEqual(patchedAnnotations, existing.Annotations) {
+		patchedRes.Annotations = patchedAnnotations
+		needsPatch = true
+	}
+	if !needsPatch {
+		return name, nil
+	}
+	shared.LogInfof(
+		reqLogger,
+		cr,
+		shared.EventReasonNoEvent,
+		"repairing workload identity service account{%s}",
+		name,
+	)
+	return name, shared.Patch(context.TODO(), existing, &patchedRes)
+}
+
+// DeleteServiceAccount deletes a service account from k8s.
+func DeleteServiceAccount(
+	namespace string,
+	saName string,
+) error {
+
+	toDelete := &corev1.ServiceAccount{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "ServiceAccount",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      saName,
+			Namespace: namespace,
+		},
+	}
+	return shared.Delete(context.TODO(), toDelete)
+}
+
+// annotationsForIdentity returns the service account annotations through
+// which the given provider's identity webhook or metadata server associates
+// pods with a cloud identity.
+func annotationsForIdentity(
+	identity *kdv1.WorkloadIdentity,
+) map[string]string {
+
+	result := make(map[string]string)
+	switch identity.Provider {
+	case kdv1.WorkloadIdentityAWS:
+		result[awsRoleArnAnnotation] = identity.Identity
+		if identity.Audience != nil {
+			result[awsAudienceAnnotation] = *identity.Audience
+		}
+	case kdv1.WorkloadIdentityGCP:
+		result[gcpServiceAccountAnnotation] = identity.Identity
+	case kdv1.WorkloadIdentityAzure:
+		result[azureClientIDAnnotation] = identity.Identity
+		if identity.TenantID != nil {
+			result[azureTenantIDAnnotation] = *identity.TenantID
+		}
+	}
+	return result
+}
+
+// generateIdentitySupport returns the volumes, mounts, and environment
+// variables that the app container needs in order to exchange a projected
+// service account token for cloud credentials. GCP needs none of these since
+// the GKE metadata server handles the exchange.
+func generateIdentitySupport(
+	role *kdv1.Role,
+) ([]corev1.VolumeMount, []corev1.Volume, []corev1.EnvVar) {
+
+	identity := role.WorkloadIdentity
+	if identity == nil {
+		return nil, nil, nil
+	}
+
+	var audience string
+	var tokenDir string
+	var envVars []corev1.EnvVar
+	switch identity.Provider {
+	case kdv1.WorkloadIdentityAWS:
+		audience = awsDefaultAudience
+		tokenDir = awsTokenDir
+		envVars = []corev1.EnvVar{
+			{
+				Name:  "AWS_ROLE_ARN",
+				Value: identity.Identity,
+			},
+			{
+				Name:  "AWS_WEB_IDENTITY_TOKEN_FILE",
+				Value: filepath.Join(tokenDir, identityTokenFile),
+			},
+		}
+	case kdv1.WorkloadIdentityAzure:
+		audience = azureDefaultAudience
+		tokenDir = azureTokenDir
+		envVars = []corev1.EnvVar{
+			{
+				Name:  "AZURE_CLIENT_ID",
+				Value: identity.Identity,
+			},
+			{
+				Name:  "AZURE_FEDERATED_TOKEN_FILE",
+				Value: filepath.Join(tokenDir, identityTokenFile),
+			},
+			{
+				Name:  "AZURE_AUTHORITY_HOST",
+				Value: azureAuthorityHost,
+			},
+		}
+		if identity.TenantID != nil {
+			envVars = append(
+				envVars,
+				corev1.EnvVar{
+					Name:  "AZURE_TENANT_ID",
+					Value: *identity.TenantID,
+				},
+			)
+		}
+	default:
+		return nil, nil, nil
+	}
+	if identity.Audience != nil {
+		audience = *identity.Audience
+	}
+
+	expiration := identityTokenExpiration
+	volumes := []corev1.Volume{
+		{
+			Name: identityTokenVolume,
+			VolumeSource: corev1.VolumeSource{
+				Projected: &corev1.ProjectedVolumeSource{
+					Sources: []corev1.VolumeProjection{
+						{
+							ServiceAccountToken: &corev1.ServiceAccountTokenProjection{
+								Audience:          audience,
+								ExpirationSeconds: &expiration,
+								Path:              identityTokenFile,
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	volumeMounts := []corev1.VolumeMount{
+		{
+			Name:      identityTokenVolume,
+			MountPath: tokenDir,
+			ReadOnly:  true,
+		},
+	}
+	return volumeMounts, volumes, envVars
+}
@@ -0,0 +1,318 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package executor
+
+import (
+	"context"
+	"strings"
+
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	"github.com/bluek8s/kubedirector/pkg/catalog"
+	"github.com/bluek8s/kubedirector/pkg/shared"
+	"github.com/go-logr/logr"
+	networkingv1beta1 "k8s.io/api/networking/v1beta1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// IngressEndpoints returns the service endpoints of the given role that the
+// app marks for ingress.
+func IngressEndpoints(
+	cr *kdv1.KubeDirectorCluster,
+	roleName string,
+) ([]catalog.ServicePortInfo, error) {
+
+	portInfoList, portsErr := catalog.PortsForRole(cr, roleName)
+	if portsErr != nil {
+		return nil, portsErr
+	}
+	var result []catalog.ServicePortInfo
+	for _, portInfo := range portInfoList {
+		if portInfo.Ingress {
+			result = append(result, portInfo)
+		}
+	}
+	return result, nil
+}
+
+// IngressHost forms the host name for a member's service endpoint from the
+// configured host template.
+func IngressHost(
+	config *kdv1.IngressConfig,
+	cr *kdv1.KubeDirectorCluster,
+	role *kdv1.Role,
+	podName string,
+	serviceID string,
+) string {
+
+	replacer := strings.NewReplacer(
+		"{member}", podName,
+		"{service}", serviceID,
+		"{role}", role.Name,
+		"{cluster}", cr.Name,
+		"{namespace}", cr.Namespace,
+	)
+	return strings.ToLower(replacer.Replace(config.HostTemplate))
+}
+
+// MemberRouteName returns the name of the Route for one service endpoint of
+// a member, given the name of the member's service.
+func MemberRouteName(
+	serviceName string,
+	serviceID string,
+) string {
+
+	return serviceName + "-" + serviceID
+}
+
+// MemberIngress generates the Ingress for a member's service, with a rule
+// for each of the given endpoints. The Ingress has the same name as the
+// service.
+func MemberIngress(
+	config *kdv1.IngressConfig,
+	cr *kdv1.KubeDirectorCluster,
+	role *kdv1.Role,
+	podName string,
+	serviceName string,
+	endpoints []catalog.ServicePortInfo,
+) *networkingv1beta1.Ingress {
+
+	ingress := &networkingv1beta1.Ingress{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Ingress",
+			APIVersion: "networking.k8s.io/v1beta1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            serviceName,
+			Namespace:       cr.Namespace,
+			OwnerReferences: shared.OwnerReferences(cr),
+			Labels:          labelsForService(cr, role),
+			Annotations:     annotationsForIngress(config, cr, role),
+		},
+	}
+	var hosts []string
+	for _, endpoint := range endpoints {
+		host := IngressHost(config, cr, role, podName, endpoint.ID)
+		hosts = append(hosts, host)
+		ingress.Spec.Rules = append(
+			ingress.Spec.Rules,
+			networkingv1beta1.IngressRule{
+				Host: host,
+				IngressRuleValue: networkingv1beta1.IngressRuleValue{
+					HTTP: &networkingv1beta1.HTTPIngressRuleValue{
+						Paths: []networkingv1beta1.HTTPIngressPath{
+							{
+								Path: "/",
+								Backend: networkingv1beta1.IngressBackend{
+									ServiceName: serviceName,
+									ServicePort: intstr.FromString(createPortNameForService(endpoint)),
+								},
+							},
+						},
+					},
+				},
+			},
+		)
+	}
+	if config.TLSSecret != nil {
+		ingress.Spec.TLS = []networkingv1beta1.IngressTLS{
+			{
+				Hosts:      hosts,
+				SecretName: *config.TLSSecret,
+			},
+		}
+	}
+	return ingress
+}
+
+// MemberRoute generates the OpenShift Route for one service endpoint of a
+// member. An HTTPS endpoint gets passthrough TLS termination; otherwise
+// edge termination is used if the config asks for TLS.
+func MemberRoute(
+	config *kdv1.IngressConfig,
+	cr *kdv1.KubeDirectorCluster,
+	role *kdv1.Role,
+	podName string,
+	serviceName string,
+	endpoint catalog.ServicePortInfo,
+) *unstructured.Unstructured {
+
+	route := &unstructured.Unstructured{}
+	route.SetAPIVersion("route.openshift.io/v1")
+	route.SetKind("Route")
+	route.SetName(MemberRouteName(serviceName, endpoint.ID))
+	route.SetNamespace(cr.Namespace)
+	route.SetOwnerReferences(shared.OwnerReferences(cr))
+	route.SetLabels(labelsForService(cr, role))
+	route.SetAnnotations(annotationsForIngress(config, cr, role))
+	spec := map[string]interface{}{
+		"host": IngressHost(config, cr, role, podName, endpoint.ID),
+		"to": map[string]interface{}{
+			"kind": "Service",
+			"name": serviceName,
+		},
+		"port": map[string]interface{}{
+			"targetPort": createPortNameForService(endpoint),
+		},
+	}
+	if strings.ToLower(endpoint.URLScheme) == "https" {
+		spec["tls"] = map[string]interface{}{"termination": "passthrough"}
+	} else if config.TLSSecret != nil {
+		spec["tls"] = map[string]interface{}{"termination": "edge"}
+	}
+	route.Object["spec"] = spec
+	return route
+}
+
+// UpdateIngress reconciles the owner reference, rules, and TLS settings of
+// an existing member Ingress to those of the desired Ingress.
+func UpdateIngress(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorCluster,
+	ingress *networkingv1beta1.Ingress,
+	desired *networkingv1beta1.Ingress,
+) error {
+
+	if shared.OwnerReferencesPresent(cr, ingress.OwnerReferences) &&
+		equality.Semantic.DeepEqual(ingress.Spec, desired.Spec) {
+		return nil
+	}
+	shared.LogInfof(
+		reqLogger,
+		cr,
+		shared.EventReasonMember,
+		"repairing ingress{%s}",
+		ingress.Name,
+	)
+	patchedRes := *ingress
+	patchedRes.OwnerReferences = shared.OwnerReferences(cr)
+	patchedRes.Spec = desired.Spec
+	return shared.Patch(
+		context.TODO(),
+		ingress,
+		&patchedRes,
+	)
+}
+
+// UpdateRoute reconciles the owner reference and the properties that
+// KubeDirector sets in the spec of an existing member Route to those of the
+// desired Route. Properties defaulted by OpenShift are left alone.
+func UpdateRoute(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorCluster,
+	route *unstructured.Unstructured,
+	desired *unstructured.Unstructured,
+) error {
+
+	patchedRes := route.DeepCopy()
+	changed := !shared.OwnerReferencesPresent(cr, route.GetOwnerReferences())
+	patchedRes.SetOwnerReferences(shared.OwnerReferences(cr))
+	desiredSpec, _, _ := unstructured.NestedMap(desired.Object, "spec")
+	for _, field := range []string{"host", "to", "port", "tls"} {
+		current, found, _ := unstructured.NestedFieldCopy(route.Object, "spec", field)
+		value, wanted := desiredSpec[field]
+		switch {
+		case wanted && !equality.Semantic.DeepEqual(current, value):
+			unstructured.SetNestedField(patchedRes.Object, value, "spec", field)
+			changed = true
+		case !wanted && found:
+			unstructured.RemoveNestedField(patchedRes.Object, "spec", field)
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	shared.LogInfof(
+		reqLogger,
+		cr,
+		shared.EventReasonMember,
+		"repairing route{%s}",
+		route.GetName(),
+	)
+	return shared.Patch(
+		context.TODO(),
+		route,
+		patchedRes,
+	)
+}
+
+// DeleteMemberIngress deletes the Ingress and any Routes of a member, given
+// the name of the member's service and the IDs of its ingress endpoints.
+// Objects that do not exist (or kinds that the K8s API does not know about)
+// are not an error.
+func DeleteMemberIngress(
+	namespace string,
+	serviceName string,
+	serviceIDs []string,
+) error {
+
+	ingress := &networkingv1beta1.Ingress{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Ingress",
+			APIVersion: "networking.k8s.io/v1beta1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      serviceName,
+			Namespace: namespace,
+		},
+	}
+	if deleteErr := shared.Delete(context.TODO(), ingress); !ignorableDeleteError(deleteErr) {
+		return deleteErr
+	}
+	for _, serviceID := range serviceIDs {
+		route := &unstructured.Unstructured{}
+		route.SetAPIVersion("route.openshift.io/v1")
+		route.SetKind("Route")
+		route.SetName(MemberRouteName(serviceName, serviceID))
+		route.SetNamespace(namespace)
+		if deleteErr := shared.Delete(context.TODO(), route); !ignorableDeleteError(deleteErr) {
+			return deleteErr
+		}
+	}
+	return nil
+}
+
+// ignorableDeleteError returns true if a deletion succeeded or failed only
+// because there was nothing to delete.
+func ignorableDeleteError(
+	err error,
+) bool {
+
+	return (err == nil) || errors.IsNotFound(err) || meta.IsNoMatchError(err)
+}
+
+// annotationsForIngress generates the annotations for a member Ingress or
+// Route: those of the role, the configured ingress annotations, and the
+// ingress class if one is configured.
+func annotationsForIngress(
+	config *kdv1.IngressConfig,
+	cr *kdv1.KubeDirectorCluster,
+	role *kdv1.Role,
+) map[string]string {
+
+	result := annotationsForRole(cr, role)
+	for name, value := range config.Annotations {
+		result[name] = value
+	}
+	if config.Class != nil {
+		result[ingressClassAnnotation] = *config.Class
+	}
+	return result
+}
@@ -0,0 +1,182 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package executor
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	"github.com/bluek8s/kubedirector/pkg/shared"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// UpdatePodPropagatedLabels makes the labels that a member pod has from the
+// cluster CR match the cluster's propagateLabels. These labels are patched
+// onto the pod rather than set in the pod template, so changing them never
+// changes the statefulset or restarts the member. Nothing is done if the
+// role no longer has a spec.
+func UpdatePodPropagatedLabels(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorCluster,
+	role *kdv1.Role,
+	pod *corev1.Pod,
+) error {
+
+	if role == nil {
+		return nil
+	}
+	desired := propagatedLabelsFor(cr, labelsForPod(cr, role))
+	patchedRes := pod.DeepCopy()
+	if !applyPropagatedLabels(&patchedRes.ObjectMeta, desired) {
+		return nil
+	}
+	shared.LogInfof(
+		reqLogger,
+		cr,
+		shared.EventReasonNoEvent,
+		"updating propagated labels on pod{%s}",
+		pod.Name,
+	)
+	patchErr := shared.Patch(
+		context.TODO(),
+		pod,
+		patchedRes,
+	)
+	if patchErr != nil {
+		return patchErr
+	}
+	*pod = *patchedRes
+	return nil
+}
+
+// UpdateServicePropagatedLabels makes the labels that a service has from the
+// cluster CR match the cluster's propagateLabels. role is nil for the
+// cluster's headless service.
+func UpdateServicePropagatedLabels(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorCluster,
+	role *kdv1.Role,
+	service *corev1.Service,
+) error {
+
+	desired := propagatedLabelsFor(cr, labelsForService(cr, role))
+	patchedRes := service.DeepCopy()
+	if !applyPropagatedLabels(&patchedRes.ObjectMeta, desired) {
+		return nil
+	}
+	shared.LogInfof(
+		reqLogger,
+		cr,
+		shared.EventReasonNoEvent,
+		"updating propagated labels on service{%s}",
+		service.Name,
+	)
+	patchErr := shared.Patch(
+		context.TODO(),
+		service,
+		patchedRes,
+	)
+	if patchErr != nil {
+		return patchErr
+	}
+	*service = *patchedRes
+	return nil
+}
+
+// propagatedLabelsFor returns the cluster CR labels to propagate to an
+// object, including the creator label, leaving out any keys that KubeDirector already sets on that object
+// from other sources.
+func propagatedLabelsFor(
+	cr *kdv1.KubeDirectorCluster,
+	generated map[string]string,
+) map[string]string {
+
+	result := shared.PropagatedLabels(cr)
+	if creator, ok := cr.Labels[shared.CreatorLabel]; ok {
+		result[shared.CreatorLabel] = creator
+	}
+	for key := range generated {
+		delete(result, key)
+	}
+	return result
+}
+
+// applyPropagatedLabels sets the desired propagated labels in the given
+// object metadata, removes the ones that were propagated before but no
+// longer are, and updates the record of propagated keys. Other labels are
+// left alone. Returns false if nothing needed to change.
+func applyPropagatedLabels(
+	objMeta *metav1.ObjectMeta,
+	desired map[string]string,
+) bool {
+
+	if objMeta.Labels == nil {
+		objMeta.Labels = make(map[string]string)
+	}
+	return applyManagedKeys(objMeta, objMeta.Labels, PropagatedLabelKeysAnnotation, desired)
+}
+
+// applyManagedKeys sets the desired entries in the given labels or
+// annotations map of an object, removes the entries that were set before
+// (according to the record kept in the given annotation) but are no longer
+// desired, and updates that record. Other entries are left alone. Returns
+// false if nothing needed to change.
+func applyManagedKeys(
+	objMeta *metav1.ObjectMeta,
+	target map[string]string,
+	recordAnnotation string,
+	desired map[string]string,
+) bool {
+
+	changed := false
+	if previous := objMeta.Annotations[recordAnnotation]; previous != "" {
+		for _, key := range strings.Split(previous, ",") {
+			if _, wanted := desired[key]; wanted {
+				continue
+			}
+			if _, ok := target[key]; ok {
+				delete(target, key)
+				changed = true
+			}
+		}
+	}
+	var keys []string
+	for key, value := range desired {
+		keys = append(keys, key)
+		if current, ok := target[key]; !ok || (current != value) {
+			target[key] = value
+			changed = true
+		}
+	}
+	sort.Strings(keys)
+	keyList := strings.Join(keys, ",")
+	current, recorded := objMeta.Annotations[recordAnnotation]
+	switch {
+	case (keyList == "") && recorded:
+		delete(objMeta.Annotations, recordAnnotation)
+		changed = true
+	case (keyList != "") && (current != keyList):
+		if objMeta.Annotations == nil {
+			objMeta.Annotations = make(map[string]string)
+		}
+		objMeta.Annotations[recordAnnotation] = keyList
+		changed = true
+	}
+	return changed
+}
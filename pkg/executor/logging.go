@@ -0,0 +1,134 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package executor
+
+import (
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	"github.com/bluek8s/kubedirector/pkg/catalog"
+	"github.com/bluek8s/kubedirector/pkg/shared"
+)
+
+// loggingAnnotations generates the pod annotations that tell log agents
+// how to parse the app container's output, for a role that asks for log
+// collection.
+func loggingAnnotations(
+	cr *kdv1.KubeDirectorCluster,
+	role *kdv1.Role,
+) (map[string]string, error) {
+
+	if role.Logging == nil {
+		return nil, nil
+	}
+	appLogging, appErr := catalog.AppLogging(cr, role.Name)
+	if (appErr != nil) || (appLogging == nil) {
+		return nil, appErr
+	}
+	result := make(map[string]string)
+	if appLogging.Parser != nil {
+		result[fluentBitParserAnnotation] = *appLogging.Parser
+	}
+	if appLogging.MultilineParser != nil {
+		result[MultilineParserAnnotation] = *appLogging.MultilineParser
+	}
+	return result, nil
+}
+
+// generateLogShipper returns the logging sidecar for a role in sidecar
+// logging mode, or nil if the role is not in that mode or no log sink is
+// configured. The sidecar tails the setup package logs and the app's log
+// files, through directories shared with the app container, and sends
+// them to the log sink.
+func generateLogShipper(
+	cr *kdv1.KubeDirectorCluster,
+	role *kdv1.Role,
+) (*kdv1.Sidecar, error) {
+
+	if (role.Logging == nil) || (role.Logging.Mode != kdv1.LoggingSidecar) {
+		return nil, nil
+	}
+	sink := shared.GetLogSinkConfig()
+	if sink == nil {
+		return nil, nil
+	}
+	appLogging, appErr := catalog.AppLogging(cr, role.Name)
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	var mounts []kdv1.SidecarVolumeMount
+	var args []string
+	mountDir := func(appDir string) string {
+		for _, mount := range mounts {
+			if mount.AppPath == appDir {
+				return mount.MountPath
+			}
+		}
+		mountPath := filepath.Join(logShipperMountBase, strconv.Itoa(len(mounts)))
+		mounts = append(
+			mounts,
+			kdv1.SidecarVolumeMount{
+				AppPath:   appDir,
+				MountPath: mountPath,
+				ReadOnly:  true,
+			},
+		)
+		return mountPath
+	}
+	args = append(
+		args,
+		"-i", "tail",
+		"-p", "path="+filepath.Join(mountDir(guestconfigLogDir), "*"),
+		"-p", "tag=guestconfig",
+	)
+	if appLogging != nil {
+		for _, logPath := range appLogging.Paths {
+			logPath = filepath.Clean(logPath)
+			shipperPath := filepath.Join(mountDir(filepath.Dir(logPath)), filepath.Base(logPath))
+			args = append(args, "-i", "tail", "-p", "path="+shipperPath, "-p", "tag=app")
+			if appLogging.Parser != nil {
+				args = append(args, "-p", "parser="+*appLogging.Parser)
+			}
+			if appLogging.MultilineParser != nil {
+				args = append(args, "-p", "multiline.parser="+*appLogging.MultilineParser)
+			}
+		}
+	}
+	args = append(args, "-o", sink.Output, "-p", "match=*")
+	var propNames []string
+	for name := range sink.Properties {
+		propNames = append(propNames, name)
+	}
+	sort.Strings(propNames)
+	for _, name := range propNames {
+		args = append(args, "-p", name+"="+sink.Properties[name])
+	}
+
+	image := shared.DefaultLogShipperImage
+	if sink.Image != nil {
+		image = *sink.Image
+	}
+	return &kdv1.Sidecar{
+		Name:         LogShipperContainerName,
+		Image:        image,
+		Command:      []string{logShipperBinary},
+		Args:         args,
+		Resources:    role.Logging.Resources,
+		VolumeMounts: mounts,
+	}, nil
+}
@@ -0,0 +1,120 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package executor
+
+import (
+	"bytes"
+	"context"
+
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	"github.com/bluek8s/kubedirector/pkg/observer"
+	"github.com/bluek8s/kubedirector/pkg/shared"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// UpdateMemberStatusDetail writes the given member status lists, keyed by
+// configmap name, into the member status detail configmaps of the cluster,
+// creating any that do not exist yet.
+func UpdateMemberStatusDetail(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorCluster,
+	details map[string][]kdv1.MemberStatus,
+) error {
+
+	for cmName, members := range details {
+		data, encodeErr := shared.EncodeMemberStatusDetail(members)
+		if encodeErr != nil {
+			return encodeErr
+		}
+		cm, getErr := observer.GetConfigMap(cr.Namespace, cmName)
+		if getErr != nil {
+			if !errors.IsNotFound(getErr) {
+				return getErr
+			}
+			cmLabels := labelsForCluster(cr)
+			cmLabels[shared.MemberStatusDetailLabel] = "true"
+			cm = &corev1.ConfigMap{
+				TypeMeta: metav1.TypeMeta{
+					Kind:       "ConfigMap",
+					APIVersion: "v1",
+				},
+				ObjectMeta: metav1.ObjectMeta{
+					Name:            cmName,
+					Namespace:       cr.Namespace,
+					OwnerReferences: shared.OwnerReferences(cr),
+					Labels:          cmLabels,
+				},
+				BinaryData: map[string][]byte{
+					shared.MemberStatusDetailKey: data,
+				},
+			}
+			shared.LogInfof(
+				reqLogger,
+				cr,
+				shared.EventReasonNoEvent,
+				"creating member status detail configmap{%s}",
+				cmName,
+			)
+			if createErr := shared.Create(context.TODO(), cm); createErr != nil {
+				return createErr
+			}
+			continue
+		}
+		if bytes.Equal(cm.BinaryData[shared.MemberStatusDetailKey], data) &&
+			shared.OwnerReferencesPresent(cr, cm.OwnerReferences) {
+			continue
+		}
+		cm.OwnerReferences = shared.OwnerReferences(cr)
+		cm.BinaryData = map[string][]byte{
+			shared.MemberStatusDetailKey: data,
+		}
+		if updateErr := shared.Update(context.TODO(), cm); updateErr != nil {
+			return updateErr
+		}
+	}
+	return nil
+}
+
+// DeleteStaleMemberStatusDetail deletes any member status detail configmaps
+// of the cluster that are not named in the given details, i.e. those of
+// roles that no longer need one or that no longer exist. This is
+// best-effort; anything left behind will be removed along with the cluster.
+func DeleteStaleMemberStatusDetail(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorCluster,
+	details map[string][]kdv1.MemberStatus,
+) {
+
+	cms, listErr := observer.ListClusterMemberStatusDetails(cr.Namespace, cr.Name)
+	if listErr != nil {
+		return
+	}
+	for i := range cms {
+		if _, ok := details[cms[i].Name]; ok {
+			continue
+		}
+		shared.LogInfof(
+			reqLogger,
+			cr,
+			shared.EventReasonNoEvent,
+			"deleting member status detail configmap{%s}",
+			cms[i].Name,
+		)
+		shared.Delete(context.TODO(), &cms[i])
+	}
+}
@@ -0,0 +1,186 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package executor
+
+import (
+	"context"
+
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	"github.com/bluek8s/kubedirector/pkg/catalog"
+	"github.com/bluek8s/kubedirector/pkg/shared"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// CreateNetworkPolicy creates in k8s a network policy for the members of
+// the given role, with the given name. See networkPolicySpec for the
+// traffic that it allows.
+func CreateNetworkPolicy(
+	cr *kdv1.KubeDirectorCluster,
+	role *kdv1.Role,
+	name string,
+) (*networkingv1.NetworkPolicy, error) {
+
+	spec, specErr := networkPolicySpec(cr, role)
+	if specErr != nil {
+		return nil, specErr
+	}
+	policy := &networkingv1.NetworkPolicy{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "NetworkPolicy",
+			APIVersion: "networking.k8s.io/v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            name,
+			Namespace:       cr.Namespace,
+			OwnerReferences: shared.OwnerReferences(cr),
+			Labels:          labelsForRole(cr, role),
+			Annotations:     annotationsForRole(cr, role),
+		},
+		Spec: spec,
+	}
+	createErr := shared.Create(context.TODO(), policy)
+	return policy, createErr
+}
+
+// UpdateNetworkPolicy examines a current role network policy in k8s and
+// reconciles its owner reference and its spec to the expected values,
+// undoing any changes made to it outside of KubeDirector.
+func UpdateNetworkPolicy(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorCluster,
+	role *kdv1.Role,
+	policy *networkingv1.NetworkPolicy,
+) error {
+
+	spec, specErr := networkPolicySpec(cr, role)
+	if specErr != nil {
+		return specErr
+	}
+	ownerRefsOk := shared.OwnerReferencesPresent(cr, policy.OwnerReferences)
+	specOk := equality.Semantic.DeepEqual(policy.Spec, spec)
+	if ownerRefsOk && specOk {
+		return nil
+	}
+	if !ownerRefsOk {
+		shared.LogInfof(
+			reqLogger,
+			cr,
+			shared.EventReasonNoEvent,
+			"repairing owner ref on networkpolicy{%s}",
+			policy.Name,
+		)
+	}
+	if !specOk {
+		shared.LogInfof(
+			reqLogger,
+			cr,
+			shared.EventReasonRole,
+			"repairing rules of networkpolicy{%s} for role{%s}",
+			policy.Name,
+			role.Name,
+		)
+	}
+	// As with the other owned objects, any existing owner refs are replaced.
+	patchedRes := *policy
+	patchedRes.OwnerReferences = shared.OwnerReferences(cr)
+	patchedRes.Spec = spec
+	return shared.Patch(
+		context.TODO(),
+		policy,
+		&patchedRes,
+	)
+}
+
+// DeleteNetworkPolicy deletes a role network policy from k8s.
+func DeleteNetworkPolicy(
+	namespace string,
+	policyName string,
+) error {
+
+	toDelete := &networkingv1.NetworkPolicy{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "NetworkPolicy",
+			APIVersion: "networking.k8s.io/v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      policyName,
+			Namespace: namespace,
+		},
+	}
+
+	return shared.Delete(context.TODO(), toDelete)
+}
+
+// networkPolicySpec generates the spec of the network policy for the members
+// of a role. Ingress to those members is denied except for traffic from
+// other members of the same virtual cluster (on any port) and traffic from
+// anywhere to the service endpoint ports that the app declares for the
+// role.
+func networkPolicySpec(
+	cr *kdv1.KubeDirectorCluster,
+	role *kdv1.Role,
+) (networkingv1.NetworkPolicySpec, error) {
+
+	spec := networkingv1.NetworkPolicySpec{
+		PodSelector: metav1.LabelSelector{
+			MatchLabels: labelsForRole(cr, role),
+		},
+		PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+		Ingress: []networkingv1.NetworkPolicyIngressRule{
+			{
+				From: []networkingv1.NetworkPolicyPeer{
+					{
+						PodSelector: &metav1.LabelSelector{
+							MatchLabels: map[string]string{
+								shared.ClusterLabel: cr.Name,
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	portInfoList, portsErr := catalog.PortsForRole(cr, role.Name)
+	if portsErr != nil {
+		return spec, portsErr
+	}
+	if len(portInfoList) != 0 {
+		// Spell out the protocol that K8s would default, so that the
+		// expected spec compares equal to the stored one.
+		protocol := corev1.ProtocolTCP
+		var ports []networkingv1.NetworkPolicyPort
+		for _, portInfo := range portInfoList {
+			port := intstr.FromInt(int(portInfo.Port))
+			ports = append(
+				ports,
+				networkingv1.NetworkPolicyPort{
+					Protocol: &protocol,
+					Port:     &port,
+				},
+			)
+		}
+		spec.Ingress = append(
+			spec.Ingress,
+			networkingv1.NetworkPolicyIngressRule{Ports: ports},
+		)
+	}
+	return spec, nil
+}
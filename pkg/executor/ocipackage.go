@@ -0,0 +1,449 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package executor
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bluek8s/kubedirector/pkg/shared"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// OCIPackageScheme marks a setup package URL that refers to an OCI
+	// artifact, as oci://registry/repository@sha256:digest.
+	OCIPackageScheme = "oci://"
+
+	// maxOCIPackageBytes bounds the size of a setup package pulled from a
+	// registry or downloaded by KubeDirector, since it is held in memory.
+	maxOCIPackageBytes = 256 * 1024 * 1024
+
+	// ociRequestTimeout bounds each request to a registry.
+	ociRequestTimeout = 2 * time.Minute
+)
+
+// ociManifestTypes are the manifest media types accepted from a registry.
+var ociManifestTypes = []string{
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+// ociPackages caches setup packages pulled from registries, by reference.
+// The references are pinned to a digest, so the content never changes.
+var ociPackages = struct {
+	sync.Mutex
+	content map[string][]byte
+}{
+	content: make(map[string][]byte),
+}
+
+// ociClient is used for all registry requests.
+var ociClient = &http.Client{Timeout: ociRequestTimeout}
+
+// ociManifest is the part of an OCI image manifest that KubeDirector uses.
+type ociManifest struct {
+	Layers []ociDescriptor `json:"layers"`
+}
+
+// ociDescriptor describes one blob in a manifest.
+type ociDescriptor struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+	Size      int64  `json:"size"`
+}
+
+// ociCredentials is a registry username and password, from a
+// dockerconfigjson secret.
+type ociCredentials struct {
+	username string
+	password string
+}
+
+// IsOCIPackage checks whether a setup package URL refers to an OCI
+// artifact rather than a tarball to be downloaded by the member.
+func IsOCIPackage(
+	packageURL string,
+) bool {
+
+	return strings.HasPrefix(packageURL, OCIPackageScheme)
+}
+
+// FetchOCIPackage returns the content of a setup package stored in an OCI
+// registry: the single gzipped tarball layer of the referenced artifact.
+// If pullSecretName is not empty, it names a dockerconfigjson secret in the
+// KubeDirector namespace holding credentials for the registry. Both the
+// manifest and the layer are checked against their digests.
+func FetchOCIPackage(
+	packageURL string,
+	pullSecretName string,
+) ([]byte, error) {
+
+	ociPackages.Lock()
+	content, ok := ociPackages.content[packageURL]
+	ociPackages.Unlock()
+	if ok {
+		return content, nil
+	}
+
+	registry, repository, digest, parseErr := parseOCIReference(packageURL)
+	if parseErr != nil {
+		return nil, parseErr
+	}
+	var creds *ociCredentials
+	if pullSecretName != "" {
+		var credsErr error
+		creds, credsErr = registryCredentials(pullSecretName, registry)
+		if credsErr != nil {
+			return nil, credsErr
+		}
+	}
+	baseURL := "https://" + registry + "/v2/" + repository
+	manifestBytes, manifestErr := ociGet(
+		baseURL+"/manifests/"+digest,
+		strings.Join(ociManifestTypes, ", "),
+		creds,
+	)
+	if manifestErr != nil {
+		return nil, fmt.Errorf("failed to fetch manifest of %s: %v", packageURL, manifestErr)
+	}
+	if verifyErr := verifyDigest(manifestBytes, digest); verifyErr != nil {
+		return nil, fmt.Errorf("manifest of %s: %v", packageURL, verifyErr)
+	}
+	manifest := ociManifest{}
+	if jsonErr := json.Unmarshal(manifestBytes, &manifest); jsonErr != nil {
+		return nil, fmt.Errorf("invalid manifest for %s: %v", packageURL, jsonErr)
+	}
+	layer, layerErr := packageLayer(&manifest)
+	if layerErr != nil {
+		return nil, fmt.Errorf("%s: %v", packageURL, layerErr)
+	}
+	content, blobErr := ociGet(baseURL+"/blobs/"+layer.Digest, "", creds)
+	if blobErr != nil {
+		return nil, fmt.Errorf("failed to fetch package layer of %s: %v", packageURL, blobErr)
+	}
+	if verifyErr := verifyDigest(content, layer.Digest); verifyErr != nil {
+		return nil, fmt.Errorf("package layer of %s: %v", packageURL, verifyErr)
+	}
+
+	ociPackages.Lock()
+	ociPackages.content[packageURL] = content
+	ociPackages.Unlock()
+	return content, nil
+}
+
+// parseOCIReference splits an oci:// setup package URL into the registry
+// host, the repository, and the digest.
+func parseOCIReference(
+	packageURL string,
+) (string, string, string, error) {
+
+	reference := strings.TrimPrefix(packageURL, OCIPackageScheme)
+	atIndex := strings.LastIndex(reference, "@")
+	slashIndex := strings.Index(reference, "/")
+	if (atIndex == -1) || (slashIndex == -1) || (slashIndex > atIndex) {
+		return "", "", "", fmt.Errorf(
+			"setup package %s is not of the form %sregistry/repository@digest",
+			packageURL,
+			OCIPackageScheme,
+		)
+	}
+	registry := reference[:slashIndex]
+	repository := reference[slashIndex+1 : atIndex]
+	digest := reference[atIndex+1:]
+	if (repository == "") || !strings.HasPrefix(digest, "sha256:") {
+		return "", "", "", fmt.Errorf(
+			"setup package %s must name a repository and a sha256 digest",
+			packageURL,
+		)
+	}
+	return registry, repository, digest, nil
+}
+
+// registryCredentials looks up the credentials for a registry in a
+// dockerconfigjson secret in the KubeDirector namespace.
+func registryCredentials(
+	secretName string,
+	registry string,
+) (*ociCredentials, error) {
+
+	kdNamespace, nsErr := shared.GetKubeDirectorNamespace()
+	if nsErr != nil {
+		return nil, nsErr
+	}
+	secret := &v1.Secret{}
+	getErr := shared.Get(
+		context.TODO(),
+		types.NamespacedName{Namespace: kdNamespace, Name: secretName},
+		secret,
+	)
+	if getErr != nil {
+		return nil, fmt.Errorf("failed to read pull secret %s: %v", secretName, getErr)
+	}
+	var dockerConfig struct {
+		Auths map[string]struct {
+			Username string `json:"username"`
+			Password string `json:"password"`
+			Auth     string `json:"auth"`
+		} `json:"auths"`
+	}
+	jsonErr := json.Unmarshal(secret.Data[v1.DockerConfigJsonKey], &dockerConfig)
+	if jsonErr != nil {
+		return nil, fmt.Errorf("pull secret %s is not a dockerconfigjson secret: %v", secretName, jsonErr)
+	}
+	for server, entry := range dockerConfig.Auths {
+		host := server
+		if parsed, parseErr := url.Parse(server); (parseErr == nil) && (parsed.Host != "") {
+			host = parsed.Host
+		}
+		if host != registry {
+			continue
+		}
+		creds := &ociCredentials{username: entry.Username, password: entry.Password}
+		if entry.Auth != "" {
+			decoded, decodeErr := base64.StdEncoding.DecodeString(entry.Auth)
+			if decodeErr == nil {
+				parts := strings.SplitN(string(decoded), ":", 2)
+				if len(parts) == 2 {
+					creds.username, creds.password = parts[0], parts[1]
+				}
+			}
+		}
+		return creds, nil
+	}
+	return nil, fmt.Errorf("pull secret %s has no credentials for %s", secretName, registry)
+}
+
+// ociGet fetches content from a registry. If the registry asks for
+// authentication, a bearer token is obtained (using the credentials, if
+// any) from the token service it names, or the credentials are sent
+// directly if it asks for basic authentication.
+func ociGet(
+	requestURL string,
+	accept string,
+	creds *ociCredentials,
+) ([]byte, error) {
+
+	response, getErr := ociRequest(requestURL, accept, "")
+	if getErr != nil {
+		return nil, getErr
+	}
+	if response.StatusCode == http.StatusUnauthorized {
+		challenge := response.Header.Get("WWW-Authenticate")
+		response.Body.Close()
+		authorization, authErr := ociAuthorization(challenge, creds)
+		if authErr != nil {
+			return nil, authErr
+		}
+		response, getErr = ociRequest(requestURL, accept, authorization)
+		if getErr != nil {
+			return nil, getErr
+		}
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("registry returned %s", response.Status)
+	}
+	return readLimited(response.Body)
+}
+
+// ociRequest makes one GET request to a registry.
+func ociRequest(
+	requestURL string,
+	accept string,
+	authorization string,
+) (*http.Response, error) {
+
+	request, requestErr := http.NewRequest(http.MethodGet, requestURL, nil)
+	if requestErr != nil {
+		return nil, requestErr
+	}
+	if accept != "" {
+		request.Header.Set("Accept", accept)
+	}
+	if authorization != "" {
+		request.Header.Set("Authorization", authorization)
+	}
+	return ociClient.Do(request)
+}
+
+// ociAuthorization answers an authentication challenge from a registry,
+// returning the value for the Authorization header.
+func ociAuthorization(
+	challenge string,
+	creds *ociCredentials,
+) (string, error) {
+
+	scheme := strings.ToLower(strings.SplitN(challenge, " ", 2)[0])
+	if scheme == "basic" {
+		if creds == nil {
+			return "", fmt.Errorf("registry requires credentials")
+		}
+		return "Basic " + base64.StdEncoding.EncodeToString(
+			[]byte(creds.username+":"+creds.password),
+		), nil
+	}
+	if scheme != "bearer" {
+		return "", fmt.Errorf("unsupported registry authentication %q", challenge)
+	}
+
+	params := challengeParams(challenge)
+	tokenURL, parseErr := url.Parse(params["realm"])
+	if (parseErr != nil) || (tokenURL.Host == "") {
+		return "", fmt.Errorf("invalid registry token realm in %q", challenge)
+	}
+	query := tokenURL.Query()
+	for _, key := range []string{"service", "scope"} {
+		if params[key] != "" {
+			query.Set(key, params[key])
+		}
+	}
+	tokenURL.RawQuery = query.Encode()
+	request, requestErr := http.NewRequest(http.MethodGet, tokenURL.String(), nil)
+	if requestErr != nil {
+		return "", requestErr
+	}
+	if creds != nil {
+		request.SetBasicAuth(creds.username, creds.password)
+	}
+	response, tokenErr := ociClient.Do(request)
+	if tokenErr != nil {
+		return "", tokenErr
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("registry token service returned %s", response.Status)
+	}
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if jsonErr := json.NewDecoder(response.Body).Decode(&token); jsonErr != nil {
+		return "", jsonErr
+	}
+	if token.Token == "" {
+		token.Token = token.AccessToken
+	}
+	return "Bearer " + token.Token, nil
+}
+
+// challengeParams parses the key="value" parameters of a WWW-Authenticate
+// challenge.
+func challengeParams(
+	challenge string,
+) map[string]string {
+
+	params := make(map[string]string)
+	parts := strings.SplitN(challenge, " ", 2)
+	if len(parts) < 2 {
+		return params
+	}
+	rest := parts[1]
+	for rest != "" {
+		eqIndex := strings.Index(rest, "=")
+		if eqIndex == -1 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(rest[:eqIndex]))
+		rest = rest[eqIndex+1:]
+		var value string
+		if strings.HasPrefix(rest, "\"") {
+			endIndex := strings.Index(rest[1:], "\"")
+			if endIndex == -1 {
+				break
+			}
+			value = rest[1 : endIndex+1]
+			rest = rest[endIndex+2:]
+		} else {
+			endIndex := strings.Index(rest, ",")
+			if endIndex == -1 {
+				endIndex = len(rest)
+			}
+			value = rest[:endIndex]
+			rest = rest[endIndex:]
+		}
+		params[key] = value
+		rest = strings.TrimLeft(rest, ", ")
+	}
+	return params
+}
+
+// packageLayer picks the layer holding the setup package out of an
+// artifact manifest: its only layer, or else its only gzipped tarball.
+func packageLayer(
+	manifest *ociManifest,
+) (*ociDescriptor, error) {
+
+	var found *ociDescriptor
+	if len(manifest.Layers) == 1 {
+		found = &(manifest.Layers[0])
+	} else {
+		for i := range manifest.Layers {
+			if strings.HasSuffix(manifest.Layers[i].MediaType, "gzip") {
+				if found != nil {
+					return nil, fmt.Errorf("artifact has more than one gzipped layer")
+				}
+				found = &(manifest.Layers[i])
+			}
+		}
+		if found == nil {
+			return nil, fmt.Errorf("artifact has no gzipped layer")
+		}
+	}
+	if found.Size > maxOCIPackageBytes {
+		return nil, fmt.Errorf("package layer is larger than %d bytes", maxOCIPackageBytes)
+	}
+	return found, nil
+}
+
+// verifyDigest checks content against a sha256 digest.
+func verifyDigest(
+	content []byte,
+	digest string,
+) error {
+
+	sum := sha256.Sum256(content)
+	if "sha256:"+hex.EncodeToString(sum[:]) != digest {
+		return fmt.Errorf("content does not match digest %s", digest)
+	}
+	return nil
+}
+
+// readLimited reads a response body of at most maxOCIPackageBytes.
+func readLimited(
+	body io.Reader,
+) ([]byte, error) {
+
+	content, readErr := ioutil.ReadAll(io.LimitReader(body, maxOCIPackageBytes+1))
+	if readErr != nil {
+		return nil, readErr
+	}
+	if len(content) > maxOCIPackageBytes {
+		return nil, fmt.Errorf("content is larger than %d bytes", maxOCIPackageBytes)
+	}
+	return content, nil
+}
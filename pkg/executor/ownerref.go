@@ -0,0 +1,55 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package executor
+
+import (
+	"github.com/go-logr/logr"
+
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	"github.com/bluek8s/kubedirector/pkg/shared"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// repairOwnerReferences deals with an object of the cluster that is missing
+// its owner reference to the cluster, perhaps because of a bad backup and
+// restore. The object's current owners are recorded in an event, and the
+// owner references that the object should be patched to have are returned,
+// according to the owner reference repair policy of the KubeDirectorConfig.
+// The returned boolean is false if the object should be left alone.
+func repairOwnerReferences(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorCluster,
+	objDesc string,
+	currentRefs []metav1.OwnerReference,
+) ([]metav1.OwnerReference, bool) {
+
+	policy := shared.GetOwnerRefRepairPolicy()
+	refs, repair := shared.RepairedOwnerReferences(cr, currentRefs, policy)
+	action := "repairing"
+	if !repair {
+		action = "not repairing"
+	}
+	shared.LogInfof(
+		reqLogger,
+		cr,
+		shared.EventReasonCluster,
+		"%s owner ref on %s (policy %s); previous owners: %s",
+		action,
+		objDesc,
+		policy,
+		shared.DescribeOwnerReferences(currentRefs),
+	)
+	return refs, repair
+}
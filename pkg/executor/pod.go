@@ -0,0 +1,180 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package executor
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	"github.com/bluek8s/kubedirector/pkg/shared"
+	"github.com/go-logr/logr"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// HasConfiguredReadinessGate returns true if the given pod was created with
+// the KubeDirector "configured" readiness gate. Pods created by older
+// versions of KubeDirector will not have it.
+func HasConfiguredReadinessGate(
+	pod *v1.Pod,
+) bool {
+
+	for _, gate := range pod.Spec.ReadinessGates {
+		if gate.ConditionType == v1.PodConditionType(MemberConfiguredCondition) {
+			return true
+		}
+	}
+	return false
+}
+
+// StorageInitFinished returns the time at which the init container that
+// populates the persistent storage of the given pod completed successfully,
+// or nil if it has not (or the pod has no such container).
+func StorageInitFinished(
+	pod *v1.Pod,
+) *metav1.Time {
+
+	for _, containerStatus := range pod.Status.InitContainerStatuses {
+		if containerStatus.Name != initContainerName {
+			continue
+		}
+		terminated := containerStatus.State.Terminated
+		if (terminated != nil) && (terminated.ExitCode == 0) {
+			return &terminated.FinishedAt
+		}
+	}
+	return nil
+}
+
+// StorageInitSummary returns the summary of the initial copy onto the
+// persistent storage of the given pod, as left by the init container in its
+// termination message. It returns nil if the init container has not
+// finished, or did not do the copy (because the storage was already
+// populated).
+func StorageInitSummary(
+	pod *v1.Pod,
+) *kdv1.StorageInitSummary {
+
+	for _, containerStatus := range pod.Status.InitContainerStatuses {
+		if containerStatus.Name != initContainerName {
+			continue
+		}
+		terminated := containerStatus.State.Terminated
+		if (terminated == nil) || (terminated.Message == "") {
+			return nil
+		}
+		result := &kdv1.StorageInitSummary{}
+		for _, line := range strings.Split(terminated.Message, "\n") {
+			parts := strings.SplitN(line, "=", 2)
+			if len(parts) != 2 {
+				continue
+			}
+			switch parts[0] {
+			case initSummaryMethod:
+				result.Method = parts[1]
+			case initSummaryExitCode:
+				exitCode, _ := strconv.ParseInt(parts[1], 10, 32)
+				result.ExitCode = int32(exitCode)
+			case initSummarySeconds:
+				result.Seconds, _ = strconv.ParseInt(parts[1], 10, 64)
+			case initSummaryProgress:
+				result.Summary = parts[1]
+			case initSummaryLog:
+				result.LogTail = append(result.LogTail, parts[1])
+			}
+		}
+		if result.Method == "" {
+			return nil
+		}
+		return result
+	}
+	return nil
+}
+
+// UpdatePodConfiguredCondition sets the KubeDirector "configured" condition
+// on the given pod to the desired value, if it is not already set that way.
+// Since this condition is used as a readiness gate, this controls whether
+// the pod can be considered ready (and therefore be an endpoint of any
+// non-headless service).
+func UpdatePodConfiguredCondition(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorCluster,
+	pod *v1.Pod,
+	configured bool,
+) error {
+
+	desiredStatus := v1.ConditionFalse
+	if configured {
+		desiredStatus = v1.ConditionTrue
+	}
+	conditionType := v1.PodConditionType(MemberConfiguredCondition)
+	newCondition := v1.PodCondition{
+		Type:               conditionType,
+		Status:             desiredStatus,
+		LastTransitionTime: metav1.Now(),
+	}
+	found := false
+	for i, condition := range pod.Status.Conditions {
+		if condition.Type != conditionType {
+			continue
+		}
+		if condition.Status == desiredStatus {
+			return nil
+		}
+		pod.Status.Conditions[i] = newCondition
+		found = true
+		break
+	}
+	if !found {
+		// Absence of the condition already means "not ready" as far as the
+		// readiness gate is concerned, so don't bother writing false.
+		if !configured {
+			return nil
+		}
+		pod.Status.Conditions = append(pod.Status.Conditions, newCondition)
+	}
+	shared.LogInfof(
+		reqLogger,
+		cr,
+		shared.EventReasonNoEvent,
+		"setting condition %s=%s on pod{%s}",
+		MemberConfiguredCondition,
+		desiredStatus,
+		pod.Name,
+	)
+	return shared.StatusUpdate(context.TODO(), pod)
+}
+
+// DeletePod deletes the named pod. Member pods are owned by a statefulset,
+// which will recreate the pod with the same name.
+func DeletePod(
+	namespace string,
+	podName string,
+) error {
+
+	toDelete := &v1.Pod{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Pod",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      podName,
+			Namespace: namespace,
+		},
+	}
+	return shared.Delete(context.TODO(), toDelete)
+}
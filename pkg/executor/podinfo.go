@@ -0,0 +1,104 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package executor
+
+import (
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	v1 "k8s.io/api/core/v1"
+)
+
+// generatePodInfoEnv returns the env vars that tell a member about itself:
+// its pod name, namespace, member index, role, and cluster, and for an edge
+// role that it is an edge member. The pod name, namespace, and index come
+// from the downward API. Any of these that the role sets in its own env are
+// left out.
+func generatePodInfoEnv(
+	cr *kdv1.KubeDirectorCluster,
+	role *kdv1.Role,
+) []v1.EnvVar {
+
+	fieldEnv := func(name string, fieldPath string) v1.EnvVar {
+		return v1.EnvVar{
+			Name: name,
+			ValueFrom: &v1.EnvVarSource{
+				FieldRef: &v1.ObjectFieldSelector{
+					APIVersion: "v1",
+					FieldPath:  fieldPath,
+				},
+			},
+		}
+	}
+	candidates := []v1.EnvVar{
+		fieldEnv(PodNameEnvVar, "metadata.name"),
+		fieldEnv(PodNamespaceEnvVar, "metadata.namespace"),
+		fieldEnv(MemberIndexEnvVar, "metadata.labels['"+podIndexLabel+"']"),
+		{Name: RoleEnvVar, Value: role.Name},
+		{Name: ClusterEnvVar, Value: cr.Name},
+	}
+	if role.Edge != nil {
+		candidates = append(candidates, v1.EnvVar{Name: EdgeEnvVar, Value: "true"})
+	}
+	var result []v1.EnvVar
+	for _, envVar := range candidates {
+		if !roleSetsEnvVar(role, envVar.Name) {
+			result = append(result, envVar)
+		}
+	}
+	return result
+}
+
+// generatePodInfoVolume generates the VolumeMount and Volume objects for
+// the downward API volume of a role, if the role asks for one. The volume
+// holds the member pod's name, namespace, labels, and annotations, one per
+// file; unlike env vars, the labels and annotations files are updated when
+// those change on the running pod.
+func generatePodInfoVolume(
+	role *kdv1.Role,
+) ([]v1.VolumeMount, []v1.Volume) {
+
+	if role.PodInfoMountPath == nil {
+		return []v1.VolumeMount{}, []v1.Volume{}
+	}
+	fileItem := func(path string, fieldPath string) v1.DownwardAPIVolumeFile {
+		return v1.DownwardAPIVolumeFile{
+			Path: path,
+			FieldRef: &v1.ObjectFieldSelector{
+				APIVersion: "v1",
+				FieldPath:  fieldPath,
+			},
+		}
+	}
+	return []v1.VolumeMount{
+		{
+			Name:      podInfoVolumeName,
+			MountPath: *role.PodInfoMountPath,
+			ReadOnly:  true,
+		},
+	}, []v1.Volume{
+		{
+			Name: podInfoVolumeName,
+			VolumeSource: v1.VolumeSource{
+				DownwardAPI: &v1.DownwardAPIVolumeSource{
+					Items: []v1.DownwardAPIVolumeFile{
+						fileItem("name", "metadata.name"),
+						fileItem("namespace", "metadata.namespace"),
+						fileItem("labels", "metadata.labels"),
+						fileItem("annotations", "metadata.annotations"),
+					},
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package executor
+
+import (
+	"fmt"
+
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	"github.com/bluek8s/kubedirector/pkg/shared"
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// RenderedObjects are the K8s objects that KubeDirector would create to
+// implement a virtual cluster.
+type RenderedObjects struct {
+	StatefulSets           []*appsv1.StatefulSet          `json:"statefulSets"`
+	Services               []*corev1.Service              `json:"services"`
+	PersistentVolumeClaims []corev1.PersistentVolumeClaim `json:"persistentVolumeClaims"`
+}
+
+// Render composes, without creating anything, the statefulsets, services,
+// and PVC templates that KubeDirector would create for the given virtual
+// cluster CR, with each role at its requested member count. The CR should
+// already have been through admission (e.g. by a server-side dry run) so
+// that its defaults are filled in. Names that K8s would generate end in a
+// placeholder suffix, unless the CR status already records them.
+func Render(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorCluster,
+) (*RenderedObjects, error) {
+
+	rendered := &RenderedObjects{}
+	rendered.Services = append(rendered.Services, headlessService(cr))
+	nativeSystemdSupport := shared.GetNativeSystemdSupport()
+	for i := range cr.Spec.Roles {
+		role := &cr.Spec.Roles[i]
+		var replicas int32
+		if role.Members != nil {
+			replicas = *role.Members
+		}
+		sset, ssetErr := getStatefulset(
+			reqLogger,
+			cr,
+			nativeSystemdSupport,
+			role,
+			renderRoleStatus(cr, role.Name),
+			replicas,
+		)
+		if ssetErr != nil {
+			return nil, fmt.Errorf("role %s: %v", role.Name, ssetErr)
+		}
+		rendered.StatefulSets = append(rendered.StatefulSets, sset)
+		rendered.PersistentVolumeClaims = append(
+			rendered.PersistentVolumeClaims,
+			sset.Spec.VolumeClaimTemplates...,
+		)
+		ssetName := sset.Name
+		if ssetName == "" {
+			ssetName = sset.GenerateName + renderNameSuffix
+		}
+		for ordinal := int32(0); ordinal < replicas; ordinal++ {
+			podName := fmt.Sprintf("%s-%d", ssetName, ordinal)
+			service, serviceErr := podService(cr, role, podName)
+			if serviceErr != nil {
+				return nil, fmt.Errorf("role %s: %v", role.Name, serviceErr)
+			}
+			if service != nil {
+				rendered.Services = append(rendered.Services, service)
+			}
+		}
+	}
+	return rendered, nil
+}
+
+// renderRoleStatus returns the status of the named role if the CR already
+// has one, or nil.
+func renderRoleStatus(
+	cr *kdv1.KubeDirectorCluster,
+	roleName string,
+) *kdv1.RoleStatus {
+
+	if cr.Status == nil {
+		return nil
+	}
+	for i := range cr.Status.Roles {
+		if cr.Status.Roles[i].Name == roleName {
+			return &cr.Status.Roles[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package executor
+
+import (
+	"path/filepath"
+
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	"github.com/bluek8s/kubedirector/pkg/shared"
+	v1 "k8s.io/api/core/v1"
+)
+
+// runtimeSocketHostPaths maps the node runtime socket sources to the path of
+// the socket on the node.
+var runtimeSocketHostPaths = map[string]string{
+	kdv1.RuntimeSocketDocker:     "/var/run/docker.sock",
+	kdv1.RuntimeSocketContainerd: "/run/containerd/containerd.sock",
+}
+
+// generateRuntimeSocket returns what gives the app container of a role
+// access to a container runtime: the mount of the socket in the app
+// container, the volumes, the env vars that point clients at the socket,
+// and for docker-in-docker the sidecar that serves it. Everything is empty
+// if the role doesn't ask for a runtime socket.
+func generateRuntimeSocket(
+	role *kdv1.Role,
+) ([]v1.VolumeMount, []v1.Volume, []v1.EnvVar, *v1.Container) {
+
+	if role.RuntimeSocket == nil {
+		return nil, nil, nil, nil
+	}
+	source := role.RuntimeSocket.Source
+	socketMount := v1.VolumeMount{
+		Name:      runtimeSocketVolume,
+		MountPath: runtimeSocketDir,
+	}
+
+	if source == kdv1.RuntimeSocketDinD {
+		socketPath := filepath.Join(runtimeSocketDir, "docker.sock")
+		image := shared.DefaultDinDImage
+		if role.RuntimeSocket.Image != nil {
+			image = *role.RuntimeSocket.Image
+		}
+		// The docker daemon cannot run without a privileged container.
+		privileged := true
+		sidecar := &v1.Container{
+			Name:  RuntimeSidecarName,
+			Image: image,
+			Args:  []string{"--host=unix://" + socketPath},
+			Env: []v1.EnvVar{
+				{
+					Name:  "DOCKER_TLS_CERTDIR",
+					Value: "",
+				},
+			},
+			SecurityContext: &v1.SecurityContext{
+				Privileged: &privileged,
+			},
+			VolumeMounts: []v1.VolumeMount{
+				socketMount,
+				{
+					Name:      dindStorageVolume,
+					MountPath: "/var/lib/docker",
+				},
+			},
+		}
+		volumes := []v1.Volume{
+			{
+				Name: runtimeSocketVolume,
+				VolumeSource: v1.VolumeSource{
+					EmptyDir: &v1.EmptyDirVolumeSource{},
+				},
+			},
+			{
+				Name: dindStorageVolume,
+				VolumeSource: v1.VolumeSource{
+					EmptyDir: &v1.EmptyDirVolumeSource{},
+				},
+			},
+		}
+		envVars := []v1.EnvVar{
+			{
+				Name:  "DOCKER_HOST",
+				Value: "unix://" + socketPath,
+			},
+		}
+		return []v1.VolumeMount{socketMount}, volumes, envVars, sidecar
+	}
+
+	// The validator has already checked the source.
+	hostPath := runtimeSocketHostPaths[source]
+	socketPath := filepath.Join(runtimeSocketDir, filepath.Base(hostPath))
+	socketMount.MountPath = socketPath
+	hostPathType := v1.HostPathSocket
+	volumes := []v1.Volume{
+		{
+			Name: runtimeSocketVolume,
+			VolumeSource: v1.VolumeSource{
+				HostPath: &v1.HostPathVolumeSource{
+					Path: hostPath,
+					Type: &hostPathType,
+				},
+			},
+		},
+	}
+	envVars := []v1.EnvVar{
+		{
+			Name:  "DOCKER_HOST",
+			Value: "unix://" + socketPath,
+		},
+	}
+	if source == kdv1.RuntimeSocketContainerd {
+		envVars = []v1.EnvVar{
+			{
+				Name:  "CONTAINERD_ADDRESS",
+				Value: socketPath,
+			},
+		}
+	}
+	return []v1.VolumeMount{socketMount}, volumes, envVars, nil
+}
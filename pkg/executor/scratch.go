@@ -0,0 +1,59 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package executor
+
+import (
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// generateScratchVolumes returns the empty-dir volumes, and their mounts in
+// the app container, that provide the scratch space of a role.
+func generateScratchVolumes(
+	role *kdv1.Role,
+) ([]v1.VolumeMount, []v1.Volume) {
+
+	var volumeMounts []v1.VolumeMount
+	var volumes []v1.Volume
+	for _, scratch := range role.Scratch {
+		volumeName := scratchVolumePrefix + scratch.Name
+		emptyDir := &v1.EmptyDirVolumeSource{
+			Medium: v1.StorageMedium(scratch.Medium),
+		}
+		if scratch.SizeLimit != nil {
+			// The validator has already checked the size.
+			sizeLimit, _ := resource.ParseQuantity(*scratch.SizeLimit)
+			emptyDir.SizeLimit = &sizeLimit
+		}
+		volumes = append(
+			volumes,
+			v1.Volume{
+				Name: volumeName,
+				VolumeSource: v1.VolumeSource{
+					EmptyDir: emptyDir,
+				},
+			},
+		)
+		volumeMounts = append(
+			volumeMounts,
+			v1.VolumeMount{
+				Name:      volumeName,
+				MountPath: scratch.MountPath,
+			},
+		)
+	}
+	return volumeMounts, volumes
+}
@@ -16,10 +16,14 @@ package executor
 
 import (
 	"context"
+	"encoding/json"
+	"sort"
+	"strings"
 
 	"github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
 	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
 	"github.com/bluek8s/kubedirector/pkg/catalog"
+	"github.com/bluek8s/kubedirector/pkg/observer"
 	"github.com/bluek8s/kubedirector/pkg/shared"
 	"github.com/go-logr/logr"
 	corev1 "k8s.io/api/core/v1"
@@ -38,6 +42,18 @@ func CreateHeadlessService(
 	cr *kdv1.KubeDirectorCluster,
 ) (*corev1.Service, error) {
 
+	service := headlessService(cr)
+	err := shared.Create(context.TODO(), service)
+
+	return service, err
+}
+
+// headlessService composes the spec for the cluster service of the given
+// virtual cluster CR.
+func headlessService(
+	cr *kdv1.KubeDirectorCluster,
+) *corev1.Service {
+
 	service := &corev1.Service{
 		TypeMeta: metav1.TypeMeta{
 			Kind:       "Service",
@@ -74,9 +90,7 @@ func CreateHeadlessService(
 	} else {
 		service.ObjectMeta.Name = cr.Status.ClusterService
 	}
-	err := shared.Create(context.TODO(), service)
-
-	return service, err
+	return service
 }
 
 // UpdateHeadlessService examines the current cluster service in k8s and may
@@ -92,21 +106,22 @@ func UpdateHeadlessService(
 	// need/expect to be under our control, other than the replicas count,
 	// correct them here.
 
-	// For now only checking the owner reference.
+	// For now only checking the owner reference. (A bit more discussion of
+	// this in UpdateStatefulSetNonReplicas comments.)
 	if shared.OwnerReferencesPresent(cr, service.OwnerReferences) {
 		return nil
 	}
-	shared.LogInfof(
+	refs, repair := repairOwnerReferences(
 		reqLogger,
 		cr,
-		shared.EventReasonNoEvent,
-		"repairing owner ref on service{%s}",
-		service.Name,
+		"service{"+service.Name+"}",
+		service.OwnerReferences,
 	)
-	// We're just going to nuke any existing owner refs. (A bit more
-	// discussion of this in UpdateStatefulSetNonReplicas comments.)
+	if !repair {
+		return nil
+	}
 	patchedRes := *service
-	patchedRes.OwnerReferences = shared.OwnerReferences(cr)
+	patchedRes.OwnerReferences = refs
 	return shared.Patch(
 		context.TODO(),
 		service,
@@ -114,6 +129,90 @@ func UpdateHeadlessService(
 	)
 }
 
+// RoleSubdomainServiceName returns the name of the headless service that
+// provides the DNS subdomain of a role which asks for its own. Joining the
+// role name and the cluster service name makes member FQDNs of the form
+// pod.role-cluster.namespace.svc.
+func RoleSubdomainServiceName(
+	cr *kdv1.KubeDirectorCluster,
+	role *kdv1.Role,
+) string {
+
+	return MungObjectName(role.Name + "-" + cr.Status.ClusterService)
+}
+
+// EnsureRoleHeadlessService creates the headless service that provides the
+// DNS subdomain of a role which asks for its own, or repairs its owner
+// reference. Its selector matches only the role's members. Returns the
+// service name.
+func EnsureRoleHeadlessService(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorCluster,
+	role *kdv1.Role,
+) (string, error) {
+
+	name := RoleSubdomainServiceName(cr, role)
+	existing, getErr := observer.GetService(cr.Namespace, name)
+	if getErr == nil {
+		return name, UpdateHeadlessService(reqLogger, cr, existing)
+	}
+	if !errors.IsNotFound(getErr) {
+		return name, getErr
+	}
+	shared.LogInfof(
+		reqLogger,
+		cr,
+		shared.EventReasonRole,
+		"creating headless service{%s} for role{%s}",
+		name,
+		role.Name,
+	)
+	service := &corev1.Service{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Service",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            name,
+			Namespace:       cr.Namespace,
+			OwnerReferences: shared.OwnerReferences(cr),
+			Labels:          labelsForService(cr, role),
+			Annotations:     annotationsForService(cr, role),
+		},
+		Spec: corev1.ServiceSpec{
+			ClusterIP:                "None",
+			Selector:                 labelsForStatefulSet(cr, role),
+			PublishNotReadyAddresses: true,
+			Ports: []corev1.ServicePort{
+				{
+					Name: "port",
+					Port: 8888, // not used
+				},
+			},
+		},
+	}
+	return name, shared.Create(context.TODO(), service)
+}
+
+// DeleteHeadlessService deletes a role headless service from k8s.
+func DeleteHeadlessService(
+	namespace string,
+	serviceName string,
+) error {
+
+	toDelete := &corev1.Service{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Service",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      serviceName,
+			Namespace: namespace,
+		},
+	}
+	return shared.Delete(context.TODO(), toDelete)
+}
+
 // CreatePodService creates in k8s a service that exposes the designated
 // service endpoints of a virtual cluster member. Depending on the app type
 // definition, this will be either a NodePort service (default) or a
@@ -125,7 +224,23 @@ func CreatePodService(
 	podName string,
 ) (*corev1.Service, error) {
 
-	serviceType := shared.ServiceType(*cr.Spec.ServiceType)
+	service, err := podService(cr, role, podName)
+	if (service == nil) || (err != nil) {
+		return nil, err
+	}
+	createErr := shared.Create(context.TODO(), service)
+	return service, createErr
+}
+
+// podService composes the spec for the per-member service of the named
+// member pod. It returns (nil, nil) if the role has no ports to expose.
+func podService(
+	cr *kdv1.KubeDirectorCluster,
+	role *kdv1.Role,
+	podName string,
+) (*corev1.Service, error) {
+
+	serviceType := memberServiceType(cr, role)
 
 	var name string
 	namingScheme := *cr.Spec.NamingScheme
@@ -152,12 +267,15 @@ func CreatePodService(
 			Namespace:       cr.Namespace,
 			OwnerReferences: shared.OwnerReferences(cr),
 			Labels:          labelsForService(cr, role),
-			Annotations:     annotationsForService(cr, role),
+			Annotations:     memberServiceAnnotations(cr, role, podName),
 		},
 		Spec: corev1.ServiceSpec{
-			Selector:                 map[string]string{statefulSetPodLabel: podName},
-			Type:                     serviceType,
-			PublishNotReadyAddresses: true,
+			Selector: map[string]string{statefulSetPodLabel: podName},
+			Type:     serviceType,
+			// Only route to the member once it is ready, which (through the
+			// configured-state readiness gate) includes app config being
+			// complete.
+			PublishNotReadyAddresses: false,
 		},
 	}
 	for _, portInfo := range portInfoList {
@@ -167,15 +285,14 @@ func CreatePodService(
 		}
 		service.Spec.Ports = append(service.Spec.Ports, servicePort)
 	}
-	createErr := shared.Create(context.TODO(), service)
-	return service, createErr
+	return service, nil
 }
 
 // UpdatePodService examines a current per-member service in k8s and may take
 // steps to reconcile it to the desired spec.
-// TBD: Currently this function handles changes only for serviceType and
-// ownerReferences, and is only called if the service is known to already
-// exist. If port-changing is supported in the future, either this function or
+// TBD: Currently this function handles changes only for serviceType,
+// annotations, trafficDistribution, and ownerReferences, and is only called if the service is
+// known to already exist. If port-changing is supported in the future, either this function or
 // its caller must take care of possibly transitioning to and from the "no
 // ports" state which will involve deleting or creating the service object
 // rather than just modifying.
@@ -187,19 +304,20 @@ func UpdatePodService(
 	service *corev1.Service,
 ) error {
 
-	// First check the owner reference.
+	// First check the owner reference. (A bit more discussion of this in
+	// UpdateStatefulSetNonReplicas comments.)
+	refs, repair := service.OwnerReferences, false
 	if !shared.OwnerReferencesPresent(cr, service.OwnerReferences) {
-		shared.LogInfof(
+		refs, repair = repairOwnerReferences(
 			reqLogger,
 			cr,
-			shared.EventReasonNoEvent,
-			"repairing owner ref on service{%s}",
-			service.Name,
+			"service{"+service.Name+"}",
+			service.OwnerReferences,
 		)
-		// We're just going to nuke any existing owner refs. (A bit more
-		// discussion of this in UpdateStatefulSetNonReplicas comments.)
+	}
+	if repair {
 		patchedRes := *service
-		patchedRes.OwnerReferences = shared.OwnerReferences(cr)
+		patchedRes.OwnerReferences = refs
 		patchErr := shared.Patch(
 			context.TODO(),
 			service,
@@ -218,8 +336,20 @@ func UpdatePodService(
 		}
 	}
 
+	// Then the annotations.
+	annotationsErr := updateServiceAnnotations(reqLogger, cr, role, podName, service)
+	if annotationsErr != nil {
+		return annotationsErr
+	}
+
+	// And the traffic distribution.
+	distributionErr := updateServiceTrafficDistribution(reqLogger, cr, service)
+	if distributionErr != nil {
+		return distributionErr
+	}
+
 	// Now deal with service type.
-	reqServiceType := shared.ServiceType(*cr.Spec.ServiceType)
+	reqServiceType := memberServiceType(cr, role)
 
 	// Compare cluster CR's service type against created service
 	if reqServiceType == service.Spec.Type {
@@ -357,3 +487,249 @@ func UpdateService(
 	}
 	return err
 }
+
+// updateServiceAnnotations makes the managed annotations of a per-member
+// service match the spec of its role, whether they differ because the spec
+// changed or because something else changed the service. As with owner
+// references, the annotations being replaced are recorded in an event.
+// Nothing is done if the role no longer has a spec.
+func updateServiceAnnotations(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorCluster,
+	role *kdv1.Role,
+	podName string,
+	service *corev1.Service,
+) error {
+
+	if role == nil {
+		return nil
+	}
+	desiredAnnotations := memberServiceAnnotations(cr, role, podName)
+	if serviceAnnotationsMatch(service, desiredAnnotations) {
+		return nil
+	}
+	shared.LogInfof(
+		reqLogger,
+		cr,
+		shared.EventReasonMember,
+		"updating annotations on service{%s}; previous values: %s",
+		service.Name,
+		describeAnnotationDrift(service, desiredAnnotations),
+	)
+	patchedRes := service.DeepCopy()
+	setServiceAnnotations(patchedRes, desiredAnnotations)
+	patchErr := shared.Patch(
+		context.TODO(),
+		service,
+		patchedRes,
+	)
+	if patchErr != nil {
+		shared.LogErrorf(
+			reqLogger,
+			patchErr,
+			cr,
+			shared.EventReasonNoEvent,
+			"failed to update service{%s}",
+			service.Name,
+		)
+		return patchErr
+	}
+	*service = *patchedRes
+	return nil
+}
+
+// updateServiceTrafficDistribution makes the trafficDistribution of a
+// per-member service match the cluster's topologyRouting. The service API
+// types that KubeDirector builds against predate that field, so it is set
+// with a merge patch, and the value set is recorded in an annotation.
+func updateServiceTrafficDistribution(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorCluster,
+	service *corev1.Service,
+) error {
+
+	desired := ""
+	if (cr.Spec.TopologyRouting != nil) && (cr.Spec.TopologyRouting.TrafficDistribution != nil) {
+		desired = *cr.Spec.TopologyRouting.TrafficDistribution
+	}
+	if service.Annotations[TrafficDistributionAnnotation] == desired {
+		return nil
+	}
+	shared.LogInfof(
+		reqLogger,
+		cr,
+		shared.EventReasonMember,
+		"setting trafficDistribution of service{%s} to \"%s\"",
+		service.Name,
+		desired,
+	)
+	// A null value in a merge patch removes the field.
+	var value interface{}
+	if desired != "" {
+		value = desired
+	}
+	patch := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{
+				TrafficDistributionAnnotation: value,
+			},
+		},
+		"spec": map[string]interface{}{
+			"trafficDistribution": value,
+		},
+	}
+	patchData, jsonErr := json.Marshal(patch)
+	if jsonErr != nil {
+		return jsonErr
+	}
+	patchErr := shared.MergePatch(context.TODO(), service, patchData)
+	if patchErr != nil {
+		shared.LogErrorf(
+			reqLogger,
+			patchErr,
+			cr,
+			shared.EventReasonNoEvent,
+			"failed to update service{%s}",
+			service.Name,
+		)
+	}
+	return patchErr
+}
+
+// memberServiceType returns the type of the member services of a role: the
+// role's own serviceType if it has one, else the cluster's.
+func memberServiceType(
+	cr *kdv1.KubeDirectorCluster,
+	role *kdv1.Role,
+) corev1.ServiceType {
+
+	if (role != nil) && (role.ServiceType != nil) {
+		return shared.ServiceType(*role.ServiceType)
+	}
+	return shared.ServiceType(*cr.Spec.ServiceType)
+}
+
+// memberServiceAnnotations returns the annotations that KubeDirector wants
+// on the service of the named member of a role, including the role's
+// per-member annotations, the topology mode, and the record of which keys
+// it manages.
+func memberServiceAnnotations(
+	cr *kdv1.KubeDirectorCluster,
+	role *kdv1.Role,
+	podName string,
+) map[string]string {
+
+	result := annotationsForService(cr, role)
+	if len(role.MemberServiceAnnotations) != 0 {
+		replacer := strings.NewReplacer(
+			"{member}", podName,
+			"{role}", role.Name,
+			"{cluster}", cr.Name,
+			"{namespace}", cr.Namespace,
+		)
+		for name, value := range role.MemberServiceAnnotations {
+			result[name] = replacer.Replace(value)
+		}
+	}
+	if (cr.Spec.TopologyRouting != nil) && (cr.Spec.TopologyRouting.Mode != nil) {
+		result[TopologyModeAnnotation] = *cr.Spec.TopologyRouting.Mode
+	}
+	var keys []string
+	for key := range result {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	result[ServiceAnnotationKeysAnnotation] = strings.Join(keys, ",")
+	return result
+}
+
+// serviceAnnotationsMatch reports whether a service has exactly the desired
+// managed annotations, and none of the annotations that KubeDirector
+// previously managed on it but no longer wants.
+func serviceAnnotationsMatch(
+	service *corev1.Service,
+	desired map[string]string,
+) bool {
+
+	for key, value := range desired {
+		if current, ok := service.Annotations[key]; !ok || (current != value) {
+			return false
+		}
+	}
+	for _, key := range staleServiceAnnotations(service, desired) {
+		if _, ok := service.Annotations[key]; ok {
+			return false
+		}
+	}
+	return true
+}
+
+// setServiceAnnotations applies the desired managed annotations to a
+// service, removing the ones that KubeDirector previously managed on it but
+// no longer wants. Annotations added by anything else are left alone.
+func setServiceAnnotations(
+	service *corev1.Service,
+	desired map[string]string,
+) {
+
+	stale := staleServiceAnnotations(service, desired)
+	if service.Annotations == nil {
+		service.Annotations = make(map[string]string)
+	}
+	for _, key := range stale {
+		delete(service.Annotations, key)
+	}
+	for key, value := range desired {
+		service.Annotations[key] = value
+	}
+}
+
+// describeAnnotationDrift lists the current values of the managed
+// annotations of a service that are not as desired, for the record.
+func describeAnnotationDrift(
+	service *corev1.Service,
+	desired map[string]string,
+) string {
+
+	var drift []string
+	for key, value := range desired {
+		if key == ServiceAnnotationKeysAnnotation {
+			continue
+		}
+		if current, ok := service.Annotations[key]; !ok {
+			drift = append(drift, key+" (missing)")
+		} else if current != value {
+			drift = append(drift, key+"="+current)
+		}
+	}
+	for _, key := range staleServiceAnnotations(service, desired) {
+		if current, ok := service.Annotations[key]; ok {
+			drift = append(drift, key+"="+current+" (no longer wanted)")
+		}
+	}
+	if len(drift) == 0 {
+		return "none"
+	}
+	sort.Strings(drift)
+	return strings.Join(drift, ", ")
+}
+
+// staleServiceAnnotations returns the keys that the service's record of
+// managed annotations lists but that are not in the desired set.
+func staleServiceAnnotations(
+	service *corev1.Service,
+	desired map[string]string,
+) []string {
+
+	var result []string
+	managedKeys, ok := service.Annotations[ServiceAnnotationKeysAnnotation]
+	if !ok || (managedKeys == "") {
+		return result
+	}
+	for _, key := range strings.Split(managedKeys, ",") {
+		if _, wanted := desired[key]; !wanted {
+			result = append(result, key)
+		}
+	}
+	return result
+}
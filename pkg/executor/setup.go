@@ -0,0 +1,87 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package executor
+
+import (
+	"path/filepath"
+
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	"github.com/bluek8s/kubedirector/pkg/catalog"
+	v1 "k8s.io/api/core/v1"
+)
+
+// generateSetupContainer creates the container spec for the setup
+// container, if the app declares a separate setup image for the role. The
+// setup package is run there instead of in the app container, so the app
+// image does not need a shell or the setup tooling. The setup container
+// sees the app-declared persistent directories (if the role has persistent
+// storage) and the role secret and configmaps at the same paths as the app
+// container, and the pod shares its process namespace so the setup scripts
+// can see the app processes. Returns an empty list if there is no setup
+// image.
+func generateSetupContainer(
+	cr *kdv1.KubeDirectorCluster,
+	role *kdv1.Role,
+	envVars []v1.EnvVar,
+	appPersistDirs *[]string,
+) ([]v1.Container, error) {
+
+	setupImage, setupImageErr := catalog.SetupImageForRole(cr, role.Name)
+	if setupImageErr != nil {
+		return nil, setupImageErr
+	}
+	if setupImage == "" {
+		return nil, nil
+	}
+
+	var volumeMounts []v1.VolumeMount
+	if (role.Storage != nil) && (appPersistDirs != nil) {
+		var dirs []string
+		for _, dir := range *appPersistDirs {
+			dirs = append(dirs, filepath.Clean(dir))
+		}
+		volumeMounts = generateClaimMounts(PvcNamePrefix, dirs)
+	}
+	secretVolMnts, _ := generateSecretVolume(role.Secret)
+	volumeMounts = append(volumeMounts, secretVolMnts...)
+	configMapVolMnts, _ := generateConfigMapVolumes(role.ConfigMaps)
+	volumeMounts = append(volumeMounts, configMapVolMnts...)
+
+	return []v1.Container{
+		{
+			Name:            SetupContainerName,
+			Image:           setupImage,
+			ImagePullPolicy: imagePullPolicy(role),
+			Command:         []string{"/bin/sh", "-c", setupContainerIdleCmd},
+			Env:             envVars,
+			EnvFrom:         generateEnvFrom(role),
+			VolumeMounts:    volumeMounts,
+		},
+	}, nil
+}
+
+// hasSetupContainer reports whether the given pod spec includes a setup
+// container.
+func hasSetupContainer(
+	podSpec *v1.PodSpec,
+) bool {
+
+	for _, container := range podSpec.Containers {
+		if container.Name == SetupContainerName {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,88 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package executor
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// setupPackageTimeout bounds the download of a setup package.
+const setupPackageTimeout = 5 * time.Minute
+
+// setupPackages caches the setup packages downloaded by KubeDirector, by
+// URL and digest. Only packages pinned to a digest are downloaded this way,
+// so a cached package is always the one asked for.
+var setupPackages = struct {
+	sync.Mutex
+	content map[string][]byte
+}{
+	content: make(map[string][]byte),
+}
+
+// setupPackageClient is used for all setup package downloads.
+var setupPackageClient = &http.Client{Timeout: setupPackageTimeout}
+
+// IsHTTPPackage checks whether a setup package URL is an http or https URL,
+// which KubeDirector can download itself.
+func IsHTTPPackage(
+	packageURL string,
+) bool {
+
+	return strings.HasPrefix(packageURL, "http://") ||
+		strings.HasPrefix(packageURL, "https://")
+}
+
+// FetchSetupPackage returns the content of the setup package at the given
+// http(s) URL, which must have the given hex sha256 digest. A package is
+// only downloaded once; later calls, for other members or clusters, are
+// answered from the cache.
+func FetchSetupPackage(
+	packageURL string,
+	digest string,
+) ([]byte, error) {
+
+	key := packageURL + "@sha256:" + digest
+	setupPackages.Lock()
+	content, ok := setupPackages.content[key]
+	setupPackages.Unlock()
+	if ok {
+		return content, nil
+	}
+
+	response, getErr := setupPackageClient.Get(packageURL)
+	if getErr != nil {
+		return nil, fmt.Errorf("failed to download %s: %v", packageURL, getErr)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download %s: %s", packageURL, response.Status)
+	}
+	content, readErr := readLimited(response.Body)
+	if readErr != nil {
+		return nil, fmt.Errorf("failed to download %s: %v", packageURL, readErr)
+	}
+	if verifyErr := verifyDigest(content, "sha256:"+digest); verifyErr != nil {
+		return nil, fmt.Errorf("setup package %s: %v", packageURL, verifyErr)
+	}
+
+	setupPackages.Lock()
+	setupPackages.content[key] = content
+	setupPackages.Unlock()
+	return content, nil
+}
@@ -0,0 +1,119 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package executor
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	v1 "k8s.io/api/core/v1"
+)
+
+// generateSidecars creates the container specs for any sidecars declared
+// for the role, followed by any extra sidecars that KubeDirector adds to
+// it. Directories shared from the member's persistent storage are
+// mounted from the member PVC; any other shared directory is backed by an
+// empty-dir volume, in which case the mounts for the app container and the
+// volumes are also returned.
+func generateSidecars(
+	role *kdv1.Role,
+	extraSidecars []kdv1.Sidecar,
+	pvcNamePrefix string,
+	persistDirs []string,
+) ([]v1.Container, []v1.VolumeMount, []v1.Volume) {
+
+	var containers []v1.Container
+	var appMounts []v1.VolumeMount
+	var volumes []v1.Volume
+	sharedVolumes := make(map[string]string)
+	allSidecars := append(append([]kdv1.Sidecar{}, role.Sidecars...), extraSidecars...)
+	for _, sidecar := range allSidecars {
+		var mounts []v1.VolumeMount
+		for _, sidecarMount := range sidecar.VolumeMounts {
+			appPath := filepath.Clean(sidecarMount.AppPath)
+			if (role.Storage != nil) && isPersisted(appPath, persistDirs) {
+				mounts = append(
+					mounts,
+					v1.VolumeMount{
+						Name:      pvcNamePrefix,
+						MountPath: sidecarMount.MountPath,
+						ReadOnly:  sidecarMount.ReadOnly,
+						SubPath:   appPath[1:],
+					},
+				)
+				continue
+			}
+			volName, ok := sharedVolumes[appPath]
+			if !ok {
+				volName = sidecarShareVolumePrefix + strconv.Itoa(len(sharedVolumes))
+				sharedVolumes[appPath] = volName
+				appMounts = append(
+					appMounts,
+					v1.VolumeMount{
+						Name:      volName,
+						MountPath: appPath,
+					},
+				)
+				volumes = append(
+					volumes,
+					v1.Volume{
+						Name: volName,
+						VolumeSource: v1.VolumeSource{
+							EmptyDir: &v1.EmptyDirVolumeSource{},
+						},
+					},
+				)
+			}
+			mounts = append(
+				mounts,
+				v1.VolumeMount{
+					Name:      volName,
+					MountPath: sidecarMount.MountPath,
+					ReadOnly:  sidecarMount.ReadOnly,
+				},
+			)
+		}
+		containers = append(
+			containers,
+			v1.Container{
+				Name:         sidecar.Name,
+				Image:        sidecar.Image,
+				Command:      sidecar.Command,
+				Args:         sidecar.Args,
+				Env:          sidecar.Env,
+				Resources:    sidecar.Resources,
+				VolumeMounts: mounts,
+			},
+		)
+	}
+	return containers, appMounts, volumes
+}
+
+// isPersisted returns true if the given absolute path is one of the
+// persisted directories or is below one of them.
+func isPersisted(
+	path string,
+	persistDirs []string,
+) bool {
+
+	for _, dir := range persistDirs {
+		rel, relErr := filepath.Rel(dir, path)
+		if (relErr == nil) && !strings.HasPrefix(rel, "..") {
+			return true
+		}
+	}
+	return false
+}
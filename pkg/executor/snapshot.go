@@ -0,0 +1,73 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package executor
+
+import (
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	"github.com/bluek8s/kubedirector/pkg/shared"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// BackupSnapshotName returns the name of the VolumeSnapshot that a backup
+// takes of a member PVC.
+func BackupSnapshotName(
+	backup *kdv1.KubeDirectorBackup,
+	pvcName string,
+) string {
+
+	return backup.Name + "-" + pvcName
+}
+
+// VolumeSnapshot generates the CSI VolumeSnapshot that a backup takes of a
+// member PVC. The snapshot is owned by the backup, so that deleting the
+// backup deletes its snapshots.
+func VolumeSnapshot(
+	backup *kdv1.KubeDirectorBackup,
+	pvcName string,
+) *unstructured.Unstructured {
+
+	snapshot := &unstructured.Unstructured{}
+	snapshot.SetAPIVersion(snapshotAPIVersion)
+	snapshot.SetKind("VolumeSnapshot")
+	snapshot.SetName(BackupSnapshotName(backup, pvcName))
+	snapshot.SetNamespace(backup.Namespace)
+	snapshot.SetOwnerReferences(shared.OwnerReferences(backup))
+	snapshot.SetLabels(map[string]string{shared.ClusterLabel: backup.Spec.Cluster})
+	spec := map[string]interface{}{
+		"source": map[string]interface{}{
+			"persistentVolumeClaimName": pvcName,
+		},
+	}
+	if backup.Spec.VolumeSnapshotClassName != nil {
+		spec["volumeSnapshotClassName"] = *backup.Spec.VolumeSnapshotClassName
+	}
+	snapshot.Object["spec"] = spec
+	return snapshot
+}
+
+// SnapshotSource returns the data source reference for a PVC whose content
+// is to be restored from the named VolumeSnapshot.
+func SnapshotSource(
+	snapshotName string,
+) *v1.TypedLocalObjectReference {
+
+	group := snapshotGroup
+	return &v1.TypedLocalObjectReference{
+		APIGroup: &group,
+		Kind:     "VolumeSnapshot",
+		Name:     snapshotName,
+	}
+}
@@ -16,6 +16,9 @@ package executor
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"path/filepath"
 	"strconv"
@@ -28,11 +31,13 @@ import (
 	"github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
 	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
 	"github.com/bluek8s/kubedirector/pkg/catalog"
+	"github.com/bluek8s/kubedirector/pkg/extension"
 	"github.com/bluek8s/kubedirector/pkg/shared"
 	appsv1 "k8s.io/api/apps/v1"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sClient "sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 // defaultMountFolders identifies the set of member filesystems directories
@@ -156,6 +161,7 @@ func UpdateStatefulSetNonReplicas(
 	cr *kdv1.KubeDirectorCluster,
 	role *kdv1.Role,
 	statefulSet *appsv1.StatefulSet,
+	templateHash string,
 ) error {
 
 	// If no spec, nothing to do.
@@ -168,29 +174,407 @@ func UpdateStatefulSetNonReplicas(
 	// need/expect to be under our control, other than the replicas count,
 	// correct them here.
 
-	// For now only checking the owner reference.
-	if shared.OwnerReferencesPresent(cr, statefulSet.OwnerReferences) {
+	// For now only checking the owner reference, the pod template hash, and
+	// debug mode.
+	// So, what to do. Do we add our owner ref to the existing ones? What if
+	// something else is claiming to be controller? Probably some stale ref
+	// left by a bad backup/restore process? The KubeDirectorConfig decides.
+	if !shared.OwnerReferencesPresent(cr, statefulSet.OwnerReferences) {
+		refs, repair := repairOwnerReferences(
+			reqLogger,
+			cr,
+			"statefulset{"+statefulSet.Name+"}",
+			statefulSet.OwnerReferences,
+		)
+		if repair {
+			patchedRes := *statefulSet
+			patchedRes.OwnerReferences = refs
+			patchErr := shared.Patch(
+				context.TODO(),
+				statefulSet,
+				&patchedRes,
+			)
+			if patchErr != nil {
+				return patchErr
+			}
+			*statefulSet = patchedRes
+		}
+	}
+
+	// A statefulset created by an older KubeDirector has no record of its
+	// pod template hash. Assume that its template is current.
+	if StatefulSetPodTemplateHash(statefulSet) == "" {
+		shared.LogInfof(
+			reqLogger,
+			cr,
+			shared.EventReasonNoEvent,
+			"recording pod template hash on statefulset{%s}",
+			statefulSet.Name,
+		)
+		patchedRes := statefulSet.DeepCopy()
+		setPodTemplateHash(patchedRes, templateHash)
+		patchErr := shared.Patch(
+			context.TODO(),
+			statefulSet,
+			patchedRes,
+		)
+		if patchErr != nil {
+			return patchErr
+		}
+		*statefulSet = *patchedRes
+	}
+
+	// If the template hash matches, the template is as KubeDirector wants
+	// it and there is nothing more to compare.
+	if StatefulSetPodTemplateHash(statefulSet) == templateHash {
+		return nil
+	}
+
+	// Turning debug mode on or off changes the pod template, which causes
+	// the statefulset to restart its pods with the new settings.
+	if debugModeActive(cr) == debugModeApplied(&statefulSet.Spec.Template.Spec) {
 		return nil
 	}
 	shared.LogInfof(
 		reqLogger,
 		cr,
 		shared.EventReasonNoEvent,
-		"repairing owner ref on statefulset{%s}",
+		"updating debug mode on statefulset{%s}",
 		statefulSet.Name,
 	)
-	// So, what to do. Do we add our owner ref to the existing ones? What if
-	// something else is claiming to be controller? Probably some stale ref
-	// left by a bad backup/restore process? We're just going to nuke any
-	// existing owner refs.
-	patchedRes := *statefulSet
-	patchedRes.OwnerReferences = shared.OwnerReferences(cr)
+	patchedRes := statefulSet.DeepCopy()
+	debugErr := applyDebugMode(cr, role, &patchedRes.Spec.Template.Spec)
+	if debugErr != nil {
+		return debugErr
+	}
+	setPodTemplateHash(patchedRes, templateHash)
+	patchErr := shared.Patch(
+		context.TODO(),
+		statefulSet,
+		patchedRes,
+	)
+	if patchErr != nil {
+		return patchErr
+	}
+	*statefulSet = *patchedRes
+	return nil
+}
+
+// StatefulSetImages returns the images used by the app container and the
+// setup container in the pod template of the given statefulset. The setup
+// image is an empty string if there is no setup container.
+func StatefulSetImages(
+	statefulSet *appsv1.StatefulSet,
+) (string, string) {
+
+	var appImage, setupImage string
+	for _, container := range statefulSet.Spec.Template.Spec.Containers {
+		switch container.Name {
+		case AppContainerName:
+			appImage = container.Image
+		case SetupContainerName:
+			setupImage = container.Image
+		}
+	}
+	return appImage, setupImage
+}
+
+// UpdateStatefulSetImages changes the images used in the pod template of
+// the given statefulset. The app image is used by the app container and by
+// the init container (which copies directories out of the app image), unless
+// the init container image is overridden. The
+// setup image is only used if the template has a setup container. The
+// "configured" readiness gate is also added to the template if it lacks it
+// (as for statefulsets made by older KubeDirector versions). The
+// statefulset controller then replaces the member pods one at a time,
+// waiting for each new pod to become ready (i.e. configured) before moving
+// on to the next. The given pod template hash is recorded on the
+// statefulset.
+func UpdateStatefulSetImages(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorCluster,
+	statefulSet *appsv1.StatefulSet,
+	appImage string,
+	setupImage string,
+	templateHash string,
+) error {
+
+	shared.LogInfof(
+		reqLogger,
+		cr,
+		shared.EventReasonNoEvent,
+		"updating images on statefulset{%s}",
+		statefulSet.Name,
+	)
+	patchedRes := statefulSet.DeepCopy()
+	setTemplateImages(cr, &patchedRes.Spec.Template, appImage, setupImage)
+	setPodTemplateHash(patchedRes, templateHash)
 	patchErr := shared.Patch(
 		context.TODO(),
 		statefulSet,
-		&patchedRes,
+		patchedRes,
+	)
+	if patchErr != nil {
+		return patchErr
+	}
+	*statefulSet = *patchedRes
+	return nil
+}
+
+// setTemplateImages makes the image changes to a pod template described for
+// UpdateStatefulSetImages, including the addition of any missing
+// "configured" readiness gate.
+func setTemplateImages(
+	cr *kdv1.KubeDirectorCluster,
+	template *v1.PodTemplateSpec,
+	appImage string,
+	setupImage string,
+) {
+
+	podSpec := &template.Spec
+	for i := range podSpec.InitContainers {
+		if podSpec.InitContainers[i].Name == initContainerName {
+			podSpec.InitContainers[i].Image = initContainerImage(cr, appImage)
+		}
+	}
+	for i := range podSpec.Containers {
+		switch podSpec.Containers[i].Name {
+		case AppContainerName:
+			podSpec.Containers[i].Image = appImage
+		case SetupContainerName:
+			podSpec.Containers[i].Image = setupImage
+		}
+	}
+	hasGate := false
+	for _, gate := range podSpec.ReadinessGates {
+		if gate.ConditionType == v1.PodConditionType(MemberConfiguredCondition) {
+			hasGate = true
+		}
+	}
+	if !hasGate {
+		podSpec.ReadinessGates = append(
+			podSpec.ReadinessGates,
+			v1.PodReadinessGate{
+				ConditionType: v1.PodConditionType(MemberConfiguredCondition),
+			},
+		)
+	}
+}
+
+// PodTemplateHash returns a short, stable hash of a pod template, used to
+// tell cheaply whether the template that KubeDirector would generate now
+// differs from the one it generated for an existing statefulset.
+func PodTemplateHash(
+	template *v1.PodTemplateSpec,
+) string {
+
+	// Marshalling sorts map keys, so the encoding is stable.
+	encoded, _ := json.Marshal(template)
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:])[:podTemplateHashLength]
+}
+
+// DesiredPodTemplateHash returns the hash of the pod template that
+// KubeDirector would currently generate for the given role.
+func DesiredPodTemplateHash(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorCluster,
+	role *kdv1.Role,
+	roleStatus *kdv1.RoleStatus,
+) (string, error) {
+
+	sset, err := generateStatefulset(
+		reqLogger,
+		cr,
+		shared.GetNativeSystemdSupport(),
+		role,
+		roleStatus,
+		0,
+	)
+	if err != nil {
+		return "", err
+	}
+	return PodTemplateHash(&sset.Spec.Template), nil
+}
+
+// StatefulSetPodTemplateHash returns the pod template hash recorded on the
+// given statefulset, or an empty string if there is none.
+func StatefulSetPodTemplateHash(
+	statefulSet *appsv1.StatefulSet,
+) string {
+
+	return statefulSet.Annotations[PodTemplateHashAnnotation]
+}
+
+// setPodTemplateHash records a pod template hash on a statefulset.
+func setPodTemplateHash(
+	statefulSet *appsv1.StatefulSet,
+	templateHash string,
+) {
+
+	if statefulSet.Annotations == nil {
+		statefulSet.Annotations = make(map[string]string)
+	}
+	statefulSet.Annotations[PodTemplateHashAnnotation] = templateHash
+}
+
+// StatefulSetRolloutDone reports whether every pod of the given statefulset
+// is running the current revision of its pod template.
+func StatefulSetRolloutDone(
+	statefulSet *appsv1.StatefulSet,
+) bool {
+
+	if statefulSet.Status.ObservedGeneration < statefulSet.Generation {
+		return false
+	}
+	if statefulSet.Status.CurrentRevision != statefulSet.Status.UpdateRevision {
+		return false
+	}
+	replicas := int32(1)
+	if statefulSet.Spec.Replicas != nil {
+		replicas = *statefulSet.Spec.Replicas
+	}
+	return statefulSet.Status.UpdatedReplicas == replicas
+}
+
+// StatefulSetStorageSize returns the size requested by the persistent
+// storage claim template of the given statefulset, or nil if the statefulset
+// does not have such a template.
+func StatefulSetStorageSize(
+	statefulSet *appsv1.StatefulSet,
+) *resource.Quantity {
+
+	for _, template := range statefulSet.Spec.VolumeClaimTemplates {
+		if template.Name != PvcNamePrefix {
+			continue
+		}
+		size, ok := template.Spec.Resources.Requests[v1.ResourceStorage]
+		if !ok {
+			return nil
+		}
+		return &size
+	}
+	return nil
+}
+
+// ReplaceStatefulSetStorage replaces the given statefulset with one whose
+// persistent storage claim template requests the given size. Claim templates
+// cannot be modified in place, so the statefulset is deleted and re-created.
+// The deletion orphans the member pods, and since the replacement otherwise
+// has an identical spec it adopts them without restarting them. If the
+// returned statefulset is nil, the old statefulset has been deleted but the
+// replacement was not created: either the returned error says why, or the
+// old statefulset has not gone away yet and the replacement is left to a
+// later reconciler pass.
+func ReplaceStatefulSetStorage(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorCluster,
+	statefulSet *appsv1.StatefulSet,
+	size resource.Quantity,
+) (*appsv1.StatefulSet, error) {
+
+	modify := func(replacement *appsv1.StatefulSet) {
+		numTemplates := len(replacement.Spec.VolumeClaimTemplates)
+		for i := 0; i < numTemplates; i++ {
+			template := &(replacement.Spec.VolumeClaimTemplates[i])
+			if template.Name == PvcNamePrefix {
+				template.Spec.Resources.Requests[v1.ResourceStorage] = size
+			}
+		}
+	}
+	return replaceStatefulSet(
+		reqLogger,
+		cr,
+		statefulSet,
+		modify,
+		"storage size "+size.String(),
+	)
+}
+
+// replaceStatefulSet deletes the given statefulset, orphaning its pods, and
+// re-creates it with a copy of its spec changed by the given function. The
+// description of the change is used for logging. Return values are as for
+// ReplaceStatefulSetStorage.
+func replaceStatefulSet(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorCluster,
+	statefulSet *appsv1.StatefulSet,
+	modify func(*appsv1.StatefulSet),
+	description string,
+) (*appsv1.StatefulSet, error) {
+
+	replacement := &appsv1.StatefulSet{
+		TypeMeta: statefulSet.TypeMeta,
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            statefulSet.Name,
+			Namespace:       statefulSet.Namespace,
+			Labels:          statefulSet.Labels,
+			Annotations:     statefulSet.Annotations,
+			OwnerReferences: shared.OwnerReferences(cr),
+		},
+		Spec: *statefulSet.Spec.DeepCopy(),
+	}
+	modify(replacement)
+
+	deleteErr := shared.Delete(
+		context.TODO(),
+		statefulSet,
+		k8sClient.PropagationPolicy(metav1.DeletePropagationOrphan),
+	)
+	if deleteErr != nil && !errors.IsNotFound(deleteErr) {
+		return statefulSet, deleteErr
+	}
+
+	// The statefulset lingers until the garbage collector has released the
+	// member pods. If it is still there, don't wait for it; a later pass
+	// will see the role without a statefulset and re-create it.
+	name := types.NamespacedName{
+		Namespace: statefulSet.Namespace,
+		Name:      statefulSet.Name,
+	}
+	getErr := shared.Get(context.TODO(), name, &appsv1.StatefulSet{})
+	if !errors.IsNotFound(getErr) {
+		return nil, nil
+	}
+
+	shared.LogInfof(
+		reqLogger,
+		cr,
+		shared.EventReasonNoEvent,
+		"re-creating statefulset{%s} with %s",
+		statefulSet.Name,
+		description,
 	)
-	return patchErr
+	createErr := shared.Create(context.TODO(), replacement)
+	if createErr != nil {
+		return nil, createErr
+	}
+	return replacement, nil
+}
+
+// RestoreStatefulSet creates in k8s a statefulset for implementing the given
+// role, with enough replicas to adopt the role's existing member pods. This
+// is used to finish an interrupted statefulset replacement.
+func RestoreStatefulSet(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorCluster,
+	nativeSystemdSupport bool,
+	role *kdv1.Role,
+	roleStatus *kdv1.RoleStatus,
+) (*appsv1.StatefulSet, error) {
+
+	statefulSet, err := getStatefulset(
+		reqLogger,
+		cr,
+		nativeSystemdSupport,
+		role,
+		roleStatus,
+		int32(len(roleStatus.Members)),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return statefulSet, shared.Create(context.TODO(), statefulSet)
 }
 
 // DeleteStatefulSet deletes a statefulset from k8s.
@@ -212,9 +596,59 @@ func DeleteStatefulSet(
 	return shared.Delete(context.TODO(), toDelete)
 }
 
+// StatefulSetPersistence summarizes the storage configured by the given
+// statefulset: the directories mounted from the role's PVC, all volume
+// mounts of the app container, and the PVC templates.
+func StatefulSetPersistence(
+	statefulSet *appsv1.StatefulSet,
+) *kdv1.RolePersistence {
+
+	result := &kdv1.RolePersistence{}
+	for _, container := range statefulSet.Spec.Template.Spec.Containers {
+		if container.Name != AppContainerName {
+			continue
+		}
+		for _, mount := range container.VolumeMounts {
+			if mount.Name == PvcNamePrefix {
+				result.PersistDirs = append(result.PersistDirs, mount.MountPath)
+			}
+			result.VolumeMounts = append(
+				result.VolumeMounts,
+				kdv1.VolumeMountSummary{
+					Name:      mount.Name,
+					MountPath: mount.MountPath,
+					SubPath:   mount.SubPath,
+					ReadOnly:  mount.ReadOnly,
+				},
+			)
+		}
+	}
+	for _, claim := range statefulSet.Spec.VolumeClaimTemplates {
+		summary := kdv1.ClaimTemplateSummary{
+			Name: claim.Name,
+		}
+		if claim.Spec.StorageClassName != nil {
+			summary.StorageClass = *claim.Spec.StorageClassName
+		}
+		if size, ok := claim.Spec.Resources.Requests[v1.ResourceStorage]; ok {
+			summary.Size = size.String()
+		}
+		if claim.Spec.VolumeMode != nil {
+			summary.VolumeMode = string(*claim.Spec.VolumeMode)
+		}
+		for _, mode := range claim.Spec.AccessModes {
+			summary.AccessModes = append(summary.AccessModes, string(mode))
+		}
+		result.ClaimTemplates = append(result.ClaimTemplates, summary)
+	}
+	noteClaimEncryption(result)
+	return result
+}
+
 // getStatefulset composes the spec for creating a statefulset in k8s, based
 // on the given virtual cluster CR and for the purposes of implementing the
-// given role.
+// given role. The hash of the pod template as generated by KubeDirector
+// (before any changes by extensions) is recorded in an annotation.
 func getStatefulset(
 	reqLogger logr.Logger,
 	cr *kdv1.KubeDirectorCluster,
@@ -224,11 +658,53 @@ func getStatefulset(
 	replicas int32,
 ) (*appsv1.StatefulSet, error) {
 
+	sset, err := generateStatefulset(
+		reqLogger,
+		cr,
+		nativeSystemdSupport,
+		role,
+		roleStatus,
+		replicas,
+	)
+	if err != nil {
+		return nil, err
+	}
+	templateHash := PodTemplateHash(&sset.Spec.Template)
+
+	// Let any extensions adjust the generated statefulset.
+	sset = extension.PreStatefulSet(reqLogger, cr, role, sset)
+
+	setPodTemplateHash(sset, templateHash)
+	return sset, nil
+}
+
+// generateStatefulset builds the statefulset that KubeDirector wants for
+// the given role, before any changes by extensions.
+func generateStatefulset(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorCluster,
+	nativeSystemdSupport bool,
+	role *kdv1.Role,
+	roleStatus *kdv1.RoleStatus,
+	replicas int32,
+) (*appsv1.StatefulSet, error) {
+
 	labels := labelsForStatefulSet(cr, role)
 	podLabels := labelsForPod(cr, role)
 	annotations := annotationsForStatefulSet(cr, role)
 	podAnnotations := annotationsForPod(cr, role)
-	startupScript := getStartupScript(cr)
+	startupScript := getStartupScript(cr, role)
+
+	// Annotations for log agents don't override the requested ones.
+	logAnnotations, logErr := loggingAnnotations(cr, role)
+	if logErr != nil {
+		return nil, logErr
+	}
+	for name, value := range logAnnotations {
+		if _, ok := podAnnotations[name]; !ok {
+			podAnnotations[name] = value
+		}
+	}
 
 	portInfoList, portsErr := catalog.PortsForRole(cr, role.Name)
 	if portsErr != nil {
@@ -357,10 +833,28 @@ func getStatefulset(
 		addToDirs(*appPersistDirs, &defaultPersistDirs, true, role.Name)
 	}
 
+	// Files matching the app's exclude patterns, or any added by the
+	// cluster role, are left out of the initial copy to the PVC.
+	appPersistExcludes, excludesErr := catalog.AppPersistExcludes(cr, role.Name)
+	if excludesErr != nil {
+		return nil, excludesErr
+	}
+	var persistExcludes []string
+	if appPersistExcludes != nil {
+		persistExcludes = append(persistExcludes, *appPersistExcludes...)
+	}
+	persistExcludes = append(persistExcludes, role.PersistExcludes...)
+
 	useServiceAccount := false
-	if role.ServiceAccountName != "" {
+	serviceAccountName := role.ServiceAccountName
+	if serviceAccountName != "" {
 		useServiceAccount = true
 	}
+	if role.WorkloadIdentity != nil {
+		// Any token the app needs is projected explicitly below, so the
+		// default API token is still not mounted.
+		serviceAccountName = WorkloadIdentityServiceAccountName(cr, role)
+	}
 	volumeMounts, volumes, volumesErr := generateVolumeMounts(
 		cr,
 		role,
@@ -373,27 +867,62 @@ func getStatefulset(
 		return nil, volumesErr
 	}
 
-	// check if BlockStorage field is present. If it is, create a volumeDevices field
-	var volumeDevices []v1.VolumeDevice
-	if role.BlockStorage != nil {
-
-		numDevices := *role.BlockStorage.NumDevices
-
-		for i := int32(0); i < numDevices; i++ {
-
-			deviceID := strconv.FormatInt(int64(i), 10)
-			devicePath := *role.BlockStorage.Path + deviceID
-			deviceName := blockPvcNamePrefix + deviceID
-
-			volumeDevice := v1.VolumeDevice{
-				Name:       deviceName,
-				DevicePath: devicePath,
-			}
-			volumeDevices = append(volumeDevices, volumeDevice)
-
-		}
-
+	// Copy the env vars so that appending never writes into the role spec.
+	envVars := append([]v1.EnvVar{}, chkModifyEnvVars(role, setupInfo)...)
+	requiredEnvVars, requiredEnvErr := generateRequiredEnv(cr, role)
+	if requiredEnvErr != nil {
+		return nil, requiredEnvErr
+	}
+	envVars = append(envVars, requiredEnvVars...)
+	identityMounts, identityVolumes, identityEnvVars := generateIdentitySupport(role)
+	volumeMounts = append(volumeMounts, identityMounts...)
+	volumes = append(volumes, identityVolumes...)
+	scratchMounts, scratchVolumes := generateScratchVolumes(role)
+	volumeMounts = append(volumeMounts, scratchMounts...)
+	volumes = append(volumes, scratchVolumes...)
+	runtimeMounts, runtimeVolumes, runtimeEnvVars, runtimeSidecar := generateRuntimeSocket(role)
+	volumeMounts = append(volumeMounts, runtimeMounts...)
+	volumes = append(volumes, runtimeVolumes...)
+	envVars = append(envVars, runtimeEnvVars...)
+	envVars = append(envVars, identityEnvVars...)
+	envVars = append(envVars, generatePodInfoEnv(cr, role)...)
+	extraSidecars, appContainerPorts, appContainersErr := generateAppContainers(cr, role)
+	if appContainersErr != nil {
+		return nil, appContainersErr
+	}
+	logShipper, logShipperErr := generateLogShipper(cr, role)
+	if logShipperErr != nil {
+		return nil, logShipperErr
+	}
+	if logShipper != nil {
+		extraSidecars = append(extraSidecars, *logShipper)
+	}
+	sidecars, sidecarAppMounts, sidecarVolumes := generateSidecars(
+		role,
+		extraSidecars,
+		PvcNamePrefix,
+		persistDirs,
+	)
+	for i := range sidecars {
+		sidecars[i].Ports = appContainerPorts[sidecars[i].Name]
+	}
+	if runtimeSidecar != nil {
+		sidecars = append(sidecars, *runtimeSidecar)
+	}
+	volumeMounts = append(volumeMounts, sidecarAppMounts...)
+	volumes = append(volumes, sidecarVolumes...)
+	setupContainers, setupErr := generateSetupContainer(
+		cr,
+		role,
+		envVars,
+		appPersistDirs,
+	)
+	if setupErr != nil {
+		return nil, setupErr
 	}
+
+	// If the role has block storage, give the app container its devices.
+	volumeDevices := generateBlockDevices(role)
 	imageID, imageErr := catalog.ImageForRole(cr, role.Name)
 	if imageErr != nil {
 		return nil, imageErr
@@ -404,6 +933,27 @@ func getStatefulset(
 		return nil, securityErr
 	}
 
+	readinessProbe, livenessProbe, startupProbe := roleProbes(cr, role.Name)
+	relaxProbe(role, readinessProbe)
+	relaxProbe(role, livenessProbe)
+	relaxProbe(role, startupProbe)
+
+	// An app without a shell in its image can't run the startup script, so
+	// its DNS search path is set through the pod DNS config instead.
+	shellless, shelllessErr := catalog.AppShellless(cr)
+	if shelllessErr != nil {
+		return nil, shelllessErr
+	}
+	preStop := rolePreStop(cr, role)
+	lifecycle := &v1.Lifecycle{PostStart: &startupScript, PreStop: preStop}
+	if shellless {
+		// A preStop command can still name a binary in the image.
+		lifecycle = nil
+		if preStop != nil {
+			lifecycle = &v1.Lifecycle{PreStop: preStop}
+		}
+	}
+
 	vct := getVolumeClaimTemplate(cr, role, PvcNamePrefix)
 
 	sset := &appsv1.StatefulSet{
@@ -420,9 +970,11 @@ func getStatefulset(
 		Spec: appsv1.StatefulSetSpec{
 			PodManagementPolicy: appsv1.ParallelPodManagement,
 			Replicas:            &replicas,
-			ServiceName:         cr.Status.ClusterService,
+			ServiceName:         memberServiceName(cr, role),
+			// The selector only uses the labels that KubeDirector sets,
+			// so that user-requested pod labels can never end up in it.
 			Selector: &metav1.LabelSelector{
-				MatchLabels: podLabels,
+				MatchLabels: labels,
 			},
 			Template: v1.PodTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{
@@ -437,24 +989,41 @@ func getStatefulset(
 						PvcNamePrefix,
 						imageID,
 						persistDirs,
+						persistExcludes,
 					),
-					Affinity:           role.Affinity,
-					ServiceAccountName: role.ServiceAccountName,
-					Containers: []v1.Container{
+					Affinity:           generateAffinity(cr, role),
+					Tolerations:        generateTolerations(role),
+					NodeSelector:       role.NodeSelector,
+					ServiceAccountName: serviceAccountName,
+					PriorityClassName:  role.PriorityClassName,
+					RuntimeClassName:   runtimeClassName(role),
+					ImagePullSecrets:   generateImagePullSecrets(role),
+					SecurityContext:    podSecurityContext(role),
+					ReadinessGates: []v1.PodReadinessGate{
+						{
+							ConditionType: v1.PodConditionType(MemberConfiguredCondition),
+						},
+					},
+					Containers: append([]v1.Container{
 						{
 							Name:            AppContainerName,
 							Image:           imageID,
+							ImagePullPolicy: imagePullPolicy(role),
 							Resources:       role.Resources,
-							Lifecycle:       &v1.Lifecycle{PostStart: &startupScript},
+							Lifecycle:       lifecycle,
 							Ports:           endpointPorts,
 							VolumeMounts:    volumeMounts,
 							VolumeDevices:   volumeDevices,
 							SecurityContext: securityContext,
-							Env:             chkModifyEnvVars(role, setupInfo),
+							Env:             envVars,
+							EnvFrom:         generateEnvFrom(role),
 							TTY:             hasTTY(cr, role.Name),
 							Stdin:           hasSTDIN(cr, role.Name),
+							ReadinessProbe:  readinessProbe,
+							LivenessProbe:   livenessProbe,
+							StartupProbe:    startupProbe,
 						},
-					},
+					}, append(sidecars, setupContainers...)...),
 					Volumes: volumes,
 				},
 			},
@@ -462,8 +1031,28 @@ func getStatefulset(
 		},
 	}
 
+	sset.Spec.Template.Spec.TopologySpreadConstraints = generateTopologySpread(cr, role)
+	sset.Spec.Template.Spec.TerminationGracePeriodSeconds = terminationGracePeriod(cr, role)
+	if shellless {
+		sset.Spec.Template.Spec.DNSConfig = getDNSConfig(cr, role)
+	}
+
+	blockPrepErr := applyBlockDevicePrep(cr, role, imageID, &sset.Spec.Template.Spec)
+	if blockPrepErr != nil {
+		return nil, blockPrepErr
+	}
+
+	// This also decides whether the pod shares its process namespace.
+	debugErr := applyDebugMode(cr, role, &sset.Spec.Template.Spec)
+	if debugErr != nil {
+		return nil, debugErr
+	}
+
+	// A role being re-created under a changed naming scheme gets a new
+	// name, rather than that of the statefulset it replaces.
 	namingScheme := *cr.Spec.NamingScheme
-	if (roleStatus == nil) || (roleStatus.StatefulSet == "") {
+	if (roleStatus == nil) || (roleStatus.StatefulSet == "") ||
+		(roleStatus.StatefulSet == roleStatus.PreviousStatefulSet) {
 		if namingScheme == v1beta1.CrNameRole {
 			sset.ObjectMeta.GenerateName = MungObjectName(cr.Name + "-" + role.Name)
 			sset.ObjectMeta.GenerateName += "-"
@@ -521,6 +1110,123 @@ func chkModifyEnvVars(
 	return
 }
 
+// generateEnvFrom returns the sources (secrets or configmaps) whose keys are
+// all set as env vars in the containers of the given role. The list is
+// copied so that the generated container never shares it with the role
+// spec.
+func generateEnvFrom(
+	role *kdv1.Role,
+) []v1.EnvFromSource {
+
+	if len(role.EnvFrom) == 0 {
+		return nil
+	}
+	result := make([]v1.EnvFromSource, len(role.EnvFrom))
+	for i := range role.EnvFrom {
+		role.EnvFrom[i].DeepCopyInto(&result[i])
+	}
+	return result
+}
+
+// generateRequiredEnv returns the env vars that bind the app's
+// secret-backed required env vars to the keys of the cluster's envSecret,
+// for those that the role does not set itself.
+func generateRequiredEnv(
+	cr *kdv1.KubeDirectorCluster,
+	role *kdv1.Role,
+) ([]v1.EnvVar, error) {
+
+	if cr.Spec.EnvSecret == nil {
+		return nil, nil
+	}
+	requiredEnv, requiredErr := catalog.RequiredEnvForRole(cr, role.Name)
+	if requiredErr != nil {
+		return nil, requiredErr
+	}
+	var result []v1.EnvVar
+	for _, required := range requiredEnv {
+		if required.SecretKey == "" {
+			continue
+		}
+		if roleSetsEnvVar(role, required.Name) {
+			continue
+		}
+		result = append(
+			result,
+			v1.EnvVar{
+				Name: required.Name,
+				ValueFrom: &v1.EnvVarSource{
+					SecretKeyRef: &v1.SecretKeySelector{
+						LocalObjectReference: v1.LocalObjectReference{
+							Name: *cr.Spec.EnvSecret,
+						},
+						Key: required.SecretKey,
+					},
+				},
+			},
+		)
+	}
+	return result, nil
+}
+
+// roleSetsEnvVar reports whether the role's env includes the named
+// variable.
+func roleSetsEnvVar(
+	role *kdv1.Role,
+	name string,
+) bool {
+
+	for _, envVar := range role.EnvVars {
+		if envVar.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// generateImagePullSecrets returns the image pull secrets for the member
+// pods of the given role: those named by the role, or else the defaults
+// from the KubeDirectorConfig.
+func generateImagePullSecrets(
+	role *kdv1.Role,
+) []v1.LocalObjectReference {
+
+	if len(role.ImagePullSecrets) != 0 {
+		return role.ImagePullSecrets
+	}
+	var result []v1.LocalObjectReference
+	for _, secretName := range shared.GetDefaultImagePullSecrets() {
+		result = append(result, v1.LocalObjectReference{Name: secretName})
+	}
+	return result
+}
+
+// podSecurityContext returns the security context for the member pods of
+// the given role: the role's own, or else the default from the
+// KubeDirectorConfig. A role's context replaces the default as a whole.
+func podSecurityContext(
+	role *kdv1.Role,
+) *v1.PodSecurityContext {
+
+	if role.PodSecurityContext != nil {
+		return role.PodSecurityContext
+	}
+	return shared.GetDefaultPodSecurityContext()
+}
+
+// imagePullPolicy returns the pull policy for the containers that run the
+// app's images in the given role: the role's own policy, or else the
+// default from the KubeDirectorConfig. Emptystring leaves the choice to K8s.
+func imagePullPolicy(
+	role *kdv1.Role,
+) v1.PullPolicy {
+
+	if role.ImagePullPolicy != "" {
+		return role.ImagePullPolicy
+	}
+	return v1.PullPolicy(shared.GetDefaultImagePullPolicy())
+}
+
 // getInitContainer prepares the init container spec to be used with the
 // given role (for initializing the directory content placed on shared
 // persistent storage). The result will be empty if the role does not use
@@ -531,6 +1237,7 @@ func getInitContainer(
 	pvcNamePrefix string,
 	imageID string,
 	persistDirs []string,
+	persistExcludes []string,
 ) (initContainer []v1.Container) {
 
 	// We are depending on the default value of 0 here. Not setting it
@@ -541,28 +1248,89 @@ func getInitContainer(
 		return
 	}
 
+	resources := role.Resources
+	securityContext := &v1.SecurityContext{
+		RunAsUser: &rootUID,
+	}
+	for _, override := range initContainerOverrides(cr) {
+		if override.Resources != nil {
+			resources = *override.Resources
+		}
+		if override.SecurityContext != nil {
+			securityContext = override.SecurityContext
+		}
+	}
+
 	initVolumeMounts := generateInitVolumeMounts(pvcNamePrefix)
 	initContainer = []v1.Container{
 		{
 			Args: []string{
 				"-c",
-				generateInitContainerLaunch(persistDirs),
+				generateInitContainerLaunch(persistDirs, persistExcludes),
 			},
 			Command: []string{
 				"/bin/bash",
 			},
-			Image:     imageID,
-			Name:      initContainerName,
-			Resources: role.Resources,
-			SecurityContext: &v1.SecurityContext{
-				RunAsUser: &rootUID,
-			},
-			VolumeMounts: initVolumeMounts,
+			Image:           initContainerImage(cr, imageID),
+			ImagePullPolicy: imagePullPolicy(role),
+			Name:            initContainerName,
+			Resources:       resources,
+			SecurityContext: securityContext,
+			VolumeMounts:    initVolumeMounts,
 		},
 	}
 	return
 }
 
+// initContainerOverrides returns the init container settings that apply
+// to the given cluster, in increasing order of precedence: the defaults
+// from the KubeDirectorConfig, then those of the cluster spec. Each
+// setting present in a later element replaces the same setting from an
+// earlier one.
+func initContainerOverrides(
+	cr *kdv1.KubeDirectorCluster,
+) []*kdv1.InitContainerConfig {
+
+	var result []*kdv1.InitContainerConfig
+	if defaults := shared.GetDefaultInitContainer(); defaults != nil {
+		result = append(result, defaults)
+	}
+	if cr.Spec.InitContainer != nil {
+		result = append(result, cr.Spec.InitContainer)
+	}
+	return result
+}
+
+// initContainerImage returns the image for the init container of the given
+// cluster's members: an overriding image if one is set, otherwise the given
+// app image.
+func initContainerImage(
+	cr *kdv1.KubeDirectorCluster,
+	appImage string,
+) string {
+
+	image := appImage
+	for _, override := range initContainerOverrides(cr) {
+		if override.Image != nil {
+			image = *override.Image
+		}
+	}
+	return image
+}
+
+// claimTemplateMeta generates the metadata of a PVC template for the given
+// role, with the role's pvcLabels and pvcAnnotations and the record of
+// their keys.
+func claimTemplateMeta(
+	name string,
+	role *kdv1.Role,
+) metav1.ObjectMeta {
+
+	objMeta := metav1.ObjectMeta{Name: name}
+	applyPVCMetadata(&objMeta, role)
+	return objMeta
+}
+
 // getVolumeClaimTemplate prepares the PVC templates to be used with the
 // given role (for acquiring shared persistent storage). The result will be
 // empty if the role does not use shared persistent storage. If the spec contains
@@ -577,13 +1345,9 @@ func getVolumeClaimTemplate(
 	if role.Storage != nil {
 		volSize, _ := resource.ParseQuantity(role.Storage.Size)
 		volClaim := v1.PersistentVolumeClaim{
-			ObjectMeta: metav1.ObjectMeta{
-				Name: pvcNamePrefix,
-			},
+			ObjectMeta: claimTemplateMeta(pvcNamePrefix, role),
 			Spec: v1.PersistentVolumeClaimSpec{
-				AccessModes: []v1.PersistentVolumeAccessMode{
-					v1.ReadWriteOnce,
-				},
+				AccessModes: claimAccessModes(role.Storage.AccessModes),
 				Resources: v1.ResourceRequirements{
 					Requests: v1.ResourceList{
 						v1.ResourceStorage: volSize,
@@ -613,13 +1377,9 @@ func getVolumeClaimTemplate(
 			deviceName := blockPvcNamePrefix + deviceID
 
 			blockClaim := v1.PersistentVolumeClaim{
-				ObjectMeta: metav1.ObjectMeta{
-					Name: deviceName,
-				},
+				ObjectMeta: claimTemplateMeta(deviceName, role),
 				Spec: v1.PersistentVolumeClaimSpec{
-					AccessModes: []v1.PersistentVolumeAccessMode{
-						v1.ReadWriteOnce,
-					},
+					AccessModes: claimAccessModes(role.BlockStorage.AccessModes),
 					Resources: v1.ResourceRequirements{
 						Requests: v1.ResourceList{
 							v1.ResourceStorage: blockVolSize,
@@ -637,13 +1397,76 @@ func getVolumeClaimTemplate(
 	return volTemplate
 }
 
+// runtimeClassName returns the runtime class for the member pods of the
+// given role, or nil to use the K8s default.
+func runtimeClassName(
+	role *kdv1.Role,
+) *string {
+
+	if role.RuntimeClassName == "" {
+		return nil
+	}
+	name := role.RuntimeClassName
+	return &name
+}
+
+// claimAccessModes returns the access modes for a PVC template: the ones
+// given in the role spec, or ReadWriteOnce if none are.
+func claimAccessModes(
+	modes []string,
+) []v1.PersistentVolumeAccessMode {
+
+	if len(modes) == 0 {
+		return []v1.PersistentVolumeAccessMode{v1.ReadWriteOnce}
+	}
+	result := make([]v1.PersistentVolumeAccessMode, 0, len(modes))
+	for _, mode := range modes {
+		result = append(result, v1.PersistentVolumeAccessMode(mode))
+	}
+	return result
+}
+
+// memberServiceName returns the name of the headless service that governs
+// the statefulset of the given role, and so provides the DNS subdomain of
+// its members: the role's own headless service if it asks for one,
+// otherwise the cluster's.
+func memberServiceName(
+	cr *kdv1.KubeDirectorCluster,
+	role *kdv1.Role,
+) string {
+
+	if role.RoleSubdomain {
+		return RoleSubdomainServiceName(cr, role)
+	}
+	return cr.Status.ClusterService
+}
+
+// searchSubdomains returns the headless service names to add, in order, to
+// the DNS search list of the given role's members: the role's own subdomain
+// if it has one, and the cluster's.
+func searchSubdomains(
+	cr *kdv1.KubeDirectorCluster,
+	role *kdv1.Role,
+) []string {
+
+	if role.RoleSubdomain {
+		return []string{RoleSubdomainServiceName(cr, role), cr.Status.ClusterService}
+	}
+	return []string{cr.Status.ClusterService}
+}
+
 // getStartupScript composes the startup script used for each app container.
-// Currently this adds the virtual cluster's DNS subdomain to the resolv.conf
-// search list.
+// Currently this adds the virtual cluster's DNS subdomain (and the role's,
+// if it has its own) to the resolv.conf search list.
 func getStartupScript(
 	cr *kdv1.KubeDirectorCluster,
+	role *kdv1.Role,
 ) v1.Handler {
 
+	var searches []string
+	for _, subdomain := range searchSubdomains(cr, role) {
+		searches = append(searches, subdomain+".\\1")
+	}
 	return v1.Handler{
 		Exec: &v1.ExecAction{
 			Command: []string{
@@ -653,8 +1476,8 @@ func getStartupScript(
 					"Retries=60; while [[ $Retries && ! -s /etc/resolv.conf ]]; do " +
 					"sleep 1; Retries=$(expr $Retries - 1); done; " +
 					"sed \"s/^search \\([^ ]\\+\\)/search " +
-					cr.Status.ClusterService +
-					".\\1 \\1/\" /etc/resolv.conf > /tmp/resolv.conf.new && " +
+					strings.Join(searches, " ") +
+					" \\1/\" /etc/resolv.conf > /tmp/resolv.conf.new && " +
 					"cat /tmp/resolv.conf.new > /etc/resolv.conf;" +
 					"rm -f /tmp/resolv.conf.new;" +
 					"chmod 755 /run;" +
@@ -664,6 +1487,24 @@ func getStartupScript(
 	}
 }
 
+// getDNSConfig composes the pod DNS config used in place of the startup
+// script for apps whose images have no shell. The virtual cluster's DNS
+// subdomain (and the role's, if it has its own) is added to the resolv.conf
+// search list.
+func getDNSConfig(
+	cr *kdv1.KubeDirectorCluster,
+	role *kdv1.Role,
+) *v1.PodDNSConfig {
+
+	var searches []string
+	for _, subdomain := range searchSubdomains(cr, role) {
+		searches = append(searches, subdomain+"."+cr.Namespace+shared.GetSvcClusterDomainBase())
+	}
+	return &v1.PodDNSConfig{
+		Searches: searches,
+	}
+}
+
 // genrateRsyncInstalledCmd checks if the rsync command is available.
 // If rsync is installed and all the options are available
 // the RSYNC_CHECK_STATUS variable will be 0.
@@ -681,18 +1522,26 @@ func genrateRsyncInstalledCmd() string {
 }
 
 // generateRsyncCmd generates command that will do copying with rsync
-// The progress will be stored in a file.
+// The progress will be stored in a file. Files matching any of the
+// persistExcludes patterns are not copied.
 func generateRsyncCmd(
 	persistDirs []string,
+	persistExcludes []string,
 ) string {
 
 	// The directory should be created in /mnt in advance,
 	// otherwise the rsync log file will not be created
 	createRsyncLogFileBaseDir := fmt.Sprintf("mkdir -p /mnt%s", filepath.Dir(kubedirectorInitLogs))
 
-	rsyncCmd := fmt.Sprintf("%s; rsync --log-file=/mnt%s --info=progress2 --relative -ax %s /mnt > /mnt%s;",
+	excludeOpts := ""
+	for _, pattern := range persistExcludes {
+		excludeOpts += " --exclude=" + shared.ShellQuote(pattern)
+	}
+
+	rsyncCmd := fmt.Sprintf("%s; rsync --log-file=/mnt%s --info=progress2 --relative -ax%s %s /mnt > /mnt%s;",
 		createRsyncLogFileBaseDir,
 		kubedirectorInitLogs,
+		excludeOpts,
 		strings.Join(persistDirs, " "),
 		kubedirectorInitProgressBar)
 
@@ -700,13 +1549,46 @@ func generateRsyncCmd(
 }
 
 // generateCpCmd generates command that will do copying with cp
-// No way to display progress
+// No way to display progress. Since cp cannot skip files, anything matching
+// the persistExcludes patterns is removed from /mnt after the copy. The
+// rsync pattern rules are approximated with find: a pattern starting with
+// "/" is matched against the full path, one containing some other "/"
+// against the end of the path, and any other against the file name.
 func generateCpCmd(
 	persistDirs []string,
+	persistExcludes []string,
 ) string {
 
 	cpCmd := fmt.Sprintf("cp --parent -ax %s /mnt", strings.Join(persistDirs, " "))
-	return cpCmd
+	if len(persistExcludes) == 0 {
+		return cpCmd
+	}
+
+	mntDirs := make([]string, 0, len(persistDirs))
+	for _, dir := range persistDirs {
+		mntDirs = append(mntDirs, "/mnt"+dir)
+	}
+	matches := make([]string, 0, len(persistExcludes))
+	for _, pattern := range persistExcludes {
+		match := ""
+		if strings.HasSuffix(pattern, "/") {
+			// rsync only matches directories with such a pattern.
+			match = "-type d "
+			pattern = strings.TrimRight(pattern, "/")
+		}
+		if strings.HasPrefix(pattern, "/") {
+			match += "-path " + shared.ShellQuote("/mnt"+pattern)
+		} else if strings.Contains(pattern, "/") {
+			match += "-path " + shared.ShellQuote("*/"+pattern)
+		} else {
+			match += "-name " + shared.ShellQuote(pattern)
+		}
+		matches = append(matches, match)
+	}
+	return fmt.Sprintf("%s && find %s \\( %s \\) -prune -exec rm -rf {} +",
+		cpCmd,
+		strings.Join(mntDirs, " "),
+		strings.Join(matches, " -o "))
 }
 
 // generateInitContainerLaunch generates the container entrypoint command for
@@ -715,6 +1597,7 @@ func generateCpCmd(
 // container filesystem, then terminate the container.
 func generateInitContainerLaunch(
 	persistDirs []string,
+	persistExcludes []string,
 ) string {
 
 	// To be safe in the case that this container is restarted by someone,
@@ -727,16 +1610,50 @@ func generateInitContainerLaunch(
 	rsyncInstalled := genrateRsyncInstalledCmd()
 
 	// If the rsync command is not available the cp command will be used.
-	fullCmd := fmt.Sprintf("%s %s && ( [ ${RSYNC_CHECK_STATUS} != 0 ] && (%s) || (%s)); touch /mnt%s;",
+	// Once the copy is done its summary is written as the termination
+	// message of the container.
+	fullCmd := fmt.Sprintf("%s %s && { KD_INIT_START=$(date +%%s); ( [ ${RSYNC_CHECK_STATUS} != 0 ] && (%s) || (%s)); %s }; touch /mnt%s;",
 		rsyncInstalled,
 		copyCondition,
-		generateCpCmd(persistDirs),
-		generateRsyncCmd(persistDirs),
+		generateCpCmd(persistDirs, persistExcludes),
+		generateRsyncCmd(persistDirs, persistExcludes),
+		generateInitSummaryCmd(),
 		kubedirectorInit)
 
 	return fullCmd
 }
 
+// generateInitSummaryCmd generates the command, run right after the copy in
+// the init container, that writes a summary of the copy to the termination
+// message of the container as "key=value" lines: the method, exit code, and
+// duration of the copy, the final rsync progress line, and the tail of the
+// rsync log. If the copy succeeded, the rsync log and progress files are
+// then removed from the persistent storage.
+func generateInitSummaryCmd() string {
+
+	logFile := "/mnt" + kubedirectorInitLogs
+	progressFile := "/mnt" + kubedirectorInitProgressBar
+	cut := fmt.Sprintf("cut -c1-%d", initSummaryLineMax)
+	return fmt.Sprintf("KD_INIT_STATUS=$?; "+
+		"KD_INIT_METHOD=rsync; [ ${RSYNC_CHECK_STATUS} != 0 ] && KD_INIT_METHOD=cp; "+
+		"{ echo \"%[1]s=${KD_INIT_METHOD}\"; "+
+		"echo \"%[2]s=${KD_INIT_STATUS}\"; "+
+		"echo \"%[3]s=$(( $(date +%%s) - KD_INIT_START ))\"; "+
+		"[ -f %[6]s ] && tr '\\r' '\\n' < %[6]s | grep -v '^ *$' | tail -n 1 | %[8]s | sed 's/^ */%[4]s=/'; "+
+		"[ -f %[7]s ] && tail -n %[9]d %[7]s | %[8]s | sed 's/^/%[5]s=/'; "+
+		"} > /dev/termination-log 2>/dev/null; "+
+		"[ ${KD_INIT_STATUS} = 0 ] && rm -f %[7]s %[6]s;",
+		initSummaryMethod,
+		initSummaryExitCode,
+		initSummarySeconds,
+		initSummaryProgress,
+		initSummaryLog,
+		progressFile,
+		logFile,
+		cut,
+		initLogTailLines)
+}
+
 // generateSecretVolume generates VolumeMount and Volume
 // object for mounting a secret into a container
 func generateSecretVolume(
@@ -768,6 +1685,44 @@ func generateSecretVolume(
 
 }
 
+// generateConfigMapVolumes generates VolumeMount and Volume objects for
+// mounting each of the given configmaps into a container
+func generateConfigMapVolumes(
+	configMaps []kdv1.KDConfigMap,
+) ([]v1.VolumeMount, []v1.Volume) {
+
+	var volumeMounts []v1.VolumeMount
+	var volumes []v1.Volume
+	for i, configMap := range configMaps {
+		// The configmap name may be too long for a volume name, so use
+		// the index instead.
+		volName := "configmap-vol-" + strconv.Itoa(i)
+		volumeMounts = append(
+			volumeMounts,
+			v1.VolumeMount{
+				Name:      volName,
+				MountPath: configMap.MountPath,
+				ReadOnly:  configMap.ReadOnly,
+			},
+		)
+		volumes = append(
+			volumes,
+			v1.Volume{
+				Name: volName,
+				VolumeSource: v1.VolumeSource{
+					ConfigMap: &v1.ConfigMapVolumeSource{
+						LocalObjectReference: v1.LocalObjectReference{
+							Name: configMap.Name,
+						},
+						DefaultMode: configMap.DefaultMode,
+					},
+				},
+			},
+		)
+	}
+	return volumeMounts, volumes
+}
+
 // generateVolumeProjectionMounts generates VolumeMount and Volume
 // object for mounting volumeProjections
 func generateVolumeProjectionMounts(
@@ -794,8 +1749,6 @@ func generateVolumeProjectionMounts(
 				},
 			},
 		}
-	return []v1.VolumeMount{}, []v1.Volume{}
-
 }
 
 // generateVolumeMounts generates all of an app container's volume and mount
@@ -803,7 +1756,7 @@ func generateVolumeProjectionMounts(
 // appropriate for members of the given role. For systemctl support,
 // nativeSystemdSupport flag is examined along with the app requirement.
 // Additionally generate volume mount spec if a role has
-// requested for volume projections.
+// requested for secrets, configmaps, or volume projections.
 func generateVolumeMounts(
 	cr *kdv1.KubeDirectorCluster,
 	role *kdv1.Role,
@@ -827,6 +1780,16 @@ func generateVolumeMounts(
 	volumeMounts = append(volumeMounts, secretVolMnts...)
 	volumes = append(volumes, secretVols...)
 
+	// Generate configmap volumes (if any)
+	configMapVolMnts, configMapVols := generateConfigMapVolumes(role.ConfigMaps)
+	volumeMounts = append(volumeMounts, configMapVolMnts...)
+	volumes = append(volumes, configMapVols...)
+
+	// Generate the downward API volume (if requested)
+	podInfoVolMnts, podInfoVols := generatePodInfoVolume(role)
+	volumeMounts = append(volumeMounts, podInfoVolMnts...)
+	volumes = append(volumes, podInfoVols...)
+
 	// Generate volume projections (if any)
 	numVolumes := len(role.VolumeProjections)
 	for i := 0; i < numVolumes; i++ {
@@ -982,6 +1945,111 @@ func generateTmpfsSupport(
 	return volumeMounts, volumes
 }
 
+// generateAffinity returns the role's affinity, plus (if the global config
+// asks for it) a preferred anti-affinity term that keeps members away from
+// members of other clusters of the same app.
+func generateAffinity(
+	cr *kdv1.KubeDirectorCluster,
+	role *kdv1.Role,
+) *v1.Affinity {
+
+	policy := shared.GetAppAntiAffinity()
+	if (policy == nil) || !shared.StringInList(cr.Spec.AppID, policy.Apps) {
+		return role.Affinity
+	}
+	matchLabels := map[string]string{
+		ClusterAppLabel: cr.Spec.AppID,
+	}
+	if len(policy.Roles) != 0 {
+		if !shared.StringInList(role.Name, policy.Roles) {
+			return role.Affinity
+		}
+		matchLabels[ClusterRoleLabel] = role.Name
+	}
+	weight := defaultAppAntiAffinityWeight
+	if policy.Weight != nil {
+		weight = *policy.Weight
+	}
+	topologyKey := v1.LabelHostname
+	if policy.TopologyKey != nil {
+		topologyKey = *policy.TopologyKey
+	}
+	term := v1.WeightedPodAffinityTerm{
+		Weight: weight,
+		PodAffinityTerm: v1.PodAffinityTerm{
+			LabelSelector: &metav1.LabelSelector{
+				MatchLabels: matchLabels,
+				MatchExpressions: []metav1.LabelSelectorRequirement{
+					{
+						Key:      shared.ClusterLabel,
+						Operator: metav1.LabelSelectorOpNotIn,
+						Values:   []string{cr.Name},
+					},
+				},
+			},
+			TopologyKey: topologyKey,
+		},
+	}
+
+	affinity := &v1.Affinity{}
+	if role.Affinity != nil {
+		affinity = role.Affinity.DeepCopy()
+	}
+	if affinity.PodAntiAffinity == nil {
+		affinity.PodAntiAffinity = &v1.PodAntiAffinity{}
+	}
+	affinity.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution = append(
+		affinity.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution,
+		term,
+	)
+	return affinity
+}
+
+// generateTopologySpread returns the topology spread constraints for the
+// members of a role. Constraints from the role spec are used if present,
+// otherwise constraints are generated from the global config's automatic
+// spread policy (if any). Any constraint without a label selector is given
+// one that matches exactly the members of this role.
+func generateTopologySpread(
+	cr *kdv1.KubeDirectorCluster,
+	role *kdv1.Role,
+) []v1.TopologySpreadConstraint {
+
+	var constraints []v1.TopologySpreadConstraint
+	if len(role.TopologySpread) != 0 {
+		for _, c := range role.TopologySpread {
+			constraints = append(constraints, *c.DeepCopy())
+		}
+	} else {
+		policy := shared.GetAutoTopologySpread()
+		if policy == nil {
+			return nil
+		}
+		maxSkew := defaultAutoTopologySpreadSkew
+		if policy.MaxSkew != nil {
+			maxSkew = *policy.MaxSkew
+		}
+		for _, key := range policy.TopologyKeys {
+			constraints = append(
+				constraints,
+				v1.TopologySpreadConstraint{
+					MaxSkew:           maxSkew,
+					TopologyKey:       key,
+					WhenUnsatisfiable: v1.ScheduleAnyway,
+				},
+			)
+		}
+	}
+	for i := range constraints {
+		if constraints[i].LabelSelector == nil {
+			constraints[i].LabelSelector = &metav1.LabelSelector{
+				MatchLabels: labelsForRole(cr, role),
+			}
+		}
+	}
+	return constraints
+}
+
 // generateSecurityContext creates security context with Add Capabilities property
 // based on app's capability list. If app doesn't require additional capabilities
 // return nil
@@ -1036,3 +2104,68 @@ func hasTTY(
 
 	return containerSpec.Tty
 }
+
+// rolePreStop returns the preStop hook for the role's app container, or nil
+// if neither the cluster role nor the app asks for one. A command set in the
+// cluster role replaces the app's.
+func rolePreStop(
+	cr *kdv1.KubeDirectorCluster,
+	role *kdv1.Role,
+) *v1.Handler {
+
+	command := role.PreStop
+	if len(command) == 0 {
+		containerSpec, _ := catalog.RoleContainerSpecs(cr, role.Name)
+		if containerSpec != nil {
+			command = containerSpec.PreStop
+		}
+	}
+	if len(command) == 0 {
+		return nil
+	}
+	return &v1.Handler{
+		Exec: &v1.ExecAction{
+			Command: append([]string{}, command...),
+		},
+	}
+}
+
+// terminationGracePeriod returns how long the role's members are given to
+// shut down, or nil to use the K8s default. A value set in the cluster role
+// replaces the app's.
+func terminationGracePeriod(
+	cr *kdv1.KubeDirectorCluster,
+	role *kdv1.Role,
+) *int64 {
+
+	seconds := role.TerminationGracePeriodSeconds
+	if seconds == nil {
+		containerSpec, _ := catalog.RoleContainerSpecs(cr, role.Name)
+		if containerSpec != nil {
+			seconds = containerSpec.TerminationGracePeriodSeconds
+		}
+	}
+	if seconds == nil {
+		return nil
+	}
+	result := *seconds
+	return &result
+}
+
+// roleProbes is a utility function to fetch any readiness, liveness, and
+// startup probes requested by the KubeDirectorApp for the role's app
+// container. Each is nil if not requested.
+func roleProbes(
+	cr *kdv1.KubeDirectorCluster,
+	role string,
+) (*v1.Probe, *v1.Probe, *v1.Probe) {
+
+	containerSpec, _ := catalog.RoleContainerSpecs(cr, role)
+	if containerSpec == nil {
+		return nil, nil, nil
+	}
+
+	return containerSpec.ReadinessProbe.DeepCopy(),
+		containerSpec.LivenessProbe.DeepCopy(),
+		containerSpec.StartupProbe.DeepCopy()
+}
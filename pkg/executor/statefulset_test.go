@@ -0,0 +1,149 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package executor
+
+import (
+	"testing"
+
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// testTemplate returns a member pod template with init, app, and setup
+// containers using the "old" images, and the given readiness gates.
+func testTemplate(
+	gates []v1.PodReadinessGate,
+) *v1.PodTemplateSpec {
+
+	return &v1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels: map[string]string{"a": "1", "b": "2"},
+		},
+		Spec: v1.PodSpec{
+			InitContainers: []v1.Container{
+				{Name: initContainerName, Image: "old-app"},
+			},
+			Containers: []v1.Container{
+				{Name: AppContainerName, Image: "old-app"},
+				{Name: SetupContainerName, Image: "old-setup"},
+			},
+			ReadinessGates: gates,
+		},
+	}
+}
+
+func TestPodTemplateHash(t *testing.T) {
+
+	base := PodTemplateHash(testTemplate(nil))
+	if len(base) != podTemplateHashLength {
+		t.Errorf("hash %q: got length %d, want %d", base, len(base), podTemplateHashLength)
+	}
+
+	reordered := testTemplate(nil)
+	reordered.Labels = map[string]string{"b": "2", "a": "1"}
+	newImage := testTemplate(nil)
+	newImage.Spec.Containers[0].Image = "new-app"
+	newLabel := testTemplate(nil)
+	newLabel.Labels["c"] = "3"
+
+	tests := []struct {
+		name     string
+		template *v1.PodTemplateSpec
+		wantSame bool
+	}{
+		{"same template", testTemplate(nil), true},
+		{"reordered labels", reordered, true},
+		{"changed image", newImage, false},
+		{"added label", newLabel, false},
+	}
+	for _, test := range tests {
+		got := PodTemplateHash(test.template)
+		if (got == base) != test.wantSame {
+			t.Errorf("%s: got hash %s against %s, want same %v", test.name, got, base, test.wantSame)
+		}
+	}
+}
+
+func TestSetTemplateImages(t *testing.T) {
+
+	configured := v1.PodReadinessGate{
+		ConditionType: v1.PodConditionType(MemberConfiguredCondition),
+	}
+	other := v1.PodReadinessGate{ConditionType: "example.com/other"}
+	overrideImage := "init-override"
+
+	tests := []struct {
+		name          string
+		initContainer *kdv1.InitContainerConfig
+		gates         []v1.PodReadinessGate
+		wantInit      string
+		wantGates     []v1.PodReadinessGate
+	}{
+		{
+			"gate added",
+			nil,
+			nil,
+			"new-app",
+			[]v1.PodReadinessGate{configured},
+		},
+		{
+			"gate added after others",
+			nil,
+			[]v1.PodReadinessGate{other},
+			"new-app",
+			[]v1.PodReadinessGate{other, configured},
+		},
+		{
+			"gate kept",
+			nil,
+			[]v1.PodReadinessGate{configured},
+			"new-app",
+			[]v1.PodReadinessGate{configured},
+		},
+		{
+			"init image overridden",
+			&kdv1.InitContainerConfig{Image: &overrideImage},
+			[]v1.PodReadinessGate{configured},
+			overrideImage,
+			[]v1.PodReadinessGate{configured},
+		},
+	}
+	for _, test := range tests {
+		cr := &kdv1.KubeDirectorCluster{}
+		cr.Spec.InitContainer = test.initContainer
+		template := testTemplate(test.gates)
+		setTemplateImages(cr, template, "new-app", "new-setup")
+		podSpec := template.Spec
+		if got := podSpec.InitContainers[0].Image; got != test.wantInit {
+			t.Errorf("%s: got init image %s, want %s", test.name, got, test.wantInit)
+		}
+		if got := podSpec.Containers[0].Image; got != "new-app" {
+			t.Errorf("%s: got app image %s, want new-app", test.name, got)
+		}
+		if got := podSpec.Containers[1].Image; got != "new-setup" {
+			t.Errorf("%s: got setup image %s, want new-setup", test.name, got)
+		}
+		if len(podSpec.ReadinessGates) != len(test.wantGates) {
+			t.Errorf("%s: got gates %v, want %v", test.name, podSpec.ReadinessGates, test.wantGates)
+			continue
+		}
+		for i := range test.wantGates {
+			if podSpec.ReadinessGates[i] != test.wantGates[i] {
+				t.Errorf("%s: got gates %v, want %v", test.name, podSpec.ReadinessGates, test.wantGates)
+			}
+		}
+	}
+}
@@ -38,10 +38,84 @@ const (
 	// statefulset, pod, and service, with a value of the KubeDirectorApp's
 	// spec.label.name.
 	ClusterAppAnnotation = shared.KdDomainBase + "/kdapp-prettyName"
+	// ServiceAnnotationKeysAnnotation is placed on every created member
+	// service, listing the keys of the annotations that KubeDirector
+	// manages on that service, so that annotations removed from the spec
+	// can be removed from the service.
+	ServiceAnnotationKeysAnnotation = shared.KdDomainBase + "/managedAnnotations"
+
+	// PropagatedLabelKeysAnnotation is placed on member pods and services
+	// that have labels propagated from the cluster CR, listing the keys of
+	// those labels so that they can be removed if no longer propagated.
+	PropagatedLabelKeysAnnotation = shared.KdDomainBase + "/propagatedLabels"
+
+	// PVCLabelKeysAnnotation and PVCAnnotationKeysAnnotation are placed on
+	// member PVCs, listing the keys of the role's pvcLabels and
+	// pvcAnnotations that KubeDirector has set on the claim, so that ones
+	// removed from the spec can be removed from the claim.
+	PVCLabelKeysAnnotation      = shared.KdDomainBase + "/managedPVCLabels"
+	PVCAnnotationKeysAnnotation = shared.KdDomainBase + "/managedPVCAnnotations"
+
+	// TopologyModeAnnotation is the annotation through which k8s enables
+	// topology-aware routing for a service.
+	TopologyModeAnnotation = "service.kubernetes.io/topology-mode"
+
+	// TrafficDistributionAnnotation is placed on member services to record
+	// the trafficDistribution that KubeDirector last set in their spec,
+	// since that field is newer than the service API that KubeDirector
+	// builds against.
+	TrafficDistributionAnnotation = shared.KdDomainBase + "/trafficDistribution"
+
+	// PodNameEnvVar, PodNamespaceEnvVar, MemberIndexEnvVar, RoleEnvVar, and
+	// ClusterEnvVar are the env vars that tell a member about itself.
+	PodNameEnvVar      = "KD_POD_NAME"
+	PodNamespaceEnvVar = "KD_NAMESPACE"
+	MemberIndexEnvVar  = "KD_MEMBER_INDEX"
+	RoleEnvVar         = "KD_ROLE"
+	ClusterEnvVar      = "KD_CLUSTER"
+
+	// EdgeEnvVar is set to "true" in the app container of an edge role's
+	// members, telling the member agent to work from its local copy of
+	// configmeta while the node is out of contact with K8s.
+	EdgeEnvVar = "KD_EDGE"
+
+	// PodTemplateHashAnnotation is placed on every created statefulset,
+	// with the hash of the pod template that KubeDirector generated for it.
+	PodTemplateHashAnnotation = shared.KdDomainBase + "/podTemplateHash"
+
+	// MemberConfiguredCondition is the pod condition type used as a
+	// readiness gate on every member pod. KubeDirector sets it true only
+	// once the member has reached the configured (ready) state.
+	MemberConfiguredCondition = shared.KdDomainBase + "/configured"
 
 	statefulSetPodLabel = "statefulset.kubernetes.io/pod-name"
 	// AppContainerName is the name of KubeDirector app containers.
 	AppContainerName = "app"
+	// SetupContainerName is the name of the container that runs the app
+	// setup package, if the app declares a separate setup image.
+	SetupContainerName = "setup"
+	// DebugContainerName is the name of the debug sidecar added to member
+	// pods while debug mode is active.
+	DebugContainerName = "kd-debug"
+	// BlockPrepContainerName is the name of the init container that
+	// prepares the block devices of members, for apps that ask for it.
+	BlockPrepContainerName = "kd-block-prep"
+	// BlockKeyMountPath is where the LUKS key for encrypted block devices
+	// is mounted, in the block device preparation container and the app
+	// container.
+	BlockKeyMountPath = "/etc/kubedirector/blockkey"
+	// LogShipperContainerName is the name of the logging sidecar added to
+	// member pods of roles that ask for one.
+	LogShipperContainerName = "kd-log-shipper"
+	// RuntimeSidecarName is the name of the docker-in-docker sidecar added
+	// to member pods of roles that ask for one.
+	RuntimeSidecarName = "kd-dind"
+	// MultilineParserAnnotation is placed on member pods, for log agents,
+	// with the name of the app's parser for multi-line log records.
+	MultilineParserAnnotation = shared.KdDomainBase + "/multilineParser"
+	// EncryptedStorageAnnotation declares, on a storage class, whether its
+	// volumes are encrypted at rest ("true" or "false").
+	EncryptedStorageAnnotation = shared.KdDomainBase + "/encrypted"
 	// PvcNamePrefix (along with a hyphen) is prepended to the name of each
 	// member PVC name that is auto-created for a statefulset.
 	PvcNamePrefix         = "p"
@@ -60,6 +134,19 @@ const (
 	// The file that contains just a progress bar of copying persisten dirs
 	// The file is updated dynamically
 	kubedirectorInitProgressBar = "/etc/kubedirector-init-progress-bar.log"
+	// initLogTailLines is how many lines at the end of the rsync log are
+	// kept in the init container's summary of the copy, and
+	// initSummaryLineMax the length to which each summary line is cut.
+	initLogTailLines   = 5
+	initSummaryLineMax = 200
+	// initSummaryMethod, initSummaryExitCode, initSummarySeconds,
+	// initSummaryProgress, and initSummaryLog are the keys of the lines in
+	// the init container's summary of the copy.
+	initSummaryMethod   = "method"
+	initSummaryExitCode = "exitCode"
+	initSummarySeconds  = "seconds"
+	initSummaryProgress = "summary"
+	initSummaryLog      = "log"
 
 	// nvidiaGpuResourceName is the name of a GPU resource, schedulable for a container -
 	// specifically, a GPU by the vendor, NVIDIA
@@ -71,11 +158,123 @@ const (
 	// nvidiaGpuVisWorkaroundEnvVarValue is the value to be set for the environment variable
 	// named nvidiaGpuVisWorkaroundEnvVarName, in the above work-around
 	nvidiaGpuVisWorkaroundEnvVarValue = "VOID"
+	// Workload identity service accounts are named after the cluster and
+	// role, plus this suffix.
+	identitySANameSuffix = "-identity"
+	// Service account annotations recognized by the cloud providers'
+	// workload identity implementations.
+	awsRoleArnAnnotation        = "eks.amazonaws.com/role-arn"
+	awsAudienceAnnotation       = "eks.amazonaws.com/audience"
+	gcpServiceAccountAnnotation = "iam.gke.io/gcp-service-account"
+	azureClientIDAnnotation     = "azure.workload.identity/client-id"
+	azureTenantIDAnnotation     = "azure.workload.identity/tenant-id"
+	// azureUseLabel marks the pods that the Azure workload identity webhook
+	// should act on.
+	azureUseLabel = "azure.workload.identity/use"
+	// Projected token details for providers that exchange a service
+	// account token for cloud credentials inside the container.
+	identityTokenVolume           = "kd-identity-token"
+	identityTokenFile             = "token"
+	identityTokenExpiration int64 = 86400
+	awsDefaultAudience            = "sts.amazonaws.com"
+	awsTokenDir                   = "/var/run/secrets/eks.amazonaws.com/serviceaccount"
+	azureDefaultAudience          = "api://AzureADTokenExchange"
+	azureTokenDir                 = "/var/run/secrets/azure/tokens"
+	azureAuthorityHost            = "https://login.microsoftonline.com/"
+	// podTemplateHashLength is the number of hex digits kept from the
+	// pod template hash.
+	podTemplateHashLength = 16
+	// ingressClassAnnotation selects the ingress controller for a
+	// generated Ingress.
+	ingressClassAnnotation = "kubernetes.io/ingress.class"
+	// podIndexLabel is set by the statefulset controller (in K8s 1.28 and
+	// later) to the ordinal of the pod.
+	podIndexLabel = "apps.kubernetes.io/pod-index"
+	// podInfoVolumeName is the name of the downward API volume.
+	podInfoVolumeName = "kd-pod-info"
+	// certManagerGroup and certManagerAPIVersion identify the cert-manager
+	// API used for member certificates.
+	certManagerGroup      = "cert-manager.io"
+	certManagerAPIVersion = certManagerGroup + "/v1"
+	// snapshotGroup and snapshotAPIVersion identify the CSI volume snapshot
+	// API used for backups.
+	snapshotGroup      = "snapshot.storage.k8s.io"
+	snapshotAPIVersion = snapshotGroup + "/v1"
+	// defaultAppAntiAffinityWeight is the weight of the generated
+	// anti-affinity term between clusters of the same app, if the global
+	// config does not specify one.
+	defaultAppAntiAffinityWeight int32 = 50
+	// defaultAutoTopologySpreadSkew is the max skew of the generated
+	// topology spread constraints, if the global config does not specify
+	// one.
+	defaultAutoTopologySpreadSkew int32 = 1
+	// sidecarShareVolumePrefix is the prefix for the names of empty-dir
+	// volumes that share a non-persistent app directory with sidecars.
+	sidecarShareVolumePrefix = "kd-sidecar-share-"
+	// fluentBitParserAnnotation selects the fluent-bit parser for the
+	// stdout and stderr of the app container.
+	fluentBitParserAnnotation = "fluentbit.io/parser-" + AppContainerName
+	// logShipperBinary is the fluent-bit executable in the log shipper
+	// image.
+	logShipperBinary = "/fluent-bit/bin/fluent-bit"
+	// logShipperMountBase is the directory in the log shipper container
+	// below which the app's log directories are mounted.
+	logShipperMountBase = "/kd-logs"
+	// guestconfigLogDir is where setup packages keep their logs.
+	guestconfigLogDir = "/var/log/guestconfig"
+	// scratchVolumePrefix is the prefix for the names of the empty-dir
+	// volumes that provide the scratch space of a role.
+	scratchVolumePrefix = "kd-scratch-"
+	// runtimeSocketDir is where the container runtime socket is mounted in
+	// the app container. It is not below /run, which is a tmpfs in the
+	// app container when systemd is supported.
+	runtimeSocketDir = "/opt/kubedirector/runtime"
+	// runtimeSocketVolume is the name of the volume that holds the
+	// container runtime socket.
+	runtimeSocketVolume = "kd-runtime-socket"
+	// dindStorageVolume is the name of the empty-dir volume for the images
+	// and containers of the docker-in-docker sidecar.
+	dindStorageVolume = "kd-dind-storage"
+	// setupContainerIdleCmd keeps the setup container running so that
+	// setup scripts can be executed in it.
+	setupContainerIdleCmd = "trap 'exit 0' TERM; while true; do sleep 1; done"
+	// debugCapability is the extra capability given to the app container
+	// and debug sidecar while debug mode is active.
+	debugCapability = "SYS_PTRACE"
 	// defaultBlockDeviceSize is the size for a block volume if it is not specified in the spec
 	defaultBlockDeviceSize = "1Gi"
 	// blockPvcNamePrefix is the prefix name for the volume device that is auto-created by the statefulset.
 	// This is assigned in accordance with the PvcPrefix
 	blockPvcNamePrefix = "b"
+	// nodeNotReadyTaint and nodeUnreachableTaint are the taints that K8s
+	// puts on a node whose kubelet has stopped reporting.
+	nodeNotReadyTaint    = "node.kubernetes.io/not-ready"
+	nodeUnreachableTaint = "node.kubernetes.io/unreachable"
+	// defaultProbeRelaxFactor multiplies the probe timeouts and failure
+	// thresholds of an edge role if the role does not say otherwise.
+	defaultProbeRelaxFactor = 3
+	// blockKeyVolumeName is the name of the volume holding the LUKS key,
+	// and blockKeySecretKey the entry of the key secret that holds it.
+	blockKeyVolumeName = "kd-block-key"
+	blockKeySecretKey  = "key"
+	// blockPrepLabel labels each LUKS header and filesystem made by the
+	// block device preparation step.
+	blockPrepLabel = "kd-prepared"
+	// blockPrepFixedArgs is the number of arguments of the block device
+	// preparation container that precede the device paths.
+	blockPrepFixedArgs = 3
+	// renderNameSuffix stands in for the random suffix of a generated
+	// object name, when rendering objects that have not been created.
+	renderNameSuffix = "xxxxx"
+	// dashboardConfigMapSuffix forms, after the cluster name, the name of
+	// the configmap with the cluster's generated Grafana dashboard, and
+	// dashboardFolderAnnotation is the annotation from which the Grafana
+	// sidecar takes the folder to put it in.
+	dashboardConfigMapSuffix  = "-dashboard"
+	dashboardFolderAnnotation = "grafana_folder"
+	// dashboardSchemaVersion is the Grafana dashboard schema version of the
+	// generated dashboards.
+	dashboardSchemaVersion = 30
 )
 
 // Streams for stdin, stdout, stderr of executed commands
@@ -20,6 +20,7 @@ import (
 	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
 	"github.com/bluek8s/kubedirector/pkg/catalog"
 	"github.com/bluek8s/kubedirector/pkg/shared"
+	"k8s.io/apimachinery/pkg/labels"
 )
 
 // Service names size have a limitation of max 63 characters. The service
@@ -144,6 +145,16 @@ func labelsForRole(
 	return result
 }
 
+// RoleSelector returns, in string form, a label selector that matches the
+// member pods of the given role.
+func RoleSelector(
+	cr *kdv1.KubeDirectorCluster,
+	role *kdv1.Role,
+) string {
+
+	return labels.SelectorFromSet(labelsForRole(cr, role)).String()
+}
+
 // labelsForStatefulSet generates a set of resource labels appropriate for a
 // statefulset in the given role.
 func labelsForStatefulSet(
@@ -170,6 +181,11 @@ func labelsForPod(
 	for globalName, globalValue := range shared.GetPodLabels() {
 		result[globalName] = globalValue
 	}
+	// The Azure workload identity webhook only acts on labelled pods.
+	if (role.WorkloadIdentity != nil) &&
+		(role.WorkloadIdentity.Provider == kdv1.WorkloadIdentityAzure) {
+		result[azureUseLabel] = "true"
+	}
 	return result
 }
 
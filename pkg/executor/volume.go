@@ -16,11 +16,18 @@ package executor
 
 import (
 	"context"
+	"strconv"
 
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
 	"github.com/bluek8s/kubedirector/pkg/shared"
+	"github.com/go-logr/logr"
 
+	appsv1 "k8s.io/api/apps/v1"
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 )
 
 // DeletePVC deletes a persistent volume claim from k8s.
@@ -41,3 +48,251 @@ func DeletePVC(
 	}
 	return shared.Delete(context.TODO(), toDelete)
 }
+
+// ReleasePVC removes the given cluster from the owner references of a
+// persistent volume claim, so that the claim is not deleted along with the
+// cluster. A claim that does not exist is not an error.
+func ReleasePVC(
+	cr *kdv1.KubeDirectorCluster,
+	pvcName string,
+) error {
+
+	pvc := &v1.PersistentVolumeClaim{}
+	getErr := shared.Get(
+		context.TODO(),
+		types.NamespacedName{Namespace: cr.Namespace, Name: pvcName},
+		pvc,
+	)
+	if getErr != nil {
+		if errors.IsNotFound(getErr) {
+			return nil
+		}
+		return getErr
+	}
+	var keptRefs []metav1.OwnerReference
+	for _, ref := range pvc.OwnerReferences {
+		if ref.UID != cr.UID {
+			keptRefs = append(keptRefs, ref)
+		}
+	}
+	if len(keptRefs) == len(pvc.OwnerReferences) {
+		return nil
+	}
+	patchedPVC := pvc.DeepCopy()
+	patchedPVC.OwnerReferences = keptRefs
+	return shared.Patch(context.TODO(), pvc, patchedPVC)
+}
+
+// ExpandPVC requests that a persistent volume claim be grown to the given
+// size, if it does not already request at least that much. The returned
+// boolean indicates whether the claim's reported capacity has reached the
+// given size.
+func ExpandPVC(
+	namespace string,
+	pvcName string,
+	size resource.Quantity,
+) (bool, error) {
+
+	pvc := &v1.PersistentVolumeClaim{}
+	getErr := shared.Get(
+		context.TODO(),
+		types.NamespacedName{Namespace: namespace, Name: pvcName},
+		pvc,
+	)
+	if getErr != nil {
+		return false, getErr
+	}
+	requested := pvc.Spec.Resources.Requests[v1.ResourceStorage]
+	if requested.Cmp(size) < 0 {
+		patchedPVC := pvc.DeepCopy()
+		if patchedPVC.Spec.Resources.Requests == nil {
+			patchedPVC.Spec.Resources.Requests = v1.ResourceList{}
+		}
+		patchedPVC.Spec.Resources.Requests[v1.ResourceStorage] = size
+		patchErr := shared.Patch(context.TODO(), pvc, patchedPVC)
+		if patchErr != nil {
+			return false, patchErr
+		}
+		return false, nil
+	}
+	capacity, ok := pvc.Status.Capacity[v1.ResourceStorage]
+	return ok && (capacity.Cmp(size) >= 0), nil
+}
+
+// MemberBlockPVCNames returns the names of the block device claims that the
+// statefulset creates for a member of the given role.
+func MemberBlockPVCNames(
+	role *kdv1.Role,
+	podName string,
+) []string {
+
+	var result []string
+	if (role.BlockStorage == nil) || (role.BlockStorage.NumDevices == nil) {
+		return result
+	}
+	for i := int32(0); i < *role.BlockStorage.NumDevices; i++ {
+		deviceName := blockPvcNamePrefix + strconv.FormatInt(int64(i), 10)
+		result = append(result, deviceName+"-"+podName)
+	}
+	return result
+}
+
+// PVCSource returns the data source reference for a PVC that is to be
+// created as a CSI clone of the named PVC.
+func PVCSource(
+	pvcName string,
+) *v1.TypedLocalObjectReference {
+
+	return &v1.TypedLocalObjectReference{
+		Kind: "PersistentVolumeClaim",
+		Name: pvcName,
+	}
+}
+
+// CreatePVCFromSource creates the PVC that the statefulset would create for
+// a member from the named volume claim template, but with its content taken
+// from the given data source (a VolumeSnapshot or another PVC). The
+// statefulset then uses this PVC for the member instead of provisioning an
+// empty one. The requested size is raised to the given minimum size, if
+// any, when that is larger. A PVC that already exists is left alone, as is
+// a template that the statefulset does not have.
+func CreatePVCFromSource(
+	statefulSet *appsv1.StatefulSet,
+	templateName string,
+	podName string,
+	dataSource *v1.TypedLocalObjectReference,
+	minSize string,
+) error {
+
+	var template *v1.PersistentVolumeClaim
+	for i := range statefulSet.Spec.VolumeClaimTemplates {
+		if statefulSet.Spec.VolumeClaimTemplates[i].Name == templateName {
+			template = &(statefulSet.Spec.VolumeClaimTemplates[i])
+			break
+		}
+	}
+	if template == nil {
+		return nil
+	}
+	pvc := &v1.PersistentVolumeClaim{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "PersistentVolumeClaim",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        templateName + "-" + podName,
+			Namespace:   statefulSet.Namespace,
+			Labels:      make(map[string]string),
+			Annotations: template.Annotations,
+		},
+	}
+	for k, v := range template.Labels {
+		pvc.Labels[k] = v
+	}
+	for k, v := range statefulSet.Spec.Selector.MatchLabels {
+		pvc.Labels[k] = v
+	}
+	template.Spec.DeepCopyInto(&pvc.Spec)
+	if size, parseErr := resource.ParseQuantity(minSize); parseErr == nil {
+		requested := pvc.Spec.Resources.Requests[v1.ResourceStorage]
+		if requested.Cmp(size) < 0 {
+			if pvc.Spec.Resources.Requests == nil {
+				pvc.Spec.Resources.Requests = v1.ResourceList{}
+			}
+			pvc.Spec.Resources.Requests[v1.ResourceStorage] = size
+		}
+	}
+	pvc.Spec.DataSource = dataSource
+	createErr := shared.Create(context.TODO(), pvc)
+	if (createErr != nil) && !errors.IsAlreadyExists(createErr) {
+		return createErr
+	}
+	return nil
+}
+
+// UpdatePVCMetadata makes the labels and annotations that a member PVC has
+// from the role's pvcLabels and pvcAnnotations match the role spec, and
+// sets the cluster's creator label on it. Labels and annotations added by
+// anything else, such as a backup operator, are left alone. A missing owner
+// reference to the cluster is handled as for the cluster's statefulsets. A
+// claim that does not exist is not an error.
+func UpdatePVCMetadata(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorCluster,
+	role *kdv1.Role,
+	pvcName string,
+) error {
+
+	pvc := &v1.PersistentVolumeClaim{}
+	getErr := shared.Get(
+		context.TODO(),
+		types.NamespacedName{Namespace: cr.Namespace, Name: pvcName},
+		pvc,
+	)
+	if getErr != nil {
+		if errors.IsNotFound(getErr) {
+			return nil
+		}
+		return getErr
+	}
+	patchedPVC := pvc.DeepCopy()
+	changed := applyPVCMetadata(&patchedPVC.ObjectMeta, role)
+	if creator, ok := cr.Labels[shared.CreatorLabel]; ok {
+		if patchedPVC.Labels[shared.CreatorLabel] != creator {
+			patchedPVC.Labels[shared.CreatorLabel] = creator
+			changed = true
+		}
+	}
+	if !shared.OwnerReferencesPresent(cr, pvc.OwnerReferences) {
+		refs, repair := repairOwnerReferences(
+			reqLogger,
+			cr,
+			"PVC{"+pvcName+"}",
+			pvc.OwnerReferences,
+		)
+		if repair {
+			patchedPVC.OwnerReferences = refs
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	shared.LogInfof(
+		reqLogger,
+		cr,
+		shared.EventReasonNoEvent,
+		"updating metadata on PVC{%s}",
+		pvcName,
+	)
+	return shared.Patch(context.TODO(), pvc, patchedPVC)
+}
+
+// applyPVCMetadata sets the role's pvcLabels and pvcAnnotations in the given
+// claim metadata, removing any that were set before but are no longer in
+// the role spec. Returns false if nothing needed to change.
+func applyPVCMetadata(
+	objMeta *metav1.ObjectMeta,
+	role *kdv1.Role,
+) bool {
+
+	if objMeta.Labels == nil {
+		objMeta.Labels = make(map[string]string)
+	}
+	if objMeta.Annotations == nil {
+		objMeta.Annotations = make(map[string]string)
+	}
+	labelsChanged := applyManagedKeys(
+		objMeta,
+		objMeta.Labels,
+		PVCLabelKeysAnnotation,
+		role.PVCLabels,
+	)
+	annotationsChanged := applyManagedKeys(
+		objMeta,
+		objMeta.Annotations,
+		PVCAnnotationKeysAnnotation,
+		role.PVCAnnotations,
+	)
+	return labelsChanged || annotationsChanged
+}
@@ -0,0 +1,25 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package extension lets integrators add behavior to KubeDirector without
+// forking it. An extension is a Go type that implements Extension plus one
+// or more of the hook interfaces in types.go; it is registered by calling
+// Register from the init function of its package, and that package is
+// linked into the operator with a blank import in cmd/manager.
+//
+// Each hook call is isolated: a hook that returns an error, panics, or
+// runs past its time limit is reported against the virtual cluster it was
+// called for, and KubeDirector carries on as if the hook had not been
+// called.
+package extension
@@ -0,0 +1,260 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package extension
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	"github.com/bluek8s/kubedirector/pkg/shared"
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+var (
+	registryLock sync.RWMutex
+	registry     []Extension
+
+	// failures holds the most recent failure of each extension hook, for
+	// each virtual cluster, keyed by cluster UID and then by extension and
+	// hook name. An entry is removed when the same hook next succeeds for
+	// that cluster.
+	failuresLock sync.Mutex
+	failures     = make(map[types.UID]map[string]Failure)
+)
+
+// Register adds an extension to the set called at each hook point. It is
+// meant to be called from an init function; registering two extensions
+// with the same name is a programming error and panics.
+func Register(
+	ext Extension,
+) {
+
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	for _, existing := range registry {
+		if existing.Name() == ext.Name() {
+			panic(fmt.Sprintf("extension %s registered twice", ext.Name()))
+		}
+	}
+	registry = append(registry, ext)
+}
+
+// Names returns the names of the registered extensions, in registration
+// order.
+func Names() []string {
+
+	var names []string
+	for _, ext := range extensions() {
+		names = append(names, ext.Name())
+	}
+	return names
+}
+
+// PreStatefulSet calls the PreStatefulSet hook of each extension that has
+// one, in registration order, and returns the resulting statefulset. The
+// changes made by a failed hook are discarded.
+func PreStatefulSet(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorCluster,
+	role *kdv1.Role,
+	statefulSet *appsv1.StatefulSet,
+) *appsv1.StatefulSet {
+
+	result := statefulSet
+	for _, ext := range extensions() {
+		hook, ok := ext.(PreStatefulSetHook)
+		if !ok {
+			continue
+		}
+		candidate := result.DeepCopy()
+		crCopy := cr.DeepCopy()
+		roleCopy := role.DeepCopy()
+		err := call(func() error {
+			return hook.PreStatefulSet(crCopy, roleCopy, candidate)
+		})
+		if !record(reqLogger, cr, ext, HookPreStatefulSet, err) {
+			continue
+		}
+		candidate.Name = result.Name
+		candidate.GenerateName = result.GenerateName
+		candidate.Namespace = result.Namespace
+		candidate.OwnerReferences = result.OwnerReferences
+		candidate.Spec.Selector = result.Spec.Selector
+		candidate.Spec.ServiceName = result.Spec.ServiceName
+		candidate.Spec.Replicas = result.Spec.Replicas
+		result = candidate
+	}
+	return result
+}
+
+// PostMemberConfigured calls the PostMemberConfigured hook of each
+// extension that has one, in registration order.
+func PostMemberConfigured(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorCluster,
+	roleName string,
+	member *kdv1.MemberStatus,
+) {
+
+	for _, ext := range extensions() {
+		hook, ok := ext.(PostMemberConfiguredHook)
+		if !ok {
+			continue
+		}
+		crCopy := cr.DeepCopy()
+		memberCopy := member.DeepCopy()
+		err := call(func() error {
+			return hook.PostMemberConfigured(crCopy, roleName, memberCopy)
+		})
+		record(reqLogger, cr, ext, HookPostMemberConfigured, err)
+	}
+}
+
+// PreDelete calls the PreDelete hook of each extension that has one, in
+// registration order.
+func PreDelete(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorCluster,
+) {
+
+	for _, ext := range extensions() {
+		hook, ok := ext.(PreDeleteHook)
+		if !ok {
+			continue
+		}
+		crCopy := cr.DeepCopy()
+		err := call(func() error {
+			return hook.PreDelete(crCopy)
+		})
+		record(reqLogger, cr, ext, HookPreDelete, err)
+	}
+}
+
+// Failures returns the outstanding hook failures for the given virtual
+// cluster, sorted by extension and hook name.
+func Failures(
+	cr *kdv1.KubeDirectorCluster,
+) []Failure {
+
+	failuresLock.Lock()
+	defer failuresLock.Unlock()
+	var result []Failure
+	for _, failure := range failures[cr.UID] {
+		result = append(result, failure)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Extension != result[j].Extension {
+			return result[i].Extension < result[j].Extension
+		}
+		return result[i].Hook < result[j].Hook
+	})
+	return result
+}
+
+// ForgetCluster drops the recorded hook failures for a virtual cluster that
+// has been deleted.
+func ForgetCluster(
+	cr *kdv1.KubeDirectorCluster,
+) {
+
+	failuresLock.Lock()
+	defer failuresLock.Unlock()
+	delete(failures, cr.UID)
+}
+
+// extensions returns a snapshot of the registered extensions.
+func extensions() []Extension {
+
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+	return append([]Extension(nil), registry...)
+}
+
+// call runs a hook function, converting a panic into an error and giving
+// up on the hook if it does not return within hookTimeout. A hook that
+// times out is left running; its results are ignored.
+func call(
+	fn func() error,
+) error {
+
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- fmt.Errorf("panic: %v", r)
+			}
+		}()
+		done <- fn()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(hookTimeout):
+		return fmt.Errorf("timed out after %v", hookTimeout)
+	}
+}
+
+// record notes the outcome of a hook call for a virtual cluster. A failure
+// is logged, raised as an event on the cluster, counted, and remembered
+// until the same hook next succeeds. The return value is true if the hook
+// succeeded.
+func record(
+	reqLogger logr.Logger,
+	cr *kdv1.KubeDirectorCluster,
+	ext Extension,
+	hook string,
+	err error,
+) bool {
+
+	key := ext.Name() + "/" + hook
+	if err == nil {
+		failuresLock.Lock()
+		defer failuresLock.Unlock()
+		if clusterFailures, ok := failures[cr.UID]; ok {
+			delete(clusterFailures, key)
+			if len(clusterFailures) == 0 {
+				delete(failures, cr.UID)
+			}
+		}
+		return true
+	}
+	shared.LogErrorf(
+		reqLogger,
+		err,
+		cr,
+		shared.EventReasonCluster,
+		"extension{%s} hook{%s} failed",
+		ext.Name(),
+		hook,
+	)
+	shared.CountExtensionFailure(ext.Name(), hook)
+	failuresLock.Lock()
+	defer failuresLock.Unlock()
+	if _, ok := failures[cr.UID]; !ok {
+		failures[cr.UID] = make(map[string]Failure)
+	}
+	failures[cr.UID][key] = Failure{
+		Extension: ext.Name(),
+		Hook:      hook,
+		Message:   err.Error(),
+		Time:      time.Now(),
+	}
+	return false
+}
@@ -0,0 +1,85 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package extension
+
+import (
+	"time"
+
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	appsv1 "k8s.io/api/apps/v1"
+)
+
+// Names of the points at which extensions can be called.
+const (
+	HookPreStatefulSet       = "PreStatefulSet"
+	HookPostMemberConfigured = "PostMemberConfigured"
+	HookPreDelete            = "PreDelete"
+)
+
+// hookTimeout bounds each individual hook call.
+const hookTimeout = 30 * time.Second
+
+// Extension is implemented by every extension. Name identifies the
+// extension in logs, events, metrics, and cluster status; it must be unique
+// among the registered extensions.
+type Extension interface {
+	Name() string
+}
+
+// PreStatefulSetHook is implemented by extensions that want to modify the
+// statefulset generated for a role before it is created in k8s. The hook
+// is given a copy of the generated statefulset, which it may change in
+// place. The name, namespace, owner references, selector, service name,
+// and replicas count of the statefulset are not under the hook's control;
+// any changes to those are discarded.
+type PreStatefulSetHook interface {
+	Extension
+	PreStatefulSet(
+		cr *kdv1.KubeDirectorCluster,
+		role *kdv1.Role,
+		statefulSet *appsv1.StatefulSet,
+	) error
+}
+
+// PostMemberConfiguredHook is implemented by extensions that want to know
+// when a member has finished its initial configuration and is ready. The
+// hook is given copies of the cluster and member status.
+type PostMemberConfiguredHook interface {
+	Extension
+	PostMemberConfigured(
+		cr *kdv1.KubeDirectorCluster,
+		roleName string,
+		member *kdv1.MemberStatus,
+	) error
+}
+
+// PreDeleteHook is implemented by extensions that want to act before a
+// virtual cluster is deleted, while its members still exist. A failure of
+// this hook does not hold up the deletion.
+type PreDeleteHook interface {
+	Extension
+	PreDelete(
+		cr *kdv1.KubeDirectorCluster,
+	) error
+}
+
+// Failure describes the most recent failed call of a hook for a virtual
+// cluster.
+type Failure struct {
+	Extension string
+	Hook      string
+	Message   string
+	Time      time.Time
+}
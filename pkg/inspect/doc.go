@@ -0,0 +1,22 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package inspect gathers what an operator needs to look into virtual
+// clusters: a summary of each cluster, and the state, pod, node, and
+// storage claims of each member. It can also show the output of a member's
+// app setup, and request a restart of members through the role's restart
+// property so that KubeDirector carries it out.
+//
+// It is used by the "kubectl kd" plugin.
+package inspect
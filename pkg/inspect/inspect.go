@@ -0,0 +1,266 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package inspect
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	"github.com/bluek8s/kubedirector/pkg/executor"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ListClusters returns a summary of each virtual cluster in the namespace,
+// ordered by name.
+func ListClusters(
+	c client.Client,
+	namespace string,
+) ([]ClusterSummary, error) {
+
+	crList := kdv1.KubeDirectorClusterList{}
+	listErr := c.List(context.TODO(), &crList, client.InNamespace(namespace))
+	if listErr != nil {
+		return nil, listErr
+	}
+	var result []ClusterSummary
+	for _, cr := range crList.Items {
+		summary := ClusterSummary{
+			Name:  cr.Name,
+			App:   cr.Spec.AppID,
+			State: cr.Status.State,
+			Roles: len(cr.Status.Roles),
+		}
+		for _, roleStatus := range cr.Status.Roles {
+			for _, member := range roleStatus.Members {
+				summary.Members++
+				if member.State == memberReady {
+					summary.ReadyMembers++
+				}
+			}
+		}
+		result = append(result, summary)
+	}
+	sort.Slice(
+		result,
+		func(i, j int) bool {
+			return result[i].Name < result[j].Name
+		},
+	)
+	return result, nil
+}
+
+// ListMembers returns the details of each member of the named virtual
+// cluster, in role and member order.
+func ListMembers(
+	c client.Client,
+	namespace string,
+	clusterName string,
+) ([]MemberDetail, error) {
+
+	cr, getErr := getCluster(c, namespace, clusterName)
+	if getErr != nil {
+		return nil, getErr
+	}
+	var result []MemberDetail
+	for _, roleStatus := range cr.Status.Roles {
+		roleSpec := clusterRole(cr, roleStatus.Name)
+		for _, member := range roleStatus.Members {
+			detail := MemberDetail{
+				Role:           roleStatus.Name,
+				Pod:            member.Pod,
+				State:          member.State,
+				ContainerState: member.StateDetail.LastKnownContainerState,
+				Service:        member.Service,
+				PVC:            member.PVC,
+			}
+			if roleSpec != nil {
+				detail.BlockPVCs = executor.MemberBlockPVCNames(roleSpec, member.Pod)
+			}
+			pod := &corev1.Pod{}
+			podErr := c.Get(
+				context.TODO(),
+				types.NamespacedName{Namespace: namespace, Name: member.Pod},
+				pod,
+			)
+			if podErr == nil {
+				detail.Node = pod.Spec.NodeName
+			}
+			result = append(result, detail)
+		}
+	}
+	return result, nil
+}
+
+// TailSetupLog writes the last lines of the output (SetupStdout or
+// SetupStderr) of the app setup in the given member to w. If follow is
+// true it keeps writing new output, as "tail -F" does, until interrupted.
+func TailSetupLog(
+	config *rest.Config,
+	c client.Client,
+	namespace string,
+	podName string,
+	which string,
+	lines int,
+	follow bool,
+	w io.Writer,
+) error {
+
+	pod := &corev1.Pod{}
+	podErr := c.Get(
+		context.TODO(),
+		types.NamespacedName{Namespace: namespace, Name: podName},
+		pod,
+	)
+	if podErr != nil {
+		return podErr
+	}
+	// Setup runs in the setup container, if the member has one.
+	containerName := executor.AppContainerName
+	for _, container := range pod.Spec.Containers {
+		if container.Name == executor.SetupContainerName {
+			containerName = executor.SetupContainerName
+		}
+	}
+	command := []string{"tail", "-n", strconv.Itoa(lines)}
+	if follow {
+		command = append(command, "-F")
+	}
+	command = append(command, fmt.Sprintf(setupOutputFmt, which))
+
+	clientSet, clientErr := kubernetes.NewForConfig(config)
+	if clientErr != nil {
+		return clientErr
+	}
+	request := clientSet.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Name(podName).
+		Namespace(namespace).
+		SubResource("exec").
+		Param("container", containerName)
+	request.VersionedParams(&corev1.PodExecOptions{
+		Container: containerName,
+		Command:   command,
+		Stdout:    true,
+		Stderr:    true,
+	}, scheme.ParameterCodec)
+	exec, initErr := remotecommand.NewSPDYExecutor(config, "POST", request.URL())
+	if initErr != nil {
+		return initErr
+	}
+	return exec.Stream(remotecommand.StreamOptions{
+		Stdout: w,
+		Stderr: w,
+	})
+}
+
+// RestartMembers asks KubeDirector to restart members of a role of the
+// named virtual cluster, by increasing the generation of the role's restart
+// property. The given members are restarted, or every member of the role if
+// none are given. It returns the new restart generation.
+func RestartMembers(
+	c client.Client,
+	namespace string,
+	clusterName string,
+	roleName string,
+	members []string,
+) (int64, error) {
+
+	cr, getErr := getCluster(c, namespace, clusterName)
+	if getErr != nil {
+		return 0, getErr
+	}
+	role := clusterRole(cr, roleName)
+	if role == nil {
+		return 0, fmt.Errorf("cluster %s has no role %s", clusterName, roleName)
+	}
+	var generation int64 = 1
+	if role.Restart != nil {
+		generation = role.Restart.Generation + 1
+	}
+	role.Restart = &kdv1.RoleRestart{
+		Generation: generation,
+		Members:    members,
+	}
+	if updateErr := c.Update(context.TODO(), cr); updateErr != nil {
+		return 0, updateErr
+	}
+	return generation, nil
+}
+
+// MemberRole returns the role of the named member of the virtual cluster.
+func MemberRole(
+	c client.Client,
+	namespace string,
+	clusterName string,
+	podName string,
+) (string, error) {
+
+	cr, getErr := getCluster(c, namespace, clusterName)
+	if getErr != nil {
+		return "", getErr
+	}
+	for _, roleStatus := range cr.Status.Roles {
+		for _, member := range roleStatus.Members {
+			if member.Pod == podName {
+				return roleStatus.Name, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("cluster %s has no member %s", clusterName, podName)
+}
+
+// getCluster fetches the named virtual cluster.
+func getCluster(
+	c client.Client,
+	namespace string,
+	clusterName string,
+) (*kdv1.KubeDirectorCluster, error) {
+
+	cr := &kdv1.KubeDirectorCluster{}
+	getErr := c.Get(
+		context.TODO(),
+		types.NamespacedName{Namespace: namespace, Name: clusterName},
+		cr,
+	)
+	if getErr != nil {
+		return nil, getErr
+	}
+	return cr, nil
+}
+
+// clusterRole returns the spec of the named role of the virtual cluster,
+// or nil if there is no such role.
+func clusterRole(
+	cr *kdv1.KubeDirectorCluster,
+	roleName string,
+) *kdv1.Role {
+
+	for i := range cr.Spec.Roles {
+		if cr.Spec.Roles[i].Name == roleName {
+			return &(cr.Spec.Roles[i])
+		}
+	}
+	return nil
+}
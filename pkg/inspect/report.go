@@ -0,0 +1,83 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package inspect
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// WriteClustersText writes the cluster summaries as a table, in the style
+// of "kubectl get".
+func WriteClustersText(
+	w io.Writer,
+	clusters []ClusterSummary,
+) error {
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tAPP\tSTATE\tROLES\tREADY")
+	for _, cluster := range clusters {
+		fmt.Fprintf(
+			tw,
+			"%s\t%s\t%s\t%d\t%d/%d\n",
+			cluster.Name,
+			cluster.App,
+			cluster.State,
+			cluster.Roles,
+			cluster.ReadyMembers,
+			cluster.Members,
+		)
+	}
+	return tw.Flush()
+}
+
+// WriteMembersText writes the member details as a table, one line per
+// member.
+func WriteMembersText(
+	w io.Writer,
+	members []MemberDetail,
+) error {
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "ROLE\tMEMBER\tSTATE\tCONTAINER\tNODE\tPVC\tBLOCK PVCS")
+	for _, member := range members {
+		fmt.Fprintf(
+			tw,
+			"%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			member.Role,
+			member.Pod,
+			member.State,
+			orNone(member.ContainerState),
+			orNone(member.Node),
+			orNone(member.PVC),
+			orNone(strings.Join(member.BlockPVCs, ",")),
+		)
+	}
+	return tw.Flush()
+}
+
+// orNone returns the given value, or "<none>" if it is empty, as kubectl
+// shows missing values.
+func orNone(
+	value string,
+) string {
+
+	if value == "" {
+		return "<none>"
+	}
+	return value
+}
@@ -0,0 +1,60 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package inspect
+
+// Which output of the app setup in a member to show.
+const (
+	SetupStdout = "stdout"
+	SetupStderr = "stderr"
+)
+
+const (
+	// memberReady is the state of a member that has been configured.
+	memberReady = "configured"
+
+	// setupOutputFmt is the path, in the member, of the output of the
+	// app setup; the placeholder is stdout or stderr.
+	setupOutputFmt = "/opt/guestconfig/configure.%s"
+
+	// DefaultTailLines is how many lines of setup output are shown by
+	// default.
+	DefaultTailLines = 50
+)
+
+// ClusterSummary describes a virtual cluster: its app, its state, and how
+// many of its members are ready out of the total.
+type ClusterSummary struct {
+	Name         string `json:"name"`
+	App          string `json:"app"`
+	State        string `json:"state"`
+	Roles        int    `json:"roles"`
+	Members      int    `json:"members"`
+	ReadyMembers int    `json:"readyMembers"`
+}
+
+// MemberDetail describes a member of a virtual cluster and the objects
+// that make it up: its pod and the node that it is on, its service, and
+// its persistent storage claims (PVC for the persisted directories, and
+// BlockPVCs for the block devices).
+type MemberDetail struct {
+	Role           string   `json:"role"`
+	Pod            string   `json:"pod"`
+	State          string   `json:"state"`
+	ContainerState string   `json:"containerState,omitempty"`
+	Node           string   `json:"node,omitempty"`
+	Service        string   `json:"service,omitempty"`
+	PVC            string   `json:"pvc,omitempty"`
+	BlockPVCs      []string `json:"blockPVCs,omitempty"`
+}
@@ -0,0 +1,21 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package lint checks virtual cluster specs for settings that are valid but
+// likely to cause trouble. Each finding carries a stable code (KD001 and so
+// on) and a severity, which the KubeDirectorConfig can change per code.
+//
+// The same checks are reported as admission warnings by the validator and
+// by "kd validate".
+package lint
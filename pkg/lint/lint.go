@@ -0,0 +1,198 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lint
+
+import (
+	"fmt"
+
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	"github.com/bluek8s/kubedirector/pkg/catalog"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// checkFunc is used as the type for all the rules. A rule returns its
+// findings without a severity; appCR is nil if the app is not known.
+type checkFunc func(*kdv1.KubeDirectorCluster, *kdv1.KubeDirectorApp) []Finding
+
+// checks lists the rules in the order of their codes.
+var checks = []checkFunc{
+	checkTmpfs,
+	checkSingleMemberHARoles,
+	checkResourceLimits,
+}
+
+// Cluster checks a cluster spec against every rule, using the spec of its
+// app if that is known (appCR may be nil). Severities overrides the default
+// severity of the codes it lists; findings whose severity is "off" are not
+// returned.
+func Cluster(
+	cr *kdv1.KubeDirectorCluster,
+	appCR *kdv1.KubeDirectorApp,
+	severities map[string]string,
+) []Finding {
+
+	var findings []Finding
+	for _, check := range checks {
+		for _, finding := range check(cr, appCR) {
+			finding.Severity = Severity(finding.Code, severities)
+			if finding.Severity != SeverityOff {
+				findings = append(findings, finding)
+			}
+		}
+	}
+	return findings
+}
+
+// Severity returns the severity of a code: the one in severities if it is
+// listed there, otherwise the default one.
+func Severity(
+	code string,
+	severities map[string]string,
+) string {
+
+	if severity, ok := severities[code]; ok {
+		return severity
+	}
+	return DefaultSeverities[code]
+}
+
+// checkTmpfs implements KD001. Memory-backed scratch volumes count against
+// the memory limit of a member, and one without a size limit can use all of
+// it.
+func checkTmpfs(
+	cr *kdv1.KubeDirectorCluster,
+	appCR *kdv1.KubeDirectorApp,
+) []Finding {
+
+	if appCR == nil {
+		return nil
+	}
+	var findings []Finding
+	for i, role := range cr.Spec.Roles {
+		limit, hasLimit := role.Resources.Limits[corev1.ResourceMemory]
+		if !hasLimit {
+			continue
+		}
+		appRole := catalog.GetRoleFromID(appCR, role.Name)
+		if (appRole == nil) || (appRole.MinResources == nil) {
+			continue
+		}
+		minMemory, hasMin := (*appRole.MinResources)[corev1.ResourceMemory]
+		if !hasMin {
+			continue
+		}
+		var tmpfs resource.Quantity
+		for _, scratch := range role.Scratch {
+			if scratch.Medium != string(corev1.StorageMediumMemory) {
+				continue
+			}
+			if scratch.SizeLimit == nil {
+				tmpfs = limit.DeepCopy()
+				break
+			}
+			size, sizeErr := resource.ParseQuantity(*scratch.SizeLimit)
+			if sizeErr == nil {
+				tmpfs.Add(size)
+			}
+		}
+		if tmpfs.IsZero() {
+			continue
+		}
+		left := limit.DeepCopy()
+		left.Sub(tmpfs)
+		if left.Cmp(minMemory) < 0 {
+			findings = append(
+				findings,
+				Finding{
+					Code: CodeTmpfsTooSmall,
+					Role: role.Name,
+					Path: fmt.Sprintf("spec.roles[%d].scratch", i),
+					Message: fmt.Sprintf(
+						tmpfsTooSmall,
+						role.Name,
+						tmpfs.String(),
+						limit.String(),
+						minMemory.String(),
+					),
+				},
+			)
+		}
+	}
+	return findings
+}
+
+// checkSingleMemberHARoles implements KD002. A role without an explicit
+// member count gets the count from the app's cardinality.
+func checkSingleMemberHARoles(
+	cr *kdv1.KubeDirectorCluster,
+	appCR *kdv1.KubeDirectorApp,
+) []Finding {
+
+	if appCR == nil {
+		return nil
+	}
+	var findings []Finding
+	for i, role := range cr.Spec.Roles {
+		appRole := catalog.GetRoleFromID(appCR, role.Name)
+		if appRole == nil {
+			continue
+		}
+		members, isScaleOut := catalog.GetRoleCardinality(appRole)
+		if !isScaleOut {
+			continue
+		}
+		if role.Members != nil {
+			members = *role.Members
+		}
+		if members == 1 {
+			findings = append(
+				findings,
+				Finding{
+					Code:    CodeSingleMemberHARole,
+					Role:    role.Name,
+					Path:    fmt.Sprintf("spec.roles[%d].members", i),
+					Message: fmt.Sprintf(singleMemberHARole, role.Name),
+				},
+			)
+		}
+	}
+	return findings
+}
+
+// checkResourceLimits implements KD003.
+func checkResourceLimits(
+	cr *kdv1.KubeDirectorCluster,
+	appCR *kdv1.KubeDirectorApp,
+) []Finding {
+
+	var findings []Finding
+	for i, role := range cr.Spec.Roles {
+		for _, resourceName := range []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory} {
+			if _, ok := role.Resources.Limits[resourceName]; !ok {
+				findings = append(
+					findings,
+					Finding{
+						Code:    CodeMissingResourceLimits,
+						Role:    role.Name,
+						Path:    fmt.Sprintf("spec.roles[%d].resources.limits", i),
+						Message: fmt.Sprintf(missingResourceLimits, role.Name, resourceName),
+					},
+				)
+			}
+		}
+	}
+	return findings
+}
@@ -0,0 +1,182 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lint
+
+import (
+	"reflect"
+	"testing"
+
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	"github.com/bluek8s/kubedirector/pkg/shared"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// testApp returns an app with a fixed-size "controller" role and a
+// scale-out "worker" role that needs at least 1Gi of memory.
+func testApp() *kdv1.KubeDirectorApp {
+
+	minResources := corev1.ResourceList{
+		corev1.ResourceMemory: resource.MustParse("1Gi"),
+	}
+	appCR := &kdv1.KubeDirectorApp{}
+	appCR.Spec.NodeRoles = []kdv1.NodeRole{
+		{ID: "controller", Cardinality: "1"},
+		{ID: "worker", Cardinality: "2+", MinResources: &minResources},
+	}
+	return appCR
+}
+
+// testLimits returns CPU and memory limits of the given amounts.
+func testLimits(
+	cpu string,
+	memory string,
+) corev1.ResourceRequirements {
+
+	return corev1.ResourceRequirements{
+		Limits: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse(cpu),
+			corev1.ResourceMemory: resource.MustParse(memory),
+		},
+	}
+}
+
+func TestCluster(t *testing.T) {
+
+	one := int32(1)
+	tests := []struct {
+		name       string
+		role       kdv1.Role
+		appCR      *kdv1.KubeDirectorApp
+		severities map[string]string
+		want       []string
+	}{
+		{
+			"clean",
+			kdv1.Role{Name: "worker", Resources: testLimits("1", "2Gi")},
+			testApp(),
+			nil,
+			nil,
+		},
+		{
+			"missing limits without app",
+			kdv1.Role{Name: "worker"},
+			nil,
+			nil,
+			[]string{
+				"KD003 warning spec.roles[0].resources.limits",
+				"KD003 warning spec.roles[0].resources.limits",
+			},
+		},
+		{
+			"unbounded tmpfs",
+			kdv1.Role{
+				Name:      "worker",
+				Resources: testLimits("1", "2Gi"),
+				Scratch:   []kdv1.ScratchVolume{{Name: "s", Medium: "Memory"}},
+			},
+			testApp(),
+			nil,
+			[]string{"KD001 warning spec.roles[0].scratch"},
+		},
+		{
+			"tmpfs leaves too little",
+			kdv1.Role{
+				Name:      "worker",
+				Resources: testLimits("1", "2Gi"),
+				Scratch: []kdv1.ScratchVolume{
+					{Name: "s1", Medium: "Memory", SizeLimit: shared.StrPtr("512Mi")},
+					{Name: "s2", Medium: "Memory", SizeLimit: shared.StrPtr("768Mi")},
+				},
+			},
+			testApp(),
+			nil,
+			[]string{"KD001 warning spec.roles[0].scratch"},
+		},
+		{
+			"tmpfs leaves enough",
+			kdv1.Role{
+				Name:      "worker",
+				Resources: testLimits("1", "2Gi"),
+				Scratch: []kdv1.ScratchVolume{
+					{Name: "s1", Medium: "Memory", SizeLimit: shared.StrPtr("512Mi")},
+					{Name: "s2", SizeLimit: shared.StrPtr("4Gi")},
+				},
+			},
+			testApp(),
+			nil,
+			nil,
+		},
+		{
+			"single member scale-out role",
+			kdv1.Role{Name: "worker", Members: &one, Resources: testLimits("1", "2Gi")},
+			testApp(),
+			nil,
+			[]string{"KD002 info spec.roles[0].members"},
+		},
+		{
+			"single member fixed role",
+			kdv1.Role{Name: "controller", Members: &one, Resources: testLimits("1", "2Gi")},
+			testApp(),
+			nil,
+			nil,
+		},
+		{
+			"severities overridden",
+			kdv1.Role{Name: "worker", Members: &one},
+			testApp(),
+			map[string]string{
+				CodeSingleMemberHARole:    SeverityError,
+				CodeMissingResourceLimits: SeverityOff,
+			},
+			[]string{"KD002 error spec.roles[0].members"},
+		},
+	}
+	for _, test := range tests {
+		cr := &kdv1.KubeDirectorCluster{}
+		cr.Spec.Roles = []kdv1.Role{test.role}
+		var got []string
+		for _, finding := range Cluster(cr, test.appCR, test.severities) {
+			if finding.Role != test.role.Name {
+				t.Errorf("%s: got role %s, want %s", test.name, finding.Role, test.role.Name)
+			}
+			got = append(got, finding.Code+" "+finding.Severity+" "+finding.Path)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestReportHasErrors(t *testing.T) {
+
+	tests := []struct {
+		severities []string
+		want       bool
+	}{
+		{nil, false},
+		{[]string{SeverityWarning, SeverityInfo}, false},
+		{[]string{SeverityInfo, SeverityError}, true},
+	}
+	for _, test := range tests {
+		report := &Report{}
+		for _, severity := range test.severities {
+			report.Findings = append(report.Findings, Finding{Severity: severity})
+		}
+		if got := report.HasErrors(); got != test.want {
+			t.Errorf("%v: got %v, want %v", test.severities, got, test.want)
+		}
+	}
+}
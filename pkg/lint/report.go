@@ -0,0 +1,68 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lint
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+)
+
+// HasErrors returns true if any finding in the report has the error
+// severity.
+func (r *Report) HasErrors() bool {
+
+	for _, finding := range r.Findings {
+		if finding.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteText writes the report as a table with one line per finding.
+func (r *Report) WriteText(
+	w io.Writer,
+) error {
+
+	if len(r.Findings) == 0 {
+		_, writeErr := fmt.Fprintf(w, "No findings for cluster %s/%s.\n", r.Namespace, r.Cluster)
+		return writeErr
+	}
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "CODE\tSEVERITY\tPATH\tMESSAGE")
+	for _, finding := range r.Findings {
+		fmt.Fprintf(
+			tw,
+			"%s\t%s\t%s\t%s\n",
+			finding.Code,
+			finding.Severity,
+			finding.Path,
+			finding.Message,
+		)
+	}
+	return tw.Flush()
+}
+
+// WriteJSON writes the report as indented JSON.
+func (r *Report) WriteJSON(
+	w io.Writer,
+) error {
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
@@ -0,0 +1,80 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lint
+
+// Severities of a finding. A finding with SeverityOff is not reported.
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+	SeverityInfo    = "info"
+	SeverityOff     = "off"
+)
+
+// Codes of the lint rules.
+const (
+	// CodeTmpfsTooSmall is reported when the memory-backed scratch space of a
+	// role can use so much of the role's memory limit that the app is left
+	// with less than the minimum memory the app asks for.
+	CodeTmpfsTooSmall = "KD001"
+
+	// CodeSingleMemberHARole is reported when a role that the app lets scale
+	// out is run with a single member, so that losing that member takes the
+	// whole role down.
+	CodeSingleMemberHARole = "KD002"
+
+	// CodeMissingResourceLimits is reported when a role does not set a CPU or
+	// memory limit.
+	CodeMissingResourceLimits = "KD003"
+)
+
+const (
+	tmpfsTooSmall         = "Memory-backed scratch space of role(%s) can use %s of its %s memory limit, leaving less than the %s that the app needs."
+	singleMemberHARole    = "Role(%s) can scale out but has only one member; the role is unavailable whenever that member is."
+	missingResourceLimits = "Role(%s) does not set a %s limit."
+)
+
+// DefaultSeverities gives the severity of each code when the
+// KubeDirectorConfig does not set one.
+var DefaultSeverities = map[string]string{
+	CodeTmpfsTooSmall:         SeverityWarning,
+	CodeSingleMemberHARole:    SeverityInfo,
+	CodeMissingResourceLimits: SeverityWarning,
+}
+
+// Severities lists every valid severity.
+var Severities = []string{
+	SeverityError,
+	SeverityWarning,
+	SeverityInfo,
+	SeverityOff,
+}
+
+// Finding is one problem found in a cluster spec. Path locates the setting
+// in the spec, in the style of "spec.roles[0].resources.limits".
+type Finding struct {
+	Code     string `json:"code"`
+	Severity string `json:"severity"`
+	Role     string `json:"role,omitempty"`
+	Path     string `json:"path"`
+	Message  string `json:"message"`
+}
+
+// Report is the result of linting one virtual cluster spec.
+type Report struct {
+	Namespace string    `json:"namespace"`
+	Cluster   string    `json:"cluster"`
+	App       string    `json:"app"`
+	Findings  []Finding `json:"findings"`
+}
@@ -23,10 +23,17 @@ import (
 	"k8s.io/api/admissionregistration/v1beta1"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	networkingv1beta1 "k8s.io/api/networking/v1beta1"
+	schedulingv1 "k8s.io/api/scheduling/v1"
 	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/version"
+	k8sClient "sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 // GetCluster finds the k8s KubeDirectorCluster with the given name in the
@@ -61,6 +68,22 @@ func GetStatusBackup(
 	return result, err
 }
 
+// GetBackup finds the k8s KubeDirectorBackup with the given name in the
+// given namespace.
+func GetBackup(
+	namespace string,
+	backupName string,
+) (*kdv1.KubeDirectorBackup, error) {
+
+	result := &kdv1.KubeDirectorBackup{}
+	err := shared.Get(
+		context.TODO(),
+		types.NamespacedName{Namespace: namespace, Name: backupName},
+		result,
+	)
+	return result, err
+}
+
 // GetStatefulSet finds the k8s StatefulSet with the given name in the given
 // namespace.
 func GetStatefulSet(
@@ -92,6 +115,132 @@ func GetService(
 	return result, err
 }
 
+// GetNetworkPolicy finds the k8s NetworkPolicy with the given name in the
+// given namespace.
+func GetNetworkPolicy(
+	namespace string,
+	policyName string,
+) (*networkingv1.NetworkPolicy, error) {
+
+	result := &networkingv1.NetworkPolicy{}
+	err := shared.Get(
+		context.TODO(),
+		types.NamespacedName{Namespace: namespace, Name: policyName},
+		result,
+	)
+	return result, err
+}
+
+// GetIngress finds the k8s Ingress with the given name in the given
+// namespace.
+func GetIngress(
+	namespace string,
+	ingressName string,
+) (*networkingv1beta1.Ingress, error) {
+
+	result := &networkingv1beta1.Ingress{}
+	err := shared.Get(
+		context.TODO(),
+		types.NamespacedName{Namespace: namespace, Name: ingressName},
+		result,
+	)
+	return result, err
+}
+
+// GetRoute finds the OpenShift Route with the given name in the given
+// namespace. This will fail with a "no match" error if the cluster does not
+// support Routes.
+func GetRoute(
+	namespace string,
+	routeName string,
+) (*unstructured.Unstructured, error) {
+
+	result := &unstructured.Unstructured{}
+	result.SetAPIVersion("route.openshift.io/v1")
+	result.SetKind("Route")
+	err := shared.Get(
+		context.TODO(),
+		types.NamespacedName{Namespace: namespace, Name: routeName},
+		result,
+	)
+	return result, err
+}
+
+// GetCertificate finds the cert-manager Certificate with the given name in
+// the given namespace. This will fail with a "no match" error if cert-manager
+// is not installed.
+func GetCertificate(
+	namespace string,
+	certificateName string,
+) (*unstructured.Unstructured, error) {
+
+	result := &unstructured.Unstructured{}
+	result.SetAPIVersion("cert-manager.io/v1")
+	result.SetKind("Certificate")
+	err := shared.Get(
+		context.TODO(),
+		types.NamespacedName{Namespace: namespace, Name: certificateName},
+		result,
+	)
+	return result, err
+}
+
+// GetVolumeSnapshot finds the CSI VolumeSnapshot with the given name in
+// the given namespace. This will fail with a "no match" error if the
+// cluster does not support volume snapshots.
+func GetVolumeSnapshot(
+	namespace string,
+	snapshotName string,
+) (*unstructured.Unstructured, error) {
+
+	result := &unstructured.Unstructured{}
+	result.SetAPIVersion("snapshot.storage.k8s.io/v1")
+	result.SetKind("VolumeSnapshot")
+	err := shared.Get(
+		context.TODO(),
+		types.NamespacedName{Namespace: namespace, Name: snapshotName},
+		result,
+	)
+	return result, err
+}
+
+// ListClusterNetworkPolicies returns the k8s NetworkPolicies in the given
+// namespace that are labelled as belonging to the given cluster.
+func ListClusterNetworkPolicies(
+	namespace string,
+	clusterName string,
+) ([]networkingv1.NetworkPolicy, error) {
+
+	result := &networkingv1.NetworkPolicyList{}
+	err := shared.List(
+		context.TODO(),
+		result,
+		k8sClient.InNamespace(namespace),
+		k8sClient.MatchingLabels{shared.ClusterLabel: clusterName},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return result.Items, nil
+}
+
+// ListResourceQuotas returns the resource quotas in the given namespace.
+func ListResourceQuotas(
+	namespace string,
+) ([]corev1.ResourceQuota, error) {
+
+	result := &corev1.ResourceQuotaList{}
+	err := shared.List(
+		context.TODO(),
+		result,
+		k8sClient.InNamespace(namespace),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return result.Items, nil
+}
+
 // GetPod finds the k8s Pod with the given name in the given namespace.
 func GetPod(
 	namespace string,
@@ -122,6 +271,29 @@ func GetConfigMap(
 	return result, err
 }
 
+// ListClusterMemberStatusDetails returns the member status detail
+// ConfigMaps in the given namespace that belong to the given cluster.
+func ListClusterMemberStatusDetails(
+	namespace string,
+	clusterName string,
+) ([]corev1.ConfigMap, error) {
+
+	result := &corev1.ConfigMapList{}
+	err := shared.List(
+		context.TODO(),
+		result,
+		k8sClient.InNamespace(namespace),
+		k8sClient.MatchingLabels{
+			shared.ClusterLabel:            clusterName,
+			shared.MemberStatusDetailLabel: "true",
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return result.Items, nil
+}
+
 // GetSecret finds the k8s Secret with the given name in the given namespace.
 func GetSecret(
 	namespace string,
@@ -264,6 +436,35 @@ func GetKDConfig(
 	return result, err
 }
 
+// GetNamespaceConfig fetches the KubeDirectorNamespaceConfig CR, if any,
+// that applies to the given namespace.
+func GetNamespaceConfig(
+	namespace string,
+) (*kdv1.KubeDirectorNamespaceConfig, error) {
+
+	result := &kdv1.KubeDirectorNamespaceConfig{}
+	err := shared.Get(
+		context.TODO(),
+		types.NamespacedName{Namespace: namespace, Name: shared.KubeDirectorNamespaceConfig},
+		result,
+	)
+	return result, err
+}
+
+// GetNamespace fetches the namespace with the given name.
+func GetNamespace(
+	namespaceName string,
+) (*corev1.Namespace, error) {
+
+	result := &corev1.Namespace{}
+	err := shared.Get(
+		context.TODO(),
+		types.NamespacedName{Name: namespaceName},
+		result,
+	)
+	return result, err
+}
+
 // GetStorageClass fetches the storage class resource with a given name.
 func GetStorageClass(
 	storageClassName string,
@@ -278,6 +479,20 @@ func GetStorageClass(
 	return result, err
 }
 
+// GetPriorityClass fetches the priority class resource with a given name.
+func GetPriorityClass(
+	priorityClassName string,
+) (*schedulingv1.PriorityClass, error) {
+
+	result := &schedulingv1.PriorityClass{}
+	err := shared.Get(
+		context.TODO(),
+		types.NamespacedName{Name: priorityClassName},
+		result,
+	)
+	return result, err
+}
+
 // GetDefaultStorageClass returns the default storage class, if any, as
 // defined by k8s.
 func GetDefaultStorageClass() (*storagev1.StorageClass, error) {
@@ -300,3 +515,94 @@ func GetDefaultStorageClass() (*storagev1.StorageClass, error) {
 	}
 	return nil, nil
 }
+
+// ListStorageClasses returns all the storage classes.
+func ListStorageClasses() ([]storagev1.StorageClass, error) {
+
+	result := &storagev1.StorageClassList{}
+	err := shared.List(context.TODO(), result)
+	if err != nil {
+		return nil, err
+	}
+	return result.Items, nil
+}
+
+// ListNodes returns all the nodes. This queries k8s directly rather than
+// going through the cache, since nodes are not otherwise watched.
+func ListNodes() ([]corev1.Node, error) {
+
+	result, err := shared.ClientSet().CoreV1().Nodes().List(metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return result.Items, nil
+}
+
+// GetNode fetches the node with the given name. Like ListNodes, this queries
+// k8s directly rather than going through the cache.
+func GetNode(
+	nodeName string,
+) (*corev1.Node, error) {
+
+	return shared.ClientSet().CoreV1().Nodes().Get(nodeName, metav1.GetOptions{})
+}
+
+// GetServerVersion returns the version of the K8s API server.
+func GetServerVersion() (*version.Info, error) {
+
+	return shared.ClientSet().Discovery().ServerVersion()
+}
+
+// APIGroupVersionServed reports whether the K8s API server serves the given
+// API group version (such as "snapshot.storage.k8s.io/v1").
+func APIGroupVersionServed(
+	groupVersion string,
+) (bool, error) {
+
+	_, err := shared.ClientSet().Discovery().ServerResourcesForGroupVersion(groupVersion)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// GetPodEvents returns the k8s events that refer to the given pod, and not
+// to an earlier pod of the same name. This queries k8s directly rather than
+// going through the cache, since events are not otherwise watched.
+func GetPodEvents(
+	pod *corev1.Pod,
+) ([]corev1.Event, error) {
+
+	result, err := shared.ClientSet().CoreV1().Events(pod.Namespace).List(
+		metav1.ListOptions{
+			FieldSelector: "involvedObject.kind=Pod,involvedObject.name=" + pod.Name +
+				",involvedObject.uid=" + string(pod.UID),
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return result.Items, nil
+}
+
+// GetStatefulSetEvents returns the k8s events in the given namespace that
+// refer to the statefulset with the given name. Like GetPodEvents, this
+// queries k8s directly.
+func GetStatefulSetEvents(
+	namespace string,
+	statefulSetName string,
+) ([]corev1.Event, error) {
+
+	result, err := shared.ClientSet().CoreV1().Events(namespace).List(
+		metav1.ListOptions{
+			FieldSelector: "involvedObject.kind=StatefulSet,involvedObject.name=" + statefulSetName,
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return result.Items, nil
+}
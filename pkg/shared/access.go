@@ -0,0 +1,113 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package shared
+
+import (
+	"context"
+	"encoding/json"
+	"regexp"
+	"strings"
+
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	v1auth "k8s.io/api/authentication/v1"
+	sar "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// labelValueInvalidChars matches the characters that a label value cannot
+// contain.
+var labelValueInvalidChars = regexp.MustCompile(`[^A-Za-z0-9_.-]`)
+
+// ClusterCreator returns the identity recorded in the creator annotation of
+// the given kdcluster, or nil if there is no such annotation (as for
+// clusters created before KubeDirector started recording it).
+func ClusterCreator(
+	cr *kdv1.KubeDirectorCluster,
+) (*v1auth.UserInfo, error) {
+
+	value, ok := cr.Annotations[CreatorAnnotation]
+	if !ok {
+		return nil, nil
+	}
+	userInfo := &v1auth.UserInfo{}
+	if jsonErr := json.Unmarshal([]byte(value), userInfo); jsonErr != nil {
+		return nil, jsonErr
+	}
+	return userInfo, nil
+}
+
+// CreatorLabelValue converts a username into a value for the creator label.
+// Characters that a label value cannot contain (such as the colons in a
+// serviceaccount username or the "@" in an email address) become
+// underscores, and the result is cut to the maximum label value length.
+func CreatorLabelValue(
+	username string,
+) string {
+
+	value := labelValueInvalidChars.ReplaceAllString(username, "_")
+	if len(value) > 63 {
+		value = value[:63]
+	}
+	return strings.Trim(value, "_.-")
+}
+
+// UserAllowed uses a SubjectAccessReview to determine whether the given user
+// may perform the verb on the named object of the given resource type and
+// API group (empty for the core group). A subresource can be given after a
+// slash, as in "pods/exec". If not, the reviewer's reason (if any) is also
+// returned.
+func UserAllowed(
+	userInfo *v1auth.UserInfo,
+	namespace string,
+	group string,
+	resource string,
+	name string,
+	verb string,
+) (bool, string, error) {
+
+	xtra := make(map[string]sar.ExtraValue)
+	for k, v := range userInfo.Extra {
+		xtra[k] = sar.ExtraValue(v)
+	}
+	subresource := ""
+	if slash := strings.Index(resource, "/"); slash != -1 {
+		subresource = resource[slash+1:]
+		resource = resource[:slash]
+	}
+	review := &sar.SubjectAccessReview{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "SubjectAccessReview",
+			APIVersion: "authorization.k8s.io/v1",
+		},
+		Spec: sar.SubjectAccessReviewSpec{
+			ResourceAttributes: &sar.ResourceAttributes{
+				Namespace:   namespace,
+				Verb:        verb,
+				Group:       group,
+				Resource:    resource,
+				Subresource: subresource,
+				Name:        name,
+			},
+			User:   userInfo.Username,
+			Groups: userInfo.Groups,
+			UID:    userInfo.UID,
+			Extra:  xtra,
+		},
+	}
+	if createErr := Create(context.TODO(), review); createErr != nil {
+		return false, "", createErr
+	}
+	return review.Status.Allowed, review.Status.Reason, nil
+}
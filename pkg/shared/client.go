@@ -58,7 +58,16 @@ var (
 // init ...
 func init() {
 
-	config = getConfigFromServiceAccount()
+	var configErr error
+	config, configErr = k8sConfig.GetConfig()
+	if configErr != nil {
+		// Leave the clients unset and drop any events. The manager exits
+		// when it finds no config, and this lets unit tests of the packages
+		// that import this one run without a K8s cluster.
+		log.Error(configErr, "getConfigFromServiceAccount")
+		eventRecorder = &record.FakeRecorder{}
+		return
+	}
 	client = getClient(config)
 	directClient = getClient(config)
 	clientSet = getClientSet(config)
@@ -78,18 +87,6 @@ func getClientSet(
 	return clientset
 }
 
-// getConfigFromServiceAccount generates a client config using the local
-// service account credentials.
-func getConfigFromServiceAccount() *rest.Config {
-
-	config, err := k8sConfig.GetConfig()
-	if err != nil {
-		log.Error(err, "getConfigFromServiceAccount")
-		os.Exit(1)
-	}
-	return config
-}
-
 // eventRecorder returns an EventRecorder type that can be
 // used to post Events to different object's lifecycles.
 func getEventRecorder() record.EventRecorder {
@@ -208,10 +205,29 @@ func Patch(
 	modifiedObj runtime.Object,
 ) error {
 
+	if faultErr := injectConflict(modifiedObj); faultErr != nil {
+		return faultErr
+	}
 	patch := k8sClient.MergeFrom(originalObj)
 	return client.Patch(ctx, modifiedObj, patch)
 }
 
+// MergePatch uses the split client to apply a JSON merge patch to the
+// given object. Unlike Patch, this can set fields that are newer than the
+// API types that KubeDirector builds against.
+func MergePatch(
+	ctx context.Context,
+	obj runtime.Object,
+	data []byte,
+) error {
+
+	if faultErr := injectConflict(obj); faultErr != nil {
+		return faultErr
+	}
+	patch := k8sClient.ConstantPatch(types.MergePatchType, data)
+	return client.Patch(ctx, obj, patch)
+}
+
 // Update uses the split client. Should write back directly to K8s, but we'll
 // use the split client in case it ever wants to use the knowledge that we
 // are changing the object.
@@ -220,6 +236,9 @@ func Update(
 	obj runtime.Object,
 ) error {
 
+	if faultErr := injectConflict(obj); faultErr != nil {
+		return faultErr
+	}
 	return client.Update(ctx, obj)
 }
 
@@ -231,6 +250,9 @@ func StatusUpdate(
 	obj runtime.Object,
 ) error {
 
+	if faultErr := injectConflict(obj); faultErr != nil {
+		return faultErr
+	}
 	return client.Status().Update(ctx, obj)
 }
 
@@ -0,0 +1,76 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package shared
+
+import (
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// SetCondition sets the condition of the given type in the given list to
+// have the given status, reason, and message. The transition time is only
+// updated if the status changes. A condition that is not already present is
+// not added if its status would be false; absence already means "not true".
+func SetCondition(
+	conditions *[]kdv1.Condition,
+	conditionType string,
+	status corev1.ConditionStatus,
+	reason string,
+	message string,
+) {
+
+	for i := range *conditions {
+		condition := &((*conditions)[i])
+		if condition.Type != conditionType {
+			continue
+		}
+		if condition.Status != status {
+			condition.Status = status
+			condition.LastTransitionTime = metav1.Now()
+		}
+		condition.Reason = reason
+		condition.Message = message
+		return
+	}
+	if status == corev1.ConditionFalse {
+		return
+	}
+	*conditions = append(
+		*conditions,
+		kdv1.Condition{
+			Type:               conditionType,
+			Status:             status,
+			Reason:             reason,
+			Message:            message,
+			LastTransitionTime: metav1.Now(),
+		},
+	)
+}
+
+// ConditionIsTrue reports whether the given conditions list contains a
+// condition of the given type with status True.
+func ConditionIsTrue(
+	conditions []kdv1.Condition,
+	conditionType string,
+) bool {
+
+	for _, condition := range conditions {
+		if condition.Type == conditionType {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
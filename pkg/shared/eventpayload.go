@@ -0,0 +1,100 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package shared
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/reference"
+)
+
+const (
+	// EventPayloadAnnotation is the annotation, on the K8s events that
+	// KubeDirector posts for state transitions, that holds the transition
+	// as a JSON-encoded EventPayload.
+	EventPayloadAnnotation = KdDomainBase + "/eventPayload"
+
+	// EventTypeAnnotation is the annotation that repeats the Type of the
+	// event payload, so that watchers can filter without decoding it.
+	EventTypeAnnotation = KdDomainBase + "/eventType"
+
+	// EventPayloadVersion is the version of the EventPayload format. It is
+	// changed only if existing properties change meaning or are removed.
+	EventPayloadVersion = "v1"
+)
+
+// Types of state transition described by an EventPayload.
+const (
+	// EventClusterStateChanged is a change of the cluster's state.
+	EventClusterStateChanged = "ClusterStateChanged"
+
+	// EventMemberStateChanged is a change of a member's state, including
+	// the first state of a new member (with an empty From).
+	EventMemberStateChanged = "MemberStateChanged"
+
+	// EventMemberRemoved is the removal of a member from the cluster.
+	EventMemberRemoved = "MemberRemoved"
+)
+
+// EventPayload is the machine-readable description of a state transition,
+// attached to the event that reports it. Role and Member are only set for
+// member transitions. From and To are the states before and after.
+type EventPayload struct {
+	Version   string `json:"version"`
+	Type      string `json:"type"`
+	Namespace string `json:"namespace"`
+	Cluster   string `json:"cluster"`
+	Role      string `json:"role,omitempty"`
+	Member    string `json:"member,omitempty"`
+	From      string `json:"from,omitempty"`
+	To        string `json:"to,omitempty"`
+}
+
+// LogTransitionf logs the given message format and payload at Info level,
+// and posts it as a Normal event with the transition payload attached in
+// its annotations.
+func LogTransitionf(
+	logger logr.Logger,
+	obj runtime.Object,
+	eventReason string,
+	payload EventPayload,
+	format string,
+	args ...interface{},
+) {
+
+	logger.Info(fmt.Sprintf(format, args...))
+
+	payload.Version = EventPayloadVersion
+	annotations := map[string]string{
+		EventTypeAnnotation: payload.Type,
+	}
+	if encoded, encodeErr := json.Marshal(payload); encodeErr == nil {
+		annotations[EventPayloadAnnotation] = string(encoded)
+	}
+	ref, _ := reference.GetReference(scheme.Scheme, obj)
+	eventRecorder.AnnotatedEventf(
+		ref,
+		annotations,
+		v1.EventTypeNormal,
+		eventReason,
+		format,
+		args...,
+	)
+}
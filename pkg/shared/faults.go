@@ -0,0 +1,201 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package shared
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// Fault injection is a test mode for exercising the reconcile logic against
+// the kinds of failures that are hard to provoke on demand in a real K8s
+// cluster. It is off unless the FaultInjectionEnvVar variable is "true" in
+// the KubeDirector deployment; the other variables then set the rate or
+// extent of each kind of fault. It must never be enabled in production.
+const (
+	// FaultInjectionEnvVar enables fault injection when set to "true".
+	FaultInjectionEnvVar = "KD_FAULT_INJECTION"
+
+	// FaultConflictPercentEnvVar is the percentage (0-100) of object
+	// updates and patches that fail with a simulated conflict error.
+	FaultConflictPercentEnvVar = "KD_FAULT_CONFLICT_PERCENT"
+
+	// FaultExecDropPercentEnvVar is the percentage (0-100) of exec
+	// sessions into member containers that are dropped before they run.
+	FaultExecDropPercentEnvVar = "KD_FAULT_EXEC_DROP_PERCENT"
+
+	// FaultEventDelayEnvVar is the maximum delay (a Go duration such as
+	// "5s") added to the delivery of each watched informer event. The
+	// actual delay is chosen at random up to this maximum.
+	FaultEventDelayEnvVar = "KD_FAULT_EVENT_DELAY"
+)
+
+// faultConfig holds the fault injection settings read at startup.
+type faultConfig struct {
+	enabled         bool
+	conflictPercent int
+	execDropPercent int
+	maxEventDelay   time.Duration
+}
+
+var faults faultConfig
+
+// LoadFaultConfig reads the fault injection settings from the environment.
+// Invalid settings are logged and treated as zero. This should be called
+// once at startup, after the logger has been set up.
+func LoadFaultConfig() {
+
+	var settings faultConfig
+	if strings.ToLower(os.Getenv(FaultInjectionEnvVar)) != "true" {
+		return
+	}
+	settings.enabled = true
+	settings.conflictPercent = faultPercent(FaultConflictPercentEnvVar)
+	settings.execDropPercent = faultPercent(FaultExecDropPercentEnvVar)
+	if delayStr, found := os.LookupEnv(FaultEventDelayEnvVar); found {
+		delay, delayErr := time.ParseDuration(delayStr)
+		if (delayErr != nil) || (delay < 0) {
+			log.Error(
+				fmt.Errorf("invalid duration %q", delayStr),
+				"ignoring fault injection setting",
+				"variable",
+				FaultEventDelayEnvVar,
+			)
+		} else {
+			settings.maxEventDelay = delay
+		}
+	}
+	rand.Seed(time.Now().UnixNano())
+	log.Info(
+		"FAULT INJECTION IS ENABLED; not for production use",
+		"conflictPercent",
+		settings.conflictPercent,
+		"execDropPercent",
+		settings.execDropPercent,
+		"maxEventDelay",
+		settings.maxEventDelay.String(),
+	)
+	faults = settings
+}
+
+// faultPercent reads a percentage from the given environment variable.
+func faultPercent(
+	envVar string,
+) int {
+
+	percentStr, found := os.LookupEnv(envVar)
+	if !found {
+		return 0
+	}
+	percent, percentErr := strconv.Atoi(percentStr)
+	if (percentErr != nil) || (percent < 0) || (percent > 100) {
+		log.Error(
+			fmt.Errorf("invalid percentage %q", percentStr),
+			"ignoring fault injection setting",
+			"variable",
+			envVar,
+		)
+		return 0
+	}
+	return percent
+}
+
+// faultHits decides at random whether a fault with the given percentage
+// rate should be injected now.
+func faultHits(
+	percent int,
+) bool {
+
+	return faults.enabled && (percent > 0) && (rand.Intn(100) < percent)
+}
+
+// injectConflict returns a simulated conflict error for a write to the
+// given object, or nil if no fault is to be injected.
+func injectConflict(
+	obj runtime.Object,
+) error {
+
+	if !faultHits(faults.conflictPercent) {
+		return nil
+	}
+	name := ""
+	if accessor, accessorErr := meta.Accessor(obj); accessorErr == nil {
+		name = accessor.GetName()
+	}
+	gvk := obj.GetObjectKind().GroupVersionKind()
+	log.Info("injecting conflict fault", "kind", gvk.Kind, "name", name)
+	return errors.NewConflict(
+		schema.GroupResource{Group: gvk.Group, Resource: strings.ToLower(gvk.Kind)},
+		name,
+		fmt.Errorf("simulated conflict (fault injection)"),
+	)
+}
+
+// InjectExecDrop returns a simulated error for an exec session into a
+// member container, or nil if no fault is to be injected.
+func InjectExecDrop(
+	podName string,
+	containerName string,
+) error {
+
+	if !faultHits(faults.execDropPercent) {
+		return nil
+	}
+	log.Info("injecting exec fault", "pod", podName, "container", containerName)
+	return fmt.Errorf(
+		"simulated dropped exec session to container{%s} in pod{%s} (fault injection)",
+		containerName,
+		podName,
+	)
+}
+
+// delayEvent blocks for a random time up to the configured maximum event
+// delay. Since it is called from the informer event handlers, this holds
+// back the delivery of later events too, as a slow watch would.
+func delayEvent() bool {
+
+	if faults.enabled && (faults.maxEventDelay > 0) {
+		time.Sleep(time.Duration(rand.Int63n(int64(faults.maxEventDelay) + 1)))
+	}
+	return true
+}
+
+// FaultDelayPredicate passes every event, after delaying it if event delay
+// faults are enabled. Controllers add it to their watches.
+var FaultDelayPredicate = predicate.Funcs{
+	CreateFunc: func(e event.CreateEvent) bool {
+		return delayEvent()
+	},
+	DeleteFunc: func(e event.DeleteEvent) bool {
+		return delayEvent()
+	},
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		return delayEvent()
+	},
+	GenericFunc: func(e event.GenericEvent) bool {
+		return delayEvent()
+	},
+}
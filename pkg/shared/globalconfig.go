@@ -19,6 +19,7 @@ import (
 	"sync"
 
 	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	corev1 "k8s.io/api/core/v1"
 )
 
 var (
@@ -187,6 +188,330 @@ func GetAllowRestoreWithoutConnections() bool {
 	return false
 }
 
+// GetHaltExpansionOnImagePullError extracts the flag definition from the
+// globalConfig CR data if present, otherwise returns false.
+func GetHaltExpansionOnImagePullError() bool {
+
+	globalConfigLock.RLock()
+	defer globalConfigLock.RUnlock()
+	if globalConfig != nil && globalConfig.Spec.HaltExpansionOnImagePullError != nil {
+		return *globalConfig.Spec.HaltExpansionOnImagePullError
+	}
+	return false
+}
+
+// GetClusterSpecFragments returns the names of the spec fragment configmaps
+// (in the KubeDirector namespace) to apply to every new virtual cluster, or
+// nil if no config.
+func GetClusterSpecFragments() []string {
+
+	globalConfigLock.RLock()
+	defer globalConfigLock.RUnlock()
+	if globalConfig != nil {
+		return globalConfig.Spec.ClusterSpecFragments
+	}
+	return nil
+}
+
+// GetRejectConflictingChanges extracts the flag definition from the
+// globalConfig CR data if present, otherwise returns false.
+func GetRejectConflictingChanges() bool {
+
+	globalConfigLock.RLock()
+	defer globalConfigLock.RUnlock()
+	if globalConfig != nil && globalConfig.Spec.RejectConflictingChanges != nil {
+		return *globalConfig.Spec.RejectConflictingChanges
+	}
+	return false
+}
+
+// GetRequireShrinkAcknowledgement extracts the flag definition from the
+// globalConfig CR data if present, otherwise returns false.
+func GetRequireShrinkAcknowledgement() bool {
+
+	globalConfigLock.RLock()
+	defer globalConfigLock.RUnlock()
+	if globalConfig != nil && globalConfig.Spec.RequireShrinkAcknowledgement != nil {
+		return *globalConfig.Spec.RequireShrinkAcknowledgement
+	}
+	return false
+}
+
+// GetDeletedPVCRetentionSeconds extracts the retention period for the
+// volume claims of deleted members from the globalConfig CR data if
+// present, otherwise returns zero (no retention).
+func GetDeletedPVCRetentionSeconds() int32 {
+
+	globalConfigLock.RLock()
+	defer globalConfigLock.RUnlock()
+	if globalConfig != nil && globalConfig.Spec.DeletedPVCRetentionSeconds != nil {
+		return *globalConfig.Spec.DeletedPVCRetentionSeconds
+	}
+	return 0
+}
+
+// GetMemberStatusDetailLimit extracts the number of members above which a
+// role's steady-state member statuses are moved out of the cluster status,
+// from the globalConfig CR data if present, otherwise returns zero (never).
+func GetMemberStatusDetailLimit() int32 {
+
+	globalConfigLock.RLock()
+	defer globalConfigLock.RUnlock()
+	if globalConfig != nil && globalConfig.Spec.MemberStatusDetailLimit != nil {
+		return *globalConfig.Spec.MemberStatusDetailLimit
+	}
+	return 0
+}
+
+// GetDefaultImagePullSecrets extracts the names of the image pull secrets
+// to use for roles that do not name their own, from the globalConfig CR
+// data if present, otherwise returns an empty list.
+func GetDefaultImagePullSecrets() []string {
+
+	globalConfigLock.RLock()
+	defer globalConfigLock.RUnlock()
+	if globalConfig != nil {
+		return append([]string{}, globalConfig.Spec.ImagePullSecrets...)
+	}
+	return []string{}
+}
+
+// GetDefaultImagePullPolicy extracts the image pull policy to use for roles
+// that do not set their own, from the globalConfig CR data if present,
+// otherwise returns emptystring (the K8s default).
+func GetDefaultImagePullPolicy() string {
+
+	globalConfigLock.RLock()
+	defer globalConfigLock.RUnlock()
+	if globalConfig != nil && globalConfig.Spec.ImagePullPolicy != nil {
+		return *globalConfig.Spec.ImagePullPolicy
+	}
+	return ""
+}
+
+// GetDefaultPodSecurityContext extracts the default security context for
+// member pods from the globalConfig CR data if present, otherwise returns
+// nil.
+func GetDefaultPodSecurityContext() *corev1.PodSecurityContext {
+
+	globalConfigLock.RLock()
+	defer globalConfigLock.RUnlock()
+	if globalConfig != nil && globalConfig.Spec.PodSecurityContext != nil {
+		return globalConfig.Spec.PodSecurityContext.DeepCopy()
+	}
+	return nil
+}
+
+// GetDefaultInitContainer extracts the default init container settings
+// from the globalConfig CR data if present, otherwise returns nil.
+func GetDefaultInitContainer() *kdv1.InitContainerConfig {
+
+	globalConfigLock.RLock()
+	defer globalConfigLock.RUnlock()
+	if globalConfig != nil && globalConfig.Spec.InitContainer != nil {
+		return globalConfig.Spec.InitContainer.DeepCopy()
+	}
+	return nil
+}
+
+// GetSchedulingDefaults extracts the default pod scheduling settings from
+// the globalConfig CR data if present, otherwise returns nil.
+func GetSchedulingDefaults() *kdv1.SchedulingDefaults {
+
+	globalConfigLock.RLock()
+	defer globalConfigLock.RUnlock()
+	if globalConfig != nil && globalConfig.Spec.SchedulingDefaults != nil {
+		return globalConfig.Spec.SchedulingDefaults.DeepCopy()
+	}
+	return nil
+}
+
+// GetNetworkPolicies extracts the flag definition from the globalConfig CR
+// data if present, otherwise returns false.
+func GetNetworkPolicies() bool {
+
+	globalConfigLock.RLock()
+	defer globalConfigLock.RUnlock()
+	if globalConfig != nil && globalConfig.Spec.NetworkPolicies != nil {
+		return *globalConfig.Spec.NetworkPolicies
+	}
+	return false
+}
+
+// GetCheckConnectionAccess extracts the flag definition from the
+// globalConfig CR data if present, otherwise returns false.
+func GetCheckConnectionAccess() bool {
+
+	globalConfigLock.RLock()
+	defer globalConfigLock.RUnlock()
+	if globalConfig != nil && globalConfig.Spec.CheckConnectionAccess != nil {
+		return *globalConfig.Spec.CheckConnectionAccess
+	}
+	return false
+}
+
+// GetOwnerRefRepairPolicy extracts the owner reference repair policy from
+// the globalConfig CR data if present, otherwise returns
+// OwnerRefRepairReplace.
+func GetOwnerRefRepairPolicy() string {
+
+	globalConfigLock.RLock()
+	defer globalConfigLock.RUnlock()
+	if globalConfig != nil && globalConfig.Spec.OwnerRefRepairPolicy != nil {
+		return *globalConfig.Spec.OwnerRefRepairPolicy
+	}
+	return kdv1.OwnerRefRepairReplace
+}
+
+// GetCacheSetupPackages extracts the flag definition from the globalConfig
+// CR data if present, otherwise returns false.
+func GetCacheSetupPackages() bool {
+
+	globalConfigLock.RLock()
+	defer globalConfigLock.RUnlock()
+	if globalConfig != nil && globalConfig.Spec.CacheSetupPackages != nil {
+		return *globalConfig.Spec.CacheSetupPackages
+	}
+	return false
+}
+
+// GetMembershipApproval extracts the membership change approval policy from
+// the globalConfig CR data if present, otherwise returns ApprovalNone.
+func GetMembershipApproval() string {
+
+	globalConfigLock.RLock()
+	defer globalConfigLock.RUnlock()
+	if globalConfig != nil && globalConfig.Spec.MembershipApproval != nil {
+		return *globalConfig.Spec.MembershipApproval
+	}
+	return kdv1.ApprovalNone
+}
+
+// GetAppAntiAffinity returns a copy of the app anti-affinity policy from
+// the globalConfig CR data if present, otherwise returns nil.
+func GetAppAntiAffinity() *kdv1.AppAntiAffinity {
+
+	globalConfigLock.RLock()
+	defer globalConfigLock.RUnlock()
+	if globalConfig != nil && globalConfig.Spec.AppAntiAffinity != nil {
+		return globalConfig.Spec.AppAntiAffinity.DeepCopy()
+	}
+	return nil
+}
+
+// GetIngressConfig returns a copy of the ingress generation settings from
+// the globalConfig CR data if present, otherwise returns nil.
+func GetIngressConfig() *kdv1.IngressConfig {
+
+	globalConfigLock.RLock()
+	defer globalConfigLock.RUnlock()
+	if globalConfig != nil && globalConfig.Spec.Ingress != nil {
+		return globalConfig.Spec.Ingress.DeepCopy()
+	}
+	return nil
+}
+
+// GetDashboardConfig returns a copy of the dashboard generation settings
+// from the globalConfig CR data if present, otherwise returns nil.
+func GetDashboardConfig() *kdv1.DashboardConfig {
+
+	globalConfigLock.RLock()
+	defer globalConfigLock.RUnlock()
+	if globalConfig != nil && globalConfig.Spec.Dashboards != nil {
+		return globalConfig.Spec.Dashboards.DeepCopy()
+	}
+	return nil
+}
+
+// GetMemberCertsConfig returns a copy of the member certificate settings
+// from the globalConfig CR data if present, otherwise returns nil.
+func GetMemberCertsConfig() *kdv1.MemberCertsConfig {
+
+	globalConfigLock.RLock()
+	defer globalConfigLock.RUnlock()
+	if globalConfig != nil && globalConfig.Spec.MemberCertificates != nil {
+		return globalConfig.Spec.MemberCertificates.DeepCopy()
+	}
+	return nil
+}
+
+// GetLogSinkConfig returns a copy of the log sink settings from the
+// globalConfig CR data if present, otherwise returns nil.
+func GetLogSinkConfig() *kdv1.LogSinkConfig {
+
+	globalConfigLock.RLock()
+	defer globalConfigLock.RUnlock()
+	if globalConfig != nil && globalConfig.Spec.LogSink != nil {
+		return globalConfig.Spec.LogSink.DeepCopy()
+	}
+	return nil
+}
+
+// GetAutoTopologySpread returns a copy of the automatic topology spread
+// policy from the globalConfig CR data if present, otherwise returns nil.
+func GetAutoTopologySpread() *kdv1.AutoTopologySpread {
+
+	globalConfigLock.RLock()
+	defer globalConfigLock.RUnlock()
+	if globalConfig != nil && globalConfig.Spec.AutoTopologySpread != nil {
+		return globalConfig.Spec.AutoTopologySpread.DeepCopy()
+	}
+	return nil
+}
+
+// GetEscalatedWarnings extracts the list of admission warnings that should
+// be treated as errors from the globalConfig CR data if present, otherwise
+// returns an empty list.
+func GetEscalatedWarnings() []string {
+
+	globalConfigLock.RLock()
+	defer globalConfigLock.RUnlock()
+	if globalConfig != nil && globalConfig.Spec.EscalatedWarnings != nil {
+		return append([]string{}, globalConfig.Spec.EscalatedWarnings...)
+	}
+	return []string{}
+}
+
+// GetLintSeverities returns a copy of the per-code lint severities from the
+// globalConfig CR data if present, otherwise returns an empty map.
+func GetLintSeverities() map[string]string {
+
+	globalConfigLock.RLock()
+	defer globalConfigLock.RUnlock()
+	severities := make(map[string]string)
+	if globalConfig != nil {
+		for code, severity := range globalConfig.Spec.LintSeverities {
+			severities[code] = severity
+		}
+	}
+	return severities
+}
+
+// GetRuntimeSocketNamespaces extracts the list of namespaces in which roles
+// may have container runtime socket access from the globalConfig CR data if
+// present, otherwise returns an empty list.
+func GetRuntimeSocketNamespaces() []string {
+
+	globalConfigLock.RLock()
+	defer globalConfigLock.RUnlock()
+	if globalConfig != nil && globalConfig.Spec.RuntimeSocketNamespaces != nil {
+		return append([]string{}, globalConfig.Spec.RuntimeSocketNamespaces...)
+	}
+	return []string{}
+}
+
+// GetDebugImage extracts the debug sidecar image from the globalConfig CR
+// data if present, otherwise returns the default value.
+func GetDebugImage() string {
+
+	globalConfigLock.RLock()
+	defer globalConfigLock.RUnlock()
+	if globalConfig != nil && globalConfig.Spec.DebugImage != nil {
+		return *globalConfig.Spec.DebugImage
+	}
+	return DefaultDebugImage
+}
+
 // RemoveGlobalConfig removes the current globalConfig
 func RemoveGlobalConfig() {
 
@@ -0,0 +1,116 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package shared
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// EncodeMemberStatusDetail produces the content of a member status detail
+// configmap: the gzipped JSON form of the given member statuses.
+func EncodeMemberStatusDetail(
+	members []kdv1.MemberStatus,
+) ([]byte, error) {
+
+	jsonData, jsonErr := json.Marshal(members)
+	if jsonErr != nil {
+		return nil, jsonErr
+	}
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	if _, writeErr := writer.Write(jsonData); writeErr != nil {
+		return nil, writeErr
+	}
+	if closeErr := writer.Close(); closeErr != nil {
+		return nil, closeErr
+	}
+	return buf.Bytes(), nil
+}
+
+// DecodeMemberStatusDetail is the inverse of EncodeMemberStatusDetail.
+func DecodeMemberStatusDetail(
+	data []byte,
+) ([]kdv1.MemberStatus, error) {
+
+	reader, readerErr := gzip.NewReader(bytes.NewReader(data))
+	if readerErr != nil {
+		return nil, readerErr
+	}
+	defer reader.Close()
+	jsonData, readErr := ioutil.ReadAll(reader)
+	if readErr != nil {
+		return nil, readErr
+	}
+	members := make([]kdv1.MemberStatus, 0)
+	if jsonErr := json.Unmarshal(jsonData, &members); jsonErr != nil {
+		return nil, jsonErr
+	}
+	return members, nil
+}
+
+// LoadMemberStatusDetail fills in the complete member lists, in the status
+// of the given in-memory cluster CR, of any roles whose steady-state member
+// statuses have been moved out to a member status detail configmap. Code
+// that needs to see every member of a cluster must call this after fetching
+// the cluster CR.
+func LoadMemberStatusDetail(
+	cr *kdv1.KubeDirectorCluster,
+) error {
+
+	if cr.Status == nil {
+		return nil
+	}
+	for i := range cr.Status.Roles {
+		roleStatus := &(cr.Status.Roles[i])
+		if roleStatus.MemberSummary == nil {
+			continue
+		}
+		cmName := roleStatus.MemberSummary.DetailConfigMap
+		cm := &corev1.ConfigMap{}
+		getErr := Get(
+			context.TODO(),
+			types.NamespacedName{Namespace: cr.Namespace, Name: cmName},
+			cm,
+		)
+		if getErr != nil {
+			return fmt.Errorf(
+				"failed to fetch member status detail configmap{%s}: %v",
+				cmName,
+				getErr,
+			)
+		}
+		members, decodeErr := DecodeMemberStatusDetail(
+			cm.BinaryData[MemberStatusDetailKey],
+		)
+		if decodeErr != nil {
+			return fmt.Errorf(
+				"failed to decode member status detail configmap{%s}: %v",
+				cmName,
+				decodeErr,
+			)
+		}
+		roleStatus.Members = members
+	}
+	return nil
+}
@@ -0,0 +1,195 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package shared
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// KubeDirector's own Prometheus metrics. These are registered with the
+// controller-runtime registry, so they are served on the manager's metrics
+// endpoint alongside the standard controller and client metrics.
+var (
+	reconcileTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kubedirector_reconcile_total",
+			Help: "Number of reconciler passes, by resource kind and result.",
+		},
+		[]string{"kind", "result"},
+	)
+	reconcileDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "kubedirector_reconcile_duration_seconds",
+			Help:    "Duration of reconciler passes, by resource kind.",
+			Buckets: prometheus.ExponentialBuckets(0.01, 2, 14),
+		},
+		[]string{"kind"},
+	)
+	clusterMembers = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "kubedirector_cluster_members",
+			Help: "Number of members of each virtual cluster, by member state.",
+		},
+		[]string{"namespace", "cluster", "state"},
+	)
+	setupFailures = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kubedirector_setup_failures_total",
+			Help: "Number of members whose initial app setup failed, by cluster and role.",
+		},
+		[]string{"namespace", "cluster", "role"},
+	)
+	webhookRejections = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kubedirector_webhook_rejections_total",
+			Help: "Number of requests rejected by the admission webhook, by resource kind and operation.",
+		},
+		[]string{"kind", "operation"},
+	)
+	memberStageDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "kubedirector_member_stage_duration_seconds",
+			Help:    "Time taken by each stage of member provisioning, by app, role, and stage.",
+			Buckets: prometheus.ExponentialBuckets(1, 2, 13),
+		},
+		[]string{"app", "role", "stage"},
+	)
+	extensionFailures = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kubedirector_extension_failures_total",
+			Help: "Number of failed extension hook calls, by extension and hook.",
+		},
+		[]string{"extension", "hook"},
+	)
+	quotaConflicts = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kubedirector_quota_conflicts_total",
+			Help: "Number of new ResourceQuota or LimitRange conflicts blocking the objects of a virtual cluster, by cluster, kind of limit, and resource.",
+		},
+		[]string{"namespace", "cluster", "kind", "resource"},
+	)
+)
+
+func init() {
+
+	metrics.Registry.MustRegister(
+		reconcileTotal,
+		reconcileDuration,
+		clusterMembers,
+		setupFailures,
+		webhookRejections,
+		memberStageDuration,
+		extensionFailures,
+		quotaConflicts,
+	)
+}
+
+// ObserveReconcile records the result and duration of a reconciler pass for
+// a resource of the given kind, which started at the given time.
+func ObserveReconcile(
+	kind string,
+	start time.Time,
+	err error,
+) {
+
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	reconcileTotal.WithLabelValues(kind, result).Inc()
+	reconcileDuration.WithLabelValues(kind).Observe(time.Since(start).Seconds())
+}
+
+// SetClusterMembers publishes the number of members of a virtual cluster in
+// each member state.
+func SetClusterMembers(
+	namespace string,
+	cluster string,
+	countsByState map[string]int,
+) {
+
+	for state, count := range countsByState {
+		clusterMembers.WithLabelValues(namespace, cluster, state).Set(float64(count))
+	}
+}
+
+// DeleteClusterMembers stops publishing member counts for a virtual cluster
+// that has been deleted.
+func DeleteClusterMembers(
+	namespace string,
+	cluster string,
+	states []string,
+) {
+
+	for _, state := range states {
+		clusterMembers.DeleteLabelValues(namespace, cluster, state)
+	}
+}
+
+// CountSetupFailure records a failure of the initial app setup of a member
+// in the given cluster role.
+func CountSetupFailure(
+	namespace string,
+	cluster string,
+	role string,
+) {
+
+	setupFailures.WithLabelValues(namespace, cluster, role).Inc()
+}
+
+// CountWebhookRejection records a request rejected by the admission webhook.
+func CountWebhookRejection(
+	kind string,
+	operation string,
+) {
+
+	webhookRejections.WithLabelValues(kind, operation).Inc()
+}
+
+// ObserveMemberStage records the time taken by a stage of the provisioning
+// of a member in the given app role.
+func ObserveMemberStage(
+	app string,
+	role string,
+	stage string,
+	duration time.Duration,
+) {
+
+	memberStageDuration.WithLabelValues(app, role, stage).Observe(duration.Seconds())
+}
+
+// CountExtensionFailure records a failed call of an extension hook.
+func CountExtensionFailure(
+	extension string,
+	hook string,
+) {
+
+	extensionFailures.WithLabelValues(extension, hook).Inc()
+}
+
+// CountQuotaConflict records a newly seen conflict between the objects of a
+// virtual cluster and a ResourceQuota or LimitRange, for one resource.
+func CountQuotaConflict(
+	namespace string,
+	cluster string,
+	kind string,
+	resource string,
+) {
+
+	quotaConflicts.WithLabelValues(namespace, cluster, kind, resource).Inc()
+}
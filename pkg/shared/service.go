@@ -15,6 +15,7 @@
 package shared
 
 import (
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
 	corev1 "k8s.io/api/core/v1"
 )
 
@@ -34,3 +35,29 @@ func ServiceType(
 
 	return corev1.ServiceTypeNodePort
 }
+
+// MemberSubdomain returns the name of the headless service that provides
+// the DNS subdomain of the members of the given role: the role's own
+// headless service if it has one, otherwise the cluster's.
+func MemberSubdomain(
+	cr *kdv1.KubeDirectorCluster,
+	roleName string,
+) string {
+
+	for _, roleStatus := range cr.Status.Roles {
+		if (roleStatus.Name == roleName) && (roleStatus.Subdomain != "") {
+			return roleStatus.Subdomain
+		}
+	}
+	return cr.Status.ClusterService
+}
+
+// MemberDomain returns the fully qualified DNS domain of the members of the
+// given role; a member's FQDN is its pod name followed by this domain.
+func MemberDomain(
+	cr *kdv1.KubeDirectorCluster,
+	roleName string,
+) string {
+
+	return MemberSubdomain(cr, roleName) + "." + cr.Namespace + GetSvcClusterDomainBase()
+}
@@ -26,6 +26,9 @@ const (
 	// KubeDirectorGlobalConfig is the name of the kubedirector config CR
 	KubeDirectorGlobalConfig = "kd-global-config"
 
+	// KubeDirectorNamespaceConfig is the name of the per-namespace config CR
+	KubeDirectorNamespaceConfig = "kd-namespace-config"
+
 	// KdDomainBase is the prefix for label and annotation keys.
 	KdDomainBase = "kubedirector.hpe.com"
 
@@ -37,10 +40,81 @@ const (
 	// it depends on are being restored from a backup.
 	RestoringLabel = KdDomainBase + "/restoring"
 
+	// CreatorLabel is set on a kdcluster, when it is created, to the
+	// username of the creating user in a form usable as a label value. It is
+	// copied to the member pods, services, and PVCs of the cluster.
+	CreatorLabel = KdDomainBase + "/created-by"
+
 	// StatusBackupAnnotation is the annotation placed on a kdcluster when
 	// writing status, to indicate whether or not a status backup exists.
 	StatusBackupAnnotation = KdDomainBase + "/status-backup-exists"
 
+	// MemberStatusDetailLabel is placed, with a value of "true", on the
+	// configmaps that hold the member statuses of very large roles.
+	MemberStatusDetailLabel = KdDomainBase + "/member-status-detail"
+
+	// MemberStatusDetailKey is the binary data key, in a member status detail
+	// configmap, of the gzipped JSON list of member statuses.
+	MemberStatusDetailKey = "members.json.gz"
+
+	// DebugTTLAnnotation is placed on a kdcluster by an authorized user to
+	// turn on debug mode for the given duration, e.g. "2h".
+	DebugTTLAnnotation = KdDomainBase + "/debug-ttl"
+
+	// DebugExpiresAnnotation is set on a kdcluster, when debug mode is
+	// requested, to the time at which debug mode will expire.
+	DebugExpiresAnnotation = KdDomainBase + "/debug-expires"
+
+	// DebugUserAnnotation is set on a kdcluster, when debug mode is
+	// requested, to the name of the requesting user.
+	DebugUserAnnotation = KdDomainBase + "/debug-user"
+
+	// ApproveGenerationAnnotation is placed on a kdcluster by an authorized
+	// user to approve the membership change requested by the spec
+	// generation given as its value.
+	ApproveGenerationAnnotation = KdDomainBase + "/approve-generation"
+
+	// ApprovedByAnnotation is set on a kdcluster, when a membership change
+	// is approved, to the name of the approving user.
+	ApprovedByAnnotation = KdDomainBase + "/approved-by"
+
+	// PausedAnnotation is placed on a kdcluster, with the value "true", to
+	// stop KubeDirector from changing the cluster's resources or members
+	// while still keeping its status up to date.
+	PausedAnnotation = KdDomainBase + "/paused"
+
+	// CreatorAnnotation is set on a kdcluster, when it is created, to the
+	// JSON-encoded identity (username, uid, groups, and extra) of the
+	// creating user.
+	CreatorAnnotation = KdDomainBase + "/creator"
+
+	// StorageClassAccessModesAnnotation can be set on a storage class by the
+	// K8s admin to a comma-separated list of the PVC access modes (such as
+	// "ReadWriteOnce,ReadWriteMany") that its volumes support.
+	StorageClassAccessModesAnnotation = KdDomainBase + "/accessModes"
+
+	// DefaultDebugImage - default image for the debug sidecar if not
+	// specified in the configCR
+	DefaultDebugImage = "busybox:1.36"
+
+	// DefaultLogShipperImage - default image for the logging sidecar if
+	// not specified in the log sink of the configCR
+	DefaultLogShipperImage = "fluent/fluent-bit:1.9.10"
+
+	// DefaultDinDImage - default image for the docker-in-docker sidecar if
+	// not specified in the runtimeSocket of the role
+	DefaultDinDImage = "docker:24-dind"
+
+	// DefaultDashboardLabel and DefaultDashboardLabelValue - default label
+	// for generated dashboard configmaps, as looked for by the Grafana
+	// sidecar, if not specified in the dashboards of the configCR
+	DefaultDashboardLabel      = "grafana_dashboard"
+	DefaultDashboardLabelValue = "1"
+
+	// DefaultDashboardDatasource - default Grafana datasource for generated
+	// dashboards if not specified in the dashboards of the configCR
+	DefaultDashboardDatasource = "Prometheus"
+
 	// DefaultServiceType - default service type if not specified in
 	// the configCR
 	DefaultServiceType = "LoadBalancer"
@@ -66,13 +140,36 @@ const (
 
 // Event reason constants for recording events
 const (
-	EventReasonNoEvent   = ""
-	EventReasonCluster   = "Cluster"
-	EventReasonRole      = "Role"
-	EventReasonMember    = "Member"
-	EventReasonConfig    = "Config"
-	EventReasonConfigMap = "ConfigMap"
-	EventReasonSecret    = "Secret"
+	EventReasonNoEvent    = ""
+	EventReasonCluster    = "Cluster"
+	EventReasonRole       = "Role"
+	EventReasonMember     = "Member"
+	EventReasonConfig     = "Config"
+	EventReasonConfigMap  = "ConfigMap"
+	EventReasonSecret     = "Secret"
+	EventReasonClusterJob = "ClusterJob"
+	EventReasonBackup     = "Backup"
+)
+
+// Event reason constants for the lifecycle transitions of a member, so that
+// each kind of transition can be selected by reason. Other member events
+// use EventReasonMember.
+const (
+	EventReasonMemberCreated            = "MemberCreated"
+	EventReasonMemberScheduled          = "MemberScheduled"
+	EventReasonMemberStorageInitialized = "MemberStorageInitialized"
+	EventReasonMemberStorageInitFailed  = "MemberStorageInitFailed"
+	EventReasonMemberConfigStarted      = "MemberConfigStarted"
+	EventReasonMemberConfigured         = "MemberConfigured"
+	EventReasonMemberConfigFailed       = "MemberConfigFailed"
+	EventReasonMemberNotified           = "MemberNotified"
+	EventReasonMemberNotifyFailed       = "MemberNotifyFailed"
+	EventReasonMemberDecommissioning    = "MemberDecommissioning"
+	EventReasonMemberDecommissioned     = "MemberDecommissioned"
+	EventReasonMemberDecommissionFailed = "MemberDecommissionFailed"
+	EventReasonMemberStopping           = "MemberStopping"
+	EventReasonMemberStopFailed         = "MemberStopFailed"
+	EventReasonMemberDeleting           = "MemberDeleting"
 )
 
 // Settings for appCatalog
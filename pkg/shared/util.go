@@ -17,6 +17,7 @@ package shared
 import (
 	"fmt"
 	"os"
+	"strings"
 
 	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -112,6 +113,94 @@ func OwnerReferencesPresent(
 	return false
 }
 
+// RepairedOwnerReferences returns the owner references that an object
+// missing its reference to the CR should be given, according to the given
+// owner reference repair policy. The returned boolean is false if the
+// policy is to leave the object alone.
+func RepairedOwnerReferences(
+	cr KubeDirectorObject,
+	currentRefs []metav1.OwnerReference,
+	policy string,
+) ([]metav1.OwnerReference, bool) {
+
+	switch policy {
+	case kdv1.OwnerRefRepairReportOnly:
+		return currentRefs, false
+	case kdv1.OwnerRefRepairMerge:
+		desiredRef := OwnerReferences(cr)[0]
+		notController := false
+		result := []metav1.OwnerReference{desiredRef}
+		for _, ref := range currentRefs {
+			if ref.UID == desiredRef.UID {
+				continue
+			}
+			if (ref.Controller != nil) && *ref.Controller {
+				ref.Controller = &notController
+			}
+			result = append(result, ref)
+		}
+		return result, true
+	default:
+		return OwnerReferences(cr), true
+	}
+}
+
+// DescribeOwnerReferences returns a readable list of the given owner
+// references, for logging.
+func DescribeOwnerReferences(
+	refs []metav1.OwnerReference,
+) string {
+
+	if len(refs) == 0 {
+		return "none"
+	}
+	descs := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		desc := fmt.Sprintf("%s/%s(uid %s)", ref.Kind, ref.Name, ref.UID)
+		if (ref.Controller != nil) && *ref.Controller {
+			desc += " controller"
+		}
+		descs = append(descs, desc)
+	}
+	return strings.Join(descs, ", ")
+}
+
+// ReservedLabelKey checks whether the given label key is one that
+// KubeDirector or the statefulset controller sets on member pods and
+// services. Such labels are used in selectors, so they must never be
+// propagated from the cluster CR.
+func ReservedLabelKey(
+	key string,
+) bool {
+
+	if strings.HasPrefix(key, KdDomainBase+"/") {
+		return true
+	}
+	if strings.HasPrefix(key, "statefulset.kubernetes.io/") {
+		return true
+	}
+	return key == "controller-revision-hash"
+}
+
+// PropagatedLabels returns the labels of the given cluster CR whose keys
+// are listed in its propagateLabels property. Labels with reserved keys are
+// never included.
+func PropagatedLabels(
+	cr *kdv1.KubeDirectorCluster,
+) map[string]string {
+
+	result := make(map[string]string)
+	for _, key := range cr.Spec.PropagateLabels {
+		if ReservedLabelKey(key) {
+			continue
+		}
+		if value, ok := cr.Labels[key]; ok {
+			result[key] = value
+		}
+	}
+	return result
+}
+
 // GetLastLines returns few last whole lines of
 // the input src string that are included
 // into the last maxSize characters of src
@@ -136,3 +225,11 @@ func GetLastLines(
 	}
 	return src[start:]
 }
+
+// ShellQuote quotes the given string as a single word for the shell.
+func ShellQuote(
+	value string,
+) string {
+
+	return "'" + strings.Replace(value, "'", `'\''`, -1) + "'"
+}
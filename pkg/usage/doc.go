@@ -0,0 +1,22 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package usage takes a snapshot of the resource usage of virtual cluster
+// members, in the style of "kubectl top". Usage is read from the K8s
+// metrics API (usually served by metrics-server), summed per member, role,
+// and cluster, and compared with each member's declared resources so that
+// hot members stand out.
+//
+// Snapshots are taken by "kd top".
+package usage
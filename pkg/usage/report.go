@@ -0,0 +1,126 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package usage
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+)
+
+// WriteText writes the report as tables in the style of "kubectl top": one
+// line per member, followed by the totals for each role.
+func (r *Report) WriteText(
+	w io.Writer,
+) error {
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "CLUSTER\tROLE\tMEMBER\tSTATE\tCPU(cores)\tCPU%\tMEMORY(bytes)\tMEMORY%\tHOT")
+	for _, cluster := range r.Clusters {
+		for _, role := range cluster.Roles {
+			for _, member := range role.Members {
+				cpu, memory := formatCPU(member.CPUMillis), formatMemory(member.MemoryBytes)
+				if member.NoMetrics {
+					cpu, memory = "<unknown>", "<unknown>"
+				}
+				hot := ""
+				if member.Hot {
+					hot = "*"
+				}
+				fmt.Fprintf(
+					tw,
+					"%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+					cluster.Name,
+					role.Name,
+					member.Pod,
+					member.State,
+					cpu,
+					formatPercent(member.CPUPercent),
+					memory,
+					formatPercent(member.MemoryPercent),
+					hot,
+				)
+			}
+		}
+	}
+	if flushErr := tw.Flush(); flushErr != nil {
+		return flushErr
+	}
+
+	fmt.Fprintln(w)
+	tw = tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "CLUSTER\tROLE\tCPU(cores)\tMEMORY(bytes)\tHOT MEMBERS")
+	for _, cluster := range r.Clusters {
+		for _, role := range cluster.Roles {
+			fmt.Fprintf(
+				tw,
+				"%s\t%s\t%s\t%s\t%d\n",
+				cluster.Name,
+				role.Name,
+				formatCPU(role.CPUMillis),
+				formatMemory(role.MemoryBytes),
+				role.HotMembers,
+			)
+		}
+		fmt.Fprintf(
+			tw,
+			"%s\t%s\t%s\t%s\t%d\n",
+			cluster.Name,
+			"(all)",
+			formatCPU(cluster.CPUMillis),
+			formatMemory(cluster.MemoryBytes),
+			cluster.HotMembers,
+		)
+	}
+	return tw.Flush()
+}
+
+// WriteJSON writes the report as indented JSON.
+func (r *Report) WriteJSON(
+	w io.Writer,
+) error {
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
+
+// formatCPU formats millicores the way "kubectl top" does.
+func formatCPU(
+	millis int64,
+) string {
+
+	return fmt.Sprintf("%dm", millis)
+}
+
+// formatMemory formats bytes the way "kubectl top" does.
+func formatMemory(
+	bytes int64,
+) string {
+
+	return fmt.Sprintf("%dMi", bytes/(1024*1024))
+}
+
+// formatPercent formats a usage percentage, which may be unknown.
+func formatPercent(
+	percent int64,
+) string {
+
+	if percent == noPercent {
+		return "-"
+	}
+	return fmt.Sprintf("%d%%", percent)
+}
@@ -0,0 +1,96 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package usage
+
+import (
+	"time"
+)
+
+// Orders in which the members of each role can be listed.
+const (
+	SortName   = "name"
+	SortCPU    = "cpu"
+	SortMemory = "memory"
+)
+
+const (
+	// DefaultThreshold is the default usage percentage at or above which a
+	// member is considered hot.
+	DefaultThreshold = 80
+
+	// noPercent is used as a usage percentage when the member declares no
+	// limit or request to compare with.
+	noPercent = -1
+)
+
+// Options controls a usage snapshot. Namespace holds the virtual clusters
+// to report on; if Cluster is set, only that cluster is included. SortBy is
+// one of the Sort constants. CPUThreshold and MemoryThreshold are
+// percentages of the limits (or, if there are none, the requests) of a
+// member's app container; a member whose app container uses at least that
+// much of either is hot. A threshold of zero is not checked. If HotOnly is
+// true, members that are not hot are left out of the report.
+type Options struct {
+	Namespace       string
+	Cluster         string
+	SortBy          string
+	CPUThreshold    int64
+	MemoryThreshold int64
+	HotOnly         bool
+}
+
+// MemberUsage is the resource usage of one member, summed over all of its
+// containers. CPUPercent and MemoryPercent are for the app container alone,
+// compared with its limits or requests, and are -1 if there is nothing to
+// compare with. NoMetrics is true if the metrics API has nothing for the
+// member yet, for example because its pod has only just started.
+type MemberUsage struct {
+	Pod           string `json:"pod"`
+	State         string `json:"state"`
+	CPUMillis     int64  `json:"cpuMillis"`
+	MemoryBytes   int64  `json:"memoryBytes"`
+	CPUPercent    int64  `json:"cpuPercent"`
+	MemoryPercent int64  `json:"memoryPercent"`
+	Hot           bool   `json:"hot"`
+	NoMetrics     bool   `json:"noMetrics,omitempty"`
+}
+
+// RoleUsage is the total resource usage of the members of a role, and the
+// usage of each member.
+type RoleUsage struct {
+	Name        string        `json:"name"`
+	CPUMillis   int64         `json:"cpuMillis"`
+	MemoryBytes int64         `json:"memoryBytes"`
+	HotMembers  int           `json:"hotMembers"`
+	Members     []MemberUsage `json:"members"`
+}
+
+// ClusterUsage is the total resource usage of a virtual cluster, and the
+// usage of each of its roles.
+type ClusterUsage struct {
+	Name        string      `json:"name"`
+	App         string      `json:"app"`
+	CPUMillis   int64       `json:"cpuMillis"`
+	MemoryBytes int64       `json:"memoryBytes"`
+	HotMembers  int         `json:"hotMembers"`
+	Roles       []RoleUsage `json:"roles"`
+}
+
+// Report is a usage snapshot of the virtual clusters in a namespace.
+type Report struct {
+	Namespace string         `json:"namespace"`
+	Time      time.Time      `json:"time"`
+	Clusters  []ClusterUsage `json:"clusters"`
+}
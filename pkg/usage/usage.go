@@ -0,0 +1,289 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package usage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	"github.com/bluek8s/kubedirector/pkg/executor"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// podMetricsListKind identifies the list of pod metrics in the metrics API.
+// It is read as unstructured content, so that KubeDirector does not need
+// the metrics API client.
+var podMetricsListKind = schema.GroupVersionKind{
+	Group:   "metrics.k8s.io",
+	Version: "v1beta1",
+	Kind:    "PodMetricsList",
+}
+
+// containerUsage is the CPU (in millicores) and memory (in bytes) used by
+// one container.
+type containerUsage struct {
+	cpuMillis   int64
+	memoryBytes int64
+}
+
+// Snapshot reads the current resource usage of the members of the virtual
+// clusters selected by opts.
+func Snapshot(
+	c client.Client,
+	opts Options,
+) (*Report, error) {
+
+	var clusters []kdv1.KubeDirectorCluster
+	if opts.Cluster != "" {
+		cr := kdv1.KubeDirectorCluster{}
+		getErr := c.Get(
+			context.TODO(),
+			types.NamespacedName{Namespace: opts.Namespace, Name: opts.Cluster},
+			&cr,
+		)
+		if getErr != nil {
+			return nil, getErr
+		}
+		clusters = append(clusters, cr)
+	} else {
+		crList := kdv1.KubeDirectorClusterList{}
+		listErr := c.List(context.TODO(), &crList, client.InNamespace(opts.Namespace))
+		if listErr != nil {
+			return nil, listErr
+		}
+		clusters = crList.Items
+	}
+
+	podUsage, metricsErr := readPodMetrics(c, opts.Namespace)
+	if metricsErr != nil {
+		return nil, metricsErr
+	}
+
+	report := &Report{
+		Namespace: opts.Namespace,
+		Time:      time.Now(),
+	}
+	for i := range clusters {
+		report.Clusters = append(
+			report.Clusters,
+			clusterUsage(&clusters[i], podUsage, opts),
+		)
+	}
+	sort.Slice(
+		report.Clusters,
+		func(i, j int) bool {
+			return report.Clusters[i].Name < report.Clusters[j].Name
+		},
+	)
+	return report, nil
+}
+
+// readPodMetrics returns the usage of each container of each pod in the
+// namespace, by pod name and then container name.
+func readPodMetrics(
+	c client.Client,
+	namespace string,
+) (map[string]map[string]containerUsage, error) {
+
+	metricsList := &unstructured.UnstructuredList{}
+	metricsList.SetGroupVersionKind(podMetricsListKind)
+	listErr := c.List(context.TODO(), metricsList, client.InNamespace(namespace))
+	if listErr != nil {
+		return nil, fmt.Errorf(
+			"cannot read pod metrics (is metrics-server installed?): %v",
+			listErr,
+		)
+	}
+	result := make(map[string]map[string]containerUsage)
+	for _, item := range metricsList.Items {
+		containers, _, _ := unstructured.NestedSlice(item.Object, "containers")
+		podUsage := make(map[string]containerUsage)
+		for _, container := range containers {
+			containerMap, ok := container.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			name, _, _ := unstructured.NestedString(containerMap, "name")
+			usage, _, _ := unstructured.NestedStringMap(containerMap, "usage")
+			var used containerUsage
+			if cpu, parseErr := resource.ParseQuantity(usage["cpu"]); parseErr == nil {
+				used.cpuMillis = cpu.MilliValue()
+			}
+			if memory, parseErr := resource.ParseQuantity(usage["memory"]); parseErr == nil {
+				used.memoryBytes = memory.Value()
+			}
+			podUsage[name] = used
+		}
+		result[item.GetName()] = podUsage
+	}
+	return result, nil
+}
+
+// clusterUsage totals the usage of the members of a virtual cluster.
+func clusterUsage(
+	cr *kdv1.KubeDirectorCluster,
+	podUsage map[string]map[string]containerUsage,
+	opts Options,
+) ClusterUsage {
+
+	result := ClusterUsage{
+		Name: cr.Name,
+		App:  cr.Spec.AppID,
+	}
+	if cr.Status == nil {
+		return result
+	}
+	roleSpecs := make(map[string]*kdv1.Role)
+	for i := range cr.Spec.Roles {
+		roleSpecs[cr.Spec.Roles[i].Name] = &(cr.Spec.Roles[i])
+	}
+	for _, roleStatus := range cr.Status.Roles {
+		role := RoleUsage{Name: roleStatus.Name}
+		for _, member := range roleStatus.Members {
+			memberUsage := usageForMember(
+				roleSpecs[roleStatus.Name],
+				member.Pod,
+				member.State,
+				podUsage,
+				opts,
+			)
+			role.CPUMillis += memberUsage.CPUMillis
+			role.MemoryBytes += memberUsage.MemoryBytes
+			if memberUsage.Hot {
+				role.HotMembers++
+			} else if opts.HotOnly {
+				continue
+			}
+			role.Members = append(role.Members, memberUsage)
+		}
+		sortMembers(role.Members, opts.SortBy)
+		result.CPUMillis += role.CPUMillis
+		result.MemoryBytes += role.MemoryBytes
+		result.HotMembers += role.HotMembers
+		result.Roles = append(result.Roles, role)
+	}
+	return result
+}
+
+// usageForMember works out the usage of one member, and whether it is hot.
+// The role spec may be nil if the role is being removed.
+func usageForMember(
+	role *kdv1.Role,
+	pod string,
+	state string,
+	podUsage map[string]map[string]containerUsage,
+	opts Options,
+) MemberUsage {
+
+	result := MemberUsage{
+		Pod:           pod,
+		State:         state,
+		CPUPercent:    noPercent,
+		MemoryPercent: noPercent,
+	}
+	containers, ok := podUsage[pod]
+	if !ok {
+		result.NoMetrics = true
+		return result
+	}
+	for _, used := range containers {
+		result.CPUMillis += used.cpuMillis
+		result.MemoryBytes += used.memoryBytes
+	}
+	app, ok := containers[executor.AppContainerName]
+	if !ok || (role == nil) {
+		return result
+	}
+	if capacity, ok := capacityOf(&role.Resources, corev1.ResourceCPU); ok {
+		result.CPUPercent = percentOf(app.cpuMillis, capacity.MilliValue())
+	}
+	if capacity, ok := capacityOf(&role.Resources, corev1.ResourceMemory); ok {
+		result.MemoryPercent = percentOf(app.memoryBytes, capacity.Value())
+	}
+	result.Hot = overThreshold(result.CPUPercent, opts.CPUThreshold) ||
+		overThreshold(result.MemoryPercent, opts.MemoryThreshold)
+	return result
+}
+
+// capacityOf returns the limit of the given resource, or the request if
+// there is no limit.
+func capacityOf(
+	resources *corev1.ResourceRequirements,
+	name corev1.ResourceName,
+) (resource.Quantity, bool) {
+
+	if limit, ok := resources.Limits[name]; ok && !limit.IsZero() {
+		return limit, true
+	}
+	if request, ok := resources.Requests[name]; ok && !request.IsZero() {
+		return request, true
+	}
+	return resource.Quantity{}, false
+}
+
+// percentOf returns used as a whole percentage of capacity.
+func percentOf(
+	used int64,
+	capacity int64,
+) int64 {
+
+	if capacity <= 0 {
+		return noPercent
+	}
+	return (used * 100) / capacity
+}
+
+// overThreshold checks a usage percentage against a threshold; a zero
+// threshold, or an unknown percentage, never counts.
+func overThreshold(
+	percent int64,
+	threshold int64,
+) bool {
+
+	return (threshold > 0) && (percent != noPercent) && (percent >= threshold)
+}
+
+// sortMembers orders the members of a role: by name, or with the biggest
+// users of CPU or memory first.
+func sortMembers(
+	members []MemberUsage,
+	sortBy string,
+) {
+
+	sort.SliceStable(
+		members,
+		func(i, j int) bool {
+			switch sortBy {
+			case SortCPU:
+				if members[i].CPUMillis != members[j].CPUMillis {
+					return members[i].CPUMillis > members[j].CPUMillis
+				}
+			case SortMemory:
+				if members[i].MemoryBytes != members[j].MemoryBytes {
+					return members[i].MemoryBytes > members[j].MemoryBytes
+				}
+			}
+			return members[i].Pod < members[j].Pod
+		},
+	)
+}
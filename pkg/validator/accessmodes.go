@@ -0,0 +1,138 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validator
+
+import (
+	"fmt"
+
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	"github.com/bluek8s/kubedirector/pkg/observer"
+	"github.com/bluek8s/kubedirector/pkg/shared"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+)
+
+// validateRoleAccessModes checks the access modes requested for the storage
+// and block storage claims of each new role, or role whose access modes are
+// changing (which validateSpecChange rejects if the role has members). Any
+// mode other than ReadWriteOnce must be declared as supported by the claim's
+// storage class, and the storage claim must be writable. This relies on
+// validateRoleStorageClass having defaulted the storage class. Any generated
+// error messages will be added to the input list and returned.
+func validateRoleAccessModes(
+	cr *kdv1.KubeDirectorCluster,
+	prevCr *kdv1.KubeDirectorCluster,
+	valErrors []string,
+) []string {
+
+	prevRoles := make(map[string]*kdv1.Role)
+	for i := range prevCr.Spec.Roles {
+		prevRoles[prevCr.Spec.Roles[i].Name] = &(prevCr.Spec.Roles[i])
+	}
+	for i := range cr.Spec.Roles {
+		role := &(cr.Spec.Roles[i])
+		prevRole := prevRoles[role.Name]
+		if role.Storage != nil {
+			var prevModes []string
+			if (prevRole != nil) && (prevRole.Storage != nil) {
+				prevModes = prevRole.Storage.AccessModes
+			}
+			if !equality.Semantic.DeepEqual(role.Storage.AccessModes, prevModes) {
+				if (len(role.Storage.AccessModes) != 0) &&
+					!shared.StringInList(string(corev1.ReadWriteOnce), role.Storage.AccessModes) &&
+					!shared.StringInList(string(corev1.ReadWriteMany), role.Storage.AccessModes) {
+					valErrors = append(
+						valErrors,
+						fmt.Sprintf(storageNotWritable, role.Name),
+					)
+				}
+				valErrors = validateClaimAccessModes(
+					role.Name,
+					"storage",
+					role.Storage.StorageClass,
+					role.Storage.AccessModes,
+					valErrors,
+				)
+			}
+		}
+		if role.BlockStorage != nil {
+			var prevModes []string
+			if (prevRole != nil) && (prevRole.BlockStorage != nil) {
+				prevModes = prevRole.BlockStorage.AccessModes
+			}
+			if !equality.Semantic.DeepEqual(role.BlockStorage.AccessModes, prevModes) {
+				valErrors = validateClaimAccessModes(
+					role.Name,
+					"blockStorage",
+					role.BlockStorage.StorageClass,
+					role.BlockStorage.AccessModes,
+					valErrors,
+				)
+			}
+		}
+	}
+	return valErrors
+}
+
+// validateClaimAccessModes checks that the storage class of a claim (the
+// K8s default class if none is named) declares support for each of the
+// requested access modes other than ReadWriteOnce. Any generated error
+// messages will be added to the input list and returned.
+func validateClaimAccessModes(
+	roleName string,
+	claimKind string,
+	storageClassName *string,
+	modes []string,
+	valErrors []string,
+) []string {
+
+	var unusual []string
+	for _, mode := range modes {
+		if mode != string(corev1.ReadWriteOnce) {
+			unusual = append(unusual, mode)
+		}
+	}
+	if len(unusual) == 0 {
+		return valErrors
+	}
+	var storageClass *storagev1.StorageClass
+	if storageClassName != nil {
+		storageClass, _ = observer.GetStorageClass(*storageClassName)
+	} else {
+		storageClass, _ = observer.GetDefaultStorageClass()
+	}
+	if storageClass == nil {
+		// A bad or missing storage class for the storage claim is reported
+		// by validateRoleStorageClass; for block storage, K8s will report it.
+		return valErrors
+	}
+	for _, mode := range unusual {
+		if !storageClassSupports(storageClass, corev1.PersistentVolumeAccessMode(mode)) {
+			valErrors = append(
+				valErrors,
+				fmt.Sprintf(
+					unsupportedAccessMode,
+					claimKind,
+					roleName,
+					mode,
+					storageClass.Name,
+					shared.StorageClassAccessModesAnnotation,
+				),
+			)
+		}
+	}
+	return valErrors
+}
@@ -0,0 +1,445 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validator
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8svalidation "k8s.io/apimachinery/pkg/util/validation"
+)
+
+// validateRoleAffinity checks the affinity stanza of each role for content
+// that the apiserver would reject when the statefulset controller tries to
+// create member pods: bad label keys, unknown operators, wrong value counts,
+// bad topology keys, and out-of-range weights. Catching these here gives
+// the user an immediate error rather than a role that silently never gets
+// any pods.
+func validateRoleAffinity(
+	cr *kdv1.KubeDirectorCluster,
+	valErrors []string,
+) []string {
+
+	for _, role := range cr.Spec.Roles {
+		if role.Affinity == nil {
+			continue
+		}
+		var problems []string
+		if role.Affinity.NodeAffinity != nil {
+			problems = append(
+				problems,
+				checkNodeAffinity(role.Affinity.NodeAffinity, "nodeAffinity")...,
+			)
+		}
+		if role.Affinity.PodAffinity != nil {
+			problems = append(
+				problems,
+				checkPodAffinityTerms(
+					role.Affinity.PodAffinity.RequiredDuringSchedulingIgnoredDuringExecution,
+					role.Affinity.PodAffinity.PreferredDuringSchedulingIgnoredDuringExecution,
+					"podAffinity",
+				)...,
+			)
+		}
+		if role.Affinity.PodAntiAffinity != nil {
+			problems = append(
+				problems,
+				checkPodAffinityTerms(
+					role.Affinity.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution,
+					role.Affinity.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution,
+					"podAntiAffinity",
+				)...,
+			)
+		}
+		for _, problem := range problems {
+			valErrors = append(
+				valErrors,
+				fmt.Sprintf(invalidAffinity, role.Name, problem),
+			)
+		}
+	}
+
+	return valErrors
+}
+
+// validateRoleNodePlacement checks the tolerations, nodeSelector, runtime
+// class name, and topology spread constraints of each role, for the same
+// reason as validateRoleAffinity: content that the apiserver would reject
+// in a pod spec should be caught up front.
+func validateRoleNodePlacement(
+	cr *kdv1.KubeDirectorCluster,
+	valErrors []string,
+) []string {
+
+	for _, role := range cr.Spec.Roles {
+		for _, problem := range checkTolerations(role.Tolerations, "tolerations") {
+			valErrors = append(
+				valErrors,
+				fmt.Sprintf(invalidTolerations, role.Name, problem),
+			)
+		}
+		for key, value := range role.NodeSelector {
+			var problems []string
+			problems = append(problems, k8svalidation.IsQualifiedName(key)...)
+			problems = append(problems, k8svalidation.IsValidLabelValue(value)...)
+			for _, problem := range problems {
+				valErrors = append(
+					valErrors,
+					fmt.Sprintf(
+						invalidNodeSelector,
+						role.Name,
+						fmt.Sprintf("%s(%s): %s", key, value, problem),
+					),
+				)
+			}
+		}
+		if role.RuntimeClassName != "" {
+			for _, problem := range k8svalidation.IsDNS1123Subdomain(role.RuntimeClassName) {
+				valErrors = append(
+					valErrors,
+					fmt.Sprintf(invalidRuntimeClass, role.Name, problem),
+				)
+			}
+		}
+		for _, problem := range checkTopologySpread(role.TopologySpread, "topologySpreadConstraints") {
+			valErrors = append(
+				valErrors,
+				fmt.Sprintf(invalidTopologySpread, role.Name, problem),
+			)
+		}
+	}
+
+	return valErrors
+}
+
+// checkTopologySpread returns a description of each problem found in the
+// given topology spread constraints. A constraint may omit the label
+// selector, in which case KubeDirector fills in one that selects the
+// members of the role.
+func checkTopologySpread(
+	constraints []core.TopologySpreadConstraint,
+	path string,
+) []string {
+
+	var problems []string
+	for i, constraint := range constraints {
+		constraintPath := fmt.Sprintf("%s[%d]", path, i)
+		if constraint.MaxSkew < 1 {
+			problems = append(
+				problems,
+				fmt.Sprintf("%s.maxSkew: must be greater than zero", constraintPath),
+			)
+		}
+		if constraint.TopologyKey == "" {
+			problems = append(problems, constraintPath+".topologyKey: must be specified")
+		} else {
+			for _, msg := range k8svalidation.IsQualifiedName(constraint.TopologyKey) {
+				problems = append(
+					problems,
+					fmt.Sprintf("%s.topologyKey(%s): %s", constraintPath, constraint.TopologyKey, msg),
+				)
+			}
+		}
+		switch constraint.WhenUnsatisfiable {
+		case core.DoNotSchedule, core.ScheduleAnyway:
+			// Valid action.
+		default:
+			problems = append(
+				problems,
+				fmt.Sprintf(
+					"%s.whenUnsatisfiable: unknown action(%s)",
+					constraintPath,
+					constraint.WhenUnsatisfiable,
+				),
+			)
+		}
+		if constraint.LabelSelector != nil {
+			if _, selectorErr := metav1.LabelSelectorAsSelector(constraint.LabelSelector); selectorErr != nil {
+				problems = append(
+					problems,
+					fmt.Sprintf("%s.labelSelector: %s", constraintPath, selectorErr.Error()),
+				)
+			}
+		}
+	}
+	return problems
+}
+
+// checkTolerations returns a description of each problem found in the
+// given tolerations.
+func checkTolerations(
+	tolerations []core.Toleration,
+	path string,
+) []string {
+
+	var problems []string
+	for i, toleration := range tolerations {
+		tolerationPath := fmt.Sprintf("%s[%d]", path, i)
+		if toleration.Key != "" {
+			for _, msg := range k8svalidation.IsQualifiedName(toleration.Key) {
+				problems = append(
+					problems,
+					fmt.Sprintf("%s.key(%s): %s", tolerationPath, toleration.Key, msg),
+				)
+			}
+		}
+		switch toleration.Operator {
+		case core.TolerationOpEqual, "":
+			for _, msg := range k8svalidation.IsValidLabelValue(toleration.Value) {
+				problems = append(
+					problems,
+					fmt.Sprintf("%s.value(%s): %s", tolerationPath, toleration.Value, msg),
+				)
+			}
+			if toleration.Key == "" {
+				problems = append(
+					problems,
+					fmt.Sprintf("%s.key: must be non-empty for operator Equal", tolerationPath),
+				)
+			}
+		case core.TolerationOpExists:
+			if toleration.Value != "" {
+				problems = append(
+					problems,
+					fmt.Sprintf("%s.value: must be empty for operator Exists", tolerationPath),
+				)
+			}
+		default:
+			problems = append(
+				problems,
+				fmt.Sprintf("%s.operator: unknown operator(%s)", tolerationPath, toleration.Operator),
+			)
+		}
+		switch toleration.Effect {
+		case core.TaintEffectNoSchedule, core.TaintEffectPreferNoSchedule, "":
+			if toleration.TolerationSeconds != nil {
+				problems = append(
+					problems,
+					fmt.Sprintf("%s.tolerationSeconds: only allowed for effect NoExecute", tolerationPath),
+				)
+			}
+		case core.TaintEffectNoExecute:
+			// Any tolerationSeconds value is OK.
+		default:
+			problems = append(
+				problems,
+				fmt.Sprintf("%s.effect: unknown effect(%s)", tolerationPath, toleration.Effect),
+			)
+		}
+	}
+	return problems
+}
+
+// checkNodeAffinity returns a description of each problem found in the
+// given node affinity.
+func checkNodeAffinity(
+	nodeAffinity *core.NodeAffinity,
+	path string,
+) []string {
+
+	var problems []string
+	required := nodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution
+	if required != nil {
+		requiredPath := path + ".requiredDuringSchedulingIgnoredDuringExecution"
+		if len(required.NodeSelectorTerms) == 0 {
+			problems = append(
+				problems,
+				requiredPath+".nodeSelectorTerms: must have at least one term",
+			)
+		}
+		for i, term := range required.NodeSelectorTerms {
+			problems = append(
+				problems,
+				checkNodeSelectorTerm(
+					term,
+					fmt.Sprintf("%s.nodeSelectorTerms[%d]", requiredPath, i),
+				)...,
+			)
+		}
+	}
+	for i, preferred := range nodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution {
+		preferredPath := fmt.Sprintf(
+			"%s.preferredDuringSchedulingIgnoredDuringExecution[%d]",
+			path,
+			i,
+		)
+		problems = append(problems, checkWeight(preferred.Weight, preferredPath)...)
+		problems = append(
+			problems,
+			checkNodeSelectorTerm(preferred.Preference, preferredPath+".preference")...,
+		)
+	}
+	return problems
+}
+
+// checkNodeSelectorTerm returns a description of each problem found in the
+// given node selector term.
+func checkNodeSelectorTerm(
+	term core.NodeSelectorTerm,
+	path string,
+) []string {
+
+	var problems []string
+	for i, req := range term.MatchExpressions {
+		reqPath := fmt.Sprintf("%s.matchExpressions[%d]", path, i)
+		for _, msg := range k8svalidation.IsQualifiedName(req.Key) {
+			problems = append(problems, fmt.Sprintf("%s.key(%s): %s", reqPath, req.Key, msg))
+		}
+		switch req.Operator {
+		case core.NodeSelectorOpIn, core.NodeSelectorOpNotIn:
+			if len(req.Values) == 0 {
+				problems = append(
+					problems,
+					fmt.Sprintf("%s.values: must be non-empty for operator %s", reqPath, req.Operator),
+				)
+			}
+		case core.NodeSelectorOpExists, core.NodeSelectorOpDoesNotExist:
+			if len(req.Values) != 0 {
+				problems = append(
+					problems,
+					fmt.Sprintf("%s.values: must be empty for operator %s", reqPath, req.Operator),
+				)
+			}
+		case core.NodeSelectorOpGt, core.NodeSelectorOpLt:
+			if len(req.Values) != 1 {
+				problems = append(
+					problems,
+					fmt.Sprintf("%s.values: must have exactly one element for operator %s", reqPath, req.Operator),
+				)
+			} else if _, convErr := strconv.ParseInt(req.Values[0], 10, 64); convErr != nil {
+				problems = append(
+					problems,
+					fmt.Sprintf("%s.values: must be an integer for operator %s", reqPath, req.Operator),
+				)
+			}
+		default:
+			problems = append(
+				problems,
+				fmt.Sprintf("%s.operator: unknown operator(%s)", reqPath, req.Operator),
+			)
+		}
+	}
+	for i, req := range term.MatchFields {
+		reqPath := fmt.Sprintf("%s.matchFields[%d]", path, i)
+		if req.Key != "metadata.name" {
+			problems = append(
+				problems,
+				fmt.Sprintf("%s.key(%s): only metadata.name is supported", reqPath, req.Key),
+			)
+		}
+		if (req.Operator != core.NodeSelectorOpIn) && (req.Operator != core.NodeSelectorOpNotIn) {
+			problems = append(
+				problems,
+				fmt.Sprintf("%s.operator: must be In or NotIn", reqPath),
+			)
+		}
+		if len(req.Values) != 1 {
+			problems = append(
+				problems,
+				fmt.Sprintf("%s.values: must have exactly one element", reqPath),
+			)
+		}
+	}
+	return problems
+}
+
+// checkPodAffinityTerms returns a description of each problem found in the
+// given required and preferred pod (anti-)affinity terms.
+func checkPodAffinityTerms(
+	required []core.PodAffinityTerm,
+	preferred []core.WeightedPodAffinityTerm,
+	path string,
+) []string {
+
+	var problems []string
+	for i, term := range required {
+		problems = append(
+			problems,
+			checkPodAffinityTerm(
+				term,
+				fmt.Sprintf("%s.requiredDuringSchedulingIgnoredDuringExecution[%d]", path, i),
+			)...,
+		)
+	}
+	for i, weighted := range preferred {
+		preferredPath := fmt.Sprintf(
+			"%s.preferredDuringSchedulingIgnoredDuringExecution[%d]",
+			path,
+			i,
+		)
+		problems = append(problems, checkWeight(weighted.Weight, preferredPath)...)
+		problems = append(
+			problems,
+			checkPodAffinityTerm(weighted.PodAffinityTerm, preferredPath+".podAffinityTerm")...,
+		)
+	}
+	return problems
+}
+
+// checkPodAffinityTerm returns a description of each problem found in the
+// given pod (anti-)affinity term.
+func checkPodAffinityTerm(
+	term core.PodAffinityTerm,
+	path string,
+) []string {
+
+	var problems []string
+	if term.TopologyKey == "" {
+		problems = append(problems, path+".topologyKey: must be specified")
+	} else {
+		for _, msg := range k8svalidation.IsQualifiedName(term.TopologyKey) {
+			problems = append(
+				problems,
+				fmt.Sprintf("%s.topologyKey(%s): %s", path, term.TopologyKey, msg),
+			)
+		}
+	}
+	if term.LabelSelector != nil {
+		if _, selectorErr := metav1.LabelSelectorAsSelector(term.LabelSelector); selectorErr != nil {
+			problems = append(
+				problems,
+				fmt.Sprintf("%s.labelSelector: %s", path, selectorErr.Error()),
+			)
+		}
+	}
+	for _, namespace := range term.Namespaces {
+		if msgs := k8svalidation.IsDNS1123Label(namespace); len(msgs) != 0 {
+			problems = append(
+				problems,
+				fmt.Sprintf("%s.namespaces(%s): %s", path, namespace, strings.Join(msgs, "; ")),
+			)
+		}
+	}
+	return problems
+}
+
+// checkWeight returns a description of the problem if the given preferred
+// scheduling term weight is out of range.
+func checkWeight(
+	weight int32,
+	path string,
+) []string {
+
+	if (weight < 1) || (weight > 100) {
+		return []string{
+			fmt.Sprintf("%s.weight(%d): must be in the range 1-100", path, weight),
+		}
+	}
+	return nil
+}
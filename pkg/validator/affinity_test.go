@@ -0,0 +1,378 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validator
+
+import (
+	"strings"
+	"testing"
+
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// checkProblems reports an error unless each of the given problems
+// contains the corresponding wanted substring.
+func checkProblems(
+	t *testing.T,
+	name string,
+	got []string,
+	want []string,
+) {
+
+	if len(got) != len(want) {
+		t.Errorf("%s: got problems %q, want %q", name, got, want)
+		return
+	}
+	for i := range want {
+		if !strings.Contains(got[i], want[i]) {
+			t.Errorf("%s: got problem %q, want it to contain %q", name, got[i], want[i])
+		}
+	}
+}
+
+func TestCheckNodeSelectorTerm(t *testing.T) {
+
+	tests := []struct {
+		name string
+		reqs []core.NodeSelectorRequirement
+		want []string
+	}{
+		{
+			"valid",
+			[]core.NodeSelectorRequirement{
+				{Key: "zone", Operator: core.NodeSelectorOpIn, Values: []string{"a"}},
+				{Key: "example.com/gpu", Operator: core.NodeSelectorOpExists},
+				{Key: "cores", Operator: core.NodeSelectorOpGt, Values: []string{"4"}},
+			},
+			nil,
+		},
+		{
+			"bad key",
+			[]core.NodeSelectorRequirement{
+				{Key: "bad key", Operator: core.NodeSelectorOpExists},
+			},
+			[]string{"t.matchExpressions[0].key(bad key): "},
+		},
+		{
+			"In without values",
+			[]core.NodeSelectorRequirement{
+				{Key: "zone", Operator: core.NodeSelectorOpIn},
+			},
+			[]string{"t.matchExpressions[0].values: must be non-empty for operator In"},
+		},
+		{
+			"Exists with values",
+			[]core.NodeSelectorRequirement{
+				{Key: "zone", Operator: core.NodeSelectorOpDoesNotExist, Values: []string{"a"}},
+			},
+			[]string{"t.matchExpressions[0].values: must be empty for operator DoesNotExist"},
+		},
+		{
+			"Lt with two values",
+			[]core.NodeSelectorRequirement{
+				{Key: "cores", Operator: core.NodeSelectorOpLt, Values: []string{"1", "2"}},
+			},
+			[]string{"t.matchExpressions[0].values: must have exactly one element for operator Lt"},
+		},
+		{
+			"Gt with non-integer",
+			[]core.NodeSelectorRequirement{
+				{Key: "cores", Operator: core.NodeSelectorOpGt, Values: []string{"many"}},
+			},
+			[]string{"t.matchExpressions[0].values: must be an integer for operator Gt"},
+		},
+		{
+			"unknown operator",
+			[]core.NodeSelectorRequirement{
+				{Key: "zone", Operator: "Near"},
+			},
+			[]string{"t.matchExpressions[0].operator: unknown operator(Near)"},
+		},
+	}
+	for _, test := range tests {
+		got := checkNodeSelectorTerm(core.NodeSelectorTerm{MatchExpressions: test.reqs}, "t")
+		checkProblems(t, test.name, got, test.want)
+	}
+}
+
+func TestCheckNodeSelectorTermFields(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		fields []core.NodeSelectorRequirement
+		want   []string
+	}{
+		{
+			"valid",
+			[]core.NodeSelectorRequirement{
+				{Key: "metadata.name", Operator: core.NodeSelectorOpNotIn, Values: []string{"n1"}},
+			},
+			nil,
+		},
+		{
+			"unsupported field",
+			[]core.NodeSelectorRequirement{
+				{Key: "metadata.uid", Operator: core.NodeSelectorOpIn, Values: []string{"n1"}},
+			},
+			[]string{"t.matchFields[0].key(metadata.uid): only metadata.name is supported"},
+		},
+		{
+			"bad operator and values",
+			[]core.NodeSelectorRequirement{
+				{Key: "metadata.name", Operator: core.NodeSelectorOpExists},
+			},
+			[]string{
+				"t.matchFields[0].operator: must be In or NotIn",
+				"t.matchFields[0].values: must have exactly one element",
+			},
+		},
+	}
+	for _, test := range tests {
+		got := checkNodeSelectorTerm(core.NodeSelectorTerm{MatchFields: test.fields}, "t")
+		checkProblems(t, test.name, got, test.want)
+	}
+}
+
+func TestCheckNodeAffinity(t *testing.T) {
+
+	validTerm := core.NodeSelectorTerm{
+		MatchExpressions: []core.NodeSelectorRequirement{
+			{Key: "zone", Operator: core.NodeSelectorOpExists},
+		},
+	}
+	tests := []struct {
+		name     string
+		affinity core.NodeAffinity
+		want     []string
+	}{
+		{
+			"valid",
+			core.NodeAffinity{
+				RequiredDuringSchedulingIgnoredDuringExecution: &core.NodeSelector{
+					NodeSelectorTerms: []core.NodeSelectorTerm{validTerm},
+				},
+				PreferredDuringSchedulingIgnoredDuringExecution: []core.PreferredSchedulingTerm{
+					{Weight: 100, Preference: validTerm},
+				},
+			},
+			nil,
+		},
+		{
+			"no required terms",
+			core.NodeAffinity{
+				RequiredDuringSchedulingIgnoredDuringExecution: &core.NodeSelector{},
+			},
+			[]string{"n.requiredDuringSchedulingIgnoredDuringExecution.nodeSelectorTerms: must have at least one term"},
+		},
+		{
+			"weight out of range",
+			core.NodeAffinity{
+				PreferredDuringSchedulingIgnoredDuringExecution: []core.PreferredSchedulingTerm{
+					{Weight: 0, Preference: validTerm},
+					{Weight: 101, Preference: validTerm},
+				},
+			},
+			[]string{
+				"n.preferredDuringSchedulingIgnoredDuringExecution[0].weight(0): must be in the range 1-100",
+				"n.preferredDuringSchedulingIgnoredDuringExecution[1].weight(101): must be in the range 1-100",
+			},
+		},
+	}
+	for _, test := range tests {
+		got := checkNodeAffinity(&test.affinity, "n")
+		checkProblems(t, test.name, got, test.want)
+	}
+}
+
+func TestCheckPodAffinityTerms(t *testing.T) {
+
+	validTerm := core.PodAffinityTerm{
+		LabelSelector: &metav1.LabelSelector{
+			MatchLabels: map[string]string{"app": "db"},
+		},
+		Namespaces:  []string{"ns1"},
+		TopologyKey: "kubernetes.io/hostname",
+	}
+	tests := []struct {
+		name      string
+		required  []core.PodAffinityTerm
+		preferred []core.WeightedPodAffinityTerm
+		want      []string
+	}{
+		{
+			"valid",
+			[]core.PodAffinityTerm{validTerm},
+			[]core.WeightedPodAffinityTerm{{Weight: 1, PodAffinityTerm: validTerm}},
+			nil,
+		},
+		{
+			"no topology key",
+			[]core.PodAffinityTerm{{}},
+			nil,
+			[]string{"p.requiredDuringSchedulingIgnoredDuringExecution[0].topologyKey: must be specified"},
+		},
+		{
+			"bad topology key",
+			[]core.PodAffinityTerm{{TopologyKey: "-bad"}},
+			nil,
+			[]string{"p.requiredDuringSchedulingIgnoredDuringExecution[0].topologyKey(-bad): "},
+		},
+		{
+			"bad selector and namespace",
+			[]core.PodAffinityTerm{
+				{
+					LabelSelector: &metav1.LabelSelector{
+						MatchExpressions: []metav1.LabelSelectorRequirement{
+							{Key: "app", Operator: "Near"},
+						},
+					},
+					Namespaces:  []string{"Bad_NS"},
+					TopologyKey: "zone",
+				},
+			},
+			nil,
+			[]string{
+				"p.requiredDuringSchedulingIgnoredDuringExecution[0].labelSelector: ",
+				"p.requiredDuringSchedulingIgnoredDuringExecution[0].namespaces(Bad_NS): ",
+			},
+		},
+		{
+			"preferred weight and term",
+			nil,
+			[]core.WeightedPodAffinityTerm{{Weight: 200}},
+			[]string{
+				"p.preferredDuringSchedulingIgnoredDuringExecution[0].weight(200): must be in the range 1-100",
+				"p.preferredDuringSchedulingIgnoredDuringExecution[0].podAffinityTerm.topologyKey: must be specified",
+			},
+		},
+	}
+	for _, test := range tests {
+		got := checkPodAffinityTerms(test.required, test.preferred, "p")
+		checkProblems(t, test.name, got, test.want)
+	}
+}
+
+func TestCheckTolerations(t *testing.T) {
+
+	seconds := int64(60)
+	tests := []struct {
+		name        string
+		tolerations []core.Toleration
+		want        []string
+	}{
+		{
+			"valid",
+			[]core.Toleration{
+				{Key: "dedicated", Value: "kd", Effect: core.TaintEffectNoSchedule},
+				{Key: "example.com/gpu", Operator: core.TolerationOpExists},
+				{Operator: core.TolerationOpExists, Effect: core.TaintEffectNoExecute, TolerationSeconds: &seconds},
+			},
+			nil,
+		},
+		{
+			"bad key and value",
+			[]core.Toleration{
+				{Key: "bad key", Operator: core.TolerationOpEqual, Value: "bad value"},
+			},
+			[]string{"t[0].key(bad key): ", "t[0].value(bad value): "},
+		},
+		{
+			"Equal without key",
+			[]core.Toleration{
+				{Operator: core.TolerationOpEqual, Value: "kd"},
+			},
+			[]string{"t[0].key: must be non-empty for operator Equal"},
+		},
+		{
+			"Exists with value",
+			[]core.Toleration{
+				{Key: "dedicated", Operator: core.TolerationOpExists, Value: "kd"},
+			},
+			[]string{"t[0].value: must be empty for operator Exists"},
+		},
+		{
+			"unknown operator and effect",
+			[]core.Toleration{
+				{Key: "dedicated", Operator: "Like", Effect: "NoRun"},
+			},
+			[]string{"t[0].operator: unknown operator(Like)", "t[0].effect: unknown effect(NoRun)"},
+		},
+		{
+			"seconds without NoExecute",
+			[]core.Toleration{
+				{Key: "dedicated", Operator: core.TolerationOpExists, TolerationSeconds: &seconds},
+			},
+			[]string{"t[0].tolerationSeconds: only allowed for effect NoExecute"},
+		},
+	}
+	for _, test := range tests {
+		got := checkTolerations(test.tolerations, "t")
+		checkProblems(t, test.name, got, test.want)
+	}
+}
+
+func TestCheckTopologySpread(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		constraints []core.TopologySpreadConstraint
+		want        []string
+	}{
+		{
+			"valid",
+			[]core.TopologySpreadConstraint{
+				{MaxSkew: 1, TopologyKey: "zone", WhenUnsatisfiable: core.DoNotSchedule},
+				{
+					MaxSkew:           2,
+					TopologyKey:       "kubernetes.io/hostname",
+					WhenUnsatisfiable: core.ScheduleAnyway,
+					LabelSelector: &metav1.LabelSelector{
+						MatchLabels: map[string]string{"app": "db"},
+					},
+				},
+			},
+			nil,
+		},
+		{
+			"missing fields",
+			[]core.TopologySpreadConstraint{{}},
+			[]string{
+				"s[0].maxSkew: must be greater than zero",
+				"s[0].topologyKey: must be specified",
+				"s[0].whenUnsatisfiable: unknown action()",
+			},
+		},
+		{
+			"bad topology key and selector",
+			[]core.TopologySpreadConstraint{
+				{
+					MaxSkew:           1,
+					TopologyKey:       "bad key",
+					WhenUnsatisfiable: core.DoNotSchedule,
+					LabelSelector: &metav1.LabelSelector{
+						MatchExpressions: []metav1.LabelSelectorRequirement{
+							{Key: "app", Operator: metav1.LabelSelectorOpIn},
+						},
+					},
+				},
+			},
+			[]string{"s[0].topologyKey(bad key): ", "s[0].labelSelector: "},
+		},
+	}
+	for _, test := range tests {
+		got := checkTopologySpread(test.constraints, "s")
+		checkProblems(t, test.name, got, test.want)
+	}
+}
@@ -17,16 +17,21 @@ package validator
 import (
 	"encoding/json"
 	"fmt"
+	"path/filepath"
 	"strconv"
 	"strings"
 
 	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
 	"github.com/bluek8s/kubedirector/pkg/catalog"
+	"github.com/bluek8s/kubedirector/pkg/executor"
 	"github.com/bluek8s/kubedirector/pkg/shared"
 	"k8s.io/api/admission/v1beta1"
+	core "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	k8svalidation "k8s.io/apimachinery/pkg/util/validation"
 )
 
 type appPatchSpec struct {
@@ -36,6 +41,7 @@ type appPatchSpec struct {
 }
 
 type appPatchValue struct {
+	appSpecValue     *kdv1.KubeDirectorAppSpec
 	packageInfoValue *kdv1.SetupPackageInfo
 	stringValue      *string
 	intValue         *int32
@@ -44,6 +50,9 @@ type appPatchValue struct {
 
 func (obj appPatchValue) MarshalJSON() ([]byte, error) {
 
+	if obj.appSpecValue != nil {
+		return json.Marshal(obj.appSpecValue)
+	}
 	if obj.packageInfoValue != nil {
 		return json.Marshal(obj.packageInfoValue)
 	}
@@ -164,8 +173,10 @@ func validateRoles(
 	// Any global defaults will be removed from the CR. Remember their values
 	// though for use in populating the role definitions.
 	var globalImageRepoTag *string
+	var globalSetupImage *string
 	var globalSetupPackageInfo *kdv1.SetupPackageInfo
 	var globalPersistDirs *[]string
+	var globalPersistExcludes *[]string
 	var globalEventList *[]string
 	var globalMaxLogSizeDump *int32
 
@@ -186,6 +197,18 @@ func validateRoles(
 			},
 		)
 	}
+	if appCR.Spec.DefaultSetupImage != nil {
+		setupImageCopy := *appCR.Spec.DefaultSetupImage
+		globalSetupImage = &setupImageCopy
+		appCR.Spec.DefaultSetupImage = nil
+		patches = append(
+			patches,
+			appPatchSpec{
+				Op:   "remove",
+				Path: "/spec/defaultSetupImageRepoTag",
+			},
+		)
+	}
 	if !appCR.Spec.DefaultSetupPackage.IsSet {
 		globalSetupPackageInfo = nil
 	} else {
@@ -219,6 +242,21 @@ func validateRoles(
 			},
 		)
 	}
+	if appCR.Spec.DefaultPersistExcludes == nil {
+		globalPersistExcludes = nil
+	} else {
+		excludesCopy := make([]string, len(*appCR.Spec.DefaultPersistExcludes))
+		copy(excludesCopy, *appCR.Spec.DefaultPersistExcludes)
+		globalPersistExcludes = &excludesCopy
+		appCR.Spec.DefaultPersistExcludes = nil
+		patches = append(
+			patches,
+			appPatchSpec{
+				Op:   "remove",
+				Path: "/spec/defaultPersistExcludes",
+			},
+		)
+	}
 	if appCR.Spec.DefaultEventList == nil {
 		globalEventList = nil
 	} else {
@@ -291,8 +329,22 @@ func validateRoles(
 					),
 				)
 			}
+			if role.MinStorage.RecommendedSize != nil {
+				_, recommendedErr := resource.ParseQuantity(*role.MinStorage.RecommendedSize)
+				if recommendedErr != nil {
+					valErrors = append(
+						valErrors,
+						fmt.Sprintf(
+							invalidRecommendedStorage,
+							*role.MinStorage.RecommendedSize,
+							role.ID,
+						),
+					)
+				}
+			}
 		}
 		if role.ContainerSpec != nil {
+			valErrors = validateRoleProbes(role.ID, role.ContainerSpec, valErrors)
 			if role.ContainerSpec.Tty {
 				if !role.ContainerSpec.Stdin {
 					valErrors = append(
@@ -331,6 +383,42 @@ func validateRoles(
 				},
 			)
 		}
+		if role.SetupImage == nil && globalSetupImage != nil {
+			// No special setup image specified so inherit from global.
+			role.SetupImage = globalSetupImage
+			patches = append(
+				patches,
+				appPatchSpec{
+					Op:   "add",
+					Path: "/spec/roles/" + strconv.Itoa(index) + "/setupImageRepoTag",
+					Value: appPatchValue{
+						stringValue: globalSetupImage,
+					},
+				},
+			)
+		}
+		if role.SetupImage != nil && role.SetupPackage.IsNull {
+			// A setup image is only used to run the setup package.
+			valErrors = append(
+				valErrors,
+				fmt.Sprintf(
+					setupImageWithoutPackage,
+					role.ID,
+				),
+			)
+		}
+		if !role.SetupPackage.IsNull &&
+			(role.SetupPackage.Info.PullSecretName != "") &&
+			!executor.IsOCIPackage(role.SetupPackage.Info.PackageURL) {
+			// Only KubeDirector itself uses the pull secret.
+			valErrors = append(
+				valErrors,
+				fmt.Sprintf(
+					pullSecretWithoutOCI,
+					role.ID,
+				),
+			)
+		}
 		if role.PersistDirs == nil {
 			if globalPersistDirs != nil {
 				role.PersistDirs = globalPersistDirs
@@ -346,6 +434,21 @@ func validateRoles(
 				)
 			}
 		}
+		if role.PersistExcludes == nil {
+			if globalPersistExcludes != nil {
+				role.PersistExcludes = globalPersistExcludes
+				patches = append(
+					patches,
+					appPatchSpec{
+						Op:   "add",
+						Path: "/spec/roles/" + strconv.Itoa(index) + "/persistExcludes",
+						Value: appPatchValue{
+							stringSliceValue: globalPersistExcludes,
+						},
+					},
+				)
+			}
+		}
 		if role.EventList == nil {
 			if globalEventList != nil {
 				role.EventList = globalEventList
@@ -379,9 +482,206 @@ func validateRoles(
 	return patches, valErrors
 }
 
+// validateRoleProbes checks any probes in a role's container spec. Each
+// probe must use exactly one handler with a valid port, must not have
+// negative timing values, and (for liveness and startup probes) cannot
+// require more than one success.
+func validateRoleProbes(
+	roleID string,
+	containerSpec *kdv1.ContainerSpec,
+	valErrors []string,
+) []string {
+
+	probes := []struct {
+		kind            string
+		probe           *core.Probe
+		singleSuccessOK bool
+	}{
+		{"readinessProbe", containerSpec.ReadinessProbe, false},
+		{"livenessProbe", containerSpec.LivenessProbe, true},
+		{"startupProbe", containerSpec.StartupProbe, true},
+	}
+	for _, p := range probes {
+		if p.probe == nil {
+			continue
+		}
+		var problems []string
+		numHandlers := 0
+		if p.probe.Exec != nil {
+			numHandlers++
+			if len(p.probe.Exec.Command) == 0 {
+				problems = append(problems, "exec command is empty")
+			}
+		}
+		if p.probe.HTTPGet != nil {
+			numHandlers++
+			problems = append(problems, validateProbePort(p.probe.HTTPGet.Port)...)
+		}
+		if p.probe.TCPSocket != nil {
+			numHandlers++
+			problems = append(problems, validateProbePort(p.probe.TCPSocket.Port)...)
+		}
+		if numHandlers != 1 {
+			problems = append(problems, "exactly one of exec, httpGet, or tcpSocket must be given")
+		}
+		if (p.probe.InitialDelaySeconds < 0) || (p.probe.TimeoutSeconds < 0) ||
+			(p.probe.PeriodSeconds < 0) || (p.probe.SuccessThreshold < 0) ||
+			(p.probe.FailureThreshold < 0) {
+			problems = append(problems, "timing and threshold values cannot be negative")
+		}
+		if p.singleSuccessOK && (p.probe.SuccessThreshold > 1) {
+			problems = append(problems, "successThreshold must be 1")
+		}
+		for _, problem := range problems {
+			valErrors = append(
+				valErrors,
+				fmt.Sprintf(invalidProbe, p.kind, roleID, problem),
+			)
+		}
+	}
+	return valErrors
+}
+
+// validateProbePort checks a probe's port, which can be either a number or
+// the name of a port.
+func validateProbePort(
+	port intstr.IntOrString,
+) []string {
+
+	if port.Type == intstr.String {
+		return k8svalidation.IsValidPortName(port.StrVal)
+	}
+	return k8svalidation.IsValidPortNum(port.IntValue())
+}
+
+// validateShellless checks the app for features that require KubeDirector
+// to run shell commands in the app container, if the app is flagged as
+// having no shell in its images. This runs after validateRoles so that
+// role-level values have been inherited from the top-level defaults. Any
+// generated error messages will be added to the input list and returned.
+func validateShellless(
+	appCR *kdv1.KubeDirectorApp,
+	valErrors []string,
+) []string {
+
+	if !appCR.Spec.Shellless {
+		return valErrors
+	}
+	if appCR.Spec.SystemdRequired {
+		valErrors = append(valErrors, shelllessSystemd)
+	}
+	for _, role := range appCR.Spec.NodeRoles {
+		if !role.SetupPackage.IsNull && (role.SetupImage == nil) {
+			valErrors = append(
+				valErrors,
+				fmt.Sprintf(shelllessSetupPackage, role.ID),
+			)
+		}
+		hasPersistDirs := (role.PersistDirs != nil) && (len(*role.PersistDirs) != 0)
+		if hasPersistDirs || (role.MinStorage != nil) {
+			valErrors = append(
+				valErrors,
+				fmt.Sprintf(shelllessPersistDirs, role.ID),
+			)
+		}
+	}
+	return valErrors
+}
+
+// validateAppContainers checks the additional app containers of each role.
+// Names must be valid, unique within the role, and must not collide with
+// the containers that KubeDirector itself generates. Shared directories
+// must be given as absolute paths. A container's setup package is only run
+// as part of the setup of the role, so the role must have a setup package
+// of its own.
+// This must be called after the role-level values have been inherited from
+// the top-level defaults. Any generated error messages will be added to the
+// input list and returned.
+func validateAppContainers(
+	appCR *kdv1.KubeDirectorApp,
+	valErrors []string,
+) []string {
+
+	reservedNames := []string{
+		executor.AppContainerName,
+		"init",
+		executor.SetupContainerName,
+		executor.DebugContainerName,
+		executor.LogShipperContainerName,
+		executor.BlockPrepContainerName,
+	}
+	for _, role := range appCR.Spec.NodeRoles {
+		var names []string
+		for _, container := range role.Containers {
+			nameErrs := k8svalidation.IsDNS1123Label(container.Name)
+			if shared.StringInList(container.Name, reservedNames) {
+				nameErrs = append(nameErrs, "name is reserved for KubeDirector use")
+			} else if shared.StringInList(container.Name, names) {
+				nameErrs = append(nameErrs, "name is repeated")
+			}
+			if len(nameErrs) != 0 {
+				valErrors = append(
+					valErrors,
+					fmt.Sprintf(
+						invalidAppContainerName,
+						container.Name,
+						role.ID,
+						strings.Join(nameErrs, "; "),
+					),
+				)
+			}
+			names = append(names, container.Name)
+			for _, mount := range container.VolumeMounts {
+				if !filepath.IsAbs(mount.AppPath) || (filepath.Clean(mount.AppPath) == "/") ||
+					!filepath.IsAbs(mount.MountPath) {
+					valErrors = append(
+						valErrors,
+						fmt.Sprintf(
+							invalidAppContainerMount,
+							container.Name,
+							role.ID,
+							"appPath must be an absolute path below / and mountPath an absolute path",
+						),
+					)
+				}
+			}
+			if container.SetupPackage == nil {
+				continue
+			}
+			if role.SetupPackage.IsNull {
+				valErrors = append(
+					valErrors,
+					fmt.Sprintf(invalidAppContainerPackage, container.Name, role.ID),
+				)
+			}
+		}
+	}
+	return valErrors
+}
+
+// validateBlockDevicePrep checks that the block device preparation step of
+// each role, if any, has something to do. Any generated error messages will
+// be added to the input list and returned.
+func validateBlockDevicePrep(
+	appCR *kdv1.KubeDirectorApp,
+	valErrors []string,
+) []string {
+
+	for _, role := range appCR.Spec.NodeRoles {
+		prep := role.BlockDevicePrep
+		if (prep != nil) && (prep.Filesystem == nil) && !prep.Encrypt {
+			valErrors = append(
+				valErrors,
+				fmt.Sprintf(emptyBlockDevicePrep, role.ID),
+			)
+		}
+	}
+	return valErrors
+}
+
 // validateServices checks each service for property constraints not
-// expressible in the schema. Currently this just means checking that the
-// service endpoint must specify url_schema if isDashboard is true. Any
+// expressible in the schema: the service endpoint must specify url_schema if
+// isDashboard is true, and must be HTTP or HTTPS if ingress is true. Any
 // generated error messages will be added to the input list and returned.
 func validateServices(
 	appCR *kdv1.KubeDirectorApp,
@@ -398,10 +698,114 @@ func validateServices(
 				valErrors = append(valErrors, invalidMsg)
 			}
 		}
+		if service.Endpoint.Ingress {
+			scheme := strings.ToLower(service.Endpoint.URLScheme)
+			if (scheme != "http") && (scheme != "https") {
+				valErrors = append(
+					valErrors,
+					fmt.Sprintf(nonHTTPIngress, service.ID),
+				)
+			}
+		}
 	}
 	return valErrors
 }
 
+// validateRequiredEnv checks the app's required env var declarations: each
+// name must be a valid and unique env var name, any listed roles must be
+// roles of the app, and any secret key must be a valid secret data key. Any
+// generated error messages will be added to the input list and returned.
+func validateRequiredEnv(
+	appCR *kdv1.KubeDirectorApp,
+	allRoleIDs []string,
+	valErrors []string,
+) []string {
+
+	var names []string
+	for _, requiredEnv := range appCR.Spec.RequiredEnv {
+		if errs := k8svalidation.IsEnvVarName(requiredEnv.Name); len(errs) != 0 {
+			valErrors = append(
+				valErrors,
+				fmt.Sprintf(
+					invalidRequiredEnvName,
+					requiredEnv.Name,
+					strings.Join(errs, "; "),
+				),
+			)
+		}
+		if shared.StringInList(requiredEnv.Name, names) {
+			valErrors = append(
+				valErrors,
+				fmt.Sprintf(nonUniqueRequiredEnv, requiredEnv.Name),
+			)
+		}
+		names = append(names, requiredEnv.Name)
+		for _, role := range requiredEnv.Roles {
+			if !shared.StringInList(role, allRoleIDs) {
+				valErrors = append(
+					valErrors,
+					fmt.Sprintf(invalidRequiredEnvRole, requiredEnv.Name, role),
+				)
+			}
+		}
+		if requiredEnv.SecretKey != "" {
+			if errs := k8svalidation.IsConfigMapKey(requiredEnv.SecretKey); len(errs) != 0 {
+				valErrors = append(
+					valErrors,
+					fmt.Sprintf(
+						invalidRequiredEnvKey,
+						requiredEnv.Name,
+						requiredEnv.SecretKey,
+						strings.Join(errs, "; "),
+					),
+				)
+			}
+		}
+	}
+	return valErrors
+}
+
+// flattenDerivedApp merges the spec of a derived app over that of its base
+// app, replacing the spec in the given app CR, and adds a patch that stores
+// the flattened spec. Any error is returned as a message.
+func flattenDerivedApp(
+	ar *v1beta1.AdmissionReview,
+	appCR *kdv1.KubeDirectorApp,
+	patches []appPatchSpec,
+) ([]appPatchSpec, string) {
+
+	baseName := *appCR.Spec.DerivedFrom
+	if baseName == ar.Request.Name {
+		return patches, appDerivedFromSelf
+	}
+	baseCR, baseErr := catalog.FindBaseApp(ar.Request.Namespace, baseName)
+	if baseErr != nil {
+		return patches, fmt.Sprintf(appBaseNotFound, baseName)
+	}
+	var rawCR struct {
+		Spec json.RawMessage `json:"spec"`
+	}
+	if jsonErr := json.Unmarshal(ar.Request.Object.Raw, &rawCR); jsonErr != nil {
+		return patches, fmt.Sprintf(appFlattenFailed, baseName, jsonErr.Error())
+	}
+	flatSpec, flattenErr := catalog.FlattenApp(baseCR, rawCR.Spec)
+	if flattenErr != nil {
+		return patches, fmt.Sprintf(appFlattenFailed, baseName, flattenErr.Error())
+	}
+	appCR.Spec = *flatSpec
+	patches = append(
+		patches,
+		appPatchSpec{
+			Op:   "add",
+			Path: "/spec",
+			Value: appPatchValue{
+				appSpecValue: flatSpec.DeepCopy(),
+			},
+		},
+	)
+	return patches, ""
+}
+
 // admitAppCR is the top-level app validation function, which invokes
 // the top-specific validation subroutines and composes the admission
 // response.
@@ -453,6 +857,19 @@ func admitAppCR(
 
 	// Now do validation for create/update.
 
+	// A derived app is flattened first, and the rest of the validation
+	// (and any defaulting patches) applies to the flattened spec.
+	if appCR.Spec.DerivedFrom != nil {
+		var flattenErr string
+		patches, flattenErr = flattenDerivedApp(ar, &appCR, patches)
+		if flattenErr != "" {
+			admitResponse.Result = &metav1.Status{
+				Message: "\n" + flattenErr,
+			}
+			return &admitResponse
+		}
+	}
+
 	allRoleIDs := catalog.GetAllRoleIDs(&appCR)
 	allServiceIDs := catalog.GetAllServiceIDs(&appCR)
 
@@ -462,6 +879,11 @@ func admitAppCR(
 	valErrors = validateSelectedRoles(&appCR, allRoleIDs, valErrors)
 	patches, valErrors = validateRoles(&appCR, patches, valErrors)
 	valErrors = validateServices(&appCR, valErrors)
+	valErrors = validateShellless(&appCR, valErrors)
+	valErrors = validateAppContainers(&appCR, valErrors)
+	valErrors = validateBlockDevicePrep(&appCR, valErrors)
+	valErrors = validateRequiredEnv(&appCR, allRoleIDs, valErrors)
+	valErrors = validateRequirementsDecl(&appCR, valErrors)
 
 	if len(valErrors) == 0 {
 		if len(patches) != 0 {
@@ -501,7 +923,10 @@ func admitAppCR(
 			// to null. See the commit comments in the PR that closes issue
 			// #319 for more details.
 			prevAppCR.Spec.DefaultSetupPackage = appCR.Spec.DefaultSetupPackage
-			if !equality.Semantic.DeepEqual(appCR.Spec, prevAppCR.Spec) {
+			// Image changes are allowed; the clusters will be upgraded.
+			compareAppCR := appCR.DeepCopy()
+			ignoreImageChanges(compareAppCR, &prevAppCR)
+			if !equality.Semantic.DeepEqual(compareAppCR.Spec, prevAppCR.Spec) {
 				referencesStr := strings.Join(references, ", ")
 				appInUseMsg := fmt.Sprintf(
 					appInUse,
@@ -0,0 +1,92 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validator
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	"github.com/bluek8s/kubedirector/pkg/shared"
+	v1auth "k8s.io/api/authentication/v1"
+)
+
+// validateApproval checks a request to approve a queued membership change.
+// When the approve-generation annotation is added or changed, the requesting
+// user must be allowed the "approve" verb on this kdcluster and the value
+// must be a generation number; if so, a patch is generated to record the
+// approving user. Otherwise the approved-by annotation may only be removed,
+// not set or changed. Any generated error messages will be added to the
+// input list and returned.
+func validateApproval(
+	cr *kdv1.KubeDirectorCluster,
+	prevCr *kdv1.KubeDirectorCluster,
+	userInfo v1auth.UserInfo,
+	valErrors []string,
+	patches []clusterPatchSpec,
+) ([]string, []clusterPatchSpec) {
+
+	gen, hasGen := cr.Annotations[shared.ApproveGenerationAnnotation]
+	prevGen, hadGen := prevCr.Annotations[shared.ApproveGenerationAnnotation]
+	if !hasGen || (hadGen && (gen == prevGen)) {
+		value, ok := cr.Annotations[shared.ApprovedByAnnotation]
+		if ok && (value != prevCr.Annotations[shared.ApprovedByAnnotation]) {
+			valErrors = append(
+				valErrors,
+				fmt.Sprintf(approvalAnnotationReadOnly, shared.ApprovedByAnnotation),
+			)
+		}
+		return valErrors, patches
+	}
+
+	if _, parseErr := strconv.ParseInt(gen, 10, 64); parseErr != nil {
+		valErrors = append(
+			valErrors,
+			fmt.Sprintf(invalidApproveGeneration, shared.ApproveGenerationAnnotation, gen),
+		)
+		return valErrors, patches
+	}
+
+	errStr := checkUserAccess(
+		userInfo,
+		cr.Namespace,
+		shared.KdDomainBase,
+		"kubedirectorclusters",
+		cr.Name,
+		approveVerb,
+	)
+	if errStr != "" {
+		valErrors = append(
+			valErrors,
+			fmt.Sprintf(approvalNotPermitted, userInfo.Username, errStr),
+		)
+		return valErrors, patches
+	}
+
+	user := userInfo.Username
+	patches = append(
+		patches,
+		clusterPatchSpec{
+			Op: "add",
+			Path: fmt.Sprintf("/metadata/annotations/%s",
+				strings.ReplaceAll(shared.ApprovedByAnnotation, "/", "~1")),
+			Value: clusterPatchValue{
+				ValueStr: &user,
+			},
+		},
+	)
+	return valErrors, patches
+}
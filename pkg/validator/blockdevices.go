@@ -0,0 +1,211 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validator
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	"github.com/bluek8s/kubedirector/pkg/catalog"
+	"github.com/bluek8s/kubedirector/pkg/executor"
+	"github.com/bluek8s/kubedirector/pkg/observer"
+)
+
+// reservedDeviceDirs are directories that the container runtime mounts in
+// every container, and reservedDevicePaths the device files that it
+// provides. Block devices cannot be placed at or below any of these.
+var reservedDeviceDirs = []string{
+	"/dev/shm",
+	"/dev/pts",
+	"/dev/mqueue",
+	"/proc",
+	"/sys",
+}
+var reservedDevicePaths = []string{
+	"/dev/null",
+	"/dev/zero",
+	"/dev/full",
+	"/dev/random",
+	"/dev/urandom",
+	"/dev/tty",
+	"/dev/console",
+	"/dev/ptmx",
+	"/dev/fd",
+	"/dev/stdin",
+	"/dev/stdout",
+	"/dev/stderr",
+	"/dev/termination-log",
+}
+
+// validateRoleBlockDevices checks the block device path prefix of each role
+// with block storage. The prefix must be a clean path that does not end in
+// "/". The device paths of a role (the prefix followed by the device index)
+// are distinct from each other, but none of them may be reserved by the
+// container runtime or collide with a directory that is mounted in the app
+// container: the app's persisted directories for the role, or the role's
+// secret, config map, volume projection, scratch, pod info, sidecar, or app
+// container mounts. If the app encrypts the role's block devices, the role
+// must name a key secret that exists and has a "key" entry. Any generated
+// error messages will be added to the input list and returned.
+func validateRoleBlockDevices(
+	cr *kdv1.KubeDirectorCluster,
+	appCR *kdv1.KubeDirectorApp,
+	valErrors []string,
+) []string {
+
+	numRoles := len(cr.Spec.Roles)
+	for i := 0; i < numRoles; i++ {
+		role := &(cr.Spec.Roles[i])
+		if (role.BlockStorage == nil) || (role.BlockStorage.Path == nil) {
+			continue
+		}
+		pathPrefix := *role.BlockStorage.Path
+		var problems []string
+		if (filepath.Clean(pathPrefix) != pathPrefix) || strings.HasSuffix(pathPrefix, "/") {
+			problems = append(problems, "must be a clean absolute path not ending in /")
+		}
+		mounts := roleMountPaths(role, appCR)
+		for _, devicePath := range executor.BlockDevicePaths(role) {
+			for _, reserved := range reservedDevicePaths {
+				if devicePath == reserved {
+					problems = append(
+						problems,
+						fmt.Sprintf("device path(%s) is reserved", devicePath),
+					)
+				}
+			}
+			for _, reserved := range reservedDeviceDirs {
+				if pathsOverlap(devicePath, reserved) {
+					problems = append(
+						problems,
+						fmt.Sprintf("device path(%s) is inside reserved directory(%s)", devicePath, reserved),
+					)
+				}
+			}
+			for _, mount := range mounts {
+				if pathsOverlap(devicePath, mount) {
+					problems = append(
+						problems,
+						fmt.Sprintf("device path(%s) collides with mounted path(%s)", devicePath, mount),
+					)
+				}
+			}
+		}
+		if len(problems) != 0 {
+			valErrors = append(
+				valErrors,
+				fmt.Sprintf(
+					invalidBlockDevicePath,
+					pathPrefix,
+					role.Name,
+					strings.Join(problems, "; "),
+				),
+			)
+		}
+		valErrors = validateBlockKeySecret(cr, role, appCR, valErrors)
+	}
+	return valErrors
+}
+
+// validateBlockKeySecret checks the LUKS key secret of a role with block
+// storage, if the app encrypts the role's block devices. Any generated
+// error messages will be added to the input list and returned.
+func validateBlockKeySecret(
+	cr *kdv1.KubeDirectorCluster,
+	role *kdv1.Role,
+	appCR *kdv1.KubeDirectorApp,
+	valErrors []string,
+) []string {
+
+	appRole := catalog.GetRoleFromID(appCR, role.Name)
+	if (appRole == nil) || (appRole.BlockDevicePrep == nil) || !appRole.BlockDevicePrep.Encrypt {
+		return valErrors
+	}
+	secretName := role.BlockStorage.EncryptionKeySecret
+	if secretName == nil {
+		return append(
+			valErrors,
+			fmt.Sprintf(blockKeySecretMissing, role.Name),
+		)
+	}
+	secret, fetchErr := observer.GetSecret(cr.Namespace, *secretName)
+	if (fetchErr != nil) || (len(secret.Data["key"]) == 0) {
+		valErrors = append(
+			valErrors,
+			fmt.Sprintf(blockKeySecretInvalid, *secretName, role.Name),
+		)
+	}
+	return valErrors
+}
+
+// roleMountPaths returns the paths of the directories mounted in the app
+// container of the given role's members.
+func roleMountPaths(
+	role *kdv1.Role,
+	appCR *kdv1.KubeDirectorApp,
+) []string {
+
+	var result []string
+	if appRole := catalog.GetRoleFromID(appCR, role.Name); appRole != nil {
+		if appRole.PersistDirs != nil {
+			result = append(result, *appRole.PersistDirs...)
+		}
+		for _, container := range appRole.Containers {
+			for _, mount := range container.VolumeMounts {
+				result = append(result, mount.AppPath)
+			}
+		}
+		if (appRole.BlockDevicePrep != nil) && appRole.BlockDevicePrep.Encrypt {
+			result = append(result, executor.BlockKeyMountPath)
+		}
+	}
+	if role.Secret != nil {
+		result = append(result, role.Secret.MountPath)
+	}
+	for _, configMap := range role.ConfigMaps {
+		result = append(result, configMap.MountPath)
+	}
+	for _, projection := range role.VolumeProjections {
+		result = append(result, projection.MountPath)
+	}
+	for _, scratch := range role.Scratch {
+		result = append(result, scratch.MountPath)
+	}
+	if role.PodInfoMountPath != nil {
+		result = append(result, *role.PodInfoMountPath)
+	}
+	for _, sidecar := range role.Sidecars {
+		for _, mount := range sidecar.VolumeMounts {
+			result = append(result, mount.AppPath)
+		}
+	}
+	return result
+}
+
+// pathsOverlap reports whether either of two absolute paths is the same as,
+// or below, the other.
+func pathsOverlap(
+	path1 string,
+	path2 string,
+) bool {
+
+	clean1 := filepath.Clean(path1)
+	clean2 := filepath.Clean(path2)
+	return (clean1 == clean2) ||
+		strings.HasPrefix(clean1, clean2+"/") ||
+		strings.HasPrefix(clean2, clean1+"/")
+}
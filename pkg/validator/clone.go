@@ -0,0 +1,114 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validator
+
+import (
+	"fmt"
+
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	"github.com/bluek8s/kubedirector/pkg/observer"
+	"github.com/bluek8s/kubedirector/pkg/shared"
+	v1auth "k8s.io/api/authentication/v1"
+)
+
+// validateCloneFrom checks the clone source, if any, of a new cluster. It
+// must name exactly one of a backup or a cluster, which must be readable
+// by the requesting user and must be of the same app. A backup must have
+// succeeded. Any generated error messages will be added to the input list
+// and returned.
+func validateCloneFrom(
+	cr *kdv1.KubeDirectorCluster,
+	userInfo v1auth.UserInfo,
+	valErrors []string,
+) []string {
+
+	if cr.Spec.CloneFrom == nil {
+		return valErrors
+	}
+	source := cr.Spec.CloneFrom
+	if (source.Backup == "") == (source.Cluster == "") {
+		valErrors = append(valErrors, invalidCloneSource)
+		return valErrors
+	}
+	kind := "KubeDirectorBackup"
+	resource := "kubedirectorbackups"
+	name := source.Backup
+	if source.Cluster != "" {
+		kind = "KubeDirectorCluster"
+		resource = "kubedirectorclusters"
+		name = source.Cluster
+	}
+	allowed, reason, reviewErr := shared.UserAllowed(
+		&userInfo,
+		cr.Namespace,
+		shared.KdDomainBase,
+		resource,
+		name,
+		"get",
+	)
+	if reviewErr != nil {
+		reason = reviewErr.Error()
+	}
+	if !allowed {
+		valErrors = append(
+			valErrors,
+			fmt.Sprintf(cloneNotPermitted, userInfo.Username, kind, name, reason),
+		)
+		return valErrors
+	}
+
+	var sourceAppID string
+	if source.Backup != "" {
+		backup, backupErr := observer.GetBackup(cr.Namespace, name)
+		if backupErr != nil {
+			valErrors = append(
+				valErrors,
+				fmt.Sprintf(invalidCloneSourceName, kind, name, cr.Namespace),
+			)
+			return valErrors
+		}
+		if (backup.Status == nil) || (backup.Status.State != kdv1.BackupSucceeded) {
+			state := ""
+			if backup.Status != nil {
+				state = backup.Status.State
+			}
+			valErrors = append(
+				valErrors,
+				fmt.Sprintf(cloneBackupNotReady, name, state),
+			)
+			return valErrors
+		}
+		if backup.Status.ClusterSpec != nil {
+			sourceAppID = backup.Status.ClusterSpec.AppID
+		}
+	} else {
+		sourceCluster, clusterErr := observer.GetCluster(cr.Namespace, name)
+		if clusterErr != nil {
+			valErrors = append(
+				valErrors,
+				fmt.Sprintf(invalidCloneSourceName, kind, name, cr.Namespace),
+			)
+			return valErrors
+		}
+		sourceAppID = sourceCluster.Spec.AppID
+	}
+	if (sourceAppID != "") && (sourceAppID != cr.Spec.AppID) {
+		valErrors = append(
+			valErrors,
+			fmt.Sprintf(cloneAppMismatch, kind, name, sourceAppID, cr.Spec.AppID),
+		)
+	}
+	return valErrors
+}
@@ -19,6 +19,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
@@ -26,6 +27,7 @@ import (
 	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
 	"github.com/bluek8s/kubedirector/pkg/catalog"
 	"github.com/bluek8s/kubedirector/pkg/controller/kubedirectorcluster"
+	"github.com/bluek8s/kubedirector/pkg/executor"
 	"github.com/bluek8s/kubedirector/pkg/observer"
 	"github.com/bluek8s/kubedirector/pkg/secretkeys"
 	"github.com/bluek8s/kubedirector/pkg/shared"
@@ -35,6 +37,7 @@ import (
 	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8svalidation "k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/apimachinery/pkg/util/validation/field"
 )
 
@@ -63,6 +66,9 @@ type clusterPatchValue struct {
 	ValueKDSecret      *kdv1.KDSecret
 	ValueSecretKey     *kdv1.SecretKey
 	ValueDict          *dictValue
+	ValueEnvVars       *[]core.EnvVar
+	ValueTolerations   *[]core.Toleration
+	ValueSpec          *kdv1.KubeDirectorClusterSpec
 }
 
 func (obj clusterPatchValue) MarshalJSON() ([]byte, error) {
@@ -82,6 +88,15 @@ func (obj clusterPatchValue) MarshalJSON() ([]byte, error) {
 	if obj.ValueDict != nil {
 		return json.Marshal(obj.ValueDict)
 	}
+	if obj.ValueEnvVars != nil {
+		return json.Marshal(obj.ValueEnvVars)
+	}
+	if obj.ValueTolerations != nil {
+		return json.Marshal(obj.ValueTolerations)
+	}
+	if obj.ValueSpec != nil {
+		return json.Marshal(obj.ValueSpec)
+	}
 	return json.Marshal(obj.ValueStr)
 }
 
@@ -216,7 +231,7 @@ func validateCardinality(
 			anyError = true
 			valErrors = append(
 				valErrors,
-				fmt.Sprint(
+				fmt.Sprintf(
 					maxMemberLimit,
 					maxKDMembers,
 				),
@@ -235,6 +250,18 @@ func validateCardinality(
 			valErrors,
 		)
 		anyError = anyError || anyLabelAnnError
+		valErrors, anyLabelAnnError = validatePVCLabelsAndAnnotations(
+			rolesPath.Index(i),
+			role,
+			valErrors,
+		)
+		anyError = anyError || anyLabelAnnError
+		valErrors, anyLabelAnnError = validateMemberServiceAnnotations(
+			rolesPath.Index(i),
+			role,
+			valErrors,
+		)
+		anyError = anyError || anyLabelAnnError
 	}
 
 	if anyError {
@@ -303,20 +330,18 @@ func validateClusterRoles(
 
 // validateGeneralClusterChanges checks for modifications to any property that
 // is not ever allowed to change after initial deployment. Currently this
-// covers the top-level app and appCatalog. Any generated error messages will
-// be added to the input list and returned.
+// covers the top-level appCatalog and specFragments, as well as the app
+// (which may only be changed to an upgraded version). Any generated error
+// messages will be added to the input list and returned.
 func validateGeneralClusterChanges(
 	cr *kdv1.KubeDirectorCluster,
 	prevCr *kdv1.KubeDirectorCluster,
 	valErrors []string,
 ) []string {
 
+	// The app can only be changed to another version of the same app.
 	if cr.Spec.AppID != prevCr.Spec.AppID {
-		appModifiedMsg := fmt.Sprintf(
-			modifiedProperty,
-			"app",
-		)
-		valErrors = append(valErrors, appModifiedMsg)
+		valErrors = validateAppUpgrade(cr, prevCr, valErrors)
 	}
 	// appCatalog should not be nil at this point in the flow if everything
 	// has worked as expected, but it doesn't hurt to be robust against that.
@@ -337,6 +362,41 @@ func validateGeneralClusterChanges(
 		)
 		valErrors = append(valErrors, appCatalogModifiedMsg)
 	}
+	// The envSecret feeds the member env, which can't be changed while
+	// members exist.
+	if !equality.Semantic.DeepEqual(cr.Spec.EnvSecret, prevCr.Spec.EnvSecret) {
+		envSecretModifiedMsg := fmt.Sprintf(
+			modifiedProperty,
+			"envSecret",
+		)
+		valErrors = append(valErrors, envSecretModifiedMsg)
+	}
+	// The init container settings are part of the member pod template,
+	// which isn't regenerated for existing roles.
+	if !equality.Semantic.DeepEqual(cr.Spec.InitContainer, prevCr.Spec.InitContainer) {
+		initContainerModifiedMsg := fmt.Sprintf(
+			modifiedProperty,
+			"initContainer",
+		)
+		valErrors = append(valErrors, initContainerModifiedMsg)
+	}
+	// Spec fragments are only merged at creation, so changing the list
+	// afterward would be misleading.
+	if !equality.Semantic.DeepEqual(cr.Spec.SpecFragments, prevCr.Spec.SpecFragments) {
+		specFragmentsModifiedMsg := fmt.Sprintf(
+			modifiedProperty,
+			"specFragments",
+		)
+		valErrors = append(valErrors, specFragmentsModifiedMsg)
+	}
+	// Likewise a clone source is only used when the cluster is created.
+	if !equality.Semantic.DeepEqual(cr.Spec.CloneFrom, prevCr.Spec.CloneFrom) {
+		cloneFromModifiedMsg := fmt.Sprintf(
+			modifiedProperty,
+			"cloneFrom",
+		)
+		valErrors = append(valErrors, cloneFromModifiedMsg)
+	}
 
 	return valErrors
 }
@@ -393,6 +453,45 @@ func validateRoleChanges(
 		// the new spec if anything other than the members count is different.
 		compareRole := *role
 		compareRole.Members = prevRole.Members
+		// The storage size may also be increased, if the storage class
+		// allows it.
+		if role.Storage != nil && prevRole.Storage != nil &&
+			role.Storage.Size != prevRole.Storage.Size {
+			valErrors = validateStorageExpansion(role, prevRole, valErrors)
+			compareStorage := *role.Storage
+			compareStorage.Size = prevRole.Storage.Size
+			compareRole.Storage = &compareStorage
+		}
+		// Likewise the block device size, and devices can be added.
+		if role.BlockStorage != nil && prevRole.BlockStorage != nil {
+			valErrors = validateBlockStorageChange(role, prevRole, valErrors)
+			compareBlockStorage := *role.BlockStorage
+			compareBlockStorage.Size = prevRole.BlockStorage.Size
+			compareBlockStorage.NumDevices = prevRole.BlockStorage.NumDevices
+			compareRole.BlockStorage = &compareBlockStorage
+		}
+		// The type and annotations of the member services are reconciled
+		// on the existing services.
+		compareRole.ServiceType = prevRole.ServiceType
+		compareRole.ServiceAnnotations = prevRole.ServiceAnnotations
+		compareRole.MemberServiceAnnotations = prevRole.MemberServiceAnnotations
+		// So are the labels and annotations of the member PVCs.
+		compareRole.PVCLabels = prevRole.PVCLabels
+		compareRole.PVCAnnotations = prevRole.PVCAnnotations
+		// A restart of the existing members can be requested, but the
+		// restart generation cannot go backwards.
+		if (role.Restart != nil) && (prevRole.Restart != nil) &&
+			(role.Restart.Generation < prevRole.Restart.Generation) {
+			valErrors = append(
+				valErrors,
+				fmt.Sprintf(restartGenerationDecrease, role.Name),
+			)
+		}
+		compareRole.Restart = prevRole.Restart
+		// The claim retention policy only affects what happens later.
+		compareRole.PVCRetentionPolicy = prevRole.PVCRetentionPolicy
+		// As does the configure policy.
+		compareRole.ConfigurePolicy = prevRole.ConfigurePolicy
 		if !equality.Semantic.DeepEqual(&compareRole, prevRole) {
 			roleModifiedMsg := fmt.Sprintf(
 				modifiedRole,
@@ -404,10 +503,127 @@ func validateRoleChanges(
 	return valErrors
 }
 
+// validateStorageExpansion checks a change to the storage size of a role
+// that has members. The size can only be increased, and only if the role's
+// storage class allows volume expansion. Any generated error messages will be
+// added to the input list and returned.
+func validateStorageExpansion(
+	role *kdv1.Role,
+	prevRole *kdv1.Role,
+	valErrors []string,
+) []string {
+
+	newSize, newErr := resource.ParseQuantity(role.Storage.Size)
+	prevSize, prevErr := resource.ParseQuantity(prevRole.Storage.Size)
+	if newErr != nil || prevErr != nil {
+		// A bad size will be reported by validateRoleStorageClass.
+		return valErrors
+	}
+	switch newSize.Cmp(prevSize) {
+	case 0:
+		return valErrors
+	case -1:
+		return append(
+			valErrors,
+			fmt.Sprintf(
+				storageShrink,
+				role.Name,
+			),
+		)
+	}
+
+	storageClassName, expandable := storageClassExpandable(prevRole.Storage.StorageClass)
+	if !expandable {
+		valErrors = append(
+			valErrors,
+			fmt.Sprintf(
+				storageNotExpandable,
+				role.Name,
+				storageClassName,
+			),
+		)
+	}
+	return valErrors
+}
+
+// validateBlockStorageChange checks a change to the block storage of a role
+// that has members. The device size can only be increased, and only if the
+// storage class allows volume expansion; the number of devices can only be
+// increased. Any generated error messages will be added to the input list
+// and returned.
+func validateBlockStorageChange(
+	role *kdv1.Role,
+	prevRole *kdv1.Role,
+	valErrors []string,
+) []string {
+
+	if (role.BlockStorage.NumDevices != nil) && (prevRole.BlockStorage.NumDevices != nil) &&
+		(*role.BlockStorage.NumDevices < *prevRole.BlockStorage.NumDevices) {
+		valErrors = append(
+			valErrors,
+			fmt.Sprintf(
+				blockDevicesDecrease,
+				role.Name,
+			),
+		)
+	}
+
+	newSize := executor.BlockDeviceSize(role)
+	prevSize := executor.BlockDeviceSize(prevRole)
+	switch newSize.Cmp(prevSize) {
+	case 0:
+		return valErrors
+	case -1:
+		return append(
+			valErrors,
+			fmt.Sprintf(
+				blockStorageShrink,
+				role.Name,
+			),
+		)
+	}
+	storageClassName, expandable := storageClassExpandable(prevRole.BlockStorage.StorageClass)
+	if !expandable {
+		valErrors = append(
+			valErrors,
+			fmt.Sprintf(
+				blockStorageNotExpandable,
+				role.Name,
+				storageClassName,
+			),
+		)
+	}
+	return valErrors
+}
+
+// storageClassExpandable returns the name of the storage class used by a
+// role's claims, given the class named in the role spec, and whether that
+// class allows volume expansion.
+func storageClassExpandable(
+	specStorageClass *string,
+) (string, bool) {
+
+	// The storage class will have been populated when the role was created,
+	// unless the cluster predates that defaulting.
+	var storageClassName string
+	if specStorageClass != nil {
+		storageClassName = *specStorageClass
+	} else if globalStorageClass := shared.GetDefaultStorageClass(); len(globalStorageClass) > 0 {
+		storageClassName = globalStorageClass
+	} else if scK8sDefault, _ := observer.GetDefaultStorageClass(); scK8sDefault != nil {
+		storageClassName = scK8sDefault.Name
+	}
+	storageClass, scErr := observer.GetStorageClass(storageClassName)
+	expandable := (scErr == nil) &&
+		(storageClass.AllowVolumeExpansion != nil) &&
+		*storageClass.AllowVolumeExpansion
+	return storageClassName, expandable
+}
+
 // validateRoleStorageClass verifies storageClassName definition for a role
 // If storage section is defined for a role, see if a storageClassName is
 // also defined and if so validate it. If not, but a default is present in the
-// global config, validate and use that one. Final fallback is to check to see
+// namespace config or global config, validate and use that one. Final fallback is to check to see
 // if the underlying platform has a default storage class.
 func validateRoleStorageClass(
 	cr *kdv1.KubeDirectorCluster,
@@ -418,7 +634,7 @@ func validateRoleStorageClass(
 	var validateDefault = false
 	var missingDefault = false
 
-	globalStorageClass := shared.GetDefaultStorageClass()
+	globalStorageClass := defaultStorageClass(cr.Namespace)
 	numRoles := len(cr.Spec.Roles)
 	for i := 0; i < numRoles; i++ {
 		role := &(cr.Spec.Roles[i])
@@ -516,6 +732,46 @@ func validateRoleStorageClass(
 	return valErrors, patches
 }
 
+// validateStorageEncryption checks, if the cluster requires encrypted
+// storage, that the storage classes of every role's persistent storage and
+// block devices encrypt their volumes at rest. Any generated error messages
+// will be added to the input list and returned.
+func validateStorageEncryption(
+	cr *kdv1.KubeDirectorCluster,
+	valErrors []string,
+) []string {
+
+	if !cr.Spec.RequireEncryptedStorage {
+		return valErrors
+	}
+	checkClass := func(
+		roleName string,
+		storageClass *string,
+	) {
+
+		var storageClassName string
+		if storageClass != nil {
+			storageClassName = *storageClass
+		}
+		encrypted, scErr := executor.StorageClassNameEncrypted(storageClassName)
+		if (scErr == nil) && !encrypted {
+			valErrors = append(
+				valErrors,
+				fmt.Sprintf(unencryptedStorageClass, storageClassName, roleName),
+			)
+		}
+	}
+	for _, role := range cr.Spec.Roles {
+		if role.Storage != nil {
+			checkClass(role.Name, role.Storage.StorageClass)
+		}
+		if role.BlockStorage != nil {
+			checkClass(role.Name, role.BlockStorage.StorageClass)
+		}
+	}
+	return valErrors
+}
+
 // validateRoleSA validates whether the SA exists and if it does
 // is the user allowed to access it or not
 func validateRoleServiceAccount(
@@ -538,10 +794,11 @@ func validateRoleServiceAccount(
 			continue
 		}
 
-		errStr := createSubjectAccessReview(
+		errStr := checkUserAccess(
 			userInfo,
 			cr.Namespace,
-			"ServiceAccount",
+			"",
+			"serviceaccounts",
 			role.ServiceAccountName,
 			"get",
 		)
@@ -553,6 +810,423 @@ func validateRoleServiceAccount(
 	return valErrs
 }
 
+// validateRolePriorityClass checks that the priority class named by each
+// role, if any, exists.
+func validateRolePriorityClass(
+	cr *kdv1.KubeDirectorCluster,
+	valErrors []string,
+) []string {
+
+	for _, role := range cr.Spec.Roles {
+		if role.PriorityClassName == "" {
+			continue
+		}
+		_, err := observer.GetPriorityClass(role.PriorityClassName)
+		if err != nil {
+			valErrors = append(
+				valErrors,
+				fmt.Sprintf(invalidPriorityClass, role.PriorityClassName, role.Name),
+			)
+		}
+	}
+	return valErrors
+}
+
+// validateRoleWorkloadIdentity checks the workloadIdentity stanza of each
+// role. The provider must be known and the identity non-empty. A role that
+// requests workload identity gets a generated service account, so it cannot
+// also name an existing one.
+func validateRoleWorkloadIdentity(
+	cr *kdv1.KubeDirectorCluster,
+	valErrors []string,
+) []string {
+
+	validProviders := []string{
+		kdv1.WorkloadIdentityAWS,
+		kdv1.WorkloadIdentityGCP,
+		kdv1.WorkloadIdentityAzure,
+	}
+	numRoles := len(cr.Spec.Roles)
+	for i := 0; i < numRoles; i++ {
+		role := &(cr.Spec.Roles[i])
+		identity := role.WorkloadIdentity
+		if identity == nil {
+			continue
+		}
+		if !shared.StringInList(identity.Provider, validProviders) {
+			valErrors = append(
+				valErrors,
+				fmt.Sprintf(
+					invalidIdentityProvider,
+					identity.Provider,
+					role.Name,
+					strings.Join(validProviders, ","),
+				),
+			)
+		}
+		if strings.TrimSpace(identity.Identity) == "" {
+			valErrors = append(
+				valErrors,
+				fmt.Sprintf(invalidIdentityValue, role.Name),
+			)
+		}
+		if (identity.TenantID != nil) && (identity.Provider != kdv1.WorkloadIdentityAzure) {
+			valErrors = append(
+				valErrors,
+				fmt.Sprintf(invalidIdentityTenant, role.Name),
+			)
+		}
+		if role.ServiceAccountName != "" {
+			valErrors = append(
+				valErrors,
+				fmt.Sprintf(conflictingIdentitySA, role.Name),
+			)
+		}
+	}
+	return valErrors
+}
+
+// validateRoleSidecars checks the sidecar containers declared for each
+// role. Sidecar names must be valid, unique within the role, and must not
+// collide with the containers that KubeDirector itself generates or the
+// additional containers of the app. Shared directories must be given as
+// absolute paths.
+func validateRoleSidecars(
+	cr *kdv1.KubeDirectorCluster,
+	appCR *kdv1.KubeDirectorApp,
+	valErrors []string,
+) []string {
+
+	// Names of the app, init, setup, debug, and log shipper containers in
+	// member pods.
+	reservedNames := []string{"app", "init", "setup", "kd-debug", "kd-log-shipper"}
+	numRoles := len(cr.Spec.Roles)
+	for i := 0; i < numRoles; i++ {
+		role := &(cr.Spec.Roles[i])
+		var names []string
+		var appContainerNames []string
+		if appRole := catalog.GetRoleFromID(appCR, role.Name); appRole != nil {
+			for _, appContainer := range appRole.Containers {
+				appContainerNames = append(appContainerNames, appContainer.Name)
+			}
+		}
+		for _, sidecar := range role.Sidecars {
+			nameErrs := k8svalidation.IsDNS1123Label(sidecar.Name)
+			if shared.StringInList(sidecar.Name, reservedNames) {
+				nameErrs = append(nameErrs, "name is reserved for KubeDirector use")
+			} else if shared.StringInList(sidecar.Name, appContainerNames) {
+				nameErrs = append(nameErrs, "name is used by a container of the app")
+			} else if shared.StringInList(sidecar.Name, names) {
+				nameErrs = append(nameErrs, "name is repeated")
+			}
+			if len(nameErrs) != 0 {
+				valErrors = append(
+					valErrors,
+					fmt.Sprintf(
+						invalidSidecarName,
+						sidecar.Name,
+						role.Name,
+						strings.Join(nameErrs, "; "),
+					),
+				)
+			}
+			names = append(names, sidecar.Name)
+			if strings.TrimSpace(sidecar.Image) == "" {
+				valErrors = append(
+					valErrors,
+					fmt.Sprintf(invalidSidecarImage, sidecar.Name, role.Name),
+				)
+			}
+			var mountPaths []string
+			for _, mount := range sidecar.VolumeMounts {
+				var mountErr string
+				if !filepath.IsAbs(mount.AppPath) || (filepath.Clean(mount.AppPath) == "/") {
+					mountErr = fmt.Sprintf("appPath(%s) must be an absolute path below /", mount.AppPath)
+				} else if !filepath.IsAbs(mount.MountPath) {
+					mountErr = fmt.Sprintf("mountPath(%s) must be an absolute path", mount.MountPath)
+				} else if shared.StringInList(filepath.Clean(mount.MountPath), mountPaths) {
+					mountErr = fmt.Sprintf("mountPath(%s) is repeated", mount.MountPath)
+				}
+				if mountErr != "" {
+					valErrors = append(
+						valErrors,
+						fmt.Sprintf(invalidSidecarMount, sidecar.Name, role.Name, mountErr),
+					)
+				}
+				mountPaths = append(mountPaths, filepath.Clean(mount.MountPath))
+			}
+		}
+	}
+	return valErrors
+}
+
+// validateRoleLogging checks that a log sink is configured for any role
+// that asks for a logging sidecar.
+func validateRoleLogging(
+	cr *kdv1.KubeDirectorCluster,
+	valErrors []string,
+) []string {
+
+	if shared.GetLogSinkConfig() != nil {
+		return valErrors
+	}
+	for _, role := range cr.Spec.Roles {
+		if (role.Logging != nil) && (role.Logging.Mode == kdv1.LoggingSidecar) {
+			valErrors = append(
+				valErrors,
+				fmt.Sprintf(logSinkMissing, role.Logging.Mode, role.Name),
+			)
+		}
+	}
+	return valErrors
+}
+
+// validateRoleRuntimeSocket checks that a role asking for a container
+// runtime socket is in a namespace allowed to have one, and that only the
+// docker-in-docker source is given an image. The namespace is only checked
+// when the runtime socket is added to a role, so that removing a namespace
+// from the list doesn't block changes to clusters already running there.
+func validateRoleRuntimeSocket(
+	cr *kdv1.KubeDirectorCluster,
+	prevCr *kdv1.KubeDirectorCluster,
+	valErrors []string,
+) []string {
+
+	prevSockets := make(map[string]*kdv1.RuntimeSocket)
+	for _, prevRole := range prevCr.Spec.Roles {
+		prevSockets[prevRole.Name] = prevRole.RuntimeSocket
+	}
+	allowedNamespaces := shared.GetRuntimeSocketNamespaces()
+	for _, role := range cr.Spec.Roles {
+		if role.RuntimeSocket == nil {
+			continue
+		}
+		if (role.RuntimeSocket.Image != nil) &&
+			(role.RuntimeSocket.Source != kdv1.RuntimeSocketDinD) {
+			valErrors = append(
+				valErrors,
+				fmt.Sprintf(
+					runtimeSocketImage,
+					role.Name,
+					role.RuntimeSocket.Source,
+					kdv1.RuntimeSocketDinD,
+				),
+			)
+		}
+		if equality.Semantic.DeepEqual(role.RuntimeSocket, prevSockets[role.Name]) {
+			continue
+		}
+		if !shared.StringInList(cr.Namespace, allowedNamespaces) {
+			valErrors = append(
+				valErrors,
+				fmt.Sprintf(runtimeSocketNamespace, role.Name, cr.Namespace),
+			)
+		}
+	}
+	return valErrors
+}
+
+// validateRoleScratch checks the scratch volumes declared for each role.
+// Names must be valid and unique within the role (they become part of the
+// volume names), mount paths must be absolute and unique, and any size
+// limit must be a positive quantity.
+func validateRoleScratch(
+	cr *kdv1.KubeDirectorCluster,
+	valErrors []string,
+) []string {
+
+	numRoles := len(cr.Spec.Roles)
+	for i := 0; i < numRoles; i++ {
+		role := &(cr.Spec.Roles[i])
+		var names []string
+		var mountPaths []string
+		for _, scratch := range role.Scratch {
+			var scratchErrs []string
+			// The volume name adds an 11-character prefix.
+			if errs := k8svalidation.IsDNS1123Label("kd-scratch-" + scratch.Name); len(errs) != 0 {
+				scratchErrs = append(scratchErrs, errs...)
+			} else if shared.StringInList(scratch.Name, names) {
+				scratchErrs = append(scratchErrs, "name is repeated")
+			}
+			names = append(names, scratch.Name)
+			cleanPath := filepath.Clean(scratch.MountPath)
+			if !filepath.IsAbs(scratch.MountPath) || (cleanPath == "/") {
+				scratchErrs = append(
+					scratchErrs,
+					fmt.Sprintf("mountPath(%s) must be an absolute path below /", scratch.MountPath),
+				)
+			} else if shared.StringInList(cleanPath, mountPaths) {
+				scratchErrs = append(
+					scratchErrs,
+					fmt.Sprintf("mountPath(%s) is repeated", scratch.MountPath),
+				)
+			}
+			mountPaths = append(mountPaths, cleanPath)
+			if scratch.SizeLimit != nil {
+				size, sizeErr := resource.ParseQuantity(*scratch.SizeLimit)
+				if (sizeErr != nil) || (size.Sign() != 1) {
+					scratchErrs = append(
+						scratchErrs,
+						fmt.Sprintf("sizeLimit(%s) must be a positive quantity", *scratch.SizeLimit),
+					)
+				}
+			}
+			if len(scratchErrs) != 0 {
+				valErrors = append(
+					valErrors,
+					fmt.Sprintf(
+						invalidScratchVolume,
+						scratch.Name,
+						role.Name,
+						strings.Join(scratchErrs, "; "),
+					),
+				)
+			}
+		}
+	}
+	return valErrors
+}
+
+// validateObjectStoreConnections checks the object store connections in the
+// cluster spec. Names must be unique and types known, and an abfs store
+// must identify its storage account through the endpoint. Since any
+// referenced credentials will be exposed to the cluster members, the user
+// must also be allowed to read the credentials secret.
+func validateObjectStoreConnections(
+	cr *kdv1.KubeDirectorCluster,
+	userInfo v1.UserInfo,
+	valErrors []string,
+) []string {
+
+	validTypes := []string{
+		kdv1.ObjectStoreS3,
+		kdv1.ObjectStoreGCS,
+		kdv1.ObjectStoreABFS,
+	}
+	var storeNames []string
+	for _, store := range cr.Spec.Connections.ObjectStores {
+		if shared.StringInList(store.Name, storeNames) {
+			valErrors = append(
+				valErrors,
+				fmt.Sprintf(nonUniqueObjectStore, store.Name),
+			)
+		}
+		storeNames = append(storeNames, store.Name)
+		if !shared.StringInList(store.Type, validTypes) {
+			valErrors = append(
+				valErrors,
+				fmt.Sprintf(
+					invalidObjectStoreType,
+					store.Type,
+					store.Name,
+					strings.Join(validTypes, ","),
+				),
+			)
+		}
+		if store.Bucket == "" {
+			valErrors = append(
+				valErrors,
+				fmt.Sprintf(invalidObjectStoreField, store.Name, "bucket"),
+			)
+		}
+		if (store.Type == kdv1.ObjectStoreABFS) &&
+			((store.Endpoint == nil) || (*store.Endpoint == "")) {
+			valErrors = append(
+				valErrors,
+				fmt.Sprintf(invalidObjectStoreField, store.Name, "endpoint"),
+			)
+		}
+		if store.SecretRef != nil {
+			errStr := checkUserAccess(
+				userInfo,
+				cr.Namespace,
+				"",
+				"secrets",
+				*store.SecretRef,
+				"get",
+			)
+			if errStr != "" {
+				valErrors = append(valErrors, errStr)
+			}
+		}
+	}
+	return valErrors
+}
+
+// validateDatabaseConnections checks the database connections in the
+// cluster spec. Names must be unique, engines known, and the host and port
+// sensible. As with object stores, the user must be allowed to read any
+// secrets whose content will be exposed to the cluster members.
+func validateDatabaseConnections(
+	cr *kdv1.KubeDirectorCluster,
+	userInfo v1.UserInfo,
+	valErrors []string,
+) []string {
+
+	validEngines := []string{
+		kdv1.DatabasePostgres,
+		kdv1.DatabaseMySQL,
+		kdv1.DatabaseMariaDB,
+		kdv1.DatabaseMSSQL,
+		kdv1.DatabaseOracle,
+	}
+	var dbNames []string
+	for _, db := range cr.Spec.Connections.Databases {
+		if shared.StringInList(db.Name, dbNames) {
+			valErrors = append(
+				valErrors,
+				fmt.Sprintf(nonUniqueDatabase, db.Name),
+			)
+		}
+		dbNames = append(dbNames, db.Name)
+		if !shared.StringInList(db.Engine, validEngines) {
+			valErrors = append(
+				valErrors,
+				fmt.Sprintf(
+					invalidDatabaseType,
+					db.Engine,
+					db.Name,
+					strings.Join(validEngines, ","),
+				),
+			)
+		}
+		if len(k8svalidation.IsDNS1123Subdomain(db.Host)) != 0 &&
+			len(k8svalidation.IsValidIP(db.Host)) != 0 {
+			valErrors = append(
+				valErrors,
+				fmt.Sprintf(invalidDatabaseField, "host", db.Name),
+			)
+		}
+		if (db.Port != nil) && (len(k8svalidation.IsValidPortNum(int(*db.Port))) != 0) {
+			valErrors = append(
+				valErrors,
+				fmt.Sprintf(invalidDatabaseField, "port", db.Name),
+			)
+		}
+		secretNames := []*string{db.SecretRef}
+		if db.TLS != nil {
+			secretNames = append(secretNames, db.TLS.CASecretRef)
+		}
+		for _, secretName := range secretNames {
+			if secretName == nil {
+				continue
+			}
+			errStr := checkUserAccess(
+				userInfo,
+				cr.Namespace,
+				"",
+				"secrets",
+				*secretName,
+				"get",
+			)
+			if errStr != "" {
+				valErrors = append(valErrors, errStr)
+			}
+		}
+	}
+	return valErrors
+}
+
 // validateApp function checks for valid app and if necessary creates a patch
 // to populate appCatalog in the spec.
 func validateApp(
@@ -777,6 +1451,83 @@ func validateFileInjections(
 	return valErrors, patches
 }
 
+// validateShelllessRoles checks that roles of a shellless app don't request
+// persistent storage or file injections, since both are implemented by
+// running shell commands in the app container.
+func validateShelllessRoles(
+	cr *kdv1.KubeDirectorCluster,
+	appCR *kdv1.KubeDirectorApp,
+	valErrors []string,
+) []string {
+
+	if !appCR.Spec.Shellless {
+		return valErrors
+	}
+	for _, role := range cr.Spec.Roles {
+		if role.Storage != nil {
+			valErrors = append(
+				valErrors,
+				fmt.Sprintf(shelllessStorage, role.Name, appCR.Name),
+			)
+		}
+		if len(role.FileInjections) != 0 {
+			valErrors = append(
+				valErrors,
+				fmt.Sprintf(shelllessInjection, role.Name, appCR.Name),
+			)
+		}
+	}
+	return valErrors
+}
+
+// validatePropagateLabels checks the keys listed in propagateLabels. They
+// must be valid label keys, must not be reserved for use by KubeDirector or
+// K8s (which would let a label edit change a selector), and must not also
+// be set by the pod or service labels of any role.
+func validatePropagateLabels(
+	cr *kdv1.KubeDirectorCluster,
+	valErrors []string,
+) []string {
+
+	seen := make(map[string]bool)
+	for _, key := range cr.Spec.PropagateLabels {
+		if seen[key] {
+			valErrors = append(valErrors, fmt.Sprintf(nonUniquePropagateLabel, key))
+			continue
+		}
+		seen[key] = true
+		if problems := k8svalidation.IsQualifiedName(key); len(problems) != 0 {
+			valErrors = append(
+				valErrors,
+				fmt.Sprintf(invalidPropagateLabel, key, strings.Join(problems, "; ")),
+			)
+			continue
+		}
+		if shared.ReservedLabelKey(key) {
+			valErrors = append(
+				valErrors,
+				fmt.Sprintf(reservedLabelKey, key, "propagateLabels"),
+			)
+			continue
+		}
+		for _, role := range cr.Spec.Roles {
+			if _, ok := role.PodLabels[key]; ok {
+				valErrors = append(
+					valErrors,
+					fmt.Sprintf(conflictingPropagateLabel, key, "podLabels", role.Name),
+				)
+			}
+			if _, ok := role.ServiceLabels[key]; ok {
+				valErrors = append(
+					valErrors,
+					fmt.Sprintf(conflictingPropagateLabel, key, "serviceLabels", role.Name),
+				)
+			}
+		}
+	}
+	return valErrors
+}
+
 // validateSecrets validates defaultSecret and individual secret field for
 // each role. Validation is done to make sure secret object with the given
 // name is present in the cluster CR's namespace, and that its name includes
@@ -890,6 +1641,50 @@ func validateSecrets(
 	return valErrors, patches
 }
 
+// validateConfigMapMounts checks that the configmaps to be mounted in each
+// role exist in the cluster CR's namespace, and that no two of the role's
+// secret, configmap, and pod info mounts use the same path. Any generated error
+// messages will be added to the input list and returned.
+func validateConfigMapMounts(
+	cr *kdv1.KubeDirectorCluster,
+	valErrors []string,
+) []string {
+
+	for _, role := range cr.Spec.Roles {
+		mountPaths := make(map[string]bool)
+		if role.Secret != nil {
+			mountPaths[filepath.Clean(role.Secret.MountPath)] = true
+		}
+		if role.PodInfoMountPath != nil {
+			mountPath := filepath.Clean(*role.PodInfoMountPath)
+			if mountPaths[mountPath] {
+				valErrors = append(
+					valErrors,
+					fmt.Sprintf(duplicateMountPath, role.Name, mountPath),
+				)
+			}
+			mountPaths[mountPath] = true
+		}
+		for _, configMap := range role.ConfigMaps {
+			if _, fetchErr := observer.GetConfigMap(cr.Namespace, configMap.Name); fetchErr != nil {
+				valErrors = append(
+					valErrors,
+					fmt.Sprintf(invalidConfigMapMount, configMap.Name, role.Name, cr.Namespace),
+				)
+			}
+			mountPath := filepath.Clean(configMap.MountPath)
+			if mountPaths[mountPath] {
+				valErrors = append(
+					valErrors,
+					fmt.Sprintf(duplicateMountPath, role.Name, mountPath),
+				)
+			}
+			mountPaths[mountPath] = true
+		}
+	}
+	return valErrors
+}
+
 // encryptSecretKeys encrypts secret keys per each role and generates patches if needed
 func encryptSecretKeys(
 	cr *kdv1.KubeDirectorCluster,
@@ -944,7 +1739,7 @@ func encryptSecretKeys(
 
 // addServiceType function checks to see if serviceType is provided for a
 // cluster CR. If unspecified, check to see if there is a default serviceType
-// provided through kubedirector's config CR, otherwise use a global constant
+// provided through the namespace config or kubedirector's config CR, otherwise use a global constant
 // for service type. In either of those cases add an entry to PATCH spec for mutating
 // cluster CR.
 func addServiceType(
@@ -957,7 +1752,7 @@ func addServiceType(
 		return valErrors, patches
 	}
 
-	serviceType := shared.GetDefaultServiceType()
+	serviceType := defaultServiceType(cr.Namespace)
 	cr.Spec.ServiceType = &serviceType
 	patches = append(
 		patches,
@@ -1110,11 +1905,12 @@ func validateVolumeProjections(
 				exclusivePvcs[volume.PvcName] = exclusivePvcs[volume.PvcName] + *(role.Members)
 			}
 
-			errStr := createSubjectAccessReview(
+			errStr := checkUserAccess(
 				userInfo,
 				cr.Namespace,
-				"PersistentVolumeClaim",
-				role.ServiceAccountName,
+				"",
+				"persistentvolumeclaims",
+				volume.PvcName,
 				"get",
 			)
 			if errStr != "" {
@@ -1284,6 +2080,25 @@ func admitClusterCR(
 
 	kubedirectorcluster.ClusterStatusGens.ValidateStatusGen(clusterCR.UID)
 
+	// Record the creator of a new cluster, and don't allow that record to be
+	// changed afterward. Also metadata, so done before the shortcut below.
+	if ar.Request.Operation == v1beta1.Create {
+		valErrors, patches = recordCreator(&clusterCR, ar.Request.UserInfo, valErrors, patches)
+	} else {
+		valErrors = validateCreatorUnchanged(&clusterCR, &prevClusterCR, valErrors)
+	}
+
+	// Check any request to turn on debug mode. This is metadata rather than
+	// spec, so it must be done before the shortcut below.
+	valErrors, patches = validateDebugMode(&clusterCR, &prevClusterCR, ar.Request.UserInfo, valErrors, patches)
+
+	// Likewise check any approval of a queued membership change.
+	valErrors, patches = validateApproval(&clusterCR, &prevClusterCR, ar.Request.UserInfo, valErrors, patches)
+
+	// A rollback request swaps in the last-known-good spec, which is then
+	// validated like any other spec change.
+	valErrors, patches = applyRollback(&clusterCR, &prevClusterCR, valErrors, patches)
+
 	// Shortcut out of here if the spec is not being changed. Among other
 	// things this allows KD to update status or metadata even if the
 	// referenced app is bad/gone. Note that we can't just check the
@@ -1315,6 +2130,31 @@ func admitClusterCR(
 		return &admitResponse
 	}
 
+	// Merge any spec fragments into a new cluster's roles first, and then
+	// fill in the default scheduling settings, so that the remaining
+	// validation applies to the merged result. Also check the
+	// clone source, if any, and that this K8s cluster meets the app's
+	// requirements.
+	if ar.Request.Operation == v1beta1.Create {
+		valErrors, patches = applySpecFragments(&clusterCR, valErrors, patches)
+		patches = applySchedulingDefaults(&clusterCR, patches)
+		valErrors = validateCloneFrom(&clusterCR, ar.Request.UserInfo, valErrors)
+		valErrors = validateAppRequirements(appCR, valErrors)
+	}
+
+	// The update checks below look at every member of the cluster, so bring
+	// back any member statuses that have been moved out to the member
+	// status detail configmap.
+	if ar.Request.Operation == v1beta1.Update {
+		if loadErr := shared.LoadMemberStatusDetail(&clusterCR); loadErr != nil {
+			valErrors = append(
+				valErrors,
+				fmt.Sprintf(memberDetailUnavailable, loadErr),
+			)
+			return &admitResponse
+		}
+	}
+
 	// Validate that it's OK to change the spec. Note that this check assumes
 	// that the above "shortcut" is in place, i.e. we are only calling this
 	// if the spec is changing.
@@ -1325,9 +2165,34 @@ func admitClusterCR(
 	// Validate cardinality and generate patches for defaults members values.
 	valErrors, patches = validateCardinality(&clusterCR, appCR, valErrors, patches)
 
+	// If so configured, reject membership changes that would have to wait
+	// for an in-progress change. (Relies on members having been defaulted
+	// by validateCardinality.)
+	if (ar.Request.Operation == v1beta1.Update) && shared.GetRejectConflictingChanges() {
+		if conflicts, activeGen := kubedirectorcluster.ChangeConflicts(&clusterCR); conflicts {
+			valErrors = append(
+				valErrors,
+				fmt.Sprintf(conflictingChange, activeGen),
+			)
+		}
+	}
+
+	// If so configured, reject shrinks that would destroy member storage
+	// without acknowledgement. (Also relies on defaulted members.)
+	if ar.Request.Operation == v1beta1.Update {
+		valErrors = validateShrinkAcknowledgement(&clusterCR, valErrors)
+	}
+
 	// Validate that roles are known & sufficient.
 	valErrors = validateClusterRoles(&clusterCR, appCR, valErrors)
 
+	// Validate the app and member resources against the namespace config
+	if ar.Request.Operation == v1beta1.Create {
+		valErrors = validateNamespaceAllowedApp(&clusterCR, valErrors)
+	}
+	valErrors = validateNamespaceResourceCeilings(&clusterCR, valErrors)
+	valErrors = validateClusterResourceCeiling(&clusterCR, appCR, valErrors)
+
 	// Validate minimum resources for all roles
 	valErrors = validateMinResources(&clusterCR, appCR, valErrors)
 
@@ -1337,26 +2202,90 @@ func admitClusterCR(
 	// Validate if the role's service account exists and if the user has permission to use
 	valErrors = validateRoleServiceAccount(&clusterCR, valErrors, ar.Request.UserInfo)
 
+	// Validate that any role priority class exists
+	valErrors = validateRolePriorityClass(&clusterCR, valErrors)
+
+	// Validate workload identity settings for all roles
+	valErrors = validateRoleWorkloadIdentity(&clusterCR, valErrors)
+
+	// Validate sidecar containers for all roles
+	valErrors = validateRoleSidecars(&clusterCR, appCR, valErrors)
+
+	// Validate log collection settings for all roles
+	valErrors = validateRoleLogging(&clusterCR, valErrors)
+
+	// Validate scratch volumes for all roles
+	valErrors = validateRoleScratch(&clusterCR, valErrors)
+
+	// Validate container runtime socket access for all roles
+	valErrors = validateRoleRuntimeSocket(&clusterCR, &prevClusterCR, valErrors)
+
+	// Validate block device paths against each other and the role's mounts
+	valErrors = validateRoleBlockDevices(&clusterCR, appCR, valErrors)
+
 	valErrors, patches = validateRoleStorageClass(&clusterCR, valErrors, patches)
 
+	// Validate storage encryption if required. (Relies on the defaulted
+	// storage classes.)
+	valErrors = validateStorageEncryption(&clusterCR, valErrors)
+
+	// Validate requested PVC access modes against the storage classes.
+	valErrors = validateRoleAccessModes(&clusterCR, &prevClusterCR, valErrors)
+
+	// Validate role affinity content
+	valErrors = validateRoleAffinity(&clusterCR, valErrors)
+
+	// Validate role tolerations and node selectors
+	valErrors = validateRoleNodePlacement(&clusterCR, valErrors)
+
+	// Validate role pod security contexts
+	valErrors = validateRolePodSecurityContext(&clusterCR, valErrors)
+
 	// Validate service type and generate patch in case no service type defined or change
 	valErrors, patches = addServiceType(&clusterCR, valErrors, patches)
 
 	// Validate naming scheme and generate patch in case no naming scheme defined or change
 	patches = validateNamingScheme(&clusterCR, appCR, patches)
 
+	// A naming scheme change re-creates the statefulsets of existing roles,
+	// so it must be acknowledged. (Relies on the defaulted naming scheme.)
+	if ar.Request.Operation == v1beta1.Update {
+		valErrors = validateNamingSchemeChange(&clusterCR, &prevClusterCR, valErrors)
+	}
+
 	// Validate file injections and generate patches for default values (if any)
 	valErrors, patches = validateFileInjections(&clusterCR, valErrors, patches)
 
+	// Validate that a shellless app isn't asked to do shell-based setup
+	valErrors = validateShelllessRoles(&clusterCR, appCR, valErrors)
+
 	// Validate secret and generate patches for default values (if any)
 	valErrors, patches = validateSecrets(&clusterCR, valErrors, patches)
 
+	// Validate configmaps to be mounted
+	valErrors = validateConfigMapMounts(&clusterCR, valErrors)
+
 	// Generate patches to conceal raw secret keys' values
 	valErrors, patches = encryptSecretKeys(&clusterCR, &prevClusterCR, valErrors, patches)
 
 	// Validate volume projections
 	valErrors, patches = validateVolumeProjections(&clusterCR, ar.Request.UserInfo, valErrors, patches)
 
+	// Validate object store connections
+	valErrors = validateObjectStoreConnections(&clusterCR, ar.Request.UserInfo, valErrors)
+
+	// Validate database connections
+	valErrors = validateDatabaseConnections(&clusterCR, ar.Request.UserInfo, valErrors)
+
+	// Validate the secrets and configmaps that supply env vars
+	valErrors = validateEnvFrom(&clusterCR, ar.Request.UserInfo, valErrors)
+
+	// Validate that the env vars required by the app are supplied
+	valErrors = validateRequiredEnvSupplied(&clusterCR, appCR, ar.Request.UserInfo, valErrors)
+
+	// Validate the keys of the labels to propagate to members
+	valErrors = validatePropagateLabels(&clusterCR, valErrors)
+
 	// If cluster already exists, check for invalid property changes.
 	if ar.Request.Operation == v1beta1.Update {
 		var changeErrors []string
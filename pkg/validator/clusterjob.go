@@ -0,0 +1,102 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validator
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	"github.com/bluek8s/kubedirector/pkg/controller/kubedirectorclusterjob"
+	"k8s.io/api/admission/v1beta1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// admitClusterJobCR is the top-level cluster job validation function. The
+// job must give exactly one of a command and a hook, and a valid schedule
+// if any. Since a job runs in the cluster's members with KubeDirector's
+// own access, whoever creates it or changes its spec (including asking for
+// another run) must be allowed to exec into pods in its namespace.
+func admitClusterJobCR(
+	ar *v1beta1.AdmissionReview,
+) *v1beta1.AdmissionResponse {
+
+	var valErrors []string
+	var admitResponse = v1beta1.AdmissionResponse{
+		Allowed: false,
+	}
+
+	// Set a defer func to handle any errors. Set the admission response to
+	// allowed=true if no errors.
+	defer func() {
+		if len(valErrors) == 0 {
+			admitResponse.Allowed = true
+		} else {
+			admitResponse.Result = &metav1.Status{
+				Message: "\n" + strings.Join(valErrors, "\n"),
+			}
+		}
+	}()
+
+	raw := ar.Request.Object.Raw
+	job := kdv1.KubeDirectorClusterJob{}
+	if jsonErr := json.Unmarshal(raw, &job); jsonErr != nil {
+		valErrors = append(valErrors, jsonErr.Error())
+		return &admitResponse
+	}
+	if ar.Request.Operation == v1beta1.Update {
+		prevJob := kdv1.KubeDirectorClusterJob{}
+		if jsonErr := json.Unmarshal(ar.Request.OldObject.Raw, &prevJob); jsonErr != nil {
+			valErrors = append(valErrors, jsonErr.Error())
+			return &admitResponse
+		}
+		// Nothing to check if only the metadata is changing.
+		if equality.Semantic.DeepEqual(job.Spec, prevJob.Spec) {
+			return &admitResponse
+		}
+	}
+
+	if (len(job.Spec.Command) == 0) == (job.Spec.Hook == "") {
+		valErrors = append(valErrors, clusterJobCommandOrHook)
+	}
+	if job.Spec.Schedule != "" {
+		if scheduleErr := kubedirectorclusterjob.ValidateSchedule(job.Spec.Schedule); scheduleErr != nil {
+			valErrors = append(valErrors, fmt.Sprintf(invalidJobSchedule, scheduleErr))
+		}
+	}
+	errStr := checkUserAccess(
+		ar.Request.UserInfo,
+		ar.Request.Namespace,
+		"",
+		"pods/exec",
+		"",
+		"create",
+	)
+	if errStr != "" {
+		valErrors = append(
+			valErrors,
+			fmt.Sprintf(
+				clusterJobNotPermitted,
+				ar.Request.UserInfo.Username,
+				ar.Request.Namespace,
+				errStr,
+			),
+		)
+	}
+
+	return &admitResponse
+}
@@ -18,16 +18,21 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/bluek8s/kubedirector/pkg/secretkeys"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/bluek8s/kubedirector/pkg/controller/kubedirectorconfig"
+	"github.com/bluek8s/kubedirector/pkg/lint"
 	"github.com/bluek8s/kubedirector/pkg/shared"
 
 	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
 	"github.com/bluek8s/kubedirector/pkg/observer"
 	"k8s.io/api/admission/v1beta1"
 	"k8s.io/apimachinery/pkg/api/equality"
+	corevalidation "k8s.io/apimachinery/pkg/api/validation"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8svalidation "k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/apimachinery/pkg/util/validation/field"
 )
 
@@ -103,6 +108,209 @@ func validateConfigStorageClass(
 	return valErrors
 }
 
+// validateConfigAppAntiAffinity checks that the app anti-affinity policy,
+// if any, names at least one app and uses a valid topology key.
+func validateConfigAppAntiAffinity(
+	policy *kdv1.AppAntiAffinity,
+	valErrors []string,
+) []string {
+
+	if policy == nil {
+		return valErrors
+	}
+	if len(policy.Apps) == 0 {
+		valErrors = append(valErrors, fmt.Sprintf(invalidAppAntiAffinity, "apps list is empty"))
+	}
+	if policy.Weight != nil && (*policy.Weight < 1 || *policy.Weight > 100) {
+		valErrors = append(valErrors, fmt.Sprintf(invalidAppAntiAffinity, "weight must be from 1 to 100"))
+	}
+	if policy.TopologyKey != nil {
+		for _, msg := range k8svalidation.IsQualifiedName(*policy.TopologyKey) {
+			valErrors = append(
+				valErrors,
+				fmt.Sprintf(invalidAppAntiAffinity, "topologyKey "+msg),
+			)
+		}
+	}
+	return valErrors
+}
+
+// validateConfigAutoTopologySpread checks that the automatic topology spread
+// policy, if any, lists at least one valid topology key.
+func validateConfigAutoTopologySpread(
+	policy *kdv1.AutoTopologySpread,
+	valErrors []string,
+) []string {
+
+	if policy == nil {
+		return valErrors
+	}
+	if len(policy.TopologyKeys) == 0 {
+		valErrors = append(valErrors, fmt.Sprintf(invalidAutoTopologySpread, "topologyKeys list is empty"))
+	}
+	for _, key := range policy.TopologyKeys {
+		for _, msg := range k8svalidation.IsQualifiedName(key) {
+			valErrors = append(
+				valErrors,
+				fmt.Sprintf(invalidAutoTopologySpread, "topologyKey "+key+" "+msg),
+			)
+		}
+	}
+	if policy.MaxSkew != nil && *policy.MaxSkew < 1 {
+		valErrors = append(valErrors, fmt.Sprintf(invalidAutoTopologySpread, "maxSkew must be greater than zero"))
+	}
+	return valErrors
+}
+
+// validateConfigEscalatedWarnings checks that every warning to be escalated
+// to an error is one that the validator knows about.
+func validateConfigEscalatedWarnings(
+	escalatedWarnings []string,
+	valErrors []string,
+) []string {
+
+	for _, id := range escalatedWarnings {
+		if !shared.StringInList(id, knownWarnings) {
+			valErrors = append(
+				valErrors,
+				fmt.Sprintf(
+					invalidEscalatedWarning,
+					id,
+					strings.Join(knownWarnings, ","),
+				),
+			)
+		}
+	}
+	return valErrors
+}
+
+// validateConfigLintSeverities checks that every code given a severity is
+// the code of a lint rule, and that the severity is a valid one.
+func validateConfigLintSeverities(
+	severities map[string]string,
+	valErrors []string,
+) []string {
+
+	var codes []string
+	for code := range lint.DefaultSeverities {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	for code, severity := range severities {
+		if _, ok := lint.DefaultSeverities[code]; !ok {
+			valErrors = append(
+				valErrors,
+				fmt.Sprintf(invalidLintCode, code, strings.Join(codes, ",")),
+			)
+			continue
+		}
+		if !shared.StringInList(severity, lint.Severities) {
+			valErrors = append(
+				valErrors,
+				fmt.Sprintf(
+					invalidLintSeverity,
+					severity,
+					code,
+					strings.Join(lint.Severities, ","),
+				),
+			)
+		}
+	}
+	return valErrors
+}
+
+// validateConfigIngress checks that the ingress host template, if
+// present, contains the placeholders needed to give each member endpoint a
+// distinct host name, and that the ingress annotations have good syntax.
+func validateConfigIngress(
+	ingress *kdv1.IngressConfig,
+	valErrors []string,
+) []string {
+
+	if ingress == nil {
+		return valErrors
+	}
+	for _, placeholder := range []string{"{member}", "{service}"} {
+		if !strings.Contains(ingress.HostTemplate, placeholder) {
+			valErrors = append(
+				valErrors,
+				fmt.Sprintf(invalidIngressHostTemplate, ingress.HostTemplate, placeholder),
+			)
+		}
+	}
+	annotationErrors := corevalidation.ValidateAnnotations(
+		ingress.Annotations,
+		field.NewPath("spec").Child("ingress").Child("annotations"),
+	)
+	for _, annotationErr := range annotationErrors {
+		valErrors = append(valErrors, annotationErr.Error())
+	}
+	return valErrors
+}
+
+// validateConfigDashboards checks that the dashboards config, if present,
+// forms a valid label for the generated configmaps.
+func validateConfigDashboards(
+	dashboards *kdv1.DashboardConfig,
+	valErrors []string,
+) []string {
+
+	if dashboards == nil {
+		return valErrors
+	}
+	label := shared.DefaultDashboardLabel
+	if dashboards.Label != nil {
+		label = *dashboards.Label
+	}
+	value := shared.DefaultDashboardLabelValue
+	if dashboards.LabelValue != nil {
+		value = *dashboards.LabelValue
+	}
+	problems := k8svalidation.IsQualifiedName(label)
+	problems = append(problems, k8svalidation.IsValidLabelValue(value)...)
+	if len(problems) != 0 {
+		valErrors = append(
+			valErrors,
+			fmt.Sprintf(invalidDashboardLabel, label, value, strings.Join(problems, "; ")),
+		)
+	}
+	return valErrors
+}
+
+// validateConfigMemberCerts checks the issuer kind and certificate duration
+// of the member certificates config, if present.
+func validateConfigMemberCerts(
+	memberCerts *kdv1.MemberCertsConfig,
+	valErrors []string,
+) []string {
+
+	if memberCerts == nil {
+		return valErrors
+	}
+	if memberCerts.IssuerKind != nil {
+		kind := *memberCerts.IssuerKind
+		if (kind != kdv1.CertIssuer) && (kind != kdv1.CertClusterIssuer) {
+			valErrors = append(
+				valErrors,
+				fmt.Sprintf(
+					invalidCertIssuerKind,
+					kind,
+					strings.Join([]string{kdv1.CertIssuer, kdv1.CertClusterIssuer}, ","),
+				),
+			)
+		}
+	}
+	if memberCerts.Duration != nil {
+		if _, err := time.ParseDuration(*memberCerts.Duration); err != nil {
+			valErrors = append(
+				valErrors,
+				fmt.Sprintf(invalidCertDuration, *memberCerts.Duration, err),
+			)
+		}
+	}
+	return valErrors
+}
+
 // validateOrPopulateMasterEncryptionKey checks key length to be supported by AES (16,24,32)
 // or generates default 32 bytes encryption key for AES-256. Also, if there's
 // an existing non-nil value, we currently don't allow changing the value while
@@ -248,6 +456,49 @@ func admitKDConfigCR(
 	// Validate storage class name if present.
 	valErrors = validateConfigStorageClass(configCR.Spec.StorageClass, valErrors)
 
+	// Validate the app anti-affinity policy if present.
+	valErrors = validateConfigAppAntiAffinity(configCR.Spec.AppAntiAffinity, valErrors)
+
+	// Validate the automatic topology spread policy if present.
+	valErrors = validateConfigAutoTopologySpread(configCR.Spec.AutoTopologySpread, valErrors)
+
+	// Validate the default scheduling settings for roles if present.
+	valErrors = validateConfigSchedulingDefaults(configCR.Spec.SchedulingDefaults, valErrors)
+
+	// Validate the default pod security context for roles if present.
+	valErrors = validateConfigPodSecurityContext(configCR.Spec.PodSecurityContext, valErrors)
+
+	// Validate the list of warnings to escalate to errors.
+	valErrors = validateConfigEscalatedWarnings(configCR.Spec.EscalatedWarnings, valErrors)
+
+	// Validate the severities given to lint codes.
+	valErrors = validateConfigLintSeverities(configCR.Spec.LintSeverities, valErrors)
+
+	// Validate the ingress generation settings if present.
+	valErrors = validateConfigIngress(configCR.Spec.Ingress, valErrors)
+	valErrors = validateConfigMemberCerts(configCR.Spec.MemberCertificates, valErrors)
+
+	// Validate the dashboard generation settings if present.
+	valErrors = validateConfigDashboards(configCR.Spec.Dashboards, valErrors)
+
+	// Validate the retention period for the volume claims of deleted members.
+	if (configCR.Spec.DeletedPVCRetentionSeconds != nil) &&
+		(*configCR.Spec.DeletedPVCRetentionSeconds < 0) {
+		valErrors = append(
+			valErrors,
+			fmt.Sprintf(invalidPVCRetention, *configCR.Spec.DeletedPVCRetentionSeconds),
+		)
+	}
+
+	// Validate the member count above which member statuses are moved out.
+	if (configCR.Spec.MemberStatusDetailLimit != nil) &&
+		(*configCR.Spec.MemberStatusDetailLimit < 0) {
+		valErrors = append(
+			valErrors,
+			fmt.Sprintf(invalidMemberStatusDetailLimit, *configCR.Spec.MemberStatusDetailLimit),
+		)
+	}
+
 	// Populate default service type if necessary.
 	if configCR.Spec.ServiceType == nil {
 		patches = append(patches,
@@ -321,6 +572,36 @@ func admitKDConfigCR(
 		)
 	}
 
+	// Populate halt-expansion-on-image-pull-error flag if necessary.
+	if configCR.Spec.HaltExpansionOnImagePullError == nil {
+		patches = append(patches,
+			newBoolPatch(
+				"/spec/haltExpansionOnImagePullError",
+				defaultHaltExpansionOnImagePullError,
+			),
+		)
+	}
+
+	// Populate reject-conflicting-changes flag if necessary.
+	if configCR.Spec.RejectConflictingChanges == nil {
+		patches = append(patches,
+			newBoolPatch(
+				"/spec/rejectConflictingChanges",
+				defaultRejectConflictingChanges,
+			),
+		)
+	}
+
+	// Populate require-shrink-acknowledgement flag if necessary.
+	if configCR.Spec.RequireShrinkAcknowledgement == nil {
+		patches = append(patches,
+			newBoolPatch(
+				"/spec/requireShrinkAcknowledgement",
+				defaultRequireShrinkAcknowledgement,
+			),
+		)
+	}
+
 	if len(valErrors) == 0 {
 		if len(patches) != 0 {
 			patchResult, patchErr := json.Marshal(patches)
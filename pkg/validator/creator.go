@@ -0,0 +1,135 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validator
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	"github.com/bluek8s/kubedirector/pkg/shared"
+	v1auth "k8s.io/api/authentication/v1"
+)
+
+// recordCreator generates patches to record the identity of the user
+// creating a kdcluster in its creator annotation, and the username in its
+// creator label, replacing any values given in the request. The in-memory
+// cluster CR is updated to match, so that later metadata patches are
+// generated against the right state.
+func recordCreator(
+	cr *kdv1.KubeDirectorCluster,
+	userInfo v1auth.UserInfo,
+	valErrors []string,
+	patches []clusterPatchSpec,
+) ([]string, []clusterPatchSpec) {
+
+	creator, jsonErr := json.Marshal(userInfo)
+	if jsonErr != nil {
+		valErrors = append(valErrors, jsonErr.Error())
+		return valErrors, patches
+	}
+	if cr.Annotations == nil {
+		cr.Annotations = map[string]string{}
+	}
+	if cr.Labels == nil {
+		cr.Labels = map[string]string{}
+	}
+	patches = addMetadataPatch(
+		cr.Annotations,
+		"annotations",
+		shared.CreatorAnnotation,
+		string(creator),
+		patches,
+	)
+	patches = addMetadataPatch(
+		cr.Labels,
+		"labels",
+		shared.CreatorLabel,
+		shared.CreatorLabelValue(userInfo.Username),
+		patches,
+	)
+	return valErrors, patches
+}
+
+// addMetadataPatch generates a patch that sets the given key of the given
+// metadata field (annotations or labels), whose current content is in
+// existing, adding the whole field if it is empty. The value is also set in
+// existing.
+func addMetadataPatch(
+	existing map[string]string,
+	field string,
+	key string,
+	value string,
+	patches []clusterPatchSpec,
+) []clusterPatchSpec {
+
+	if len(existing) == 0 {
+		dict := dictValue{key: value}
+		patches = append(
+			patches,
+			clusterPatchSpec{
+				Op:   "add",
+				Path: "/metadata/" + field,
+				Value: clusterPatchValue{
+					ValueDict: &dict,
+				},
+			},
+		)
+	} else {
+		patches = append(
+			patches,
+			clusterPatchSpec{
+				Op: "add",
+				Path: fmt.Sprintf("/metadata/%s/%s",
+					field,
+					strings.ReplaceAll(key, "/", "~1")),
+				Value: clusterPatchValue{
+					ValueStr: &value,
+				},
+			},
+		)
+	}
+	existing[key] = value
+	return patches
+}
+
+// validateCreatorUnchanged checks that an update does not add, change, or
+// remove the creator annotation or label. Any generated error messages will be added
+// to the input list and returned.
+func validateCreatorUnchanged(
+	cr *kdv1.KubeDirectorCluster,
+	prevCr *kdv1.KubeDirectorCluster,
+	valErrors []string,
+) []string {
+
+	value, ok := cr.Annotations[shared.CreatorAnnotation]
+	prevValue, prevOk := prevCr.Annotations[shared.CreatorAnnotation]
+	if (ok != prevOk) || (value != prevValue) {
+		valErrors = append(
+			valErrors,
+			fmt.Sprintf(creatorAnnotationReadOnly, shared.CreatorAnnotation),
+		)
+	}
+	value, ok = cr.Labels[shared.CreatorLabel]
+	prevValue, prevOk = prevCr.Labels[shared.CreatorLabel]
+	if (ok != prevOk) || (value != prevValue) {
+		valErrors = append(
+			valErrors,
+			fmt.Sprintf(creatorLabelReadOnly, shared.CreatorLabel),
+		)
+	}
+	return valErrors
+}
@@ -0,0 +1,112 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validator
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	"github.com/bluek8s/kubedirector/pkg/shared"
+	v1auth "k8s.io/api/authentication/v1"
+)
+
+// validateDebugMode checks the debug mode request annotations. When the
+// debug TTL annotation is added or changed, the requesting user must be
+// allowed the "debug" verb on this kdcluster, and the TTL must be a valid
+// duration within limits; if so, patches are generated to record the expiry
+// time and the requesting user. Otherwise the expiry and user annotations
+// may only be removed, not set or changed. Any generated error messages
+// will be added to the input list and returned.
+func validateDebugMode(
+	cr *kdv1.KubeDirectorCluster,
+	prevCr *kdv1.KubeDirectorCluster,
+	userInfo v1auth.UserInfo,
+	valErrors []string,
+	patches []clusterPatchSpec,
+) ([]string, []clusterPatchSpec) {
+
+	ttlStr, hasTTL := cr.Annotations[shared.DebugTTLAnnotation]
+	prevTTLStr, hadTTL := prevCr.Annotations[shared.DebugTTLAnnotation]
+	if !hasTTL || (hadTTL && (ttlStr == prevTTLStr)) {
+		for _, key := range []string{
+			shared.DebugExpiresAnnotation,
+			shared.DebugUserAnnotation,
+		} {
+			value, ok := cr.Annotations[key]
+			if ok && (value != prevCr.Annotations[key]) {
+				valErrors = append(
+					valErrors,
+					fmt.Sprintf(debugAnnotationReadOnly, key),
+				)
+			}
+		}
+		return valErrors, patches
+	}
+
+	ttl, parseErr := time.ParseDuration(ttlStr)
+	if (parseErr != nil) || (ttl <= 0) || (ttl > maxDebugTTL) {
+		valErrors = append(
+			valErrors,
+			fmt.Sprintf(
+				invalidDebugTTL,
+				shared.DebugTTLAnnotation,
+				ttlStr,
+				maxDebugTTL,
+			),
+		)
+		return valErrors, patches
+	}
+
+	errStr := checkUserAccess(
+		userInfo,
+		cr.Namespace,
+		shared.KdDomainBase,
+		"kubedirectorclusters",
+		cr.Name,
+		debugVerb,
+	)
+	if errStr != "" {
+		valErrors = append(
+			valErrors,
+			fmt.Sprintf(debugNotPermitted, userInfo.Username, errStr),
+		)
+		return valErrors, patches
+	}
+
+	expires := time.Now().Add(ttl).UTC().Format(time.RFC3339)
+	user := userInfo.Username
+	patches = append(
+		patches,
+		clusterPatchSpec{
+			Op: "add",
+			Path: fmt.Sprintf("/metadata/annotations/%s",
+				strings.ReplaceAll(shared.DebugExpiresAnnotation, "/", "~1")),
+			Value: clusterPatchValue{
+				ValueStr: &expires,
+			},
+		},
+		clusterPatchSpec{
+			Op: "add",
+			Path: fmt.Sprintf("/metadata/annotations/%s",
+				strings.ReplaceAll(shared.DebugUserAnnotation, "/", "~1")),
+			Value: clusterPatchValue{
+				ValueStr: &user,
+			},
+		},
+	)
+	return valErrors, patches
+}
@@ -0,0 +1,229 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validator
+
+import (
+	"fmt"
+	"strings"
+
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	"github.com/bluek8s/kubedirector/pkg/observer"
+	"github.com/bluek8s/kubedirector/pkg/shared"
+	v1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8svalidation "k8s.io/apimachinery/pkg/util/validation"
+)
+
+// validateRequiredEnvSupplied checks that every env var required by the app
+// is supplied to each role of the cluster that it applies to, either in the
+// role's env or envFrom or (for a secret-backed requirement) through the key
+// of the cluster's envSecret. The requesting user must be allowed to read the
+// envSecret. Any generated error messages will be added to the input list
+// and returned.
+func validateRequiredEnvSupplied(
+	cr *kdv1.KubeDirectorCluster,
+	appCR *kdv1.KubeDirectorApp,
+	userInfo v1.UserInfo,
+	valErrors []string,
+) []string {
+
+	var envSecret *corev1.Secret
+	if cr.Spec.EnvSecret != nil {
+		errStr := checkUserAccess(
+			userInfo,
+			cr.Namespace,
+			"",
+			"secrets",
+			*cr.Spec.EnvSecret,
+			"get",
+		)
+		if errStr != "" {
+			return append(valErrors, errStr)
+		}
+		secret, fetchErr := observer.GetSecret(cr.Namespace, *cr.Spec.EnvSecret)
+		if fetchErr != nil {
+			return append(
+				valErrors,
+				fmt.Sprintf(invalidEnvSecret, *cr.Spec.EnvSecret, cr.Namespace),
+			)
+		}
+		envSecret = secret
+	}
+
+	for _, requiredEnv := range appCR.Spec.RequiredEnv {
+		description := ""
+		if requiredEnv.Description != "" {
+			description = " (" + requiredEnv.Description + ")"
+		}
+		for i := range cr.Spec.Roles {
+			role := &(cr.Spec.Roles[i])
+			if (len(requiredEnv.Roles) != 0) && !shared.StringInList(role.Name, requiredEnv.Roles) {
+				continue
+			}
+			if roleHasEnvVar(cr, role, requiredEnv.Name) {
+				continue
+			}
+			if requiredEnv.SecretKey == "" {
+				valErrors = append(
+					valErrors,
+					fmt.Sprintf(
+						missingRequiredEnv,
+						role.Name,
+						requiredEnv.Name,
+						description,
+					),
+				)
+				continue
+			}
+			if envSecret != nil {
+				if _, ok := envSecret.Data[requiredEnv.SecretKey]; ok {
+					continue
+				}
+			}
+			valErrors = append(
+				valErrors,
+				fmt.Sprintf(
+					missingRequiredSecretEnv,
+					role.Name,
+					requiredEnv.Name,
+					description,
+					requiredEnv.SecretKey,
+				),
+			)
+		}
+	}
+	return valErrors
+}
+
+// validateEnvFrom checks the envFrom list of each role. Each entry must
+// name exactly one secret or configmap, which must exist in the cluster's
+// namespace unless the entry is marked optional, and any prefix must be
+// usable at the start of an env var name. Since the keys of a secret end up
+// in the member containers, the requesting user must be allowed to read
+// it. Any generated error messages will be added to the input list and
+// returned.
+func validateEnvFrom(
+	cr *kdv1.KubeDirectorCluster,
+	userInfo v1.UserInfo,
+	valErrors []string,
+) []string {
+
+	for _, role := range cr.Spec.Roles {
+		for _, source := range role.EnvFrom {
+			if (source.SecretRef == nil) == (source.ConfigMapRef == nil) {
+				valErrors = append(valErrors, fmt.Sprintf(invalidEnvFromSource, role.Name))
+				continue
+			}
+			if source.Prefix != "" {
+				if problems := k8svalidation.IsEnvVarName(source.Prefix); len(problems) != 0 {
+					valErrors = append(
+						valErrors,
+						fmt.Sprintf(
+							invalidEnvFromPrefix,
+							source.Prefix,
+							role.Name,
+							strings.Join(problems, "; "),
+						),
+					)
+				}
+			}
+			if source.SecretRef != nil {
+				errStr := checkUserAccess(
+					userInfo,
+					cr.Namespace,
+					"",
+					"secrets",
+					source.SecretRef.Name,
+					"get",
+				)
+				if errStr != "" {
+					valErrors = append(valErrors, errStr)
+					continue
+				}
+				optional := (source.SecretRef.Optional != nil) && *source.SecretRef.Optional
+				_, fetchErr := observer.GetSecret(cr.Namespace, source.SecretRef.Name)
+				if (fetchErr != nil) && !optional {
+					valErrors = append(
+						valErrors,
+						fmt.Sprintf(
+							invalidEnvFromRef,
+							"secret",
+							source.SecretRef.Name,
+							role.Name,
+							cr.Namespace,
+						),
+					)
+				}
+				continue
+			}
+			optional := (source.ConfigMapRef.Optional != nil) && *source.ConfigMapRef.Optional
+			_, fetchErr := observer.GetConfigMap(cr.Namespace, source.ConfigMapRef.Name)
+			if (fetchErr != nil) && !optional {
+				valErrors = append(
+					valErrors,
+					fmt.Sprintf(
+						invalidEnvFromRef,
+						"configmap",
+						source.ConfigMapRef.Name,
+						role.Name,
+						cr.Namespace,
+					),
+				)
+			}
+		}
+	}
+	return valErrors
+}
+
+// roleHasEnvVar reports whether the role's env includes the named variable,
+// or whether one of the secrets or configmaps in the role's envFrom has a
+// key that (with the entry's prefix) gives that name.
+func roleHasEnvVar(
+	cr *kdv1.KubeDirectorCluster,
+	role *kdv1.Role,
+	name string,
+) bool {
+
+	for _, envVar := range role.EnvVars {
+		if envVar.Name == name {
+			return true
+		}
+	}
+	for _, source := range role.EnvFrom {
+		if !strings.HasPrefix(name, source.Prefix) {
+			continue
+		}
+		key := strings.TrimPrefix(name, source.Prefix)
+		switch {
+		case source.SecretRef != nil:
+			secret, fetchErr := observer.GetSecret(cr.Namespace, source.SecretRef.Name)
+			if fetchErr != nil {
+				continue
+			}
+			if _, ok := secret.Data[key]; ok {
+				return true
+			}
+		case source.ConfigMapRef != nil:
+			configMap, fetchErr := observer.GetConfigMap(cr.Namespace, source.ConfigMapRef.Name)
+			if fetchErr != nil {
+				continue
+			}
+			if _, ok := configMap.Data[key]; ok {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,177 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validator
+
+import (
+	"testing"
+
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	v1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestValidateRequiredEnv(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		required []kdv1.RequiredEnvVar
+		want     []string
+	}{
+		{
+			"valid",
+			[]kdv1.RequiredEnvVar{
+				{Name: "DB_HOST", Roles: []string{"worker"}},
+				{Name: "DB_PASSWORD", SecretKey: "db.password"},
+			},
+			nil,
+		},
+		{
+			"bad name",
+			[]kdv1.RequiredEnvVar{{Name: "1DB=HOST"}},
+			[]string{"Required env var name(1DB=HOST) is invalid: "},
+		},
+		{
+			"duplicate name",
+			[]kdv1.RequiredEnvVar{{Name: "DB_HOST"}, {Name: "DB_HOST"}},
+			[]string{"Required env var(DB_HOST) is declared more than once."},
+		},
+		{
+			"unknown role",
+			[]kdv1.RequiredEnvVar{{Name: "DB_HOST", Roles: []string{"gateway"}}},
+			[]string{"Required env var(DB_HOST) lists role(gateway), which is not a role of this app."},
+		},
+		{
+			"bad secret key",
+			[]kdv1.RequiredEnvVar{{Name: "DB_PASSWORD", SecretKey: "db/password"}},
+			[]string{"Required env var(DB_PASSWORD) has an invalid secretKey(db/password): "},
+		},
+	}
+	for _, test := range tests {
+		appCR := &kdv1.KubeDirectorApp{}
+		appCR.Spec.RequiredEnv = test.required
+		got := validateRequiredEnv(appCR, []string{"controller", "worker"}, nil)
+		checkProblems(t, test.name, got, test.want)
+	}
+}
+
+func TestValidateRequiredEnvSupplied(t *testing.T) {
+
+	required := []kdv1.RequiredEnvVar{
+		{Name: "DB_HOST", Description: "database host", Roles: []string{"worker"}},
+		{Name: "DB_PASSWORD", SecretKey: "db.password"},
+	}
+	tests := []struct {
+		name   string
+		worker []corev1.EnvVar
+		other  []corev1.EnvVar
+		want   []string
+	}{
+		{
+			"all supplied",
+			[]corev1.EnvVar{{Name: "DB_HOST"}, {Name: "DB_PASSWORD"}},
+			[]corev1.EnvVar{{Name: "DB_PASSWORD"}},
+			nil,
+		},
+		{
+			"role-specific var missing",
+			[]corev1.EnvVar{{Name: "DB_PASSWORD"}},
+			[]corev1.EnvVar{{Name: "DB_PASSWORD"}},
+			[]string{"Role(worker) must set env var(DB_HOST) (database host), which the app requires."},
+		},
+		{
+			"secret-backed var missing without envSecret",
+			[]corev1.EnvVar{{Name: "DB_HOST"}},
+			nil,
+			[]string{
+				"Role(worker) must set env var(DB_PASSWORD), which the app requires, or envSecret must name a secret with key(db.password).",
+				"Role(other) must set env var(DB_PASSWORD), which the app requires, or envSecret must name a secret with key(db.password).",
+			},
+		},
+	}
+	for _, test := range tests {
+		appCR := &kdv1.KubeDirectorApp{}
+		appCR.Spec.RequiredEnv = required
+		cr := &kdv1.KubeDirectorCluster{}
+		cr.Spec.Roles = []kdv1.Role{
+			{Name: "worker", EnvVars: test.worker},
+			{Name: "other", EnvVars: test.other},
+		}
+		got := validateRequiredEnvSupplied(cr, appCR, v1.UserInfo{}, nil)
+		checkProblems(t, test.name, got, test.want)
+	}
+}
+
+func TestValidateEnvFromSources(t *testing.T) {
+
+	secretRef := &corev1.SecretEnvSource{
+		LocalObjectReference: corev1.LocalObjectReference{Name: "s1"},
+	}
+	configMapRef := &corev1.ConfigMapEnvSource{
+		LocalObjectReference: corev1.LocalObjectReference{Name: "c1"},
+	}
+	tests := []struct {
+		name    string
+		envFrom []corev1.EnvFromSource
+		want    []string
+	}{
+		{"none", nil, nil},
+		{
+			"no source",
+			[]corev1.EnvFromSource{{Prefix: "DB_"}},
+			[]string{"Each envFrom entry of role(worker) must have exactly one of secretRef or configMapRef."},
+		},
+		{
+			"both sources",
+			[]corev1.EnvFromSource{{SecretRef: secretRef, ConfigMapRef: configMapRef}},
+			[]string{"Each envFrom entry of role(worker) must have exactly one of secretRef or configMapRef."},
+		},
+	}
+	for _, test := range tests {
+		cr := &kdv1.KubeDirectorCluster{}
+		cr.Spec.Roles = []kdv1.Role{{Name: "worker", EnvFrom: test.envFrom}}
+		got := validateEnvFrom(cr, v1.UserInfo{}, nil)
+		checkProblems(t, test.name, got, test.want)
+	}
+}
+
+func TestRoleHasEnvVar(t *testing.T) {
+
+	role := &kdv1.Role{
+		Name:    "worker",
+		EnvVars: []corev1.EnvVar{{Name: "DB_HOST"}},
+		EnvFrom: []corev1.EnvFromSource{
+			{
+				Prefix: "CACHE_",
+				ConfigMapRef: &corev1.ConfigMapEnvSource{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "c1"},
+				},
+			},
+		},
+	}
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"DB_HOST", true},
+		{"DB_PORT", false},
+		// Not looked up in the configmap, since the prefix does not match.
+		{"QUEUE_HOST", false},
+	}
+	for _, test := range tests {
+		if got := roleHasEnvVar(&kdv1.KubeDirectorCluster{}, role, test.name); got != test.want {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,310 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validator
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	"github.com/bluek8s/kubedirector/pkg/observer"
+	"github.com/bluek8s/kubedirector/pkg/shared"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/yaml"
+)
+
+// namedFragment is a parsed spec fragment along with the namespace/name of
+// the configmap it came from.
+type namedFragment struct {
+	source   string
+	fragment specFragment
+}
+
+// applySpecFragments merges spec fragments into the roles of a cluster that
+// is being created. The global fragments listed in the KubeDirectorConfig
+// come first, followed by those listed in the cluster spec. Settings from
+// "default" fragments are used only where the cluster spec does not provide
+// its own value for the same key (or env var name); among fragments, later
+// ones take precedence over earlier ones. Settings from "override" fragments
+// take precedence over the cluster spec. The merged result is placed back
+// into the given CR, so that later validation sees it, and also returned as
+// patches. A missing global fragment is ignored, but a missing fragment
+// named by the cluster spec is an error.
+func applySpecFragments(
+	cr *kdv1.KubeDirectorCluster,
+	valErrors []string,
+	patches []clusterPatchSpec,
+) ([]string, []clusterPatchSpec) {
+
+	var fragments []namedFragment
+	kdNamespace, nsErr := shared.GetKubeDirectorNamespace()
+	if nsErr == nil {
+		for _, cmName := range shared.GetClusterSpecFragments() {
+			fragment, errStr := readSpecFragment(kdNamespace, cmName)
+			if errStr != "" {
+				valErrors = append(valErrors, errStr)
+				continue
+			}
+			if fragment != nil {
+				fragments = append(fragments, *fragment)
+			}
+		}
+	}
+	for _, cmName := range cr.Spec.SpecFragments {
+		fragment, errStr := readSpecFragment(cr.Namespace, cmName)
+		if errStr != "" {
+			valErrors = append(valErrors, errStr)
+			continue
+		}
+		if fragment == nil {
+			valErrors = append(
+				valErrors,
+				fmt.Sprintf(missingSpecFragment, cmName, cr.Namespace),
+			)
+			continue
+		}
+		fragments = append(fragments, *fragment)
+	}
+	if len(fragments) == 0 {
+		return valErrors, patches
+	}
+
+	var applied []string
+	numRoles := len(cr.Spec.Roles)
+	for i := 0; i < numRoles; i++ {
+		role := &(cr.Spec.Roles[i])
+		var defaults []specFragment
+		var overrides []specFragment
+		for _, f := range fragments {
+			if (len(f.fragment.Roles) != 0) &&
+				!shared.StringInList(role.Name, f.fragment.Roles) {
+				continue
+			}
+			if !shared.StringInList(f.source, applied) {
+				applied = append(applied, f.source)
+			}
+			if f.fragment.Policy == specFragmentPolicyOverride {
+				overrides = append(overrides, f.fragment)
+			} else {
+				defaults = append(defaults, f.fragment)
+			}
+		}
+		merged := specFragment{}
+		for _, f := range defaults {
+			mergeSpecFragment(&merged, f)
+		}
+		mergeSpecFragment(
+			&merged,
+			specFragment{
+				PodLabels:                role.PodLabels,
+				PodAnnotations:           role.PodAnnotations,
+				ServiceLabels:            role.ServiceLabels,
+				ServiceAnnotations:       role.ServiceAnnotations,
+				MemberServiceAnnotations: role.MemberServiceAnnotations,
+				EnvVars:                  role.EnvVars,
+				Tolerations:              role.Tolerations,
+				NodeSelector:             role.NodeSelector,
+			},
+		)
+		for _, f := range overrides {
+			mergeSpecFragment(&merged, f)
+		}
+
+		rolePath := fmt.Sprintf("/spec/roles/%d", i)
+		patchDict := func(
+			property string,
+			current *map[string]string,
+			result map[string]string,
+		) {
+			if (len(result) == 0) || reflect.DeepEqual(*current, result) {
+				return
+			}
+			*current = result
+			value := dictValue(result)
+			patches = append(
+				patches,
+				clusterPatchSpec{
+					Op:   "add",
+					Path: rolePath + "/" + property,
+					Value: clusterPatchValue{
+						ValueDict: &value,
+					},
+				},
+			)
+		}
+		patchDict("podLabels", &role.PodLabels, merged.PodLabels)
+		patchDict("podAnnotations", &role.PodAnnotations, merged.PodAnnotations)
+		patchDict("serviceLabels", &role.ServiceLabels, merged.ServiceLabels)
+		patchDict("serviceAnnotations", &role.ServiceAnnotations, merged.ServiceAnnotations)
+		patchDict("memberServiceAnnotations", &role.MemberServiceAnnotations, merged.MemberServiceAnnotations)
+		patchDict("nodeSelector", &role.NodeSelector, merged.NodeSelector)
+		if (len(merged.EnvVars) != 0) && !reflect.DeepEqual(role.EnvVars, merged.EnvVars) {
+			role.EnvVars = merged.EnvVars
+			envVars := merged.EnvVars
+			patches = append(
+				patches,
+				clusterPatchSpec{
+					Op:   "add",
+					Path: rolePath + "/env",
+					Value: clusterPatchValue{
+						ValueEnvVars: &envVars,
+					},
+				},
+			)
+		}
+		if (len(merged.Tolerations) != 0) && !reflect.DeepEqual(role.Tolerations, merged.Tolerations) {
+			role.Tolerations = merged.Tolerations
+			tolerations := merged.Tolerations
+			patches = append(
+				patches,
+				clusterPatchSpec{
+					Op:   "add",
+					Path: rolePath + "/tolerations",
+					Value: clusterPatchValue{
+						ValueTolerations: &tolerations,
+					},
+				},
+			)
+		}
+	}
+
+	if len(applied) != 0 {
+		appliedStr := strings.Join(applied, ",")
+		if len(cr.Annotations) == 0 {
+			annotations := dictValue{appliedFragmentsAnnotation: appliedStr}
+			patches = append(
+				patches,
+				clusterPatchSpec{
+					Op:   "add",
+					Path: "/metadata/annotations",
+					Value: clusterPatchValue{
+						ValueDict: &annotations,
+					},
+				},
+			)
+		} else {
+			patches = append(
+				patches,
+				clusterPatchSpec{
+					Op: "add",
+					Path: fmt.Sprintf("/metadata/annotations/%s",
+						strings.ReplaceAll(appliedFragmentsAnnotation, "/", "~1")),
+					Value: clusterPatchValue{
+						ValueStr: &appliedStr,
+					},
+				},
+			)
+		}
+	}
+	return valErrors, patches
+}
+
+// readSpecFragment fetches and parses the spec fragment in the given
+// configmap. Returns nil (and no error string) if the configmap does not
+// exist.
+func readSpecFragment(
+	namespace string,
+	cmName string,
+) (*namedFragment, string) {
+
+	cm, cmErr := observer.GetConfigMap(namespace, cmName)
+	if cmErr != nil {
+		if errors.IsNotFound(cmErr) {
+			return nil, ""
+		}
+		return nil, fmt.Sprintf(invalidSpecFragment, cmName, namespace, cmErr.Error())
+	}
+	content, ok := cm.Data[specFragmentKey]
+	if !ok {
+		return nil, fmt.Sprintf(
+			invalidSpecFragment,
+			cmName,
+			namespace,
+			"no \""+specFragmentKey+"\" key in data",
+		)
+	}
+	fragment := specFragment{}
+	if parseErr := yaml.UnmarshalStrict([]byte(content), &fragment); parseErr != nil {
+		return nil, fmt.Sprintf(invalidSpecFragment, cmName, namespace, parseErr.Error())
+	}
+	switch fragment.Policy {
+	case "", specFragmentPolicyDefault, specFragmentPolicyOverride:
+	default:
+		return nil, fmt.Sprintf(
+			invalidSpecFragment,
+			cmName,
+			namespace,
+			"policy must be \""+specFragmentPolicyDefault+"\" or \""+specFragmentPolicyOverride+"\"",
+		)
+	}
+	return &namedFragment{source: namespace + "/" + cmName, fragment: fragment}, ""
+}
+
+// mergeSpecFragment overlays the settings of src onto dst. Map entries, env
+// vars (matched by name), and tolerations (matched by key and effect) in src
+// replace those in dst.
+func mergeSpecFragment(
+	dst *specFragment,
+	src specFragment,
+) {
+
+	mergeDict := func(dstMap *map[string]string, srcMap map[string]string) {
+		if len(srcMap) == 0 {
+			return
+		}
+		if *dstMap == nil {
+			*dstMap = make(map[string]string)
+		}
+		for k, v := range srcMap {
+			(*dstMap)[k] = v
+		}
+	}
+	mergeDict(&dst.PodLabels, src.PodLabels)
+	mergeDict(&dst.PodAnnotations, src.PodAnnotations)
+	mergeDict(&dst.ServiceLabels, src.ServiceLabels)
+	mergeDict(&dst.ServiceAnnotations, src.ServiceAnnotations)
+	mergeDict(&dst.MemberServiceAnnotations, src.MemberServiceAnnotations)
+	mergeDict(&dst.NodeSelector, src.NodeSelector)
+
+	for _, srcVar := range src.EnvVars {
+		replaced := false
+		for i := range dst.EnvVars {
+			if dst.EnvVars[i].Name == srcVar.Name {
+				dst.EnvVars[i] = srcVar
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			dst.EnvVars = append(dst.EnvVars, srcVar)
+		}
+	}
+
+	for _, srcToleration := range src.Tolerations {
+		replaced := false
+		for i := range dst.Tolerations {
+			if (dst.Tolerations[i].Key == srcToleration.Key) &&
+				(dst.Tolerations[i].Effect == srcToleration.Effect) {
+				dst.Tolerations[i] = srcToleration
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			dst.Tolerations = append(dst.Tolerations, srcToleration)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validator
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	"github.com/bluek8s/kubedirector/pkg/observer"
+	"github.com/bluek8s/kubedirector/pkg/shared"
+	"k8s.io/api/admission/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// namespaceConfigSpec returns the spec of the KubeDirectorNamespaceConfig
+// for the given namespace, or nil if there is none.
+func namespaceConfigSpec(
+	namespace string,
+) *kdv1.KubeDirectorNamespaceConfigSpec {
+
+	nsConfig, err := observer.GetNamespaceConfig(namespace)
+	if err != nil {
+		return nil
+	}
+	return nsConfig.Spec
+}
+
+// defaultStorageClass returns the default storage class for clusters in the
+// given namespace: that of the namespace config if set, otherwise that of
+// the KubeDirectorConfig (which may be empty).
+func defaultStorageClass(
+	namespace string,
+) string {
+
+	nsSpec := namespaceConfigSpec(namespace)
+	if (nsSpec != nil) && (nsSpec.StorageClass != nil) {
+		return *nsSpec.StorageClass
+	}
+	return shared.GetDefaultStorageClass()
+}
+
+// defaultServiceType returns the default service type for clusters in the
+// given namespace: that of the namespace config if set, otherwise that of
+// the KubeDirectorConfig.
+func defaultServiceType(
+	namespace string,
+) string {
+
+	nsSpec := namespaceConfigSpec(namespace)
+	if (nsSpec != nil) && (nsSpec.ServiceType != nil) {
+		return *nsSpec.ServiceType
+	}
+	return shared.GetDefaultServiceType()
+}
+
+// validateNamespaceAllowedApp checks that the cluster's app is one of those
+// allowed by its namespace config, if that config limits the apps.
+func validateNamespaceAllowedApp(
+	cr *kdv1.KubeDirectorCluster,
+	valErrors []string,
+) []string {
+
+	nsSpec := namespaceConfigSpec(cr.Namespace)
+	if (nsSpec == nil) || (len(nsSpec.AllowedApps) == 0) {
+		return valErrors
+	}
+	if shared.StringInList(cr.Spec.AppID, nsSpec.AllowedApps) {
+		return valErrors
+	}
+	return append(
+		valErrors,
+		fmt.Sprintf(
+			appNotAllowedInNamespace,
+			cr.Spec.AppID,
+			cr.Namespace,
+			strings.Join(nsSpec.AllowedApps, "\",\""),
+		),
+	)
+}
+
+// validateNamespaceResourceCeilings checks the resource requests and limits
+// of every role against the per-member maximums of the namespace config,
+// if any.
+func validateNamespaceResourceCeilings(
+	cr *kdv1.KubeDirectorCluster,
+	valErrors []string,
+) []string {
+
+	nsSpec := namespaceConfigSpec(cr.Namespace)
+	if (nsSpec == nil) || (len(nsSpec.MaxMemberResources) == 0) {
+		return valErrors
+	}
+	var resourceNames []string
+	for resourceName := range nsSpec.MaxMemberResources {
+		resourceNames = append(resourceNames, string(resourceName))
+	}
+	sort.Strings(resourceNames)
+	for _, role := range cr.Spec.Roles {
+		for _, resourceName := range resourceNames {
+			ceiling := nsSpec.MaxMemberResources[corev1.ResourceName(resourceName)]
+			amounts := []struct {
+				kind string
+				list corev1.ResourceList
+			}{
+				{"request", role.Resources.Requests},
+				{"limit", role.Resources.Limits},
+			}
+			for _, amount := range amounts {
+				quantity, ok := amount.list[corev1.ResourceName(resourceName)]
+				if !ok || (quantity.Cmp(ceiling) <= 0) {
+					continue
+				}
+				valErrors = append(
+					valErrors,
+					fmt.Sprintf(
+						memberResourceCeiling,
+						amount.kind,
+						resourceName,
+						quantity.String(),
+						role.Name,
+						ceiling.String(),
+						cr.Namespace,
+					),
+				)
+			}
+		}
+	}
+	return valErrors
+}
+
+// admitNamespaceConfigCR is the top-level namespace config validation
+// function. The name of the object is already restricted by the CRD schema.
+func admitNamespaceConfigCR(
+	ar *v1beta1.AdmissionReview,
+) *v1beta1.AdmissionResponse {
+
+	var valErrors []string
+	var admitResponse = v1beta1.AdmissionResponse{
+		Allowed: false,
+	}
+
+	// Set a defer func to handle any errors. Set the admission response to
+	// allowed=true if no errors.
+	defer func() {
+		if len(valErrors) == 0 {
+			admitResponse.Allowed = true
+		} else {
+			admitResponse.Result = &metav1.Status{
+				Message: "\n" + strings.Join(valErrors, "\n"),
+			}
+		}
+	}()
+
+	// Nothing to check on delete.
+	if ar.Request.Operation == v1beta1.Delete {
+		return &admitResponse
+	}
+
+	// Deserialize the incoming object.
+	raw := ar.Request.Object.Raw
+	nsConfig := kdv1.KubeDirectorNamespaceConfig{}
+	if jsonErr := json.Unmarshal(raw, &nsConfig); jsonErr != nil {
+		valErrors = append(valErrors, jsonErr.Error())
+		return &admitResponse
+	}
+	if nsConfig.Spec == nil {
+		return &admitResponse
+	}
+
+	// The overriding storage class must exist, as for the global one.
+	valErrors = validateConfigStorageClass(nsConfig.Spec.StorageClass, valErrors)
+
+	for _, appID := range nsConfig.Spec.AllowedApps {
+		if appID == "" {
+			valErrors = append(valErrors, emptyAllowedApp)
+			break
+		}
+	}
+	ceilings := map[string]corev1.ResourceList{
+		"maxMemberResources":  nsConfig.Spec.MaxMemberResources,
+		"maxClusterResources": nsConfig.Spec.MaxClusterResources,
+	}
+	for property, ceiling := range ceilings {
+		for resourceName, quantity := range ceiling {
+			if quantity.Sign() < 0 {
+				valErrors = append(
+					valErrors,
+					fmt.Sprintf(negativeResourceCeiling, property, resourceName),
+				)
+			}
+		}
+	}
+
+	return &admitResponse
+}
@@ -0,0 +1,226 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validator
+
+import (
+	"fmt"
+	"sort"
+
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	"github.com/bluek8s/kubedirector/pkg/catalog"
+	"github.com/bluek8s/kubedirector/pkg/executor"
+	"github.com/bluek8s/kubedirector/pkg/observer"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// storageClassQuotaSuffix forms, after a storage class name, the names of
+// the per-class storage limits of a ResourceQuota.
+const storageClassQuotaSuffix = ".storageclass.storage.k8s.io/"
+
+// clusterFootprint returns what the members of the cluster would take from
+// a ResourceQuota in its namespace, keyed by the resource names used in the
+// quota's hard limits. Only the app containers and the member volumes are
+// counted. A role without a members count gets the app's cardinality, and
+// storage without a class gets the default class, as they would when the
+// cluster is admitted.
+func clusterFootprint(
+	cr *kdv1.KubeDirectorCluster,
+	appCR *kdv1.KubeDirectorApp,
+) corev1.ResourceList {
+
+	footprint := corev1.ResourceList{}
+	add := func(name string, quantity resource.Quantity, members int32) {
+		total := footprint[corev1.ResourceName(name)]
+		for i := int32(0); i < members; i++ {
+			total.Add(quantity)
+		}
+		footprint[corev1.ResourceName(name)] = total
+	}
+	addClaims := func(storageClass string, size resource.Quantity, claims int32) {
+		add("requests.storage", size, claims)
+		add(string(corev1.ResourcePersistentVolumeClaims), *resource.NewQuantity(1, resource.DecimalSI), claims)
+		if storageClass != "" {
+			add(storageClass+storageClassQuotaSuffix+"requests.storage", size, claims)
+			add(storageClass+storageClassQuotaSuffix+"persistentvolumeclaims", *resource.NewQuantity(1, resource.DecimalSI), claims)
+		}
+	}
+	k8sDefaultClass := ""
+	if scK8sDefault, _ := observer.GetDefaultStorageClass(); scK8sDefault != nil {
+		k8sDefaultClass = scK8sDefault.Name
+	}
+
+	for _, role := range cr.Spec.Roles {
+		var members int32
+		if role.Members != nil {
+			members = *role.Members
+		} else if appCR != nil {
+			if appRole := catalog.GetRoleFromID(appCR, role.Name); appRole != nil {
+				members, _ = catalog.GetRoleCardinality(appRole)
+			}
+		}
+		if members <= 0 {
+			continue
+		}
+		add(string(corev1.ResourcePods), *resource.NewQuantity(1, resource.DecimalSI), members)
+
+		// K8s defaults a missing request to the limit.
+		requests := corev1.ResourceList{}
+		for name, quantity := range role.Resources.Limits {
+			requests[name] = quantity
+		}
+		for name, quantity := range role.Resources.Requests {
+			requests[name] = quantity
+		}
+		for name, quantity := range requests {
+			add("requests."+string(name), quantity, members)
+			if (name == corev1.ResourceCPU) || (name == corev1.ResourceMemory) {
+				add(string(name), quantity, members)
+			}
+		}
+		for name, quantity := range role.Resources.Limits {
+			add("limits."+string(name), quantity, members)
+		}
+
+		if role.Storage != nil {
+			if size, sizeErr := resource.ParseQuantity(role.Storage.Size); sizeErr == nil {
+				storageClass := k8sDefaultClass
+				if role.Storage.StorageClass != nil {
+					storageClass = *role.Storage.StorageClass
+				} else if configClass := defaultStorageClass(cr.Namespace); configClass != "" {
+					storageClass = configClass
+				}
+				addClaims(storageClass, size, members)
+			}
+		}
+		if (role.BlockStorage != nil) && (role.BlockStorage.NumDevices != nil) {
+			storageClass := k8sDefaultClass
+			if role.BlockStorage.StorageClass != nil {
+				storageClass = *role.BlockStorage.StorageClass
+			}
+			addClaims(storageClass, executor.BlockDeviceSize(&role), members*(*role.BlockStorage.NumDevices))
+		}
+	}
+	return footprint
+}
+
+// sortedResourceNames returns the names in the resource list in order, so
+// that messages about them come out the same way each time.
+func sortedResourceNames(
+	list corev1.ResourceList,
+) []corev1.ResourceName {
+
+	var names []corev1.ResourceName
+	for name := range list {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return names[i] < names[j] })
+	return names
+}
+
+// quotaWarnings compares what a cluster create or change would add to the
+// footprint of the cluster (see clusterFootprint) with what is left in each
+// ResourceQuota of its namespace, and returns a warning for each limit that
+// would be exceeded. Such a cluster would otherwise be admitted but have
+// members whose pods or claims cannot be created. Quotas with scopes are
+// skipped, since whether they apply depends on more than the footprint.
+func quotaWarnings(
+	cr *kdv1.KubeDirectorCluster,
+	prevCr *kdv1.KubeDirectorCluster,
+	appCR *kdv1.KubeDirectorApp,
+) []admissionWarning {
+
+	quotas, listErr := observer.ListResourceQuotas(cr.Namespace)
+	if (listErr != nil) || (len(quotas) == 0) {
+		return nil
+	}
+	added := clusterFootprint(cr, appCR)
+	if prevCr != nil {
+		for name, quantity := range clusterFootprint(prevCr, appCR) {
+			if total, ok := added[name]; ok {
+				total.Sub(quantity)
+				added[name] = total
+			}
+		}
+	}
+
+	var warnings []admissionWarning
+	for _, quota := range quotas {
+		if (len(quota.Spec.Scopes) != 0) || (quota.Spec.ScopeSelector != nil) {
+			continue
+		}
+		for _, name := range sortedResourceNames(quota.Status.Hard) {
+			addition, ok := added[name]
+			if !ok || (addition.Sign() <= 0) {
+				continue
+			}
+			hard := quota.Status.Hard[name]
+			remaining := hard.DeepCopy()
+			remaining.Sub(quota.Status.Used[name])
+			if addition.Cmp(remaining) <= 0 {
+				continue
+			}
+			warnings = append(
+				warnings,
+				admissionWarning{
+					id: warnQuotaExceeded,
+					message: fmt.Sprintf(
+						quotaExceeded,
+						addition.String(),
+						name,
+						quota.Name,
+						remaining.String(),
+						hard.String(),
+					),
+				},
+			)
+		}
+	}
+	return warnings
+}
+
+// validateClusterResourceCeiling checks the whole footprint of the cluster
+// (see clusterFootprint) against the per-cluster maximums of the namespace
+// config, if any.
+func validateClusterResourceCeiling(
+	cr *kdv1.KubeDirectorCluster,
+	appCR *kdv1.KubeDirectorApp,
+	valErrors []string,
+) []string {
+
+	nsSpec := namespaceConfigSpec(cr.Namespace)
+	if (nsSpec == nil) || (len(nsSpec.MaxClusterResources) == 0) {
+		return valErrors
+	}
+	footprint := clusterFootprint(cr, appCR)
+	for _, name := range sortedResourceNames(nsSpec.MaxClusterResources) {
+		ceiling := nsSpec.MaxClusterResources[name]
+		total, ok := footprint[name]
+		if !ok || (total.Cmp(ceiling) <= 0) {
+			continue
+		}
+		valErrors = append(
+			valErrors,
+			fmt.Sprintf(
+				clusterResourceCeiling,
+				total.String(),
+				name,
+				ceiling.String(),
+				cr.Namespace,
+			),
+		)
+	}
+	return valErrors
+}
@@ -0,0 +1,67 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validator
+
+import (
+	"fmt"
+
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+)
+
+// validateNamingSchemeChange checks a change to the naming scheme of a
+// cluster. Carrying out such a change re-creates the statefulset of every
+// role that has one, which renames the members, so it must be acknowledged
+// through recreateAcknowledgement. The naming scheme also cannot be changed
+// again until an earlier change has been carried out. Any generated error
+// messages will be added to the input list and returned.
+func validateNamingSchemeChange(
+	cr *kdv1.KubeDirectorCluster,
+	prevCr *kdv1.KubeDirectorCluster,
+	valErrors []string,
+) []string {
+
+	if (cr.Spec.NamingScheme == nil) || (prevCr.Spec.NamingScheme == nil) {
+		return valErrors
+	}
+	if *(cr.Spec.NamingScheme) == *(prevCr.Spec.NamingScheme) {
+		return valErrors
+	}
+	if prevCr.Status == nil {
+		return valErrors
+	}
+	if (prevCr.Status.NamingScheme != "") &&
+		(prevCr.Status.NamingScheme != *(prevCr.Spec.NamingScheme)) {
+		return append(
+			valErrors,
+			fmt.Sprintf(recreateInProgress, *(prevCr.Spec.NamingScheme)),
+		)
+	}
+	if cr.Spec.RecreateAcknowledgement {
+		return valErrors
+	}
+	for _, roleStatus := range prevCr.Status.Roles {
+		if roleStatus.StatefulSet != "" {
+			return append(
+				valErrors,
+				fmt.Sprintf(
+					unacknowledgedRecreate,
+					*(prevCr.Spec.NamingScheme),
+					*(cr.Spec.NamingScheme),
+				),
+			)
+		}
+	}
+	return valErrors
+}
@@ -0,0 +1,213 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validator
+
+import (
+	"fmt"
+	"strings"
+
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	"github.com/bluek8s/kubedirector/pkg/observer"
+	"github.com/bluek8s/kubedirector/pkg/shared"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	k8svalidation "k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/version"
+)
+
+// minBlockVolumesVersion is the first K8s version with raw block volume
+// support enabled by default.
+const minBlockVolumesVersion = "1.13"
+
+// validateRequirementsDecl checks the syntax of the app's declared cluster
+// requirements. Any generated error messages will be added to the input
+// list and returned.
+func validateRequirementsDecl(
+	appCR *kdv1.KubeDirectorApp,
+	valErrors []string,
+) []string {
+
+	requirements := appCR.Spec.Requirements
+	if requirements == nil {
+		return valErrors
+	}
+	if requirements.MinKubernetesVersion != nil {
+		_, parseErr := version.ParseGeneric(*requirements.MinKubernetesVersion)
+		if parseErr != nil {
+			valErrors = append(
+				valErrors,
+				fmt.Sprintf(invalidMinK8sVersion, *requirements.MinKubernetesVersion, parseErr),
+			)
+		}
+	}
+	for _, resource := range requirements.DeviceResources {
+		if errs := k8svalidation.IsQualifiedName(resource); len(errs) != 0 {
+			valErrors = append(
+				valErrors,
+				fmt.Sprintf(invalidDeviceResource, resource, strings.Join(errs, "; ")),
+			)
+		}
+	}
+	return valErrors
+}
+
+// validateAppRequirements checks the live K8s cluster against the
+// requirements declared by the app of a new virtual cluster. Any generated
+// error messages will be added to the input list and returned.
+func validateAppRequirements(
+	appCR *kdv1.KubeDirectorApp,
+	valErrors []string,
+) []string {
+
+	requirements := appCR.Spec.Requirements
+	if requirements == nil {
+		return valErrors
+	}
+	checkFailed := func(err error) []string {
+		return append(
+			valErrors,
+			fmt.Sprintf(requirementCheckFailed, appCR.Name, err),
+		)
+	}
+
+	needsVersion := (requirements.MinKubernetesVersion != nil) ||
+		shared.StringInList(kdv1.AppFeatureBlockVolumes, requirements.Features)
+	if needsVersion {
+		serverInfo, infoErr := observer.GetServerVersion()
+		if infoErr != nil {
+			return checkFailed(infoErr)
+		}
+		serverVersion, parseErr := version.ParseGeneric(serverInfo.GitVersion)
+		if parseErr != nil {
+			return checkFailed(parseErr)
+		}
+		if requirements.MinKubernetesVersion != nil {
+			minVersion, minErr := version.ParseGeneric(*requirements.MinKubernetesVersion)
+			if minErr != nil {
+				return checkFailed(minErr)
+			}
+			if !serverVersion.AtLeast(minVersion) {
+				valErrors = append(
+					valErrors,
+					fmt.Sprintf(
+						k8sVersionTooOld,
+						appCR.Name,
+						*requirements.MinKubernetesVersion,
+						serverInfo.GitVersion,
+					),
+				)
+			}
+		}
+		if shared.StringInList(kdv1.AppFeatureBlockVolumes, requirements.Features) &&
+			!serverVersion.AtLeast(version.MustParseGeneric(minBlockVolumesVersion)) {
+			valErrors = append(
+				valErrors,
+				fmt.Sprintf(
+					missingClusterFeature,
+					appCR.Name,
+					kdv1.AppFeatureBlockVolumes,
+					"Kubernetes "+serverInfo.GitVersion+" is older than "+minBlockVolumesVersion,
+				),
+			)
+		}
+	}
+
+	if shared.StringInList(kdv1.AppFeatureReadWriteMany, requirements.Features) {
+		storageClasses, listErr := observer.ListStorageClasses()
+		if listErr != nil {
+			return checkFailed(listErr)
+		}
+		found := false
+		for _, storageClass := range storageClasses {
+			if storageClassSupports(&storageClass, corev1.ReadWriteMany) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			valErrors = append(
+				valErrors,
+				fmt.Sprintf(
+					missingClusterFeature,
+					appCR.Name,
+					kdv1.AppFeatureReadWriteMany,
+					"no storage class lists ReadWriteMany in its "+
+						shared.StorageClassAccessModesAnnotation+" annotation",
+				),
+			)
+		}
+	}
+
+	if shared.StringInList(kdv1.AppFeatureVolumeSnapshots, requirements.Features) {
+		served, servedErr := observer.APIGroupVersionServed("snapshot.storage.k8s.io/v1")
+		if servedErr != nil {
+			return checkFailed(servedErr)
+		}
+		if !served {
+			valErrors = append(
+				valErrors,
+				fmt.Sprintf(
+					missingClusterFeature,
+					appCR.Name,
+					kdv1.AppFeatureVolumeSnapshots,
+					"the snapshot.storage.k8s.io/v1 API is not served",
+				),
+			)
+		}
+	}
+
+	if len(requirements.DeviceResources) != 0 {
+		nodes, nodesErr := observer.ListNodes()
+		if nodesErr != nil {
+			return checkFailed(nodesErr)
+		}
+		for _, resource := range requirements.DeviceResources {
+			found := false
+			for _, node := range nodes {
+				quantity, ok := node.Status.Allocatable[corev1.ResourceName(resource)]
+				if ok && !quantity.IsZero() {
+					found = true
+					break
+				}
+			}
+			if !found {
+				valErrors = append(
+					valErrors,
+					fmt.Sprintf(missingDeviceResource, appCR.Name, resource),
+				)
+			}
+		}
+	}
+	return valErrors
+}
+
+// storageClassSupports reports whether the storage class is declared, by
+// its access modes annotation, to support the given PVC access mode.
+func storageClassSupports(
+	storageClass *storagev1.StorageClass,
+	mode corev1.PersistentVolumeAccessMode,
+) bool {
+
+	modes, ok := storageClass.Annotations[shared.StorageClassAccessModesAnnotation]
+	if !ok {
+		return false
+	}
+	for _, declared := range strings.Split(modes, ",") {
+		if strings.TrimSpace(declared) == string(mode) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,89 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validator
+
+import (
+	"testing"
+
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	"github.com/bluek8s/kubedirector/pkg/shared"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+)
+
+func TestValidateRequirementsDecl(t *testing.T) {
+
+	tests := []struct {
+		name         string
+		requirements *kdv1.AppRequirements
+		want         []string
+	}{
+		{"none", nil, nil},
+		{
+			"valid",
+			&kdv1.AppRequirements{
+				MinKubernetesVersion: shared.StrPtr("1.16"),
+				DeviceResources:      []string{"nvidia.com/gpu"},
+			},
+			nil,
+		},
+		{
+			"full version",
+			&kdv1.AppRequirements{MinKubernetesVersion: shared.StrPtr("v1.18.3-gke.1")},
+			nil,
+		},
+		{
+			"bad version",
+			&kdv1.AppRequirements{MinKubernetesVersion: shared.StrPtr("one.sixteen")},
+			[]string{"minKubernetesVersion(one.sixteen) is not a valid version: "},
+		},
+		{
+			"bad device resource",
+			&kdv1.AppRequirements{DeviceResources: []string{"nvidia.com/gpu", "bad gpu"}},
+			[]string{"Device resource(bad gpu) is not a valid resource name: "},
+		},
+	}
+	for _, test := range tests {
+		appCR := &kdv1.KubeDirectorApp{}
+		appCR.Spec.Requirements = test.requirements
+		got := validateRequirementsDecl(appCR, nil)
+		checkProblems(t, test.name, got, test.want)
+	}
+}
+
+func TestStorageClassSupports(t *testing.T) {
+
+	tests := []struct {
+		name  string
+		modes *string
+		want  bool
+	}{
+		{"no annotation", nil, false},
+		{"listed", shared.StrPtr("ReadWriteOnce, ReadWriteMany"), true},
+		{"not listed", shared.StrPtr("ReadWriteOnce,ReadOnlyMany"), false},
+		{"prefix only", shared.StrPtr("ReadWriteManyish"), false},
+	}
+	for _, test := range tests {
+		storageClass := &storagev1.StorageClass{}
+		if test.modes != nil {
+			storageClass.Annotations = map[string]string{
+				shared.StorageClassAccessModesAnnotation: *test.modes,
+			}
+		}
+		if got := storageClassSupports(storageClass, corev1.ReadWriteMany); got != test.want {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,268 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	"github.com/bluek8s/kubedirector/pkg/catalog"
+	"github.com/bluek8s/kubedirector/pkg/controller/kubedirectorcluster"
+	"github.com/bluek8s/kubedirector/pkg/observer"
+	"github.com/bluek8s/kubedirector/pkg/shared"
+	"k8s.io/api/admission/v1beta1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	k8sClient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// validateRoleScale checks that a role scale targets an existing role of an
+// existing cluster, that no other role scale targets the same role, and that
+// any requested member count is allowed by the app's role cardinality. If
+// the member count is changing and the KubeDirectorConfig rejects
+// conflicting changes, it also checks that the cluster is not still carrying
+// out an earlier membership change.
+func validateRoleScale(
+	roleScale *kdv1.KubeDirectorRoleScale,
+	prevRoleScale *kdv1.KubeDirectorRoleScale,
+	valErrors []string,
+) []string {
+
+	if prevRoleScale != nil {
+		if roleScale.Spec.Cluster != prevRoleScale.Spec.Cluster {
+			return append(valErrors, fmt.Sprintf(modifiedProperty, "cluster"))
+		}
+		if roleScale.Spec.Role != prevRoleScale.Spec.Role {
+			return append(valErrors, fmt.Sprintf(modifiedProperty, "role"))
+		}
+	}
+
+	cluster, clusterErr := observer.GetCluster(roleScale.Namespace, roleScale.Spec.Cluster)
+	if clusterErr != nil {
+		return append(
+			valErrors,
+			fmt.Sprintf(roleScaleNoCluster, roleScale.Spec.Cluster, clusterErr),
+		)
+	}
+	var roleSpec *kdv1.Role
+	for i := range cluster.Spec.Roles {
+		if cluster.Spec.Roles[i].Name == roleScale.Spec.Role {
+			roleSpec = &(cluster.Spec.Roles[i])
+			break
+		}
+	}
+	if roleSpec == nil {
+		return append(
+			valErrors,
+			fmt.Sprintf(roleScaleNoRole, roleScale.Spec.Role, roleScale.Spec.Cluster),
+		)
+	}
+
+	if prevRoleScale == nil {
+		roleScales := &kdv1.KubeDirectorRoleScaleList{}
+		listErr := shared.List(
+			context.TODO(),
+			roleScales,
+			k8sClient.InNamespace(roleScale.Namespace),
+		)
+		if listErr == nil {
+			for _, other := range roleScales.Items {
+				if (other.Name != roleScale.Name) &&
+					(other.Spec.Cluster == roleScale.Spec.Cluster) &&
+					(other.Spec.Role == roleScale.Spec.Role) {
+					valErrors = append(
+						valErrors,
+						fmt.Sprintf(
+							roleScaleDuplicate,
+							roleScale.Spec.Role,
+							roleScale.Spec.Cluster,
+							other.Name,
+						),
+					)
+				}
+			}
+		}
+	}
+
+	if roleScale.Spec.Members == nil {
+		return valErrors
+	}
+	appCR, appErr := catalog.FindApp(cluster)
+	if appErr == nil {
+		if appRole := catalog.GetRoleFromID(appCR, roleSpec.Name); appRole != nil {
+			cardinality, isScaleOut := catalog.GetRoleCardinality(appRole)
+			members := *roleScale.Spec.Members
+			if (isScaleOut && (members < cardinality)) ||
+				(!isScaleOut && (members != cardinality)) {
+				valErrors = append(
+					valErrors,
+					fmt.Sprintf(
+						invalidCardinality,
+						roleSpec.Name,
+						members,
+						appRole.Cardinality,
+					),
+				)
+			}
+		}
+	}
+
+	membersChanged := (roleSpec.Members == nil) ||
+		(*roleSpec.Members != *roleScale.Spec.Members)
+	if !membersChanged {
+		return valErrors
+	}
+	if loadErr := shared.LoadMemberStatusDetail(cluster); loadErr != nil {
+		return append(
+			valErrors,
+			fmt.Sprintf(memberDetailUnavailable, loadErr),
+		)
+	}
+	scaledCluster := cluster.DeepCopy()
+	for i := range scaledCluster.Spec.Roles {
+		if scaledCluster.Spec.Roles[i].Name == roleSpec.Name {
+			scaledCluster.Spec.Roles[i].Members = roleScale.Spec.Members
+		}
+	}
+	valErrors = validateShrinkAcknowledgement(scaledCluster, valErrors)
+	if shared.GetRejectConflictingChanges() {
+		if conflicts, activeGen := kubedirectorcluster.ChangeConflicts(scaledCluster); conflicts {
+			valErrors = append(
+				valErrors,
+				fmt.Sprintf(conflictingChange, activeGen),
+			)
+		}
+	}
+	return valErrors
+}
+
+// admitRoleScaleCR is the top-level role scale validation function, which
+// invokes the specific validation subroutines and composes the admission
+// response.
+func admitRoleScaleCR(
+	ar *v1beta1.AdmissionReview,
+) *v1beta1.AdmissionResponse {
+
+	var valErrors []string
+	var admitResponse = v1beta1.AdmissionResponse{
+		Allowed: false,
+	}
+
+	// Set a defer func to handle any errors. Set the admission response to
+	// allowed=true if no errors.
+	defer func() {
+		if len(valErrors) == 0 {
+			admitResponse.Allowed = true
+		} else {
+			admitResponse.Result = &metav1.Status{
+				Message: "\n" + strings.Join(valErrors, "\n"),
+			}
+		}
+	}()
+
+	// Nothing to check on delete.
+	if ar.Request.Operation == v1beta1.Delete {
+		return &admitResponse
+	}
+
+	// Deserialize the incoming object.
+	raw := ar.Request.Object.Raw
+	roleScale := kdv1.KubeDirectorRoleScale{}
+	if jsonErr := json.Unmarshal(raw, &roleScale); jsonErr != nil {
+		valErrors = append(valErrors, jsonErr.Error())
+		return &admitResponse
+	}
+
+	// We'll need the existing object in the update case. If the spec is
+	// not changing there is nothing to check.
+	var prevRoleScale *kdv1.KubeDirectorRoleScale
+	if ar.Request.Operation == v1beta1.Update {
+		prevRoleScale = &kdv1.KubeDirectorRoleScale{}
+		prevRaw := ar.Request.OldObject.Raw
+		if prevJSONErr := json.Unmarshal(prevRaw, prevRoleScale); prevJSONErr != nil {
+			valErrors = append(valErrors, prevJSONErr.Error())
+			return &admitResponse
+		}
+		if equality.Semantic.DeepEqual(roleScale.Spec, prevRoleScale.Spec) {
+			return &admitResponse
+		}
+	}
+
+	valErrors = validateRoleScale(&roleScale, prevRoleScale, valErrors)
+
+	return &admitResponse
+}
+
+// admitScale validates an update through the scale subresource of a role
+// scale, as done by a HorizontalPodAutoscaler. The new replica count is
+// checked in the same way as a change to the role scale's members property.
+func admitScale(
+	ar *v1beta1.AdmissionReview,
+) *v1beta1.AdmissionResponse {
+
+	var valErrors []string
+	var admitResponse = v1beta1.AdmissionResponse{
+		Allowed: false,
+	}
+
+	// Set a defer func to handle any errors. Set the admission response to
+	// allowed=true if no errors.
+	defer func() {
+		if len(valErrors) == 0 {
+			admitResponse.Allowed = true
+		} else {
+			admitResponse.Result = &metav1.Status{
+				Message: "\n" + strings.Join(valErrors, "\n"),
+			}
+		}
+	}()
+
+	// The only scale subresource we register for is that of role scales.
+	if ar.Request.Resource.Resource != "kubedirectorrolescales" {
+		return &admitResponse
+	}
+
+	raw := ar.Request.Object.Raw
+	scale := autoscalingv1.Scale{}
+	if jsonErr := json.Unmarshal(raw, &scale); jsonErr != nil {
+		valErrors = append(valErrors, jsonErr.Error())
+		return &admitResponse
+	}
+	prevRoleScale := &kdv1.KubeDirectorRoleScale{}
+	getErr := shared.Get(
+		context.TODO(),
+		types.NamespacedName{Namespace: ar.Request.Namespace, Name: ar.Request.Name},
+		prevRoleScale,
+	)
+	if getErr != nil {
+		valErrors = append(valErrors, getErr.Error())
+		return &admitResponse
+	}
+	if (prevRoleScale.Spec.Members != nil) &&
+		(*prevRoleScale.Spec.Members == scale.Spec.Replicas) {
+		return &admitResponse
+	}
+	roleScale := prevRoleScale.DeepCopy()
+	roleScale.Spec.Members = &scale.Spec.Replicas
+
+	valErrors = validateRoleScale(roleScale, prevRoleScale, valErrors)
+
+	return &admitResponse
+}
@@ -0,0 +1,59 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validator
+
+import (
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+)
+
+// applyRollback handles a request to roll the cluster back to its
+// last-known-good spec. If rollback is set in the incoming spec, that spec
+// is replaced, both here and through a patch to the stored object, by the
+// spec recorded in the cluster status. The remaining validation then
+// applies to the recorded spec as if the user had submitted it. The
+// shrinkAcknowledgement of the request is kept, since rolling back may
+// shrink roles. Any generated error messages will be added to the input
+// list and returned.
+func applyRollback(
+	cr *kdv1.KubeDirectorCluster,
+	prevCr *kdv1.KubeDirectorCluster,
+	valErrors []string,
+	patches []clusterPatchSpec,
+) ([]string, []clusterPatchSpec) {
+
+	if !cr.Spec.Rollback {
+		return valErrors, patches
+	}
+	if (prevCr.Status == nil) || (prevCr.Status.LastKnownGood == nil) {
+		valErrors = append(valErrors, noLastKnownGood)
+		return valErrors, patches
+	}
+
+	spec := prevCr.Status.LastKnownGood.Spec.DeepCopy()
+	spec.Rollback = false
+	spec.ShrinkAcknowledgement = cr.Spec.ShrinkAcknowledgement
+	cr.Spec = *spec
+	patches = append(
+		patches,
+		clusterPatchSpec{
+			Op:   "replace",
+			Path: "/spec",
+			Value: clusterPatchValue{
+				ValueSpec: spec,
+			},
+		},
+	)
+	return valErrors, patches
+}
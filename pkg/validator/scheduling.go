@@ -0,0 +1,145 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validator
+
+import (
+	"fmt"
+	"strconv"
+
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	"github.com/bluek8s/kubedirector/pkg/shared"
+	k8svalidation "k8s.io/apimachinery/pkg/util/validation"
+)
+
+// applySchedulingDefaults fills in the default pod scheduling settings from
+// the KubeDirectorConfig, for each role of a cluster being created that
+// does not set the same property itself. A role's own tolerations or
+// nodeSelector replace the defaults rather than being merged with them. The
+// result is placed back into the given CR, so that later validation sees
+// it, and also returned as patches.
+func applySchedulingDefaults(
+	cr *kdv1.KubeDirectorCluster,
+	patches []clusterPatchSpec,
+) []clusterPatchSpec {
+
+	defaults := shared.GetSchedulingDefaults()
+	if defaults == nil {
+		return patches
+	}
+	numRoles := len(cr.Spec.Roles)
+	for i := 0; i < numRoles; i++ {
+		role := &(cr.Spec.Roles[i])
+		rolePath := "/spec/roles/" + strconv.Itoa(i)
+		if (len(role.Tolerations) == 0) && (len(defaults.Tolerations) != 0) {
+			role.Tolerations = defaults.Tolerations
+			tolerations := defaults.Tolerations
+			patches = append(
+				patches,
+				clusterPatchSpec{
+					Op:   "add",
+					Path: rolePath + "/tolerations",
+					Value: clusterPatchValue{
+						ValueTolerations: &tolerations,
+					},
+				},
+			)
+		}
+		if (len(role.NodeSelector) == 0) && (len(defaults.NodeSelector) != 0) {
+			role.NodeSelector = defaults.NodeSelector
+			nodeSelector := dictValue(defaults.NodeSelector)
+			patches = append(
+				patches,
+				clusterPatchSpec{
+					Op:   "add",
+					Path: rolePath + "/nodeSelector",
+					Value: clusterPatchValue{
+						ValueDict: &nodeSelector,
+					},
+				},
+			)
+		}
+		if (role.RuntimeClassName == "") && (defaults.RuntimeClassName != nil) {
+			role.RuntimeClassName = *defaults.RuntimeClassName
+			runtimeClass := *defaults.RuntimeClassName
+			patches = append(
+				patches,
+				clusterPatchSpec{
+					Op:   "add",
+					Path: rolePath + "/runtimeClassName",
+					Value: clusterPatchValue{
+						ValueStr: &runtimeClass,
+					},
+				},
+			)
+		}
+		if (role.PriorityClassName == "") && (defaults.PriorityClassName != nil) {
+			role.PriorityClassName = *defaults.PriorityClassName
+			priorityClass := *defaults.PriorityClassName
+			patches = append(
+				patches,
+				clusterPatchSpec{
+					Op:   "add",
+					Path: rolePath + "/priorityClassName",
+					Value: clusterPatchValue{
+						ValueStr: &priorityClass,
+					},
+				},
+			)
+		}
+	}
+	return patches
+}
+
+// validateConfigSchedulingDefaults checks the default pod scheduling
+// settings, if any, for content that would be rejected in a role.
+func validateConfigSchedulingDefaults(
+	defaults *kdv1.SchedulingDefaults,
+	valErrors []string,
+) []string {
+
+	if defaults == nil {
+		return valErrors
+	}
+	var problems []string
+	problems = append(problems, checkTolerations(defaults.Tolerations, "tolerations")...)
+	for key, value := range defaults.NodeSelector {
+		var msgs []string
+		msgs = append(msgs, k8svalidation.IsQualifiedName(key)...)
+		msgs = append(msgs, k8svalidation.IsValidLabelValue(value)...)
+		for _, msg := range msgs {
+			problems = append(
+				problems,
+				fmt.Sprintf("nodeSelector %s(%s): %s", key, value, msg),
+			)
+		}
+	}
+	if defaults.RuntimeClassName != nil {
+		for _, msg := range k8svalidation.IsDNS1123Subdomain(*defaults.RuntimeClassName) {
+			problems = append(problems, "runtimeClassName "+msg)
+		}
+	}
+	if defaults.PriorityClassName != nil {
+		for _, msg := range k8svalidation.IsDNS1123Subdomain(*defaults.PriorityClassName) {
+			problems = append(problems, "priorityClassName "+msg)
+		}
+	}
+	for _, problem := range problems {
+		valErrors = append(
+			valErrors,
+			fmt.Sprintf(invalidSchedulingDefaults, problem),
+		)
+	}
+	return valErrors
+}
@@ -0,0 +1,136 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validator
+
+import (
+	"reflect"
+	"testing"
+
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	"github.com/bluek8s/kubedirector/pkg/shared"
+	core "k8s.io/api/core/v1"
+)
+
+func TestApplySchedulingDefaults(t *testing.T) {
+
+	runtimeClass := "gvisor"
+	defaults := &kdv1.SchedulingDefaults{
+		Tolerations: []core.Toleration{
+			{Key: "dedicated", Value: "kd", Effect: core.TaintEffectNoSchedule},
+		},
+		NodeSelector:     map[string]string{"pool": "kd"},
+		RuntimeClassName: &runtimeClass,
+	}
+	config := &kdv1.KubeDirectorConfig{
+		Spec: &kdv1.KubeDirectorConfigSpec{SchedulingDefaults: defaults},
+	}
+	shared.AddGlobalConfig(config)
+	defer shared.RemoveGlobalConfig()
+
+	cr := &kdv1.KubeDirectorCluster{}
+	cr.Spec.Roles = []kdv1.Role{
+		{Name: "plain"},
+		{
+			Name:             "own",
+			NodeSelector:     map[string]string{"pool": "gpu"},
+			RuntimeClassName: "kata",
+		},
+	}
+	patches := applySchedulingDefaults(cr, nil)
+
+	var gotPaths []string
+	for _, patch := range patches {
+		gotPaths = append(gotPaths, patch.Op+" "+patch.Path)
+	}
+	wantPaths := []string{
+		"add /spec/roles/0/tolerations",
+		"add /spec/roles/0/nodeSelector",
+		"add /spec/roles/0/runtimeClassName",
+		"add /spec/roles/1/tolerations",
+	}
+	if !reflect.DeepEqual(gotPaths, wantPaths) {
+		t.Errorf("got patches %v, want %v", gotPaths, wantPaths)
+	}
+
+	tests := []struct {
+		role             int
+		wantTolerations  []core.Toleration
+		wantNodeSelector map[string]string
+		wantRuntimeClass string
+	}{
+		{0, defaults.Tolerations, defaults.NodeSelector, runtimeClass},
+		{1, defaults.Tolerations, map[string]string{"pool": "gpu"}, "kata"},
+	}
+	for _, test := range tests {
+		role := cr.Spec.Roles[test.role]
+		if !reflect.DeepEqual(role.Tolerations, test.wantTolerations) {
+			t.Errorf("role %s: got tolerations %v, want %v", role.Name, role.Tolerations, test.wantTolerations)
+		}
+		if !reflect.DeepEqual(role.NodeSelector, test.wantNodeSelector) {
+			t.Errorf("role %s: got nodeSelector %v, want %v", role.Name, role.NodeSelector, test.wantNodeSelector)
+		}
+		if role.RuntimeClassName != test.wantRuntimeClass {
+			t.Errorf("role %s: got runtimeClassName %s, want %s", role.Name, role.RuntimeClassName, test.wantRuntimeClass)
+		}
+	}
+}
+
+func TestValidateConfigSchedulingDefaults(t *testing.T) {
+
+	badClass := "Bad_Class"
+	goodClass := "high"
+	tests := []struct {
+		name     string
+		defaults *kdv1.SchedulingDefaults
+		want     []string
+	}{
+		{"none", nil, nil},
+		{
+			"valid",
+			&kdv1.SchedulingDefaults{
+				Tolerations: []core.Toleration{
+					{Key: "dedicated", Operator: core.TolerationOpExists},
+				},
+				NodeSelector:      map[string]string{"pool": "kd"},
+				PriorityClassName: &goodClass,
+			},
+			nil,
+		},
+		{
+			"bad toleration",
+			&kdv1.SchedulingDefaults{
+				Tolerations: []core.Toleration{{Operator: "Like"}},
+			},
+			[]string{"Invalid schedulingDefaults: tolerations[0].operator: unknown operator(Like)."},
+		},
+		{
+			"bad nodeSelector and classes",
+			&kdv1.SchedulingDefaults{
+				NodeSelector:      map[string]string{"pool": "bad value"},
+				RuntimeClassName:  &badClass,
+				PriorityClassName: &badClass,
+			},
+			[]string{
+				"Invalid schedulingDefaults: nodeSelector pool(bad value): ",
+				"Invalid schedulingDefaults: runtimeClassName ",
+				"Invalid schedulingDefaults: priorityClassName ",
+			},
+		},
+	}
+	for _, test := range tests {
+		got := validateConfigSchedulingDefaults(test.defaults, nil)
+		checkProblems(t, test.name, got, test.want)
+	}
+}
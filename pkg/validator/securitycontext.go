@@ -0,0 +1,107 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validator
+
+import (
+	"fmt"
+
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	core "k8s.io/api/core/v1"
+)
+
+// validateRolePodSecurityContext checks the pod security context of each
+// role that sets one, for content that the apiserver would reject in a pod
+// spec. Any generated error messages will be added to the input list and
+// returned.
+func validateRolePodSecurityContext(
+	cr *kdv1.KubeDirectorCluster,
+	valErrors []string,
+) []string {
+
+	for _, role := range cr.Spec.Roles {
+		for _, problem := range checkPodSecurityContext(role.PodSecurityContext) {
+			valErrors = append(
+				valErrors,
+				fmt.Sprintf(invalidPodSecurityContext, role.Name, problem),
+			)
+		}
+	}
+	return valErrors
+}
+
+// validateConfigPodSecurityContext checks the default pod security context,
+// if any, for content that would be rejected in a role.
+func validateConfigPodSecurityContext(
+	securityContext *core.PodSecurityContext,
+	valErrors []string,
+) []string {
+
+	for _, problem := range checkPodSecurityContext(securityContext) {
+		valErrors = append(
+			valErrors,
+			fmt.Sprintf(invalidDefaultPodSecurityContext, problem),
+		)
+	}
+	return valErrors
+}
+
+// checkPodSecurityContext returns a description of each problem found in
+// the given pod security context, which may be nil.
+func checkPodSecurityContext(
+	securityContext *core.PodSecurityContext,
+) []string {
+
+	var problems []string
+	if securityContext == nil {
+		return problems
+	}
+	ids := []struct {
+		name  string
+		value *int64
+	}{
+		{"runAsUser", securityContext.RunAsUser},
+		{"runAsGroup", securityContext.RunAsGroup},
+		{"fsGroup", securityContext.FSGroup},
+	}
+	for _, id := range ids {
+		if (id.value != nil) && (*id.value < 0) {
+			problems = append(
+				problems,
+				fmt.Sprintf("%s(%d) must not be negative", id.name, *id.value),
+			)
+		}
+	}
+	for i, group := range securityContext.SupplementalGroups {
+		if group < 0 {
+			problems = append(
+				problems,
+				fmt.Sprintf("supplementalGroups[%d](%d) must not be negative", i, group),
+			)
+		}
+	}
+	if (securityContext.RunAsNonRoot != nil) && *securityContext.RunAsNonRoot &&
+		(securityContext.RunAsUser != nil) && (*securityContext.RunAsUser == 0) {
+		problems = append(problems, "runAsNonRoot cannot be true when runAsUser is 0")
+	}
+	for i, sysctl := range securityContext.Sysctls {
+		if sysctl.Name == "" {
+			problems = append(
+				problems,
+				fmt.Sprintf("sysctls[%d].name must be non-empty", i),
+			)
+		}
+	}
+	return problems
+}
@@ -33,10 +33,20 @@ import (
 
 // Add validation handlers for all CRs that we currently support
 var validationHandlers = map[string]admitFunc{
-	"KubeDirectorApp":       admitAppCR,
-	"KubeDirectorCluster":   admitClusterCR,
-	"KubeDirectorConfig":    admitKDConfigCR,
-	"PersistentVolumeClaim": admitPVC,
+	"KubeDirectorApp":             admitAppCR,
+	"KubeDirectorCluster":         admitClusterCR,
+	"KubeDirectorConfig":          admitKDConfigCR,
+	"PersistentVolumeClaim":       admitPVC,
+	"KubeDirectorRoleScale":       admitRoleScaleCR,
+	"Scale":                       admitScale,
+	"KubeDirectorNamespaceConfig": admitNamespaceConfigCR,
+	"KubeDirectorClusterJob":      admitClusterJobCR,
+}
+
+// Add warning handlers for the CRs that we currently check
+var warningHandlers = map[string]warnFunc{
+	"KubeDirectorApp":     appWarnings,
+	"KubeDirectorCluster": clusterWarnings,
 }
 
 var validatorLog = log.Log.WithName(validatorServiceName)
@@ -48,7 +58,7 @@ func validation(
 	r *http.Request,
 ) {
 
-	var admissionResponse *v1beta1.AdmissionResponse
+	var response *v1beta1.AdmissionResponse
 
 	var body []byte
 	if r.Body != nil {
@@ -75,7 +85,7 @@ func validation(
 
 	ar := v1beta1.AdmissionReview{}
 	if err := json.Unmarshal(body, &ar); err != nil {
-		admissionResponse = &v1beta1.AdmissionResponse{
+		response = &v1beta1.AdmissionResponse{
 			Result: &metav1.Status{
 				Message: err.Error(),
 			},
@@ -84,24 +94,33 @@ func validation(
 		crKind := ar.Request.Kind.Kind
 		// If there is a validation handler for this CR invoke it.
 		if handler, ok := validationHandlers[crKind]; ok {
-			admissionResponse = handler(&ar)
+			response = handler(&ar)
 		} else {
 			// No validation handler for this CR. Allow to go through.
-			admissionResponse = &v1beta1.AdmissionResponse{
+			response = &v1beta1.AdmissionResponse{
 				Allowed: true,
 			}
 		}
 	}
 
-	admissionReview := v1beta1.AdmissionReview{}
-	if admissionResponse != nil {
-		admissionReview.Response = admissionResponse
+	review := admissionReview{}
+	if response != nil {
+		review.Response = &admissionResponse{
+			AdmissionResponse: response,
+		}
 		if ar.Request != nil {
-			admissionReview.Response.UID = ar.Request.UID
+			review.Response.UID = ar.Request.UID
+			review.Response.Warnings = addWarnings(&ar, response)
+			if !response.Allowed {
+				shared.CountWebhookRejection(
+					ar.Request.Kind.Kind,
+					string(ar.Request.Operation),
+				)
+			}
 		}
 	}
 
-	respBytes, err := json.Marshal(admissionReview)
+	respBytes, err := json.Marshal(review)
 	if err != nil {
 		http.Error(
 			w,
@@ -0,0 +1,67 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validator
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	"github.com/bluek8s/kubedirector/pkg/controller/kubedirectorcluster"
+	"github.com/bluek8s/kubedirector/pkg/shared"
+)
+
+// validateShrinkAcknowledgement checks, if KubeDirector is configured to
+// require it, that every member whose persistent storage would be released
+// by the requested role member counts is listed in the cluster's
+// shrinkAcknowledgement. The caller must already have loaded the cluster's
+// member status detail. Any generated error messages will be added to the
+// input list and returned.
+func validateShrinkAcknowledgement(
+	cr *kdv1.KubeDirectorCluster,
+	valErrors []string,
+) []string {
+
+	if !shared.GetRequireShrinkAcknowledgement() {
+		return valErrors
+	}
+
+	victims := kubedirectorcluster.ShrinkVictims(cr)
+	roleNames := make([]string, 0, len(victims))
+	for roleName := range victims {
+		roleNames = append(roleNames, roleName)
+	}
+	sort.Strings(roleNames)
+	for _, roleName := range roleNames {
+		var missing []string
+		for _, member := range victims[roleName] {
+			if !shared.StringInList(member, cr.Spec.ShrinkAcknowledgement) {
+				missing = append(missing, member)
+			}
+		}
+		if len(missing) != 0 {
+			valErrors = append(
+				valErrors,
+				fmt.Sprintf(
+					unacknowledgedShrink,
+					roleName,
+					strings.Join(missing, "\",\""),
+				),
+			)
+		}
+	}
+	return valErrors
+}
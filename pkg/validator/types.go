@@ -15,8 +15,11 @@
 package validator
 
 import (
+	"time"
+
 	"github.com/bluek8s/kubedirector/pkg/shared"
 	"k8s.io/api/admission/v1beta1"
+	core "k8s.io/api/core/v1"
 )
 
 // admitFunc is used as the type for all the callback validators
@@ -35,6 +38,9 @@ const (
 	defaultNativeSystemd                  = false
 	defaultBackupClusterStatus            = false
 	defaultAllowRestoreWithoutConnections = false
+	defaultHaltExpansionOnImagePullError  = false
+	defaultRejectConflictingChanges       = false
+	defaultRequireShrinkAcknowledgement   = false
 
 	appCrt  = "app.crt"
 	appKey  = "app.pem"
@@ -54,6 +60,17 @@ const (
 	modifiedProperty = "The %s property is read-only."
 	modifiedRole     = "Role(%s) properties other than the members count cannot be modified while role members exist."
 
+	appUpgradeNoPrevious  = "The app cannot be changed to %s, because the current app(%s) cannot be found."
+	appUpgradeDistro      = "The app cannot be changed to %s, because its distroID(%s) differs from that of the current app(%s)."
+	appUpgradeSetupImage  = "The app cannot be changed to %s, because role(%s) would gain or lose its setup image."
+	appUpgradePersistDirs = "The app cannot be changed to %s, because the persistDirs of role(%s) would change."
+	appUpgradeNoPath      = "The app cannot be changed to %s, because it declares no upgrade path from version(%s) of the current app(%s)."
+	appUpgradeNoRollback  = "The app cannot be changed back to %s, because the upgrade path to the current app(%s) does not allow rollback."
+
+	appBaseNotFound    = "Base app(%s) named by derivedFrom was not found."
+	appDerivedFromSelf = "An app cannot be derivedFrom itself."
+	appFlattenFailed   = "Failed to merge the app with its base app(%s): %s"
+
 	invalidNodeRoleID     = "Invalid roleID(%s) in roleServices array in config section. Valid roles: \"%s\""
 	invalidSelectedRoleID = "Invalid element(%s) in selectedRoles array in config section. Valid roles: \"%s\""
 	invalidServiceID      = "Invalid service_id(%s) in roleServices array in config section. Valid services: \"%s\""
@@ -70,8 +87,19 @@ const (
 
 	noDefaultImage  = "Role(%s) has no specified image, and no top-level default image is specified."
 	ttyWithoutStdin = "Role(%s) requested TTY without STDIN."
+	invalidProbe    = "Invalid %s for role(%s): %s."
+
+	setupImageWithoutPackage = "Role(%s) has a setup image but no config package to run in it."
+	pullSecretWithoutOCI     = "Role(%s) has a config package pullSecretName, but its packageURL is not an oci:// reference."
 
-	noURLScheme = "The endpoint for service(%s) must include a urlScheme value because isDashboard is true."
+	shelllessSystemd      = "A shellless app cannot require systemd."
+	shelllessSetupPackage = "Role(%s) of a shellless app has a config package but no setup image to run it in."
+	shelllessPersistDirs  = "Role(%s) of a shellless app cannot have persistDirs or minStorage, because persisted directories are copied out of the app image by a shell."
+	shelllessStorage      = "Role(%s) cannot use persistent storage, because app(%s) is shellless."
+	shelllessInjection    = "Role(%s) cannot use file injections, because app(%s) is shellless."
+
+	noURLScheme    = "The endpoint for service(%s) must include a urlScheme value because isDashboard is true."
+	nonHTTPIngress = "The endpoint for service(%s) must have a urlScheme of http or https because ingress is true."
 
 	failedToPatch = "Internal error: failed to populate default values for unspecified properties."
 
@@ -83,10 +111,21 @@ const (
 
 	invalidMinStorageDef = "Minimum storage size for role (%s) is incorrectly defined."
 
+	appNotAllowedInNamespace = "App(%s) is not allowed in namespace(%s). Allowed apps: \"%s\""
+	memberResourceCeiling    = "The %s of %s(%s) for role(%s) exceeds the maximum of %s allowed per member in namespace(%s)."
+	emptyAllowedApp          = "The allowedApps list cannot contain an empty app ID."
+	negativeResourceCeiling  = "The %s value for %s cannot be negative."
+	clusterResourceCeiling   = "The cluster would use %s of %s, which exceeds the maximum of %s allowed per cluster in namespace(%s)."
+
 	invalidRoleStorageClass = "Unable to fetch storageClassName(%s) for role(%s)."
+	invalidPriorityClass    = "Unable to fetch priorityClassName(%s) for role(%s)."
+	storageShrink           = "Storage size for role(%s) cannot be decreased while role members exist."
+	storageNotExpandable    = "Storage size for role(%s) cannot be increased because storageClassName(%s) does not allow volume expansion."
 	noDefaultStorageClass   = "storageClassName is not specified for one or more roles, and no default storage class is available."
 	badDefaultStorageClass  = "storageClassName is not specified for one or more roles, and default storage class (%s) is not available on the system."
 
+	restartGenerationDecrease = "Restart generation for role(%s) cannot be decreased."
+
 	invalidResource = "Specified resource(\"%s\") value(\"%s\") for role(\"%s\") is invalid. Minimum value must be \"%s\"."
 	invalidStorage  = "Specified persistent storage size(\"%s\") for role(\"%s\") is invalid. Minimum size must be \"%s\"."
 	invalidSrcURL   = "Unable to access the specified URL(\"%s\") in file injection spec for the role (%s). error: %s."
@@ -98,12 +137,236 @@ const (
 	invalidMasterEncryptionKey                      = "masterEncryptionKey is invalid. error: %s."
 	masterEncryptionKeyChange                       = "masterEncryptionKey value cannot be changed while kdclusters exist"
 
+	invalidAppAntiAffinity = "Invalid appAntiAffinity: %s."
+
+	invalidAutoTopologySpread = "Invalid autoTopologySpread: %s."
+
+	invalidSchedulingDefaults = "Invalid schedulingDefaults: %s."
+
+	invalidDefaultPodSecurityContext = "Invalid defaultPodSecurityContext: %s."
+
 	invalidConfigDelete = "kd-global-config cannot be deleted while kdclusters exist"
 
 	invalidPVC        = "Unable to find persistentvolumeclaim(%s) in namespace(%s) as specified for role(%s)."
 	invalidVolumeMode = "Specified persistentvolumeclaim(%s) for role (%s) is invalid. VolumeMode(%s) for the underlying volume must be configured as Filesystem."
 	invalidAccessMode = "Specified persistentvolumeclaim(%s) is invalid. AccessModes for this volume must contain either ReadWriteMany or ReadOnlyMany, since its consumed by more than 1 member of the cluster."
 	invalidMountPath  = "Specified mountPath(%s) for role(%s) is invalid. It must be unique within the role."
+
+	invalidAffinity     = "Invalid affinity for role(%s): %s."
+	invalidTolerations  = "Invalid tolerations for role(%s): %s."
+	invalidNodeSelector = "Invalid nodeSelector for role(%s): %s."
+
+	invalidPodSecurityContext = "Invalid podSecurityContext for role(%s): %s."
+
+	invalidRuntimeClass = "Invalid runtimeClassName for role(%s): %s."
+
+	invalidTopologySpread = "Invalid topologySpreadConstraints for role(%s): %s."
+
+	invalidIdentityProvider = "Invalid workloadIdentity provider(%s) for role(%s). Valid providers: \"%s\""
+	invalidIdentityValue    = "Invalid workloadIdentity for role(%s). The identity value must be non-empty."
+	invalidIdentityTenant   = "Invalid workloadIdentity for role(%s). The tenantID value is only used by the azure provider."
+	conflictingIdentitySA   = "Role(%s) cannot specify both serviceAccountName and workloadIdentity."
+
+	nonUniqueObjectStore    = "Each object store connection must have a unique name; name(%s) is repeated."
+	invalidObjectStoreType  = "Invalid type(%s) for object store connection(%s). Valid types: \"%s\""
+	invalidObjectStoreField = "Object store connection(%s) must specify a non-empty %s."
+
+	nonUniqueDatabase    = "Each database connection must have a unique name; name(%s) is repeated."
+	invalidDatabaseType  = "Invalid engine(%s) for database connection(%s). Valid engines: \"%s\""
+	invalidDatabaseField = "Invalid %s for database connection(%s)."
+
+	noLastKnownGood = "Cannot roll back, because no spec of this cluster has been fully configured yet."
+
+	memberDetailUnavailable = "Cannot read the cluster's member status detail: %v"
+
+	conflictingChange = "Cannot change role members while the membership change from generation %d is still in progress, because rejectConflictingChanges is set in KubeDirectorConfig."
+
+	invalidSidecarName  = "Invalid sidecar name(%s) for role(%s): %s"
+	invalidSidecarImage = "Sidecar(%s) for role(%s) must specify an image."
+	invalidSidecarMount = "Invalid volumeMount for sidecar(%s) in role(%s): %s"
+
+	logSinkMissing = "Logging mode(%s) for role(%s) requires a logSink in the KubeDirectorConfig."
+
+	invalidScratchVolume = "Invalid scratch volume(%s) for role(%s): %s"
+
+	runtimeSocketNamespace = "Role(%s) asks for a container runtime socket, but namespace(%s) is not in the runtimeSocketNamespaces of the KubeDirectorConfig."
+	runtimeSocketImage     = "Role(%s) runtimeSocket source(%s) cannot have an image; only source(%s) runs a sidecar."
+
+	unencryptedStorageClass = "Storage class(%s) for role(%s) does not encrypt volumes at rest, and requireEncryptedStorage is set. Use an encrypted storage class, or mark the class with the kubedirector.hpe.com/encrypted annotation if it does encrypt."
+
+	blockStorageShrink        = "Block device size for role(%s) cannot be decreased while role members exist."
+	blockStorageNotExpandable = "Block device size for role(%s) cannot be increased because storageClassName(%s) does not allow volume expansion."
+	blockDevicesDecrease      = "Number of block devices for role(%s) cannot be decreased while role members exist."
+	invalidBlockDevicePath    = "Invalid block storage pathPrefix(%s) for role(%s): %s"
+	blockKeySecretMissing     = "Role(%s) must set blockStorage encryptionKeySecret, because the app encrypts its block devices."
+	blockKeySecretInvalid     = "Block storage encryptionKeySecret(%s) for role(%s) must exist in the cluster namespace and have a non-empty \"key\" entry."
+
+	accessNotGranted = "Verb(%s) on resource(%s) is not granted."
+
+	invalidDebugTTL         = "Invalid %s annotation value(%s): must be a duration greater than zero and no more than %v."
+	debugNotPermitted       = "User(%s) is not allowed to turn on debug mode for this cluster: %s"
+	debugAnnotationReadOnly = "The %s annotation is set by KubeDirector and cannot be modified."
+
+	missingSpecFragment = "Unable to find spec fragment configmap(%s) in namespace(%s)."
+	invalidSpecFragment = "Invalid spec fragment in configmap(%s) in namespace(%s): %s"
+
+	// specFragmentKey is the configmap data key that holds a spec fragment.
+	specFragmentKey = "fragment"
+	// specFragmentPolicyOverride marks a fragment whose settings take
+	// precedence over those in the cluster spec itself.
+	specFragmentPolicyOverride = "override"
+	// specFragmentPolicyDefault marks a fragment whose settings are only
+	// used where the cluster spec does not itself provide a value.
+	specFragmentPolicyDefault = "default"
+	// appliedFragmentsAnnotation records, on a created cluster, which spec
+	// fragments were merged into it.
+	appliedFragmentsAnnotation = shared.KdDomainBase + "/appliedSpecFragments"
+
+	// maxDebugTTL is the longest duration for which debug mode can be
+	// requested at once.
+	maxDebugTTL = 24 * time.Hour
+	// debugVerb is the RBAC verb on kubedirectorclusters that a user must
+	// be granted in order to turn on debug mode.
+	debugVerb = "debug"
+
+	// IDs of the admission warnings; these are the values that can be
+	// listed in the KubeDirectorConfig escalatedWarnings property. Lint
+	// findings use their codes as IDs instead, and are escalated through
+	// lintSeverities; MissingResourceLimits is kept as an alias that
+	// escalates KD003.
+	warnMissingResourceLimits   = "MissingResourceLimits"
+	warnStorageBelowRecommended = "StorageBelowRecommended"
+	warnDeprecatedNamingScheme  = "DeprecatedNamingScheme"
+	warnLegacySetupLayout       = "LegacySetupLayout"
+	warnQuotaExceeded           = "QuotaExceeded"
+	warnRuntimeSocketAccess     = "RuntimeSocketAccess"
+
+	storageBelowRecommended   = "Storage size(%s) for role(%s) is smaller than the size recommended by the app(%s)."
+	deprecatedNamingScheme    = "The UID naming scheme is deprecated; use CrNameRole instead."
+	legacySetupLayout         = "The %s does not use the new setup layout, which is required for configcli and persisted dirs support."
+	quotaExceeded             = "This change adds %s of %s, but ResourceQuota(%s) has only %s of its %s left."
+	runtimeSocketNodeAccess   = "SECURITY: members of role(%s) get the %s socket of their node, which gives them control of every container on the node and effectively root on it. Prefer source(%s) unless the app is fully trusted."
+	runtimeSocketPrivileged   = "SECURITY: members of role(%s) run a privileged docker-in-docker sidecar, which can escape to its node if compromised."
+	invalidRecommendedStorage = "Invalid recommendedSize(%s) in minStorage of role(%s)."
+	invalidEscalatedWarning   = "Unknown warning ID(%s) in escalatedWarnings. Valid IDs: \"%s\""
+	invalidLintCode           = "Unknown lint code(%s) in lintSeverities. Valid codes: \"%s\""
+	invalidLintSeverity       = "Invalid severity(%s) for lint code(%s). Valid severities: \"%s\""
+
+	roleScaleNoCluster = "Cannot find the cluster(%s) to scale: %v"
+	roleScaleNoRole    = "Role(%s) is not in the spec of cluster(%s)."
+	roleScaleDuplicate = "Role(%s) of cluster(%s) is already scaled by KubeDirectorRoleScale(%s)."
+
+	clusterJobCommandOrHook = "Exactly one of command and hook must be given."
+	invalidJobSchedule      = "Invalid schedule: %v"
+	clusterJobNotPermitted  = "User(%s) is not allowed to exec into pods in namespace(%s), which a cluster job does through KubeDirector: %s"
+
+	approvalNotPermitted       = "User(%s) is not allowed to approve membership changes for this cluster: %s"
+	approvalAnnotationReadOnly = "The %s annotation is set by KubeDirector and cannot be modified."
+	invalidApproveGeneration   = "The %s annotation must be a spec generation number, not \"%s\"."
+
+	creatorAnnotationReadOnly = "The %s annotation is set by KubeDirector when the cluster is created and cannot be modified."
+	creatorLabelReadOnly      = "The %s label is set by KubeDirector when the cluster is created and cannot be modified."
+
+	invalidCloneSource     = "cloneFrom must name exactly one of a backup or a cluster."
+	invalidCloneSourceName = "Unable to find %s(%s) in namespace(%s)."
+	cloneBackupNotReady    = "KubeDirectorBackup(%s) is in state(%s); only a succeeded backup can be cloned."
+	cloneAppMismatch       = "%s(%s) is of app(%s), not app(%s)."
+	cloneNotPermitted      = "User(%s) is not allowed to read %s(%s): %s"
+
+	unacknowledgedShrink = "Shrinking role(%s) would destroy the persistent storage of members(\"%s\"). To proceed, list those members in shrinkAcknowledgement."
+	invalidPVCRetention  = "Invalid deletedPVCRetentionSeconds(%d); must not be negative."
+
+	unacknowledgedRecreate = "Changing namingScheme from %s to %s re-creates the StatefulSets of all roles, which restarts and renames their members. To proceed, set recreateAcknowledgement to true."
+	recreateInProgress     = "namingScheme cannot be changed while the change to %s is still being carried out."
+
+	invalidMemberStatusDetailLimit = "Invalid memberStatusDetailLimit(%d); must not be negative."
+
+	invalidIngressHostTemplate = "Ingress hostTemplate(%s) must contain the %s placeholder."
+
+	invalidDashboardLabel = "Invalid dashboards label(%s=%s): %s"
+
+	invalidAppContainerName    = "Invalid container name(%s) for role(%s): %s"
+	invalidAppContainerMount   = "Invalid volumeMount for container(%s) in role(%s): %s"
+	invalidAppContainerPackage = "Container(%s) of role(%s) cannot have a configPackage, because the role has none."
+
+	emptyBlockDevicePrep = "blockDevicePrep for role(%s) must set a filesystem, or encrypt, or both."
+
+	invalidRequiredEnvName   = "Required env var name(%s) is invalid: %s"
+	nonUniqueRequiredEnv     = "Required env var(%s) is declared more than once."
+	invalidRequiredEnvRole   = "Required env var(%s) lists role(%s), which is not a role of this app."
+	invalidRequiredEnvKey    = "Required env var(%s) has an invalid secretKey(%s): %s"
+	missingRequiredEnv       = "Role(%s) must set env var(%s)%s, which the app requires."
+	missingRequiredSecretEnv = "Role(%s) must set env var(%s)%s, which the app requires, or envSecret must name a secret with key(%s)."
+	invalidEnvSecret         = "Unable to find envSecret(%s) in namespace(%s)."
+
+	invalidMinK8sVersion   = "minKubernetesVersion(%s) is not a valid version: %v"
+	invalidDeviceResource  = "Device resource(%s) is not a valid resource name: %s"
+	k8sVersionTooOld       = "App(%s) requires Kubernetes %s or later; this cluster runs %s."
+	missingClusterFeature  = "App(%s) requires the %s feature, which this Kubernetes cluster does not provide: %s."
+	missingDeviceResource  = "App(%s) requires device resource(%s), which no node in this Kubernetes cluster has allocatable."
+	requirementCheckFailed = "Unable to check the cluster requirements of app(%s): %v"
+
+	storageNotWritable    = "The storage accessModes of role(%s) must include ReadWriteOnce or ReadWriteMany."
+	unsupportedAccessMode = "The %s of role(%s) requests access mode(%s), which storage class(%s) does not list in its %s annotation."
+
+	invalidCertIssuerKind = "Invalid memberCertificates issuerKind(%s). Valid values: %s."
+	invalidCertDuration   = "Invalid memberCertificates duration(%s): %v"
+
+	reservedLabelKey          = "Label key(%s) in %s is reserved for use by KubeDirector or K8s."
+	unknownMemberPlaceholder  = "Unknown placeholder %s in %s. Valid placeholders: {member}, {role}, {cluster}, {namespace}"
+	invalidPropagateLabel     = "Invalid propagateLabels key(%s): %s"
+	nonUniquePropagateLabel   = "propagateLabels lists key(%s) more than once."
+	conflictingPropagateLabel = "propagateLabels key(%s) is also set in the %s of role(%s)."
+
+	invalidConfigMapMount = "Unable to find configmap(%s) for role(%s) in namespace(%s)."
+	duplicateMountPath    = "Role(%s) mounts more than one secret, configmap, or pod info volume at path(%s)."
+
+	invalidEnvFromSource = "Each envFrom entry of role(%s) must have exactly one of secretRef or configMapRef."
+	invalidEnvFromPrefix = "Invalid envFrom prefix(%s) in role(%s): %s"
+	invalidEnvFromRef    = "Unable to find %s(%s) named in envFrom of role(%s) in namespace(%s)."
+
+	// approveVerb is the RBAC verb on kubedirectorclusters that a user must
+	// be granted in order to approve a membership change.
+	approveVerb = "approve"
 )
 
+// knownWarnings lists the IDs of all admission warnings.
+var knownWarnings = []string{
+	warnMissingResourceLimits,
+	warnStorageBelowRecommended,
+	warnDeprecatedNamingScheme,
+	warnLegacySetupLayout,
+	warnQuotaExceeded,
+	warnRuntimeSocketAccess,
+}
+
+// admissionResponse extends the admission response with the warnings list
+// understood by K8s 1.19 and later. Older API servers ignore it.
+type admissionResponse struct {
+	*v1beta1.AdmissionResponse
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// admissionReview is the AdmissionReview returned by the validator, carrying
+// the extended admission response.
+type admissionReview struct {
+	Response *admissionResponse `json:"response,omitempty"`
+}
+
 type dictValue map[string]string
+
+// specFragment is the content of a spec fragment configmap: partial role
+// settings to merge into some or all roles of a new cluster. An empty Roles
+// list selects every role.
+type specFragment struct {
+	Roles                    []string          `json:"roles,omitempty"`
+	Policy                   string            `json:"policy,omitempty"`
+	PodLabels                map[string]string `json:"podLabels,omitempty"`
+	PodAnnotations           map[string]string `json:"podAnnotations,omitempty"`
+	ServiceLabels            map[string]string `json:"serviceLabels,omitempty"`
+	ServiceAnnotations       map[string]string `json:"serviceAnnotations,omitempty"`
+	MemberServiceAnnotations map[string]string `json:"memberServiceAnnotations,omitempty"`
+	EnvVars                  []core.EnvVar     `json:"env,omitempty"`
+	Tolerations              []core.Toleration `json:"tolerations,omitempty"`
+	NodeSelector             map[string]string `json:"nodeSelector,omitempty"`
+}
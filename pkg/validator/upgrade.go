@@ -0,0 +1,154 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validator
+
+import (
+	"fmt"
+
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	"github.com/bluek8s/kubedirector/pkg/catalog"
+	"k8s.io/apimachinery/pkg/api/equality"
+)
+
+// validateAppUpgrade checks a change of the app used by an existing
+// cluster. The new app must be another version of the same app (same
+// distroID, in the same catalog), and for each of the cluster's roles it
+// must keep the same persistDirs and the same use (or not) of a separate
+// setup image, since those cannot be changed for existing members. If the
+// new app declares upgrade paths, one must be from the version of the
+// current app. Other role properties are checked against the new app by the
+// usual validation. Any generated error messages will be added to the input
+// list and returned.
+func validateAppUpgrade(
+	cr *kdv1.KubeDirectorCluster,
+	prevCr *kdv1.KubeDirectorCluster,
+	valErrors []string,
+) []string {
+
+	appCR, appErr := catalog.FindApp(cr)
+	if appErr != nil {
+		// Already reported by validateApp.
+		return valErrors
+	}
+	prevAppCR, prevAppErr := catalog.FindApp(prevCr)
+	if prevAppErr != nil {
+		return append(
+			valErrors,
+			fmt.Sprintf(appUpgradeNoPrevious, cr.Spec.AppID, prevCr.Spec.AppID),
+		)
+	}
+	if appCR.Spec.DistroID != prevAppCR.Spec.DistroID {
+		return append(
+			valErrors,
+			fmt.Sprintf(
+				appUpgradeDistro,
+				cr.Spec.AppID,
+				appCR.Spec.DistroID,
+				prevAppCR.Spec.DistroID,
+			),
+		)
+	}
+	valErrors = validateUpgradePath(cr, prevCr, appCR, prevAppCR, valErrors)
+	for _, role := range cr.Spec.Roles {
+		appRole := catalog.GetRoleFromID(appCR, role.Name)
+		prevAppRole := catalog.GetRoleFromID(prevAppCR, role.Name)
+		if (appRole == nil) || (prevAppRole == nil) {
+			// Unknown roles are reported by validateClusterRoles.
+			continue
+		}
+		if (appRole.SetupImage == nil) != (prevAppRole.SetupImage == nil) {
+			valErrors = append(
+				valErrors,
+				fmt.Sprintf(appUpgradeSetupImage, cr.Spec.AppID, role.Name),
+			)
+		}
+		if !equality.Semantic.DeepEqual(appRole.PersistDirs, prevAppRole.PersistDirs) {
+			valErrors = append(
+				valErrors,
+				fmt.Sprintf(appUpgradePersistDirs, cr.Spec.AppID, role.Name),
+			)
+		}
+	}
+	return valErrors
+}
+
+// validateUpgradePath checks that the app declares an upgrade path from the
+// version of the current app, if it declares any. Going back to the app of
+// an upgrade that is still in progress is instead a rollback, which is
+// rejected only if the path of that upgrade does not allow it. Any
+// generated error messages will be added to the input list and returned.
+func validateUpgradePath(
+	cr *kdv1.KubeDirectorCluster,
+	prevCr *kdv1.KubeDirectorCluster,
+	appCR *kdv1.KubeDirectorApp,
+	prevAppCR *kdv1.KubeDirectorApp,
+	valErrors []string,
+) []string {
+
+	if prevCr.Status != nil {
+		upgrade := prevCr.Status.AppUpgrade
+		if (upgrade != nil) && (upgrade.State == kdv1.AppUpgradeInProgress) &&
+			(upgrade.From == cr.Spec.AppID) && (upgrade.To == prevCr.Spec.AppID) {
+			path := catalog.UpgradePath(prevAppCR, appCR.Spec.Version)
+			if (path != nil) && !path.AllowRollback {
+				valErrors = append(
+					valErrors,
+					fmt.Sprintf(appUpgradeNoRollback, cr.Spec.AppID, prevCr.Spec.AppID),
+				)
+			}
+			return valErrors
+		}
+	}
+	if (appCR.Spec.Upgrade != nil) &&
+		(catalog.UpgradePath(appCR, prevAppCR.Spec.Version) == nil) {
+		valErrors = append(
+			valErrors,
+			fmt.Sprintf(
+				appUpgradeNoPath,
+				cr.Spec.AppID,
+				prevAppCR.Spec.Version,
+				prevCr.Spec.AppID,
+			),
+		)
+	}
+	return valErrors
+}
+
+// ignoreImageChanges copies the image properties of prevAppCR into appCR,
+// so that a comparison of the two ignores image changes. Images can be
+// changed in an app that is in use; clusters using it will upgrade their
+// members to the new images. A change between having and not having a
+// setup image is not ignored.
+func ignoreImageChanges(
+	appCR *kdv1.KubeDirectorApp,
+	prevAppCR *kdv1.KubeDirectorApp,
+) {
+
+	appCR.Spec.DefaultImageRepoTag = prevAppCR.Spec.DefaultImageRepoTag
+	if (appCR.Spec.DefaultSetupImage == nil) == (prevAppCR.Spec.DefaultSetupImage == nil) {
+		appCR.Spec.DefaultSetupImage = prevAppCR.Spec.DefaultSetupImage
+	}
+	for i := range appCR.Spec.NodeRoles {
+		role := &(appCR.Spec.NodeRoles[i])
+		prevRole := catalog.GetRoleFromID(prevAppCR, role.ID)
+		if prevRole == nil {
+			continue
+		}
+		role.ImageRepoTag = prevRole.ImageRepoTag
+		if (role.SetupImage == nil) == (prevRole.SetupImage == nil) {
+			role.SetupImage = prevRole.SetupImage
+		}
+	}
+}
@@ -17,8 +17,10 @@ package validator
 import (
 	"context"
 	"fmt"
+	"regexp"
 	"strings"
 
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
 	"github.com/bluek8s/kubedirector/pkg/cert"
 	"github.com/bluek8s/kubedirector/pkg/observer"
 	"github.com/bluek8s/kubedirector/pkg/shared"
@@ -26,7 +28,6 @@ import (
 	"github.com/operator-framework/operator-sdk/pkg/k8sutil"
 	"k8s.io/api/admissionregistration/v1beta1"
 	v1auth "k8s.io/api/authentication/v1"
-	sar "k8s.io/api/authorization/v1"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	corevalidation "k8s.io/apimachinery/pkg/api/validation"
@@ -157,6 +158,47 @@ func createAdmissionService(
 					},
 				},
 			},
+			// Role scales (and their scale subresource, as updated by a
+			// HorizontalPodAutoscaler) are checked against the cluster.
+			{
+				Operations: []v1beta1.OperationType{
+					v1beta1.Create,
+					v1beta1.Update,
+				},
+				Rule: v1beta1.Rule{
+					APIGroups:   []string{"kubedirector.hpe.com"},
+					APIVersions: []string{"v1beta1"},
+					Resources: []string{
+						"kubedirectorrolescales",
+						"kubedirectorrolescales/scale",
+					},
+				},
+			},
+			// Namespace configs are checked for valid overrides.
+			{
+				Operations: []v1beta1.OperationType{
+					v1beta1.Create,
+					v1beta1.Update,
+				},
+				Rule: v1beta1.Rule{
+					APIGroups:   []string{"kubedirector.hpe.com"},
+					APIVersions: []string{"v1beta1"},
+					Resources:   []string{"kubedirectornamespaceconfigs"},
+				},
+			},
+			// Cluster jobs run commands in members through KubeDirector,
+			// so their creators must be allowed to do that themselves.
+			{
+				Operations: []v1beta1.OperationType{
+					v1beta1.Create,
+					v1beta1.Update,
+				},
+				Rule: v1beta1.Rule{
+					APIGroups:   []string{"kubedirector.hpe.com"},
+					APIVersions: []string{"v1beta1"},
+					Resources:   []string{"kubedirectorclusterjobs"},
+				},
+			},
 		},
 		FailurePolicy: &hardFailurePolicy,
 		SideEffects:   &sideEffectsNone,
@@ -298,6 +340,22 @@ func validateLabelsAndAnnotations(
 		serviceAnnotations,
 		path.Child("serviceAnnotations"),
 	)
+	// Labels that KubeDirector or K8s use in selectors must not be
+	// overridden, since that would break the statefulset selector (which
+	// cannot be changed) or the service selectors.
+	checkReserved := func(labels map[string]string, fieldName string) {
+		for key := range labels {
+			if shared.ReservedLabelKey(key) {
+				anyError = true
+				valErrors = append(
+					valErrors,
+					fmt.Sprintf(reservedLabelKey, key, path.Child(fieldName).String()),
+				)
+			}
+		}
+	}
+	checkReserved(podLabels, "podLabels")
+	checkReserved(serviceLabels, "serviceLabels")
 	if (len(labelErrors) != 0) ||
 		(len(annotationErrors) != 0) ||
 		(len(serviceLabelErrors) != 0) ||
@@ -320,49 +378,118 @@ func validateLabelsAndAnnotations(
 	return valErrors, anyError
 }
 
-// createSubjectAccessReview is a utility function to validate if a user is allowed to access
-// a resource in a namespace. It constructs SubjectAccessReviewSpec using the information
-// provided by the caller and makes the SAR request to API Server. It returns an error string
-// to the caller.
-func createSubjectAccessReview(
-	userInfo v1auth.UserInfo,
-	resourceNamespace string,
-	resourceName string,
-	objectName string,
-	verb string,
-) (errStr string) {
+// validatePVCLabelsAndAnnotations checks the syntax of a role's pvcLabels
+// and pvcAnnotations, and that they do not use keys in the KubeDirector
+// domain (which KubeDirector uses to keep track of them).
+func validatePVCLabelsAndAnnotations(
+	path *field.Path,
+	role *kdv1.Role,
+	valErrors []string,
+) ([]string, bool) {
 
-	// Convert k8s.io/api/authentication/v1".ExtraValue -> k8s.io/api/authorization/v1".ExtraValue
-	xtra := make(map[string]sar.ExtraValue)
-	for k, v := range userInfo.Extra {
-		xtra[k] = sar.ExtraValue(v)
+	anyError := false
+	var fieldErrors field.ErrorList
+	fieldErrors = append(
+		fieldErrors,
+		appsvalidation.ValidateLabels(role.PVCLabels, path.Child("pvcLabels"))...,
+	)
+	fieldErrors = append(
+		fieldErrors,
+		corevalidation.ValidateAnnotations(role.PVCAnnotations, path.Child("pvcAnnotations"))...,
+	)
+	for _, fieldErr := range fieldErrors {
+		anyError = true
+		valErrors = append(valErrors, fieldErr.Error())
 	}
-	sar := &sar.SubjectAccessReview{
-		TypeMeta: metav1.TypeMeta{
-			Kind:       "SubjectAccessReview",
-			APIVersion: "authorization.k8s.io/v1",
-		},
-		Spec: sar.SubjectAccessReviewSpec{
-			ResourceAttributes: &sar.ResourceAttributes{
-				Namespace: resourceNamespace,
-				Verb:      verb,
-				Resource:  resourceName,
-				Name:      objectName,
-			},
-			User:   userInfo.Username,
-			Groups: userInfo.Groups,
-			UID:    userInfo.UID,
-			Extra:  xtra,
-		},
+	checkReserved := func(keys map[string]string, fieldName string) {
+		for key := range keys {
+			if strings.HasPrefix(key, shared.KdDomainBase+"/") {
+				anyError = true
+				valErrors = append(
+					valErrors,
+					fmt.Sprintf(reservedLabelKey, key, path.Child(fieldName).String()),
+				)
+			}
+		}
 	}
-	err := shared.Create(context.TODO(), sar)
-	if err != nil {
-		errStr = err.Error()
-	} else {
-		if sar.Status.Denied {
-			errStr = sar.Status.Reason
+	checkReserved(role.PVCLabels, "pvcLabels")
+	checkReserved(role.PVCAnnotations, "pvcAnnotations")
+	return valErrors, anyError
+}
+
+// memberPlaceholderRegexp matches anything that looks like a placeholder in
+// the value of a per-member service annotation.
+var memberPlaceholderRegexp = regexp.MustCompile(`\{[a-z]+\}`)
+
+// validateMemberServiceAnnotations checks the syntax of the per-member
+// service annotations of a role, that none of them is in the KubeDirector
+// domain, and that their values use only known placeholders.
+func validateMemberServiceAnnotations(
+	path *field.Path,
+	role *kdv1.Role,
+	valErrors []string,
+) ([]string, bool) {
+
+	anyError := false
+	fieldPath := path.Child("memberServiceAnnotations")
+	annotationErrors := corevalidation.ValidateAnnotations(role.MemberServiceAnnotations, fieldPath)
+	for _, annotationErr := range annotationErrors {
+		anyError = true
+		valErrors = append(valErrors, annotationErr.Error())
+	}
+	knownPlaceholders := []string{"{member}", "{role}", "{cluster}", "{namespace}"}
+	for key, value := range role.MemberServiceAnnotations {
+		if strings.HasPrefix(key, shared.KdDomainBase+"/") {
+			anyError = true
+			valErrors = append(
+				valErrors,
+				fmt.Sprintf(reservedLabelKey, key, fieldPath.String()),
+			)
+		}
+		for _, placeholder := range memberPlaceholderRegexp.FindAllString(value, -1) {
+			if !shared.StringInList(placeholder, knownPlaceholders) {
+				anyError = true
+				valErrors = append(
+					valErrors,
+					fmt.Sprintf(unknownMemberPlaceholder, placeholder, fieldPath.Key(key).String()),
+				)
+			}
 		}
 	}
+	return valErrors, anyError
+}
 
-	return
+// checkUserAccess uses a subject access review to find out whether the user
+// is granted the verb on the named object (or, if the name is empty, on all
+// objects) of the given resource type and API group in the namespace. It
+// returns an error string, which is empty if access is allowed. Only an
+// explicit grant allows access; authorizers such as RBAC never deny, they
+// just do not allow.
+func checkUserAccess(
+	userInfo v1auth.UserInfo,
+	namespace string,
+	group string,
+	resource string,
+	name string,
+	verb string,
+) string {
+
+	allowed, reason, reviewErr := shared.UserAllowed(
+		&userInfo,
+		namespace,
+		group,
+		resource,
+		name,
+		verb,
+	)
+	if reviewErr != nil {
+		return reviewErr.Error()
+	}
+	if allowed {
+		return ""
+	}
+	if reason != "" {
+		return reason
+	}
+	return fmt.Sprintf(accessNotGranted, verb, resource)
 }
@@ -0,0 +1,243 @@
+// Copyright 2022 Hewlett Packard Enterprise Development LP
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validator
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	kdv1 "github.com/bluek8s/kubedirector/pkg/apis/kubedirector/v1beta1"
+	"github.com/bluek8s/kubedirector/pkg/catalog"
+	"github.com/bluek8s/kubedirector/pkg/lint"
+	"github.com/bluek8s/kubedirector/pkg/shared"
+	"k8s.io/api/admission/v1beta1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// admissionWarning is a suspicious but allowed setting found in a CR. The
+// ID is what the KubeDirectorConfig escalatedWarnings list refers to. A
+// warning with escalate set is turned into an error regardless of that list.
+type admissionWarning struct {
+	id       string
+	message  string
+	escalate bool
+}
+
+// warnFunc is used as the type for all the callbacks that look for
+// suspicious settings in an admitted CR.
+type warnFunc func(*v1beta1.AdmissionReview) []admissionWarning
+
+// addWarnings runs the warning handler (if any) for the CR in an admitted
+// request. Warnings that the KubeDirectorConfig escalates turn the response
+// into a rejection; the others are returned to be passed back to the user.
+func addWarnings(
+	ar *v1beta1.AdmissionReview,
+	response *v1beta1.AdmissionResponse,
+) []string {
+
+	if !response.Allowed || (ar.Request.Operation == v1beta1.Delete) {
+		return nil
+	}
+	handler, ok := warningHandlers[ar.Request.Kind.Kind]
+	if !ok {
+		return nil
+	}
+	escalated := shared.GetEscalatedWarnings()
+	var warnings []string
+	var errors []string
+	for _, warning := range handler(ar) {
+		msg := fmt.Sprintf("%s: %s", warning.id, warning.message)
+		if warning.escalate || shared.StringInList(warning.id, escalated) {
+			errors = append(errors, msg)
+		} else {
+			warnings = append(warnings, msg)
+		}
+	}
+	if len(errors) != 0 {
+		response.Allowed = false
+		response.Patch = nil
+		response.PatchType = nil
+		response.Result = &metav1.Status{
+			Message: "\n" + strings.Join(errors, "\n"),
+		}
+	}
+	return warnings
+}
+
+// clusterWarnings looks for suspicious settings in a cluster CR: the lint
+// findings of warning or error severity, storage smaller than the app recommends,
+// the deprecated UID naming scheme, newly granted container runtime socket
+// access, and changes that would not fit in the namespace's resource quotas. Nothing is reported for an update that does
+// not change the spec.
+func clusterWarnings(
+	ar *v1beta1.AdmissionReview,
+) []admissionWarning {
+
+	clusterCR := kdv1.KubeDirectorCluster{}
+	if json.Unmarshal(ar.Request.Object.Raw, &clusterCR) != nil {
+		return nil
+	}
+	var prevClusterCR *kdv1.KubeDirectorCluster
+	if ar.Request.Operation == v1beta1.Update {
+		prevClusterCR = &kdv1.KubeDirectorCluster{}
+		if json.Unmarshal(ar.Request.OldObject.Raw, prevClusterCR) != nil {
+			return nil
+		}
+		if equality.Semantic.DeepEqual(clusterCR.Spec, prevClusterCR.Spec) {
+			return nil
+		}
+	}
+
+	var warnings []admissionWarning
+	appCR, _ := catalog.FindApp(&clusterCR)
+	limitsEscalated := shared.StringInList(warnMissingResourceLimits, shared.GetEscalatedWarnings())
+	for _, finding := range lint.Cluster(&clusterCR, appCR, shared.GetLintSeverities()) {
+		if finding.Severity == lint.SeverityInfo {
+			continue
+		}
+		warnings = append(
+			warnings,
+			admissionWarning{
+				id:      finding.Code,
+				message: finding.Message,
+				escalate: (finding.Severity == lint.SeverityError) ||
+					(limitsEscalated && (finding.Code == lint.CodeMissingResourceLimits)),
+			},
+		)
+	}
+	for _, role := range clusterCR.Spec.Roles {
+		if appCR == nil {
+			continue
+		}
+		appRole := catalog.GetRoleFromID(appCR, role.Name)
+		if appRole == nil {
+			continue
+		}
+		minStorage := catalog.GetRoleMinStorage(appRole)
+		if (minStorage == nil) || (minStorage.RecommendedSize == nil) {
+			continue
+		}
+		recommended, recommendedErr := resource.ParseQuantity(*minStorage.RecommendedSize)
+		if recommendedErr != nil {
+			continue
+		}
+		size := "0"
+		if role.Storage != nil {
+			size = role.Storage.Size
+		}
+		quantity, sizeErr := resource.ParseQuantity(size)
+		if (sizeErr == nil) && (quantity.Cmp(recommended) < 0) {
+			warnings = append(
+				warnings,
+				admissionWarning{
+					id: warnStorageBelowRecommended,
+					message: fmt.Sprintf(
+						storageBelowRecommended,
+						size,
+						role.Name,
+						recommended.String(),
+					),
+				},
+			)
+		}
+	}
+
+	namingScheme := shared.GetDefaultNamingScheme()
+	if clusterCR.Spec.NamingScheme != nil {
+		namingScheme = *clusterCR.Spec.NamingScheme
+	}
+	if (ar.Request.Operation == v1beta1.Create) && (namingScheme == kdv1.UID) {
+		warnings = append(
+			warnings,
+			admissionWarning{
+				id:      warnDeprecatedNamingScheme,
+				message: deprecatedNamingScheme,
+			},
+		)
+	}
+
+	prevSockets := make(map[string]*kdv1.RuntimeSocket)
+	if prevClusterCR != nil {
+		for _, prevRole := range prevClusterCR.Spec.Roles {
+			prevSockets[prevRole.Name] = prevRole.RuntimeSocket
+		}
+	}
+	for _, role := range clusterCR.Spec.Roles {
+		socket := role.RuntimeSocket
+		if (socket == nil) || equality.Semantic.DeepEqual(socket, prevSockets[role.Name]) {
+			continue
+		}
+		message := fmt.Sprintf(runtimeSocketPrivileged, role.Name)
+		if socket.Source != kdv1.RuntimeSocketDinD {
+			message = fmt.Sprintf(
+				runtimeSocketNodeAccess,
+				role.Name,
+				socket.Source,
+				kdv1.RuntimeSocketDinD,
+			)
+		}
+		warnings = append(
+			warnings,
+			admissionWarning{
+				id:      warnRuntimeSocketAccess,
+				message: message,
+			},
+		)
+	}
+
+	warnings = append(warnings, quotaWarnings(&clusterCR, prevClusterCR, appCR)...)
+	return warnings
+}
+
+// appWarnings looks for suspicious settings in an app CR. Currently this is
+// the use of the legacy setup package layout.
+func appWarnings(
+	ar *v1beta1.AdmissionReview,
+) []admissionWarning {
+
+	appCR := kdv1.KubeDirectorApp{}
+	if json.Unmarshal(ar.Request.Object.Raw, &appCR) != nil {
+		return nil
+	}
+
+	var warnings []admissionWarning
+	legacyLayout := func(setupPackage kdv1.SetupPackage) bool {
+		return setupPackage.IsSet && !setupPackage.IsNull && !setupPackage.Info.UseNewSetupLayout
+	}
+	if legacyLayout(appCR.Spec.DefaultSetupPackage) {
+		warnings = append(
+			warnings,
+			admissionWarning{
+				id:      warnLegacySetupLayout,
+				message: fmt.Sprintf(legacySetupLayout, "defaultConfigPackage"),
+			},
+		)
+	}
+	for _, role := range appCR.Spec.NodeRoles {
+		if legacyLayout(role.SetupPackage) {
+			warnings = append(
+				warnings,
+				admissionWarning{
+					id:      warnLegacySetupLayout,
+					message: fmt.Sprintf(legacySetupLayout, "configPackage of role "+role.ID),
+				},
+			)
+		}
+	}
+	return warnings
+}